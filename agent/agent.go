@@ -0,0 +1,431 @@
+// Package agent keeps the keys derived from master passwords in a
+// long-running process, so that short-lived commands can unlock a vault
+// without asking for the password and repeating the slow key derivation each
+// time. Clients talk to the agent over a unix socket that only its owner can
+// reach.
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+// SocketEnv names the environment variable that overrides the socket path.
+const SocketEnv = "OPVAULT_AGENT_SOCK"
+
+var (
+	// ErrNotRunning is returned by clients when no agent is listening.
+	ErrNotRunning = errors.New("agent not running")
+	// ErrNoKeys is returned by Client.Keys when the agent doesn't hold keys
+	// for the vault.
+	ErrNoKeys = errors.New("agent has no keys for the vault")
+)
+
+// SocketPath returns the path of the agent's socket: $OPVAULT_AGENT_SOCK if
+// it's set, or else a socket in a per-user directory under $XDG_RUNTIME_DIR
+// or the temporary directory.
+func SocketPath() string {
+	if p := os.Getenv(SocketEnv); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, fmt.Sprintf("opvault-%d", os.Getuid()), "agent.sock")
+}
+
+// VaultID identifies a vault to the agent, as its absolute path or URL and
+// profile name, e.g. "/home/wendy/1Password.opvault#default".
+func VaultID(dbPath, profile string) string {
+	if strings.Contains(dbPath, "://") {
+		return dbPath + "#" + profile
+	}
+	if abs, err := filepath.Abs(dbPath); err == nil {
+		dbPath = abs
+	}
+	return dbPath + "#" + profile
+}
+
+// Requests and responses are single JSON objects, one of each per connection.
+type request struct {
+	Op     string `json:"op"` // "keys", "add", "lock", or "stop"
+	Vault  string `json:"vault,omitempty"`
+	EncKey []byte `json:"encKey,omitempty"`
+	MACKey []byte `json:"macKey,omitempty"`
+}
+
+type response struct {
+	EncKey []byte `json:"encKey,omitempty"`
+	MACKey []byte `json:"macKey,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Metrics receives counts of the agent's requests, so that they can be
+// exported to a monitoring system.
+type Metrics interface {
+	// KeysRequested is called for each request for a vault's keys, with
+	// whether the agent held them.
+	KeysRequested(found bool)
+}
+
+// A Server holds derived keys until it's locked, sits idle for Timeout, or,
+// with LockOnSleep, the system is suspended. With Sessions, the keys are
+// also saved there, so that an agent stopped with Stop and started again
+// still has them; locking removes them.
+type Server struct {
+	Timeout     time.Duration
+	LockOnSleep bool
+	Metrics     Metrics            // Nil unless measuring
+	Sessions    sessionstore.Store // Nil to keep keys only in memory
+
+	mu    sync.Mutex
+	keys  map[string]*crypto.KeyPair
+	used  time.Time
+	ln    net.Listener
+	timer *time.Timer
+}
+
+// sessionName is the name the keys are saved under in Sessions.
+const sessionName = "agent"
+
+// A session is the state saved in Sessions.
+type session struct {
+	Used time.Time                  `json:"used"`
+	Keys map[string]*crypto.KeyPair `json:"keys"`
+}
+
+// Listen creates the socket at path, and the directory holding it with
+// permissions only for the current user. The directory is refused if it
+// already exists and isn't the current user's alone. A stale socket left
+// by an agent that has exited is replaced.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := checkDir(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("agent socket directory: %s", err)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("agent already running on %s", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve answers requests on ln until the server is locked or times out, at
+// which point every key is forgotten and Serve returns nil.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.keys = make(map[string]*crypto.KeyPair)
+	s.used = time.Now()
+	wait := s.Timeout
+	if s.Sessions != nil {
+		wait -= s.restore()
+	}
+	if s.Timeout > 0 {
+		s.timer = time.AfterFunc(wait, s.Lock)
+	}
+	s.mu.Unlock()
+	if s.LockOnSleep {
+		go s.watchSleep()
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			stopped := s.keys == nil
+			s.mu.Unlock()
+			if stopped {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	if checkPeer(conn) != nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var req request
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.used = time.Now()
+	if s.timer != nil {
+		s.timer.Reset(s.Timeout)
+	}
+	switch {
+	case s.keys == nil:
+		resp.Error = "agent locked"
+	case req.Op == "keys":
+		kp, ok := s.keys[req.Vault]
+		if ok {
+			// Copied, as locking wipes the keys held while the response
+			// may still be being written
+			resp.EncKey = append([]byte(nil), kp.EncKey...)
+			resp.MACKey = append([]byte(nil), kp.MACKey...)
+		} else {
+			resp.Error = ErrNoKeys.Error()
+		}
+		if s.Metrics != nil {
+			s.Metrics.KeysRequested(ok)
+		}
+	case req.Op == "add":
+		if len(req.EncKey) != crypto.EncKeySize || len(req.MACKey) != crypto.MACKeySize {
+			resp.Error = "invalid keys"
+		} else {
+			s.keys[req.Vault] = &crypto.KeyPair{EncKey: req.EncKey, MACKey: req.MACKey}
+			s.save()
+		}
+	case req.Op == "lock", req.Op == "stop":
+	default:
+		resp.Error = fmt.Sprintf("unknown request %q", req.Op)
+	}
+	s.mu.Unlock()
+
+	json.NewEncoder(conn).Encode(&resp)
+	wipe(resp.EncKey)
+	wipe(resp.MACKey)
+	switch req.Op {
+	case "lock":
+		s.Lock()
+	case "stop":
+		s.Stop()
+	}
+}
+
+// Sleep is noticed as the wall clock running ahead of the monotonic clock,
+// which stops while the system is suspended on Linux and macOS. Checks are
+// made every sleepCheck, and a gap of sleepThreshold counts as a sleep.
+const (
+	sleepCheck     = 5 * time.Second
+	sleepThreshold = 30 * time.Second
+)
+
+// watchSleep locks the server when the system wakes from sleep.
+func (s *Server) watchSleep() {
+	t := time.NewTicker(sleepCheck)
+	defer t.Stop()
+	last := time.Now()
+	for range t.C {
+		s.mu.Lock()
+		stopped := s.keys == nil
+		s.mu.Unlock()
+		if stopped {
+			return
+		}
+		now := time.Now()
+		// Round(0) strips the monotonic reading, leaving wall time
+		if now.Round(0).Sub(last.Round(0))-now.Sub(last) > sleepThreshold {
+			s.Lock()
+			return
+		}
+		last = now
+	}
+}
+
+// restore adds the keys saved in Sessions, unless they've been unused for
+// Timeout, and returns how long they've been unused.
+func (s *Server) restore() time.Duration {
+	data, err := s.Sessions.Load(sessionName)
+	if err != nil {
+		return 0
+	}
+	defer wipe(data)
+	var saved session
+	if json.Unmarshal(data, &saved) != nil {
+		return 0
+	}
+	idle := time.Since(saved.Used)
+	if idle < 0 || (s.Timeout > 0 && idle >= s.Timeout) {
+		s.Sessions.Delete(sessionName)
+		return 0
+	}
+	for vault, kp := range saved.Keys {
+		if len(kp.EncKey) == crypto.EncKeySize && len(kp.MACKey) == crypto.MACKeySize {
+			s.keys[vault] = kp
+		}
+	}
+	s.used = saved.Used
+	return idle
+}
+
+// save writes the keys to Sessions, if set. Failures only cost the keys
+// surviving a restart, so are ignored.
+func (s *Server) save() {
+	if s.Sessions == nil {
+		return
+	}
+	data, err := json.Marshal(&session{s.used, s.keys})
+	if err != nil {
+		return
+	}
+	s.Sessions.Save(sessionName, data)
+	wipe(data)
+}
+
+// Stop stops the server, forgetting the keys but leaving them in Sessions
+// for the next agent to start.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		return
+	}
+	s.save()
+	s.forget()
+}
+
+// Lock forgets every key, removing them from Sessions, and stops the
+// server.
+func (s *Server) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		return
+	}
+	if s.Sessions != nil {
+		s.Sessions.Delete(sessionName)
+	}
+	s.forget()
+}
+
+// forget wipes the keys and closes the listener.
+func (s *Server) forget() {
+	for _, kp := range s.keys {
+		kp.Zero()
+	}
+	s.keys = nil
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.ln.Close()
+}
+
+// checkPeer returns an error unless the process at the other end of conn
+// runs as the current user.
+func checkPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a unix socket")
+	}
+	uid, err := peerUID(uc)
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("agent socket is held by user %d", uid)
+	}
+	return nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// A Client talks to the agent listening on Path.
+type Client struct {
+	Path string
+}
+
+// NewClient returns a client for the agent at SocketPath.
+func NewClient() *Client {
+	return &Client{SocketPath()}
+}
+
+func (c *Client) call(req *request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.Path, time.Second)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	// Another user's process mustn't be handed keys, or trusted for them
+	if err = checkPeer(conn); err != nil {
+		return nil, fmt.Errorf("agent: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp response
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("agent: %s", err)
+	}
+	if resp.Error == ErrNoKeys.Error() {
+		return nil, ErrNoKeys
+	} else if resp.Error != "" {
+		return nil, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// Running reports whether an agent is listening.
+func (c *Client) Running() bool {
+	conn, err := net.DialTimeout("unix", c.Path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Keys returns the keys held for a vault, as identified by VaultID.
+func (c *Client) Keys(vault string) (*crypto.KeyPair, error) {
+	resp, err := c.call(&request{Op: "keys", Vault: vault})
+	if err != nil {
+		return nil, err
+	}
+	return &crypto.KeyPair{EncKey: resp.EncKey, MACKey: resp.MACKey}, nil
+}
+
+// Add hands the agent the keys for a vault.
+func (c *Client) Add(vault string, kp *crypto.KeyPair) error {
+	_, err := c.call(&request{Op: "add", Vault: vault, EncKey: kp.EncKey, MACKey: kp.MACKey})
+	return err
+}
+
+// Lock makes the agent forget every key and exit.
+func (c *Client) Lock() error {
+	_, err := c.call(&request{Op: "lock"})
+	return err
+}
+
+// Stop makes the agent exit, leaving its keys in its Sessions, if it has
+// any, for the next agent to start with.
+func (c *Client) Stop() error {
+	_, err := c.call(&request{Op: "stop"})
+	return err
+}
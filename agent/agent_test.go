@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+func startServer(t *testing.T, s *Server) (*Client, chan error, func()) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sock", "agent.sock")
+	ln, err := Listen(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	return &Client{path}, done, func() { os.RemoveAll(dir) }
+}
+
+func TestAgent(t *testing.T) {
+	c, done, cleanup := startServer(t, &Server{Timeout: time.Minute})
+	defer cleanup()
+
+	id := VaultID("/vaults/a.opvault", "default")
+	if _, err := c.Keys(id); err != ErrNoKeys {
+		t.Fatalf("Expected ErrNoKeys. Got %v.", err)
+	}
+	kp := &crypto.KeyPair{EncKey: bytes.Repeat([]byte{1}, 32), MACKey: bytes.Repeat([]byte{2}, 32)}
+	if err := c.Add(id, kp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Keys(id)
+	if err != nil || !bytes.Equal(got.EncKey, kp.EncKey) || !bytes.Equal(got.MACKey, kp.MACKey) {
+		t.Fatalf("Unexpected keys %+v, %v", got, err)
+	}
+
+	if err := c.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+	if _, err := c.Keys(id); err != ErrNotRunning {
+		t.Fatalf("Expected ErrNotRunning after locking. Got %v.", err)
+	}
+}
+
+func TestAgentTimeout(t *testing.T) {
+	c, done, cleanup := startServer(t, &Server{Timeout: 50 * time.Millisecond})
+	defer cleanup()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the idle agent to exit.")
+	}
+	if c.Running() {
+		t.Fatalf("Expected the agent to have stopped.")
+	}
+}
+
+// memoryStore is a sessionstore.Store in memory.
+type memoryStore map[string][]byte
+
+func (m memoryStore) Save(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m memoryStore) Load(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, sessionstore.ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m memoryStore) Delete(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func TestAgentSessions(t *testing.T) {
+	store := memoryStore{}
+	s := &Server{Timeout: time.Minute, Sessions: store}
+	c, done, cleanup := startServer(t, s)
+	defer cleanup()
+
+	id := VaultID("/vaults/a.opvault", "default")
+	kp := &crypto.KeyPair{EncKey: bytes.Repeat([]byte{1}, 32), MACKey: bytes.Repeat([]byte{2}, 32)}
+	if err := c.Add(id, kp); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+
+	// A restarted agent has the keys until it's locked
+	c, done, cleanup = startServer(t, &Server{Timeout: time.Minute, Sessions: store})
+	defer cleanup()
+	if got, err := c.Keys(id); err != nil || !bytes.Equal(got.MACKey, kp.MACKey) {
+		t.Fatalf("Expected the saved keys. Got %+v, %v.", got, err)
+	}
+	if err := c.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(store) != 0 {
+		t.Fatalf("Expected locking to remove the saved keys")
+	}
+
+	// Keys unused for longer than the timeout aren't restored
+	store.Save(sessionName, []byte(`{"used":"2001-01-01T00:00:00Z","keys":{"v":{"EncKey":"AQ==","MACKey":"Ag=="}}}`))
+	s = &Server{Timeout: time.Minute, Sessions: store}
+	c, done, cleanup = startServer(t, s)
+	defer cleanup()
+	if _, err := c.Keys("v"); err != ErrNoKeys {
+		t.Fatalf("Expected expired keys to be dropped. Got %v.", err)
+	}
+	s.Lock()
+	<-done
+}
+
+func TestListenDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Directories others can reach, or links to them, might not be ours
+	open := filepath.Join(dir, "open")
+	if err = os.Mkdir(open, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chmod(open, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(filepath.Join(dir, "private"), link); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(filepath.Join(dir, "private"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{open, link} {
+		if ln, err := Listen(filepath.Join(d, "agent.sock")); err == nil {
+			ln.Close()
+			t.Errorf("Expected %s refused", d)
+		}
+	}
+	ln, err := Listen(filepath.Join(dir, "private", "agent.sock"))
+	if err != nil {
+		t.Fatalf("Expected a private directory accepted: %s", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package agent
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkDir returns an error unless dir is a directory, not a link to one.
+// Ownership and permissions aren't told by file modes here.
+func checkDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s isn't a directory", dir)
+	}
+	return nil
+}
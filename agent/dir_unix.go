@@ -0,0 +1,29 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkDir returns an error unless dir is a directory, not a link to one,
+// that belongs to the current user and that only they can use. Otherwise
+// another user could have made it first and be listening in it.
+func checkDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s isn't a directory", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s doesn't belong to the current user", dir)
+	}
+	if fi.Mode().Perm() != 0700 {
+		return fmt.Errorf("%s has mode %s; it must be 0700", dir, fi.Mode().Perm())
+	}
+	return nil
+}
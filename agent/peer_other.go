@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package agent
+
+import (
+	"net"
+	"os"
+)
+
+// peerUID reports the current user where the peer's credentials can't be
+// read, leaving the socket's private directory to keep other users out.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return os.Getuid(), nil
+}
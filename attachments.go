@@ -0,0 +1,103 @@
+package onepassword
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// An Attachment is a file attached to an item, such as the file stored by a
+// Document. Attachments are only available from OPVault directories.
+type Attachment struct {
+	Uuid     string
+	ItemUuid string
+	Name     string // File name, from the encrypted overview
+	Size     int64  // Size of the decrypted contents
+	Created  time.Time
+	Updated  time.Time
+
+	rec *attachmentRecord
+}
+
+type attachmentOverview struct {
+	Filename string `json:"filename"`
+}
+
+// Attachments returns the files attached to an item. Only their overviews
+// are decrypted; use ReadAttachment for the contents.
+func (v *Vault) Attachments(item *Item) ([]Attachment, error) {
+	recs, err := v.store.attachments(item.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	atts := make([]Attachment, len(recs))
+	for i, r := range recs {
+		var ov attachmentOverview
+		if len(r.Overview) > 0 {
+			data, err := crypto.DecryptOPData01(r.Overview, v.overviewKP)
+			if err == nil {
+				err = json.Unmarshal(data, &ov)
+			}
+			if err != nil {
+				return nil, itemError(item.Uuid, "attachment", err)
+			}
+		}
+		atts[i] = Attachment{
+			Uuid:     r.Uuid,
+			ItemUuid: item.Uuid,
+			Name:     ov.Filename,
+			Size:     r.Size,
+			Created:  time.Unix(r.Created, 0),
+			Updated:  time.Unix(r.Updated, 0),
+			rec:      r,
+		}
+	}
+	return atts, nil
+}
+
+// WriteAttachment decrypts an attachment to w a chunk at a time, reading
+// it from its file as it goes, so that attachments of gigabytes can be
+// saved with little memory. It returns the number of bytes written.
+// progress, if not nil, is called after each chunk with the bytes written
+// so far and the attachment's size, and writing stops once ctx is done,
+// as for crypto.DecryptOPData01Stream. The whole attachment is
+// authenticated before anything is written.
+func (v *Vault) WriteAttachment(ctx context.Context, w io.Writer, a *Attachment, progress func(written, total int64)) (int64, error) {
+	r, err := v.store.record(a.ItemUuid)
+	if err != nil {
+		return 0, err
+	}
+	kp, err := crypto.DecryptItemKey(r.Key, v.masterKP)
+	if err != nil {
+		return 0, itemError(r.Uuid, "key", err)
+	}
+	opdata, size, done, err := v.store.attachmentReader(a.rec)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	return crypto.DecryptOPData01Stream(ctx, w, opdata, size, kp, progress)
+}
+
+// ReadAttachment returns the decrypted contents of an attachment.
+func (v *Vault) ReadAttachment(a *Attachment) ([]byte, error) {
+	r, err := v.store.record(a.ItemUuid)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := crypto.DecryptItemKey(r.Key, v.masterKP)
+	if err != nil {
+		return nil, itemError(r.Uuid, "key", err)
+	}
+	opdata, release, err := v.store.attachmentData(a.rec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	data, err := crypto.DecryptOPData01(opdata, kp)
+	return data, itemError(r.Uuid, "attachment", err)
+}
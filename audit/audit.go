@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mpage/onepassword"
+)
+
+//go:embed totp_domains.txt
+var totpDomainList string
+
+// TOTPDomains holds registrable domains known to support time-based one-time
+// passwords.
+var TOTPDomains = parseDomainList(totpDomainList)
+
+func parseDomainList(list string) map[string]bool {
+	domains := make(map[string]bool)
+	s := bufio.NewScanner(strings.NewReader(list))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			domains[strings.ToLower(line)] = true
+		}
+	}
+	return domains
+}
+
+// Options control what the audit considers a problem.
+type Options struct {
+	MinEntropy  float64         // Passwords with fewer bits are weak
+	MaxAge      time.Duration   // Passwords unchanged for longer are old
+	TOTPDomains map[string]bool // Domains whose logins should have TOTP
+	ExpiresIn   time.Duration   // Items expiring sooner are reported
+	Now         time.Time       // Reference time for ages. Defaults to time.Now.
+}
+
+// DefaultOptions flags passwords under 60 bits of entropy, passwords older
+// than two years, and items expiring within 30 days.
+var DefaultOptions = Options{
+	MinEntropy:  60,
+	MaxAge:      2 * 365 * 24 * time.Hour,
+	TOTPDomains: TOTPDomains,
+	ExpiresIn:   30 * 24 * time.Hour,
+}
+
+// An ItemRef identifies an item in a report without carrying its secrets.
+type ItemRef struct {
+	Uuid     string `json:"uuid"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Domain   string `json:"domain,omitempty"`
+}
+
+func refOf(i *onepassword.Item) ItemRef {
+	return ItemRef{i.Uuid, i.Title, i.Category.Name, i.Domain()}
+}
+
+// A ReusedPassword is a password shared by several items.
+type ReusedPassword struct {
+	Fingerprint string    `json:"fingerprint"`
+	Items       []ItemRef `json:"items"`
+}
+
+// A WeakPassword is a password with too little entropy.
+type WeakPassword struct {
+	Item    ItemRef `json:"item"`
+	Entropy float64 `json:"entropy"` // Estimated bits
+}
+
+// An OldPassword is a password that hasn't been changed for too long.
+type OldPassword struct {
+	Item    ItemRef       `json:"item"`
+	Changed time.Time     `json:"changed"`
+	Age     time.Duration `json:"age"`
+}
+
+// An ExpiringItem is an item, such as a passport or credit card, that
+// expires soon or has already expired.
+type ExpiringItem struct {
+	Item    ItemRef   `json:"item"`
+	Expires time.Time `json:"expires"`
+}
+
+// Report lists the problems found by an audit. Items in each list are
+// ordered by title.
+type Report struct {
+	Generated   time.Time        `json:"generated"`
+	Items       int              `json:"items"` // Number of items audited
+	Reused      []ReusedPassword `json:"reused"`
+	Weak        []WeakPassword   `json:"weak"`
+	Old         []OldPassword    `json:"old"`
+	MissingTOTP []ItemRef        `json:"missingTOTP"`
+	Expiring    []ExpiringItem   `json:"expiring"`
+
+	// Populated by BreachChecker.Annotate
+	Breached []BreachedPassword `json:"breached,omitempty"`
+}
+
+// Run audits every item in the vault using DefaultOptions.
+func Run(v *onepassword.Vault) (*Report, error) {
+	items, err := v.Items()
+	if err != nil {
+		return nil, err
+	}
+	return Analyze(items, DefaultOptions), nil
+}
+
+// Analyze audits the supplied items.
+func Analyze(items []onepassword.Item, opts Options) *Report {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	items = append([]onepassword.Item(nil), items...)
+	onepassword.SortItems(items, onepassword.ByTitle)
+
+	r := &Report{Generated: now}
+	reused := make(map[string][]ItemRef)
+	var fingerprints []string
+	for idx := range items {
+		item := &items[idx]
+		if item.Category.Uuid == onepassword.CatTombstone.Uuid {
+			continue
+		}
+		r.Items++
+
+		password := item.Password()
+		if password != "" {
+			fp := PasswordFingerprint(password)
+			if _, ok := reused[fp]; !ok {
+				fingerprints = append(fingerprints, fp)
+			}
+			reused[fp] = append(reused[fp], refOf(item))
+
+			if e := Entropy(password); e < opts.MinEntropy {
+				r.Weak = append(r.Weak, WeakPassword{refOf(item), e})
+			}
+
+			changed := item.PasswordChanged()
+			if age := now.Sub(changed); opts.MaxAge > 0 && !changed.IsZero() && age > opts.MaxAge {
+				r.Old = append(r.Old, OldPassword{refOf(item), changed, age})
+			}
+		}
+
+		if item.Category.Uuid == onepassword.CatLogin.Uuid && opts.TOTPDomains[item.Domain()] && item.TOTP() == "" {
+			r.MissingTOTP = append(r.MissingTOTP, refOf(item))
+		}
+
+		if exp, ok := item.Expiry(); ok && opts.ExpiresIn > 0 && exp.Before(now.Add(opts.ExpiresIn)) {
+			r.Expiring = append(r.Expiring, ExpiringItem{refOf(item), exp})
+		}
+	}
+
+	sort.Strings(fingerprints)
+	for _, fp := range fingerprints {
+		if refs := reused[fp]; len(refs) > 1 {
+			r.Reused = append(r.Reused, ReusedPassword{fp, refs})
+		}
+	}
+
+	return r
+}
+
+// Entropy estimates the strength of a password in bits, assuming each
+// character is drawn at random from the classes of characters it uses.
+// Repeated characters contribute nothing beyond their first occurrence in a
+// run, so "aaaaaaaa" scores as a single character.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	n := 0
+	var prev rune = -1
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if r != prev {
+			n++
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(n) * math.Log2(float64(pool))
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+func TestAnalyze(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	github := login("GitHub", "https://github.com", "wendy", "correct horse battery staple")
+	github.Updated = now.AddDate(-3, 0, 0)
+	bank := login("Bank", "https://bank.example", "wendy", "hunter2")
+	bank.Updated = now
+	mail := login("Mail", "https://mail.example", "wendy", "hunter2")
+	mail.Updated = now
+
+	opts := DefaultOptions
+	opts.Now = now
+	r := Analyze([]onepassword.Item{github, bank, mail}, opts)
+
+	if r.Items != 3 {
+		t.Fatalf("Expected 3 items audited. Got %d.", r.Items)
+	}
+	if len(r.Reused) != 1 || len(r.Reused[0].Items) != 2 || r.Reused[0].Items[0].Title != "Bank" {
+		t.Fatalf("Unexpected reused passwords: %+v", r.Reused)
+	}
+	if len(r.Weak) != 2 {
+		t.Fatalf("Expected both hunter2 logins to be weak: %+v", r.Weak)
+	}
+	if len(r.Old) != 1 || r.Old[0].Item.Title != "GitHub" {
+		t.Fatalf("Unexpected old passwords: %+v", r.Old)
+	}
+	if len(r.MissingTOTP) != 1 || r.MissingTOTP[0].Domain != "github.com" {
+		t.Fatalf("Unexpected missing TOTP: %+v", r.MissingTOTP)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if e := Entropy("aaaaaaaa"); e > 5 {
+		t.Fatalf("Expected repeated characters to score low. Got %v.", e)
+	}
+	if Entropy("Tr0ub4dor&3") <= Entropy("troubador") {
+		t.Fatalf("Expected mixed classes to score higher")
+	}
+}
+
+func TestBreachCheckerSendsOnlyPrefix(t *testing.T) {
+	// SHA-1 of "hunter2" is F3BBBD66A63D4BF1747940578EC3D0103530E21D
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, "D66A63D4BF1747940578EC3D0103530E21D:17043\r\n0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n")
+	}))
+	defer srv.Close()
+
+	c := NewBreachChecker()
+	c.RangeURL = srv.URL + "/range/"
+	r := &Report{}
+	items := []onepassword.Item{
+		login("Bank", "https://bank.example", "wendy", "hunter2"),
+		login("Mail", "https://mail.example", "wendy", "hunter2"),
+	}
+	if err := c.Annotate(r, items); err != nil {
+		t.Fatalf("Failed checking breaches: %s", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/range/F3BBB" {
+		t.Fatalf("Expected a single range request for the prefix. Got %v.", paths)
+	}
+	if len(r.Breached) != 2 || r.Breached[0].Count != 17043 {
+		t.Fatalf("Unexpected breaches: %+v", r.Breached)
+	}
+}
+
+func TestFindingsAndSARIF(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bank := login("Bank", "https://bank.example", "wendy", "hunter2")
+	mail := login("Mail", "https://mail.example", "wendy", "hunter2")
+	passport := onepassword.Item{
+		Uuid:     "P1",
+		Title:    "Passport",
+		Category: onepassword.CatPassport,
+		Details:  []byte(fmt.Sprintf(`{"sections":[{"fields":[{"k":"date","n":"expiry_date","v":%d}]}]}`, now.AddDate(0, 0, 10).Unix())),
+	}
+
+	opts := DefaultOptions
+	opts.Now = now
+	r := Analyze([]onepassword.Item{bank, mail, passport}, opts)
+	if len(r.Expiring) != 1 || r.Expiring[0].Item.Title != "Passport" {
+		t.Fatalf("Unexpected expiring items: %+v", r.Expiring)
+	}
+
+	fs := r.Findings()
+	if len(fs) != 5 || fs[0].Rule != RuleReused || fs[0].Message != "password also used by Mail" || fs[4].Rule != RuleExpiring {
+		t.Fatalf("Unexpected findings: %+v", fs)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if res := log.Runs[0].Results; len(res) != 5 || res[0].Level != "warning" || res[0].Locations[0].LogicalLocations[0].Name != "Bank" {
+		t.Fatalf("Unexpected SARIF results: %+v", res)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("SARIF output contains a password")
+	}
+}
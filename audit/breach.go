@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// DefaultRangeURL is the Have I Been Pwned "Pwned Passwords" range API.
+const DefaultRangeURL = "https://api.pwnedpasswords.com/range/"
+
+// A BreachedPassword is a password found in known data breaches.
+type BreachedPassword struct {
+	Item  ItemRef `json:"item"`
+	Count int     `json:"count"` // Times the password appears in breaches
+}
+
+// A BreachChecker looks up passwords in the Pwned Passwords database using
+// its k-anonymity range API: only the first five hex characters of a
+// password's SHA-1 hash are sent, and matching is done locally against the
+// returned suffixes. Neither passwords nor full hashes leave the machine.
+//
+// Checking is opt-in; nothing in this package contacts the network unless a
+// BreachChecker is used.
+type BreachChecker struct {
+	Client   *http.Client
+	RangeURL string
+
+	ranges map[string]map[string]int // Hash prefix -> suffix -> count
+}
+
+func NewBreachChecker() *BreachChecker {
+	return &BreachChecker{
+		Client:   http.DefaultClient,
+		RangeURL: DefaultRangeURL,
+		ranges:   make(map[string]map[string]int),
+	}
+}
+
+// Count returns the number of times password appears in known breaches.
+func (c *BreachChecker) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	suffixes, ok := c.ranges[prefix]
+	if !ok {
+		var err error
+		suffixes, err = c.fetchRange(prefix)
+		if err != nil {
+			return 0, err
+		}
+		c.ranges[prefix] = suffixes
+	}
+
+	return suffixes[suffix], nil
+}
+
+func (c *BreachChecker) fetchRange(prefix string) (map[string]int, error) {
+	req, err := http.NewRequest("GET", c.RangeURL+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "onepassword-audit")
+	// Padding hides the true number of matching suffixes from observers
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pwned passwords: unexpected status %s", resp.Status)
+	}
+
+	suffixes := make(map[string]int)
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(s.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n == 0 {
+			// Padding entries have a count of zero
+			continue
+		}
+		suffixes[strings.ToUpper(parts[0])] = n
+	}
+
+	return suffixes, s.Err()
+}
+
+// Annotate checks the password of every item and records those found in
+// breaches in r.Breached, ordered by title.
+func (c *BreachChecker) Annotate(r *Report, items []onepassword.Item) error {
+	items = append([]onepassword.Item(nil), items...)
+	onepassword.SortItems(items, onepassword.ByTitle)
+
+	r.Breached = nil
+	for idx := range items {
+		item := &items[idx]
+		password := item.Password()
+		if password == "" || item.Category.Uuid == onepassword.CatTombstone.Uuid {
+			continue
+		}
+		n, err := c.Count(password)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			r.Breached = append(r.Breached, BreachedPassword{refOf(item), n})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package audit analyzes the items in a vault for problems worth fixing,
+// such as duplicated items and weak or reused passwords.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// Reasons items are considered duplicates of each other.
+const (
+	SameLogin    = "same-login"    // Same registrable domain and username
+	SamePassword = "same-password" // Identical passwords
+	SameTitle    = "same-title"    // Identical titles, ignoring case
+)
+
+// A DuplicateGroup is a set of items that are likely duplicates of each
+// other.
+type DuplicateGroup struct {
+	Reason     string
+	Key        string // What the items share. Passwords are represented by a hash prefix.
+	Items      []onepassword.Item
+	Confidence float64 // In (0, 1]. How likely the items really are duplicates.
+}
+
+// FindDuplicates groups items that look like duplicates. An item may appear
+// in several groups with different reasons. Groups are ordered from most to
+// least confident.
+func FindDuplicates(items []onepassword.Item) []DuplicateGroup {
+	byLogin := make(map[string][]onepassword.Item)
+	byPassword := make(map[string][]onepassword.Item)
+	byTitle := make(map[string][]onepassword.Item)
+
+	for _, item := range items {
+		if item.Category.Uuid == onepassword.CatTombstone.Uuid {
+			continue
+		}
+		if d, u := item.Domain(), item.Username(); d != "" && u != "" {
+			key := d + " " + strings.ToLower(u)
+			byLogin[key] = append(byLogin[key], item)
+		}
+		if p := item.Password(); p != "" {
+			key := PasswordFingerprint(p)
+			byPassword[key] = append(byPassword[key], item)
+		}
+		if t := strings.ToLower(strings.TrimSpace(item.Title)); t != "" {
+			byTitle[t] = append(byTitle[t], item)
+		}
+	}
+
+	var groups []DuplicateGroup
+	add := func(reason string, m map[string][]onepassword.Item, score func([]onepassword.Item) float64) {
+		for key, group := range m {
+			if len(group) > 1 {
+				groups = append(groups, DuplicateGroup{reason, key, group, score(group)})
+			}
+		}
+	}
+	add(SameLogin, byLogin, func(g []onepassword.Item) float64 {
+		return 0.8 + 0.1*bool2f(allSame(g, passwordOf)) + 0.1*bool2f(allSame(g, titleOf))
+	})
+	add(SamePassword, byPassword, func(g []onepassword.Item) float64 {
+		return 0.3 + 0.3*bool2f(allSame(g, domainOf))
+	})
+	add(SameTitle, byTitle, func(g []onepassword.Item) float64 {
+		return 0.4 + 0.2*bool2f(allSame(g, categoryOf)) + 0.2*bool2f(allSame(g, domainOf))
+	})
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Confidence != groups[j].Confidence {
+			return groups[i].Confidence > groups[j].Confidence
+		}
+		if groups[i].Reason != groups[j].Reason {
+			return groups[i].Reason < groups[j].Reason
+		}
+		return groups[i].Key < groups[j].Key
+	})
+
+	return groups
+}
+
+// PasswordFingerprint identifies a password without revealing it, so that
+// reports can group items sharing a password.
+func PasswordFingerprint(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+func passwordOf(i *onepassword.Item) string { return i.Password() }
+func titleOf(i *onepassword.Item) string    { return strings.ToLower(i.Title) }
+func domainOf(i *onepassword.Item) string   { return i.Domain() }
+func categoryOf(i *onepassword.Item) string { return i.Category.Uuid }
+
+// allSame returns true if key yields the same non-empty value for every item.
+func allSame(items []onepassword.Item, key func(*onepassword.Item) string) bool {
+	first := key(&items[0])
+	if first == "" {
+		return false
+	}
+	for i := range items[1:] {
+		if key(&items[i+1]) != first {
+			return false
+		}
+	}
+	return true
+}
+
+func bool2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mpage/onepassword"
+)
+
+func login(title, url, username, password string) onepassword.Item {
+	details := fmt.Sprintf(`{"fields":[{"designation":"username","value":%q},{"designation":"password","value":%q}]}`, username, password)
+	return onepassword.Item{
+		Title:    title,
+		Url:      url,
+		Category: onepassword.CatLogin,
+		Details:  []byte(details),
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	groups := FindDuplicates([]onepassword.Item{
+		login("GitHub", "https://github.com", "wendy", "a"),
+		login("github", "https://gist.github.com", "Wendy", "a"),
+		login("Bank", "https://bank.example", "wendy", "a"),
+		login("Mail", "https://mail.example", "wendy", "b"),
+	})
+
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups. Got %+v.", groups)
+	}
+	first := groups[0]
+	if first.Reason != SameLogin || first.Key != "github.com wendy" || first.Confidence != 1 {
+		t.Fatalf("Unexpected first group: %+v", first)
+	}
+	for _, g := range groups {
+		if g.Reason == SamePassword && len(g.Items) != 3 {
+			t.Fatalf("Expected three items sharing a password: %+v", g)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Rules identify the kinds of problem an audit finds.
+const (
+	RuleWeak        = "weak-password"
+	RuleReused      = "reused-password"
+	RuleBreached    = "breached-password"
+	RuleOld         = "old-password"
+	RuleMissingTOTP = "missing-totp"
+	RuleExpiring    = "expiring-item"
+)
+
+// A Rule describes a kind of problem.
+type Rule struct {
+	Id          string
+	Description string
+	Level       string // SARIF level: "error", "warning", or "note"
+}
+
+// Rules lists every rule, most serious first.
+var Rules = []Rule{
+	{RuleBreached, "Password found in known data breaches", "error"},
+	{RuleReused, "Password shared with other items", "warning"},
+	{RuleWeak, "Password too easy to guess", "warning"},
+	{RuleOld, "Password unchanged for a long time", "note"},
+	{RuleMissingTOTP, "Site supports one-time passwords, but none are set up", "note"},
+	{RuleExpiring, "Item expires soon or has expired", "note"},
+}
+
+// A Finding is a single problem with a single item.
+type Finding struct {
+	Rule    string  `json:"rule"`
+	Item    ItemRef `json:"item"`
+	Message string  `json:"message"`
+}
+
+// Findings lists the problems in the report one item at a time, grouped by
+// rule in the order of Rules. An item using a reused password gets a
+// finding for each.
+func (r *Report) Findings() []Finding {
+	var fs []Finding
+	add := func(rule string, item ItemRef, format string, args ...interface{}) {
+		fs = append(fs, Finding{rule, item, fmt.Sprintf(format, args...)})
+	}
+
+	for _, b := range r.Breached {
+		add(RuleBreached, b.Item, "password appears %d times in breaches", b.Count)
+	}
+	for _, reused := range r.Reused {
+		for i, item := range reused.Items {
+			var others []string
+			for j, other := range reused.Items {
+				if j != i {
+					others = append(others, other.Title)
+				}
+			}
+			add(RuleReused, item, "password also used by %s", strings.Join(others, ", "))
+		}
+	}
+	for _, w := range r.Weak {
+		add(RuleWeak, w.Item, "password has about %.0f bits of entropy", w.Entropy)
+	}
+	for _, o := range r.Old {
+		add(RuleOld, o.Item, "password unchanged since %s", o.Changed.Format("2006-01-02"))
+	}
+	for _, item := range r.MissingTOTP {
+		add(RuleMissingTOTP, item, "%s supports one-time passwords", item.Domain)
+	}
+	for _, e := range r.Expiring {
+		verb := "expires"
+		if e.Expires.Before(r.Generated) {
+			verb = "expired"
+		}
+		add(RuleExpiring, e.Item, "%s %s", verb, e.Expires.Format("2006-01-02"))
+	}
+	return fs
+}
+
+// The subset of SARIF 2.1.0 needed to report findings.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	DefaultConfig    struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool      `json:"executionSuccessful"`
+	EndTimeUtc          time.Time `json:"endTimeUtc"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteSARIF writes the report as a SARIF 2.1.0 log, for tools that collect
+// static analysis results. Items are reported as logical locations named by
+// title, with their uuid as the fully qualified name; no secrets are
+// included.
+func (r *Report) WriteSARIF(w io.Writer) error {
+	run := sarifRun{
+		Invocations: []sarifInvocation{{true, r.Generated.UTC()}},
+		Results:     []sarifResult{},
+	}
+	run.Tool.Driver.Name = "opvault audit"
+	levels := make(map[string]string)
+	for _, rule := range Rules {
+		sr := sarifRule{Id: rule.Id, ShortDescription: sarifMessage{rule.Description}}
+		sr.DefaultConfig.Level = rule.Level
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sr)
+		levels[rule.Id] = rule.Level
+	}
+	for _, f := range r.Findings() {
+		run.Results = append(run.Results, sarifResult{
+			RuleId:  f.Rule,
+			Level:   levels[f.Rule],
+			Message: sarifMessage{fmt.Sprintf("%s: %s", f.Item.Title, f.Message)},
+			Locations: []sarifLocation{{[]sarifLogicalLocation{{
+				Name:               f.Item.Title,
+				FullyQualifiedName: f.Item.Uuid,
+				Kind:               "object",
+			}}}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
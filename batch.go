@@ -0,0 +1,95 @@
+package onepassword
+
+import (
+	"context"
+	"runtime"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+)
+
+// lookupBatch is how many records LookupItems decrypts at once before
+// filtering them, which bounds the items held that may not match.
+const lookupBatch = 256
+
+// DecryptOverviews returns the items with the supplied uuids, in the same
+// order, with their overviews decrypted but not their details. Up to
+// parallelism overviews are decrypted at once, or GOMAXPROCS if
+// parallelism isn't positive. Workers take one item at a time, so nothing
+// but the results grows with the number of items. Decryption stops at the
+// first error, or when ctx is done.
+func (v *Vault) DecryptOverviews(ctx context.Context, uuids []string, parallelism int) ([]Item, error) {
+	recs := make([]*record, len(uuids))
+	for i, uuid := range uuids {
+		r, err := v.store.record(uuid)
+		if err != nil {
+			return nil, err
+		}
+		recs[i] = r
+	}
+	return v.decryptRecords(ctx, recs, parallelism, false)
+}
+
+// decryptRecords returns the items described by recs, in order, with their
+// overviews decrypted, and their details too if details is set, using up
+// to parallelism goroutines.
+func (v *Vault) decryptRecords(ctx context.Context, recs []*record, parallelism int, details bool) ([]Item, error) {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	if parallelism > len(recs) {
+		parallelism = len(recs)
+	}
+	defer trace.StartRegion(ctx, "onepassword.decryptItems").End()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	items := make([]Item, len(recs))
+	var (
+		wg       sync.WaitGroup
+		next     int64 = -1
+		failOnce sync.Once
+		failed   error
+	)
+	decrypt := func(r *record, item *Item) error {
+		decrypted, err := v.decryptOverview(r)
+		if err != nil {
+			return err
+		}
+		if details {
+			if err = v.decryptDetails(r, decrypted); err != nil {
+				return err
+			}
+		}
+		*item = *decrypted
+		return nil
+	}
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(recs) {
+					return
+				}
+				if err := decrypt(recs[i], &items[i]); err != nil {
+					failOnce.Do(func() {
+						failed = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, failed
+	}
+	// Only the caller's ctx is done unless a worker failed
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,41 @@
+package onepassword
+
+import "strings"
+
+// A DisplayScope controls where an item may be offered for filling. It is
+// stored in the item overview as "scope".
+type DisplayScope string
+
+const (
+	ScopeAlways DisplayScope = "Always" // Offer the item everywhere. The default.
+	ScopeNever  DisplayScope = "Never"  // Never display the item in the browser.
+)
+
+// An AutosubmitMode controls whether a filled login form is submitted
+// automatically. It is stored in the item overview as "autosubmit".
+type AutosubmitMode string
+
+const (
+	AutosubmitDefault AutosubmitMode = "" // Follow the user's global preference.
+	AutosubmitAlways  AutosubmitMode = "Always"
+	AutosubmitNever   AutosubmitMode = "Never"
+)
+
+// DisplayInBrowser returns false if the item is marked "never display in
+// browser". Items without a scope are displayed.
+func (i *Item) DisplayInBrowser() bool {
+	return !strings.EqualFold(string(i.Scope), string(ScopeNever))
+}
+
+// ShouldAutosubmit resolves the item's autosubmit mode against the caller's
+// global preference.
+func (i *Item) ShouldAutosubmit(preference bool) bool {
+	switch {
+	case strings.EqualFold(string(i.Autosubmit), string(AutosubmitAlways)):
+		return true
+	case strings.EqualFold(string(i.Autosubmit), string(AutosubmitNever)):
+		return false
+	default:
+		return preference
+	}
+}
@@ -0,0 +1,129 @@
+package onepassword
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// benchmarkSizes are the numbers of items in the synthetic vaults that
+// benchmarks run against.
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+var (
+	syntheticMu     sync.Mutex
+	syntheticVaults = make(map[int]*opvaultFixture)
+)
+
+// syntheticVault returns a fixture holding n logins, made once for each n
+// as large ones take a while.
+func syntheticVault(b *testing.B, n int) *opvaultFixture {
+	syntheticMu.Lock()
+	defer syntheticMu.Unlock()
+	if f, ok := syntheticVaults[n]; ok {
+		f.t = b
+		return f
+	}
+	f := newOPVaultFixture(b)
+	for i := 0; i < n; i++ {
+		overview := fmt.Sprintf(`{"title":"Login %d","url":"https://example%d.com","tags":["bench"]}`, i, i%500)
+		f.putItem(NewUUID(), CatLogin.Uuid, overview, loginDetails, false)
+	}
+	for _, c := range "0123456789ABCDEF" {
+		f.writeBand(string(c))
+	}
+	syntheticVaults[n] = f
+	return f
+}
+
+// runSizes runs bench against a synthetic vault of each size.
+func runSizes(b *testing.B, bench func(b *testing.B, f *opvaultFixture)) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			f := syntheticVault(b, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			bench(b, f)
+		})
+	}
+}
+
+// BenchmarkOpen unlocks a vault and loads its bands, as the first read
+// does.
+func BenchmarkOpen(b *testing.B) {
+	runSizes(b, func(b *testing.B, f *opvaultFixture) {
+		for i := 0; i < b.N; i++ {
+			v, err := NewVaultFS(f.fsys, "default", testPassword)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = v.store.records(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkOverviews(b *testing.B) {
+	runSizes(b, func(b *testing.B, f *opvaultFixture) {
+		v := f.open()
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Overviews(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkItems decrypts every item, as listing does.
+func BenchmarkItems(b *testing.B) {
+	runSizes(b, func(b *testing.B, f *opvaultFixture) {
+		v := f.open()
+		for i := 0; i < b.N; i++ {
+			if _, err := v.Items(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSearchIndex builds the search index from items already
+// decrypted.
+func BenchmarkSearchIndex(b *testing.B) {
+	runSizes(b, func(b *testing.B, f *opvaultFixture) {
+		b.StopTimer()
+		items, err := f.open().Items()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		for i := 0; i < b.N; i++ {
+			newItemIndex(items)
+		}
+	})
+}
+
+// BenchmarkDecryptOverviews shows how decrypting overviews scales with the
+// number of workers, up to the number of cores.
+func BenchmarkDecryptOverviews(b *testing.B) {
+	v := syntheticVault(b, 10000).open()
+	recs, err := v.store.records()
+	if err != nil {
+		b.Fatal(err)
+	}
+	uuids := make([]string, len(recs))
+	for i, r := range recs {
+		uuids[i] = r.Uuid
+	}
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := v.DecryptOverviews(context.Background(), uuids, n); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
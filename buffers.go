@@ -0,0 +1,67 @@
+package onepassword
+
+import (
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/secure"
+)
+
+// decryptBuffer decrypts an OPData01 blob into a buffer from the pool.
+func decryptBuffer(opdata []byte, kp *crypto.KeyPair) (*secure.Buffer, error) {
+	buf := secure.Get(len(opdata))
+	dst := buf.Bytes()
+	plaintext, err := crypto.DecryptOPData01Into(dst, opdata, kp)
+	if err != nil {
+		buf.Release()
+		return nil, err
+	}
+	// The plaintext follows the padding at the start of dst
+	start := cap(dst) - cap(plaintext)
+	buf.Slice(start, start+len(plaintext))
+	return buf, nil
+}
+
+// DetailsBuffer returns the decrypted details of the item with the
+// supplied uuid, the JSON that Item.Details holds, in a buffer from the
+// secure package's pool, so that servers decide when they're wiped by
+// calling Release. They're always decrypted, as the item cache is only
+// for Items.
+func (v *Vault) DetailsBuffer(uuid string) (*secure.Buffer, error) {
+	r, err := v.store.record(uuid)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := crypto.DecryptItemKey(r.Key, v.masterKP)
+	if err != nil {
+		return nil, itemError(r.Uuid, "key", err)
+	}
+	if r.Details == nil {
+		if err = v.store.details(r); err != nil {
+			return nil, err
+		}
+	}
+	defer observeDecrypt(v.metrics, "details", time.Now())
+	buf, err := decryptBuffer(r.Details, kp)
+	return buf, itemError(r.Uuid, "details", err)
+}
+
+// AttachmentBuffer returns the decrypted contents of an attachment, as
+// ReadAttachment does, in a buffer from the secure package's pool.
+func (v *Vault) AttachmentBuffer(a *Attachment) (*secure.Buffer, error) {
+	r, err := v.store.record(a.ItemUuid)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := crypto.DecryptItemKey(r.Key, v.masterKP)
+	if err != nil {
+		return nil, itemError(r.Uuid, "key", err)
+	}
+	opdata, release, err := v.store.attachmentData(a.rec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	buf, err := decryptBuffer(opdata, kp)
+	return buf, itemError(r.Uuid, "attachment", err)
+}
@@ -0,0 +1,106 @@
+package onepassword
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Category) // For uuid -> category
+)
+
+func init() {
+	builtin := []Category{
+		CatLogin, CatCreditCard, CatSecureNote, CatIdentity, CatPassword,
+		CatTombstone, CatSoftwareLicense, CatBankAccount, CatDatabase,
+		CatDriverLicense, CatOutdoorLicense, CatMembership, CatPassport,
+		CatRewards, CatSSN, CatRouter, CatServer, CatEmail, CatDocument,
+		CatAPICredential, CatMedicalRecord, CatSSHKey, CatCryptoWallet,
+	}
+	for _, c := range builtin {
+		registry[c.Uuid] = c
+	}
+}
+
+// RegisterCategory makes a category known to the package. Items whose
+// category is not described by the database are resolved through the
+// registry. Registering a uuid a second time replaces the previous name.
+func RegisterCategory(uuid, name string) Category {
+	c := Category{uuid, name}
+
+	registryMu.Lock()
+	registry[uuid] = c
+	registryMu.Unlock()
+
+	return c
+}
+
+// CategoryByUUID returns the registered category with the supplied uuid.
+func CategoryByUUID(uuid string) (Category, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	c, ok := registry[uuid]
+	return c, ok
+}
+
+// CategoryByName returns the registered category with the supplied name.
+// Matching ignores case as well as spaces, dashes, and underscores, so
+// "credit-card", "CreditCard", and "Credit Card" all find CatCreditCard. If
+// several registered categories match, the one with the lowest uuid wins, so
+// a custom category can't shadow a builtin one of the same name.
+func CategoryByName(name string) (Category, bool) {
+	key := foldCategoryName(name)
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var found Category
+	ok := false
+	for _, c := range registry {
+		if foldCategoryName(c.Name) == key && (!ok || c.Uuid < found.Uuid) {
+			found, ok = c, true
+		}
+	}
+
+	return found, ok
+}
+
+// AllCategories returns every registered category ordered by uuid.
+func AllCategories() []Category {
+	registryMu.RLock()
+	cats := make([]Category, 0, len(registry))
+	for _, c := range registry {
+		cats = append(cats, c)
+	}
+	registryMu.RUnlock()
+
+	sort.Slice(cats, func(i, j int) bool { return cats[i].Uuid < cats[j].Uuid })
+
+	return cats
+}
+
+func foldCategoryName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// resolveCategory looks up the category with the supplied uuid in the
+// registry. Unregistered uuids resolve to a generic "Unknown" category that
+// still carries the uuid, so callers can tell unknown categories apart.
+func resolveCategory(uuid string) Category {
+	c, ok := CategoryByUUID(uuid)
+	if !ok {
+		c = Category{uuid, fmt.Sprintf("Unknown (%s)", uuid)}
+	}
+
+	return c
+}
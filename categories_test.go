@@ -0,0 +1,92 @@
+package onepassword
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestResolveBuiltinCategory(t *testing.T) {
+	if c := resolveCategory("001"); c != CatLogin {
+		t.Fatalf("Expected %v. Got %v.", CatLogin, c)
+	}
+}
+
+func TestRegisterCategory(t *testing.T) {
+	c := RegisterCategory("900", "Custom")
+	if got := resolveCategory("900"); got != c {
+		t.Fatalf("Expected %v. Got %v.", c, got)
+	}
+}
+
+func TestResolveUnknownCategory(t *testing.T) {
+	c := resolveCategory("999")
+	if c.Uuid != "999" || c.Name != "Unknown (999)" {
+		t.Fatalf("Unexpected category for unknown uuid: %v", c)
+	}
+}
+
+func TestCategoryByName(t *testing.T) {
+	for _, name := range []string{"Credit Card", "credit-card", "CREDITCARD", "credit_card"} {
+		c, ok := CategoryByName(name)
+		if !ok || c != CatCreditCard {
+			t.Fatalf("Expected %q to find %v. Got %v.", name, CatCreditCard, c)
+		}
+	}
+	if _, ok := CategoryByName("no such category"); ok {
+		t.Fatalf("Expected lookup of unknown name to fail")
+	}
+}
+
+func TestCategoryByNameCollision(t *testing.T) {
+	RegisterCategory("998", "credit card")
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "998")
+		registryMu.Unlock()
+	}()
+	for i := 0; i < 20; i++ {
+		if c, _ := CategoryByName("Credit Card"); c != CatCreditCard {
+			t.Fatalf("Expected %v. Got %v.", CatCreditCard, c)
+		}
+	}
+}
+
+func TestAllCategoriesSorted(t *testing.T) {
+	cats := AllCategories()
+	for i := 1; i < len(cats); i++ {
+		if cats[i-1].Uuid >= cats[i].Uuid {
+			t.Fatalf("Categories not sorted: %v before %v", cats[i-1], cats[i])
+		}
+	}
+}
+
+func TestCategoryJSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(CatCreditCard)
+	if err != nil {
+		t.Fatalf("Failed marshaling category: %s", err)
+	}
+
+	var c Category
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("Failed unmarshaling %s: %s", data, err)
+	} else if c != CatCreditCard {
+		t.Fatalf("Expected %v. Got %v.", CatCreditCard, c)
+	}
+
+	if err := json.Unmarshal([]byte(`"106"`), &c); err != nil {
+		t.Fatalf("Failed unmarshaling bare uuid: %s", err)
+	} else if c != CatPassport {
+		t.Fatalf("Expected %v. Got %v.", CatPassport, c)
+	}
+}
+
+func TestItemDetailsMarshalAsJSON(t *testing.T) {
+	item := Item{Title: "t", Details: []byte(`{"notesPlain":"hi"}`)}
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("Failed marshaling item: %s", err)
+	} else if !bytes.Contains(data, []byte(`"details":{"notesPlain":"hi"}`)) {
+		t.Fatalf("Details not embedded as JSON: %s", data)
+	}
+}
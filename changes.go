@@ -0,0 +1,72 @@
+package onepassword
+
+import "sort"
+
+// A ChangeSet lists the uuids of the items changed in a vault since a
+// watermark, and the watermark to ask for the changes after them.
+type ChangeSet struct {
+	Added     []string `json:"added"`
+	Modified  []string `json:"modified"`
+	Deleted   []string `json:"deleted"` // Moved to the trash
+	Watermark uint64   `json:"watermark"`
+}
+
+// ChangesSince lists the items changed in transactions at or after tx,
+// so external systems can be kept up to date without comparing full
+// exports: pass 0 the first time, which lists every item as added, and the
+// returned watermark thereafter. Items are added if they were created at
+// or after tx, and deleted if they're in the trash.
+//
+// A vault's transactions are numbered by the second in which they were
+// made, so items changed in the same second as the watermark are listed
+// again next time; the changes are meant to be applied idempotently.
+// Items removed from the trash for good aren't listed, as nothing of them
+// is left to read. Items without a recorded transaction, as in SQLite
+// databases, are compared by modification time.
+func (v *Vault) ChangesSince(tx uint64) (*ChangeSet, error) {
+	recs, err := v.store.records()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := v.store.trashed()
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &ChangeSet{Watermark: tx}
+	add := func(list *[]string, r *record) {
+		t := recordTx(r)
+		if t > cs.Watermark {
+			cs.Watermark = t
+		}
+		if tx == 0 || t >= tx {
+			*list = append(*list, r.Uuid)
+		}
+	}
+	for _, r := range recs {
+		if tx == 0 || r.Created >= int64(tx) {
+			add(&cs.Added, r)
+		} else {
+			add(&cs.Modified, r)
+		}
+	}
+	for _, r := range trashed {
+		add(&cs.Deleted, r)
+	}
+	sort.Strings(cs.Added)
+	sort.Strings(cs.Modified)
+	sort.Strings(cs.Deleted)
+	return cs, nil
+}
+
+// recordTx returns the transaction of a record's last change, falling back
+// to its modification time.
+func recordTx(r *record) uint64 {
+	if r.Tx > 0 {
+		return uint64(r.Tx)
+	}
+	if r.Updated > 0 {
+		return uint64(r.Updated)
+	}
+	return 0
+}
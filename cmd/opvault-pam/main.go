@@ -0,0 +1,50 @@
+//go:build unix
+
+// Command opvault-pam writes users' secrets from a system vault when they
+// log in. It's run by pam_exec from a session line in the PAM
+// configuration:
+//
+//	session optional pam_exec.so quiet /usr/local/bin/opvault-pam
+//
+// See package github.com/mpage/onepassword/pam for its configuration.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword/pam"
+)
+
+func main() {
+	config := flag.String("config", pam.DefaultConfigPath, "read the configuration from `file`")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*config); err != nil {
+		// pam_exec logs standard error with its log= option
+		fmt.Fprintf(os.Stderr, "opvault-pam: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(config string) error {
+	// A setuid copy would let any user run it with an environment of their
+	// choosing
+	if os.Geteuid() != os.Getuid() {
+		return fmt.Errorf("refusing to run setuid")
+	}
+	ev, err := pam.EventFromEnv(os.Getenv)
+	if err != nil {
+		return err
+	}
+	c, err := pam.LoadConfig(config)
+	if err != nil {
+		return err
+	}
+	return c.Run(ev)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/agent"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+// runAgent starts the agent in the background, or with -foreground serves
+// in this process.
+func runAgent(args []string) error {
+	fs := newFlagSet("agent")
+	timeout := fs.Duration("timeout", 15*time.Minute, "forget the keys and exit after this long without use")
+	lockOnSleep := fs.Bool("lock-on-sleep", true, "forget the keys when the system wakes from sleep")
+	foreground := fs.Bool("foreground", false, "serve in the foreground instead of starting a background process")
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on `address`")
+	persist := fs.Bool("persist", false, "keep the keys across restarts with -stop in the OS keyring, Keychain, or DPAPI")
+	stop := fs.Bool("stop", false, "stop the running agent, keeping its keys for the next if it was started with -persist")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path := agent.SocketPath()
+	if *stop {
+		return (&agent.Client{Path: path}).Stop()
+	}
+	if *foreground {
+		s := &agent.Server{Timeout: *timeout, LockOnSleep: *lockOnSleep}
+		if m := serveMetrics(*metricsAddr); m != nil {
+			s.Metrics = m
+		}
+		if *persist {
+			store, err := sessionstore.Default("opvault")
+			if err != nil {
+				return err
+			}
+			s.Sessions = store
+		}
+		return serveAgent(path, s)
+	}
+
+	c := &agent.Client{Path: path}
+	if c.Running() {
+		return fmt.Errorf("agent already running on %s", path)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "agent", "-foreground", "-timeout", timeout.String(), fmt.Sprintf("-lock-on-sleep=%t", *lockOnSleep), "-metrics", *metricsAddr, fmt.Sprintf("-persist=%t", *persist))
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("agent exited: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if c.Running() {
+			note("agent listening on %s", path)
+			return nil
+		}
+	}
+	return fmt.Errorf("agent didn't start listening on %s", path)
+}
+
+// serveAgent serves until the agent is locked, stopped, times out, or is
+// signalled. Signals lock it, so keys are only kept for the next agent when
+// it's stopped with -stop.
+func serveAgent(path string, s *agent.Server) error {
+	ln, err := agent.Listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-sigs
+		s.Lock()
+	}()
+	return s.Serve(ln)
+}
+
+// runLock makes the agent forget its keys and exit, and removes the key
+// cache and the vault's search index cache.
+func runLock(args []string) error {
+	fs := newFlagSet("lock")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	err := agent.NewClient().Lock()
+	if err != nil && err != agent.ErrNotRunning {
+		return err
+	}
+	if err = clearKeyCache(); err != nil {
+		return err
+	}
+	return onepassword.RemoveIndexCache(cfg)
+}
+
+// agentVault unlocks the vault described by c with keys held by the agent,
+// returning nil if there's no agent or it doesn't have the right keys.
+func agentVault(c onepassword.VaultConfig) *onepassword.Vault {
+	kp, err := agent.NewClient().Keys(agent.VaultID(c.DBPath, c.Profile))
+	if err != nil {
+		return nil
+	}
+	v, err := onepassword.NewVaultWithKeys(kp, c)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// rememberKeys hands the keys that unlocked v to the agent, if one is
+// running.
+func rememberKeys(c onepassword.VaultConfig, v *onepassword.Vault) {
+	agent.NewClient().Add(agent.VaultID(c.DBPath, c.Profile), v.DerivedKeys())
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// An askpassRule answers the prompts its pattern matches with a field of an
+// item. Rules are listed in the configuration file, e.g.
+//
+//	askpass:
+//	  - prompt: "passphrase for key '.*/id_ed25519'"
+//	    item: opvault:///SSH key/password
+//	  - prompt: '^\[sudo\] password for (\w+)'
+//	    item: sudo $1
+//
+// Item is a secret reference or an item query, in which $1, ${name}, and so
+// on are replaced by the pattern's submatches. Field defaults to password.
+type askpassRule struct {
+	Prompt string `yaml:"prompt"`
+	Item   string `yaml:"item"`
+	Field  string `yaml:"field,omitempty"`
+}
+
+// ruleFlags collects repeated -rule flags.
+type ruleFlags []string
+
+func (r *ruleFlags) String() string     { return strings.Join(*r, ",") }
+func (r *ruleFlags) Set(s string) error { *r = append(*r, s); return nil }
+
+// askpassActiveEnv is set while opvault askpass runs, so that an askpass
+// program asking for its master password that's opvault askpass itself
+// fails instead of recursing.
+const askpassActiveEnv = "OPVAULT_ASKPASS_ACTIVE"
+
+// runAskpass prints the secret the first matching rule names for a prompt,
+// acting as the program named by SSH_ASKPASS or SUDO_ASKPASS. Those run a
+// program without arguments of its own, so point them at a script such as:
+//
+//	#!/bin/sh
+//	exec opvault askpass "$@"
+func runAskpass(args []string) error {
+	fs := newFlagSet("askpass")
+	var flagRules ruleFlags
+	fs.Var(&flagRules, "rule", "answer prompts matching `pattern=item` before the configured rules; may be repeated")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prompt := strings.TrimSpace(fs.Arg(0))
+
+	// ssh asks for confirmation of agent key use and shows notices through
+	// askpass too; those are for a person
+	switch os.Getenv("SSH_ASKPASS_PROMPT") {
+	case "confirm":
+		return fmt.Errorf("refusing to confirm %q on the user's behalf", prompt)
+	case "none":
+		return nil
+	}
+
+	if os.Getenv(askpassActiveEnv) != "" {
+		return &exitError{exitLocked, fmt.Errorf("opvault askpass was asked for its own master password; set %s or use -password-file", passwordEnv)}
+	}
+	os.Setenv(askpassActiveEnv, "1")
+
+	var rules []askpassRule
+	for _, s := range flagRules {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq == len(s)-1 {
+			return fmt.Errorf("invalid rule %q; expected pattern=item", s)
+		}
+		rules = append(rules, askpassRule{Prompt: s[:eq], Item: s[eq+1:]})
+	}
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	rules = append(rules, conf.Askpass...)
+
+	query, field, err := matchAskpass(rules, prompt)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	var value string
+	if onepassword.IsSecretRef(query) {
+		if value, err = v.Resolve(query); err != nil {
+			return err
+		}
+	} else {
+		item, err := v.FindItem(query)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if value, ok = item.Field(field); !ok {
+			return fmt.Errorf("%s has no field %q", item.Title, field)
+		}
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// matchAskpass returns the item query or secret reference, and the field,
+// that the first rule matching prompt names.
+func matchAskpass(rules []askpassRule, prompt string) (query, field string, err error) {
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Prompt)
+		if err != nil {
+			return "", "", fmt.Errorf("askpass rule %q: %s", r.Prompt, err)
+		}
+		m := re.FindStringSubmatchIndex(prompt)
+		if m == nil {
+			continue
+		}
+		query = string(re.ExpandString(nil, r.Item, prompt, m))
+		field = r.Field
+		if field == "" {
+			field = "password"
+		}
+		return query, field, nil
+	}
+	return "", "", &exitError{exitNotFound, fmt.Errorf("no askpass rule matches %q", prompt)}
+}
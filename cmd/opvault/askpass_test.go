@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestMatchAskpass(t *testing.T) {
+	rules := []askpassRule{
+		{Prompt: `passphrase for key '.*/id_ed25519'`, Item: "opvault:///SSH key/password"},
+		{Prompt: `^\[sudo\] password for (\w+)`, Item: "sudo $1"},
+		{Prompt: `^\w+@(?P<host>[\w.]+)'s password`, Item: "${host}", Field: "login password"},
+	}
+	for _, c := range []struct {
+		prompt, query, field string
+	}{
+		{"Enter passphrase for key '/home/wendy/.ssh/id_ed25519':", "opvault:///SSH key/password", "password"},
+		{"[sudo] password for wendy:", "sudo wendy", "password"},
+		{"wendy@build.example.com's password:", "build.example.com", "login password"},
+	} {
+		query, field, err := matchAskpass(rules, c.prompt)
+		if err != nil {
+			t.Errorf("%q: %s", c.prompt, err)
+			continue
+		}
+		if query != c.query || field != c.field {
+			t.Errorf("%q matched %q, %q; want %q, %q", c.prompt, query, field, c.query, c.field)
+		}
+	}
+
+	if _, _, err := matchAskpass(rules, "Enter PIN for token:"); exitStatus(err) != exitNotFound {
+		t.Errorf("unmatched prompt returned %v", err)
+	}
+	if _, _, err := matchAskpass([]askpassRule{{Prompt: "("}}, "x"); err == nil {
+		t.Error("accepted an invalid pattern")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mpage/onepassword/audit"
+)
+
+// runAudit reports weak, reused, breached, and old passwords, logins
+// missing one-time passwords, and expiring items. It exits with status 1 if
+// anything is found, so it can be scheduled to alert on problems.
+func runAudit(args []string) error {
+	fs := newFlagSet("audit")
+	format := fs.String("format", "text", "output format: text, json, yaml, or sarif")
+	breached := fs.Bool("breached", false, "check passwords against Have I Been Pwned, sending only hash prefixes")
+	minEntropy := fs.Float64("min-entropy", audit.DefaultOptions.MinEntropy, "report passwords with fewer bits of entropy")
+	maxAge := fs.Duration("max-age", audit.DefaultOptions.MaxAge, "report passwords unchanged for longer; 0 to disable")
+	expiresIn := fs.Duration("expires-in", audit.DefaultOptions.ExpiresIn, "report items expiring within this long; 0 to disable")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var out *output
+	if *format != "sarif" {
+		var err error
+		if out, err = newOutput(*format); err != nil {
+			return err
+		}
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	items, err := v.Items()
+	v.Close()
+	if err != nil {
+		return err
+	}
+
+	opts := audit.DefaultOptions
+	opts.MinEntropy = *minEntropy
+	opts.MaxAge = *maxAge
+	opts.ExpiresIn = *expiresIn
+	r := audit.Analyze(items, opts)
+	if *breached {
+		if err = audit.NewBreachChecker().Annotate(r, items); err != nil {
+			return err
+		}
+	}
+
+	findings := r.Findings()
+	switch {
+	case out == nil:
+		err = r.WriteSARIF(os.Stdout)
+	case out.text():
+		err = printFindings(findings, r.Items)
+	default:
+		err = out.write(os.Stdout, r)
+	}
+	if err != nil {
+		return err
+	}
+	if len(findings) > 0 {
+		os.Exit(exitFailure)
+	}
+	return nil
+}
+
+func printFindings(findings []audit.Finding, items int) error {
+	if len(findings) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "RULE\tTITLE\tUUID\tPROBLEM")
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Rule, f.Item.Title, f.Item.Uuid, f.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d items, %d problems\n", items, len(findings))
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runChanges lists the items changed since a watermark, for scripts that
+// copy changes elsewhere.
+func runChanges(args []string) error {
+	fs := newFlagSet("changes")
+	since := fs.Uint64("since", 0, "list changes at or after `watermark`, as printed by the last run; 0 lists every item")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	cs, err := v.ChangesSince(*since)
+	if err != nil {
+		return err
+	}
+
+	if !out.text() {
+		return out.write(os.Stdout, cs)
+	}
+	for _, list := range []struct {
+		kind  string
+		uuids []string
+	}{{"added", cs.Added}, {"modified", cs.Modified}, {"deleted", cs.Deleted}} {
+		for _, uuid := range list.uuids {
+			fmt.Printf("%-8s %s\n", list.kind, uuid)
+		}
+	}
+	fmt.Printf("watermark %d\n", cs.Watermark)
+	return nil
+}
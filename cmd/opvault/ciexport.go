@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCIExport writes secrets where a CI job's later steps read them,
+// without printing their values: to $GITHUB_ENV, after telling GitHub
+// Actions to mask them, or to a dotenv report or a file of masked variables
+// for GitLab CI.
+func runCIExport(args []string) error {
+	fs := newFlagSet("ci-export")
+	format := fs.String("format", "github", "`format`: github, gitlab (a dotenv report), or gitlab-variables (JSON for the variables API)")
+	out := fs.String("o", "", "write to `file` (default $GITHUB_ENV for github)")
+	var envs envFlags
+	fs.Var(&envs, "env", "export `NAME=item/field` or NAME=opvault://...; may be repeated")
+	manifest := fs.String("env-file", "", "read NAME=item/field mappings from `file`")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch *format {
+	case "github":
+		if *out == "" {
+			*out = os.Getenv("GITHUB_ENV")
+		}
+		// Earlier steps' variables are kept
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	case "gitlab", "gitlab-variables":
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	// Secrets are never written to standard output, which CI logs
+	if *out == "" {
+		return fmt.Errorf("no output file; use -o")
+	}
+
+	var mappings []envMapping
+	if *manifest != "" {
+		m, err := readEnvManifest(*manifest)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m...)
+	}
+	for _, s := range envs {
+		m, err := parseEnvMapping(s)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m)
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("no variables given; use -env or -env-file")
+	}
+	secrets, err := resolveMappings(mappings)
+	if err != nil {
+		return err
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if !seen[m.Name] {
+			names = append(names, m.Name)
+			seen[m.Name] = true
+		}
+	}
+
+	var data string
+	switch *format {
+	case "github":
+		// Masks take effect for the rest of the job, so they're printed
+		// before the values are anywhere a later step could print them
+		for _, name := range names {
+			for _, line := range githubMasks(secrets[name]) {
+				fmt.Println(line)
+			}
+		}
+		for _, name := range names {
+			// A random delimiter can't be forged by a value
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			data += githubEnv(name, secrets[name], "ghadelimiter_"+hex.EncodeToString(b))
+		}
+	case "gitlab":
+		note("warning: GitLab doesn't mask dotenv report variables; prefer -format gitlab-variables")
+		for _, name := range names {
+			line, err := gitlabDotenv(name, secrets[name])
+			if err != nil {
+				return err
+			}
+			data += line
+		}
+	case "gitlab-variables":
+		vars := gitlabVariables(names, secrets)
+		for _, v := range vars {
+			if !v.Masked {
+				note("warning: GitLab can't mask %s; it must be a single line of 8 or more characters from its allowed set", v.Key)
+			}
+		}
+		b, err := json.MarshalIndent(vars, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = string(b) + "\n"
+	}
+
+	f, err := os.OpenFile(*out, flags, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// githubMasks returns the workflow commands masking value in GitHub
+// Actions logs. Masks match single lines, so each line is masked.
+func githubMasks(value string) []string {
+	var cmds []string
+	for _, line := range strings.Split(strings.Replace(value, "\r\n", "\n", -1), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		line = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(line)
+		cmds = append(cmds, "::add-mask::"+line)
+	}
+	return cmds
+}
+
+// githubEnv returns a $GITHUB_ENV entry setting name to value, using the
+// multiline syntax so values may hold newlines. delim mustn't occur in
+// value.
+func githubEnv(name, value, delim string) string {
+	return fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delim, value, delim)
+}
+
+// gitlabDotenv returns a dotenv report line, which can't hold newlines.
+func gitlabDotenv(name, value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("%s spans several lines, which GitLab dotenv reports can't hold", name)
+	}
+	return name + "=" + value + "\n", nil
+}
+
+// A gitlabVariable is a CI/CD variable as GitLab's variables API takes it.
+type gitlabVariable struct {
+	Key          string `json:"key"`
+	Value        string `json:"value"`
+	VariableType string `json:"variable_type"`
+	Masked       bool   `json:"masked"`
+	Protected    bool   `json:"protected"`
+	Raw          bool   `json:"raw"`
+}
+
+// gitlabVariables returns the variables to create, masked where GitLab
+// allows. Values spanning lines are file variables, which GitLab also
+// can't mask.
+func gitlabVariables(names []string, secrets map[string]string) []gitlabVariable {
+	vars := []gitlabVariable{}
+	for _, name := range names {
+		value := secrets[name]
+		typ := "env_var"
+		if strings.ContainsAny(value, "\r\n") {
+			typ = "file"
+		}
+		vars = append(vars, gitlabVariable{name, value, typ, gitlabMaskable(value), true, true})
+	}
+	return vars
+}
+
+// gitlabMaskable reports whether GitLab can mask value: a single line of
+// at least 8 characters from its allowed set.
+func gitlabMaskable(value string) bool {
+	if len(value) < 8 {
+		return false
+	}
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("@:.~+/=-_", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGithubMasks(t *testing.T) {
+	got := githubMasks("line one\r\n\n100%\n")
+	want := []string{"::add-mask::line one", "::add-mask::100%25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %q. Got %q.", want, got)
+	}
+	if env := githubEnv("KEY", "a\nb", "EOF"); env != "KEY<<EOF\na\nb\nEOF\n" {
+		t.Fatalf("Unexpected entry %q", env)
+	}
+}
+
+func TestGitlabVariables(t *testing.T) {
+	secrets := map[string]string{"TOKEN": "glpat-0123456789", "PIN": "1234", "KEY": "-----BEGIN\nabc\n"}
+	vars := gitlabVariables([]string{"TOKEN", "PIN", "KEY"}, secrets)
+	if !vars[0].Masked || vars[1].Masked || vars[2].Masked || vars[2].VariableType != "file" {
+		t.Fatalf("Unexpected variables: %+v", vars)
+	}
+	if _, err := gitlabDotenv("KEY", secrets["KEY"]); err == nil {
+		t.Fatalf("Expected a multi-line dotenv value to be rejected")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A clipboard copies to and pastes from the system clipboard using the
+// platform's command line tools.
+type clipboard struct {
+	copy  []string
+	paste []string
+}
+
+// errNoClipboard is returned when none of the supported tools are found.
+var errNoClipboard = errors.New("no clipboard tool found; install wl-clipboard, xclip, or xsel")
+
+// systemClipboard finds the clipboard tools for the current platform and
+// display server.
+func systemClipboard() (*clipboard, error) {
+	var candidates []clipboard
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = []clipboard{{[]string{"pbcopy"}, []string{"pbpaste"}}}
+	case "windows":
+		candidates = []clipboard{{
+			[]string{"powershell", "-NoProfile", "-Command", "[Console]::In.ReadToEnd() | Set-Clipboard"},
+			[]string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, clipboard{[]string{"wl-copy"}, []string{"wl-paste", "-n"}})
+		}
+		if os.Getenv("DISPLAY") != "" {
+			candidates = append(candidates,
+				clipboard{[]string{"xclip", "-selection", "clipboard", "-in"}, []string{"xclip", "-selection", "clipboard", "-out"}},
+				clipboard{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}})
+		}
+	}
+
+	for i := range candidates {
+		if _, err := exec.LookPath(candidates[i].copy[0]); err == nil {
+			return &candidates[i], nil
+		}
+	}
+	return nil, errNoClipboard
+}
+
+func (c *clipboard) write(s string) error {
+	cmd := exec.Command(c.copy[0], c.copy[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	return cmd.Run()
+}
+
+func (c *clipboard) read() (string, error) {
+	out, err := exec.Command(c.paste[0], c.paste[1:]...).Output()
+	return string(out), err
+}
+
+// A clearRequest is handed to the background process that clears the
+// clipboard. It carries a digest rather than the secret so the clipboard
+// is only cleared if nothing else has been copied in the meantime.
+type clearRequest struct {
+	Digest   []byte `json:"digest"`
+	Previous string `json:"previous"`
+}
+
+func digest(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+// runCopy copies a field of an item, the password by default, to the
+// clipboard and clears it after a timeout, restoring whatever was there
+// before.
+func runCopy(args []string) error {
+	fs := newFlagSet("copy")
+	clearAfter := fs.Duration("clear", 45*time.Second, "clear the clipboard after this long; 0 never clears")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	field := "password"
+	if fs.NArg() == 2 {
+		field = fs.Arg(1)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	item, err := findItem(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	value, ok := item.Field(field)
+	if !ok {
+		return fmt.Errorf("%s has no field %q", item.Title, field)
+	}
+
+	if err = copyToClipboard(value, *clearAfter); err != nil {
+		return err
+	}
+	if *clearAfter <= 0 {
+		note("Copied %s of %s to the clipboard.", field, item.Title)
+	} else {
+		note("Copied %s of %s to the clipboard. Clearing in %s.", field, item.Title, *clearAfter)
+	}
+	return nil
+}
+
+// copyToClipboard puts value on the clipboard. Unless clearAfter is zero,
+// the clipboard is restored to its previous contents once it expires.
+func copyToClipboard(value string, clearAfter time.Duration) error {
+	cb, err := systemClipboard()
+	if err != nil {
+		return err
+	}
+
+	previous, _ := cb.read()
+	if err = cb.write(value); err != nil {
+		return fmt.Errorf("copying to clipboard: %s", err)
+	}
+	if clearAfter <= 0 {
+		return nil
+	}
+	if err = startClearer(clearAfter, clearRequest{digest(value), previous}); err != nil {
+		return fmt.Errorf("scheduling clipboard clearing: %s", err)
+	}
+	return nil
+}
+
+// startClearer runs this executable in the background to clear the
+// clipboard once the timeout expires, so the shell isn't held up waiting.
+func startClearer(after time.Duration, req clearRequest) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, "clear-clipboard", "-after", after.String())
+	cmd.Stdin = bytes.NewReader(data)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// runClearClipboard is the hidden command run by startClearer.
+func runClearClipboard(args []string) error {
+	fs := flag.NewFlagSet("clear-clipboard", flag.ExitOnError)
+	after := fs.Duration("after", 0, "")
+	fs.Parse(args)
+
+	var req clearRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		return err
+	}
+	cb, err := systemClipboard()
+	if err != nil {
+		return err
+	}
+
+	// Outlive the terminal that started us
+	signal.Ignore(syscall.SIGHUP)
+	time.Sleep(*after)
+
+	current, err := cb.read()
+	if err != nil || !bytes.Equal(digest(current), req.Digest) {
+		return err
+	}
+	return cb.write(req.Previous)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A theme maps the styles used in text output to ANSI SGR parameters, e.g.
+// "1;34" for bold blue. It can be changed in the configuration file:
+//
+//	theme:
+//	  title: "1;35"
+//	  masked: "2"
+//
+// An empty value leaves text of that style plain.
+type theme map[string]string
+
+var defaultTheme = theme{
+	"header":   "1",  // Table headings
+	"title":    "1",  // Item titles
+	"uuid":     "2",  // Item uuids
+	"category": "36", // Category names
+	"label":    "33", // Field names in show
+	"masked":   "2",  // Concealed values that aren't revealed
+	"added":    "32", // Lines of diff output
+	"removed":  "31",
+	"modified": "33",
+}
+
+// colors holds the theme in use, or nil when output isn't colored.
+var colors theme
+
+// setupColor turns on color for "always", or for "auto" when standard
+// output is a terminal and NO_COLOR isn't set, with the configured theme
+// overriding the default.
+func setupColor(mode string, custom theme) error {
+	switch mode {
+	case "never":
+		return nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || terminalWidth(os.Stdout) == 0 {
+			return nil
+		}
+	case "always":
+	default:
+		return fmt.Errorf("invalid -color %q: use auto, always, or never", mode)
+	}
+
+	colors = theme{}
+	for style, sgr := range defaultTheme {
+		colors[style] = sgr
+	}
+	for style, sgr := range custom {
+		if _, ok := defaultTheme[style]; !ok {
+			return fmt.Errorf("unknown theme style %q", style)
+		}
+		if strings.Trim(sgr, "0123456789;") != "" {
+			return fmt.Errorf("invalid theme color %q for %s: use SGR parameters like \"1;34\"", sgr, style)
+		}
+		colors[style] = sgr
+	}
+	return nil
+}
+
+// paint wraps s in the escape sequences for style, if color is on.
+func paint(style, s string) string {
+	sgr := colors[style]
+	if sgr == "" || s == "" {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + "\x1b[0m"
+}
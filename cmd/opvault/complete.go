@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// Completion scripts hand the words typed so far, including the one being
+// completed, to the hidden __complete command and offer the lines it
+// prints. Item names are only completed when the vault can be unlocked
+// without prompting; see sessionVault.
+var completionScripts = map[string]string{
+	"bash": `_opvault() {
+	local IFS=$'\n' i
+	COMPREPLY=($(opvault __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+	for i in "${!COMPREPLY[@]}"; do
+		COMPREPLY[i]=$(printf '%q' "${COMPREPLY[i]}")
+	done
+}
+complete -F _opvault opvault
+`,
+	"zsh": `#compdef opvault
+_opvault() {
+	local out
+	out=$(opvault __complete "${(@)words[2,CURRENT]}" 2>/dev/null)
+	[[ -n $out ]] && compadd -- "${(@f)out}"
+}
+compdef _opvault opvault
+`,
+	"fish": `function __opvault_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	opvault __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c opvault -f -a '(__opvault_complete)'
+`,
+}
+
+// itemCommands take an item query as their first argument.
+var itemCommands = map[string]bool{"get": true, "show": true, "copy": true, "totp": true, "pick": true, "qr": true, "edit": true, "history": true, "versions": true}
+
+// globalValueFlags are the global flags that take a separate value.
+var globalValueFlags = map[string]*string{"db": &cfg.DBPath, "profile": &cfg.Profile}
+
+// runCompletion prints the completion script for a shell. For example:
+//
+//	source <(opvault completion bash)
+func runCompletion(args []string) error {
+	fs := newFlagSet("completion")
+	fs.Parse(args)
+	script, ok := completionScripts[fs.Arg(0)]
+	if fs.NArg() != 1 || !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// runComplete prints the completions of the last of args.
+func runComplete(args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, c := range complete(args[:len(args)-1], args[len(args)-1]) {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+// complete returns the completions of prefix given the preceding words.
+func complete(words []string, prefix string) []string {
+	// Find the command, applying global flags so the right vault is used
+	var cmd string
+	var cmdArgs []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if cmd != "" {
+			cmdArgs = append(cmdArgs, w)
+			continue
+		}
+		if !strings.HasPrefix(w, "-") {
+			cmd = w
+			continue
+		}
+		name := strings.TrimLeft(w, "-")
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			if p, ok := globalValueFlags[name[:eq]]; ok {
+				*p = name[eq+1:]
+			}
+		} else if p, ok := globalValueFlags[name]; ok && i+1 < len(words) {
+			i++
+			*p = words[i]
+		}
+	}
+
+	if cmd == "" {
+		var names []string
+		for name, c := range commands {
+			if c.summary != "" {
+				names = append(names, name)
+			}
+		}
+		return withPrefix(names, prefix)
+	}
+	if strings.HasPrefix(prefix, "-") {
+		return nil
+	}
+
+	switch {
+	case cmd == "completion":
+		var shells []string
+		for shell := range completionScripts {
+			shells = append(shells, shell)
+		}
+		return withPrefix(shells, prefix)
+	case cmd == "list":
+		return completeFilter(prefix)
+	case itemCommands[cmd] && positional(cmdArgs) == 0:
+		items := overviews()
+		titles := make([]string, len(items))
+		for i, item := range items {
+			titles[i] = item.Title
+		}
+		return withPrefix(titles, prefix)
+	}
+	return nil
+}
+
+// positional counts the arguments that aren't flags. Flags taking values
+// must use the -flag=value form to be skipped correctly.
+func positional(args []string) int {
+	n := 0
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			n++
+		}
+	}
+	return n
+}
+
+// completeFilter completes a term of a list filter expression.
+func completeFilter(prefix string) []string {
+	key := prefix
+	if colon := strings.IndexByte(prefix, ':'); colon >= 0 {
+		key = prefix[:colon]
+	} else {
+		return withPrefix([]string{"category:", "tag:", "url:", "title:", "uuid:", "created:", "updated:"}, prefix)
+	}
+
+	var values []string
+	switch key {
+	case "category", "cat":
+		for _, c := range onepassword.AllCategories() {
+			values = append(values, key+":"+strings.ToLower(strings.Replace(c.Name, " ", "-", -1)))
+		}
+	case "tag":
+		for _, item := range overviews() {
+			for _, t := range item.Tags {
+				values = append(values, key+":"+t)
+			}
+		}
+	}
+	return withPrefix(values, prefix)
+}
+
+// overviews returns the vault's item overviews if it can be unlocked
+// without prompting.
+func overviews() []onepassword.Item {
+	v, err := sessionVault()
+	if v == nil || err != nil {
+		return nil
+	}
+	defer v.Close()
+	items, _ := v.Overviews()
+	return items
+}
+
+// withPrefix returns the distinct candidates starting with prefix, ignoring
+// case, in sorted order.
+func withPrefix(candidates []string, prefix string) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, c := range candidates {
+		if !seen[c] && strings.HasPrefix(strings.ToLower(c), strings.ToLower(prefix)) {
+			seen[c] = true
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
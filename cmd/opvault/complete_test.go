@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// These completions don't need the vault to be unlocked.
+func TestCompleteWithoutVault(t *testing.T) {
+	for _, tc := range []struct {
+		words  []string
+		prefix string
+		want   []string
+	}{
+		{nil, "ge", []string{"generate", "get"}},
+		{[]string{"-db", "x.sqlite"}, "sh", []string{"show"}},
+		{[]string{"completion"}, "z", []string{"zsh"}},
+		{[]string{"list"}, "ta", []string{"tag:"}},
+		{[]string{"list"}, "cat:secure", []string{"cat:secure-note"}},
+	} {
+		got := complete(tc.words, tc.prefix)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("complete(%q, %q) = %q. Expected %q.", tc.words, tc.prefix, got, tc.want)
+		}
+	}
+}
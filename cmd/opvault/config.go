@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mpage/onepassword"
+	"gopkg.in/yaml.v2"
+)
+
+// configEnv names the environment variable that overrides the path of the
+// configuration file.
+const configEnv = "OPVAULT_CONFIG"
+
+// vaultEnv names the environment variable that may hold the default for
+// -vault.
+const vaultEnv = "OPVAULT_VAULT"
+
+// A config is the contents of the configuration file, which names the
+// vaults a user works with. See the package documentation for an example.
+type config struct {
+	Default string                `yaml:"default,omitempty"`
+	Vaults  map[string]vaultEntry `yaml:"vaults"`
+	Theme   theme                 `yaml:"theme,omitempty"`
+	Askpass []askpassRule         `yaml:"askpass,omitempty"`
+}
+
+type vaultEntry struct {
+	Path         string `yaml:"path"`
+	Profile      string `yaml:"profile,omitempty"`
+	IndexCache   bool   `yaml:"indexCache,omitempty"`
+	ItemVersions int    `yaml:"itemVersions,omitempty"`
+	FieldClocks  bool   `yaml:"fieldClocks,omitempty"`
+	MemoryMap    bool   `yaml:"memoryMap,omitempty"`
+	ItemCache    int    `yaml:"itemCacheBytes,omitempty"`
+	KeyCache     bool   `yaml:"keyCache,omitempty"`
+}
+
+// A namedVault is a vault chosen with -vault.
+type namedVault struct {
+	name string
+	cfg  onepassword.VaultConfig
+}
+
+// selected holds the vaults chosen with -vault, or is empty if the vault
+// comes from -db or the built in default.
+var selected []namedVault
+
+func configPath() string {
+	if p := os.Getenv(configEnv); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "opvault", "config.yaml")
+}
+
+// loadConfig reads the configuration file. A missing file is an empty
+// configuration.
+func loadConfig() (*config, error) {
+	c := &config{}
+	path := configPath()
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// vaultConfig returns the configuration of a named vault, based on global
+// flags such as -index-cache.
+func (c *config) vaultConfig(name string) (onepassword.VaultConfig, error) {
+	e, ok := c.Vaults[name]
+	if !ok {
+		return cfg, fmt.Errorf("unknown vault %q; vaults are configured in %s", name, configPath())
+	}
+	vc := cfg
+	vc.DBPath = expandHome(e.Path)
+	if e.Profile != "" {
+		vc.Profile = e.Profile
+	}
+	vc.IndexCache = vc.IndexCache || e.IndexCache
+	vc.FieldClocks = vc.FieldClocks || e.FieldClocks
+	vc.MemoryMap = vc.MemoryMap || e.MemoryMap
+	if vc.ItemCacheBytes == 0 {
+		vc.ItemCacheBytes = e.ItemCache
+	}
+	if vc.ItemVersions == 0 {
+		vc.ItemVersions = e.ItemVersions
+	}
+	if e.KeyCache && vc.KeyCache == nil {
+		kc, err := openKeyCache()
+		if err != nil {
+			return vc, err
+		}
+		vc.KeyCache = kc
+	}
+	return vc, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// selectVaults applies -vault, $OPVAULT_VAULT, or the configured default,
+// unless -db was given. names is a comma separated list of vault names, or
+// "all" for every configured vault.
+func selectVaults(c *config, names string) error {
+	dbSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "db" {
+			dbSet = true
+		}
+	})
+	if dbSet && names != "" {
+		return fmt.Errorf("-db and -vault can't be used together")
+	} else if dbSet {
+		return nil
+	}
+
+	if names == "" {
+		names = os.Getenv(vaultEnv)
+	}
+	if names == "" {
+		names = c.Default
+	}
+	if names == "" {
+		return nil
+	}
+
+	var list []string
+	if names == "all" {
+		for name := range c.Vaults {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+	} else {
+		list = strings.Split(names, ",")
+	}
+	for _, name := range list {
+		vc, err := c.vaultConfig(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		selected = append(selected, namedVault{strings.TrimSpace(name), vc})
+	}
+	if len(selected) > 0 {
+		cfg = selected[0].cfg
+	}
+	return nil
+}
+
+// openVaults unlocks every vault chosen with -vault, or the single vault
+// chosen otherwise under the name "default".
+func openVaults() (*onepassword.VaultSet, error) {
+	s := onepassword.NewVaultSet()
+	if len(selected) == 0 {
+		v, err := unlockVault(cfg, "Master password: ", true)
+		if err != nil {
+			return nil, err
+		}
+		s.Add("default", v)
+		return s, nil
+	}
+	for _, nv := range selected {
+		v, err := unlockVault(nv.cfg, fmt.Sprintf("Master password for %s: ", nv.name), true)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %w", nv.name, err)
+		}
+		s.Add(nv.name, v)
+	}
+	return s, nil
+}
+
+// runVaults lists the configured vaults, marking the default.
+func runVaults(args []string) error {
+	fs := newFlagSet("vaults")
+	fs.Parse(args)
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(c.Vaults) == 0 {
+		note("no vaults configured in %s", configPath())
+		return nil
+	}
+
+	var names []string
+	for name := range c.Vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tPATH\tPROFILE")
+	for _, name := range names {
+		mark := ""
+		if name == c.Default {
+			mark = "*"
+		}
+		vc, _ := c.vaultConfig(name)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, name, vc.DBPath, vc.Profile)
+	}
+	return w.Flush()
+}
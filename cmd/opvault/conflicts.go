@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// A conflictSummary is a conflict as printed, without the items' details.
+type conflictSummary struct {
+	Kind     string                    `json:"kind"`
+	Uuid     string                    `json:"uuid,omitempty"`
+	Title    string                    `json:"title"`
+	CopyUuid string                    `json:"copyUuid"`
+	File     string                    `json:"file,omitempty"`
+	Changes  []onepassword.FieldChange `json:"changes"`
+}
+
+// runConflicts lists the items a file sync service kept two versions of,
+// and optionally resolves them.
+func runConflicts(args []string) error {
+	fs := newFlagSet("conflicts")
+	resolve := fs.String("resolve", "", "resolve each conflict by keeping the vault's version, the copy's, or asking: vault, copy, or ask")
+	showSecrets := fs.Bool("show-secrets", false, "show the values of concealed fields")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	switch *resolve {
+	case "", "vault", "copy", "ask":
+	default:
+		return fmt.Errorf("unknown resolution %q", *resolve)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	conflicts, err := v.SyncConflicts()
+	if err != nil {
+		return err
+	}
+
+	summaries := make([]conflictSummary, len(conflicts))
+	for i := range conflicts {
+		summaries[i] = summarizeConflict(&conflicts[i], *showSecrets)
+	}
+	if *resolve == "" {
+		if !out.text() {
+			return out.write(os.Stdout, summaries)
+		}
+		for _, s := range summaries {
+			printConflict(&s)
+		}
+		return nil
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for i := range conflicts {
+		useCopy := *resolve == "copy"
+		if *resolve == "ask" {
+			printConflict(&summaries[i])
+			if useCopy, err = askSyncConflict(in); err != nil {
+				return err
+			}
+		}
+		if err = v.ResolveSyncConflict(&conflicts[i], useCopy); err != nil {
+			return err
+		}
+	}
+	note("Resolved %d conflicts", len(conflicts))
+	return nil
+}
+
+func summarizeConflict(c *onepassword.SyncConflict, showSecrets bool) conflictSummary {
+	s := conflictSummary{Kind: c.Kind, Title: c.Copy.Title, CopyUuid: c.Copy.Uuid, File: c.File}
+	// Masking mustn't change the conflict
+	s.Changes = append(s.Changes, c.Changes...)
+	if c.Item != nil {
+		s.Uuid, s.Title = c.Item.Uuid, c.Item.Title
+	}
+	if !showSecrets {
+		d := &onepassword.VaultDiff{Modified: []onepassword.ItemDiff{{Changes: s.Changes}}}
+		maskChanges(d)
+		s.Changes = d.Modified[0].Changes
+	}
+	return s
+}
+
+func printConflict(s *conflictSummary) {
+	switch {
+	case s.Kind == onepassword.DuplicateItem:
+		fmt.Printf("%s %s is duplicated by %s\n", s.Uuid, s.Title, s.CopyUuid)
+	case s.Uuid == "":
+		fmt.Printf("%s %s is only in %s\n", s.CopyUuid, s.Title, s.File)
+	default:
+		fmt.Printf("%s %s differs in %s\n", s.Uuid, s.Title, s.File)
+	}
+	printDiff(&onepassword.VaultDiff{Modified: []onepassword.ItemDiff{{Uuid: s.Uuid, Title: s.Title, Changes: s.Changes}}})
+}
+
+// askSyncConflict asks which version of a conflicting item to keep.
+func askSyncConflict(in *bufio.Reader) (bool, error) {
+	for {
+		fmt.Fprintf(os.Stderr, "Keep the [v]ault's or the [c]opy's version? ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("no answer: %s", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "v", "vault":
+			return false, nil
+		case "c", "copy":
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mpage/onepassword/csiprovider"
+)
+
+// runCSIProvider serves the vault to the Kubernetes Secrets Store CSI
+// driver until signalled. It's meant to run in a DaemonSet with the vault
+// and its password mounted, e.g. with -password-file.
+func runCSIProvider(args []string) error {
+	fs := newFlagSet("csi-provider")
+	socket := fs.String("socket", "/etc/kubernetes/secrets-store-csi-providers/"+csiprovider.ProviderName+".sock", "path of the socket the driver connects to")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	// A socket left by a provider that didn't exit cleanly is replaced
+	os.Remove(*socket)
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+
+	s := csiprovider.NewServer(&csiprovider.Provider{Resolver: v})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		s.GracefulStop()
+	}()
+	note("serving %s on %s", v.Name(), *socket)
+	return s.Serve(ln)
+}
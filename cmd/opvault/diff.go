@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mpage/onepassword"
+)
+
+// runDiff compares two vaults, such as a vault and its backup, and exits
+// with status 1 if they differ.
+func runDiff(args []string) error {
+	fs := newFlagSet("diff")
+	showSecrets := fs.Bool("show-secrets", false, "show the values of concealed fields")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v1, err := openVaultAt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer v1.Close()
+	v2, err := openVaultAt(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer v2.Close()
+
+	d, err := onepassword.Diff(v1, v2)
+	if err != nil {
+		return err
+	}
+	if !*showSecrets {
+		maskChanges(d)
+	}
+
+	if out.text() {
+		printDiff(d)
+	} else if err = out.write(os.Stdout, d); err != nil {
+		return err
+	}
+	if !d.Empty() {
+		v1.Close()
+		v2.Close()
+		os.Exit(exitFailure)
+	}
+	return nil
+}
+
+// openVaultAt unlocks the vault at path, which may not be the one chosen
+// with -db. Each vault gets its own prompt, as their passwords may differ.
+func openVaultAt(path string) (*onepassword.Vault, error) {
+	c := cfg
+	c.DBPath = path
+	v, err := unlockVault(c, fmt.Sprintf("Master password for %s: ", filepath.Base(path)), true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return v, nil
+}
+
+func maskChanges(d *onepassword.VaultDiff) {
+	for i := range d.Modified {
+		for j := range d.Modified[i].Changes {
+			c := &d.Modified[i].Changes[j]
+			if !c.Concealed {
+				continue
+			}
+			if c.Old != "" {
+				c.Old = concealedMask
+			}
+			if c.New != "" {
+				c.New = concealedMask
+			}
+		}
+	}
+}
+
+func printDiff(d *onepassword.VaultDiff) {
+	for _, item := range d.Removed {
+		fmt.Println(paint("removed", fmt.Sprintf("- %s %s", item.Uuid, item.Title)))
+	}
+	for _, item := range d.Added {
+		fmt.Println(paint("added", fmt.Sprintf("+ %s %s", item.Uuid, item.Title)))
+	}
+	for _, m := range d.Modified {
+		fmt.Println(paint("modified", fmt.Sprintf("~ %s %s", m.Uuid, m.Title)))
+		for _, c := range m.Changes {
+			switch {
+			case c.Old == "":
+				fmt.Printf("    %s: added %q\n", c.Field, c.New)
+			case c.New == "":
+				fmt.Printf("    %s: removed %q\n", c.Field, c.Old)
+			default:
+				fmt.Printf("    %s: %q -> %q\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/generate"
+	"gopkg.in/yaml.v2"
+)
+
+// A scaffold is the editable form of an item.
+type scaffold struct {
+	Title    string          `json:"title" yaml:"title"`
+	Category string          `json:"category" yaml:"category"`
+	Url      string          `json:"url" yaml:"url"`
+	Tags     []string        `json:"tags" yaml:"tags"`
+	Fields   []scaffoldField `json:"fields" yaml:"fields"`
+	Notes    string          `json:"notes" yaml:"notes"`
+}
+
+type scaffoldField struct {
+	Section string `json:"section,omitempty" yaml:"section,omitempty"`
+	Id      string `json:"id" yaml:"id"`
+	Label   string `json:"label" yaml:"label"`
+	Kind    string `json:"kind" yaml:"kind"`
+	Value   string `json:"value" yaml:"value"`
+}
+
+const scaffoldHelp = `# Edit the item below, then save and quit. Fields without a section are
+# the web form fields of a Login. Kinds are: string, concealed, email,
+# phone, URL, date (a Unix timestamp), monthYear (YYYYMM), menu, gender,
+# cctype, and address. The category can't be changed.
+`
+
+// newScaffold returns the scaffold for an item, including empty fields
+// from its category's template.
+func newScaffold(item *onepassword.Item) *scaffold {
+	sc := &scaffold{
+		Title:    item.Title,
+		Category: item.Category.Name,
+		Url:      item.Url,
+		Tags:     item.Tags,
+		Notes:    item.Notes(),
+	}
+	fields := item.Fields()
+	have := make(map[string]bool)
+	for _, f := range fields {
+		have[f.Section+"\x00"+f.Id] = true
+	}
+	for _, f := range onepassword.TemplateFields(item.Category) {
+		if !have[f.Section+"\x00"+f.Id] {
+			fields = append(fields, f)
+		}
+	}
+	for _, f := range fields {
+		sc.Fields = append(sc.Fields, scaffoldField{f.Section, f.Id, f.Name, f.Kind, f.Value})
+	}
+	if sc.Tags == nil {
+		sc.Tags = []string{}
+	}
+	return sc
+}
+
+// apply updates item from the scaffold.
+func (sc *scaffold) apply(item *onepassword.Item) error {
+	if cat, ok := onepassword.CategoryByName(sc.Category); !ok || cat.Uuid != item.Category.Uuid {
+		return fmt.Errorf("category can't be changed from %s", item.Category.Name)
+	}
+	var fields []onepassword.FieldValue
+	for _, f := range sc.Fields {
+		if f.Value == "" && f.Id == "" {
+			continue
+		}
+		fields = append(fields, onepassword.FieldValue{
+			Section:   f.Section,
+			Id:        f.Id,
+			Name:      f.Label,
+			Kind:      f.Kind,
+			Value:     f.Value,
+			Concealed: f.Kind == onepassword.KindConcealed || f.Kind == "P",
+		})
+	}
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		return err
+	}
+	if err := item.SetNotes(sc.Notes); err != nil {
+		return err
+	}
+	item.Title = sc.Title
+	item.Url = sc.Url
+	item.Tags = sc.Tags
+	if item.Category.Uuid == onepassword.CatLogin.Uuid {
+		item.Info = item.Username()
+	}
+	return item.Validate()
+}
+
+func (sc *scaffold) encode(asJSON bool) ([]byte, error) {
+	if asJSON {
+		data, err := json.MarshalIndent(sc, "", "  ")
+		return append(data, '\n'), err
+	}
+	data, err := yaml.Marshal(sc)
+	return append([]byte(scaffoldHelp), data...), err
+}
+
+func decodeScaffold(data []byte, asJSON bool) (*scaffold, error) {
+	var sc scaffold
+	var err error
+	if asJSON {
+		err = json.Unmarshal(data, &sc)
+	} else {
+		err = yaml.UnmarshalStrict(data, &sc)
+	}
+	return &sc, err
+}
+
+// editItem lets the user edit item in their editor until it's valid or
+// they give up. It reports whether the item was changed.
+func editItem(item *onepassword.Item, asJSON bool) (bool, error) {
+	original, err := newScaffold(item).encode(asJSON)
+	if err != nil {
+		return false, err
+	}
+	ext := ".yaml"
+	if asJSON {
+		ext = ".json"
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	text := original
+	for {
+		edited, err := runEditor(text, ext)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(edited, original) {
+			return false, nil
+		}
+
+		// Apply to a copy so a failed attempt doesn't leave partial changes
+		updated := *item
+		sc, err := decodeScaffold(stripErrors(edited), asJSON)
+		if err == nil {
+			err = sc.apply(&updated)
+		}
+		if err == nil {
+			*item = updated
+			return true, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "%s\nEdit again? [Y/n] ", err)
+		answer, _ := in.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "n" || a == "no" {
+			return false, err
+		}
+		text = edited
+		if !asJSON {
+			text = append([]byte(errorComment(err)), stripErrors(edited)...)
+		}
+	}
+}
+
+// errorPrefix marks the comment lines describing why the last edit failed.
+const errorPrefix = "# error: "
+
+func errorComment(err error) string {
+	problems := []string{err.Error()}
+	if verr, ok := err.(*onepassword.ValidationError); ok {
+		problems = verr.Problems
+	}
+	var b strings.Builder
+	for _, p := range problems {
+		b.WriteString(errorPrefix + strings.Replace(p, "\n", " ", -1) + "\n")
+	}
+	return b.String()
+}
+
+func stripErrors(data []byte) []byte {
+	var out []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte(errorPrefix)) {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// runEditor opens text in the user's editor and returns the result. The
+// temporary file is only readable by the user and is removed afterwards.
+func runEditor(text []byte, ext string) ([]byte, error) {
+	f, err := ioutil.TempFile("", "opvault-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	argv := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %s", err)
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+// runCreate creates an item in the category named by the first argument.
+// Logins start with a generated password unless -generate=false.
+func runCreate(args []string) error {
+	fs := newFlagSet("create")
+	asJSON := fs.Bool("json", false, "edit the item as JSON instead of YAML")
+	gen := fs.Bool("generate", true, "give a new Login a generated password")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cat, ok := onepassword.CategoryByName(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("unknown category %q", fs.Arg(0))
+	}
+	title := strings.Join(fs.Args()[1:], " ")
+	var item *onepassword.Item
+	if cat.Uuid == onepassword.CatLogin.Uuid && *gen {
+		var err error
+		if item, err = onepassword.NewLogin(title, "", generate.DefaultChars, time.Now()); err != nil {
+			return err
+		}
+	} else {
+		item = onepassword.NewItemFromTemplate(cat)
+		item.Title = title
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	changed, err := editItem(item, *asJSON)
+	if err != nil {
+		return err
+	} else if !changed && item.Title == "" {
+		return fmt.Errorf("no item created")
+	}
+	if err = item.Validate(); err != nil {
+		return err
+	}
+	if err = v.SaveItem(item); err != nil {
+		return err
+	}
+	note("Created %s (%s)", item.Title, item.Uuid)
+	return nil
+}
+
+// runEdit edits an existing item.
+func runEdit(args []string) error {
+	fs := newFlagSet("edit")
+	asJSON := fs.Bool("json", false, "edit the item as JSON instead of YAML")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	item, err := findItem(v, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	changed, err := editItem(item, *asJSON)
+	if err != nil {
+		return err
+	} else if !changed {
+		note("No changes")
+		return nil
+	}
+	if err = v.SaveItem(item); err != nil {
+		return err
+	}
+	note("Saved %s", item.Title)
+	return nil
+}
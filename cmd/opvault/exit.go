@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/credentials"
+	"github.com/mpage/onepassword/crypto"
+)
+
+// Exit statuses, as listed in the package documentation.
+const (
+	exitFailure   = 1 // Anything else, or problems found by verify, audit, or diff
+	exitUsage     = 2
+	exitNotFound  = 3
+	exitAmbiguous = 4
+	exitLocked    = 5 // No master password available, or a wrong one
+	exitIntegrity = 6 // Data failed authentication
+)
+
+// An exitError is an error that ends the command with a particular status.
+type exitError struct {
+	status int
+	err    error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitStatus returns the status to exit with after err.
+func exitStatus(err error) int {
+	var e *exitError
+	var amb *onepassword.AmbiguousQueryError
+	switch {
+	case errors.As(err, &e):
+		return e.status
+	case errors.Is(err, onepassword.ErrWrongPassword), errors.Is(err, credentials.ErrUnavailable):
+		return exitLocked
+	case errors.Is(err, crypto.ErrIncorrectMAC):
+		return exitIntegrity
+	case errors.Is(err, onepassword.ErrItemNotFound):
+		return exitNotFound
+	case errors.As(err, &amb):
+		return exitAmbiguous
+	}
+	return exitFailure
+}
+
+// quiet is set by -q to suppress everything but the requested output.
+var quiet bool
+
+// note tells the user what a command did, unless -q was given.
+func note(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
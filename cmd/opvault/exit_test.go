@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/crypto"
+)
+
+func TestExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), exitFailure},
+		{&exitError{exitNotFound, errors.New("no item")}, exitNotFound},
+		{fmt.Errorf("a.opvault: %w", onepassword.ErrWrongPassword), exitLocked},
+		{crypto.ErrIncorrectMAC, exitIntegrity},
+		{&onepassword.AmbiguousQueryError{}, exitAmbiguous},
+	} {
+		if got := exitStatus(tc.err); got != tc.want {
+			t.Errorf("exitStatus(%v) = %d. Expected %d.", tc.err, got, tc.want)
+		}
+	}
+}
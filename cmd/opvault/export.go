@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/convert"
+)
+
+// runExport writes the items matching a filter in another password
+// manager's format. The export holds every secret in the clear, apart from
+// KeePass databases, which are encrypted with a new password.
+func runExport(args []string) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "", "export format: 1pif, 1pux, csv, or kdbx; defaults to the output file's extension, then 1pif")
+	out := fs.String("o", "", "write the export to `file` instead of stdout")
+	fs.Parse(args)
+
+	f, err := convertFormat(*format, *out, "1pif")
+	if err != nil {
+		return err
+	}
+	pred, err := onepassword.ParseFilter(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	items, err := v.List(pred)
+	v.Close()
+	if err != nil {
+		return err
+	}
+
+	var opts convert.Options
+	if f.Name == "kdbx" {
+		if opts.Password, err = newPassword("KeePass database password: "); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err = f.Export(&buf, items, opts); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err = writeFileAtomic(*out, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	note("Exported %d items to %s", len(items), *out)
+	return nil
+}
+
+// convertFormat returns the named format or, if name is empty, the one
+// matching the extension of file, falling back to def.
+func convertFormat(name, file, def string) (*convert.Format, error) {
+	if name == "" && file != "" {
+		if f, err := convert.FormatForFile(file); err == nil {
+			return f, nil
+		}
+	}
+	if name == "" {
+		name = def
+	}
+	return convert.FormatByName(name)
+}
+
+// newPassword prompts for a new password twice.
+func newPassword(prompt string) (string, error) {
+	pass, err := onepassword.ReadPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	again, err := onepassword.ReadPassword("Repeat " + strings.ToLower(prompt[:1]) + prompt[1:])
+	if err != nil {
+		return "", err
+	}
+	if pass != again {
+		return "", fmt.Errorf("passwords don't match")
+	}
+	if pass == "" {
+		return "", fmt.Errorf("empty password")
+	}
+	return pass, nil
+}
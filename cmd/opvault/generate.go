@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword/generate"
+)
+
+// A generatedRecord is the structured output of generate.
+type generatedRecord struct {
+	Password string  `json:"password" yaml:"password"`
+	Entropy  float64 `json:"entropy" yaml:"entropy"` // Bits
+}
+
+// runGenerate prints random passwords. It doesn't need the vault.
+func runGenerate(args []string) error {
+	fs := newFlagSet("generate")
+	length := fs.Int("length", generate.DefaultChars.Length, "number of characters")
+	symbols := fs.Bool("symbols", false, "include symbols")
+	digits := fs.Bool("digits", true, "include digits")
+	ambiguous := fs.Bool("ambiguous", true, "allow easily confused characters like l and 1")
+	words := fs.Int("words", 0, "generate a diceware passphrase with this many words")
+	separator := fs.String("separator", generate.DefaultDiceware.Separator, "separator between passphrase words")
+	pronounceable := fs.Bool("pronounceable", false, "generate a pronounceable password")
+	count := fs.Int("count", 1, "number of passwords to generate")
+	format := formatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+	if out.format == "template" {
+		return fmt.Errorf("generate doesn't support templates")
+	}
+
+	var g generate.Generator
+	switch {
+	case *words > 0:
+		g = generate.Diceware{Words: *words, Separator: *separator}
+	case *pronounceable:
+		g = generate.Pronounceable{Length: *length, Capitalize: true, Digit: *digits}
+	default:
+		g = generate.Chars{
+			Length:           *length,
+			Upper:            true,
+			Digits:           *digits,
+			Symbols:          *symbols,
+			ExcludeAmbiguous: !*ambiguous,
+		}
+	}
+
+	var records []generatedRecord
+	for i := 0; i < *count; i++ {
+		pw, err := g.Generate()
+		if err != nil {
+			return err
+		}
+		if out.text() {
+			fmt.Println(pw)
+		}
+		records = append(records, generatedRecord{pw, g.Entropy()})
+	}
+	if !out.text() {
+		return out.write(os.Stdout, records)
+	}
+	return nil
+}
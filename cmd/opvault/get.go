@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// maxCandidates limits the items listed when a query is ambiguous.
+const maxCandidates = 5
+
+// findItem returns the item identified by query; see
+// onepassword.Vault.FindItem. Errors list the candidates.
+func findItem(v *onepassword.Vault, query string) (*onepassword.Item, error) {
+	item, err := v.FindItem(query)
+	if err == onepassword.ErrItemNotFound {
+		return nil, &exitError{exitNotFound, fmt.Errorf("no item matches %q", query)}
+	}
+	amb, ok := err.(*onepassword.AmbiguousQueryError)
+	if !ok {
+		return item, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(amb.Error() + ":")
+	for i, m := range amb.Matches {
+		if i == maxCandidates {
+			fmt.Fprintf(&b, "\n  ...")
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s  %s", m.Uuid, m.Title)
+	}
+	return nil, &exitError{exitAmbiguous, errors.New(b.String())}
+}
+
+// A fieldValueRecord is the structured output of get.
+type fieldValueRecord struct {
+	Uuid  string `json:"uuid" yaml:"uuid"`
+	Title string `json:"title" yaml:"title"`
+	Field string `json:"field" yaml:"field"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// runGet prints one field of an item, the password by default.
+func runGet(args []string) error {
+	fs := newFlagSet("get")
+	field := fs.String("field", "password", "name of the field to print")
+	format := formatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	item, err := findItem(v, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	if out.format == "template" {
+		return out.write(os.Stdout, nil, item)
+	}
+	value, ok := item.Field(*field)
+	if !ok {
+		return fmt.Errorf("%s has no field %q", item.Title, *field)
+	}
+	if !out.text() {
+		return out.write(os.Stdout, fieldValueRecord{item.Uuid, item.Title, *field, value})
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// runShow prints an item's overview and fields. Concealed values are masked
+// unless -reveal is given.
+func runShow(args []string) error {
+	fs := newFlagSet("show")
+	reveal := fs.Bool("reveal", false, "print concealed values")
+	format := formatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	item, err := findItem(v, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	if !out.text() {
+		r := newItemRecord(item)
+		r.addDetails(item, *reveal)
+		return out.write(os.Stdout, r, item)
+	}
+
+	// Every label is painted alike, so the escape sequences don't upset the
+	// alignment
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	line := func(label, value string) {
+		fmt.Fprintf(w, "%s\t%s\n", paint("label", cleanCell(label)+":"), value)
+	}
+	line("Title", paint("title", cleanCell(item.Title)))
+	line("UUID", paint("uuid", item.Uuid))
+	line("Category", paint("category", item.Category.Name))
+	if len(item.Tags) > 0 {
+		line("Tags", cleanCell(strings.Join(item.Tags, ", ")))
+	}
+	if item.Url != "" {
+		line("URL", cleanCell(item.Url))
+	}
+	line("Created", item.Created.Format(time.RFC3339))
+	line("Updated", item.Updated.Format(time.RFC3339))
+
+	for _, f := range item.Fields() {
+		name := f.Name
+		if name == "" {
+			name = f.Id
+		}
+		if f.Section != "" {
+			name = f.Section + " / " + name
+		}
+		value := cleanCell(f.Value)
+		if f.Concealed && !*reveal {
+			value = paint("masked", concealedMask)
+		}
+		line(name, value)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	if notes := item.Notes(); notes != "" {
+		fmt.Printf("\n%s\n", notes)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// runGitCredential is a git credential helper, so git's HTTPS remotes
+// authenticate with the Logins in the vault. Configure it with:
+//
+//	git config --global credential.helper '!opvault git-credential'
+//
+// git asks for credentials with "get", which prints the username and
+// password of the Login best matching the remote's URL, and of the
+// requested username if there is one. After authenticating, git sends them
+// back with "store", which changes the password of the matching Login or
+// creates one. "erase", sent when the server rejects credentials, leaves
+// the vault alone, so a failure elsewhere can't lose a password.
+func runGitCredential(args []string) error {
+	fs := newFlagSet("git-credential")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if passwordStdin {
+		return fmt.Errorf("git-credential reads git's requests from standard input; use -password-file")
+	}
+	attrs, err := readCredential(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "get":
+		return gitCredentialGet(attrs)
+	case "store":
+		return gitCredentialStore(attrs)
+	}
+	// erase is ignored, as are actions git may add in the future
+	return nil
+}
+
+// readCredential reads the attributes git describes a credential with, one
+// key=value line each, ending with a blank line or the end of input.
+func readCredential(r io.Reader) (map[string]string, error) {
+	attrs := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid credential line %q", line)
+		}
+		attrs[line[:eq]] = line[eq+1:]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(attrs["url"]); err == nil && attrs["url"] != "" {
+		if attrs["protocol"] == "" {
+			attrs["protocol"] = u.Scheme
+		}
+		if attrs["host"] == "" {
+			attrs["host"] = u.Host
+		}
+		if attrs["path"] == "" {
+			attrs["path"] = strings.TrimPrefix(u.Path, "/")
+		}
+		if attrs["username"] == "" && u.User != nil {
+			attrs["username"] = u.User.Username()
+		}
+	}
+	return attrs, nil
+}
+
+// credentialURL returns the URL of the remote the attributes describe, or
+// "" if it isn't one the vault's Logins could be for.
+func credentialURL(attrs map[string]string) string {
+	if attrs["protocol"] != "http" && attrs["protocol"] != "https" || attrs["host"] == "" {
+		return ""
+	}
+	return attrs["protocol"] + "://" + attrs["host"] + "/" + attrs["path"]
+}
+
+// matchCredential returns the Login among items that best matches the
+// remote and username the attributes describe, or nil if none does.
+func matchCredential(items []onepassword.Item, attrs map[string]string) (*onepassword.Item, error) {
+	u := credentialURL(attrs)
+	if u == "" {
+		return nil, nil
+	}
+	results, err := onepassword.RankLogins(items, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if user := attrs["username"]; user == "" || r.Item.Username() == user {
+			item := r.Item
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+func loginItems(v *onepassword.Vault) ([]onepassword.Item, error) {
+	return v.LookupItems(func(i *onepassword.Item) bool {
+		return i.Category.Uuid == onepassword.CatLogin.Uuid
+	})
+}
+
+// gitCredentialGet prints the matching Login's username and password, or
+// nothing so that git tries its other helpers and then prompts.
+func gitCredentialGet(attrs map[string]string) error {
+	if credentialURL(attrs) == "" {
+		return nil
+	}
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	items, err := loginItems(v)
+	if err != nil {
+		return err
+	}
+	item, err := matchCredential(items, attrs)
+	if err != nil || item == nil {
+		return err
+	}
+
+	username, password := item.Username(), item.Password()
+	if strings.ContainsAny(username+password, "\n\x00") {
+		return fmt.Errorf("%s: credentials can't be passed to git", item.Title)
+	}
+	if username != "" {
+		fmt.Printf("username=%s\n", username)
+	}
+	fmt.Printf("password=%s\n", password)
+	return nil
+}
+
+// gitCredentialStore saves the password git authenticated with in the
+// matching Login, or in a new Login titled with the remote's host.
+func gitCredentialStore(attrs map[string]string) error {
+	u := credentialURL(attrs)
+	if u == "" || attrs["username"] == "" || attrs["password"] == "" {
+		return nil
+	}
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	items, err := loginItems(v)
+	if err != nil {
+		return err
+	}
+	item, err := matchCredential(items, attrs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if item != nil {
+		if item.Password() == attrs["password"] {
+			return nil
+		}
+		if err = item.SetPassword(attrs["password"], now); err != nil {
+			return err
+		}
+		if err = v.SaveItem(item); err != nil {
+			return err
+		}
+		note("Saved %s", item.Title)
+		return nil
+	}
+
+	item = onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Title = attrs["host"]
+	item.Url = u
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	for i := range fields {
+		switch fields[i].Id {
+		case "username":
+			fields[i].Value = attrs["username"]
+		case "password":
+			fields[i].Value = attrs["password"]
+		}
+	}
+	if err = item.SetFields(fields, now); err != nil {
+		return err
+	}
+	if err = v.SaveItem(item); err != nil {
+		return err
+	}
+	note("Created %s (%s)", item.Title, item.Uuid)
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+func TestReadCredential(t *testing.T) {
+	attrs, err := readCredential(strings.NewReader("protocol=https\nhost=git.example.com:8443\npath=team/repo.git\nusername=wendy\n\nignored=1\n"))
+	if err != nil {
+		t.Fatalf("Failed reading credential: %s", err)
+	}
+	if attrs["ignored"] != "" || attrs["username"] != "wendy" {
+		t.Fatalf("Unexpected attributes: %v", attrs)
+	}
+	if u := credentialURL(attrs); u != "https://git.example.com:8443/team/repo.git" {
+		t.Fatalf("Unexpected URL %q", u)
+	}
+
+	attrs, err = readCredential(strings.NewReader("url=https://bob@example.com/repo.git\n"))
+	if err != nil || attrs["host"] != "example.com" || attrs["username"] != "bob" || attrs["path"] != "repo.git" {
+		t.Fatalf("Unexpected attributes: %v, %v", attrs, err)
+	}
+
+	if _, err := readCredential(strings.NewReader("protocol\n")); err == nil {
+		t.Fatalf("Expected an error for a line without a value")
+	}
+	if u := credentialURL(map[string]string{"protocol": "ssh", "host": "example.com"}); u != "" {
+		t.Fatalf("Expected no URL for ssh. Got %q.", u)
+	}
+}
+
+func TestMatchCredential(t *testing.T) {
+	login := func(title, url, username string) onepassword.Item {
+		item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+		item.Title, item.Url = title, url
+		fields := onepassword.TemplateFields(onepassword.CatLogin)
+		fields[0].Value, fields[1].Value = username, "secret"
+		if err := item.SetFields(fields, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return *item
+	}
+	items := []onepassword.Item{
+		login("Example", "https://example.com", "wendy"),
+		login("Git", "https://git.example.com", "bob"),
+		login("Other", "https://other.com", "wendy"),
+	}
+
+	for _, tc := range []struct {
+		attrs map[string]string
+		want  string
+	}{
+		{map[string]string{"protocol": "https", "host": "git.example.com"}, "Git"},
+		{map[string]string{"protocol": "https", "host": "git.example.com", "username": "wendy"}, "Example"},
+		{map[string]string{"protocol": "https", "host": "git.example.com", "username": "alice"}, ""},
+		{map[string]string{"protocol": "https", "host": "unknown.org"}, ""},
+	} {
+		item, err := matchCredential(items, tc.attrs)
+		if err != nil {
+			t.Fatalf("Failed matching %v: %s", tc.attrs, err)
+		}
+		got := ""
+		if item != nil {
+			got = item.Title
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected %q. Got %q.", tc.attrs, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mpage/onepassword/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// runGRPC serves the vault's gRPC API until signalled. Clients must present
+// a certificate signed by -client-ca.
+func runGRPC(args []string) error {
+	fs := newFlagSet("grpc")
+	addr := fs.String("addr", "127.0.0.1:8643", "`address` to listen on")
+	cert := fs.String("cert", "", "TLS certificate `file`")
+	key := fs.String("key", "", "TLS private key `file`")
+	clientCA := fs.String("client-ca", "", "`file` of CA certificates that sign client certificates")
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on `address`")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *cert == "" || *key == "" || *clientCA == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	pair, err := tls.LoadX509KeyPair(*cert, *key)
+	if err != nil {
+		return err
+	}
+	pem, err := ioutil.ReadFile(*clientCA)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("%s holds no certificates", *clientCA)
+	}
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	m := serveMetrics(*metricsAddr)
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	opts := []grpc.ServerOption{grpc.Creds(creds)}
+	if m != nil {
+		opts = append(opts, m.ServerOptions()...)
+	}
+	s := grpcapi.NewServer(v, opts...)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		s.GracefulStop()
+	}()
+	note("serving %s on %s", v.Name(), *addr)
+	return s.Serve(ln)
+}
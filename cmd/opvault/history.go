@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// runHistory prints the vault's journal of changes, optionally only those
+// to one item.
+func runHistory(args []string) error {
+	fs := newFlagSet("history")
+	since := fs.Duration("since", 0, "only show changes made within `duration`")
+	user := fs.String("user", "", "only show changes made by `user@host`")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	q := onepassword.HistoryQuery{User: *user}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+	if fs.NArg() == 1 {
+		item, err := v.FindItem(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		q.Uuid = item.Uuid
+	}
+	entries, err := v.History(q)
+	if err != nil {
+		return err
+	}
+
+	if !out.text() {
+		return out.write(os.Stdout, entries)
+	}
+	for _, e := range entries {
+		line := fmt.Sprintf("%s  %s  %-8s %s", e.Time.Local().Format("2006-01-02 15:04"), e.User, e.Action, e.Title)
+		if len(e.Fields) > 0 {
+			line += " (" + strings.Join(e.Fields, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
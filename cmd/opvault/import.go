@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/convert"
+)
+
+// Ways of resolving an imported item that's already in the vault.
+const (
+	conflictAsk     = "ask"
+	conflictSkip    = "skip"
+	conflictReplace = "replace"
+	conflictKeep    = "keep" // Keep both
+)
+
+// runImport adds the items in another password manager's export to the
+// vault. An item conflicts with one already in the vault if it has the same
+// uuid, or the same category, title, and username.
+func runImport(args []string) error {
+	fs := newFlagSet("import")
+	format := fs.String("format", "", "import format: 1pif, 1pux, csv, or kdbx; defaults to the file's extension")
+	dryRun := fs.Bool("dry-run", false, "show what would be imported without changing the vault")
+	conflict := fs.String("conflict", conflictAsk, "how to handle items already in the vault: ask, skip, replace, or keep (both)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	switch *conflict {
+	case conflictAsk, conflictSkip, conflictReplace, conflictKeep:
+	default:
+		return fmt.Errorf("unknown conflict policy %q", *conflict)
+	}
+
+	f, err := convertFormat(*format, fs.Arg(0), "")
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var opts convert.Options
+	if f.Name == "kdbx" {
+		if opts.Password, err = onepassword.ReadPassword("KeePass database password: "); err != nil {
+			return err
+		}
+	}
+	items, err := f.Import(data, opts)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	created, replaced, skipped, err := importItems(v, items, *conflict, *dryRun, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		note("Created %d items, replaced %d, skipped %d", created, replaced, skipped)
+	}
+	return nil
+}
+
+// importItems saves items to the vault, resolving conflicts with the items
+// already in it as conflict says, and asking on in if it's conflictAsk. A
+// dry run prints what would be done instead.
+func importItems(v *onepassword.Vault, items []onepassword.Item, conflict string, dryRun bool, in *bufio.Reader) (created, replaced, skipped int, err error) {
+	existing, err := v.Overviews()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	byUuid := make(map[string]*onepassword.Item)
+	byKey := make(map[string]*onepassword.Item)
+	for i := range existing {
+		byUuid[existing[i].Uuid] = &existing[i]
+		byKey[conflictKey(&existing[i])] = &existing[i]
+	}
+
+	for i := range items {
+		item := &items[i]
+		old := byUuid[item.Uuid]
+		if old == nil {
+			old = byKey[conflictKey(item)]
+		}
+
+		action := "create"
+		if old != nil {
+			action = conflict
+			if action == conflictAsk && !dryRun {
+				if action, err = askConflict(in, item, old); err != nil {
+					return created, replaced, skipped, err
+				}
+			}
+		}
+		if dryRun {
+			if action == conflictAsk {
+				action = "conflict"
+			}
+			if old != nil {
+				fmt.Printf("%-8s %s (%s)\n", action, item.Title, old.Uuid)
+			} else {
+				fmt.Printf("%-8s %s\n", action, item.Title)
+			}
+			continue
+		}
+
+		switch action {
+		case conflictSkip:
+			skipped++
+			continue
+		case conflictReplace:
+			item.Uuid, item.Folder = old.Uuid, old.Folder
+			replaced++
+		case conflictKeep:
+			item.Uuid = ""
+			created++
+		default:
+			created++
+		}
+		if err = v.SaveItem(item); err != nil {
+			return created, replaced, skipped, fmt.Errorf("%s: %s", item.Title, err)
+		}
+	}
+	return created, replaced, skipped, nil
+}
+
+func conflictKey(item *onepassword.Item) string {
+	return strings.ToLower(item.Category.Uuid + "\x00" + item.Title + "\x00" + item.Info)
+}
+
+// askConflict asks what to do with an item that's already in the vault.
+func askConflict(in *bufio.Reader, item, old *onepassword.Item) (string, error) {
+	for {
+		fmt.Fprintf(os.Stderr, "%q is already in the vault as %s. [s]kip, [r]eplace, or [k]eep both? ", item.Title, old.Uuid)
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("no answer for %q: %s", item.Title, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "s", "skip":
+			return conflictSkip, nil
+		case "r", "replace":
+			return conflictReplace, nil
+		case "k", "keep":
+			return conflictKeep, nil
+		}
+	}
+}
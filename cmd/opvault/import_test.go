@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/convert"
+	"github.com/mpage/onepassword/crypto"
+)
+
+// writeEmptyVault writes an OPVault directory with no items, unlocked by
+// password.
+func writeEmptyVault(t *testing.T, dir, password string) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	derived := crypto.ComputeDerivedKeys(password, salt, 100)
+	key := func() []byte {
+		plain := make([]byte, 256)
+		rand.Read(plain)
+		opdata, err := crypto.EncryptOPData01(plain, derived)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opdata
+	}
+	prof, err := json.Marshal(map[string]interface{}{
+		"salt":        salt,
+		"iterations":  100,
+		"masterKey":   key(),
+		"overviewKey": key(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, onepassword.DefaultProfile, "profile.js")
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(name, append(append([]byte("var profile="), prof...), ';'), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImport1PUX(t *testing.T) {
+	dir := t.TempDir()
+	writeEmptyVault(t, dir, "freddy")
+	cfg := onepassword.VaultConfig{DBPath: dir, Profile: onepassword.DefaultProfile}
+	v, err := onepassword.NewVault("freddy", cfg)
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+
+	// 1PUX exports key items by lowercase base32 uuids
+	at := time.Unix(1600000000, 0)
+	export := []onepassword.Item{{
+		Uuid:     "pvlhpxlwvnvlgmz3m5mrbwqrwy",
+		Title:    "GitHub",
+		Category: onepassword.CatLogin,
+		Created:  at,
+		Updated:  at,
+		Details:  []byte(`{"fields":[{"type":"P","name":"password","value":"hunter2","designation":"password"}]}`),
+	}}
+	f, err := convert.FormatByName("1pux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err = f.Export(&b, export, convert.Options{}); err != nil {
+		t.Fatalf("Failed exporting: %s", err)
+	}
+	items, err := f.Import(b.Bytes(), convert.Options{})
+	if err != nil {
+		t.Fatalf("Failed importing: %s", err)
+	}
+	created, _, _, err := importItems(v, items, conflictSkip, false, bufio.NewReader(strings.NewReader("")))
+	v.Close()
+	if err != nil || created != 1 {
+		t.Fatalf("Expected one item created. Got %d, %v.", created, err)
+	}
+
+	// Reopen to read back what was written
+	if v, err = onepassword.NewVault("freddy", cfg); err != nil {
+		t.Fatalf("Failed reopening vault: %s", err)
+	}
+	defer v.Close()
+	saved, err := v.Items()
+	if err != nil {
+		t.Fatalf("Failed reading items: %s", err)
+	}
+	if len(saved) != 1 || saved[0].Uuid != "7D5677DD76AB6AB3333B675910DA11B6" || saved[0].Password() != "hunter2" {
+		t.Fatalf("Expected the imported item. Got %+v.", saved)
+	}
+}
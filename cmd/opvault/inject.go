@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// runInject renders a template containing secret references; see
+// onepassword.Vault.Inject. The output is written in full or not at all.
+func runInject(args []string) error {
+	fs := newFlagSet("inject")
+	in := fs.String("i", "", "read the template from `file` instead of stdin")
+	out := fs.String("o", "", "write the result to `file` instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var text []byte
+	var err error
+	if *in == "" {
+		text, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		text, err = ioutil.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	// Render to memory first so a failure doesn't leave partial output
+	var buf bytes.Buffer
+	if err = v.Inject(&buf, string(text)); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = io.Copy(os.Stdout, &buf)
+		return err
+	}
+	return writeFileAtomic(*out, buf.Bytes(), 0600)
+}
+
+// writeFileAtomic replaces the contents of path with data, via a temporary
+// file in the same directory.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword/keycache"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+// sessionKeyEnv names the environment variable holding a session key to
+// seal the key cache with instead of a key kept in the OS keystore.
+const sessionKeyEnv = "OPVAULT_SESSION_KEY"
+
+// openKeyCache returns the cache of derived keys in the user's cache
+// directory, sealed with $OPVAULT_SESSION_KEY if it's set, or else with a
+// key kept in the OS keystore.
+func openKeyCache() (*keycache.Cache, error) {
+	dir, err := keycache.DefaultDir("opvault")
+	if err != nil {
+		return nil, err
+	}
+	if key := os.Getenv(sessionKeyEnv); key != "" {
+		return keycache.WithSessionKey(dir, []byte(key)), nil
+	}
+	store, err := sessionstore.Default("opvault")
+	if err != nil {
+		return nil, fmt.Errorf("key cache: %s; set %s to seal it with a session key instead", err, sessionKeyEnv)
+	}
+	return keycache.New(dir, store), nil
+}
+
+// clearKeyCache removes the key cache, whether or not it's in use.
+func clearKeyCache() error {
+	c, err := openKeyCache()
+	if err == nil {
+		return c.Clear()
+	}
+	dir, err := keycache.DefaultDir("opvault")
+	if err != nil {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/agent"
+	"github.com/mpage/onepassword/credentials"
+)
+
+// keychainService is the service name opvault's passwords are stored under.
+const keychainService = "opvault"
+
+// vaultKeychain returns the keychain entry for the vault described by c.
+func vaultKeychain(c onepassword.VaultConfig) credentials.Keychain {
+	return credentials.Keychain{Service: keychainService, Account: agent.VaultID(c.DBPath, c.Profile)}
+}
+
+// runKeychain saves the master password in the OS keychain, checking it
+// unlocks the vault first, or forgets it again.
+func runKeychain(args []string) error {
+	fs := newFlagSet("keychain")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	k := vaultKeychain(cfg)
+
+	var err error
+	switch fs.Arg(0) {
+	case "save":
+		if noKeychain {
+			return fmt.Errorf("keychain use is forbidden by -no-keychain or $%s", noKeychainEnv)
+		}
+		// Don't read back a password that's already saved
+		noKeychain = true
+		var pass string
+		if pass, err = readMasterPassword(cfg, "Master password: ", true); err != nil {
+			return err
+		}
+		var v *onepassword.Vault
+		if v, err = onepassword.NewVault(pass, cfg); err != nil {
+			return err
+		}
+		v.Close()
+		err = k.Store(pass)
+	case "forget":
+		err = k.Delete()
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// listColumns are the columns list can show in its table.
+var listColumns = map[string]func(item *onepassword.VaultItem) string{
+	"vault":    func(item *onepassword.VaultItem) string { return item.Vault },
+	"uuid":     func(item *onepassword.VaultItem) string { return item.Uuid },
+	"title":    func(item *onepassword.VaultItem) string { return item.Title },
+	"category": func(item *onepassword.VaultItem) string { return item.Category.Name },
+	"info":     func(item *onepassword.VaultItem) string { return item.Info },
+	"username": func(item *onepassword.VaultItem) string { return item.Username() },
+	"url":      func(item *onepassword.VaultItem) string { return item.Url },
+	"domain":   func(item *onepassword.VaultItem) string { return item.Domain() },
+	"tags":     func(item *onepassword.VaultItem) string { return strings.Join(item.Tags, ",") },
+	"created":  func(item *onepassword.VaultItem) string { return item.Created.Format("2006-01-02 15:04") },
+	"updated":  func(item *onepassword.VaultItem) string { return item.Updated.Format("2006-01-02 15:04") },
+}
+
+const defaultListColumns = "uuid,title,category,info"
+
+// parseColumns checks a comma separated list of column names.
+func parseColumns(spec string) ([]string, error) {
+	var cols []string
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if _, ok := listColumns[c]; !ok {
+			return nil, fmt.Errorf("unknown column %q", c)
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// runList prints a table of the items matching a filter expression. See
+// onepassword.ParseFilter for the syntax.
+func runList(args []string) error {
+	fs := newFlagSet("list")
+	order := fs.String("sort", "title", "comma separated sort keys, prefixed with - to reverse")
+	columns := fs.String("columns", defaultListColumns, "comma separated columns of the table: vault, uuid, title, category, info, username, url, domain, tags, created, updated")
+	format := formatFlag(fs)
+	fs.Parse(args)
+
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+	cols, err := parseColumns(*columns)
+	if err != nil {
+		return err
+	}
+
+	pred, err := onepassword.ParseFilter(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	cmps, err := onepassword.ParseSortOrder(*order)
+	if err != nil {
+		return err
+	}
+
+	vs, err := openVaults()
+	if err != nil {
+		return err
+	}
+	defer vs.Close()
+
+	items, err := vs.List(pred, cmps...)
+	if err != nil {
+		return err
+	}
+	// Name the vault holding each item only when there's a choice
+	several := len(vs.Names()) > 1
+
+	if !out.text() {
+		records := make([]itemRecord, len(items))
+		ptrs := make([]*onepassword.Item, len(items))
+		for i := range items {
+			records[i] = newItemRecord(&items[i].Item)
+			if several {
+				records[i].Vault = items[i].Vault
+			}
+			ptrs[i] = &items[i].Item
+		}
+		return out.write(os.Stdout, records, ptrs...)
+	}
+
+	if several && *columns == defaultListColumns {
+		cols = append([]string{"vault"}, cols...)
+	}
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = strings.ToUpper(c)
+	}
+	t := newTable(header...)
+	styles := make([]string, len(cols))
+	for i, c := range cols {
+		if _, ok := defaultTheme[c]; ok {
+			styles[i] = c
+		}
+	}
+	t.style(styles...)
+	for i := range items {
+		row := make([]string, len(cols))
+		for j, c := range cols {
+			row[j] = listColumns[c](&items[i])
+		}
+		t.add(row...)
+	}
+	return t.write(os.Stdout, terminalWidth(os.Stdout))
+}
@@ -0,0 +1,417 @@
+// Command opvault reads items from a 1Password vault.
+//
+// Usage:
+//
+//	opvault [-db path | -vault names] [-profile name] <command> [arguments]
+//
+// The commands are:
+//
+//	list        list the items matching a filter
+//	get         print a single field of an item
+//	show        print every field of an item
+//	copy        copy a field of an item to the clipboard
+//	totp        print an item's one-time password
+//	generate    print random passwords
+//	tui         browse the vault interactively
+//	pick        choose an item with a fuzzy finder and print a field
+//	run         run a command with secrets in its environment
+//	inject      render a template containing secrets
+//	read        print the secrets named by secret references
+//	mount       serve the vault as a read-only filesystem
+//	serve       serve the vault to other programs over an HTTP API
+//	grpc        serve the vault to other programs over gRPC with mutual TLS
+//	watch       report changes to the vault, optionally to webhooks
+//	rpc         answer JSON-RPC requests on standard input
+//	ci-export   write secrets for later steps of a CI job, masked in its logs
+//	qr          show a QR code for a one-time password or Wi-Fi network
+//	verify      check the integrity of the vault
+//	audit       report weak, reused, and old passwords and expiring items
+//	diff        compare the items in two vaults
+//	merge       copy the items of one vault into another
+//	conflicts   find and resolve items a file sync service kept two versions of
+//	history     show who changed which items, and when
+//	versions    list an item's earlier versions, or restore one
+//	changes     list the items changed since a watermark
+//	replicate   keep another OPVault directory a copy of the vault
+//	snapshot    copy the vault into a directory of backups and rotate them
+//	export      write items in another password manager's format
+//	import      add items from another password manager's export
+//	create      create an item in your editor
+//	edit        edit an item in your editor
+//	agent       keep the vault unlocked between commands
+//	lock        make the agent forget the vault's keys and remove caches
+//	ssh-agent   serve the SSH keys in the vault to ssh
+//	askpass     answer ssh and sudo password prompts from the vault
+//	git-credential
+//	            give git the passwords of the vault's Logins
+//	csi-provider
+//	            serve secrets to Kubernetes pods through the Secrets Store CSI driver
+//	native-host serve logins to a browser extension
+//	systemd-creds
+//	            hand secrets to systemd services as credentials
+//	secret-service
+//	            serve the vault to desktop applications as their keyring
+//	vaults      list the vaults named in the configuration file
+//	keychain    keep the master password in the OS keychain
+//	completion  print a shell completion script
+//
+// Run "opvault <command> -h" for the flags accepted by a command. Every
+// command accepts -format to print JSON, YAML, or the result of a Go
+// template executed against each item:
+//
+//	opvault list -format '{{.Title}} {{.Username}}' tag:work
+//
+// The master password is read from the first of these that's available:
+//
+//	-password-stdin      the first line of standard input
+//	-password-file file  the first line of file
+//	OPVAULT_PASSWORD     the environment variable
+//	the OS keychain      if saved there with "opvault keychain save"
+//	-askpass program     the output of program, which is passed the prompt;
+//	                     defaults to $OPVAULT_ASKPASS
+//	the terminal         a prompt, without echo
+//
+// -password-stdin and -password-file replace the other sources rather than
+// being tried first. While "opvault agent" is running, the keys derived from
+// the password are kept by the agent, so later commands don't ask again
+// until it's been idle for its timeout, the system sleeps, it's sent
+// SIGTERM, or "opvault lock" is run. An agent started with -persist and
+// stopped with "opvault agent -stop" leaves the keys in the OS keystore for
+// the next agent. The agent listens on a socket in $XDG_RUNTIME_DIR, or at
+// $OPVAULT_AGENT_SOCK.
+//
+// With -key-cache, or keyCache: true for a vault in the configuration
+// file, the derived keys are also kept in a file in the user's cache
+// directory, so later commands needn't ask even without an agent. The file
+// is sealed with a key kept in the OS keystore, or with
+// $OPVAULT_SESSION_KEY if it's set, e.g. to random text exported for one
+// shell session, and is removed by "opvault lock".
+// Setting OPVAULT_NO_KEYCHAIN, or passing -no-keychain, forbids using the
+// OS keychain.
+//
+// Commands exit with these statuses, so scripts can tell failures apart:
+//
+//	0  success
+//	1  any other error, or problems found by verify, audit, or diff
+//	2  invalid usage
+//	3  no item matches the query
+//	4  the query matches several items
+//	5  the vault is locked: no master password is available, or it's wrong
+//	6  data failed authentication, as a corrupt or tampered vault would
+//
+// With -q, nothing but the requested output is printed; errors are only
+// reported by the exit status.
+//
+// Vaults can be given names in opvault/config.yaml in the user's
+// configuration directory, e.g. ~/.config on Linux, or in the file named by
+// $OPVAULT_CONFIG, and chosen with -vault instead of -db:
+//
+//	default: personal
+//	vaults:
+//	  personal:
+//	    path: ~/Dropbox/1Password.opvault
+//	    itemVersions: 10
+//	    fieldClocks: true
+//	  work:
+//	    path: ~/work/Work.opvault
+//
+// itemVersions keeps that many earlier versions of each item saved, as
+// -item-versions does, for "opvault versions" to restore. fieldClocks
+// keeps a clock for each field of items saved, as -field-clocks does, so
+// "opvault merge -strategy field" can tell which copy changed it last.
+//
+// "opvault -vault personal,work list" and "opvault -vault all list" list
+// the items of several vaults together; other commands use a single vault.
+//
+// Paths may also be webdav://, webdav+http://, or sftp:// URLs of OPVault
+// directories on servers, which are read-only and cached locally, or s3://
+// and gs:// URLs of directories in buckets, which can also be written to;
+// see package github.com/mpage/onepassword/remote.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/credentials"
+	"github.com/mpage/onepassword/keycache"
+)
+
+// A command is an opvault subcommand.
+type command struct {
+	usage   string // Arguments, shown after the command name
+	summary string
+	run     func(args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	// Assigned here as commands refer back to the table for their usage.
+	commands = map[string]*command{
+		"list":      {"[-sort order] [-columns c,...] [-format f] [filter]", "list the items matching a filter", runList},
+		"get":       {"[-field name] [-format f] <query>", "print a single field of an item", runGet},
+		"show":      {"[-reveal] [-format f] <query>", "print every field of an item", runShow},
+		"totp":      {"[-watch] [-format f] <query>", "print an item's one-time password", runTotp},
+		"generate":  {"[-words n | -pronounceable] [-length n] [-symbols]", "print random passwords", runGenerate},
+		"copy":      {"[-clear duration] <query> [field]", "copy a field of an item to the clipboard", runCopy},
+		"tui":       {"[-clear duration]", "browse the vault interactively", runTui},
+		"pick":      {"[-field name] [-1] [query]", "choose an item with a fuzzy finder and print a field", runPick},
+		"run":       {"[-env NAME=item/field]... [-env-file file] -- command [args]", "run a command with secrets in its environment", runRun},
+		"inject":    {"[-i file] [-o file]", "render a template containing secrets", runInject},
+		"read":      {"<reference>...", "print the secrets named by secret references", runRead},
+		"mount":     {"[-allow-other] <dir>", "serve the vault as a read-only filesystem", runMount},
+		"serve":     {"[-addr address] [-cert file -key file | -no-tls] [-tokens file] [-metrics address]", "serve the vault to other programs over an HTTP API", runServe},
+		"grpc":      {"[-addr address] -cert file -key file -client-ca file [-metrics address]", "serve the vault to other programs over gRPC with mutual TLS", runGRPC},
+		"watch":     {"[-interval duration] [-webhook url]... [-secret file]", "report changes to the vault, optionally to webhooks", runWatch},
+		"rpc":       {"", "answer JSON-RPC requests on standard input", runRPC},
+		"ci-export": {"[-format github|gitlab|gitlab-variables] [-o file] [-env NAME=item/field]... [-env-file file]", "write secrets for later steps of a CI job, masked in its logs", runCIExport},
+		"qr":        {"[-png file] [-size n] <query>", "show a QR code for a one-time password or Wi-Fi network", runQr},
+		"verify":    {"[-format f]", "check the integrity of the vault", runVerify},
+		"audit":     {"[-breached] [-format text|json|yaml|sarif]", "report weak, reused, and old passwords and expiring items", runAudit},
+		"diff":      {"[-show-secrets] [-format f] <vault> <vault>", "compare the items in two vaults", runDiff},
+		"merge":     {"[-strategy newest|destination|ask|field] [-show-secrets] <destination> <source>", "copy the items of one vault into another", runMerge},
+		"conflicts": {"[-resolve vault|copy|ask] [-show-secrets] [-format f]", "find and resolve items a file sync service kept two versions of", runConflicts},
+		"history":   {"[-since duration] [-user user@host] [-format f] [query]", "show who changed which items, and when", runHistory},
+		"versions":  {"[-restore n] [-format f] <query>", "list an item's earlier versions, or restore one", runVersions},
+		"changes":   {"[-since watermark] [-format f]", "list the items changed since a watermark", runChanges},
+		"replicate": {"[-replica-password-file file] <dir>", "keep another OPVault directory a copy of the vault", runReplicate},
+		"snapshot":  {"[-keep-daily n] [-keep-weekly n] [-keep-monthly n] <dir>", "copy the vault into a directory of backups and rotate them", runSnapshot},
+		"export":    {"[-format 1pif|1pux|csv|kdbx] [-o file] [filter]", "write items in another password manager's format", runExport},
+		"import":    {"[-format f] [-dry-run] [-conflict policy] <file>", "add items from another password manager's export", runImport},
+		"create":    {"[-json] [-generate=false] <category> [title]", "create an item in your editor", runCreate},
+		"edit":      {"[-json] <query>", "edit an item in your editor", runEdit},
+		"agent":     {"[-timeout duration] [-lock-on-sleep=false] [-persist] [-foreground] [-metrics address] | -stop", "keep the vault unlocked between commands", runAgent},
+		"lock":      {"", "make the agent forget the vault's keys and remove caches", runLock},
+		"vaults":    {"", "list the vaults named in the configuration file", runVaults},
+		"keychain":  {"save|forget", "keep the master password in the OS keychain", runKeychain},
+		"askpass":   {"[-rule pattern=item]... [prompt]", "answer ssh and sudo password prompts from the vault", runAskpass},
+
+		"ssh-agent":  {"[-a socket] [-no-confirm] [-askpass program] [filter]", "serve the SSH keys in the vault to ssh", runSSHAgent},
+		"completion": {"bash|zsh|fish", "print a shell completion script", runCompletion},
+
+		"git-credential": {"get|store|erase", "give git the passwords of the vault's Logins", runGitCredential},
+		"csi-provider":   {"[-socket path]", "serve secrets to Kubernetes pods through the Secrets Store CSI driver", runCSIProvider},
+		"native-host":    {"[-timeout duration] [-install browser -extension id]", "serve logins to a browser extension", runNativeHost},
+		"systemd-creds":  {"write [-dir dir] [-encrypt] id=ref... | serve [-socket path] id=ref...", "hand secrets to systemd services as credentials", runSystemdCreds},
+		"secret-service": {"[-replace]", "serve the vault to desktop applications as their keyring", runSecretService},
+
+		// Run in the background by copy
+		"clear-clipboard": {"", "", runClearClipboard},
+		// Run by completion scripts
+		"__complete": {"", "", runComplete},
+	}
+}
+
+var cfg = onepassword.DefaultVaultConfig
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: opvault [flags] <command> [arguments]\n\nCommands:\n")
+	var names []string
+	for name, cmd := range commands {
+		if cmd.summary == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-11s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set for a command.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: opvault %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// passwordEnv names the environment variable that may hold the master
+// password, for unlocking without a prompt.
+const passwordEnv = "OPVAULT_PASSWORD"
+
+// askpassEnv names the environment variable that may hold the default for
+// -askpass.
+const askpassEnv = "OPVAULT_ASKPASS"
+
+// noKeychainEnv names the environment variable that, when set to anything,
+// forbids keeping the master password in the OS keychain, as -no-keychain
+// does. Administrators can set it for everyone.
+const noKeychainEnv = "OPVAULT_NO_KEYCHAIN"
+
+// Where the master password comes from, as chosen by the global flags.
+var (
+	passwordStdin bool
+	passwordFile  string
+	askpass       = os.Getenv(askpassEnv)
+	noKeychain    = os.Getenv(noKeychainEnv) != ""
+	stdinPassword *credentials.Reader
+)
+
+// passwordSource returns where to read the master password from. A source
+// chosen with -password-stdin or -password-file is used alone; otherwise
+// OPVAULT_PASSWORD is tried, then the OS keychain, then the askpass program,
+// then the terminal. Only sources that can be used without the user's
+// attention are returned unless interactive is set.
+func passwordSource(c onepassword.VaultConfig, interactive bool) credentials.Source {
+	switch {
+	case passwordStdin:
+		if !interactive {
+			return credentials.First()
+		}
+		// Shared so each prompt, e.g. one per vault in diff, reads a line
+		if stdinPassword == nil {
+			stdinPassword = credentials.NewReader(os.Stdin)
+		}
+		return stdinPassword
+	case passwordFile != "":
+		return credentials.File(passwordFile)
+	}
+	if !interactive {
+		return credentials.Env(passwordEnv)
+	}
+	sources := []credentials.Source{credentials.Env(passwordEnv)}
+	if !noKeychain {
+		sources = append(sources, vaultKeychain(c))
+	}
+	if askpass != "" {
+		sources = append(sources, credentials.Askpass(askpass))
+	}
+	return credentials.First(append(sources, credentials.Terminal{})...)
+}
+
+// readMasterPassword reads the master password from the source chosen by
+// the global flags.
+func readMasterPassword(c onepassword.VaultConfig, prompt string, interactive bool) (string, error) {
+	pass, err := passwordSource(c, interactive).Password(prompt)
+	if err == credentials.ErrUnavailable && interactive {
+		return "", &exitError{exitLocked, fmt.Errorf("no master password: set %s or use -password-stdin, -password-file, or -askpass", passwordEnv)}
+	}
+	return pass, err
+}
+
+// openVault unlocks the vault, prompting for the master password unless
+// it's available without one.
+func openVault() (*onepassword.Vault, error) {
+	if len(selected) > 1 {
+		return nil, errSeveralVaults
+	}
+	return unlockVault(cfg, "Master password: ", true)
+}
+
+// errSeveralVaults is returned by commands that work on one vault when
+// -vault names several.
+var errSeveralVaults = errors.New("this command works on a single vault; choose one with -vault")
+
+// sessionVault unlocks the vault if that's possible without prompting, and
+// returns nil otherwise. It's used where a prompt would be out of place,
+// such as shell completion.
+func sessionVault() (*onepassword.Vault, error) {
+	if len(selected) > 1 {
+		return nil, nil
+	}
+	v, err := unlockVault(cfg, "", false)
+	if err == credentials.ErrUnavailable {
+		return nil, nil
+	}
+	return v, err
+}
+
+// unlockVault unlocks the vault described by c with keys held by the agent,
+// if one is running, or the key cache, if it's used, or else with the
+// master password. Keys derived from the password are handed to the agent
+// for next time.
+func unlockVault(c onepassword.VaultConfig, prompt string, interactive bool) (*onepassword.Vault, error) {
+	if v := agentVault(c); v != nil {
+		return v, nil
+	}
+	if v, err := onepassword.NewVaultWithCachedKeys(c); err == nil {
+		return v, nil
+	}
+	pass, err := readMasterPassword(c, prompt, interactive)
+	if err != nil {
+		return nil, err
+	}
+	v, err := onepassword.NewVault(pass, c)
+	if err != nil {
+		return nil, err
+	}
+	rememberKeys(c, v)
+	return v, nil
+}
+
+func main() {
+	flag.StringVar(&cfg.DBPath, "db", cfg.DBPath, "path to the 1Password SQLite database")
+	vaultNames := flag.String("vault", "", "comma separated `names` of configured vaults, or all (default $"+vaultEnv+" or the configured default)")
+	flag.StringVar(&cfg.Profile, "profile", cfg.Profile, "name of the 1Password profile")
+	flag.BoolVar(&cfg.IndexCache, "index-cache", false, "persist the search index next to the database")
+	flag.IntVar(&cfg.ItemVersions, "item-versions", 0, "keep `n` earlier versions of each item saved, for the versions command")
+	flag.BoolVar(&cfg.FieldClocks, "field-clocks", false, "keep a vector clock for each field of items saved, for merge -strategy field")
+	flag.IntVar(&cfg.ItemCacheBytes, "item-cache", 0, "keep up to `bytes` of recently decrypted items in memory, for long-running commands such as serve")
+	flag.BoolVar(&cfg.MemoryMap, "mmap", false, "map band and attachment files into memory rather than reading them, for very large vaults")
+	flag.BoolVar(&cfg.Tombstones, "tombstones", false, "include the tombstones 1Password leaves in place of deleted items in lists and searches")
+	flag.BoolVar(&cfg.StrictOPData, "strict-opdata", false, "reject encrypted data that isn't padded as 1Password pads it")
+	useKeyCache := flag.Bool("key-cache", false, "keep the keys derived from the master password in a sealed file for later commands; opvault lock removes it")
+	color := flag.String("color", "auto", "color text output: auto, always, or never; auto is off when NO_COLOR is set or output isn't a terminal")
+	flag.BoolVar(&quiet, "q", false, "print only the requested output, without messages or errors; check the exit status")
+	flag.BoolVar(&passwordStdin, "password-stdin", false, "read the master password from the first line of standard input")
+	flag.StringVar(&passwordFile, "password-file", "", "read the master password from the first line of `file`")
+	flag.BoolVar(&noKeychain, "no-keychain", noKeychain, "never read the master password from the OS keychain (default true if $"+noKeychainEnv+" is set)")
+	flag.StringVar(&askpass, "askpass", askpass, "run `program` to ask for the master password (default $"+askpassEnv+")")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to `file`, for go tool pprof")
+	traceFile := flag.String("trace", "", "write an execution trace to `file`, for go tool trace")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "opvault: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(exitUsage)
+	}
+	conf, err := loadConfig()
+	if err == nil && *useKeyCache {
+		var kc *keycache.Cache
+		if kc, err = openKeyCache(); err == nil {
+			cfg.KeyCache = kc
+		}
+	}
+	if err == nil {
+		err = selectVaults(conf, *vaultNames)
+	}
+	if err == nil {
+		err = setupColor(*color, conf.Theme)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opvault: %s\n", err)
+		os.Exit(exitUsage)
+	}
+
+	stopProfiling, err := startProfiling(*cpuProfile, *traceFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opvault: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	err = cmd.run(flag.Args()[1:])
+	stopProfiling()
+	if err != nil {
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "opvault: %s\n", err)
+		}
+		os.Exit(exitStatus(err))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// runMerge copies the items of one vault into another, resolving items
+// changed in both with the chosen strategy. The field strategy merges
+// them field by field, as onepassword.MergeFields does.
+func runMerge(args []string) error {
+	fs := newFlagSet("merge")
+	strategy := fs.String("strategy", "newest", "how to resolve items changed in both vaults: newest, destination, ask, or field")
+	showSecrets := fs.Bool("show-secrets", false, "show the values of concealed fields when asking")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var s onepassword.MergeStrategy
+	switch *strategy {
+	case "newest":
+		s = onepassword.NewestWins
+	case "destination":
+		s = onepassword.PreferDestination
+	case "ask":
+		s = askMerge(bufio.NewReader(os.Stdin), *showSecrets)
+	case "field":
+	default:
+		return fmt.Errorf("unknown merge strategy %q", *strategy)
+	}
+
+	dst, err := openVaultAt(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	src, err := openVaultAt(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var res *onepassword.MergeResult
+	if *strategy == "field" {
+		res, err = onepassword.MergeFields(dst, src)
+	} else {
+		res, err = onepassword.Merge(dst, src, s)
+	}
+	if res != nil {
+		note("Added %d items, replaced %d, kept %d, merged %d", len(res.Added), len(res.Replaced), len(res.Kept), len(res.Merged))
+	}
+	return err
+}
+
+// askMerge returns a strategy showing how each conflicting item differs
+// and asking which version to keep.
+func askMerge(in *bufio.Reader, showSecrets bool) onepassword.MergeStrategy {
+	return func(c *onepassword.MergeConflict) (bool, error) {
+		d := &onepassword.VaultDiff{Modified: []onepassword.ItemDiff{{Uuid: c.Src.Uuid, Title: c.Src.Title, Changes: c.Changes}}}
+		if !showSecrets {
+			maskChanges(d)
+		}
+		printDiff(d)
+		newer := "destination"
+		if c.SrcNewer() {
+			newer = "source"
+		}
+		for {
+			fmt.Fprintf(os.Stderr, "Keep the [d]estination's or the [s]ource's version? (the %s's is newer) ", newer)
+			line, err := in.ReadString('\n')
+			if err != nil {
+				return false, fmt.Errorf("no answer for %q: %s", c.Src.Title, err)
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "d", "destination":
+				return false, nil
+			case "s", "source":
+				return true, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mpage/onepassword/metrics"
+)
+
+// serveMetrics serves Prometheus metrics at /metrics on addr, and has the
+// vault report to them. It returns nil if addr is empty.
+func serveMetrics(addr string) *metrics.Collector {
+	if addr == "" {
+		return nil
+	}
+	m := metrics.New()
+	cfg.Metrics = m
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			note("metrics: %s", err)
+		}
+	}()
+	note("serving metrics on %s/metrics", addr)
+	return m
+}
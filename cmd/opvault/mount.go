@@ -0,0 +1,50 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mpage/onepassword/vaultfs"
+)
+
+// runMount serves the vault as a read-only filesystem at a directory until
+// it's unmounted or opvault is signalled.
+func runMount(args []string) error {
+	fs := newFlagSet("mount")
+	allowOther := fs.Bool("allow-other", false, "let other users read the filesystem, if /etc/fuse.conf permits")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	keepCurrent(v)
+
+	// Mounting directly works without fusermount when run as root, and
+	// falls back to it otherwise
+	opts := &fusefs.Options{MountOptions: fuse.MountOptions{AllowOther: *allowOther, DirectMount: true}}
+	server, err := vaultfs.Mount(dir, v, opts)
+	if err != nil {
+		return err
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-sigs
+		server.Unmount()
+	}()
+	note("mounted %s on %s", v.Name(), dir)
+	server.Wait()
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// runMount fails where there's no FUSE for the vault to be served through.
+func runMount(args []string) error {
+	return errors.New("mount isn't supported on this platform")
+}
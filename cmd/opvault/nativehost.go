@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/nativehost"
+)
+
+// nativeHostName is the name extensions connect to the host by.
+const nativeHostName = "com.github.mpage.opvault"
+
+// runNativeHost serves a browser extension as its native messaging host,
+// or with -install registers the host with a browser. Browsers start the
+// host without arguments of opvault's choosing, so -install writes a
+// script running opvault with the current vault and askpass program, and
+// registers that.
+func runNativeHost(args []string) error {
+	fs := newFlagSet("native-host")
+	install := fs.String("install", "", "register the host with `browser`: chrome, chromium, or firefox")
+	extension := fs.String("extension", "", "id of the extension allowed to use the host, with -install")
+	timeout := fs.Duration("timeout", 15*time.Minute, "lock the vault after this long without a request")
+	fs.Parse(args)
+
+	if *install != "" {
+		if *extension == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return installNativeHost(*install, *extension, *timeout)
+	}
+
+	// Browsers pass the extension's origin, or the manifest's path and the
+	// extension's id, which are ignored as the manifest names the allowed
+	// extensions
+	confirm, err := confirmer(askpass)
+	if err != nil {
+		return err
+	}
+	h := &nativehost.Host{
+		Unlock: func() (onepassword.VaultReader, error) {
+			v, err := unlockVault(cfg, "Master password: ", true)
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		},
+		Confirm: func(origin string) bool {
+			return confirm(fmt.Sprintf("Allow %s to use the logins in %s?", origin, filepath.Base(cfg.DBPath)))
+		},
+		Timeout: *timeout,
+	}
+	return h.Serve(os.Stdin, os.Stdout)
+}
+
+// nativeHostManifestDirs are where each browser looks for the manifests of
+// the user's native messaging hosts, by operating system.
+var nativeHostManifestDirs = map[string]map[string]string{
+	"linux": {
+		"chrome":   ".config/google-chrome/NativeMessagingHosts",
+		"chromium": ".config/chromium/NativeMessagingHosts",
+		"firefox":  ".mozilla/native-messaging-hosts",
+	},
+	"darwin": {
+		"chrome":   "Library/Application Support/Google/Chrome/NativeMessagingHosts",
+		"chromium": "Library/Application Support/Chromium/NativeMessagingHosts",
+		"firefox":  "Library/Application Support/Mozilla/NativeMessagingHosts",
+	},
+}
+
+// installNativeHost writes the host's script and the browser's manifest.
+func installNativeHost(browser, extension string, timeout time.Duration) error {
+	dir, ok := nativeHostManifestDirs[runtime.GOOS][browser]
+	if !ok {
+		return fmt.Errorf("can't register native messaging hosts for %s on %s", browser, runtime.GOOS)
+	}
+	if askpass == "" {
+		return fmt.Errorf("the host needs -askpass or $%s to ask for the master password and confirm sites", askpassEnv)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	db, err := filepath.Abs(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	confDir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+
+	script := filepath.Join(confDir, "opvault", "native-host")
+	body := fmt.Sprintf("#!/bin/sh\nexec %s -db %s -profile %s -askpass %s native-host -timeout %s\n",
+		shellQuote(exe), shellQuote(db), shellQuote(cfg.Profile), shellQuote(askpass), timeout)
+	if err = os.MkdirAll(filepath.Dir(script), 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(script, []byte(body), 0700); err != nil {
+		return err
+	}
+
+	manifest := map[string]interface{}{
+		"name":        nativeHostName,
+		"description": "opvault",
+		"path":        script,
+		"type":        "stdio",
+	}
+	if browser == "firefox" {
+		manifest["allowed_extensions"] = []string{extension}
+	} else {
+		manifest["allowed_origins"] = []string{"chrome-extension://" + extension + "/"}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(home, dir, nativeHostName+".json")
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	note("Registered %s for %s in %s", nativeHostName, browser, path)
+	return nil
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
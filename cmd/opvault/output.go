@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"gopkg.in/yaml.v2"
+)
+
+// An output writes a command's results in the form chosen with -format:
+// the command's own text layout, JSON, YAML, or a Go template executed
+// against each *onepassword.Item, e.g. -format '{{.Title}} {{.Username}}'.
+// JSON and YAML escape control characters, so they never carry terminal
+// escape sequences from item text and are safe to parse in scripts.
+type output struct {
+	format string
+	tmpl   *template.Template
+}
+
+// formatFlag registers the -format flag shared by every command.
+func formatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", "text", "output format: text, json, yaml, or a Go template")
+}
+
+func newOutput(format string) (*output, error) {
+	switch format {
+	case "", "text", "table":
+		return &output{format: "text"}, nil
+	case "json", "yaml":
+		return &output{format: format}, nil
+	}
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	tmpl, err := template.New("format").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	return &output{format: "template", tmpl: tmpl}, nil
+}
+
+// text reports whether the command should use its own layout.
+func (o *output) text() bool {
+	return o.format == "text"
+}
+
+// write encodes v as JSON or YAML, or executes the template once for each
+// of items.
+func (o *output) write(w io.Writer, v interface{}, items ...*onepassword.Item) error {
+	switch o.format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "template":
+		for _, item := range items {
+			if err := o.tmpl.Execute(w, item); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+	return fmt.Errorf("no %s output", o.format)
+}
+
+// An itemRecord is the structured form of an item. Details are only
+// included by commands that show them.
+type itemRecord struct {
+	Vault    string        `json:"vault,omitempty" yaml:"vault,omitempty"`
+	Uuid     string        `json:"uuid" yaml:"uuid"`
+	Title    string        `json:"title" yaml:"title"`
+	Category string        `json:"category" yaml:"category"`
+	Info     string        `json:"info,omitempty" yaml:"info,omitempty"`
+	Url      string        `json:"url,omitempty" yaml:"url,omitempty"`
+	Tags     []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Created  time.Time     `json:"created" yaml:"created"`
+	Updated  time.Time     `json:"updated" yaml:"updated"`
+	Fields   []fieldRecord `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Notes    string        `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+type fieldRecord struct {
+	Section   string `json:"section,omitempty" yaml:"section,omitempty"`
+	Id        string `json:"id,omitempty" yaml:"id,omitempty"`
+	Name      string `json:"name" yaml:"name"`
+	Kind      string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Value     string `json:"value" yaml:"value"`
+	Concealed bool   `json:"concealed,omitempty" yaml:"concealed,omitempty"`
+}
+
+// concealedMask replaces concealed values that weren't asked for.
+const concealedMask = "********"
+
+func newItemRecord(item *onepassword.Item) itemRecord {
+	return itemRecord{
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Category: item.Category.Name,
+		Info:     item.Info,
+		Url:      item.Url,
+		Tags:     item.Tags,
+		Created:  item.Created,
+		Updated:  item.Updated,
+	}
+}
+
+// addDetails includes the item's fields and notes in the record, masking
+// concealed values unless reveal is set.
+func (r *itemRecord) addDetails(item *onepassword.Item, reveal bool) {
+	for _, f := range item.Fields() {
+		value := f.Value
+		if f.Concealed && !reveal {
+			value = concealedMask
+		}
+		r.Fields = append(r.Fields, fieldRecord{f.Section, f.Id, f.Name, f.Kind, value, f.Concealed})
+	}
+	r.Notes = item.Notes()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mpage/onepassword"
+	"github.com/rivo/tview"
+)
+
+// runPick lets the user choose an item with a fuzzy finder and prints one
+// of its fields. The finder is drawn on the terminal rather than stdout, so
+// the command composes with command substitution:
+//
+//	ssh $(opvault pick -field username server)
+func runPick(args []string) error {
+	fs := newFlagSet("pick")
+	field := fs.String("field", "password", "name of the field to print")
+	selectOne := fs.Bool("1", false, "print the field without asking if the query matches a single item")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	var picked *onepassword.Item
+	if *selectOne {
+		items, err := v.Overviews()
+		if err != nil {
+			return err
+		}
+		if matches := fuzzyFilter(items, query); len(matches) == 1 {
+			picked = matches[0]
+		}
+	}
+	if picked == nil {
+		if picked, err = pick(v, query); err != nil {
+			return err
+		} else if picked == nil {
+			return fmt.Errorf("nothing picked")
+		}
+	}
+
+	item, err := v.Item(picked.Uuid)
+	if err != nil {
+		return err
+	}
+	value, ok := item.Field(*field)
+	if !ok {
+		return fmt.Errorf("%s has no field %q", item.Title, *field)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// pick runs the fuzzy finder, starting with query, and returns the chosen
+// overview or nil if the user gave up. Titles appear once the overviews
+// have been decrypted in the background.
+func pick(v *onepassword.Vault, query string) (*onepassword.Item, error) {
+	app := tview.NewApplication()
+	input := tview.NewInputField().SetLabel("> ").SetText(query)
+	list := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	list.AddItem("Decrypting overviews...", "", 0, nil)
+
+	var items []onepassword.Item
+	var shown []*onepassword.Item
+	var picked *onepassword.Item
+	var loadErr error
+
+	filter := func(text string) {
+		if items == nil {
+			return
+		}
+		shown = fuzzyFilter(items, text)
+		list.Clear()
+		for _, item := range shown {
+			list.AddItem(tview.Escape(item.Title), "", 0, nil)
+		}
+	}
+	input.SetChangedFunc(filter)
+
+	// Keys go to the query, except for those moving through the list
+	input.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		switch ev.Key() {
+		case tcell.KeyEnter:
+			if i := list.GetCurrentItem(); i >= 0 && i < len(shown) {
+				picked = shown[i]
+			}
+			app.Stop()
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			app.Stop()
+		case tcell.KeyUp, tcell.KeyCtrlP:
+			list.SetCurrentItem(list.GetCurrentItem() - 1)
+		case tcell.KeyDown, tcell.KeyCtrlN, tcell.KeyTab:
+			if n := list.GetItemCount(); n > 0 {
+				list.SetCurrentItem((list.GetCurrentItem() + 1) % n)
+			}
+		default:
+			return ev
+		}
+		return nil
+	})
+
+	go func() {
+		loaded, err := v.Overviews()
+		app.QueueUpdateDraw(func() {
+			if err != nil {
+				loadErr = err
+				app.Stop()
+				return
+			}
+			onepassword.SortItems(loaded, onepassword.ByTitle)
+			items = loaded
+			filter(input.GetText())
+		})
+	}()
+
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, false).
+		AddItem(input, 1, 0, true)
+	if err := app.SetRoot(root, true).SetFocus(input).Run(); err != nil {
+		return nil, err
+	}
+	return picked, loadErr
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// runQr shows a QR code for an item's one-time password, to enroll another
+// authenticator, or for a Router item's network, to let a phone join it.
+func runQr(args []string) error {
+	fs := newFlagSet("qr")
+	png := fs.String("png", "", "write a PNG image to `file` instead of drawing on the terminal")
+	size := fs.Int("size", 256, "width and height of the PNG image in pixels")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	item, err := findItem(v, strings.Join(fs.Args(), " "))
+	v.Close()
+	if err != nil {
+		return err
+	}
+
+	var payload string
+	if item.Category.Uuid == onepassword.CatRouter.Uuid {
+		payload, err = item.WiFiConfig()
+	} else {
+		payload, err = item.OTPAuthURI()
+	}
+	if err != nil {
+		return err
+	}
+
+	qr, err := qrcode.New(payload, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	if *png != "" {
+		data, err := qr.PNG(*size)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(*png, data, 0600)
+	}
+	fmt.Print(qr.ToSmallString(false))
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword"
+)
+
+// runRead prints the secrets named by secret references, one per line.
+func runRead(args []string) error {
+	fs := newFlagSet("read")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, ref := range fs.Args() {
+		if _, err := onepassword.ParseSecretRef(ref); err != nil {
+			return err
+		}
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	for _, ref := range fs.Args() {
+		value, err := v.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package main
+
+// Registered so that -db and configured paths may be URLs of vaults on
+// servers.
+import (
+	_ "github.com/mpage/onepassword/remote/s3"
+	_ "github.com/mpage/onepassword/remote/sftp"
+	_ "github.com/mpage/onepassword/remote/webdav"
+)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/credentials"
+)
+
+// runReplicate keeps another OPVault directory a copy of the vault until
+// signalled, creating it first if need be.
+func runReplicate(args []string) error {
+	fs := newFlagSet("replicate")
+	passFile := fs.String("replica-password-file", "", "give the replica the master password on the first line of `file`, re-encrypting items for it; by default it shares the vault's password and keys")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+	var pass string
+	if *passFile != "" {
+		var err error
+		if pass, err = credentials.File(*passFile).Password(""); err != nil {
+			return err
+		}
+	}
+
+	src, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err = os.Stat(filepath.Join(dir, onepassword.DefaultProfile, "profile.js")); errors.Is(err, os.ErrNotExist) {
+		if err = onepassword.CreateReplica(dir, src, pass); err != nil {
+			return err
+		}
+		note("Created %s", dir)
+	}
+	dstCfg := onepassword.VaultConfig{DBPath: dir, Profile: onepassword.DefaultProfile}
+	var dst *onepassword.Vault
+	if pass != "" {
+		dst, err = onepassword.NewVault(pass, dstCfg)
+	} else {
+		dst, err = onepassword.NewVaultWithKeys(src.DerivedKeys(), dstCfg)
+	}
+	if err == onepassword.ErrWrongPassword && pass == "" {
+		return errors.New("the replica has a password of its own; pass it with -replica-password-file")
+	} else if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	note("Replicating %s to %s", src.Name(), dir)
+	if err = onepassword.Replicate(ctx, src, dst); err != context.Canceled {
+		return err
+	}
+	return nil
+}
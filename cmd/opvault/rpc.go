@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mpage/onepassword/jsonrpc"
+)
+
+// runRPC answers JSON-RPC requests on standard input until it's closed,
+// keeping the vault unlocked for the program that started opvault.
+func runRPC(args []string) error {
+	fs := newFlagSet("rpc")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	s := &jsonrpc.Server{Vault: v}
+	return s.Serve(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mpage/onepassword"
+)
+
+// envFlags collects repeated -env flags.
+type envFlags []string
+
+func (e *envFlags) String() string     { return strings.Join(*e, ",") }
+func (e *envFlags) Set(s string) error { *e = append(*e, s); return nil }
+
+// An envMapping names the item field that supplies an environment variable,
+// either by secret reference or by item and field.
+type envMapping struct {
+	Name  string
+	Ref   string
+	Item  string
+	Field string
+}
+
+// parseEnvMapping parses NAME=item/field or NAME=opvault://... In the first
+// form the field follows the last slash, so item titles may contain slashes.
+func parseEnvMapping(s string) (envMapping, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq > 0 && onepassword.IsSecretRef(s[eq+1:]) {
+		if _, err := onepassword.ParseSecretRef(s[eq+1:]); err != nil {
+			return envMapping{}, err
+		}
+		return envMapping{Name: s[:eq], Ref: s[eq+1:]}, nil
+	}
+	slash := strings.LastIndexByte(s, '/')
+	if eq <= 0 || slash <= eq+1 || slash == len(s)-1 {
+		return envMapping{}, fmt.Errorf("invalid mapping %q; expected NAME=item/field", s)
+	}
+	return envMapping{Name: s[:eq], Item: s[eq+1 : slash], Field: s[slash+1:]}, nil
+}
+
+// readEnvManifest reads mappings from a file with one NAME=item/field or
+// NAME=opvault://... per line. Blank lines and lines starting with # are ignored.
+func readEnvManifest(path string) ([]envMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mappings []envMapping
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m, err := parseEnvMapping(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, n, err)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, s.Err()
+}
+
+// childEnv returns the environment for the child: ours, less the master
+// password, with the secrets added.
+func childEnv(secrets map[string]string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if eq := strings.IndexByte(kv, '='); eq >= 0 {
+			name = kv[:eq]
+		}
+		if _, ok := secrets[name]; !ok && name != passwordEnv {
+			env = append(env, kv)
+		}
+	}
+	for name, value := range secrets {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// runRun runs a command with environment variables set from item fields.
+// The secrets are only placed in the child's environment, never in
+// opvault's own, and the vault is closed before the command starts.
+func runRun(args []string) error {
+	fs := newFlagSet("run")
+	var envs envFlags
+	fs.Var(&envs, "env", "set `NAME=item/field` or NAME=opvault://...; may be repeated")
+	manifest := fs.String("env-file", "", "read NAME=item/field mappings from `file`")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var mappings []envMapping
+	if *manifest != "" {
+		m, err := readEnvManifest(*manifest)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m...)
+	}
+	for _, s := range envs {
+		m, err := parseEnvMapping(s)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m)
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("no environment variables given; use -env or -env-file")
+	}
+
+	secrets, err := resolveMappings(mappings)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Env = childEnv(secrets)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Let the child decide how to handle signals meant for it
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	if exit, ok := err.(*exec.ExitError); ok {
+		os.Exit(exit.ExitCode())
+	}
+	return err
+}
+
+// resolveMappings looks up the value of each mapping, unlocking the vault
+// only for as long as it takes.
+func resolveMappings(mappings []envMapping) (map[string]string, error) {
+	v, err := openVault()
+	if err != nil {
+		return nil, err
+	}
+	defer v.Close()
+
+	items := make(map[string]*onepassword.Item)
+	secrets := make(map[string]string)
+	for _, m := range mappings {
+		if m.Ref != "" {
+			if secrets[m.Name], err = v.Resolve(m.Ref); err != nil {
+				return nil, fmt.Errorf("%s: %s", m.Name, err)
+			}
+			continue
+		}
+
+		item, ok := items[m.Item]
+		if !ok {
+			if item, err = findItem(v, m.Item); err != nil {
+				return nil, err
+			}
+			items[m.Item] = item
+		}
+		value, ok := item.Field(m.Field)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s has no field %q", m.Name, item.Title, m.Field)
+		}
+		secrets[m.Name] = value
+	}
+	return secrets, nil
+}
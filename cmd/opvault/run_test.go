@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEnvMapping(t *testing.T) {
+	m, err := parseEnvMapping("DB_PASSWORD=prod/db/password")
+	if err != nil {
+		t.Fatalf("Failed parsing mapping: %s", err)
+	}
+	if m != (envMapping{Name: "DB_PASSWORD", Item: "prod/db", Field: "password"}) {
+		t.Fatalf("Unexpected mapping: %+v", m)
+	}
+	m, err = parseEnvMapping("TOKEN=opvault:///GitHub/token")
+	if err != nil || m.Ref != "opvault:///GitHub/token" {
+		t.Fatalf("Unexpected mapping: %+v, %v", m, err)
+	}
+	for _, bad := range []string{"TOKEN", "=item/field", "TOKEN=item", "TOKEN=item/", "TOKEN=/field", "TOKEN=opvault://x/y"} {
+		if _, err := parseEnvMapping(bad); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestChildEnvDropsMasterPassword(t *testing.T) {
+	t.Setenv(passwordEnv, "freddy")
+	t.Setenv("TOKEN", "old")
+	env := strings.Join(childEnv(map[string]string{"TOKEN": "new"}), "\n")
+	if strings.Contains(env, passwordEnv) || strings.Contains(env, "TOKEN=old") || !strings.Contains(env, "TOKEN=new") {
+		t.Fatalf("Unexpected environment:\n%s", env)
+	}
+}
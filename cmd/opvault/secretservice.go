@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/mpage/onepassword/secretservice"
+)
+
+// runSecretService serves the vault as the desktop's Secret Service on the
+// session bus until signalled, so applications that would use GNOME
+// Keyring or KWallet read and store their passwords in the vault.
+func runSecretService(args []string) error {
+	fs := newFlagSet("secret-service")
+	replace := fs.Bool("replace", false, "take over from a running keyring, such as gnome-keyring-daemon")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	keepCurrent(v)
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s := &secretservice.Server{Vault: v, Label: v.Name()}
+	if err = s.Export(conn); err != nil {
+		return err
+	}
+	flags := dbus.NameFlagDoNotQueue
+	if *replace {
+		flags |= dbus.NameFlagReplaceExisting
+	}
+	reply, err := conn.RequestName(secretservice.BusName, flags)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("another keyring provides %s; stop it or use -replace", secretservice.BusName)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	note("serving %s as %s", v.Name(), secretservice.BusName)
+	<-sigs
+	return nil
+}
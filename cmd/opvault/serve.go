@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/mpage/onepassword/restapi"
+)
+
+// runServe serves the vault's REST API until signalled. Clients
+// authenticate with the tokens in -tokens, or else with a token made up
+// and printed at startup.
+func runServe(args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", "127.0.0.1:8642", "`address` to listen on")
+	cert := fs.String("cert", "", "TLS certificate `file`")
+	key := fs.String("key", "", "TLS private key `file`")
+	noTLS := fs.Bool("no-tls", false, "serve plain HTTP, which is only allowed on a loopback address")
+	tokenFile := fs.String("tokens", "", "`file` of accepted bearer tokens, one per line")
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on `address`")
+	fs.Parse(args)
+	if fs.NArg() != 0 || (*cert == "") != (*key == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *cert == "" && !*noTLS {
+		return fmt.Errorf("serve needs -cert and -key, or -no-tls")
+	}
+	if *noTLS && !loopback(*addr) {
+		return fmt.Errorf("-no-tls is only allowed on a loopback address, not %s", *addr)
+	}
+
+	var tokens []string
+	if *tokenFile != "" {
+		data, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				tokens = append(tokens, line)
+			}
+		}
+		if len(tokens) == 0 {
+			return fmt.Errorf("%s holds no tokens", *tokenFile)
+		}
+	} else {
+		token, err := restapi.NewToken()
+		if err != nil {
+			return err
+		}
+		tokens = []string{token}
+		note("no -tokens given; clients may use this token until opvault exits:")
+		fmt.Println(token)
+	}
+
+	m := serveMetrics(*metricsAddr)
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	keepCurrent(v)
+
+	var h http.Handler = &restapi.Server{Vault: v, Tokens: tokens}
+	if m != nil {
+		h = m.InstrumentHandler(h)
+	}
+	srv := &http.Server{Addr: *addr, Handler: h}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		srv.Shutdown(context.Background())
+	}()
+	note("serving %s on %s", v.Name(), *addr)
+	if *noTLS {
+		err = srv.ListenAndServe()
+	} else {
+		err = srv.ListenAndServeTLS(*cert, *key)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// loopback reports whether addr listens only on a loopback address.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// runSnapshot copies the vault into a directory of backups, under a name
+// giving the time, and removes the snapshots the rotation flags don't keep.
+func runSnapshot(args []string) error {
+	fs := newFlagSet("snapshot")
+	var p onepassword.RotationPolicy
+	fs.IntVar(&p.Daily, "keep-daily", 0, "keep the newest snapshot of each of the last `n` days")
+	fs.IntVar(&p.Weekly, "keep-weekly", 0, "keep the newest snapshot of each of the last `n` weeks")
+	fs.IntVar(&p.Monthly, "keep-monthly", 0, "keep the newest snapshot of each of the last `n` months")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	name := onepassword.SnapshotName(time.Now(), path.Ext(strings.TrimSuffix(cfg.DBPath, "/")))
+	if err = v.Snapshot(filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	note("Saved %s", filepath.Join(dir, name))
+
+	if p == (onepassword.RotationPolicy{}) {
+		return nil
+	}
+	removed, err := onepassword.RotateSnapshots(dir, p)
+	for _, r := range removed {
+		note("Removed %s", filepath.Join(dir, r))
+	}
+	return err
+}
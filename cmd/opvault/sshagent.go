@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/agent"
+	"github.com/mpage/onepassword/sshagent"
+	sshagentproto "golang.org/x/crypto/ssh/agent"
+)
+
+// runSSHAgent serves the SSH keys in the vault's items until interrupted.
+// Like ssh-agent, it prints the shell commands that point ssh at it.
+func runSSHAgent(args []string) error {
+	fs := newFlagSet("ssh-agent")
+	socket := fs.String("a", filepath.Join(filepath.Dir(agent.SocketPath()), "ssh-agent.sock"), "path of the socket to listen on")
+	noConfirm := fs.Bool("no-confirm", false, "sign without asking first")
+	confirmProg := fs.String("askpass", os.Getenv("SSH_ASKPASS"), "program asking to confirm each use of a key (default $SSH_ASKPASS, else the terminal)")
+	fs.Parse(args)
+
+	pred, err := onepassword.ParseFilter(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	items, err := v.LookupItems(pred)
+	v.Close()
+	if err != nil {
+		return err
+	}
+	keys, errs := sshagent.Keys(items)
+	for _, err := range errs {
+		note("skipping key: %s", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no SSH keys found")
+	}
+
+	var confirm func(k *sshagent.Key) bool
+	if !*noConfirm {
+		ask, err := confirmer(*confirmProg)
+		if err != nil {
+			return fmt.Errorf("%s, or -no-confirm", err)
+		}
+		confirm = func(k *sshagent.Key) bool {
+			return ask(fmt.Sprintf("Allow use of key %s (%s)?", k.Title, k.Fingerprint()))
+		}
+	}
+
+	ln, err := agent.Listen(*socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-sigs
+		ln.Close()
+	}()
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", *socket)
+	for _, k := range keys {
+		note("serving %s (%s)", k.Title, k.Fingerprint())
+	}
+
+	keyring := sshagent.NewKeyring(keys, confirm)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// Closed by a signal
+			return nil
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			sshagentproto.ServeAgent(keyring, conn)
+		}(conn)
+	}
+}
+
+// confirmer returns a function asking the user a yes or no question:
+// through program, run as ssh runs SSH_ASKPASS to confirm, or else on the
+// terminal.
+func confirmer(program string) (func(question string) bool, error) {
+	if program != "" {
+		return func(question string) bool {
+			cmd := exec.Command(program, question)
+			cmd.Env = append(os.Environ(), "SSH_ASKPASS_PROMPT=confirm")
+			return cmd.Run() == nil
+		}, nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask for confirmation on; use -askpass")
+	}
+	r := bufio.NewReader(tty)
+	return func(question string) bool {
+		fmt.Fprintf(tty, "%s [y/N] ", question)
+		line, _ := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes"
+	}, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/mpage/onepassword/systemdcreds"
+)
+
+// runSystemdCreds hands secrets to systemd services as credentials, either
+// writing them to a credential store or answering LoadCredential= from a
+// socket.
+func runSystemdCreds(args []string) error {
+	fs := newFlagSet("systemd-creds")
+	dir := fs.String("dir", "", "with write, the `directory` to write to (default "+systemdcreds.StoreDir+", or "+systemdcreds.EncryptedStoreDir+" with -encrypt)")
+	encrypt := fs.Bool("encrypt", false, "with write, encrypt credentials with systemd-creds for LoadCredentialEncrypted=")
+	socket := fs.String("socket", "/run/opvault/creds.sock", "with serve, the `path` of the socket LoadCredential= names")
+	if len(args) == 0 || (args[0] != "write" && args[0] != "serve") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	creds := make(map[string]string)
+	var order []string
+	for _, arg := range fs.Args() {
+		c, err := systemdcreds.ParseCredential(arg)
+		if err != nil {
+			return err
+		}
+		if _, dup := creds[c.Id]; !dup {
+			order = append(order, c.Id)
+		}
+		creds[c.Id] = c.Ref
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if args[0] == "write" {
+		if *dir == "" {
+			*dir = systemdcreds.StoreDir
+			if *encrypt {
+				*dir = systemdcreds.EncryptedStoreDir
+			}
+		}
+		if err := os.MkdirAll(*dir, 0700); err != nil {
+			return err
+		}
+		for _, id := range order {
+			value, err := v.Resolve(creds[id])
+			if err != nil {
+				return fmt.Errorf("%s: %s", id, err)
+			}
+			if err = systemdcreds.Write(*dir, id, value, *encrypt); err != nil {
+				return fmt.Errorf("%s: %s", id, err)
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*socket), 0700); err != nil {
+		return err
+	}
+	// A socket left by a server that didn't exit cleanly is replaced
+	os.Remove(*socket)
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+	if err = os.Chmod(*socket, 0600); err != nil {
+		return err
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		ln.Close()
+	}()
+
+	var mu sync.Mutex
+	resolve := func(unit, id string) (string, error) {
+		ref, ok := creds[id]
+		if !ok {
+			return "", fmt.Errorf("no such credential")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return v.Resolve(ref)
+	}
+	note("serving credentials from %s on %s", v.Name(), *socket)
+	systemdcreds.Serve(ln, resolve, func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	})
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// minColumnWidth is as narrow as a column is shrunk to fit the terminal.
+const minColumnWidth = 6
+
+// A table lays out rows in aligned columns separated by two spaces. When
+// written to a terminal, the widest columns are shrunk to fit its width and
+// their cells truncated with an ellipsis.
+type table struct {
+	header []string
+	styles []string // Theme style of each column, if any
+	rows   [][]string
+}
+
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+// style sets the theme styles of the columns, which are applied after
+// fitting the table so escape sequences don't count towards widths.
+func (t *table) style(styles ...string) {
+	t.styles = styles
+}
+
+func (t *table) add(cells ...string) {
+	for i := range cells {
+		cells[i] = cleanCell(cells[i])
+	}
+	t.rows = append(t.rows, cells)
+}
+
+// cleanCell replaces control characters, so that item text can't move the
+// cursor or inject escape sequences into the terminal, and the layout stays
+// on one line per row.
+func cleanCell(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// terminalWidth returns the width of the terminal f writes to, or 0 if it
+// isn't one.
+func terminalWidth(f *os.File) int {
+	fd := int(f.Fd())
+	if !terminal.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := terminal.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// write writes the table to w, fitting it within width columns unless
+// width is 0.
+func (t *table) write(w io.Writer, width int) error {
+	widths := make([]int, len(t.header))
+	for _, row := range append([][]string{t.header}, t.rows...) {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if width > 0 {
+		fitWidths(widths, width-2*(len(widths)-1))
+	}
+
+	var b strings.Builder
+	for r, row := range append([][]string{t.header}, t.rows...) {
+		b.Reset()
+		for i, cell := range row {
+			cell = truncate(cell, widths[i])
+			pad := widths[i] - utf8.RuneCountInString(cell) + 2
+			if r == 0 {
+				cell = paint("header", cell)
+			} else if i < len(t.styles) {
+				cell = paint(t.styles[i], cell)
+			}
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", pad))
+			}
+		}
+		if _, err := io.WriteString(w, strings.TrimRight(b.String(), " ")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitWidths narrows the widest columns one character at a time until the
+// total is within avail or every column is at minColumnWidth.
+func fitWidths(widths []int, avail int) {
+	total := 0
+	for _, n := range widths {
+		total += n
+	}
+	for total > avail {
+		widest := 0
+		for i, n := range widths {
+			if n > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// truncate shortens s to n characters, ending it with an ellipsis if
+// anything was cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	tb := newTable("UUID", "TITLE", "INFO")
+	tb.add("A1", "A rather long title for an item", "wendy")
+	tb.add("B2", "Bank\x1b[31m", "")
+
+	var buf bytes.Buffer
+	tb.write(&buf, 0)
+	want := "UUID  TITLE                            INFO\n" +
+		"A1    A rather long title for an item  wendy\n" +
+		"B2    Bank?[31m\n"
+	if buf.String() != want {
+		t.Fatalf("Got:\n%s\nExpected:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	tb.write(&buf, 30)
+	want = "UUID  TITLE              INFO\n" +
+		"A1    A rather long ti…  wendy\n" +
+		"B2    Bank?[31m\n"
+	if buf.String() != want {
+		t.Fatalf("Got:\n%s\nExpected:\n%s", buf.String(), want)
+	}
+}
+
+func TestTableColor(t *testing.T) {
+	defer func() { colors = nil }()
+	if err := setupColor("always", theme{"title": "35"}); err != nil {
+		t.Fatal(err)
+	}
+	tb := newTable("UUID", "TITLE")
+	tb.style("uuid", "title")
+	tb.add("A1", "GitHub")
+
+	var buf bytes.Buffer
+	tb.write(&buf, 0)
+	want := "\x1b[1mUUID\x1b[0m  \x1b[1mTITLE\x1b[0m\n" +
+		"\x1b[2mA1\x1b[0m    \x1b[35mGitHub\x1b[0m\n"
+	if buf.String() != want {
+		t.Fatalf("Got %q. Expected %q.", buf.String(), want)
+	}
+
+	colors = nil
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if setupColor("auto", nil); colors != nil {
+		t.Fatalf("Expected NO_COLOR to turn color off.")
+	}
+}
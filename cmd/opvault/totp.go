@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// A totpRecord is the structured output of totp.
+type totpRecord struct {
+	Uuid      string `json:"uuid" yaml:"uuid"`
+	Title     string `json:"title" yaml:"title"`
+	Code      string `json:"code" yaml:"code"`
+	Remaining int    `json:"remaining" yaml:"remaining"` // Seconds
+}
+
+// runTotp prints an item's current one-time password and how long it
+// remains valid. With -watch it keeps printing codes as they change.
+func runTotp(args []string) error {
+	fs := newFlagSet("totp")
+	watch := fs.Bool("watch", false, "keep printing codes until interrupted")
+	format := formatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	item, err := findItem(v, strings.Join(fs.Args(), " "))
+	v.Close()
+	if err != nil {
+		return err
+	}
+
+	// Only the secret is needed from here on
+	code, remaining, err := item.TOTPCode(time.Now())
+	if err != nil {
+		return err
+	}
+	if !*watch {
+		if !out.text() {
+			return out.write(os.Stdout, totpRecord{item.Uuid, item.Title, code, int(remaining / time.Second)}, item)
+		}
+		if quiet {
+			fmt.Println(code)
+		} else {
+			fmt.Printf("%s  %ds\n", code, remaining/time.Second)
+		}
+		return nil
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	last := ""
+	for {
+		code, remaining, _ = item.TOTPCode(time.Now())
+		if out.text() {
+			// Redraw the countdown in place, starting a new line per code
+			if last != "" && code != last {
+				fmt.Println()
+			}
+			fmt.Printf("\r%s  %2ds", code, remaining/time.Second)
+		} else if code != last {
+			err = out.write(os.Stdout, totpRecord{item.Uuid, item.Title, code, int(remaining / time.Second)}, item)
+			if err != nil {
+				return err
+			}
+		}
+		last = code
+
+		select {
+		case <-tick.C:
+		case <-interrupt:
+			if out.text() {
+				fmt.Println()
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/search"
+	"github.com/rivo/tview"
+)
+
+const tuiHelp = "[yellow]/[-] search  [yellow]r[-] reveal  [yellow]c[-] copy password  " +
+	"[yellow]u[-] copy username  [yellow]t[-] copy code  [yellow]d[-] download attachments  [yellow]q[-] quit"
+
+// A browser is the state of the tui command. Only overviews are decrypted
+// up front; an item's details are decrypted when it's first selected.
+type browser struct {
+	vault      *onepassword.Vault
+	overviews  []onepassword.Item
+	shown      []*onepassword.Item // Overviews matching the search, in list order
+	details    map[string]*onepassword.Item
+	reveal     bool
+	clearAfter time.Duration
+
+	app    *tview.Application
+	search *tview.InputField
+	list   *tview.List
+	pane   *tview.TextView
+	status *tview.TextView
+}
+
+// runTui browses the vault in a terminal user interface.
+func runTui(args []string) error {
+	fs := newFlagSet("tui")
+	clearAfter := fs.Duration("clear", 45*time.Second, "clear copied values from the clipboard after this long")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	items, err := v.Overviews()
+	if err != nil {
+		return err
+	}
+	onepassword.SortItems(items, onepassword.ByTitle)
+
+	b := &browser{
+		vault:      v,
+		overviews:  items,
+		details:    make(map[string]*onepassword.Item),
+		clearAfter: *clearAfter,
+		app:        tview.NewApplication(),
+	}
+	b.layout()
+	b.filter("")
+	return b.app.Run()
+}
+
+func (b *browser) layout() {
+	b.search = tview.NewInputField().SetLabel("Search: ")
+	b.search.SetChangedFunc(b.filter)
+	b.search.SetDoneFunc(func(key tcell.Key) {
+		b.app.SetFocus(b.list)
+	})
+
+	b.list = tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	b.list.SetBorder(true).SetTitle(" Items ")
+	b.list.SetChangedFunc(func(int, string, string, rune) { b.show() })
+	b.list.SetInputCapture(b.keys)
+
+	b.pane = tview.NewTextView().SetDynamicColors(true).SetWrap(true)
+	b.pane.SetBorder(true).SetTitle(" Details ")
+
+	b.status = tview.NewTextView().SetDynamicColors(true).SetText(tuiHelp)
+
+	body := tview.NewFlex().
+		AddItem(b.list, 0, 1, true).
+		AddItem(b.pane, 0, 2, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.search, 1, 0, false).
+		AddItem(body, 0, 1, true).
+		AddItem(b.status, 1, 0, false)
+	b.app.SetRoot(root, true).SetFocus(b.list)
+}
+
+// filter shows the items matching query.
+func (b *browser) filter(query string) {
+	b.shown = fuzzyFilter(b.overviews, query)
+	b.list.Clear()
+	for _, item := range b.shown {
+		b.list.AddItem(tview.Escape(item.Title), "", 0, nil)
+	}
+	b.show()
+}
+
+// fuzzyFilter returns the items whose title or info fuzzily match query,
+// best matches first. Every item matches an empty query.
+func fuzzyFilter(items []onepassword.Item, query string) []*onepassword.Item {
+	type match struct {
+		item  *onepassword.Item
+		score float64
+	}
+	var matches []match
+	for i := range items {
+		item := &items[i]
+		if query == "" {
+			matches = append(matches, match{item, 0})
+		} else if m, ok := search.Fuzzy(query, item.Title+" "+item.Info); ok {
+			matches = append(matches, match{item, m.Score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	shown := make([]*onepassword.Item, len(matches))
+	for i, m := range matches {
+		shown[i] = m.item
+	}
+	return shown
+}
+
+// selected returns the selected item with its details, decrypting them if
+// necessary.
+func (b *browser) selected() (*onepassword.Item, error) {
+	i := b.list.GetCurrentItem()
+	if i < 0 || i >= len(b.shown) {
+		return nil, nil
+	}
+	uuid := b.shown[i].Uuid
+	if item, ok := b.details[uuid]; ok {
+		return item, nil
+	}
+	item, err := b.vault.Item(uuid)
+	if err != nil {
+		return nil, err
+	}
+	b.details[uuid] = item
+	return item, nil
+}
+
+// show renders the selected item in the detail pane.
+func (b *browser) show() {
+	b.pane.Clear()
+	item, err := b.selected()
+	if err != nil {
+		b.flash("[red]%s", err)
+		return
+	} else if item == nil {
+		return
+	}
+
+	w := b.pane
+	row := func(name, value string) {
+		fmt.Fprintf(w, "[::b]%s:[::-] %s\n", tview.Escape(name), tview.Escape(value))
+	}
+	row("Title", item.Title)
+	row("Category", item.Category.Name)
+	if len(item.Tags) > 0 {
+		row("Tags", strings.Join(item.Tags, ", "))
+	}
+	if item.Url != "" {
+		row("URL", item.Url)
+	}
+	row("Updated", item.Updated.Format(time.RFC3339))
+	fmt.Fprintln(w)
+
+	for _, f := range item.Fields() {
+		name := f.Name
+		if name == "" {
+			name = f.Id
+		}
+		if f.Section != "" {
+			name = f.Section + " / " + name
+		}
+		value := f.Value
+		if f.Concealed && !b.reveal {
+			value = concealedMask
+		}
+		row(name, value)
+	}
+
+	if atts, err := b.vault.Attachments(item); err == nil && len(atts) > 0 {
+		fmt.Fprintln(w)
+		for _, a := range atts {
+			row("Attachment", fmt.Sprintf("%s (%d bytes)", a.Name, a.Size))
+		}
+	}
+	if notes := item.Notes(); notes != "" {
+		fmt.Fprintf(w, "\n%s\n", tview.Escape(notes))
+	}
+	b.pane.ScrollToBeginning()
+}
+
+// flash shows a message in the status bar until the next key press.
+func (b *browser) flash(format string, args ...interface{}) {
+	b.status.SetText(fmt.Sprintf(format, args...))
+}
+
+func (b *browser) keys(ev *tcell.EventKey) *tcell.EventKey {
+	b.status.SetText(tuiHelp)
+	if ev.Key() == tcell.KeyEscape {
+		b.app.Stop()
+		return nil
+	}
+	if ev.Key() != tcell.KeyRune {
+		return ev
+	}
+
+	switch ev.Rune() {
+	case 'q':
+		b.app.Stop()
+	case '/':
+		b.app.SetFocus(b.search)
+	case 'r':
+		b.reveal = !b.reveal
+		b.show()
+	case 'c':
+		b.copy("password")
+	case 'u':
+		b.copy("username")
+	case 't':
+		b.copy("totp")
+	case 'd':
+		b.download()
+	default:
+		return ev
+	}
+	return nil
+}
+
+// copy copies a field of the selected item to the clipboard.
+func (b *browser) copy(field string) {
+	item, err := b.selected()
+	if err != nil || item == nil {
+		return
+	}
+
+	var value string
+	if field == "totp" {
+		value, _, err = item.TOTPCode(time.Now())
+		if err != nil {
+			b.flash("[red]%s has no one-time password", tview.Escape(item.Title))
+			return
+		}
+	} else if value, _ = item.Field(field); value == "" {
+		b.flash("[red]%s has no %s", tview.Escape(item.Title), field)
+		return
+	}
+
+	if err = copyToClipboard(value, b.clearAfter); err != nil {
+		b.flash("[red]%s", tview.Escape(err.Error()))
+		return
+	}
+	b.flash("Copied %s of %s", field, tview.Escape(item.Title))
+}
+
+// download saves the selected item's attachments in the current directory.
+// Existing files are never overwritten.
+func (b *browser) download() {
+	item, err := b.selected()
+	if err != nil || item == nil {
+		return
+	}
+	atts, err := b.vault.Attachments(item)
+	if err != nil {
+		b.flash("[red]%s", tview.Escape(err.Error()))
+		return
+	} else if len(atts) == 0 {
+		b.flash("[red]%s has no attachments", tview.Escape(item.Title))
+		return
+	}
+
+	var saved []string
+	for i := range atts {
+		name, err := saveAttachment(b.vault, &atts[i])
+		if err != nil {
+			b.flash("[red]%s", tview.Escape(err.Error()))
+			return
+		}
+		saved = append(saved, name)
+	}
+	b.flash("Saved %s", tview.Escape(strings.Join(saved, ", ")))
+}
+
+// saveAttachment writes an attachment to the current directory, readable
+// only by the user, and returns the file name used.
+func saveAttachment(v *onepassword.Vault, a *onepassword.Attachment) (string, error) {
+	name := filepath.Base(a.Name)
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		name = a.Uuid
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	// Decrypted a chunk at a time, so large attachments fit in memory
+	if _, err = v.WriteAttachment(context.Background(), f, a, nil); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	return name, f.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mpage/onepassword"
+)
+
+// runVerify checks the integrity of the vault and exits with status 1 if
+// anything is wrong with it.
+func runVerify(args []string) error {
+	fs := newFlagSet("verify")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	r, err := v.Verify()
+	v.Close()
+	if err != nil {
+		return err
+	}
+
+	if out.text() {
+		printVerifyReport(r)
+	} else if err = out.write(os.Stdout, r); err != nil {
+		return err
+	}
+	if !r.OK() {
+		os.Exit(exitFailure)
+	}
+	return nil
+}
+
+func printVerifyReport(r *onepassword.VerifyReport) {
+	for _, p := range r.Problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("%d items, %d attachments, %d problems\n", r.Items, r.Attachments, len(r.Problems))
+}
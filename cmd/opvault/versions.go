@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runVersions lists the kept earlier versions of an item, or restores one.
+func runVersions(args []string) error {
+	fs := newFlagSet("versions")
+	restore := fs.Int("restore", -1, "restore version `n`, as numbered in the list")
+	format := fs.String("format", "text", "output format: text, json, or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	out, err := newOutput(*format)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	item, err := v.FindItem(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *restore >= 0 {
+		if err = v.RestoreVersion(item.Uuid, *restore); err != nil {
+			return err
+		}
+		note("Restored version %d of %q", *restore, item.Title)
+		return nil
+	}
+
+	versions, err := v.Versions(item.Uuid)
+	if err != nil {
+		return err
+	}
+	if !out.text() {
+		return out.write(os.Stdout, versions)
+	}
+	if len(versions) == 0 {
+		note("No earlier versions of %q are kept; save items with -item-versions to keep them", item.Title)
+	}
+	for i, ver := range versions {
+		fmt.Printf("%d  %s  %s\n", i, ver.Replaced.Local().Format("2006-01-02 15:04"), ver.Item.Title)
+	}
+	return nil
+}
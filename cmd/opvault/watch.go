@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/webhook"
+)
+
+// urlFlags collects repeated -webhook flags.
+type urlFlags []string
+
+func (u *urlFlags) String() string     { return strings.Join(*u, ",") }
+func (u *urlFlags) Set(s string) error { *u = append(*u, s); return nil }
+
+// runWatch prints a line of JSON for each change to the vault, and posts
+// the changes to any webhooks, until signalled. No password is needed, as
+// only unencrypted attributes are compared.
+func runWatch(args []string) error {
+	fs := newFlagSet("watch")
+	interval := fs.Duration("interval", 5*time.Second, "how often to check for changes")
+	var hooks urlFlags
+	fs.Var(&hooks, "webhook", "post changes to `url`; may be repeated")
+	secretFile := fs.String("secret", "", "sign webhook deliveries with the first line of `file`")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(selected) > 1 {
+		return errSeveralVaults
+	}
+
+	var secret []byte
+	if *secretFile != "" {
+		data, err := ioutil.ReadFile(*secretFile)
+		if err != nil {
+			return err
+		}
+		secret = []byte(strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0]))
+	}
+
+	w, err := onepassword.NewWatcher(cfg)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(cfg.DBPath), filepath.Ext(cfg.DBPath))
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+	note("watching %s", name)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case <-sigs:
+			return nil
+		case <-t.C:
+		}
+		evs, err := w.Poll()
+		if err != nil {
+			// The vault may be mid-sync; try again next time
+			note("%s", err)
+			continue
+		}
+		if len(evs) == 0 {
+			continue
+		}
+		for i := range evs {
+			enc.Encode(&evs[i])
+		}
+		p := &webhook.Payload{Vault: name, Events: evs}
+		for _, url := range hooks {
+			go func(h *webhook.Hook) {
+				if err := h.Deliver(p); err != nil {
+					note("webhook: %s", err)
+				}
+			}(&webhook.Hook{URL: url, Secret: secret})
+		}
+	}
+}
+
+// keepCurrent reloads a long-running command's vault as other programs,
+// such as a syncing client, change it. Vaults that can't be watched stay
+// as they were opened.
+func keepCurrent(v *onepassword.Vault) {
+	events, err := v.Watch(context.Background())
+	if err != nil {
+		return
+	}
+	go func() {
+		for ev := range events {
+			if ev.Kind == onepassword.VaultRekeyed {
+				note("the master password changed; restart to read items saved with it")
+			}
+		}
+	}()
+}
@@ -0,0 +1,319 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of SyncConflict.
+const (
+	ConflictedCopy = "conflicted-copy" // In a file sync service's copy of a band file
+	DuplicateItem  = "duplicate"       // Another item that looks like a copy of the same one
+)
+
+// A SyncConflict pairs two versions of an item that a file sync service
+// kept both of, as when the vault was changed on two computers at once.
+type SyncConflict struct {
+	Kind    string        `json:"kind"`
+	Item    *Item         `json:"item"`           // The version in the vault, with details; nil if only the copy has the item
+	Copy    *Item         `json:"copy"`           // The other version, with details
+	File    string        `json:"file,omitempty"` // For ConflictedCopy, the name of the copy of the band
+	Changes []FieldChange `json:"changes"`        // From Item to Copy, as reported by Diff
+}
+
+// copySuffix matches the suffixes that sync services and 1Password add to
+// the titles of copies, such as " (conflicted copy 2026-10-15)" or " (1)".
+var copySuffix = regexp.MustCompile(`(?i)\s*\((?:[^()]*conflict[^()]*|copy|\d+)\)$`)
+
+// SyncConflicts finds the items that file sync services kept two versions
+// of. Dropbox, Syncthing, Nextcloud, and the like save a band written on
+// two computers at once as the band and a conflicted copy of it, such as
+// "band_A (conflicted copy 2026-10-15).js", which 1Password ignores; items
+// in such copies that differ from the vault's version, or that the vault
+// lacks, are reported as ConflictedCopy. Items that were duplicated under
+// a new uuid are paired heuristically, by category, title without a
+// copy's suffix, summary, and domain, and reported as DuplicateItem, with
+// the item created first as Item. Items in the trash are ignored.
+func (v *Vault) SyncConflicts() ([]SyncConflict, error) {
+	var conflicts []SyncConflict
+	if st, ok := v.store.(*opvaultStore); ok {
+		var err error
+		if conflicts, err = v.conflictedCopies(st); err != nil {
+			return nil, err
+		}
+	}
+
+	recs, err := v.store.records()
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]*record)
+	items := make(map[string]*Item)
+	var keys []string
+	for _, r := range recs {
+		item, err := v.decryptOverview(r)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join([]string{
+			item.Category.Uuid,
+			strings.ToLower(copySuffix.ReplaceAllString(item.Title, "")),
+			item.Info,
+			item.Domain(),
+		}, "\x00")
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], r)
+		items[r.Uuid] = item
+	}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Created < group[j].Created })
+		for _, r := range group {
+			if err = v.decryptDetails(r, items[r.Uuid]); err != nil {
+				return nil, err
+			}
+		}
+		first := items[group[0].Uuid]
+		for _, r := range group[1:] {
+			c := items[r.Uuid]
+			conflicts = append(conflicts, SyncConflict{DuplicateItem, first, c, "", diffItems(first, c)})
+		}
+	}
+	return conflicts, nil
+}
+
+// conflictedBands returns the names of the conflicted copies of bands in
+// the profile directory: files named like a band, with more before ".js".
+func (s *opvaultStore) conflictedBands() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.dir)
+	if err != nil {
+		return nil, err
+	}
+	canonical := make(map[string]bool)
+	for _, name := range bandNames {
+		canonical[name] = true
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, "band_") && strings.HasSuffix(name, ".js") && !canonical[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// readConflictedBand returns the items of a conflicted copy of a band. A
+// copy that can only be read in part is an error, as resolving conflicts
+// with it would lose the items that couldn't be read.
+func (s *opvaultStore) readConflictedBand(name string) (map[string]*bandItem, error) {
+	band := make(map[string]*bandItem)
+	errs, err := s.readBand(name, band)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return band, nil
+}
+
+func (v *Vault) conflictedCopies(st *opvaultStore) ([]SyncConflict, error) {
+	names, err := st.conflictedBands()
+	if err != nil {
+		return nil, err
+	}
+	current, err := st.load()
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []SyncConflict
+	for _, name := range names {
+		band, err := st.readConflictedBand(name)
+		if err != nil {
+			return nil, err
+		}
+		uuids := make([]string, 0, len(band))
+		for uuid := range band {
+			uuids = append(uuids, uuid)
+		}
+		sort.Strings(uuids)
+		for _, uuid := range uuids {
+			b := band[uuid]
+			st.mu.Lock()
+			cur := current[uuid]
+			st.mu.Unlock()
+			if b == nil || cur != nil && (cur.Trashed || cur.Updated == b.Updated && cur.Tx == b.Tx) {
+				continue
+			}
+			b.Uuid = uuid
+			// Copies that can't be read, such as from before the keys
+			// changed, can't be resolved either
+			copied, err := v.decryptOverview(b.record())
+			if err != nil {
+				continue
+			}
+			if err = v.decryptDetails(b.record(), copied); err != nil {
+				continue
+			}
+			c := SyncConflict{Kind: ConflictedCopy, Copy: copied, File: name}
+			if cur != nil {
+				r := cur.record()
+				if c.Item, err = v.decryptOverview(r); err != nil {
+					return nil, err
+				}
+				if err = v.decryptDetails(r, c.Item); err != nil {
+					return nil, err
+				}
+				if c.Changes = diffItems(c.Item, copied); len(c.Changes) == 0 {
+					continue
+				}
+			}
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts, nil
+}
+
+// ResolveSyncConflict settles a conflict reported by SyncConflicts,
+// keeping the vault's version of the item, or the copy's if useCopy is
+// set. Fields only the other version has are added to the one kept, as are
+// its tags and, if the kept version has none, its notes; its password is
+// added to the password history as by Merge. The result is saved as by
+// SaveItem under the uuid of the vault's version. The other version is
+// then tombstoned: a duplicate item is moved to the trash, and an item in
+// a conflicted copy of a band is removed from the copy, which is deleted
+// once it's empty.
+func (v *Vault) ResolveSyncConflict(c *SyncConflict, useCopy bool) error {
+	winner, loser := c.Item, c.Copy
+	if useCopy || c.Item == nil {
+		winner, loser = c.Copy, c.Item
+	}
+	merged := *winner
+	if loser != nil {
+		if err := mergeItems(&merged, loser); err != nil {
+			return err
+		}
+	}
+	if c.Item != nil {
+		merged.Uuid = c.Item.Uuid
+	}
+	if err := v.SaveItem(&merged); err != nil {
+		return err
+	}
+
+	switch c.Kind {
+	case DuplicateItem:
+		ts, ok := v.store.(trashStore)
+		if !ok {
+			return ErrReadOnly
+		}
+		if err := ts.trash(c.Copy.Uuid, time.Now().Unix(), v.overviewKP); err != nil {
+			return fmt.Errorf("item saved, but the duplicate wasn't moved to the trash: %s", err)
+		}
+		v.cache.evict(c.Copy.Uuid)
+		if v.indexCache {
+			if err := v.evictIndexCache(c.Copy.Uuid); err != nil {
+				return fmt.Errorf("duplicate moved to the trash, but not removed from the index cache: %s", err)
+			}
+		}
+		v.indexMu.Lock()
+		v.index = nil
+		v.indexMu.Unlock()
+	case ConflictedCopy:
+		st, ok := v.store.(*opvaultStore)
+		if !ok {
+			return errors.New("only OPVault directories have conflicted copies")
+		}
+		if err := st.removeConflicted(c.File, c.Copy.Uuid); err != nil {
+			return fmt.Errorf("item saved, but not removed from %s: %s", c.File, err)
+		}
+	}
+	return nil
+}
+
+// removeConflicted removes an item from a conflicted copy of a band,
+// deleting the copy once it's empty if files can be deleted.
+func (s *opvaultStore) removeConflicted(name, uuid string) error {
+	if s.writeFile == nil {
+		return ErrReadOnly
+	}
+	if s.lock != nil {
+		unlock, err := s.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	name = path.Join(s.dir, name)
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return err
+	}
+	band := make(map[string]json.RawMessage)
+	if err = unmarshalJS(data, &band); err != nil {
+		return fmt.Errorf("%s: %s", path.Base(name), err)
+	}
+	delete(band, uuid)
+	if len(band) == 0 && s.removeFile != nil {
+		return s.removeFile(name)
+	}
+	if data, err = json.Marshal(band); err != nil {
+		return err
+	}
+	return s.writeFile(name, append(append([]byte("ld("), data...), ");"...))
+}
+
+// mergeItems adds to winner the fields and tags only loser has, loser's
+// notes if winner has none, and loser's passwords to its history.
+func mergeItems(winner, loser *Item) error {
+	key := func(f *FieldValue) string { return f.Section + "\x00" + f.Id }
+	fields := winner.fields(true)
+	have := make(map[string]bool)
+	for i := range fields {
+		have[key(&fields[i])] = true
+	}
+	added := false
+	for _, f := range loser.Fields() {
+		if !have[key(&f)] {
+			fields = append(fields, f)
+			added = true
+		}
+	}
+	if added {
+		if err := winner.SetFields(fields, time.Now()); err != nil {
+			return err
+		}
+	}
+	if winner.Notes() == "" && loser.Notes() != "" {
+		if err := winner.SetNotes(loser.Notes()); err != nil {
+			return err
+		}
+	}
+	tags := append([]string(nil), winner.Tags...)
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		seen[NormalizeTag(t)] = true
+	}
+	for _, t := range loser.Tags {
+		if !seen[NormalizeTag(t)] {
+			tags = append(tags, t)
+			seen[NormalizeTag(t)] = true
+		}
+	}
+	winner.Tags = tags
+	_, err := mergePasswordHistory(winner, loser)
+	return err
+}
@@ -0,0 +1,99 @@
+package onepassword
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSyncConflicts(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub","ainfo":"wendy","url":"https://github.com/login","tags":["work"]}`, loginDetails, false)
+	f.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	// Saved on another computer as GitLab was changed on this one
+	f.band[uuidB2].Overview = mustEncrypt(t, []byte(`{"title":"GitLab CE"}`), f.okp)
+	f.band[uuidB2].Updated++
+	f.writeBand("B")
+	conflicted := "default/band_B (wendy's conflicted copy 2026-10-15).js"
+	f.fsys[conflicted] = f.fsys["default/band_B.js"]
+	f.band[uuidB2].Overview = mustEncrypt(t, []byte(`{"title":"GitLab"}`), f.okp)
+	f.band[uuidB2].Updated--
+	f.writeBand("B")
+	// And GitHub was duplicated under a new uuid, with a field added
+	f.addItem(uuidC3, CatLogin.Uuid, `{"title":"GitHub (1)","ainfo":"wendy","url":"https://github.com","tags":["personal"]}`,
+		`{"fields":[{"type":"T","name":"username","value":"wendy","designation":"username"},{"type":"P","name":"password","value":"hunter3","designation":"password"}],`+
+			`"sections":[{"name":"","title":"","fields":[{"k":"string","n":"pin","t":"PIN","v":"1234"}]}]}`, false)
+	f.band[uuidC3].Created++
+	f.writeBand("C")
+	v := f.open()
+	st := v.store.(*opvaultStore)
+	st.removeFile = func(name string) error {
+		delete(f.fsys, name)
+		return nil
+	}
+	v.cache = newItemCache(1 << 20)
+	v.dbPath, v.profile, v.indexCache = filepath.Join(t.TempDir(), "Personal.opvault"), "default", true
+
+	conflicts, err := v.SyncConflicts()
+	if err != nil {
+		t.Fatalf("Failed finding conflicts: %s", err)
+	}
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts. Got %+v.", conflicts)
+	}
+	c := conflicts[0]
+	if c.Kind != ConflictedCopy || c.Item.Title != "GitLab" || c.Copy.Title != "GitLab CE" || c.File != "band_B (wendy's conflicted copy 2026-10-15).js" ||
+		!reflect.DeepEqual(c.Changes, []FieldChange{{Field: "title", Old: "GitLab", New: "GitLab CE"}}) {
+		t.Errorf("Unexpected conflicted copy: %+v", c)
+	}
+	d := conflicts[1]
+	if d.Kind != DuplicateItem || d.Item.Uuid != uuidA1 || d.Copy.Uuid != uuidC3 {
+		t.Errorf("Unexpected duplicate: %+v", d)
+	}
+
+	if err = v.ResolveSyncConflict(&c, true); err != nil {
+		t.Fatalf("Failed resolving conflicted copy: %s", err)
+	}
+	if item, err := v.Item(uuidB2); err != nil || item.Title != "GitLab CE" {
+		t.Errorf("Expected the copy's version. Got %+v, %v.", item, err)
+	}
+	if _, ok := f.fsys[conflicted]; ok {
+		t.Error("Empty conflicted copy wasn't deleted")
+	}
+
+	// The duplicate is cached until it's moved to the trash
+	if _, err = v.Item(uuidC3); err != nil {
+		t.Fatalf("Failed reading duplicate: %s", err)
+	}
+	if _, err = v.Overviews(); err != nil {
+		t.Fatalf("Failed reading overviews: %s", err)
+	}
+	if err = v.ResolveSyncConflict(&d, false); err != nil {
+		t.Fatalf("Failed resolving duplicate: %s", err)
+	}
+	if _, ok := v.cache.byKey[cacheKey{"overview", uuidC3}]; ok {
+		t.Error("Expected the duplicate evicted from the item cache")
+	}
+	if _, ok := v.readIndexCache()[uuidC3]; ok {
+		t.Error("Expected the duplicate evicted from the index cache")
+	}
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	if item.Title != "GitHub" || item.Password() != "hunter2" || !reflect.DeepEqual(item.Tags, []string{"work", "personal"}) || item.Notes() != "note" {
+		t.Errorf("Expected the vault's version with the copy's tags. Got %+v.", item)
+	}
+	if pin, ok := item.Field("PIN"); !ok || pin != "1234" {
+		t.Errorf("Expected the copy's PIN. Got %q.", pin)
+	}
+	if h := item.PasswordHistory(); len(h) != 1 || h[0].Value != "hunter3" {
+		t.Errorf("Expected the copy's password in the history. Got %+v.", h)
+	}
+	if _, err = v.Item(uuidC3); err != ErrItemNotFound {
+		t.Errorf("Expected the duplicate in the trash. Got %v.", err)
+	}
+	if conflicts, err = v.SyncConflicts(); err != nil || len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts left. Got %+v, %v.", conflicts, err)
+	}
+}
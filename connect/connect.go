@@ -0,0 +1,245 @@
+// Package connect is a client for the REST API of a 1Password Connect
+// server, which serves the vaults of a 1Password account to applications
+// holding an access token. Items are returned as onepassword.Items, and a
+// Reader reads one vault through the onepassword.VaultReader interface, so
+// programs can switch between a local vault and Connect.
+package connect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// The environment variables read by NewClientFromEnv, as used by
+// 1Password's own Connect SDKs.
+const (
+	HostEnv  = "OP_CONNECT_HOST"
+	TokenEnv = "OP_CONNECT_TOKEN"
+)
+
+// An Error is returned for requests the server refuses.
+type Error struct {
+	StatusCode int    `json:"status"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("connect: %d %s", e.StatusCode, e.Message)
+}
+
+// A Client makes requests to the Connect server at URL, authenticating with
+// Token.
+type Client struct {
+	URL   string
+	Token string
+	HTTP  *http.Client // http.DefaultClient if nil
+}
+
+func NewClient(url, token string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), Token: token}
+}
+
+// NewClientFromEnv returns a client for the server and token given by
+// $OP_CONNECT_HOST and $OP_CONNECT_TOKEN.
+func NewClientFromEnv() (*Client, error) {
+	host, token := os.Getenv(HostEnv), os.Getenv(TokenEnv)
+	if host == "" || token == "" {
+		return nil, fmt.Errorf("connect: %s and %s must be set", HostEnv, TokenEnv)
+	}
+	return NewClient(host, token), nil
+}
+
+// get fetches path, decoding the JSON response into v, or returning the
+// body if v is nil.
+func (c *Client) get(path string, v interface{}) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{}
+		if json.Unmarshal(body, e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(body))
+		}
+		e.StatusCode = resp.StatusCode
+		return nil, e
+	}
+	if v == nil {
+		return body, nil
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return nil, fmt.Errorf("connect: %s: %s", path, err)
+	}
+	return nil, nil
+}
+
+// A Vault describes a vault the token can read.
+type Vault struct {
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Type        string    `json:"type"`
+	Items       int       `json:"items"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Vaults lists the vaults the token can read.
+func (c *Client) Vaults() ([]Vault, error) {
+	var vaults []Vault
+	_, err := c.get("/v1/vaults", &vaults)
+	return vaults, err
+}
+
+// Items returns the items of a vault without their details, which Item
+// fetches one item at a time.
+func (c *Client) Items(vaultId string) ([]onepassword.Item, error) {
+	var summaries []apiItem
+	if _, err := c.get("/v1/vaults/"+url.PathEscape(vaultId)+"/items", &summaries); err != nil {
+		return nil, err
+	}
+	items := make([]onepassword.Item, 0, len(summaries))
+	for _, s := range summaries {
+		if s.State == "ARCHIVED" || s.State == "DELETED" {
+			continue
+		}
+		item, err := s.item()
+		if err != nil {
+			return nil, err
+		}
+		item.Details = nil
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// Item returns an item of a vault with its details, or
+// onepassword.ErrItemNotFound.
+func (c *Client) Item(vaultId, itemId string) (*onepassword.Item, error) {
+	var a apiItem
+	_, err := c.get("/v1/vaults/"+url.PathEscape(vaultId)+"/items/"+url.PathEscape(itemId), &a)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+		return nil, onepassword.ErrItemNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return a.item()
+}
+
+// A File is a file attached to an item.
+type File struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentPath string `json:"content_path"`
+}
+
+// Files lists the files attached to an item.
+func (c *Client) Files(vaultId, itemId string) ([]File, error) {
+	var files []File
+	_, err := c.get("/v1/vaults/"+url.PathEscape(vaultId)+"/items/"+url.PathEscape(itemId)+"/files", &files)
+	return files, err
+}
+
+// FileContent returns the contents of a file attached to an item.
+func (c *Client) FileContent(vaultId, itemId, fileId string) ([]byte, error) {
+	return c.get("/v1/vaults/"+url.PathEscape(vaultId)+"/items/"+url.PathEscape(itemId)+"/files/"+url.PathEscape(fileId)+"/content", nil)
+}
+
+// Health describes the server and the services it depends on.
+type Health struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Dependencies []struct {
+		Service string `json:"service"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"dependencies"`
+}
+
+// Health returns the state of the server.
+func (c *Client) Health() (*Health, error) {
+	var h Health
+	if _, err := c.get("/health", &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Heartbeat returns an error unless the server is up.
+func (c *Client) Heartbeat() error {
+	_, err := c.get("/heartbeat", nil)
+	return err
+}
+
+// A Reader reads a single vault through a Client, implementing
+// onepassword.VaultReader. LookupItems fetches every item of the vault,
+// as predicates may look at their details.
+type Reader struct {
+	Client  *Client
+	VaultId string
+}
+
+var _ onepassword.VaultReader = (*Reader)(nil)
+
+// VaultByName returns a Reader for the vault with the supplied name or id.
+func (c *Client) VaultByName(name string) (*Reader, error) {
+	vaults, err := c.Vaults()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vaults {
+		if v.Id == name || strings.EqualFold(v.Name, name) {
+			return &Reader{c, v.Id}, nil
+		}
+	}
+	return nil, fmt.Errorf("connect: no vault named %q", name)
+}
+
+func (r *Reader) LookupItems(pred onepassword.ItemPredicate) ([]onepassword.Item, error) {
+	summaries, err := r.Client.Items(r.VaultId)
+	if err != nil {
+		return nil, err
+	}
+	var items []onepassword.Item
+	for _, s := range summaries {
+		item, err := r.Client.Item(r.VaultId, s.Uuid)
+		if err != nil {
+			return nil, err
+		}
+		if pred(item) {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+func (r *Reader) Item(uuid string) (*onepassword.Item, error) {
+	return r.Client.Item(r.VaultId, uuid)
+}
+
+// Close does nothing, as the client holds no keys.
+func (r *Reader) Close() {}
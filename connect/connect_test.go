@@ -0,0 +1,97 @@
+package connect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mpage/onepassword"
+)
+
+const testItem = `{
+	"id": "wepiqdxdzncjtnvmv5fegud4qy",
+	"title": "GitHub",
+	"category": "LOGIN",
+	"tags": ["dev"],
+	"urls": [{"href": "https://example.com"}, {"primary": true, "href": "https://github.com"}],
+	"sections": [{"id": "add more"}, {"id": "s1", "label": "Recovery"}],
+	"fields": [
+		{"id": "username", "type": "STRING", "purpose": "USERNAME", "label": "username", "value": "wendy"},
+		{"id": "password", "type": "CONCEALED", "purpose": "PASSWORD", "label": "password", "value": "hunter2"},
+		{"id": "notesPlain", "type": "STRING", "purpose": "NOTES", "label": "notesPlain", "value": "a note"},
+		{"id": "codes", "section": {"id": "s1"}, "type": "CONCEALED", "label": "codes", "value": "1234 5678"},
+		{"id": "otp", "section": {"id": "add more"}, "type": "OTP", "label": "one-time password", "value": "otpauth://totp/x?secret=GEZDGNBV"}
+	],
+	"createdAt": "2021-04-10T17:20:58.000Z",
+	"updatedAt": "2021-04-13T17:20:58.000Z"
+}`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status": 401, "message": "Invalid token signature"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/vaults":
+			w.Write([]byte(`[{"id": "v1", "name": "Dev", "items": 1}]`))
+		case "/v1/vaults/v1/items":
+			w.Write([]byte(`[{"id": "wepiqdxdzncjtnvmv5fegud4qy", "title": "GitHub", "category": "LOGIN"}]`))
+		case "/v1/vaults/v1/items/wepiqdxdzncjtnvmv5fegud4qy":
+			w.Write([]byte(testItem))
+		case "/heartbeat":
+			w.Write([]byte("."))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status": 404, "message": "Not found"}`))
+		}
+	}))
+}
+
+func TestReader(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	if err := NewClient(srv.URL, "wrong").Heartbeat(); err == nil || err.(*Error).StatusCode != 401 {
+		t.Fatalf("Expected a 401 error. Got %v.", err)
+	}
+
+	r, err := NewClient(srv.URL, "token").VaultByName("dev")
+	if err != nil {
+		t.Fatalf("Failed finding vault: %s", err)
+	}
+	var v onepassword.VaultReader = r
+	items, err := v.LookupItems(func(i *onepassword.Item) bool { return i.Username() == "wendy" })
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Unexpected items: %v, %v", items, err)
+	}
+
+	item := items[0]
+	if item.Category != onepassword.CatLogin || item.Url != "https://github.com" || len(item.Urls) != 2 {
+		t.Fatalf("Unexpected item: %+v", item)
+	}
+	if item.Password() != "hunter2" || item.Notes() != "a note" || item.TOTP() == "" {
+		t.Fatalf("Unexpected details: %s", item.Details)
+	}
+	if codes, _ := item.Field("Recovery.codes"); codes != "1234 5678" {
+		t.Fatalf("Unexpected section field %q", codes)
+	}
+
+	if _, err := v.Item("missing"); err != onepassword.ErrItemNotFound {
+		t.Fatalf("Expected ErrItemNotFound. Got %v.", err)
+	}
+}
+
+func TestCategory(t *testing.T) {
+	for name, want := range map[string]onepassword.Category{
+		"CREDIT_CARD":            onepassword.CatCreditCard,
+		"SOCIAL_SECURITY_NUMBER": onepassword.CatSSN,
+		"SSH_KEY":                onepassword.CatSSHKey,
+		"CUSTOM":                 onepassword.CatSecureNote,
+	} {
+		if got := category(name); got != want {
+			t.Errorf("%s: expected %v. Got %v.", name, want, got)
+		}
+	}
+}
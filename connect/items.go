@@ -0,0 +1,190 @@
+package connect
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// apiItem is an item as the API returns it. Listings leave out sections
+// and fields.
+type apiItem struct {
+	Id       string   `json:"id"`
+	Title    string   `json:"title"`
+	Category string   `json:"category"` // e.g. "LOGIN" or "CREDIT_CARD"
+	Tags     []string `json:"tags"`
+	Favorite bool     `json:"favorite"`
+	State    string   `json:"state"` // "", "ARCHIVED", or "DELETED"
+	Urls     []struct {
+		Label   string `json:"label"`
+		Primary bool   `json:"primary"`
+		Href    string `json:"href"`
+	} `json:"urls"`
+	Sections []struct {
+		Id    string `json:"id"`
+		Label string `json:"label"`
+	} `json:"sections"`
+	Fields    []apiField `json:"fields"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	// The op CLI names the times in snake case
+	CreatedAtCLI time.Time `json:"created_at"`
+	UpdatedAtCLI time.Time `json:"updated_at"`
+}
+
+type apiField struct {
+	Id      string `json:"id"`
+	Section *struct {
+		Id string `json:"id"`
+	} `json:"section"`
+	Type    string `json:"type"`    // e.g. "STRING" or "CONCEALED"
+	Purpose string `json:"purpose"` // "USERNAME", "PASSWORD", or "NOTES"
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+}
+
+// categories maps the API's category names, where they differ from ours
+// once underscores are ignored, e.g. "CREDIT_CARD" for "Credit Card".
+var categories = map[string]onepassword.Category{
+	"REWARD_PROGRAM":         onepassword.CatRewards,
+	"SOCIAL_SECURITY_NUMBER": onepassword.CatSSN,
+	"WIRELESS_ROUTER":        onepassword.CatRouter,
+	"EMAIL_ACCOUNT":          onepassword.CatEmail,
+}
+
+func category(name string) onepassword.Category {
+	if c, ok := categories[name]; ok {
+		return c
+	}
+	if c, ok := onepassword.CategoryByName(name); ok {
+		return c
+	}
+	// Including "CUSTOM"
+	return onepassword.CatSecureNote
+}
+
+// fieldKind returns the kind of section field for a field of the API.
+func fieldKind(f *apiField) string {
+	switch f.Type {
+	case "CONCEALED", "OTP":
+		return onepassword.KindConcealed
+	case "EMAIL":
+		return onepassword.KindEmail
+	case "URL":
+		return onepassword.KindURL
+	case "PHONE":
+		return onepassword.KindPhone
+	case "MENU":
+		return onepassword.KindMenu
+	case "DATE":
+		if _, err := strconv.ParseInt(f.Value, 10, 64); err == nil {
+			return onepassword.KindDate
+		}
+	case "MONTH_YEAR":
+		if _, err := strconv.Atoi(f.Value); err == nil && len(f.Value) == 6 {
+			return onepassword.KindMonthYear
+		}
+	}
+	return onepassword.KindString
+}
+
+// DecodeItem decodes an item in the JSON of the Connect API, which the op
+// command line tool also prints for "op item get --format json".
+func DecodeItem(data []byte) (*onepassword.Item, error) {
+	var a apiItem
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return a.item()
+}
+
+// item converts an item of the API into the details the apps store in a
+// vault: username and password fields become a Login's web form fields or
+// a Password item's password, and other fields are kept in their sections.
+func (a *apiItem) item() (*onepassword.Item, error) {
+	item := &onepassword.Item{
+		Uuid:     a.Id,
+		Title:    a.Title,
+		Category: category(a.Category),
+		Tags:     a.Tags,
+		Created:  a.CreatedAt,
+		Updated:  a.UpdatedAt,
+	}
+	if item.Created.IsZero() {
+		item.Created, item.Updated = a.CreatedAtCLI, a.UpdatedAtCLI
+	}
+	if item.Tags == nil {
+		item.Tags = []string{}
+	}
+	if a.Favorite {
+		item.FaveIndex = 1
+	}
+	for _, u := range a.Urls {
+		if u.Primary || item.Url == "" {
+			item.Url = u.Href
+		}
+		item.Urls = append(item.Urls, onepassword.Link{Label: u.Label, Url: u.Href})
+	}
+
+	d := map[string]interface{}{}
+	var loginFields []onepassword.LoginField
+	sections := []onepassword.Section{}
+	section := func(id string) *onepassword.Section {
+		for i := range sections {
+			if sections[i].Name == id {
+				return &sections[i]
+			}
+		}
+		s := onepassword.Section{Name: id, Fields: []onepassword.Field{}}
+		for _, as := range a.Sections {
+			if as.Id == id {
+				s.Title = as.Label
+			}
+		}
+		sections = append(sections, s)
+		return &sections[len(sections)-1]
+	}
+
+	for i := range a.Fields {
+		f := &a.Fields[i]
+		switch {
+		case f.Purpose == "NOTES":
+			if f.Value != "" {
+				d["notesPlain"] = f.Value
+			}
+			continue
+		case f.Purpose == "PASSWORD" && item.Category.Uuid == onepassword.CatPassword.Uuid:
+			d["password"] = f.Value
+			continue
+		case (f.Purpose == "USERNAME" || f.Purpose == "PASSWORD") && item.Category.Uuid == onepassword.CatLogin.Uuid:
+			designation, typ := "username", "T"
+			if f.Purpose == "PASSWORD" {
+				designation, typ = "password", "P"
+			}
+			loginFields = append(loginFields, onepassword.LoginField{Name: designation, Value: f.Value, Type: typ, Designation: designation})
+			continue
+		}
+
+		sectionId := ""
+		if f.Section != nil {
+			sectionId = f.Section.Id
+		}
+		id := f.Id
+		if f.Type == "OTP" && !strings.HasPrefix(id, "TOTP_") {
+			id = "TOTP_" + id
+		}
+		s := section(sectionId)
+		s.Fields = append(s.Fields, onepassword.Field{Value: f.Value, Name: f.Label, Kind: fieldKind(f), Id: id})
+	}
+	if loginFields != nil {
+		d["fields"] = loginFields
+	}
+	d["sections"] = sections
+
+	var err error
+	item.Details, err = json.Marshal(d)
+	return item, err
+}
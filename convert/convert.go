@@ -0,0 +1,204 @@
+// Package convert moves items between vaults and the formats password
+// managers use to exchange data: 1Password's 1PIF and 1PUX exports, CSV,
+// and KeePass databases.
+//
+// 1PIF and 1PUX keep items' categories and every field. CSV and KDBX only
+// have room for logins, so other items are flattened into a title,
+// username, password, URL, notes, and a list of extra fields, and come
+// back as Logins or Secure Notes.
+package convert
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// Options control conversions.
+type Options struct {
+	// Password encrypts exported KDBX databases and decrypts imported ones.
+	Password string
+
+	// Now is the export time recorded by formats that have one. Defaults
+	// to time.Now.
+	Now time.Time
+}
+
+// A Format converts items to and from one file format.
+type Format struct {
+	Name        string // As accepted by FormatByName, e.g. "1pif"
+	Ext         string // File name extension, including the dot
+	Description string
+
+	// Export writes items, which must include their details.
+	Export func(w io.Writer, items []onepassword.Item, opts Options) error
+
+	// Import reads the items in data. Items keep their uuids where the
+	// format has them, in the form vaults use; the rest have none.
+	Import func(data []byte, opts Options) ([]onepassword.Item, error)
+}
+
+// Formats lists the supported formats.
+var Formats = []*Format{
+	{"1pif", ".1pif", "1Password Interchange Format", export1PIF, import1PIF},
+	{"1pux", ".1pux", "1Password Unencrypted Export", export1PUX, import1PUX},
+	{"csv", ".csv", "comma separated values", exportCSV, importCSV},
+	{"kdbx", ".kdbx", "KeePass 2 database", exportKDBX, importKDBX},
+}
+
+// FormatByName returns the format with the supplied name, ignoring case.
+func FormatByName(name string) (*Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q", name)
+}
+
+// FormatForFile guesses the format of a file from its name.
+func FormatForFile(name string) (*Format, error) {
+	for _, f := range Formats {
+		if strings.HasSuffix(strings.ToLower(name), f.Ext) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("can't tell the format of %s", name)
+}
+
+// vaultUUID returns the uuid an imported item is saved under. 1PUX exports
+// use lowercase base32 uuids, which are converted to the uppercase hex
+// vaults use; other foreign uuids are replaced with new ones.
+func vaultUUID(uuid string) string {
+	if uuid == "" {
+		return ""
+	}
+	if b, err := hex.DecodeString(uuid); err == nil && len(b) == 16 {
+		return strings.ToUpper(uuid)
+	}
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(uuid))
+	if err == nil && len(b) == 16 {
+		return strings.ToUpper(hex.EncodeToString(b))
+	}
+	return onepassword.NewUUID()
+}
+
+// An entry is the part of an item every format can represent.
+type entry struct {
+	Uuid     string
+	Title    string
+	Url      string
+	Username string
+	Password string
+	Notes    string
+	TOTP     string
+	Tags     []string
+	Extra    []onepassword.FieldValue // Other fields
+	Created  time.Time
+	Updated  time.Time
+}
+
+func entryOf(item *onepassword.Item) *entry {
+	e := &entry{
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Url:      item.Url,
+		Username: item.Username(),
+		Password: item.Password(),
+		Notes:    item.Notes(),
+		TOTP:     item.TOTP(),
+		Tags:     item.Tags,
+		Created:  item.Created,
+		Updated:  item.Updated,
+	}
+	for _, f := range item.Fields() {
+		switch {
+		case f.Id == "username" && f.Value == e.Username:
+		case f.Id == "password" && f.Value == e.Password:
+		case f.Value == e.TOTP:
+		default:
+			e.Extra = append(e.Extra, f)
+		}
+	}
+	return e
+}
+
+// item turns the entry into a Login or, if it has no credentials, a Secure
+// Note. Extra fields are kept in sections named after theirs.
+func (e *entry) item() onepassword.Item {
+	cat := onepassword.CatLogin
+	if e.Username == "" && e.Password == "" && e.Url == "" && e.TOTP == "" {
+		cat = onepassword.CatSecureNote
+	}
+
+	var sections []onepassword.Section
+	section := func(title string) *onepassword.Section {
+		for i := range sections {
+			if sections[i].Title == title {
+				return &sections[i]
+			}
+		}
+		sections = append(sections, onepassword.Section{Name: title, Title: title})
+		return &sections[len(sections)-1]
+	}
+	if e.TOTP != "" {
+		s := section("")
+		s.Fields = append(s.Fields, onepassword.Field{
+			Value: e.TOTP,
+			Name:  "one-time password",
+			Kind:  onepassword.KindConcealed,
+			Id:    "TOTP_" + onepassword.NewUUID(),
+		})
+	}
+	for _, f := range e.Extra {
+		s := section(f.Section)
+		kind := f.Kind
+		if kind == "" {
+			kind = onepassword.KindString
+		}
+		id := f.Id
+		if id == "" {
+			id = f.Name
+		}
+		s.Fields = append(s.Fields, onepassword.Field{Value: f.Value, Name: f.Name, Kind: kind, Id: id})
+	}
+	if sections == nil {
+		sections = []onepassword.Section{}
+	}
+
+	var details interface{}
+	if cat == onepassword.CatLogin {
+		details = &onepassword.Login{
+			Fields: []onepassword.LoginField{
+				{Name: "username", Value: e.Username, Type: "T", Designation: "username"},
+				{Name: "password", Value: e.Password, Type: "P", Designation: "password"},
+			},
+			Sections:    sections,
+			Description: e.Notes,
+		}
+	} else {
+		details = &onepassword.Note{Sections: sections, Description: e.Notes}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		panic(err)
+	}
+
+	return onepassword.Item{
+		Uuid:     vaultUUID(e.Uuid),
+		Title:    e.Title,
+		Url:      e.Url,
+		Info:     e.Username,
+		Tags:     e.Tags,
+		Category: cat,
+		Created:  e.Created,
+		Updated:  e.Updated,
+		Details:  data,
+	}
+}
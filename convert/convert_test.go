@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+const (
+	loginDetails = `{"fields":[{"type":"T","name":"username","value":"wendy","designation":"username"},{"type":"P","name":"password","value":"hunter2","designation":"password"}],"notesPlain":"note","sections":[{"name":"s","title":"Security","fields":[{"k":"concealed","n":"TOTP_1","v":"JBSWY3DPEHPK3PXP","t":"one-time password"},{"k":"string","n":"pin","v":"1234","t":"PIN"}]}]}`
+	noteDetails  = `{"notesPlain":"wifi is upstairs","sections":[]}`
+)
+
+func testItems() []onepassword.Item {
+	at := time.Unix(1600000000, 0)
+	return []onepassword.Item{
+		{
+			Uuid:     "4B9C8F1E2D3A4B5C6D7E8F9A0B1C2D3E",
+			Title:    "GitHub",
+			Url:      "https://github.com",
+			Info:     "wendy",
+			Tags:     []string{"work", "dev"},
+			Category: onepassword.CatLogin,
+			Created:  at,
+			Updated:  at,
+			Details:  []byte(loginDetails),
+		},
+		{
+			Uuid:     "0A1B2C3D4E5F60718293A4B5C6D7E8F9",
+			Title:    "House notes",
+			Category: onepassword.CatSecureNote,
+			Created:  at,
+			Updated:  at,
+			Details:  []byte(noteDetails),
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	opts := Options{Password: "correct horse"}
+	for _, f := range Formats {
+		var b bytes.Buffer
+		if err := f.Export(&b, testItems(), opts); err != nil {
+			t.Fatalf("%s: failed exporting: %s", f.Name, err)
+		}
+		items, err := f.Import(b.Bytes(), opts)
+		if err != nil {
+			t.Fatalf("%s: failed importing: %s", f.Name, err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("%s: expected 2 items. Got %d.", f.Name, len(items))
+		}
+
+		login, note := &items[0], &items[1]
+		if login.Title != "GitHub" || login.Url != "https://github.com" || login.Username() != "wendy" || login.Password() != "hunter2" {
+			t.Errorf("%s: unexpected login: %+v", f.Name, login)
+		}
+		if login.TOTP() != "JBSWY3DPEHPK3PXP" || strings.Join(login.Tags, ",") != "work,dev" {
+			t.Errorf("%s: expected the TOTP secret and tags. Got %q, %q.", f.Name, login.TOTP(), login.Tags)
+		}
+		if pin, _ := login.Field("pin"); pin != "1234" && f.Name != "csv" {
+			t.Errorf("%s: expected the PIN field. Got %q.", f.Name, pin)
+		}
+		if note.Category != onepassword.CatSecureNote || note.Notes() != "wifi is upstairs" {
+			t.Errorf("%s: unexpected note: %+v", f.Name, note)
+		}
+		if f.Name != "csv" && (login.Uuid != "4B9C8F1E2D3A4B5C6D7E8F9A0B1C2D3E" || !login.Updated.Equal(time.Unix(1600000000, 0))) {
+			t.Errorf("%s: expected the uuid and times to be kept. Got %s, %s.", f.Name, login.Uuid, login.Updated)
+		}
+	}
+}
+
+func TestImportCSVAliases(t *testing.T) {
+	data := "name,login_uri,login_username,login_password,extra\nGitHub,https://github.com,wendy,hunter2,note\n"
+	items, err := importCSV([]byte(data), Options{})
+	if err != nil {
+		t.Fatalf("Failed importing: %s", err)
+	}
+	if len(items) != 1 || items[0].Title != "GitHub" || items[0].Password() != "hunter2" || items[0].Notes() != "note" {
+		t.Fatalf("Unexpected items: %+v", items)
+	}
+}
+
+func TestImportKDBXWrongPassword(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportKDBX(&b, testItems(), Options{Password: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importKDBX(b.Bytes(), Options{Password: "wrong"}); err != errKDBXPassword {
+		t.Fatalf("Expected a password error. Got %v.", err)
+	}
+}
+
+func TestVaultUUID(t *testing.T) {
+	for uuid, want := range map[string]string{
+		"":                                 "",
+		"4b9c8f1e2d3a4b5c6d7e8f9a0b1c2d3e": "4B9C8F1E2D3A4B5C6D7E8F9A0B1C2D3E",
+		"pvlhpxlwvnvlgmz3m5mrbwqrwy":       "7D5677DD76AB6AB3333B675910DA11B6",
+	} {
+		if got := vaultUUID(uuid); got != want {
+			t.Errorf("Expected %q for %q. Got %q.", want, uuid, got)
+		}
+	}
+	if got := vaultUUID("{not-a-uuid}"); len(got) != 32 || got != strings.ToUpper(got) {
+		t.Errorf("Expected a new uuid. Got %q.", got)
+	}
+}
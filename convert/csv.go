@@ -0,0 +1,124 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mpage/onepassword"
+)
+
+// csvHeader names the columns written by exportCSV.
+var csvHeader = []string{"title", "url", "username", "password", "totp", "notes", "tags", "category"}
+
+// csvAliases maps the column names used by other password managers'
+// exports to ours.
+var csvAliases = map[string]string{
+	"name":           "title",
+	"website":        "url",
+	"login_uri":      "url",
+	"location":       "url",
+	"login_username": "username",
+	"user":           "username",
+	"login_password": "password",
+	"otp":            "totp",
+	"login_totp":     "totp",
+	"otpauth":        "totp",
+	"note":           "notes",
+	"notesplain":     "notes",
+	"extra":          "notes",
+	"type":           "category",
+}
+
+// exportCSV writes one row per item. Extra fields don't fit in a fixed set
+// of columns, so they're appended to the notes as "label: value" lines.
+func exportCSV(w io.Writer, items []onepassword.Item, opts Options) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for i := range items {
+		e := entryOf(&items[i])
+		notes := e.Notes
+		for _, f := range e.Extra {
+			if notes != "" {
+				notes += "\n"
+			}
+			notes += f.Name + ": " + f.Value
+		}
+		cw.Write([]string{
+			e.Title, e.Url, e.Username, e.Password, e.TOTP, notes,
+			strings.Join(e.Tags, ","), items[i].Category.Name,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// importCSV reads a CSV file with a header row. Columns are matched by
+// name, including the names used by several other password managers, and
+// unknown columns are ignored.
+func importCSV(data []byte, opts Options) ([]onepassword.Item, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %s", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if alias, ok := csvAliases[name]; ok {
+			name = alias
+		}
+		if _, ok := cols[name]; !ok {
+			cols[name] = i
+		}
+	}
+	if _, ok := cols["title"]; !ok {
+		return nil, fmt.Errorf("csv: no title column in %q", strings.Join(rows[0], ","))
+	}
+
+	var items []onepassword.Item
+	for _, row := range rows[1:] {
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		e := &entry{
+			Title:    get("title"),
+			Url:      get("url"),
+			Username: get("username"),
+			Password: get("password"),
+			TOTP:     get("totp"),
+			Notes:    get("notes"),
+		}
+		for _, t := range strings.Split(get("tags"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				e.Tags = append(e.Tags, t)
+			}
+		}
+		item := e.item()
+		if cat, ok := onepassword.CategoryByName(get("category")); ok && cat == onepassword.CatPassword {
+			item = passwordItem(e)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// passwordItem turns an entry into a Password item.
+func passwordItem(e *entry) onepassword.Item {
+	item := *onepassword.NewItemFromTemplate(onepassword.CatPassword)
+	item.Title = e.Title
+	item.Tags = e.Tags
+	item.Details, _ = json.Marshal(&onepassword.Password{Password: e.Password, Description: e.Notes})
+	return item
+}
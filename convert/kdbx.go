@@ -0,0 +1,592 @@
+package convert
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// KeePass databases are written in the KDBX 3.1 format, which every
+// KeePass-compatible app reads: AES-KDF key derivation, AES-256-CBC, a
+// gzipped XML payload, and Salsa20 protecting passwords within the XML.
+// Only databases in the same format, protected by a password alone, can be
+// imported.
+const (
+	kdbxSignature1 = 0x9aa2d903
+	kdbxSignature2 = 0xb54bfb67
+	kdbxVersion    = 0x00030001
+
+	kdbxRounds = 60000 // AES-KDF rounds for exported databases
+)
+
+// Header field identifiers
+const (
+	kdbxEndOfHeader         = 0
+	kdbxCipherID            = 2
+	kdbxCompressionFlags    = 3
+	kdbxMasterSeed          = 4
+	kdbxTransformSeed       = 5
+	kdbxTransformRounds     = 6
+	kdbxEncryptionIV        = 7
+	kdbxProtectedStreamKey  = 8
+	kdbxStreamStartBytes    = 9
+	kdbxInnerRandomStreamID = 10
+
+	kdbxSalsa20 = 2 // Inner random stream
+)
+
+var (
+	kdbxCipherAES    = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	kdbxSalsa20Nonce = []byte{0xe8, 0x30, 0x09, 0x4b, 0x97, 0x20, 0x5d, 0x2a}
+
+	errKDBXPassword = errors.New("kdbx: wrong password or corrupt database")
+)
+
+type kdbxHeader struct {
+	masterSeed         []byte
+	transformSeed      []byte
+	transformRounds    uint64
+	iv                 []byte
+	protectedStreamKey []byte
+	streamStartBytes   []byte
+	compressed         bool
+}
+
+// masterKey derives the key the payload is encrypted with.
+func (h *kdbxHeader) masterKey(password string) ([]byte, error) {
+	pw := sha256.Sum256([]byte(password))
+	key := sha256.Sum256(pw[:])
+
+	c, err := aes.NewCipher(h.transformSeed)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < h.transformRounds; i++ {
+		c.Encrypt(key[:16], key[:16])
+		c.Encrypt(key[16:], key[16:])
+	}
+	transformed := sha256.Sum256(key[:])
+
+	m := sha256.New()
+	m.Write(h.masterSeed)
+	m.Write(transformed[:])
+	return m.Sum(nil), nil
+}
+
+// A salsaStream is the keystream that protected values are XORed with, in
+// the order they appear in the XML.
+type salsaStream struct {
+	key     [32]byte
+	counter uint64
+	buf     []byte
+}
+
+func newSalsaStream(protectedStreamKey []byte) *salsaStream {
+	return &salsaStream{key: sha256.Sum256(protectedStreamKey)}
+}
+
+func (s *salsaStream) xor(b []byte) {
+	for i := range b {
+		if len(s.buf) == 0 {
+			var counter [16]byte
+			copy(counter[:], kdbxSalsa20Nonce)
+			binary.LittleEndian.PutUint64(counter[8:], s.counter)
+			s.counter++
+			s.buf = make([]byte, 64)
+			salsa.XORKeyStream(s.buf, s.buf, &counter, &s.key)
+		}
+		b[i] ^= s.buf[0]
+		s.buf = s.buf[1:]
+	}
+}
+
+type kdbxFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    kdbxMeta `xml:"Meta"`
+	Root    struct {
+		Group kdbxGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type kdbxMeta struct {
+	Generator      string `xml:"Generator"`
+	HeaderHash     string `xml:"HeaderHash,omitempty"`
+	DatabaseName   string `xml:"DatabaseName,omitempty"`
+	RecycleBinUUID string `xml:"RecycleBinUUID,omitempty"`
+}
+
+type kdbxGroup struct {
+	UUID    string      `xml:"UUID"`
+	Name    string      `xml:"Name"`
+	Entries []kdbxEntry `xml:"Entry"`
+	Groups  []kdbxGroup `xml:"Group"`
+}
+
+type kdbxEntry struct {
+	UUID    string       `xml:"UUID"`
+	Tags    string       `xml:"Tags,omitempty"`
+	Times   kdbxTimes    `xml:"Times"`
+	Strings []kdbxString `xml:"String"`
+}
+
+type kdbxTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+}
+
+type kdbxString struct {
+	Key   string    `xml:"Key"`
+	Value kdbxValue `xml:"Value"`
+}
+
+type kdbxValue struct {
+	Protected string `xml:"Protected,attr,omitempty"`
+	Text      string `xml:",chardata"`
+}
+
+// Standard entry strings
+const (
+	kdbxTitle    = "Title"
+	kdbxUserName = "UserName"
+	kdbxPassword = "Password"
+	kdbxURL      = "URL"
+	kdbxNotes    = "Notes"
+	kdbxOTP      = "otp" // As used by KeePassXC
+)
+
+// kdbxUUID returns the 16 byte KeePass uuid of an item, reusing the item's
+// uuid when it's in the usual hexadecimal form.
+func kdbxUUID(uuid string) string {
+	b, err := hex.DecodeString(uuid)
+	if err != nil || len(b) != 16 {
+		b, _ = hex.DecodeString(onepassword.NewUUID())
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func exportKDBX(w io.Writer, items []onepassword.Item, opts Options) error {
+	if opts.Password == "" {
+		return fmt.Errorf("kdbx: a password is required")
+	}
+
+	h := &kdbxHeader{transformRounds: kdbxRounds, compressed: true}
+	for _, b := range []*[]byte{&h.masterSeed, &h.transformSeed, &h.protectedStreamKey, &h.streamStartBytes} {
+		*b = make([]byte, 32)
+	}
+	h.iv = make([]byte, aes.BlockSize)
+	for _, b := range [][]byte{h.masterSeed, h.transformSeed, h.protectedStreamKey, h.streamStartBytes, h.iv} {
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+	}
+	header := h.encode()
+	headerHash := sha256.Sum256(header)
+
+	var doc kdbxFile
+	doc.Meta = kdbxMeta{
+		Generator:    "opvault",
+		HeaderHash:   base64.StdEncoding.EncodeToString(headerHash[:]),
+		DatabaseName: "Exported",
+	}
+	root := &doc.Root.Group
+	root.UUID = kdbxUUID("")
+	root.Name = "Exported"
+
+	stream := newSalsaStream(h.protectedStreamKey)
+	for i := range items {
+		e := entryOf(&items[i])
+		entry := kdbxEntry{
+			UUID: kdbxUUID(e.Uuid),
+			Tags: strings.Join(e.Tags, ";"),
+			Times: kdbxTimes{
+				CreationTime:         e.Created.UTC().Format(time.RFC3339),
+				LastModificationTime: e.Updated.UTC().Format(time.RFC3339),
+			},
+		}
+		add := func(key, value string, protect bool) {
+			v := kdbxValue{Text: value}
+			if protect {
+				b := []byte(value)
+				stream.xor(b)
+				v = kdbxValue{Protected: "True", Text: base64.StdEncoding.EncodeToString(b)}
+			}
+			entry.Strings = append(entry.Strings, kdbxString{key, v})
+		}
+		add(kdbxTitle, e.Title, false)
+		add(kdbxUserName, e.Username, false)
+		add(kdbxPassword, e.Password, true)
+		add(kdbxURL, e.Url, false)
+		add(kdbxNotes, e.Notes, false)
+		if e.TOTP != "" {
+			add(kdbxOTP, e.TOTP, true)
+		}
+		seen := make(map[string]bool)
+		for _, f := range e.Extra {
+			key := f.Name
+			if f.Section != "" {
+				key = f.Section + "." + key
+			}
+			// Keys must be unique within an entry
+			base := key
+			for n := 2; seen[key] || isStandardKDBXKey(key); n++ {
+				key = fmt.Sprintf("%s (%d)", base, n)
+			}
+			seen[key] = true
+			add(key, f.Value, f.Concealed)
+		}
+		root.Entries = append(root.Entries, entry)
+	}
+
+	var payload bytes.Buffer
+	payload.Write(h.streamStartBytes)
+	var xmlData bytes.Buffer
+	xmlData.WriteString(xml.Header)
+	if err := xml.NewEncoder(&xmlData).Encode(&doc); err != nil {
+		return err
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(xmlData.Bytes())
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	writeHashedBlocks(&payload, gz.Bytes())
+
+	key, err := h.masterKey(opts.Password)
+	if err != nil {
+		return err
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	plain := payload.Bytes()
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(c, h.iv).CryptBlocks(plain, plain)
+
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(plain)
+	return err
+}
+
+func isStandardKDBXKey(key string) bool {
+	switch key {
+	case kdbxTitle, kdbxUserName, kdbxPassword, kdbxURL, kdbxNotes, kdbxOTP:
+		return true
+	}
+	return false
+}
+
+// encode returns the file signature, version, and header fields.
+func (h *kdbxHeader) encode() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2, kdbxVersion})
+	field := func(id byte, data []byte) {
+		b.WriteByte(id)
+		binary.Write(&b, binary.LittleEndian, uint16(len(data)))
+		b.Write(data)
+	}
+	u32 := make([]byte, 4)
+	u64 := make([]byte, 8)
+	field(kdbxCipherID, kdbxCipherAES)
+	if h.compressed {
+		binary.LittleEndian.PutUint32(u32, 1)
+	}
+	field(kdbxCompressionFlags, u32)
+	field(kdbxMasterSeed, h.masterSeed)
+	field(kdbxTransformSeed, h.transformSeed)
+	binary.LittleEndian.PutUint64(u64, h.transformRounds)
+	field(kdbxTransformRounds, u64)
+	field(kdbxEncryptionIV, h.iv)
+	field(kdbxProtectedStreamKey, h.protectedStreamKey)
+	field(kdbxStreamStartBytes, h.streamStartBytes)
+	stream := make([]byte, 4)
+	binary.LittleEndian.PutUint32(stream, kdbxSalsa20)
+	field(kdbxInnerRandomStreamID, stream)
+	field(kdbxEndOfHeader, []byte("\r\n\r\n"))
+	return b.Bytes()
+}
+
+// parseKDBXHeader reads the header, returning it and its length.
+func parseKDBXHeader(data []byte) (*kdbxHeader, int, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data) != kdbxSignature1 || binary.LittleEndian.Uint32(data[4:]) != kdbxSignature2 {
+		return nil, 0, fmt.Errorf("kdbx: not a KeePass database")
+	}
+	if major := binary.LittleEndian.Uint32(data[8:]) >> 16; major != 3 {
+		return nil, 0, fmt.Errorf("kdbx: unsupported version %d; only KDBX 3 databases can be imported", major)
+	}
+
+	h := &kdbxHeader{}
+	off := 12
+	for {
+		if off+3 > len(data) {
+			return nil, 0, fmt.Errorf("kdbx: truncated header")
+		}
+		id := data[off]
+		n := int(binary.LittleEndian.Uint16(data[off+1:]))
+		off += 3
+		if off+n > len(data) {
+			return nil, 0, fmt.Errorf("kdbx: truncated header")
+		}
+		v := data[off : off+n]
+		off += n
+
+		switch id {
+		case kdbxEndOfHeader:
+			return h, off, nil
+		case kdbxCipherID:
+			if !bytes.Equal(v, kdbxCipherAES) {
+				return nil, 0, fmt.Errorf("kdbx: unsupported cipher; only AES databases can be imported")
+			}
+		case kdbxCompressionFlags:
+			h.compressed = len(v) == 4 && binary.LittleEndian.Uint32(v) == 1
+		case kdbxMasterSeed:
+			h.masterSeed = v
+		case kdbxTransformSeed:
+			h.transformSeed = v
+		case kdbxTransformRounds:
+			if len(v) == 8 {
+				h.transformRounds = binary.LittleEndian.Uint64(v)
+			}
+		case kdbxEncryptionIV:
+			h.iv = v
+		case kdbxProtectedStreamKey:
+			h.protectedStreamKey = v
+		case kdbxStreamStartBytes:
+			h.streamStartBytes = v
+		case kdbxInnerRandomStreamID:
+			if len(v) != 4 || binary.LittleEndian.Uint32(v) != kdbxSalsa20 {
+				return nil, 0, fmt.Errorf("kdbx: unsupported inner stream; only Salsa20 is supported")
+			}
+		}
+	}
+}
+
+// writeHashedBlocks writes data in the hashed block format: each block is
+// its index, the SHA-256 of its data, its size, and its data, ending with
+// an empty block.
+func writeHashedBlocks(w io.Writer, data []byte) {
+	const blockSize = 1 << 20
+	var index uint32
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		sum := sha256.Sum256(data[:n])
+		binary.Write(w, binary.LittleEndian, index)
+		w.Write(sum[:])
+		binary.Write(w, binary.LittleEndian, uint32(n))
+		w.Write(data[:n])
+		data = data[n:]
+		index++
+	}
+	binary.Write(w, binary.LittleEndian, index)
+	w.Write(make([]byte, sha256.Size+4))
+}
+
+func readHashedBlocks(data []byte) ([]byte, error) {
+	var out []byte
+	for {
+		if len(data) < 40 {
+			return nil, fmt.Errorf("kdbx: truncated block")
+		}
+		hash := data[4:36]
+		n := int(binary.LittleEndian.Uint32(data[36:]))
+		data = data[40:]
+		if n == 0 {
+			return out, nil
+		}
+		if n > len(data) {
+			return nil, fmt.Errorf("kdbx: truncated block")
+		}
+		if sum := sha256.Sum256(data[:n]); !bytes.Equal(sum[:], hash) {
+			return nil, fmt.Errorf("kdbx: corrupt block")
+		}
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+}
+
+func importKDBX(data []byte, opts Options) ([]onepassword.Item, error) {
+	h, off, err := parseKDBXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := h.masterKey(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ct := data[off:]
+	if len(ct) == 0 || len(ct)%aes.BlockSize != 0 || len(h.iv) != aes.BlockSize {
+		return nil, errKDBXPassword
+	}
+	plain := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(c, h.iv).CryptBlocks(plain, ct)
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > aes.BlockSize || !bytes.HasPrefix(plain, h.streamStartBytes) {
+		return nil, errKDBXPassword
+	}
+	plain = plain[len(h.streamStartBytes) : len(plain)-pad]
+
+	payload, err := readHashedBlocks(plain)
+	if err != nil {
+		return nil, err
+	}
+	if h.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("kdbx: %s", err)
+		}
+		if payload, err = ioutil.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("kdbx: %s", err)
+		}
+	}
+
+	payload, err = unprotectKDBX(payload, newSalsaStream(h.protectedStreamKey))
+	if err != nil {
+		return nil, err
+	}
+	var doc kdbxFile
+	if err = xml.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("kdbx: %s", err)
+	}
+
+	var items []onepassword.Item
+	var walk func(g *kdbxGroup, path []string)
+	walk = func(g *kdbxGroup, path []string) {
+		if doc.Meta.RecycleBinUUID != "" && g.UUID == doc.Meta.RecycleBinUUID {
+			return
+		}
+		for i := range g.Entries {
+			items = append(items, kdbxItem(&g.Entries[i], path))
+		}
+		for i := range g.Groups {
+			walk(&g.Groups[i], append(path, g.Groups[i].Name))
+		}
+	}
+	walk(&doc.Root.Group, nil)
+	return items, nil
+}
+
+// unprotectKDBX decrypts the protected values in a KDBX document, leaving
+// their Protected attributes to mark them as concealed. They must be
+// decrypted in document order, including those in entries' histories, so
+// it's done on the token stream before decoding.
+func unprotectKDBX(doc []byte, stream *salsaStream) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	var out bytes.Buffer
+	e := xml.NewEncoder(&out)
+	protected := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("kdbx: %s", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			protected = false
+			for _, a := range t.Attr {
+				if a.Name.Local == "Protected" && a.Value == "True" {
+					protected = true
+				}
+			}
+		case xml.CharData:
+			if protected {
+				protected = false
+				b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(t)))
+				if err != nil {
+					return nil, fmt.Errorf("kdbx: protected value: %s", err)
+				}
+				stream.xor(b)
+				tok = xml.CharData(b)
+			}
+		case xml.EndElement:
+			protected = false
+		case xml.ProcInst:
+			// The encoder only accepts an XML declaration first
+			continue
+		}
+		if err = e.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// kdbxItem converts an entry, tagging it with the path of the group it's
+// in below the root.
+func kdbxItem(ke *kdbxEntry, groups []string) onepassword.Item {
+	e := &entry{}
+	if b, err := base64.StdEncoding.DecodeString(ke.UUID); err == nil && len(b) == 16 {
+		e.Uuid = strings.ToUpper(hex.EncodeToString(b))
+	}
+	e.Created, _ = time.Parse(time.RFC3339, ke.Times.CreationTime)
+	e.Updated, _ = time.Parse(time.RFC3339, ke.Times.LastModificationTime)
+	for _, t := range strings.FieldsFunc(ke.Tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			e.Tags = append(e.Tags, t)
+		}
+	}
+	if len(groups) > 0 {
+		e.Tags = append(e.Tags, strings.Join(groups, "/"))
+	}
+
+	for _, s := range ke.Strings {
+		switch s.Key {
+		case kdbxTitle:
+			e.Title = s.Value.Text
+		case kdbxUserName:
+			e.Username = s.Value.Text
+		case kdbxPassword:
+			e.Password = s.Value.Text
+		case kdbxURL:
+			e.Url = s.Value.Text
+		case kdbxNotes:
+			e.Notes = s.Value.Text
+		case kdbxOTP:
+			e.TOTP = s.Value.Text
+		default:
+			if s.Value.Text == "" {
+				continue
+			}
+			f := onepassword.FieldValue{Name: s.Key, Value: s.Value.Text, Kind: onepassword.KindString}
+			if s.Value.Protected == "True" {
+				f.Kind = onepassword.KindConcealed
+			}
+			if i := strings.IndexByte(s.Key, '.'); i > 0 {
+				f.Section, f.Name = s.Key[:i], s.Key[i+1:]
+			}
+			e.Extra = append(e.Extra, f)
+		}
+	}
+	return e.item()
+}
@@ -0,0 +1,157 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// onePIFSeparator follows each item in a 1PIF file.
+const onePIFSeparator = "***5642bee8-a5ff-11dc-8314-0800200c9a66***"
+
+// onePIFTypes maps category uuids to the type names used by 1PIF. Items in
+// other categories are exported as Secure Notes.
+var onePIFTypes = map[string]string{
+	onepassword.CatLogin.Uuid:           "webforms.WebForm",
+	onepassword.CatCreditCard.Uuid:      "wallet.financial.CreditCard",
+	onepassword.CatSecureNote.Uuid:      "securenotes.SecureNote",
+	onepassword.CatIdentity.Uuid:        "identities.Identity",
+	onepassword.CatPassword.Uuid:        "passwords.Password",
+	onepassword.CatSoftwareLicense.Uuid: "wallet.computer.License",
+	onepassword.CatBankAccount.Uuid:     "wallet.financial.BankAccountUS",
+	onepassword.CatDatabase.Uuid:        "wallet.computer.Database",
+	onepassword.CatDriverLicense.Uuid:   "wallet.government.DriversLicense",
+	onepassword.CatOutdoorLicense.Uuid:  "wallet.government.HuntingLicense",
+	onepassword.CatMembership.Uuid:      "wallet.membership.Membership",
+	onepassword.CatPassport.Uuid:        "wallet.government.Passport",
+	onepassword.CatRewards.Uuid:         "wallet.membership.RewardProgram",
+	onepassword.CatSSN.Uuid:             "wallet.government.SsnUS",
+	onepassword.CatRouter.Uuid:          "wallet.computer.Router",
+	onepassword.CatServer.Uuid:          "wallet.computer.UnixServer",
+	onepassword.CatEmail.Uuid:           "wallet.onlineservices.Email.v2",
+}
+
+type onePIFItem struct {
+	Uuid           string          `json:"uuid"`
+	Title          string          `json:"title"`
+	TypeName       string          `json:"typeName"`
+	Location       string          `json:"location,omitempty"`
+	CreatedAt      int64           `json:"createdAt"`
+	UpdatedAt      int64           `json:"updatedAt"`
+	FaveIndex      int             `json:"faveIndex,omitempty"`
+	SecureContents json.RawMessage `json:"secureContents"`
+	OpenContents   struct {
+		Tags []string `json:"tags,omitempty"`
+	} `json:"openContents"`
+}
+
+func export1PIF(w io.Writer, items []onepassword.Item, opts Options) error {
+	bw := bufio.NewWriter(w)
+	for i := range items {
+		item := &items[i]
+		typeName, ok := onePIFTypes[item.Category.Uuid]
+		if !ok {
+			typeName = onePIFTypes[onepassword.CatSecureNote.Uuid]
+		}
+
+		// Links live with the details in 1PIF
+		contents := make(map[string]json.RawMessage)
+		if len(item.Details) > 0 {
+			if err := json.Unmarshal(item.Details, &contents); err != nil {
+				return fmt.Errorf("%s: %s", item.Title, err)
+			}
+		}
+		if len(item.Urls) > 0 {
+			var urls []map[string]string
+			for _, l := range item.Urls {
+				urls = append(urls, map[string]string{"label": l.Label, "url": l.Url})
+			}
+			contents["URLs"], _ = json.Marshal(urls)
+		}
+		secure, err := json.Marshal(contents)
+		if err != nil {
+			return err
+		}
+
+		p := onePIFItem{
+			Uuid:           item.Uuid,
+			Title:          item.Title,
+			TypeName:       typeName,
+			Location:       item.Url,
+			CreatedAt:      item.Created.Unix(),
+			UpdatedAt:      item.Updated.Unix(),
+			FaveIndex:      item.FaveIndex,
+			SecureContents: secure,
+		}
+		p.OpenContents.Tags = item.Tags
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		bw.WriteString("\n" + onePIFSeparator + "\n")
+	}
+	return bw.Flush()
+}
+
+func import1PIF(data []byte, opts Options) ([]onepassword.Item, error) {
+	categories := make(map[string]onepassword.Category)
+	for uuid, name := range onePIFTypes {
+		categories[name], _ = onepassword.CategoryByUUID(uuid)
+	}
+
+	var items []onepassword.Item
+	for n, chunk := range strings.Split(string(data), onePIFSeparator) {
+		chunk = strings.TrimSpace(chunk)
+		if chunk == "" {
+			continue
+		}
+		var p onePIFItem
+		if err := json.Unmarshal([]byte(chunk), &p); err != nil {
+			return nil, fmt.Errorf("1pif: item %d: %s", n+1, err)
+		}
+		if p.TypeName == "system.Tombstone" {
+			continue
+		}
+		cat, ok := categories[p.TypeName]
+		if !ok {
+			cat = onepassword.CatSecureNote
+		}
+
+		item := onepassword.Item{
+			Uuid:      vaultUUID(p.Uuid),
+			Title:     p.Title,
+			Url:       p.Location,
+			Tags:      p.OpenContents.Tags,
+			Category:  cat,
+			FaveIndex: p.FaveIndex,
+			Created:   time.Unix(p.CreatedAt, 0),
+			Updated:   time.Unix(p.UpdatedAt, 0),
+			Details:   json.RawMessage("{}"),
+		}
+		if len(p.SecureContents) > 0 {
+			contents := make(map[string]json.RawMessage)
+			if err := json.Unmarshal(p.SecureContents, &contents); err != nil {
+				return nil, fmt.Errorf("1pif: %s: %s", p.Title, err)
+			}
+			var urls []struct {
+				Label string `json:"label"`
+				Url   string `json:"url"`
+			}
+			json.Unmarshal(contents["URLs"], &urls)
+			for _, u := range urls {
+				item.Urls = append(item.Urls, onepassword.Link{Label: u.Label, Url: u.Url})
+			}
+			delete(contents, "URLs")
+			item.Details, _ = json.Marshal(contents)
+		}
+		item.Info = item.Username()
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,351 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// A 1PUX file is a zip archive holding export.attributes and export.data,
+// a JSON document of accounts, their vaults, and the vaults' items.
+type onePUXData struct {
+	Accounts []struct {
+		Attrs  map[string]string `json:"attrs"`
+		Vaults []struct {
+			Attrs map[string]string `json:"attrs"`
+			Items []onePUXItem      `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePUXItem struct {
+	Uuid         string `json:"uuid"`
+	FavIndex     int    `json:"favIndex"`
+	CreatedAt    int64  `json:"createdAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+	State        string `json:"state"`
+	CategoryUuid string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields     []onePUXLoginField                 `json:"loginFields"`
+		NotesPlain      string                             `json:"notesPlain"`
+		Sections        []onePUXSection                    `json:"sections"`
+		PasswordHistory []onepassword.PasswordHistoryEntry `json:"passwordHistory"`
+		Password        string                             `json:"password,omitempty"`
+	} `json:"details"`
+	Overview struct {
+		Subtitle string      `json:"subtitle"`
+		Title    string      `json:"title"`
+		Url      string      `json:"url"`
+		Urls     []onePUXURL `json:"urls,omitempty"`
+		Ps       int         `json:"ps,omitempty"`
+		Tags     []string    `json:"tags,omitempty"`
+	} `json:"overview"`
+}
+
+type onePUXLoginField struct {
+	Value       string `json:"value"`
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	FieldType   string `json:"fieldType"`
+	Designation string `json:"designation,omitempty"`
+}
+
+type onePUXSection struct {
+	Title  string        `json:"title"`
+	Name   string        `json:"name"`
+	Fields []onePUXField `json:"fields"`
+}
+
+type onePUXURL struct {
+	Label string `json:"label"`
+	Url   string `json:"url"`
+}
+
+// A onePUXField's value is an object with a single key naming its type,
+// e.g. {"concealed": "hunter2"} or {"date": 1893456000}.
+type onePUXField struct {
+	Title string                     `json:"title"`
+	Id    string                     `json:"id"`
+	Value map[string]json.RawMessage `json:"value"`
+}
+
+// onePUXKinds maps field kinds to the 1PUX value types that differ.
+var onePUXKinds = map[string]string{
+	onepassword.KindURL:    "url",
+	onepassword.KindCCType: "creditCardType",
+}
+
+// value returns a field's value and kind.
+func (f *onePUXField) value() (value, kind string) {
+	for typ, raw := range f.Value {
+		kind = typ
+		for k, t := range onePUXKinds {
+			if t == typ {
+				kind = k
+			}
+		}
+		if typ == "totp" {
+			kind = onepassword.KindConcealed
+		}
+
+		var s string
+		var n json.Number
+		var email struct {
+			Address string `json:"email_address"`
+		}
+		switch {
+		case json.Unmarshal(raw, &s) == nil:
+			value = s
+		case json.Unmarshal(raw, &n) == nil:
+			value = n.String()
+		case typ == "email" && json.Unmarshal(raw, &email) == nil && email.Address != "":
+			value = email.Address
+		case string(raw) != "null":
+			value = string(raw)
+		}
+		return value, kind
+	}
+	return "", onepassword.KindString
+}
+
+func export1PUX(w io.Writer, items []onepassword.Item, opts Options) error {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var out []onePUXItem
+	for i := range items {
+		item := &items[i]
+		var p onePUXItem
+		p.Uuid = item.Uuid
+		p.FavIndex = item.FaveIndex
+		p.CreatedAt = item.Created.Unix()
+		p.UpdatedAt = item.Updated.Unix()
+		p.State = "active"
+		p.CategoryUuid = item.Category.Uuid
+		p.Overview.Title = item.Title
+		p.Overview.Subtitle = item.Info
+		p.Overview.Url = item.Url
+		p.Overview.Ps = item.Strength
+		p.Overview.Tags = item.Tags
+		for _, l := range item.Urls {
+			p.Overview.Urls = append(p.Overview.Urls, onePUXURL{l.Label, l.Url})
+		}
+
+		d := &p.Details
+		d.NotesPlain = item.Notes()
+		d.PasswordHistory = item.PasswordHistory()
+		d.LoginFields = []onePUXLoginField{}
+		d.Sections = []onePUXSection{}
+		totp := item.TOTP()
+		for _, f := range item.Fields() {
+			if f.Section == "" && item.Category.Uuid == onepassword.CatPassword.Uuid {
+				d.Password = f.Value
+				continue
+			}
+			if f.Section == "" && item.Category.Uuid == onepassword.CatLogin.Uuid {
+				lf := onePUXLoginField{Value: f.Value, Name: f.Name, FieldType: f.Kind}
+				if f.Id == "username" || f.Id == "password" {
+					lf.Designation = f.Id
+				}
+				d.LoginFields = append(d.LoginFields, lf)
+				continue
+			}
+
+			typ := f.Kind
+			if t, ok := onePUXKinds[typ]; ok {
+				typ = t
+			}
+			if f.Value == totp {
+				typ = "totp"
+			}
+			var raw json.RawMessage
+			if (f.Kind == onepassword.KindDate || f.Kind == onepassword.KindMonthYear) && isInteger(f.Value) {
+				raw = json.RawMessage(f.Value)
+			} else if f.Kind == onepassword.KindAddress && json.Valid([]byte(f.Value)) {
+				raw = json.RawMessage(f.Value)
+			} else {
+				raw, _ = json.Marshal(f.Value)
+			}
+
+			var s *onePUXSection
+			for j := range d.Sections {
+				if d.Sections[j].Title == f.Section {
+					s = &d.Sections[j]
+				}
+			}
+			if s == nil {
+				d.Sections = append(d.Sections, onePUXSection{Title: f.Section, Name: f.Section})
+				s = &d.Sections[len(d.Sections)-1]
+			}
+			s.Fields = append(s.Fields, onePUXField{
+				Title: f.Name,
+				Id:    f.Id,
+				Value: map[string]json.RawMessage{typ: raw},
+			})
+		}
+		out = append(out, p)
+	}
+
+	doc := map[string]interface{}{
+		"accounts": []interface{}{map[string]interface{}{
+			"attrs": map[string]string{"accountName": "opvault", "name": "opvault"},
+			"vaults": []interface{}{map[string]interface{}{
+				"attrs": map[string]string{"name": "Exported", "type": "U"},
+				"items": out,
+			}},
+		}},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	attrs, _ := json.Marshal(map[string]interface{}{
+		"version":     3,
+		"description": "1Password Unencrypted Export",
+		"createdAt":   now.Unix(),
+	})
+
+	zw := zip.NewWriter(w)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"export.attributes", attrs}, {"export.data", data}} {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func import1PUX(data []byte, opts Options) ([]onepassword.Item, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("1pux: %s", err)
+	}
+	var doc onePUXData
+	found := false
+	for _, f := range zr.File {
+		if f.Name != "export.data" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("1pux: %s", err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("1pux: no export.data in archive")
+	}
+
+	var items []onepassword.Item
+	for _, a := range doc.Accounts {
+		for _, v := range a.Vaults {
+			for _, p := range v.Items {
+				if p.State != "" && p.State != "active" {
+					continue
+				}
+				item, err := p.item()
+				if err != nil {
+					return nil, fmt.Errorf("1pux: %s: %s", p.Overview.Title, err)
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (p *onePUXItem) item() (onepassword.Item, error) {
+	cat, ok := onepassword.CategoryByUUID(p.CategoryUuid)
+	if !ok {
+		cat = onepassword.CatSecureNote
+	}
+	item := onepassword.Item{
+		Uuid:      vaultUUID(p.Uuid),
+		Title:     p.Overview.Title,
+		Url:       p.Overview.Url,
+		Info:      p.Overview.Subtitle,
+		Tags:      p.Overview.Tags,
+		Strength:  p.Overview.Ps,
+		Category:  cat,
+		FaveIndex: p.FavIndex,
+		Created:   time.Unix(p.CreatedAt, 0),
+		Updated:   time.Unix(p.UpdatedAt, 0),
+	}
+	for _, u := range p.Overview.Urls {
+		item.Urls = append(item.Urls, onepassword.Link{Label: u.Label, Url: u.Url})
+	}
+
+	d := map[string]interface{}{}
+	if p.Details.NotesPlain != "" {
+		d["notesPlain"] = p.Details.NotesPlain
+	}
+	if p.Details.Password != "" {
+		d["password"] = p.Details.Password
+	}
+	if len(p.Details.PasswordHistory) > 0 {
+		d["passwordHistory"] = p.Details.PasswordHistory
+	}
+	if len(p.Details.LoginFields) > 0 {
+		var fields []onepassword.LoginField
+		for _, f := range p.Details.LoginFields {
+			name := f.Name
+			if name == "" {
+				name = f.Id
+			}
+			fields = append(fields, onepassword.LoginField{
+				Name:        name,
+				Value:       f.Value,
+				Type:        f.FieldType,
+				Designation: f.Designation,
+			})
+		}
+		d["fields"] = fields
+	}
+	sections := []onepassword.Section{}
+	for _, s := range p.Details.Sections {
+		sec := onepassword.Section{Name: s.Name, Title: s.Title, Fields: []onepassword.Field{}}
+		for _, f := range s.Fields {
+			value, kind := f.value()
+			id := f.Id
+			if _, ok := f.Value["totp"]; ok && !strings.HasPrefix(id, "TOTP_") {
+				id = "TOTP_" + id
+			}
+			sec.Fields = append(sec.Fields, onepassword.Field{Value: value, Name: f.Title, Kind: kind, Id: id})
+		}
+		sections = append(sections, sec)
+	}
+	d["sections"] = sections
+
+	var err error
+	item.Details, err = json.Marshal(d)
+	return item, err
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,154 @@
+// Package credentials supplies master passwords from the places a user might
+// keep them: the terminal, standard input, a file, an environment variable,
+// or an askpass program.
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ErrUnavailable is returned by a Source that has no password to offer, such
+// as an unset environment variable. First moves on to the next source when it
+// sees it.
+var ErrUnavailable = errors.New("no password available")
+
+// A Source supplies a password. The prompt describes what the password is
+// for; sources that don't interact with the user ignore it.
+type Source interface {
+	Password(prompt string) (string, error)
+}
+
+// Env reads the password from an environment variable.
+type Env string
+
+func (e Env) Password(prompt string) (string, error) {
+	pass, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", ErrUnavailable
+	}
+	return pass, nil
+}
+
+// File reads the password from the first line of a file.
+type File string
+
+func (f File) Password(prompt string) (string, error) {
+	fh, err := os.Open(string(f))
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	pass, err := readLine(bufio.NewReader(fh))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", f, err)
+	}
+	return pass, nil
+}
+
+// A Reader reads one password per line from r, so a single reader can answer
+// several prompts in turn. Use NewReader(os.Stdin) for --password-stdin.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Source reading passwords from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{bufio.NewReader(r)}
+}
+
+func (r *Reader) Password(prompt string) (string, error) {
+	return readLine(r.r)
+}
+
+// readLine reads a line, without its line ending. A final line needn't end
+// with a newline, but there must be one.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	} else if err == io.EOF {
+		return "", errors.New("no password given")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Askpass runs a program with the prompt as its only argument and reads the
+// password from its standard output, like ssh's SSH_ASKPASS. The program
+// exiting unsuccessfully means the user cancelled.
+type Askpass string
+
+func (a Askpass) Password(prompt string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(string(a), prompt)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("askpass: cancelled")
+		}
+		return "", fmt.Errorf("askpass: %s", err)
+	}
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
+
+// Terminal prompts on the controlling terminal without echoing input. The
+// prompt is written to standard error so it doesn't mix with a command's
+// output. When standard input isn't a terminal, e.g. because it's a pipe,
+// /dev/tty is used instead.
+type Terminal struct{}
+
+func (Terminal) Password(prompt string) (string, error) {
+	in := os.Stdin
+	if !terminal.IsTerminal(int(in.Fd())) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return "", ErrUnavailable
+		}
+		defer tty.Close()
+		in = tty
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := terminal.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(pass), nil
+}
+
+// Static always supplies the same password.
+type Static string
+
+func (s Static) Password(prompt string) (string, error) {
+	return string(s), nil
+}
+
+// First tries each source in turn, returning the first password found. A
+// source returning ErrUnavailable is skipped; any other error is returned.
+func First(sources ...Source) Source {
+	return first(sources)
+}
+
+type first []Source
+
+func (f first) Password(prompt string) (string, error) {
+	for _, s := range f {
+		pass, err := s.Password(prompt)
+		if err != ErrUnavailable {
+			return pass, err
+		}
+	}
+	return "", ErrUnavailable
+}
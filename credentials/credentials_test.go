@@ -0,0 +1,59 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "pass")
+	if err := ioutil.WriteFile(file, []byte("from file\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	askpass := filepath.Join(dir, "askpass")
+	if err := ioutil.WriteFile(askpass, []byte("#!/bin/sh\necho \"answer to $1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CREDENTIALS_TEST", "from env")
+	defer os.Unsetenv("CREDENTIALS_TEST")
+
+	for _, tc := range []struct {
+		src  Source
+		want string
+	}{
+		{Env("CREDENTIALS_TEST"), "from env"},
+		{File(file), "from file"},
+		{Askpass(askpass), "answer to Password:"},
+		{First(Env("CREDENTIALS_UNSET"), Static("static")), "static"},
+	} {
+		got, err := tc.src.Password("Password:")
+		if err != nil || got != tc.want {
+			t.Errorf("%T: got %q, %v. Expected %q.", tc.src, got, err, tc.want)
+		}
+	}
+
+	if _, err := First(Env("CREDENTIALS_UNSET")).Password(""); err != ErrUnavailable {
+		t.Errorf("Expected ErrUnavailable. Got %v.", err)
+	}
+}
+
+func TestReaderAnswersEachPrompt(t *testing.T) {
+	r := NewReader(strings.NewReader("one\r\ntwo"))
+	for _, want := range []string{"one", "two"} {
+		if got, err := r.Password(""); err != nil || got != want {
+			t.Fatalf("Got %q, %v. Expected %q.", got, err, want)
+		}
+	}
+	if _, err := r.Password(""); err == nil {
+		t.Fatalf("Expected an error once the input is exhausted.")
+	}
+}
@@ -0,0 +1,132 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNoKeychain is returned when the platform's credential store can't be
+// reached: security(1) on macOS, secret-tool(1) from libsecret for the
+// freedesktop Secret Service elsewhere, or PowerShell on Windows.
+var ErrNoKeychain = errors.New("no supported keychain found")
+
+// Keychain reads a password kept in the operating system's credential
+// store, so a vault can be unlocked without a prompt while the user is
+// logged in. Passwords are stored under the Service and Account pair.
+type Keychain struct {
+	Service string
+	Account string
+}
+
+// Windows has no command line tool for reading stored passwords, so the
+// Credential Locker, shown in Credential Manager, is used through WinRT.
+const psPasswordVault = `[void][Windows.Security.Credentials.PasswordVault,Windows.Security.Credentials,ContentType=WindowsRuntime];` +
+	`$v = New-Object Windows.Security.Credentials.PasswordVault;`
+
+// keychainTool returns the command the platform needs to perform op, one
+// of "lookup", "store", or "delete", and the input to give it.
+func (k Keychain) keychainTool(op, password string) ([]string, string, error) {
+	var argv []string
+	var stdin string
+	switch runtime.GOOS {
+	case "darwin":
+		switch op {
+		case "lookup":
+			argv = []string{"security", "find-generic-password", "-s", k.Service, "-a", k.Account, "-w"}
+		case "store":
+			// Commands are read from stdin, keeping the password out of ps
+			argv = []string{"security", "-i"}
+			stdin = fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+				securityQuote(k.Service), securityQuote(k.Account), securityQuote(password))
+		case "delete":
+			argv = []string{"security", "delete-generic-password", "-s", k.Service, "-a", k.Account}
+		}
+	case "windows":
+		script := psPasswordVault
+		switch op {
+		case "lookup":
+			script += `$c = $v.Retrieve($env:OPVAULT_SERVICE, $env:OPVAULT_ACCOUNT); $c.RetrievePassword(); [Console]::Out.Write($c.Password)`
+		case "store":
+			script += `$v.Add((New-Object Windows.Security.Credentials.PasswordCredential($env:OPVAULT_SERVICE, $env:OPVAULT_ACCOUNT, [Console]::In.ReadToEnd())))`
+			stdin = password
+		case "delete":
+			script += `$v.Remove($v.Retrieve($env:OPVAULT_SERVICE, $env:OPVAULT_ACCOUNT))`
+		}
+		argv = []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", script}
+	default:
+		switch op {
+		case "lookup":
+			argv = []string{"secret-tool", "lookup", "service", k.Service, "account", k.Account}
+		case "store":
+			argv = []string{"secret-tool", "store", "--label", k.Service + " " + k.Account, "service", k.Service, "account", k.Account}
+			stdin = password
+		case "delete":
+			argv = []string{"secret-tool", "clear", "service", k.Service, "account", k.Account}
+		}
+	}
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return nil, "", ErrNoKeychain
+	}
+	return argv, stdin, nil
+}
+
+// securityQuote quotes s for security(1)'s interactive mode.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (k Keychain) run(op, password string) (string, error) {
+	argv, stdin, err := k.keychainTool(op, password)
+	if err != nil {
+		return "", err
+	}
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "OPVAULT_SERVICE="+k.Service, "OPVAULT_ACCOUNT="+k.Account)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			return "", fmt.Errorf("keychain: %s", msg)
+		}
+		return "", fmt.Errorf("keychain: %s", err)
+	}
+	return out.String(), nil
+}
+
+// Password returns the stored password, or ErrUnavailable if there's none
+// or the keychain can't be read, e.g. because the user declined to unlock
+// it.
+func (k Keychain) Password(prompt string) (string, error) {
+	out, err := k.run("lookup", "")
+	if err != nil || out == "" {
+		return "", ErrUnavailable
+	}
+	// security and secret-tool end the password with a newline
+	if runtime.GOOS != "windows" {
+		out = strings.TrimSuffix(out, "\n")
+	}
+	return out, nil
+}
+
+// Store saves password in the keychain, replacing any stored before.
+func (k Keychain) Store(password string) error {
+	if runtime.GOOS == "windows" {
+		// The Credential Locker refuses to replace a credential
+		k.Delete()
+	}
+	_, err := k.run("store", password)
+	return err
+}
+
+// Delete removes the stored password, if there is one.
+func (k Keychain) Delete() error {
+	_, err := k.run("delete", "")
+	return err
+}
@@ -0,0 +1,58 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSecretTool stands in for secret-tool, keeping one password in a file.
+const fakeSecretTool = `#!/bin/sh
+store="$(dirname "$0")/secret"
+case "$1" in
+store) cat > "$store" ;;
+lookup) [ -f "$store" ] && cat "$store" && echo ;;
+clear) rm -f "$store" ;;
+esac
+`
+
+func TestKeychain(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("uses a fake secret-tool")
+	}
+	dir, err := ioutil.TempDir("", "keychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "secret-tool"), []byte(fakeSecretTool), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	k := Keychain{"opvault", "test"}
+	if _, err := k.Password(""); err != ErrUnavailable {
+		t.Fatalf("Expected ErrUnavailable. Got %v.", err)
+	}
+	if err := k.Store("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Password(""); err != nil || got != "hunter2" {
+		t.Fatalf("Got %q, %v. Expected the stored password.", got, err)
+	}
+	if err := k.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Password(""); err != ErrUnavailable {
+		t.Fatalf("Expected ErrUnavailable after deleting. Got %v.", err)
+	}
+
+	os.Setenv("PATH", filepath.Join(dir, "missing"))
+	if err := k.Store("x"); err != ErrNoKeychain {
+		t.Fatalf("Expected ErrNoKeychain. Got %v.", err)
+	}
+}
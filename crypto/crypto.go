@@ -2,16 +2,18 @@ package crypto
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/binary"
 	"errors"
-	"io/ioutil"
-
-	"golang.org/x/crypto/pbkdf2"
+	"fmt"
+	"io"
+	"sync/atomic"
 )
 
 const (
@@ -28,21 +30,82 @@ var (
 	ErrIncorrectMAC         = errors.New("incorrect MAC")
 	ErrInvalidMagic         = errors.New("invalid magic")
 
+	// ErrMalformedOPData is returned, with the lengths at fault, for
+	// OPData01 blobs whose declared plaintext length doesn't fit their
+	// ciphertext.
+	ErrMalformedOPData = errors.New("malformed opdata01")
+
 	OPData01Magic           = []byte("opdata01")
 )
 
 // KeyPair holds an encryption and MAC key used to encrypt and authenticate
-// data stored in the vault.
+// data stored in the vault. The AES key schedule of EncKey is expanded on
+// first use and kept for the blobs after, so keys mustn't be changed in
+// place once used, except by Zero.
 type KeyPair struct {
 	EncKey []byte
 	MACKey []byte
+
+	// Strict rejects OPData01 blobs decrypted with the keys unless they
+	// have 1-16 bytes of padding, as 1Password writes, rather than only
+	// checking that their declared length fits. Keys decrypted with
+	// strict keys are strict too.
+	Strict bool
+
+	block atomic.Value // *aesBlock, set on first use
+}
+
+// An aesBlock is the block cipher expanded from a KeyPair's EncKey.
+type aesBlock struct {
+	key []byte // The EncKey it was expanded from
+	b   cipher.Block
+}
+
+// cipher returns the AES block cipher for EncKey, expanding the key
+// schedule only the first time, rather than for each of the thousands of
+// blobs a vault may hold.
+func (kp *KeyPair) cipher() (cipher.Block, error) {
+	if c, ok := kp.block.Load().(*aesBlock); ok && c.b != nil && sameSlice(c.key, kp.EncKey) {
+		return c.b, nil
+	}
+	b, err := aes.NewCipher(kp.EncKey)
+	if err != nil {
+		return nil, err
+	}
+	kp.block.Store(&aesBlock{kp.EncKey, b})
+	return b, nil
+}
+
+// sameSlice reports whether a and b are the same bytes in memory.
+func sameSlice(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Zero overwrites the keys with zeros and drops the expanded key schedule,
+// leaving it to the garbage collector, as Go's AES implementation can't
+// wipe it.
+func (kp *KeyPair) Zero() {
+	wipe(kp.EncKey)
+	wipe(kp.MACKey)
+	kp.block.Store(&aesBlock{})
 }
 
 // ComputeDerivedKeys derives the encryption and MAC keys that are used decrypt and
 // authenticate the master encryption and MAC keys.
 func ComputeDerivedKeys(pass string, salt []byte, nIters int) (*KeyPair) {
-	data := pbkdf2.Key([]byte(pass), salt, nIters, 64, sha512.New)
-	return &KeyPair{data[0:32], data[32:64]}
+	data := deriveKey([]byte(pass), salt, nIters, 64)
+	return &KeyPair{EncKey: data[0:32], MACKey: data[32:64]}
+}
+
+// ComputeDerivedKeysContext is ComputeDerivedKeys, returning ctx's error
+// if ctx is done before the keys are derived, as when a user gives up on
+// unlocking a profile with many iterations on a slow machine.
+func ComputeDerivedKeysContext(ctx context.Context, pass string, salt []byte, nIters int) (*KeyPair, error) {
+	data, err := deriveKeyContext(ctx, []byte(pass), salt, nIters, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{EncKey: data[0:32], MACKey: data[32:64]}, nil
 }
 
 // DecryptMasterKeys decrypts a master keypair from an OPData blob. Use this to
@@ -53,7 +116,7 @@ func DecryptMasterKeys(opdata []byte, derivedKeys *KeyPair) (*KeyPair, error) {
 		return nil, err
 	}
 	data := sha512.Sum512(mkData)
-	return &KeyPair{data[0:32], data[32:64]}, nil
+	return &KeyPair{EncKey: data[0:32], MACKey: data[32:64], Strict: derivedKeys.Strict}, nil
 }
 
 // authenticate verifies the MAC on the supplied blob. The blob is expected to
@@ -84,31 +147,30 @@ func authenticate(blob []byte, kp *KeyPair) ([]byte, error) {
 //     16 bytes - IV
 //     Variable - Ciphertext
 func decrypt(blob []byte, kp *KeyPair) ([]byte, error) {
-	r := bytes.NewReader(blob)
+	return decryptInto(nil, blob, kp)
+}
 
-	// Read IV
-	iv := make([]byte, aes.BlockSize)
-	n, err := r.Read(iv)
-	if err != nil {
-		return nil, err
-	} else if n != aes.BlockSize {
+// decryptInto is decrypt, writing the plaintext to the start of dst if it
+// has the capacity, and otherwise to a new buffer. The IV and ciphertext
+// are sliced from blob, and dst may be the ciphertext itself.
+func decryptInto(dst, blob []byte, kp *KeyPair) ([]byte, error) {
+	if len(blob) < aes.BlockSize {
 		return nil, ErrIncompleteIV
 	}
-
-	// Read ciphertext
-	ciphertext, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	} else if len(ciphertext) < aes.BlockSize {
+	iv, ciphertext := blob[:aes.BlockSize], blob[aes.BlockSize:]
+	if len(ciphertext) < aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
 		return nil, ErrIncompleteCiphertext
 	}
 
 	// Decrypt
-	b, err := aes.NewCipher(kp.EncKey)
+	b, err := kp.cipher()
 	if err != nil {
 		return nil, err
 	}
-	plaintext := make([]byte, len(ciphertext))
+	if cap(dst) < len(ciphertext) {
+		dst = make([]byte, len(ciphertext))
+	}
+	plaintext := dst[:len(ciphertext)]
 	bm := cipher.NewCBCDecrypter(b, iv)
 	bm.CryptBlocks(plaintext, ciphertext)
 
@@ -124,42 +186,99 @@ func decrypt(blob []byte, kp *KeyPair) ([]byte, error) {
 //     Variable - Ciphertext
 //     32 bytes - MAC
 func DecryptOPData01(opdata []byte, kp *KeyPair) ([]byte, error) {
-	opdata, err := authenticate(opdata, kp)
+	return DecryptOPData01Into(nil, opdata, kp)
+}
+
+// DecryptOPData01Into is DecryptOPData01, decrypting into dst rather than
+// a new buffer when dst has the capacity, so that servers can pool
+// plaintext buffers and wipe them once done. The plaintext is returned as
+// a slice of dst, which is written from its start with the padding and
+// plaintext, as many bytes as the ciphertext has. If dst is too small, a
+// new buffer is used instead, as append does.
+func DecryptOPData01Into(dst, opdata []byte, kp *KeyPair) ([]byte, error) {
+	blob, padLen, err := openOPData01(opdata, kp)
 	if err != nil {
 		return nil, err
 	}
-
-	r := bytes.NewBuffer(opdata)
-
-	// Read magic
-	magic := make([]byte, len(OPData01Magic))
-	n, err := r.Read(magic)
+	plaintext, err := decryptInto(dst, blob, kp)
 	if err != nil {
 		return nil, err
-	} else if n != len(magic) {
-		return nil, ErrIncompleteMagic
-	} else if !bytes.Equal(magic, OPData01Magic) {
-		return nil, ErrInvalidMagic
 	}
+	return plaintext[padLen:len(plaintext)], nil
+}
 
-	// Read plaintext length
-	var ptLen uint64
-	err = binary.Read(r, binary.LittleEndian, &ptLen)
+// DecryptOPData01InPlace is DecryptOPData01, decrypting over the
+// ciphertext in opdata rather than into a new buffer. The plaintext is
+// returned as a slice of opdata, which can't be decrypted again.
+func DecryptOPData01InPlace(opdata []byte, kp *KeyPair) ([]byte, error) {
+	blob, padLen, err := openOPData01(opdata, kp)
 	if err != nil {
 		return nil, err
 	}
-	padLen := aes.BlockSize - (ptLen % aes.BlockSize)
-
-	// Decrypt data
-	ct, err := ioutil.ReadAll(r)
-	plaintext, err := decrypt(ct, kp)
+	var ciphertext []byte
+	if len(blob) > aes.BlockSize {
+		ciphertext = blob[aes.BlockSize:]
+	}
+	plaintext, err := decryptInto(ciphertext, blob, kp)
 	if err != nil {
 		return nil, err
 	}
-
 	return plaintext[padLen:len(plaintext)], nil
 }
 
+// openOPData01 authenticates an OPData01 blob and parses its header,
+// returning the IV and ciphertext that follow it, and the length of the
+// padding that precedes the plaintext.
+func openOPData01(opdata []byte, kp *KeyPair) ([]byte, int64, error) {
+	opdata, err := authenticate(opdata, kp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Read magic
+	if len(opdata) < len(OPData01Magic) {
+		return nil, 0, ErrIncompleteMagic
+	} else if !bytes.Equal(opdata[:len(OPData01Magic)], OPData01Magic) {
+		return nil, 0, ErrInvalidMagic
+	}
+
+	// Read plaintext length
+	hdrLen := len(OPData01Magic) + 8
+	if len(opdata) < hdrLen {
+		return nil, 0, ErrIncompleteHeader
+	}
+	ptLen := binary.LittleEndian.Uint64(opdata[len(OPData01Magic):hdrLen])
+	blob := opdata[hdrLen:]
+	if len(blob) < aes.BlockSize {
+		return nil, 0, ErrIncompleteIV
+	}
+	padLen, err := paddingLength(int64(len(blob)-aes.BlockSize), ptLen, kp.Strict)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return blob, padLen, nil
+}
+
+// paddingLength returns how much of ctLen bytes of ciphertext pads the
+// ptLen bytes of plaintext declared in the header. Plaintexts filling a
+// whole number of blocks are usually padded with a block of their own,
+// but other programs add none, so the padding is what the declared length
+// leaves rather than what it implies.
+func paddingLength(ctLen int64, ptLen uint64, strict bool) (int64, error) {
+	if ctLen < aes.BlockSize || ctLen%aes.BlockSize != 0 {
+		return 0, ErrIncompleteCiphertext
+	}
+	if ptLen > uint64(ctLen) {
+		return 0, fmt.Errorf("%w: %d bytes of plaintext declared for %d bytes of ciphertext", ErrMalformedOPData, ptLen, ctLen)
+	}
+	padLen := ctLen - int64(ptLen)
+	if strict && (padLen < 1 || padLen > aes.BlockSize) {
+		return 0, fmt.Errorf("%w: %d bytes of padding, not 1-%d", ErrMalformedOPData, padLen, aes.BlockSize)
+	}
+	return padLen, nil
+}
+
 // DecryptItemKey parses, authenticates, and decrypts item key blobs. Item Key
 // blobs have the format:
 //     16 bytes - IV
@@ -179,7 +298,64 @@ func DecryptItemKey(itemKey []byte, kp *KeyPair) (*KeyPair, error) {
 	itemKP := &KeyPair{
 		EncKey: plaintext[0:EncKeySize],
 		MACKey: plaintext[EncKeySize:EncKeySize + MACKeySize],
+		Strict: kp.Strict,
 	}
 
 	return itemKP, nil
 }
+
+// mac appends the HMAC-SHA256 of data to it.
+func mac(data []byte, kp *KeyPair) []byte {
+	m := hmac.New(sha256.New, kp.MACKey)
+	m.Write(data)
+	return m.Sum(data)
+}
+
+// EncryptOPData01 encrypts and authenticates plaintext, producing an
+// OPData01 blob that DecryptOPData01 accepts. As in blobs written by
+// 1Password, the plaintext is prefixed with 1-16 random bytes of padding to
+// fill a whole number of blocks.
+func EncryptOPData01(plaintext []byte, kp *KeyPair) ([]byte, error) {
+	padLen := aes.BlockSize - (len(plaintext) % aes.BlockSize)
+	padded := make([]byte, padLen+len(plaintext))
+	if _, err := io.ReadFull(rand.Reader, padded[:padLen]); err != nil {
+		return nil, err
+	}
+	copy(padded[padLen:], plaintext)
+
+	b, err := kp.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	hdrLen := len(OPData01Magic) + 8
+	blob := make([]byte, hdrLen+aes.BlockSize+len(padded), hdrLen+aes.BlockSize+len(padded)+sha256.Size)
+	copy(blob, OPData01Magic)
+	binary.LittleEndian.PutUint64(blob[len(OPData01Magic):], uint64(len(plaintext)))
+	iv := blob[hdrLen : hdrLen+aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(b, iv).CryptBlocks(blob[hdrLen+aes.BlockSize:], padded)
+
+	return mac(blob, kp), nil
+}
+
+// EncryptItemKey encrypts and authenticates an item keypair, producing a
+// blob that DecryptItemKey accepts.
+func EncryptItemKey(itemKP *KeyPair, kp *KeyPair) ([]byte, error) {
+	b, err := kp.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := append(append([]byte{}, itemKP.EncKey...), itemKP.MACKey...)
+	blob := make([]byte, aes.BlockSize+len(keys), aes.BlockSize+len(keys)+sha256.Size)
+	iv := blob[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(b, iv).CryptBlocks(blob[aes.BlockSize:], keys)
+
+	return mac(blob, kp), nil
+}
@@ -1,7 +1,14 @@
 package crypto
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"testing"
 )
 
@@ -95,3 +102,275 @@ func TestDecryptMasterKey(t *testing.T) {
 	}
 
 }
+
+func TestComputeDerivedKeysContext(t *testing.T) {
+	profile := profileFixture()
+	want := ComputeDerivedKeys(masterPass, profile.Salt, profile.Iterations)
+	got, err := ComputeDerivedKeysContext(context.Background(), masterPass, profile.Salt, profile.Iterations)
+	if err != nil || !bytes.Equal(got.EncKey, want.EncKey) || !bytes.Equal(got.MACKey, want.MACKey) {
+		t.Fatalf("Expected the same keys as ComputeDerivedKeys. Got %v.", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = ComputeDerivedKeysContext(ctx, masterPass, profile.Salt, 1<<30); err != context.Canceled {
+		t.Errorf("Expected context.Canceled. Got %v.", err)
+	}
+}
+
+func TestEncryptOPData01RoundTrip(t *testing.T) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	for _, n := range []int{0, 1, 15, 16, 17, 100} {
+		plaintext := make([]byte, n)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+
+		opdata, err := EncryptOPData01(plaintext, kp)
+		if err != nil {
+			t.Fatalf("Failed encrypting %d bytes: %s", n, err)
+		}
+		decrypted, err := DecryptOPData01(opdata, kp)
+		if err != nil {
+			t.Fatalf("Failed decrypting %d bytes: %s", n, err)
+		} else if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("Round trip of %d bytes produced %x", n, decrypted)
+		}
+	}
+}
+
+// benchmarkOPData returns an item key and the OPData01 blob of a typical
+// item's details, encrypted with it.
+func benchmarkOPData(b *testing.B) (*KeyPair, []byte) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	opdata, err := EncryptOPData01(bytes.Repeat([]byte(decryptedItemDetails), 4), kp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return kp, opdata
+}
+
+func TestKeyPairZero(t *testing.T) {
+	kp := &KeyPair{EncKey: bytes.Repeat([]byte{1}, EncKeySize), MACKey: bytes.Repeat([]byte{2}, MACKeySize)}
+	opdata, err := EncryptOPData01([]byte("secret"), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := kp.cipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := kp.cipher(); again != b {
+		t.Errorf("Expected the key schedule to be reused")
+	}
+
+	kp.Zero()
+	if !bytes.Equal(kp.EncKey, make([]byte, EncKeySize)) || !bytes.Equal(kp.MACKey, make([]byte, MACKeySize)) {
+		t.Errorf("Expected the keys zeroed. Got %x, %x.", kp.EncKey, kp.MACKey)
+	}
+	if again, _ := kp.cipher(); again == b {
+		t.Errorf("Expected the key schedule dropped")
+	}
+	if _, err = DecryptOPData01(opdata, kp); err != ErrIncorrectMAC {
+		t.Errorf("Expected zeroed keys not to decrypt. Got %v.", err)
+	}
+}
+
+// BenchmarkComputeDerivedKeys derives keys as unlocking a profile made
+// by 1Password does, with 100,000 iterations.
+func BenchmarkComputeDerivedKeys(b *testing.B) {
+	salt := make([]byte, 16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ComputeDerivedKeys(masterPass, salt, 100000)
+	}
+}
+
+func BenchmarkDecryptOPData01(b *testing.B) {
+	kp, opdata := benchmarkOPData(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(opdata)))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecryptOPData01(opdata, kp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecryptItemKey(b *testing.B) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	itemKey, err := EncryptItemKey(&KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}, kp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecryptItemKey(itemKey, kp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecryptOPData01Into(t *testing.T) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	plaintext := []byte(decryptedItemDetails)
+	opdata, err := EncryptOPData01(plaintext, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ciphertext is all but the header, IV, and MAC
+	ctLen := len(opdata) - 16 - 16 - 32
+
+	// A buffer with room is used
+	buf := make([]byte, 0, len(opdata))
+	decrypted, err := DecryptOPData01Into(buf, opdata, kp)
+	if err != nil {
+		t.Fatalf("Failed decrypting: %s", err)
+	} else if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("Decrypted %q", decrypted)
+	} else if &buf[:ctLen][ctLen-1] != &decrypted[len(decrypted)-1] {
+		t.Errorf("Expected the plaintext in the supplied buffer")
+	}
+	// One without is replaced
+	if decrypted, err = DecryptOPData01Into(make([]byte, 4), opdata, kp); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected the plaintext in a new buffer. Got %q, %v.", decrypted, err)
+	}
+
+	copied := append([]byte{}, opdata...)
+	if decrypted, err = DecryptOPData01InPlace(copied, kp); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("Failed decrypting in place: %q, %v", decrypted, err)
+	} else if &copied[len(copied)-32-1] != &decrypted[len(decrypted)-1] {
+		t.Errorf("Expected the plaintext in the blob")
+	}
+	if _, err = DecryptOPData01InPlace(copied, kp); err != ErrIncorrectMAC {
+		t.Errorf("Expected decrypting in place twice to fail. Got %v.", err)
+	}
+}
+
+func BenchmarkDecryptOPData01Into(b *testing.B) {
+	kp, opdata := benchmarkOPData(b)
+	buf := make([]byte, len(opdata))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(opdata)))
+	for i := 0; i < b.N; i++ {
+		if _, err := DecryptOPData01Into(buf, opdata, kp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecryptOPData01Stream(t *testing.T) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	for _, n := range []int{0, 15, 16, StreamChunkSize - 40, 3*StreamChunkSize + 100} {
+		plaintext := make([]byte, n)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		opdata, err := EncryptOPData01(plaintext, kp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		var last, total int64
+		written, err := DecryptOPData01Stream(context.Background(), &out, bytes.NewReader(opdata), int64(len(opdata)), kp, func(w, t int64) {
+			last, total = w, t
+		})
+		if err != nil {
+			t.Fatalf("Failed decrypting %d bytes: %s", n, err)
+		} else if !bytes.Equal(out.Bytes(), plaintext) || written != int64(n) {
+			t.Fatalf("Streaming %d bytes wrote %d", n, written)
+		}
+		if last != int64(n) || total != int64(n) {
+			t.Errorf("Expected progress to reach %d. Got %d of %d.", n, last, total)
+		}
+	}
+
+	opdata, err := EncryptOPData01(make([]byte, 2*StreamChunkSize), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opdata[len(opdata)/2] ^= 1
+	var out bytes.Buffer
+	if _, err = DecryptOPData01Stream(context.Background(), &out, bytes.NewReader(opdata), int64(len(opdata)), kp, nil); err != ErrIncorrectMAC || out.Len() != 0 {
+		t.Errorf("Expected nothing written for a tampered blob. Got %d bytes, %v.", out.Len(), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = DecryptOPData01Stream(ctx, &out, bytes.NewReader(opdata), int64(len(opdata)), kp, nil); err != context.Canceled {
+		t.Errorf("Expected context.Canceled. Got %v.", err)
+	}
+}
+
+// sealOPData01 makes an OPData01 blob of padded, declaring a plaintext of
+// ptLen bytes, as other programs might.
+func sealOPData01(t *testing.T, padded []byte, ptLen uint64, kp *KeyPair) []byte {
+	b, err := kp.cipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append(append([]byte{}, OPData01Magic...), make([]byte, 8+aes.BlockSize)...)
+	binary.LittleEndian.PutUint64(blob[len(OPData01Magic):], ptLen)
+	ct := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(b, blob[len(blob)-aes.BlockSize:]).CryptBlocks(ct, padded)
+	return mac(append(blob, ct...), kp)
+}
+
+func TestOPData01Padding(t *testing.T) {
+	kp := &KeyPair{EncKey: make([]byte, EncKeySize), MACKey: make([]byte, MACKeySize)}
+	strict := &KeyPair{EncKey: kp.EncKey, MACKey: kp.MACKey, Strict: true}
+	block := []byte("0123456789abcdef0123456789abcdef")
+
+	// A whole number of blocks without padding keeps every byte
+	unpadded := sealOPData01(t, block, 32, kp)
+	if pt, err := DecryptOPData01(unpadded, kp); err != nil || !bytes.Equal(pt, block) {
+		t.Errorf("Expected the whole plaintext. Got %q, %v.", pt, err)
+	}
+	var buf bytes.Buffer
+	if _, err := DecryptOPData01Stream(context.Background(), &buf, bytes.NewReader(unpadded), int64(len(unpadded)), kp, nil); err != nil || !bytes.Equal(buf.Bytes(), block) {
+		t.Errorf("Expected the whole plaintext streamed. Got %q, %v.", buf.Bytes(), err)
+	}
+	if _, err := DecryptOPData01(unpadded, strict); !errors.Is(err, ErrMalformedOPData) {
+		t.Errorf("Expected strict keys to reject missing padding. Got %v.", err)
+	}
+
+	// As 1Password pads them, with a block of its own
+	padded, err := EncryptOPData01(block, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := DecryptOPData01(padded, strict); err != nil || !bytes.Equal(pt, block) {
+		t.Errorf("Expected the plaintext. Got %q, %v.", pt, err)
+	}
+
+	for _, c := range []struct {
+		ptLen  uint64
+		strict bool
+	}{
+		{33, false}, // Longer than the ciphertext
+		{1 << 63, false},
+		{0, true}, // 32 bytes of padding
+	} {
+		opdata := sealOPData01(t, block, c.ptLen, kp)
+		k := kp
+		if c.strict {
+			k = strict
+		}
+		if _, err := DecryptOPData01(opdata, k); !errors.Is(err, ErrMalformedOPData) {
+			t.Errorf("Declaring %d bytes: expected ErrMalformedOPData. Got %v.", c.ptLen, err)
+		}
+		if _, err := DecryptOPData01Stream(context.Background(), ioutil.Discard, bytes.NewReader(opdata), int64(len(opdata)), k, nil); !errors.Is(err, ErrMalformedOPData) {
+			t.Errorf("Declaring %d bytes: expected ErrMalformedOPData streaming. Got %v.", c.ptLen, err)
+		}
+	}
+
+	// Keys decrypted with strict keys are strict
+	itemKey, err := EncryptItemKey(kp, strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ikp, err := DecryptItemKey(itemKey, strict); err != nil || !ikp.Strict {
+		t.Errorf("Expected strict item keys. Got %v.", err)
+	}
+}
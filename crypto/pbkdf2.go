@@ -0,0 +1,57 @@
+//go:build !js
+
+package crypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+)
+
+// ctxCheckRounds is how many PBKDF2 rounds are computed between checks of
+// whether the context is done, a fraction of a millisecond's work.
+const ctxCheckRounds = 1024
+
+// deriveKey computes PBKDF2-HMAC-SHA512.
+func deriveKey(pass, salt []byte, iter, keyLen int) []byte {
+	key, _ := deriveKeyContext(context.Background(), pass, salt, iter, keyLen)
+	return key
+}
+
+// deriveKeyContext is deriveKey, returning ctx's error if it's done before
+// the key is derived. It's PBKDF2 as in golang.org/x/crypto/pbkdf2, with
+// the context checked between rounds.
+func deriveKeyContext(ctx context.Context, pass, salt []byte, iter, keyLen int) ([]byte, error) {
+	prf := hmac.New(sha512.New, pass)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			if n%ctxCheckRounds == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen], nil
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"context"
+	"crypto/sha512"
+	"syscall/js"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// deriveKey computes PBKDF2-HMAC-SHA512 with the browser's SubtleCrypto,
+// which is far faster than Go compiled to WebAssembly, falling back to Go
+// where it's unavailable, as in Node without webcrypto or on pages that
+// aren't secure contexts. SubtleCrypto answers with a promise, so this
+// blocks until it settles and mustn't be called from a js.FuncOf callback
+// without starting a goroutine.
+func deriveKey(pass, salt []byte, iter, keyLen int) []byte {
+	if key, ok := subtleDeriveKey(pass, salt, iter, keyLen); ok {
+		return key
+	}
+	return pbkdf2.Key(pass, salt, iter, keyLen, sha512.New)
+}
+
+// deriveKeyContext is deriveKey, returning ctx's error if it's done first.
+// SubtleCrypto can't be stopped once started, so it's only abandoned.
+func deriveKeyContext(ctx context.Context, pass, salt []byte, iter, keyLen int) ([]byte, error) {
+	done := make(chan []byte, 1)
+	go func() { done <- deriveKey(pass, salt, iter, keyLen) }()
+	select {
+	case key := <-done:
+		return key, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func subtleDeriveKey(pass, salt []byte, iter, keyLen int) ([]byte, bool) {
+	c := js.Global().Get("crypto")
+	if c.IsUndefined() || c.Get("subtle").IsUndefined() {
+		return nil, false
+	}
+	subtle := c.Get("subtle")
+
+	raw := js.Global().Get("Uint8Array").New(len(pass))
+	js.CopyBytesToJS(raw, pass)
+	jsSalt := js.Global().Get("Uint8Array").New(len(salt))
+	js.CopyBytesToJS(jsSalt, salt)
+
+	base, ok := await(subtle.Call("importKey", "raw", raw, "PBKDF2", false, []interface{}{"deriveBits"}))
+	if !ok {
+		return nil, false
+	}
+	params := map[string]interface{}{"name": "PBKDF2", "hash": "SHA-512", "salt": jsSalt, "iterations": iter}
+	bits, ok := await(subtle.Call("deriveBits", params, base, keyLen*8))
+	if !ok {
+		return nil, false
+	}
+	key := make([]byte, keyLen)
+	js.CopyBytesToGo(key, js.Global().Get("Uint8Array").New(bits))
+	return key, true
+}
+
+// await blocks until p settles, returning its value and whether it was
+// fulfilled.
+func await(p js.Value) (js.Value, bool) {
+	type result struct {
+		v  js.Value
+		ok bool
+	}
+	done := make(chan result, 1)
+	then := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- result{args[0], true}
+		return nil
+	})
+	defer then.Release()
+	catch := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- result{js.Undefined(), false}
+		return nil
+	})
+	defer catch.Release()
+	p.Call("then", then, catch)
+	r := <-done
+	return r.v, r.ok
+}
@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// StreamChunkSize is how many bytes DecryptOPData01Stream reads and
+// decrypts at a time.
+const StreamChunkSize = 64 << 10
+
+// DecryptOPData01Stream decrypts the OPData01 blob of size bytes read
+// from r, writing the plaintext to w a chunk at a time, so that blobs of
+// gigabytes need no more memory than a chunk. It returns the number of
+// bytes written.
+//
+// The blob is authenticated in full before anything is written. It's
+// authenticated again as it's decrypted, in case it changed meanwhile, in
+// which case ErrIncorrectMAC is returned once the plaintext read is
+// written. progress, if not nil, is called after each chunk written with
+// the number of bytes written so far and the size of the plaintext. Work
+// stops with ctx's error once ctx is done.
+func DecryptOPData01Stream(ctx context.Context, w io.Writer, r io.ReaderAt, size int64, kp *KeyPair, progress func(written, total int64)) (int64, error) {
+	hdrLen := int64(len(OPData01Magic) + 8)
+	if size < sha256.Size {
+		return 0, ErrIncompleteMAC
+	}
+	dataLen := size - sha256.Size
+	buf := make([]byte, StreamChunkSize)
+	defer wipe(buf)
+
+	// macOf computes the MAC of the blob, passing each chunk read to fn
+	macOf := func(fn func(off int64, chunk []byte) error) ([]byte, error) {
+		mac := hmac.New(sha256.New, kp.MACKey)
+		for off := int64(0); off < dataLen; {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			n := int64(len(buf))
+			if dataLen-off < n {
+				n = dataLen - off
+			}
+			chunk := buf[:n]
+			if _, err := r.ReadAt(chunk, off); err != nil {
+				return nil, err
+			}
+			mac.Write(chunk)
+			if fn != nil {
+				if err := fn(off, chunk); err != nil {
+					return nil, err
+				}
+			}
+			off += n
+		}
+		return mac.Sum(nil), nil
+	}
+	expectedMAC := make([]byte, sha256.Size)
+	if _, err := r.ReadAt(expectedMAC, dataLen); err != nil {
+		return 0, err
+	}
+	sum, err := macOf(nil)
+	if err != nil {
+		return 0, err
+	}
+	if !hmac.Equal(sum, expectedMAC) {
+		return 0, ErrIncorrectMAC
+	}
+
+	// Read the header
+	hdr := make([]byte, hdrLen+aes.BlockSize)
+	if dataLen < int64(len(OPData01Magic)) {
+		return 0, ErrIncompleteMagic
+	} else if dataLen < hdrLen {
+		return 0, ErrIncompleteHeader
+	} else if dataLen < int64(len(hdr)) {
+		return 0, ErrIncompleteIV
+	}
+	if _, err = r.ReadAt(hdr, 0); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(hdr[:len(OPData01Magic)], OPData01Magic) {
+		return 0, ErrInvalidMagic
+	}
+	ptLen := binary.LittleEndian.Uint64(hdr[len(OPData01Magic):hdrLen])
+	ctLen := dataLen - int64(len(hdr))
+	skip, err := paddingLength(ctLen, ptLen, kp.Strict)
+	if err != nil {
+		return 0, err
+	}
+	total := ctLen - skip
+
+	b, err := kp.cipher()
+	if err != nil {
+		return 0, err
+	}
+	bm := cipher.NewCBCDecrypter(b, hdr[hdrLen:])
+	var written int64
+	// Chunks are whole blocks past the header, which precedes the
+	// ciphertext by a whole number of blocks too
+	decrypt := func(off int64, chunk []byte) error {
+		if off < int64(len(hdr)) {
+			chunk = chunk[int64(len(hdr))-off:]
+		}
+		bm.CryptBlocks(chunk, chunk)
+		if skip > 0 {
+			n := skip
+			if int64(len(chunk)) < n {
+				n = int64(len(chunk))
+			}
+			chunk, skip = chunk[n:], skip-n
+		}
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(written, total)
+		}
+		return nil
+	}
+	if sum, err = macOf(decrypt); err != nil {
+		return written, err
+	}
+	if !hmac.Equal(sum, expectedMAC) {
+		return written, ErrIncorrectMAC
+	}
+	return written, nil
+}
+
+// wipe overwrites plaintext with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
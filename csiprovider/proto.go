@@ -0,0 +1,289 @@
+package csiprovider
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of the v1alpha1 provider API, from the driver's
+// provider/v1alpha1/service.proto. They're encoded by hand, as the driver's
+// generated package can't be imported without the whole driver.
+
+type versionRequest struct {
+	Version string // 1
+}
+
+type versionResponse struct {
+	Version        string // 1
+	RuntimeName    string // 2
+	RuntimeVersion string // 3
+}
+
+type mountRequest struct {
+	Attributes           string           // 1, a JSON object of strings
+	Secrets              string           // 2, a JSON object of strings
+	TargetPath           string           // 3
+	Permission           string           // 4, a JSON number
+	CurrentObjectVersion []*objectVersion // 5
+}
+
+type mountResponse struct {
+	ObjectVersion []*objectVersion // 1
+	Error         *mountError      // 2
+	Files         []*file          // 3
+}
+
+type objectVersion struct {
+	Id      string // 1
+	Version string // 2
+}
+
+type mountError struct {
+	Code string // 1
+}
+
+type file struct {
+	Path     string // 1
+	Mode     int32  // 2
+	Contents []byte // 3
+}
+
+// A message is encoded in the protocol buffer wire format.
+type message interface {
+	marshal(b []byte) []byte
+	unmarshal(b []byte) error
+}
+
+// codec encodes the messages for gRPC, in place of the protobuf package's
+// codec, which requires generated types.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("csiprovider: cannot encode %T", v)
+	}
+	return m.marshal(nil), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("csiprovider: cannot decode %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.marshal(nil))
+}
+
+// eachField calls fn with each field in b. Strings and embedded messages
+// are passed as bytes, varints as their value; other fields are skipped.
+func eachField(b []byte, fn func(num protowire.Number, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = fn(num, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = fn(num, nil, v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *versionRequest) marshal(b []byte) []byte {
+	return appendString(b, 1, m.Version)
+}
+
+func (m *versionRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num == 1 {
+			m.Version = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *versionResponse) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Version)
+	b = appendString(b, 2, m.RuntimeName)
+	return appendString(b, 3, m.RuntimeVersion)
+}
+
+func (m *versionResponse) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			m.Version = string(v)
+		case 2:
+			m.RuntimeName = string(v)
+		case 3:
+			m.RuntimeVersion = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *mountRequest) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Attributes)
+	b = appendString(b, 2, m.Secrets)
+	b = appendString(b, 3, m.TargetPath)
+	b = appendString(b, 4, m.Permission)
+	for _, ov := range m.CurrentObjectVersion {
+		b = appendMessage(b, 5, ov)
+	}
+	return b
+}
+
+func (m *mountRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			m.Attributes = string(v)
+		case 2:
+			m.Secrets = string(v)
+		case 3:
+			m.TargetPath = string(v)
+		case 4:
+			m.Permission = string(v)
+		case 5:
+			ov := new(objectVersion)
+			if err := ov.unmarshal(v); err != nil {
+				return err
+			}
+			m.CurrentObjectVersion = append(m.CurrentObjectVersion, ov)
+		}
+		return nil
+	})
+}
+
+func (m *mountResponse) marshal(b []byte) []byte {
+	for _, ov := range m.ObjectVersion {
+		b = appendMessage(b, 1, ov)
+	}
+	if m.Error != nil {
+		b = appendMessage(b, 2, m.Error)
+	}
+	for _, f := range m.Files {
+		b = appendMessage(b, 3, f)
+	}
+	return b
+}
+
+func (m *mountResponse) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			ov := new(objectVersion)
+			if err := ov.unmarshal(v); err != nil {
+				return err
+			}
+			m.ObjectVersion = append(m.ObjectVersion, ov)
+		case 2:
+			m.Error = new(mountError)
+			return m.Error.unmarshal(v)
+		case 3:
+			f := new(file)
+			if err := f.unmarshal(v); err != nil {
+				return err
+			}
+			m.Files = append(m.Files, f)
+		}
+		return nil
+	})
+}
+
+func (m *objectVersion) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Id)
+	return appendString(b, 2, m.Version)
+}
+
+func (m *objectVersion) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			m.Id = string(v)
+		case 2:
+			m.Version = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *mountError) marshal(b []byte) []byte {
+	return appendString(b, 1, m.Code)
+}
+
+func (m *mountError) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num == 1 {
+			m.Code = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *file) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Path)
+	if m.Mode != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.Mode))
+	}
+	if len(m.Contents) > 0 {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Contents)
+	}
+	return b
+}
+
+func (m *file) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Path = string(v)
+		case 2:
+			m.Mode = int32(n)
+		case 3:
+			m.Contents = append([]byte(nil), v...)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,176 @@
+// Package csiprovider serves vault items to Kubernetes pods as a provider
+// for the Secrets Store CSI driver. The driver asks providers over gRPC on
+// a unix socket, conventionally
+// /etc/kubernetes/secrets-store-csi-providers/opvault.sock, for the files
+// to mount into a pod's volume. A SecretProviderClass names the files and
+// the secret references their contents come from in its "objects"
+// parameter, a YAML list:
+//
+//	apiVersion: secrets-store.csi.x-k8s.io/v1
+//	kind: SecretProviderClass
+//	metadata:
+//	  name: database
+//	spec:
+//	  provider: opvault
+//	  parameters:
+//	    objects: |
+//	      - path: db-password
+//	        ref: opvault:///Database/password
+//	      - path: api-token
+//	        ref: opvault://work/API/token
+//	        mode: 0400
+package csiprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
+)
+
+// ProviderName is the name SecretProviderClasses give the provider.
+const ProviderName = "opvault"
+
+// APIVersion is the version of the driver's provider API implemented.
+const APIVersion = "v1alpha1"
+
+// A Resolver returns the secret a secret reference points at, as
+// onepassword.Vault.Resolve does.
+type Resolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// A Provider answers the driver's requests, resolving references with
+// Resolver. Version, if set, is reported to the driver as the provider's
+// version.
+type Provider struct {
+	Resolver Resolver
+	Version  string
+}
+
+// An Object is a file requested by a SecretProviderClass.
+type Object struct {
+	Path string  `yaml:"path"`
+	Ref  string  `yaml:"ref"`
+	Mode *uint32 `yaml:"mode"` // Defaults to the volume's permission
+}
+
+// NewServer returns a gRPC server for the provider. The messages are
+// encoded by this package, so the server can't serve other services.
+func NewServer(p *Provider) *grpc.Server {
+	s := grpc.NewServer(grpc.ForceServerCodec(codec{}))
+	s.RegisterService(&serviceDesc, p)
+	return s
+}
+
+// csiDriverProvider is the service's interface, as RegisterService checks
+// the implementation against its HandlerType.
+type csiDriverProvider interface {
+	version(ctx context.Context, req *versionRequest) (*versionResponse, error)
+	mount(ctx context.Context, req *mountRequest) (*mountResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "v1alpha1.CSIDriverProvider",
+	HandlerType: (*csiDriverProvider)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Version", Handler: unaryHandler("Version", func() message { return new(versionRequest) },
+			func(p csiDriverProvider, ctx context.Context, req message) (interface{}, error) {
+				return p.version(ctx, req.(*versionRequest))
+			})},
+		{MethodName: "Mount", Handler: unaryHandler("Mount", func() message { return new(mountRequest) },
+			func(p csiDriverProvider, ctx context.Context, req message) (interface{}, error) {
+				return p.mount(ctx, req.(*mountRequest))
+			})},
+	},
+	Metadata: "provider/v1alpha1/service.proto",
+}
+
+// unaryHandler adapts a method of the provider to gRPC, as protoc-gen-go-grpc
+// would generate.
+func unaryHandler(method string, newReq func() message, call func(csiDriverProvider, context.Context, message) (interface{}, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		p := srv.(csiDriverProvider)
+		if interceptor == nil {
+			return call(p, ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/v1alpha1.CSIDriverProvider/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(p, ctx, req.(message))
+		})
+	}
+}
+
+func (p *Provider) version(ctx context.Context, req *versionRequest) (*versionResponse, error) {
+	return &versionResponse{Version: APIVersion, RuntimeName: ProviderName, RuntimeVersion: p.Version}, nil
+}
+
+func (p *Provider) mount(ctx context.Context, req *mountRequest) (*mountResponse, error) {
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(req.Attributes), &attrs); err != nil {
+		return nil, fmt.Errorf("invalid attributes: %s", err)
+	}
+	var perm uint32
+	if err := json.Unmarshal([]byte(req.Permission), &perm); err != nil {
+		return nil, fmt.Errorf("invalid permission: %s", err)
+	}
+	objects, err := ParseObjects(attrs["objects"])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(mountResponse)
+	for _, o := range objects {
+		value, err := p.Resolver.Resolve(o.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", o.Path, err)
+		}
+		mode := perm
+		if o.Mode != nil {
+			mode = *o.Mode
+		}
+		resp.Files = append(resp.Files, &file{Path: o.Path, Mode: int32(mode), Contents: []byte(value)})
+		// The driver compares versions to tell when a rotated secret has
+		// changed
+		sum := sha256.Sum256([]byte(value))
+		resp.ObjectVersion = append(resp.ObjectVersion, &objectVersion{Id: o.Path, Version: hex.EncodeToString(sum[:8])})
+	}
+	return resp, nil
+}
+
+// ParseObjects parses the "objects" parameter of a SecretProviderClass.
+// Paths must be relative and stay within the volume.
+func ParseObjects(param string) ([]Object, error) {
+	var objects []Object
+	if err := yaml.Unmarshal([]byte(param), &objects); err != nil {
+		return nil, fmt.Errorf("invalid objects parameter: %s", err)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no objects requested")
+	}
+	seen := make(map[string]bool)
+	for _, o := range objects {
+		clean := path.Clean(o.Path)
+		if o.Path == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("invalid object path %q", o.Path)
+		}
+		if o.Ref == "" {
+			return nil, fmt.Errorf("object %s has no ref", o.Path)
+		}
+		if seen[clean] {
+			return nil, fmt.Errorf("object path %s is given twice", o.Path)
+		}
+		seen[clean] = true
+	}
+	return objects, nil
+}
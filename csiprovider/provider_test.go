@@ -0,0 +1,97 @@
+package csiprovider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type fakeResolver map[string]string
+
+func (r fakeResolver) Resolve(ref string) (string, error) {
+	if v, ok := r[ref]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("no item for %s", ref)
+}
+
+func TestMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csiprovider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "opvault.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&Provider{Resolver: fakeResolver{
+		"opvault:///Database/password": "hunter2",
+		"opvault:///API/token":         "t0ken",
+	}, Version: "test"})
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("unix://"+sock,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	var version versionResponse
+	if err := conn.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Version", &versionRequest{Version: "v1alpha1"}, &version); err != nil {
+		t.Fatalf("Version failed: %s", err)
+	}
+	if version.RuntimeName != ProviderName || version.RuntimeVersion != "test" {
+		t.Fatalf("Unexpected version: %+v", version)
+	}
+
+	req := &mountRequest{
+		Attributes: `{"objects": "- path: db/password\n  ref: opvault:///Database/password\n- path: token\n  ref: opvault:///API/token\n  mode: 0400\n", "csi.storage.k8s.io/pod.name": "web"}`,
+		Permission: "420",
+		TargetPath: dir,
+	}
+	var resp mountResponse
+	if err := conn.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Mount", req, &resp); err != nil {
+		t.Fatalf("Mount failed: %s", err)
+	}
+	if len(resp.Files) != 2 || len(resp.ObjectVersion) != 2 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	for i, want := range []file{{"db/password", 0644, []byte("hunter2")}, {"token", 0400, []byte("t0ken")}} {
+		f := resp.Files[i]
+		if f.Path != want.Path || f.Mode != want.Mode || string(f.Contents) != string(want.Contents) {
+			t.Errorf("Expected %+v. Got %+v.", want, *f)
+		}
+	}
+
+	req.Attributes = `{"objects": "- path: missing\n  ref: opvault:///Missing/password\n"}`
+	if err := conn.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Mount", req, &resp); err == nil {
+		t.Fatalf("Expected an error for a missing item")
+	}
+}
+
+func TestParseObjectsRejectsEscapingPaths(t *testing.T) {
+	for _, param := range []string{
+		"",
+		"- path: ../etc/passwd\n  ref: opvault:///x/y\n",
+		"- path: /etc/passwd\n  ref: opvault:///x/y\n",
+		"- path: a\n",
+		"- path: a\n  ref: opvault:///x/y\n- path: ./a\n  ref: opvault:///x/z\n",
+	} {
+		if _, err := ParseObjects(param); err == nil {
+			t.Errorf("Expected an error parsing %q", param)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// newDetails returns a pointer to the zero value of the detail model used by
+// items in the supplied category.
+func newDetails(cat Category) interface{} {
+	switch cat.Uuid {
+	case CatLogin.Uuid:
+		return &Login{}
+	case CatPassword.Uuid:
+		return &Password{}
+	case CatDocument.Uuid:
+		return &Document{}
+	default:
+		return &Note{}
+	}
+}
+
+// DecodeDetails unmarshals the decrypted item details into v and returns it.
+// If v is nil, the details are decoded into the model matching the item's
+// category: *Login, *Password, or *Document for those categories and *Note for
+// everything else.
+func (i *Item) DecodeDetails(v interface{}) (interface{}, error) {
+	if v == nil {
+		v = newDetails(i.Category)
+	}
+
+	err := json.Unmarshal(i.Details, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// credentialDetails holds the parts of item details that may contain a
+// username or password, whatever the item's category.
+type credentialDetails struct {
+	Description     string                 `json:"notesPlain"`
+	Fields          []LoginField           `json:"fields"`
+	Sections        []Section              `json:"sections"`
+	Password        string                 `json:"password"`
+	PasswordHistory []PasswordHistoryEntry `json:"passwordHistory"`
+}
+
+func (i *Item) credentials() credentialDetails {
+	var d credentialDetails
+	json.Unmarshal(i.Details, &d)
+	return d
+}
+
+// sectionValue returns the value of the first section field with the
+// supplied identifier.
+func (d *credentialDetails) sectionValue(id string) string {
+	for _, s := range d.Sections {
+		for _, f := range s.Fields {
+			if f.Id == id && f.Value != "" {
+				return f.Value
+			}
+		}
+	}
+	return ""
+}
+
+// Username returns the username stored in the item: the login form field
+// designated as the username or, for other categories, a section field
+// named "username". It returns "" if there is none.
+func (i *Item) Username() string {
+	d := i.credentials()
+	for _, f := range d.Fields {
+		if f.Designation == "username" {
+			return f.Value
+		}
+	}
+	return d.sectionValue("username")
+}
+
+// Password returns the password stored in the item: the login form field
+// designated as the password, the password of a Password item, or a section
+// field named "password". It returns "" if there is none.
+func (i *Item) Password() string {
+	d := i.credentials()
+	for _, f := range d.Fields {
+		if f.Designation == "password" {
+			return f.Value
+		}
+	}
+	if d.Password != "" {
+		return d.Password
+	}
+	return d.sectionValue("password")
+}
+
+// PasswordHistory returns the passwords the item used to have, as recorded
+// by the official apps, oldest first.
+func (i *Item) PasswordHistory() []PasswordHistoryEntry {
+	h := i.credentials().PasswordHistory
+	sort.Slice(h, func(a, b int) bool { return h[a].Time < h[b].Time })
+	return h
+}
+
+// PasswordChanged returns when the item's current password was set: the
+// time the most recent password was moved to the history or, for items
+// without history, when the item was last updated.
+func (i *Item) PasswordChanged() time.Time {
+	if h := i.PasswordHistory(); len(h) > 0 {
+		return time.Unix(h[len(h)-1].Time, 0)
+	}
+	return i.Updated
+}
@@ -0,0 +1,235 @@
+package onepassword
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword/generate"
+)
+
+const (
+	ssnDetails   = `{"sections":[{"name":"","title":"","fields":[{"k":"string","n":"name","v":"Wendy Appleseed","t":"name"},{"k":"concealed","v":"555-55-1234","n":"number","a":{"generate":"off"},"t":"number"}]}]}`
+	loginDetails = `{"fields":[{"type":"T","name":"username","value":"wendy","designation":"username"},{"type":"P","name":"password","value":"hunter2","designation":"password"}],"notesPlain":"note"}`
+)
+
+func TestDecodeDetailsByCategory(t *testing.T) {
+	item := Item{Category: CatSSN, Details: []byte(ssnDetails)}
+	v, err := item.DecodeDetails(nil)
+	if err != nil {
+		t.Fatalf("Failed decoding details: %s", err)
+	}
+	note, ok := v.(*Note)
+	if !ok {
+		t.Fatalf("Expected *Note. Got %T.", v)
+	} else if note.Sections[0].Fields[1].Value != "555-55-1234" {
+		t.Fatalf("Unexpected fields decoded: %+v", note.Sections[0].Fields)
+	}
+
+	item = Item{Category: CatLogin, Details: []byte(loginDetails)}
+	v, err = item.DecodeDetails(nil)
+	if err != nil {
+		t.Fatalf("Failed decoding details: %s", err)
+	}
+	login, ok := v.(*Login)
+	if !ok {
+		t.Fatalf("Expected *Login. Got %T.", v)
+	} else if len(login.Fields) != 2 || login.Description != "note" {
+		t.Fatalf("Unexpected login decoded: %+v", login)
+	}
+}
+
+func TestDecodeDetailsIntoCallerStruct(t *testing.T) {
+	var out struct {
+		Notes string `json:"notesPlain"`
+	}
+	item := Item{Category: CatLogin, Details: []byte(loginDetails)}
+	if _, err := item.DecodeDetails(&out); err != nil {
+		t.Fatalf("Failed decoding details: %s", err)
+	} else if out.Notes != "note" {
+		t.Fatalf("Expected notes to be decoded. Got %q.", out.Notes)
+	}
+}
+
+func TestDecodeNonStringFieldValues(t *testing.T) {
+	details := `{"sections":[{"fields":[{"k":"date","n":"expiry_date","v":1893456000,"t":"expiry date"},{"k":"address","n":"address","v":{"city":"Toronto"},"t":"address"}]}]}`
+	item := Item{Category: CatPassport, Details: []byte(details)}
+	v, err := item.DecodeDetails(nil)
+	if err != nil {
+		t.Fatalf("Failed decoding details: %s", err)
+	}
+	fields := v.(*Note).Sections[0].Fields
+	if fields[0].Value != "1893456000" || fields[1].Value != `{"city":"Toronto"}` {
+		t.Fatalf("Unexpected values decoded: %+v", fields)
+	}
+}
+
+func TestNewItemFromTemplate(t *testing.T) {
+	item := NewItemFromTemplate(CatPassport)
+	v, err := item.DecodeDetails(nil)
+	if err != nil {
+		t.Fatalf("Failed decoding template: %s", err)
+	}
+	fields := v.(*Note).Sections[0].Fields
+	last := fields[len(fields)-1]
+	if last.Id != "expiry_date" || last.Kind != KindDate || last.Value != "" {
+		t.Fatalf("Unexpected passport field: %+v", last)
+	}
+
+	item = NewItemFromTemplate(CatLogin)
+	v, err = item.DecodeDetails(nil)
+	if err != nil {
+		t.Fatalf("Failed decoding template: %s", err)
+	} else if len(v.(*Login).Fields) != 2 {
+		t.Fatalf("Expected username and password fields: %+v", v)
+	}
+}
+
+func TestItemExpiry(t *testing.T) {
+	card := Item{Category: CatCreditCard, Details: []byte(`{"sections":[{"fields":[{"k":"monthYear","n":"expiry","t":"expiry date","v":202312}]}]}`)}
+	exp, ok := card.Expiry()
+	if !ok || !exp.Equal(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("Unexpected card expiry: %v %v", exp, ok)
+	}
+
+	passport := Item{Category: CatPassport, Details: []byte(`{"sections":[{"fields":[{"k":"date","n":"birthdate","v":0},{"k":"date","n":"expiry_date","v":1893456000}]}]}`)}
+	exp, ok = passport.Expiry()
+	if !ok || exp.Unix() != 1893456000 {
+		t.Fatalf("Unexpected passport expiry: %v %v", exp, ok)
+	}
+
+	if _, ok := NewItemFromTemplate(CatPassport).Expiry(); ok {
+		t.Fatalf("Expected empty passport to have no expiry")
+	}
+}
+
+func TestItemField(t *testing.T) {
+	details := `{"sections":[{"name":"s1","title":"Server","fields":[{"k":"string","n":"url","v":"db.example.com","t":"hostname"},{"k":"concealed","n":"password","v":"s3cret","t":"password"}]},{"title":"Admin","fields":[{"k":"string","n":"user","v":"root","t":"hostname"}]}]}`
+	item := Item{Category: CatServer, Details: []byte(details)}
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"password", "s3cret"},
+		{"HOSTNAME", "db.example.com"},
+		{"url", "db.example.com"},
+		{"admin.hostname", "root"},
+		{"user", "root"},
+	} {
+		if got, ok := item.Field(tc.name); !ok || got != tc.want {
+			t.Errorf("Field(%q) = %q, %v. Expected %q.", tc.name, got, ok, tc.want)
+		}
+	}
+	if _, ok := item.Field("missing"); ok {
+		t.Errorf("Expected no value for a missing field.")
+	}
+
+	login := Item{Category: CatLogin, Details: []byte(loginDetails)}
+	fields := login.Fields()
+	if len(fields) != 2 || fields[0].Id != "username" || !fields[1].Concealed {
+		t.Fatalf("Unexpected login fields: %+v", fields)
+	}
+	if got, _ := login.Field("notes"); got != "note" {
+		t.Fatalf("Expected notes. Got %q.", got)
+	}
+}
+
+func TestSetPasswordRecordsHistory(t *testing.T) {
+	item := Item{Category: CatLogin, Details: []byte(loginDetails)}
+	at := time.Unix(1600000000, 0)
+	if err := item.SetPassword("correct horse", at); err != nil {
+		t.Fatalf("Failed setting password: %s", err)
+	}
+	if item.Password() != "correct horse" || item.Username() != "wendy" {
+		t.Fatalf("Unexpected credentials %q/%q", item.Username(), item.Password())
+	}
+	h := item.PasswordHistory()
+	if len(h) != 1 || h[0].Value != "hunter2" || h[0].Time != at.Unix() {
+		t.Fatalf("Unexpected history: %+v", h)
+	}
+	if item.Notes() != "note" {
+		t.Fatalf("Expected notes to be preserved.")
+	}
+
+	note := Item{Category: CatSecureNote, Details: []byte(`{}`)}
+	if err := note.SetPassword("x", at); err == nil {
+		t.Fatalf("Expected an error setting the password of a note.")
+	}
+}
+
+func TestNewLogin(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	item, err := NewLogin("GitHub", "wendy", generate.DefaultChars, at)
+	if err != nil {
+		t.Fatalf("Failed creating login: %s", err)
+	}
+	if item.Title != "GitHub" || item.Username() != "wendy" || len(item.Password()) != generate.DefaultChars.Length {
+		t.Fatalf("Unexpected login: %+v", item)
+	}
+	// The generated password enters the history once it's replaced
+	generated := item.Password()
+	if h := item.PasswordHistory(); len(h) != 0 {
+		t.Fatalf("Expected no history yet. Got %+v.", h)
+	}
+	if err = item.SetPassword("correct horse", at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if h := item.PasswordHistory(); len(h) != 1 || h[0].Value != generated {
+		t.Fatalf("Expected the generated password in the history. Got %+v.", h)
+	}
+}
+
+func TestSetFields(t *testing.T) {
+	details := `{"sections":[{"name":"s1","title":"Server","fields":[{"k":"string","n":"url","v":"db.example.com","t":"hostname","a":{"multiline":"no"}},{"k":"concealed","n":"password","v":"s3cret","t":"password"}]}],"notesPlain":"old"}`
+	item := Item{Category: CatServer, Details: []byte(details)}
+	fields := item.Fields()
+	fields[0].Value = "db2.example.com"
+	fields = append(fields[:1], FieldValue{Section: "Admin", Id: "user", Name: "username", Kind: KindString, Value: "root"})
+	if err := item.SetFields(fields, time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("Failed setting fields: %s", err)
+	}
+	if err := item.SetNotes("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := item.Fields()
+	if len(got) != 2 || got[0].Value != "db2.example.com" || got[1].Section != "Admin" || item.Notes() != "new" {
+		t.Fatalf("Unexpected fields: %+v", got)
+	}
+	if v, err := item.GetString("sections[0].fields[0].a.multiline"); err != nil || v != "no" {
+		t.Fatalf("Expected field attributes to be kept. Got %v, %v.", v, err)
+	}
+
+	login := Item{Category: CatLogin, Details: []byte(loginDetails)}
+	fields = login.Fields()
+	fields[1].Value = "hunter3"
+	if err := login.SetFields(fields, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if login.Password() != "hunter3" || len(login.PasswordHistory()) != 1 {
+		t.Fatalf("Expected the old password in the history: %s", login.Details)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	card := NewItemFromTemplate(CatCreditCard)
+	card.Title = "Visa"
+	if err := card.Validate(); err != nil {
+		t.Fatalf("Expected a new card to be valid. Got %s.", err)
+	}
+
+	fields := card.fields(true)
+	for i := range fields {
+		switch fields[i].Id {
+		case "expiry":
+			fields[i].Value = "2024-01"
+		case "ccnum":
+			fields[i].Kind = KindDate
+		}
+	}
+	card.SetFields(fields, time.Now())
+	card.Title = ""
+	err := card.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 3 {
+		t.Fatalf("Expected 3 problems. Got %v.", err)
+	}
+}
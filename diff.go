@@ -0,0 +1,154 @@
+package onepassword
+
+import (
+	"sort"
+	"strings"
+)
+
+// A VaultDiff describes how one vault differs from another.
+type VaultDiff struct {
+	Added    []Item     `json:"added"`    // Only in the second vault
+	Removed  []Item     `json:"removed"`  // Only in the first vault
+	Modified []ItemDiff `json:"modified"` // Changed between the vaults
+}
+
+// Empty reports whether the vaults hold the same items.
+func (d *VaultDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// An ItemDiff lists the changes to an item present in both vaults.
+type ItemDiff struct {
+	Uuid    string        `json:"uuid"`
+	Title   string        `json:"title"` // As of the second vault
+	Changes []FieldChange `json:"changes"`
+}
+
+// A FieldChange is a value that differs between two versions of an item.
+// Old is empty for added fields and New is empty for removed ones.
+type FieldChange struct {
+	Field     string `json:"field"` // "title", "url", "tags", "notes", or "section.label" for detail fields
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	Concealed bool   `json:"concealed,omitempty"`
+}
+
+// Diff compares the items in two vaults, for example a vault and its
+// backup or two synced copies. Items are matched by uuid. Items whose sync
+// transaction and modification time agree are assumed to be unchanged;
+// the rest are decrypted and compared field by field, and are reported as
+// modified only if their contents differ. Items in the trash are ignored.
+//
+// Each list is ordered by uuid. Values are reported in the clear, so
+// callers displaying a diff should mask concealed ones.
+func Diff(v1, v2 *Vault) (*VaultDiff, error) {
+	recs1, err := v1.store.records()
+	if err != nil {
+		return nil, err
+	}
+	recs2, err := v2.store.records()
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]*record)
+	for _, r := range recs1 {
+		old[r.Uuid] = r
+	}
+
+	d := &VaultDiff{}
+	for _, r2 := range recs2 {
+		r1, ok := old[r2.Uuid]
+		delete(old, r2.Uuid)
+		if ok && r1.Tx == r2.Tx && r1.Updated == r2.Updated {
+			continue
+		}
+
+		item2, err := v2.decryptOverview(r2)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			d.Added = append(d.Added, *item2)
+			continue
+		}
+		item1, err := v1.decryptOverview(r1)
+		if err != nil {
+			return nil, err
+		}
+		if err = v1.decryptDetails(r1, item1); err != nil {
+			return nil, err
+		}
+		if err = v2.decryptDetails(r2, item2); err != nil {
+			return nil, err
+		}
+		if changes := diffItems(item1, item2); len(changes) > 0 {
+			d.Modified = append(d.Modified, ItemDiff{item2.Uuid, item2.Title, changes})
+		}
+	}
+	for _, r1 := range recs1 {
+		if _, ok := old[r1.Uuid]; !ok {
+			continue
+		}
+		item1, err := v1.decryptOverview(r1)
+		if err != nil {
+			return nil, err
+		}
+		d.Removed = append(d.Removed, *item1)
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Uuid < d.Added[j].Uuid })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Uuid < d.Removed[j].Uuid })
+	sort.Slice(d.Modified, func(i, j int) bool { return d.Modified[i].Uuid < d.Modified[j].Uuid })
+	return d, nil
+}
+
+// diffItems returns the changes between two versions of an item, overview
+// fields first, then detail fields in the order of the newer version.
+func diffItems(a, b *Item) []FieldChange {
+	var changes []FieldChange
+	add := func(field, old, new string, concealed bool) {
+		if old != new {
+			changes = append(changes, FieldChange{field, old, new, concealed})
+		}
+	}
+
+	add("title", a.Title, b.Title, false)
+	add("url", a.Url, b.Url, false)
+	add("tags", strings.Join(a.Tags, ", "), strings.Join(b.Tags, ", "), false)
+
+	// Match detail fields by section and identifier, as labels may change
+	key := func(f *FieldValue) string { return f.Section + "\x00" + f.Id }
+	name := func(f *FieldValue) string {
+		label := f.Name
+		if label == "" {
+			label = f.Id
+		}
+		if f.Section == "" {
+			return label
+		}
+		return f.Section + "." + label
+	}
+	oldFields := make(map[string]*FieldValue)
+	af := a.Fields()
+	for i := range af {
+		oldFields[key(&af[i])] = &af[i]
+	}
+	bf := b.Fields()
+	for i := range bf {
+		f := &bf[i]
+		if o, ok := oldFields[key(f)]; ok {
+			add(name(f), o.Value, f.Value, o.Concealed || f.Concealed)
+			delete(oldFields, key(f))
+		} else {
+			add(name(f), "", f.Value, f.Concealed)
+		}
+	}
+	for i := range af {
+		if o, ok := oldFields[key(&af[i])]; ok {
+			add(name(o), o.Value, "", o.Concealed)
+		}
+	}
+
+	add("notes", a.Notes(), b.Notes(), false)
+	return changes
+}
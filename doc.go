@@ -1,6 +1,24 @@
 /*
 Package onepassword provides read-only access to items stored in the 1Password SQLite database.
 
+Vaults in the OPVault format, the directories 1Password syncs through
+Dropbox or a shared folder, can be read as well by passing the path of the
+.opvault directory as VaultConfig.DBPath.
+
+OPVault directories can also be read from any fs.FS with NewVaultFS, which
+does no other IO. Together with the crypto package, this builds with
+GOOS=js GOARCH=wasm for viewers running in a browser, where the master
+password is stretched with the browser's SubtleCrypto when it's available.
+SQLite databases can't be read there.
+
+Items can be created and changed with Vault.SaveItem. 1Password should not be
+running while a vault is written.
+
+Deriving keys, loading bands, decrypting items, and building the search
+index are marked as regions named "onepassword.*" in execution traces, as
+taken with runtime/trace or "go test -trace". NewVaultContext and the
+methods ending in Context stop them early once a context is done, as do the
+restapi, grpcapi, and jsonrpc servers when a request is canceled.
 
 
 Compatibility
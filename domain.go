@@ -0,0 +1,179 @@
+package onepassword
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scores awarded when matching a login's URL against a page.
+const (
+	scoreExactHost  = 100 // Hosts are identical
+	scoreSubdomain  = 50  // One host is a subdomain of the other
+	scoreSameDomain = 10  // Hosts share a registrable domain
+	scoreExactPath  = 20  // Paths are identical
+	scorePathPrefix = 10  // The page lies beneath the login's path
+	penaltyScheme   = 5   // The login is for https, the page uses http
+)
+
+// parseLoginURL parses a URL as typed by a user or saved in an item,
+// assuming https if no scheme is given.
+func parseLoginURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// registrableDomain returns the public suffix plus one label for host, e.g.
+// "example.co.uk" for "login.example.co.uk". IP addresses and single label
+// hosts like "localhost" are their own registrable domain.
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return d
+}
+
+// effectivePort returns the port of u, defaulting by scheme.
+func effectivePort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	switch u.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+func isSubdomain(host, parent string) bool {
+	return strings.HasSuffix(host, "."+parent)
+}
+
+// Domain returns the registrable domain of the item's primary URL, or "" if
+// the item has no URL.
+func (i *Item) Domain() string {
+	urls := i.allUrls()
+	if len(urls) == 0 {
+		return ""
+	}
+	u, err := parseLoginURL(urls[0])
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return registrableDomain(u.Hostname())
+}
+
+// urlMatchScore rates how well a URL saved in a login matches the page the
+// user is on, mirroring the browser extension: hosts must share a
+// registrable domain and explicitly given ports must agree. Closer hosts and longer
+// shared paths score higher. Zero means no match.
+func urlMatchScore(page *url.URL, saved string) int {
+	u, err := parseLoginURL(saved)
+	if err != nil || u.Hostname() == "" {
+		return 0
+	}
+
+	pageHost, host := page.Hostname(), u.Hostname()
+	if registrableDomain(pageHost) != registrableDomain(host) {
+		return 0
+	}
+	if (page.Port() != "" || u.Port() != "") && effectivePort(page) != effectivePort(u) {
+		return 0
+	}
+
+	var score int
+	switch {
+	case pageHost == host:
+		score = scoreExactHost
+	case isSubdomain(pageHost, host) || isSubdomain(host, pageHost):
+		// Penalize each label of separation
+		depth := strings.Count(pageHost, ".") - strings.Count(host, ".")
+		if depth < 0 {
+			depth = -depth
+		}
+		score = scoreSubdomain - depth
+	default:
+		score = scoreSameDomain
+	}
+
+	savedPath := strings.TrimSuffix(u.Path, "/")
+	pagePath := strings.TrimSuffix(page.Path, "/")
+	switch {
+	case savedPath == "":
+	case savedPath == pagePath:
+		score += scoreExactPath
+	case strings.HasPrefix(pagePath, savedPath+"/"):
+		score += scorePathPrefix
+	}
+
+	if u.Scheme == "https" && page.Scheme == "http" {
+		score -= penaltyScheme
+	}
+
+	return score
+}
+
+// RankLogins returns the logins among items that should be offered on the
+// page at rawurl, best match first. Items marked never to be displayed in
+// the browser are excluded. An item's score is that of its best matching
+// URL.
+func RankLogins(items []Item, rawurl string) ([]SearchResult, error) {
+	page, err := parseLoginURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, item := range items {
+		if item.Category.Uuid != CatLogin.Uuid || !item.DisplayInBrowser() {
+			continue
+		}
+		best := 0
+		for _, u := range item.allUrls() {
+			if s := urlMatchScore(page, u); s > best {
+				best = s
+			}
+		}
+		if best > 0 {
+			results = append(results, SearchResult{Item: item, Score: float64(best)})
+		}
+	}
+	sortResults(results)
+
+	return results, nil
+}
+
+// LoginsForURL returns the logins in the vault that should be offered on the
+// page at rawurl, best match first. Logins are matched on their overviews,
+// and only the details of those offered are decrypted.
+func (v *Vault) LoginsForURL(rawurl string) ([]SearchResult, error) {
+	items, err := v.Overviews()
+	if err != nil {
+		return nil, err
+	}
+	results, err := RankLogins(items, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if err = v.resultDetails(context.Background(), results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
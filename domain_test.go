@@ -0,0 +1,62 @@
+package onepassword
+
+import "testing"
+
+func TestRankLogins(t *testing.T) {
+	login := func(title, url string) Item {
+		return Item{Title: title, Url: url, Category: CatLogin}
+	}
+	hidden := login("Hidden", "https://example.co.uk")
+	hidden.Scope = ScopeNever
+	items := []Item{
+		login("Apex", "example.co.uk"),
+		login("Exact", "https://accounts.example.co.uk/login"),
+		login("Other", "https://other.co.uk"),
+		login("Sub", "https://deep.accounts.example.co.uk"),
+		login("Port", "https://accounts.example.co.uk:8443"),
+		hidden,
+		{Title: "Note", Url: "https://accounts.example.co.uk", Category: CatSecureNote},
+	}
+
+	results, err := RankLogins(items, "https://accounts.example.co.uk/login?next=/")
+	if err != nil {
+		t.Fatalf("Failed ranking logins: %s", err)
+	}
+	var titles []string
+	for _, r := range results {
+		titles = append(titles, r.Item.Title)
+	}
+	expected := []string{"Exact", "Apex", "Sub"}
+	if len(titles) != len(expected) {
+		t.Fatalf("Expected %v. Got %v.", expected, titles)
+	}
+	for i := range expected {
+		if titles[i] != expected[i] {
+			t.Fatalf("Expected %v. Got %v.", expected, titles)
+		}
+	}
+
+	results, _ = RankLogins(items, "https://accounts.example.co.uk:8443/")
+	if len(results) != 1 || results[0].Item.Title != "Port" {
+		t.Fatalf("Expected only the login with a matching port: %+v", results)
+	}
+}
+
+func TestLoginsForURL(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub","url":"https://github.com/login"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"Bank","url":"https://bank.example"}`, loginDetails, false)
+	// Only the details of the logins offered are decrypted
+	f.band["B2"].Details[40] ^= 1
+	f.writeBand("B")
+	v := f.open()
+	defer v.Close()
+
+	results, err := v.LoginsForURL("https://gist.github.com/")
+	if err != nil || len(results) != 1 || results[0].Item.Password() != "hunter2" {
+		t.Fatalf("Expected GitHub with its details. Got %+v, %v.", results, err)
+	}
+	if _, err = v.LoginsForURL("https://bank.example/"); err == nil {
+		t.Errorf("Expected the corrupt details of an offered login reported")
+	}
+}
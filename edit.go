@@ -0,0 +1,277 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginFieldTypes are the types of the web form fields saved with logins.
+var loginFieldTypes = map[string]string{
+	"T":   "text",
+	"P":   "password",
+	"E":   "email",
+	"N":   "number",
+	"A":   "text area",
+	"C":   "checkbox",
+	"R":   "radio button",
+	"S":   "submit button",
+	"B":   "button",
+	"I":   "image",
+	"U":   "URL",
+	"TEL": "telephone",
+}
+
+// sectionKinds are the kinds of section fields.
+var sectionKinds = map[string]bool{
+	KindString: true, KindConcealed: true, KindEmail: true, KindPhone: true,
+	KindURL: true, KindDate: true, KindMonthYear: true, KindMenu: true,
+	KindGender: true, KindCCType: true, KindAddress: true,
+}
+
+// isLoginField reports whether f is one of a Login's web form fields rather
+// than a section field.
+func (i *Item) isLoginField(f *FieldValue) bool {
+	return f.Section == "" && i.Category.Uuid == CatLogin.Uuid && loginFieldTypes[f.Kind] != ""
+}
+
+// SetFields replaces the fields of the item with the supplied ones, in the
+// form returned by Fields. Fields are matched to existing ones by section
+// and identifier so attributes this package doesn't model are kept; fields
+// that aren't supplied are removed. Fields with an empty Section are web
+// form fields for Logins and the password for Password items; for other
+// categories they belong to the untitled section. If the password changes,
+// the old one is added to the history as by SetPassword.
+func (i *Item) SetFields(fields []FieldValue, at time.Time) error {
+	d := make(map[string]json.RawMessage)
+	if len(i.Details) > 0 {
+		if err := json.Unmarshal(i.Details, &d); err != nil {
+			return err
+		}
+	}
+	old := i.Password()
+
+	var loginFields []map[string]interface{}
+	var existingLogin []map[string]interface{}
+	json.Unmarshal(d["fields"], &existingLogin)
+	var existingSections []map[string]interface{}
+	json.Unmarshal(d["sections"], &existingSections)
+
+	// Section fields are matched among all existing sections' fields, so
+	// a field moved between sections keeps its attributes
+	existingFields := make(map[string]map[string]interface{})
+	for _, s := range existingSections {
+		fs, _ := s["fields"].([]interface{})
+		for _, f := range fs {
+			if m, ok := f.(map[string]interface{}); ok {
+				if id, ok := m["n"].(string); ok {
+					existingFields[id] = m
+				}
+			}
+		}
+	}
+
+	var sections []map[string]interface{}
+	section := func(title string) map[string]interface{} {
+		for _, s := range sections {
+			if sectionTitle(s) == title {
+				return s
+			}
+		}
+		s := map[string]interface{}{"name": title, "title": title}
+		for _, e := range existingSections {
+			if sectionTitle(e) == title {
+				s = e
+				break
+			}
+		}
+		s["fields"] = []interface{}{}
+		sections = append(sections, s)
+		return s
+	}
+
+	delete(d, "password")
+	for idx := range fields {
+		f := &fields[idx]
+		switch {
+		case f.Section == "" && i.Category.Uuid == CatPassword.Uuid && f.Id == "password":
+			d["password"], _ = json.Marshal(f.Value)
+		case i.isLoginField(f):
+			m := map[string]interface{}{}
+			for _, e := range existingLogin {
+				if e["designation"] == f.Id || (e["designation"] == nil && e["name"] == f.Id) {
+					m = e
+					break
+				}
+			}
+			name := f.Name
+			if name == "" {
+				name = f.Id
+			}
+			m["name"], m["type"], m["value"] = name, f.Kind, f.Value
+			if f.Id == "username" || f.Id == "password" {
+				m["designation"] = f.Id
+			}
+			loginFields = append(loginFields, m)
+		default:
+			s := section(f.Section)
+			m := existingFields[f.Id]
+			if m == nil {
+				m = map[string]interface{}{}
+			}
+			raw, err := json.Marshal(Field{Value: f.Value, Name: f.Name, Kind: f.Kind, Id: f.Id})
+			if err != nil {
+				return err
+			}
+			var enc map[string]interface{}
+			json.Unmarshal(raw, &enc)
+			delete(m, "v")
+			for k, v := range enc {
+				m[k] = v
+			}
+			s["fields"] = append(s["fields"].([]interface{}), m)
+		}
+	}
+
+	if i.Category.Uuid == CatLogin.Uuid || loginFields != nil {
+		if loginFields == nil {
+			loginFields = []map[string]interface{}{}
+		}
+		d["fields"], _ = json.Marshal(loginFields)
+	}
+	if sections == nil {
+		sections = []map[string]interface{}{}
+	}
+	d["sections"], _ = json.Marshal(sections)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	i.Details = data
+	if i.Category.Uuid == CatLogin.Uuid || i.Category.Uuid == CatPassword.Uuid {
+		if err = addPasswordHistory(d, old, i.Password(), at); err != nil {
+			return err
+		}
+		if i.Details, err = json.Marshal(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sectionTitle returns the title of a section as reported by Fields.
+func sectionTitle(s map[string]interface{}) string {
+	if title, _ := s["title"].(string); title != "" {
+		return title
+	}
+	name, _ := s["name"].(string)
+	return name
+}
+
+// SetNotes replaces the item's notes.
+func (i *Item) SetNotes(notes string) error {
+	d := make(map[string]json.RawMessage)
+	if len(i.Details) > 0 {
+		if err := json.Unmarshal(i.Details, &d); err != nil {
+			return err
+		}
+	}
+	if notes == "" {
+		delete(d, "notesPlain")
+	} else {
+		d["notesPlain"], _ = json.Marshal(notes)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	i.Details = data
+	return nil
+}
+
+// A ValidationError lists the problems Validate found with an item.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid item: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that an item can be saved and will display properly in
+// the official apps: it needs a title and a known category, its details
+// must decode, each field must have a known kind, fields from the
+// category's template must keep their template's kind, and dates must be
+// numbers. It returns a *ValidationError listing any problems.
+func (i *Item) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(i.Title) == "" {
+		add("missing title")
+	}
+	if _, ok := CategoryByUUID(i.Category.Uuid); !ok {
+		add("unknown category %q", i.Category.Uuid)
+	}
+	var d map[string]json.RawMessage
+	if err := json.Unmarshal(i.Details, &d); err != nil {
+		add("details: %s", err)
+		return &ValidationError{problems}
+	}
+
+	tmpl := make(map[string]string)
+	for _, f := range TemplateFields(i.Category) {
+		tmpl[f.Section+"\x00"+f.Id] = f.Kind
+	}
+	seen := make(map[string]bool)
+	for _, f := range i.fields(true) {
+		name := f.Name
+		if name == "" {
+			name = f.Id
+		}
+		if f.Section != "" {
+			name = f.Section + "." + name
+		}
+
+		key := f.Section + "\x00" + f.Id
+		if f.Id != "" && seen[key] {
+			add("%s: duplicate field id %q", name, f.Id)
+		}
+		seen[key] = true
+
+		if i.isLoginField(&f) || (f.Section == "" && i.Category.Uuid == CatPassword.Uuid && f.Id == "password") {
+			continue
+		}
+		if !sectionKinds[f.Kind] {
+			add("%s: unknown kind %q", name, f.Kind)
+			continue
+		}
+		if kind, ok := tmpl[key]; ok && kind != f.Kind {
+			add("%s: kind must be %q, not %q", name, kind, f.Kind)
+		}
+		switch {
+		case f.Value == "":
+		case f.Kind == KindDate && !isInteger(f.Value):
+			add("%s: dates must be Unix timestamps", name)
+		case f.Kind == KindMonthYear && !isMonthYear(f.Value):
+			add("%s: must be a month in the form YYYYMM", name)
+		case f.Kind == KindAddress && !json.Valid([]byte(f.Value)):
+			add("%s: addresses must be JSON objects", name)
+		}
+	}
+
+	if problems != nil {
+		return &ValidationError{problems}
+	}
+	return nil
+}
+
+func isMonthYear(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && len(s) == 6 && n%100 >= 1 && n%100 <= 12
+}
@@ -0,0 +1,80 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// An ItemDecryptError reports part of an item that couldn't be decrypted
+// or decoded. errors.Is sees through it to the error from package crypto,
+// such as crypto.ErrIncorrectMAC.
+type ItemDecryptError struct {
+	Uuid string
+	Part string // "key", "overview", "details", or "attachment"
+	Err  error
+}
+
+func (e *ItemDecryptError) Error() string {
+	return fmt.Sprintf("item %s: %s: %s", e.Uuid, e.Part, e.Err)
+}
+
+func (e *ItemDecryptError) Unwrap() error {
+	return e.Err
+}
+
+// itemError wraps an error from decrypting part of the item with the
+// supplied uuid, or returns nil if err is.
+func itemError(uuid, part string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ItemDecryptError{Uuid: uuid, Part: part, Err: err}
+}
+
+// A ProfileError reports a profile that couldn't be found or read.
+type ProfileError struct {
+	Profile string
+	File    string // profile.js within an OPVault directory, or the SQLite database
+	Err     error
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("profile %q: %s: %s", e.Profile, e.File, e.Err)
+}
+
+func (e *ProfileError) Unwrap() error {
+	return e.Err
+}
+
+// A BandParseError reports a band file that couldn't be decoded.
+type BandParseError struct {
+	File   string
+	Offset int64 // How far into the file the decoder had read, or -1
+	Err    error
+}
+
+func (e *BandParseError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s: byte %d: %s", e.File, e.Offset, e.Err)
+}
+
+func (e *BandParseError) Unwrap() error {
+	return e.Err
+}
+
+// jsonOffset returns how far past base a JSON decoding error was found, or
+// -1 if the error doesn't say.
+func jsonOffset(base int64, err error) int64 {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		return base + syntax.Offset
+	case errors.As(err, &typ):
+		return base + typ.Offset
+	}
+	return -1
+}
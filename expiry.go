@@ -0,0 +1,83 @@
+package onepassword
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiryIds holds the identifiers of the section fields used for expiry
+// dates by the category templates.
+var expiryIds = map[string]bool{
+	"expiry":      true, // Credit Card
+	"expiry_date": true, // Driver License, Membership, Passport
+	"expires":     true, // Outdoor License, API Credential
+}
+
+// parseFieldTime converts the value of a date or monthYear field to a time.
+// A month/year value such as 202312 is taken to mean the end of the month,
+// i.e. the first instant of the following month.
+func parseFieldTime(f Field) (time.Time, bool) {
+	n, err := strconv.ParseInt(f.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	switch f.Kind {
+	case KindDate:
+		return time.Unix(n, 0), true
+	case KindMonthYear:
+		year, month := int(n/100), time.Month(n%100)
+		if year < 1 || month < 1 || month > 12 {
+			return time.Time{}, false
+		}
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, time.Local), true
+	}
+	return time.Time{}, false
+}
+
+// Expiry returns when the item expires, based on the expiry date fields of
+// passports, credit cards, licenses, memberships, and similar items. The
+// boolean is false if the item has no expiry date.
+func (i *Item) Expiry() (time.Time, bool) {
+	if i.Category.Uuid == CatLogin.Uuid || i.Category.Uuid == CatPassword.Uuid {
+		return time.Time{}, false
+	}
+
+	d := i.credentials()
+	for _, s := range d.Sections {
+		for _, f := range s.Fields {
+			if f.Kind != KindDate && f.Kind != KindMonthYear {
+				continue
+			}
+			if !expiryIds[f.Id] && !strings.Contains(strings.ToLower(f.Name), "expir") {
+				continue
+			}
+			if t, ok := parseFieldTime(f); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Expiring returns the items that expire within the supplied duration from
+// now, including those that have already expired, soonest first.
+func (v *Vault) Expiring(within time.Duration) ([]Item, error) {
+	deadline := time.Now().Add(within)
+	items, err := v.LookupItems(func(i *Item) bool {
+		t, ok := i.Expiry()
+		return ok && t.Before(deadline)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(items, func(a, b int) bool {
+		ta, _ := items[a].Expiry()
+		tb, _ := items[b].Expiry()
+		return ta.Before(tb)
+	})
+	return items, nil
+}
@@ -0,0 +1,239 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// fieldClocksKey is the entry of an item's details holding the clocks of
+// its fields. 1Password keeps entries of the details it doesn't know.
+const fieldClocksKey = "opvaultFieldClocks"
+
+// A fieldClock is the vector clock of one of an item's fields: how many
+// times each computer, named as user@host, has changed it, and when it was
+// last changed.
+type fieldClock struct {
+	Counts map[string]uint64 `json:"v"`
+	Time   int64             `json:"t"`
+}
+
+// descends reports whether c has seen every change d has.
+func (c fieldClock) descends(d fieldClock) bool {
+	for replica, n := range d.Counts {
+		if c.Counts[replica] < n {
+			return false
+		}
+	}
+	return true
+}
+
+// join returns the clock that has seen the changes of both c and d, last
+// changed at the time of the one chosen.
+func (c fieldClock) join(d fieldClock, chosen fieldClock) fieldClock {
+	j := fieldClock{Counts: make(map[string]uint64), Time: chosen.Time}
+	for replica, n := range c.Counts {
+		j.Counts[replica] = n
+	}
+	for replica, n := range d.Counts {
+		if n > j.Counts[replica] {
+			j.Counts[replica] = n
+		}
+	}
+	return j
+}
+
+// fieldKey names a detail field among the values returned by fieldValues.
+func fieldKey(f *FieldValue) string {
+	return "field/" + f.Section + "/" + f.Id
+}
+
+// fieldValues returns the values that MergeFields reconciles one by one:
+// the title, URL, tags, and notes, and each detail field that isn't empty.
+func fieldValues(item *Item) map[string]string {
+	values := make(map[string]string)
+	if item == nil {
+		return values
+	}
+	set := func(k, v string) {
+		if v != "" {
+			values[k] = v
+		}
+	}
+	set("title", item.Title)
+	set("url", item.Url)
+	set("tags", strings.Join(item.Tags, "\n"))
+	set("notes", item.Notes())
+	for _, f := range item.Fields() {
+		set(fieldKey(&f), f.Value)
+	}
+	return values
+}
+
+// readFieldClocks returns the clocks kept in an item's details.
+func readFieldClocks(item *Item) map[string]fieldClock {
+	clocks := make(map[string]fieldClock)
+	if item == nil || len(item.Details) == 0 {
+		return clocks
+	}
+	var d struct {
+		Clocks map[string]fieldClock `json:"opvaultFieldClocks"`
+	}
+	if json.Unmarshal(item.Details, &d) == nil && d.Clocks != nil {
+		clocks = d.Clocks
+	}
+	return clocks
+}
+
+// writeFieldClocks replaces the clocks kept in an item's details.
+func writeFieldClocks(item *Item, clocks map[string]fieldClock) error {
+	d := make(map[string]json.RawMessage)
+	if len(item.Details) > 0 {
+		if err := json.Unmarshal(item.Details, &d); err != nil {
+			return err
+		}
+	}
+	d[fieldClocksKey], _ = json.Marshal(clocks)
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	item.Details = data
+	return nil
+}
+
+// tickFieldClocks counts a change by this computer to each field that
+// differs between old, which is nil for new items, and item.
+func tickFieldClocks(item, old *Item, at time.Time) error {
+	clocks := readFieldClocks(old)
+	if old == nil {
+		clocks = readFieldClocks(item)
+	}
+	before, after := fieldValues(old), fieldValues(item)
+	replica := journalUser()
+	tick := func(k string) {
+		c := clocks[k]
+		counts := make(map[string]uint64)
+		for r, n := range c.Counts {
+			counts[r] = n
+		}
+		counts[replica]++
+		clocks[k] = fieldClock{counts, at.Unix()}
+	}
+	for k, v := range after {
+		if before[k] != v {
+			tick(k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			tick(k)
+		}
+	}
+	return writeFieldClocks(item, clocks)
+}
+
+// mergeFields returns dst with each field that src changed more recently
+// taken from src, and whether that changed anything. A field's version in
+// src wins if its clock has seen every change in dst's. If neither has
+// seen all of the other's changes, or the fields have no clocks, the one
+// changed last wins, with fields without clocks counted as changed when
+// their item was; ties go to the greater value, so both copies agree.
+// Fields are removed if the winning version has none.
+func mergeFields(dst, src *Item) (*Item, bool, error) {
+	dstValues, srcValues := fieldValues(dst), fieldValues(src)
+	dstClocks, srcClocks := readFieldClocks(dst), readFieldClocks(src)
+	keys := make(map[string]bool)
+	for _, m := range []map[string]string{dstValues, srcValues} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	for _, m := range []map[string]fieldClock{dstClocks, srcClocks} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+
+	values := make(map[string]string)
+	clocks := make(map[string]fieldClock)
+	for k := range keys {
+		dc, dok := dstClocks[k]
+		if !dok {
+			dc.Time = dst.Updated.Unix()
+		}
+		sc, sok := srcClocks[k]
+		if !sok {
+			sc.Time = src.Updated.Unix()
+		}
+		var useSrc bool
+		switch dv, sv := dstValues[k], srcValues[k]; {
+		case sc.descends(dc) && !dc.descends(sc):
+			useSrc = true
+		case dc.descends(sc) && !sc.descends(dc), dv == sv:
+			useSrc = false
+		default:
+			useSrc = sc.Time > dc.Time || sc.Time == dc.Time && sv > dv
+		}
+		chosen := dc
+		if useSrc {
+			chosen = sc
+		}
+		if dok || sok {
+			clocks[k] = dc.join(sc, chosen)
+		}
+		v := dstValues[k]
+		if useSrc {
+			v = srcValues[k]
+		}
+		if v != "" {
+			values[k] = v
+		}
+	}
+	if reflect.DeepEqual(values, dstValues) && reflect.DeepEqual(clocks, dstClocks) {
+		return dst, false, nil
+	}
+
+	merged := *dst
+	merged.Title = values["title"]
+	merged.Url = values["url"]
+	merged.Tags = nil
+	if tags := values["tags"]; tags != "" {
+		merged.Tags = strings.Split(tags, "\n")
+	}
+	// Fields keep their place in dst, and those only src has follow
+	var fields []FieldValue
+	seen := make(map[string]bool)
+	for _, f := range dst.fields(true) {
+		k := fieldKey(&f)
+		seen[k] = true
+		if v, ok := values[k]; ok {
+			f.Value = v
+		} else if f.Value != "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	for _, f := range src.Fields() {
+		k := fieldKey(&f)
+		if v, ok := values[k]; ok && !seen[k] {
+			f.Value = v
+			fields = append(fields, f)
+		}
+	}
+	now := time.Now()
+	if err := merged.SetFields(fields, now); err != nil {
+		return nil, false, err
+	}
+	if err := merged.SetNotes(values["notes"]); err != nil {
+		return nil, false, err
+	}
+	if _, err := mergePasswordHistory(&merged, src); err != nil {
+		return nil, false, err
+	}
+	if err := writeFieldClocks(&merged, clocks); err != nil {
+		return nil, false, err
+	}
+	return &merged, true, nil
+}
@@ -0,0 +1,78 @@
+package onepassword
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// Field kinds used by the official apps. The kind controls how a field's
+// value is stored and rendered.
+const (
+	KindString    = "string"
+	KindConcealed = "concealed"
+	KindEmail     = "email"
+	KindPhone     = "phone"
+	KindURL       = "URL"
+	KindDate      = "date"      // Unix timestamp
+	KindMonthYear = "monthYear" // YYYYMM
+	KindMenu      = "menu"
+	KindGender    = "gender"
+	KindCCType    = "cctype"
+	KindAddress   = "address" // JSON object
+)
+
+type field struct {
+	Kind  string          `json:"k"`
+	Id    string          `json:"n"`
+	Name  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// UnmarshalJSON decodes a section field. Values that aren't JSON strings,
+// like the numbers stored by date fields or the objects stored by address
+// fields, are kept as their JSON text.
+func (f *Field) UnmarshalJSON(data []byte) error {
+	var raw field
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*f = Field{Kind: raw.Kind, Id: raw.Id, Name: raw.Name}
+	if len(raw.Value) == 0 || bytes.Equal(raw.Value, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Value, &f.Value); err != nil {
+		f.Value = string(raw.Value)
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes a section field, storing date and month/year values as
+// numbers and address values as objects the way the official apps do. Empty
+// values are omitted.
+func (f Field) MarshalJSON() ([]byte, error) {
+	raw := field{Kind: f.Kind, Id: f.Id, Name: f.Name}
+	if f.Value != "" {
+		switch {
+		case (f.Kind == KindDate || f.Kind == KindMonthYear) && isInteger(f.Value):
+			raw.Value = json.RawMessage(f.Value)
+		case f.Kind == KindAddress && json.Valid([]byte(f.Value)):
+			raw.Value = json.RawMessage(f.Value)
+		default:
+			v, err := json.Marshal(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			raw.Value = v
+		}
+	}
+
+	return json.Marshal(raw)
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
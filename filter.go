@@ -0,0 +1,301 @@
+package onepassword
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseFilter compiles a filter expression into an ItemPredicate. An
+// expression is a list of whitespace separated terms, all of which must
+// match:
+//
+//	category:login        Items in a category, by name or uuid
+//	tag:work              Items tagged work or anything beneath it
+//	url:*.example.com     Items with a URL matching a glob or substring
+//	title:"my bank"       Items whose title matches a glob or substring
+//	uuid:67979020CCA5...  The item with the supplied uuid
+//	created:<2020-06-01   Items created before, after (>), on or before
+//	updated:>=2023-01-01  (<=), on or after (>=), or on (=) a date
+//	bank                  Items mentioning a word in their overview
+//
+// Prefixing a term with "-" negates it. Values containing whitespace may be
+// double quoted. Globs support "*" and "?", and all matching ignores case.
+func ParseFilter(expr string) (ItemPredicate, error) {
+	terms, err := splitTerms(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var preds []ItemPredicate
+	for _, term := range terms {
+		pred, err := parseTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+
+	return func(i *Item) bool {
+		for _, p := range preds {
+			if !p(i) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// Filter returns the items in the vault matching a filter expression. The
+// terms only look at overviews, so details are decrypted only for the
+// items that match.
+func (v *Vault) Filter(expr string) ([]Item, error) {
+	return v.FilterContext(context.Background(), expr)
+}
+
+// FilterContext is Filter, stopping with ctx's error once ctx is done.
+func (v *Vault) FilterContext(ctx context.Context, expr string) ([]Item, error) {
+	pred, err := ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	overviews, err := v.OverviewsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for i := range overviews {
+		if pred(&overviews[i]) {
+			items = append(items, overviews[i])
+		}
+	}
+	if err = v.ensureDetails(ctx, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// splitTerms splits an expression on whitespace, keeping quoted runs
+// together and removing the quotes.
+func splitTerms(expr string) ([]string, error) {
+	var terms []string
+	var cur strings.Builder
+	inTerm, quoted := false, false
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inTerm = true
+		case unicode.IsSpace(r) && !quoted:
+			if inTerm {
+				terms = append(terms, cur.String())
+				cur.Reset()
+				inTerm = false
+			}
+		default:
+			cur.WriteRune(r)
+			inTerm = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("filter: unterminated quote in %q", expr)
+	}
+	if inTerm {
+		terms = append(terms, cur.String())
+	}
+	return terms, nil
+}
+
+func parseTerm(term string) (ItemPredicate, error) {
+	negate := false
+	if strings.HasPrefix(term, "-") && len(term) > 1 {
+		negate = true
+		term = term[1:]
+	}
+
+	var pred ItemPredicate
+	var err error
+	key, value, ok := cutTerm(term)
+	if !ok {
+		pred = matchText(term)
+	} else {
+		switch key {
+		case "category", "cat":
+			pred, err = matchCategory(value)
+		case "tag":
+			pred = TagPrefix(value)
+		case "url":
+			pred = matchURL(value)
+		case "title":
+			pred = func(i *Item) bool { return matchString(value, i.Title) }
+		case "uuid":
+			pred = func(i *Item) bool { return strings.EqualFold(i.Uuid, value) }
+		case "created":
+			pred, err = matchTime(value, func(i *Item) time.Time { return i.Created })
+		case "updated":
+			pred, err = matchTime(value, func(i *Item) time.Time { return i.Updated })
+		default:
+			err = fmt.Errorf("filter: unknown key %q", key)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if negate {
+		return func(i *Item) bool { return !pred(i) }, nil
+	}
+	return pred, nil
+}
+
+func cutTerm(term string) (key, value string, ok bool) {
+	i := strings.IndexByte(term, ':')
+	if i <= 0 {
+		return "", term, false
+	}
+	return strings.ToLower(term[:i]), term[i+1:], true
+}
+
+func matchText(word string) ItemPredicate {
+	return func(i *Item) bool {
+		if matchString(word, i.Title) || matchString(word, i.Info) || matchString(word, i.Url) {
+			return true
+		}
+		for _, t := range i.Tags {
+			if matchString(word, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchCategory(value string) (ItemPredicate, error) {
+	cat, ok := CategoryByName(value)
+	if !ok {
+		cat, ok = CategoryByUUID(value)
+	}
+	if !ok {
+		return nil, fmt.Errorf("filter: unknown category %q", value)
+	}
+	return func(i *Item) bool { return i.Category.Uuid == cat.Uuid }, nil
+}
+
+func matchURL(pattern string) ItemPredicate {
+	return func(i *Item) bool {
+		for _, u := range i.allUrls() {
+			if matchString(pattern, u) {
+				return true
+			}
+			if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+				if matchString(pattern, parsed.Hostname()) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// allUrls returns the item's primary URL followed by any additional URLs.
+func (i *Item) allUrls() []string {
+	var urls []string
+	if i.Url != "" {
+		urls = append(urls, i.Url)
+	}
+	for _, l := range i.Urls {
+		if l.Url != "" && l.Url != i.Url {
+			urls = append(urls, l.Url)
+		}
+	}
+	return urls
+}
+
+// matchString matches s against pattern, ignoring case. Patterns containing
+// wildcards must match all of s; other patterns need only be a substring.
+func matchString(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	if !strings.ContainsAny(pattern, "*?") {
+		return strings.Contains(s, pattern)
+	}
+	return matchGlob([]rune(pattern), []rune(s))
+}
+
+// matchGlob reports whether s matches all of the glob p. Only the last
+// star seen is backtracked to, as a match found with an earlier one could
+// be found with it too, so matching takes time proportional to len(p) times
+// len(s) at worst, rather than growing exponentially with the stars.
+func matchGlob(p, s []rune) bool {
+	pi, si := 0, 0
+	star, starS := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			star, starS = pi, si
+			pi++
+		case pi < len(p) && (p[pi] == '?' || p[pi] == s[si]):
+			pi++
+			si++
+		case star >= 0:
+			// Let the last star take one more rune
+			starS++
+			pi, si = star+1, starS
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// matchTime parses a comparison such as ">=2023-01-01". Dates without a time
+// of day cover the whole day in local time.
+func matchTime(value string, get func(*Item) time.Time) (ItemPredicate, error) {
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, o) {
+			op, value = o, value[len(o):]
+			break
+		}
+	}
+
+	var start, end time.Time
+	var err error
+	for _, layout := range timeLayouts {
+		start, err = time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			if layout == "2006-01-02" {
+				end = start.AddDate(0, 0, 1)
+			} else {
+				end = start.Add(time.Nanosecond)
+			}
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter: invalid date %q", value)
+	}
+
+	return func(i *Item) bool {
+		t := get(i)
+		switch op {
+		case ">":
+			return !t.Before(end)
+		case ">=":
+			return !t.Before(start)
+		case "<":
+			return t.Before(start)
+		case "<=":
+			return t.Before(end)
+		default:
+			return !t.Before(start) && t.Before(end)
+		}
+	}, nil
+}
@@ -0,0 +1,115 @@
+package onepassword
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return d
+	}
+	github := Item{
+		Title:    "GitHub",
+		Url:      "https://login.github.com/session",
+		Tags:     []string{"Work/Dev"},
+		Category: CatLogin,
+		Updated:  day("2023-01-01").Add(time.Hour),
+	}
+	bank := Item{
+		Title:    "My Bank",
+		Tags:     []string{"personal", "archived"},
+		Category: CatBankAccount,
+		Updated:  day("2022-06-01"),
+	}
+
+	cases := []struct {
+		expr  string
+		match []bool
+	}{
+		{"category:login", []bool{true, false}},
+		{"cat:bank-account", []bool{false, true}},
+		{"tag:work", []bool{true, false}},
+		{"-tag:archived", []bool{true, false}},
+		{"url:*.github.com", []bool{true, false}},
+		{`title:"my bank"`, []bool{false, true}},
+		{"title:git*", []bool{true, false}},
+		{"updated:>2022-12-31", []bool{true, false}},
+		{"updated:>2023-01-01", []bool{false, false}},
+		{"updated:2023-01-01", []bool{true, false}},
+		{"updated:<=2022-06-01", []bool{false, true}},
+		{"bank tag:personal", []bool{false, true}},
+		{"", []bool{true, true}},
+	}
+	for _, c := range cases {
+		pred, err := ParseFilter(c.expr)
+		if err != nil {
+			t.Fatalf("Failed parsing %q: %s", c.expr, err)
+		}
+		for i, item := range []Item{github, bank} {
+			if got := pred(&item); got != c.match[i] {
+				t.Fatalf("%q on %q: expected %v. Got %v.", c.expr, item.Title, c.match[i], got)
+			}
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{"color:red", "category:nope", "updated:>yesterday", `title:"open`} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Fatalf("Expected error parsing %q", expr)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"g?thub", "github", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"*", "", true},
+		{"**a", "a", true},
+		{"a?", "a", false},
+	} {
+		if got := matchGlob([]rune(tc.pattern), []rune(tc.s)); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+
+	// Backtracking to every star would take exponential time
+	pattern := strings.Repeat("*a", 30) + "*b"
+	s := strings.Repeat("a", 1000)
+	start := time.Now()
+	if matchGlob([]rune(pattern), []rune(s)) {
+		t.Errorf("Expected %q not to match", pattern)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Matching took %s", d)
+	}
+}
+
+func TestFilterDetails(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"Bank"}`, loginDetails, false)
+	// Only the details of matching items are decrypted
+	f.band["B2"].Details[40] ^= 1
+	f.writeBand("B")
+	v := f.open()
+	defer v.Close()
+
+	items, err := v.Filter("title:git*")
+	if err != nil || len(items) != 1 || items[0].Password() != "hunter2" {
+		t.Fatalf("Expected GitHub with its details. Got %+v, %v.", items, err)
+	}
+	if _, err = v.Filter("title:bank"); err == nil {
+		t.Errorf("Expected the corrupt details of a matching item reported")
+	}
+}
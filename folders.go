@@ -0,0 +1,92 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// A Folder groups items. Folders may be nested, and each item is in at
+// most one, named by Item.Folder.
+type Folder struct {
+	Uuid   string
+	Title  string // From the encrypted overview
+	Parent string // Uuid of the enclosing folder; empty at the top level
+}
+
+// A folderRecord is a folder as stored, with its overview encrypted.
+type folderRecord struct {
+	Uuid     string `json:"uuid"`
+	Parent   string `json:"parent"`
+	Smart    bool   `json:"smart"`
+	Overview []byte `json:"overview"`
+}
+
+type folderOverview struct {
+	Title string `json:"title"`
+}
+
+// A folderStore keeps folders. Only OPVault directories do.
+type folderStore interface {
+	folders() ([]*folderRecord, error)
+}
+
+// folders reads folders.js, which profiles without folders lack.
+func (s *opvaultStore) folders() ([]*folderRecord, error) {
+	data, err := fs.ReadFile(s.fsys, path.Join(s.dir, "folders.js"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var fm map[string]*folderRecord
+	if err = unmarshalJS(data, &fm); err != nil {
+		return nil, err
+	}
+	recs := make([]*folderRecord, 0, len(fm))
+	for _, r := range fm {
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
+
+// Folders returns the vault's folders, sorted by title. Smart folders,
+// which are saved searches rather than places items are kept, are left
+// out. Vaults whose format has no folders have none.
+func (v *Vault) Folders() ([]Folder, error) {
+	fst, ok := v.store.(folderStore)
+	if !ok {
+		return nil, nil
+	}
+	recs, err := fst.folders()
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []Folder
+	for _, r := range recs {
+		if r.Smart {
+			continue
+		}
+		var ov folderOverview
+		data, err := crypto.DecryptOPData01(r.Overview, v.overviewKP)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &ov); err != nil {
+			return nil, err
+		}
+		folders = append(folders, Folder{r.Uuid, ov.Title, r.Parent})
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if folders[i].Title != folders[j].Title {
+			return folders[i].Title < folders[j].Title
+		}
+		return folders[i].Uuid < folders[j].Uuid
+	})
+	return folders, nil
+}
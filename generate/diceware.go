@@ -0,0 +1,56 @@
+package generate
+
+import (
+	_ "embed"
+	"errors"
+	"math"
+	"strings"
+)
+
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+// EFFLargeWordlist is the EFF's list of 7776 words for diceware, chosen to
+// be memorable and easy to type. See
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases.
+var EFFLargeWordlist = strings.Fields(effLargeWordlist)
+
+// Diceware generates passphrases of words picked at random from a list.
+type Diceware struct {
+	Words      int
+	Separator  string
+	Capitalize bool     // Capitalize the first letter of each word
+	Wordlist   []string // Defaults to EFFLargeWordlist
+}
+
+// DefaultDiceware generates five word passphrases separated by dashes.
+var DefaultDiceware = Diceware{Words: 5, Separator: "-"}
+
+func (d Diceware) wordlist() []string {
+	if d.Wordlist != nil {
+		return d.Wordlist
+	}
+	return EFFLargeWordlist
+}
+
+func (d Diceware) Generate() (string, error) {
+	if d.Words < 1 {
+		return "", errors.New("generate: a passphrase needs at least one word")
+	}
+	words := make([]string, d.Words)
+	for i := range words {
+		w, err := pick(d.wordlist())
+		if err != nil {
+			return "", err
+		}
+		if d.Capitalize {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		words[i] = w
+	}
+	return strings.Join(words, d.Separator), nil
+}
+
+func (d Diceware) Entropy() float64 {
+	return float64(d.Words) * math.Log2(float64(len(d.wordlist())))
+}
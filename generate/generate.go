@@ -0,0 +1,198 @@
+// Package generate creates random passwords: strings drawn from character
+// classes, pronounceable passwords, and diceware passphrases. All randomness
+// comes from crypto/rand.
+package generate
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// A Generator creates random passwords.
+type Generator interface {
+	// Generate returns a new password.
+	Generate() (string, error)
+
+	// Entropy returns the strength of generated passwords in bits,
+	// assuming an attacker knows how they were generated.
+	Entropy() float64
+}
+
+// Character classes used by Chars.
+const (
+	Lower   = "abcdefghijklmnopqrstuvwxyz"
+	Upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits  = "0123456789"
+	Symbols = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+
+	// Ambiguous characters are easily confused when read or typed.
+	Ambiguous = "Il1O0o"
+)
+
+// randInt returns a uniformly random integer in [0, n).
+func randInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// pick returns a random element of choices.
+func pick(choices []string) (string, error) {
+	i, err := randInt(len(choices))
+	if err != nil {
+		return "", err
+	}
+	return choices[i], nil
+}
+
+// Chars generates passwords of random characters. Every enabled class is
+// guaranteed to appear at least once.
+type Chars struct {
+	Length           int
+	Upper            bool
+	Digits           bool
+	Symbols          bool
+	ExcludeAmbiguous bool
+}
+
+// DefaultChars generates 20 character passwords using letters and digits.
+var DefaultChars = Chars{Length: 20, Upper: true, Digits: true}
+
+// classes returns the enabled character classes. Lowercase letters are
+// always included.
+func (c Chars) classes() []string {
+	classes := []string{Lower}
+	if c.Upper {
+		classes = append(classes, Upper)
+	}
+	if c.Digits {
+		classes = append(classes, Digits)
+	}
+	if c.Symbols {
+		classes = append(classes, Symbols)
+	}
+	if c.ExcludeAmbiguous {
+		for i, class := range classes {
+			classes[i] = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(Ambiguous, r) {
+					return -1
+				}
+				return r
+			}, class)
+		}
+	}
+	return classes
+}
+
+func (c Chars) Generate() (string, error) {
+	classes := c.classes()
+	if c.Length < len(classes) {
+		return "", errors.New("generate: length is too short to include every character class")
+	}
+	alphabet := strings.Join(classes, "")
+
+	// Rejection sampling keeps every acceptable password equally likely
+	buf := make([]byte, c.Length)
+	for {
+		for i := range buf {
+			j, err := randInt(len(alphabet))
+			if err != nil {
+				return "", err
+			}
+			buf[i] = alphabet[j]
+		}
+		ok := true
+		for _, class := range classes {
+			ok = ok && strings.ContainsAny(string(buf), class)
+		}
+		if ok {
+			return string(buf), nil
+		}
+	}
+}
+
+func (c Chars) Entropy() float64 {
+	return float64(c.Length) * math.Log2(float64(len(strings.Join(c.classes(), ""))))
+}
+
+// Pronounceable generates passwords made of alternating consonants and
+// vowels, e.g. "votakimu", optionally with a capital letter and a digit
+// mixed in to satisfy site rules.
+type Pronounceable struct {
+	Length     int
+	Capitalize bool // Capitalize one letter
+	Digit      bool // Replace one letter with a digit
+}
+
+// DefaultPronounceable generates 16 character pronounceable passwords.
+var DefaultPronounceable = Pronounceable{Length: 16, Capitalize: true, Digit: true}
+
+var (
+	consonants = strings.Split("b c d f g h j k l m n p r s t v w z ch sh th", " ")
+	vowels     = strings.Split("a e i o u", " ")
+)
+
+func (p Pronounceable) Generate() (string, error) {
+	if p.Length < 2 {
+		return "", errors.New("generate: length is too short")
+	}
+
+	var b strings.Builder
+	for i := 0; b.Len() < p.Length; i++ {
+		set := consonants
+		if i%2 == 1 {
+			set = vowels
+		}
+		s, err := pick(set)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	pw := []byte(b.String()[:p.Length])
+
+	// The capital and digit go in different places
+	digit := -1
+	if p.Digit {
+		i, err := randInt(len(pw))
+		if err != nil {
+			return "", err
+		}
+		d, err := randInt(10)
+		if err != nil {
+			return "", err
+		}
+		pw[i] = byte('0' + d)
+		digit = i
+	}
+	if p.Capitalize {
+		n := len(pw)
+		if digit >= 0 {
+			n--
+		}
+		i, err := randInt(n)
+		if err != nil {
+			return "", err
+		}
+		if digit >= 0 && i >= digit {
+			i++
+		}
+		pw[i] = pw[i] - 'a' + 'A'
+	}
+	return string(pw), nil
+}
+
+// Entropy is a lower bound that treats digraphs as single letters.
+func (p Pronounceable) Entropy() float64 {
+	bits := float64(p.Length/2)*math.Log2(float64(len(consonants))) +
+		float64(p.Length/2)*math.Log2(float64(len(vowels)))
+	if p.Digit {
+		bits += math.Log2(10)
+	}
+	return bits
+}
@@ -0,0 +1,55 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCharsIncludesEveryClass(t *testing.T) {
+	g := Chars{Length: 4, Upper: true, Digits: true, Symbols: true, ExcludeAmbiguous: true}
+	for i := 0; i < 100; i++ {
+		pw, err := g.Generate()
+		if err != nil {
+			t.Fatalf("Failed generating password: %s", err)
+		}
+		if len(pw) != 4 || strings.ContainsAny(pw, Ambiguous) {
+			t.Fatalf("Unexpected password %q", pw)
+		}
+		for _, class := range g.classes() {
+			if !strings.ContainsAny(pw, class) {
+				t.Fatalf("Password %q is missing a character from %q", pw, class)
+			}
+		}
+	}
+	if _, err := (Chars{Length: 2, Upper: true, Digits: true}).Generate(); err == nil {
+		t.Fatalf("Expected an error when the length can't fit every class.")
+	}
+}
+
+func TestDiceware(t *testing.T) {
+	if len(EFFLargeWordlist) != 7776 {
+		t.Fatalf("Expected 7776 words. Got %d.", len(EFFLargeWordlist))
+	}
+	g := Diceware{Words: 6, Separator: " ", Capitalize: true}
+	pw, err := g.Generate()
+	if err != nil {
+		t.Fatalf("Failed generating passphrase: %s", err)
+	}
+	words := strings.Split(pw, " ")
+	if len(words) != 6 || words[0][:1] != strings.ToUpper(words[0][:1]) {
+		t.Fatalf("Unexpected passphrase %q", pw)
+	}
+	if bits := g.Entropy(); bits < 77 || bits > 78 {
+		t.Fatalf("Expected about 77.5 bits. Got %f.", bits)
+	}
+}
+
+func TestPronounceable(t *testing.T) {
+	pw, err := DefaultPronounceable.Generate()
+	if err != nil {
+		t.Fatalf("Failed generating password: %s", err)
+	}
+	if len(pw) != 16 || !strings.ContainsAny(pw, Digits) {
+		t.Fatalf("Unexpected password %q", pw)
+	}
+}
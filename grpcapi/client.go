@@ -0,0 +1,89 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+)
+
+// A Client calls the service over a connection, which needn't be created
+// with this package's codec.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient returns a client using conn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp message) error {
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, grpc.ForceCodec(codec{}))
+}
+
+// stream calls a server streaming method, passing fn each item received.
+func (c *Client) stream(ctx context.Context, method string, req message, fn func(*Item) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	desc := &grpc.StreamDesc{StreamName: method, ServerStreams: true}
+	s, err := c.conn.NewStream(ctx, desc, "/"+ServiceName+"/"+method, grpc.ForceCodec(codec{}))
+	if err != nil {
+		return err
+	}
+	if err = s.SendMsg(req); err != nil {
+		return err
+	}
+	if err = s.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		item := new(Item)
+		if err := s.RecvMsg(item); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+// ListItems calls fn with each item matching req's filter, as the server
+// sends them. An error from fn ends the call.
+func (c *Client) ListItems(ctx context.Context, req *ListItemsRequest, fn func(*Item) error) error {
+	return c.stream(ctx, "ListItems", req, fn)
+}
+
+// SearchItems calls fn with each item matching req's query, best first.
+func (c *Client) SearchItems(ctx context.Context, req *SearchItemsRequest, fn func(*Item) error) error {
+	return c.stream(ctx, "SearchItems", req, fn)
+}
+
+// GetItem returns an item with its fields and notes.
+func (c *Client) GetItem(ctx context.Context, req *GetItemRequest) (*Item, error) {
+	resp := new(Item)
+	if err := c.invoke(ctx, "GetItem", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Resolve returns the secret a secret reference names.
+func (c *Client) Resolve(ctx context.Context, ref string) (string, error) {
+	resp := new(ResolveResponse)
+	if err := c.invoke(ctx, "Resolve", &ResolveRequest{ref}, resp); err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// GetTOTP returns an item's current one-time password.
+func (c *Client) GetTOTP(ctx context.Context, uuid string) (*GetTOTPResponse, error) {
+	resp := new(GetTOTPResponse)
+	if err := c.invoke(ctx, "GetTOTP", &GetTOTPRequest{uuid}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
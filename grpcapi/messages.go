@@ -0,0 +1,344 @@
+package grpcapi
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of vault.proto. They're encoded by hand, like those of the
+// csiprovider package, so neither protoc nor generated code is needed.
+
+type ListItemsRequest struct {
+	Filter  string // 1
+	Details bool   // 2
+}
+
+type SearchItemsRequest struct {
+	Query   string // 1
+	Details bool   // 2
+}
+
+type GetItemRequest struct {
+	Uuid  string // 1
+	Query string // 2
+}
+
+type ResolveRequest struct {
+	Ref string // 1
+}
+
+type ResolveResponse struct {
+	Value string // 1
+}
+
+type GetTOTPRequest struct {
+	Uuid string // 1
+}
+
+type GetTOTPResponse struct {
+	Code      string // 1
+	Remaining int32  // 2
+}
+
+type Item struct {
+	Uuid     string   // 1
+	Title    string   // 2
+	Category string   // 3
+	Info     string   // 4
+	Url      string   // 5
+	Tags     []string // 6
+	Created  int64    // 7
+	Updated  int64    // 8
+	Fields   []*Field // 9
+	Notes    string   // 10
+}
+
+type Field struct {
+	Section   string // 1
+	Id        string // 2
+	Name      string // 3
+	Kind      string // 4
+	Value     string // 5
+	Concealed bool   // 6
+}
+
+// A message is encoded in the protocol buffer wire format.
+type message interface {
+	marshal(b []byte) []byte
+	unmarshal(b []byte) error
+}
+
+// codec encodes the messages for gRPC, in place of the protobuf package's
+// codec, which requires generated types.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("grpcapi: cannot encode %T", v)
+	}
+	return m.marshal(nil), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("grpcapi: cannot decode %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	return appendVarint(b, num, protowire.EncodeBool(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.marshal(nil))
+}
+
+// eachField calls fn with each field in b. Strings and embedded messages
+// are passed as bytes, varints as their value; other fields are skipped.
+func eachField(b []byte, fn func(num protowire.Number, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = fn(num, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = fn(num, nil, v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ListItemsRequest) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Filter)
+	return appendBool(b, 2, m.Details)
+}
+
+func (m *ListItemsRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Filter = string(v)
+		case 2:
+			m.Details = protowire.DecodeBool(n)
+		}
+		return nil
+	})
+}
+
+func (m *SearchItemsRequest) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Query)
+	return appendBool(b, 2, m.Details)
+}
+
+func (m *SearchItemsRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Query = string(v)
+		case 2:
+			m.Details = protowire.DecodeBool(n)
+		}
+		return nil
+	})
+}
+
+func (m *GetItemRequest) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Uuid)
+	return appendString(b, 2, m.Query)
+}
+
+func (m *GetItemRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			m.Uuid = string(v)
+		case 2:
+			m.Query = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *ResolveRequest) marshal(b []byte) []byte {
+	return appendString(b, 1, m.Ref)
+}
+
+func (m *ResolveRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num == 1 {
+			m.Ref = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *ResolveResponse) marshal(b []byte) []byte {
+	return appendString(b, 1, m.Value)
+}
+
+func (m *ResolveResponse) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num == 1 {
+			m.Value = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *GetTOTPRequest) marshal(b []byte) []byte {
+	return appendString(b, 1, m.Uuid)
+}
+
+func (m *GetTOTPRequest) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num == 1 {
+			m.Uuid = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *GetTOTPResponse) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Code)
+	// int32 is sign extended to 64 bits on the wire
+	return appendVarint(b, 2, uint64(int64(m.Remaining)))
+}
+
+func (m *GetTOTPResponse) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Code = string(v)
+		case 2:
+			m.Remaining = int32(n)
+		}
+		return nil
+	})
+}
+
+func (m *Item) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Uuid)
+	b = appendString(b, 2, m.Title)
+	b = appendString(b, 3, m.Category)
+	b = appendString(b, 4, m.Info)
+	b = appendString(b, 5, m.Url)
+	for _, t := range m.Tags {
+		// Repeated strings are written even when empty
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, t)
+	}
+	b = appendVarint(b, 7, uint64(m.Created))
+	b = appendVarint(b, 8, uint64(m.Updated))
+	for _, f := range m.Fields {
+		b = appendMessage(b, 9, f)
+	}
+	return appendString(b, 10, m.Notes)
+}
+
+func (m *Item) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Uuid = string(v)
+		case 2:
+			m.Title = string(v)
+		case 3:
+			m.Category = string(v)
+		case 4:
+			m.Info = string(v)
+		case 5:
+			m.Url = string(v)
+		case 6:
+			m.Tags = append(m.Tags, string(v))
+		case 7:
+			m.Created = int64(n)
+		case 8:
+			m.Updated = int64(n)
+		case 9:
+			f := new(Field)
+			if err := f.unmarshal(v); err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, f)
+		case 10:
+			m.Notes = string(v)
+		}
+		return nil
+	})
+}
+
+func (m *Field) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Section)
+	b = appendString(b, 2, m.Id)
+	b = appendString(b, 3, m.Name)
+	b = appendString(b, 4, m.Kind)
+	b = appendString(b, 5, m.Value)
+	return appendBool(b, 6, m.Concealed)
+}
+
+func (m *Field) unmarshal(b []byte) error {
+	return eachField(b, func(num protowire.Number, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.Section = string(v)
+		case 2:
+			m.Id = string(v)
+		case 3:
+			m.Name = string(v)
+		case 4:
+			m.Kind = string(v)
+		case 5:
+			m.Value = string(v)
+		case 6:
+			m.Concealed = protowire.DecodeBool(n)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,262 @@
+// Package grpcapi serves a vault over gRPC, for services written in any
+// language: vault.proto defines the API, from which other languages can
+// generate clients, and Client calls it from Go. Item listings are
+// streamed, one message per item. The server doesn't authenticate clients
+// itself; serve it with mutual TLS, as "opvault grpc" does.
+package grpcapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the service's full name in vault.proto.
+const ServiceName = "opvault.v1.Vault"
+
+// A Source is what the service serves; *onepassword.Vault is one.
+type Source interface {
+	Filter(expr string) ([]onepassword.Item, error)
+	Search(query string) ([]onepassword.SearchResult, error)
+	Item(uuid string) (*onepassword.Item, error)
+	FindItem(query string) (*onepassword.Item, error)
+	Resolve(ref string) (string, error)
+}
+
+// NewServer returns a gRPC server for v, created with opts. The messages
+// are encoded by this package, so the server can't serve other services.
+// Vaults aren't safe for concurrent use, so calls are answered one at a
+// time.
+func NewServer(v Source, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(opts, grpc.ForceServerCodec(codec{}))...)
+	s.RegisterService(&serviceDesc, &service{vault: v})
+	return s
+}
+
+// NewItem returns the API's form of item, with its fields and notes if
+// details is set.
+func NewItem(item *onepassword.Item, details bool) *Item {
+	i := &Item{
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Category: item.Category.Name,
+		Info:     item.Info,
+		Url:      item.Url,
+		Tags:     item.Tags,
+		Created:  unixTime(item.Created),
+		Updated:  unixTime(item.Updated),
+	}
+	if details {
+		for _, f := range item.Fields() {
+			i.Fields = append(i.Fields, &Field{f.Section, f.Id, f.Name, f.Kind, f.Value, f.Concealed})
+		}
+		i.Notes = item.Notes()
+	}
+	return i
+}
+
+// unixTime returns t as Unix time, or 0 for the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+type service struct {
+	mu    sync.Mutex
+	vault Source
+}
+
+// vaultService is the service's interface, as RegisterService checks the
+// implementation against its HandlerType.
+type vaultService interface {
+	listItems(ctx context.Context, req *ListItemsRequest, send func(*Item) error) error
+	searchItems(ctx context.Context, req *SearchItemsRequest, send func(*Item) error) error
+	getItem(ctx context.Context, req *GetItemRequest) (*Item, error)
+	resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error)
+	getTOTP(ctx context.Context, req *GetTOTPRequest) (*GetTOTPResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*vaultService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetItem", Handler: unaryHandler("GetItem", func() message { return new(GetItemRequest) },
+			func(s vaultService, ctx context.Context, req message) (interface{}, error) {
+				return s.getItem(ctx, req.(*GetItemRequest))
+			})},
+		{MethodName: "Resolve", Handler: unaryHandler("Resolve", func() message { return new(ResolveRequest) },
+			func(s vaultService, ctx context.Context, req message) (interface{}, error) {
+				return s.resolve(ctx, req.(*ResolveRequest))
+			})},
+		{MethodName: "GetTOTP", Handler: unaryHandler("GetTOTP", func() message { return new(GetTOTPRequest) },
+			func(s vaultService, ctx context.Context, req message) (interface{}, error) {
+				return s.getTOTP(ctx, req.(*GetTOTPRequest))
+			})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ListItems", ServerStreams: true, Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := new(ListItemsRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(vaultService).listItems(stream.Context(), req, func(i *Item) error { return stream.SendMsg(i) })
+		}},
+		{StreamName: "SearchItems", ServerStreams: true, Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := new(SearchItemsRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(vaultService).searchItems(stream.Context(), req, func(i *Item) error { return stream.SendMsg(i) })
+		}},
+	},
+	Metadata: "vault.proto",
+}
+
+// unaryHandler adapts a method of the service to gRPC, as protoc-gen-go-grpc
+// would generate.
+func unaryHandler(method string, newReq func() message, call func(vaultService, context.Context, message) (interface{}, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		s := srv.(vaultService)
+		if interceptor == nil {
+			return call(s, ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(s, ctx, req.(message))
+		})
+	}
+}
+
+// statusError converts errors from the vault to gRPC statuses.
+func statusError(err error) error {
+	if _, ok := err.(*onepassword.AmbiguousQueryError); ok {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err == onepassword.ErrItemNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	switch err {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func (s *service) filter(ctx context.Context, expr string) ([]onepassword.Item, error) {
+	if cs, ok := s.vault.(onepassword.ContextSource); ok {
+		return cs.FilterContext(ctx, expr)
+	}
+	return s.vault.Filter(expr)
+}
+
+func (s *service) search(ctx context.Context, query string) ([]onepassword.SearchResult, error) {
+	if cs, ok := s.vault.(onepassword.ContextSource); ok {
+		return cs.SearchContext(ctx, query)
+	}
+	return s.vault.Search(query)
+}
+
+func (s *service) findItem(ctx context.Context, query string) (*onepassword.Item, error) {
+	if cs, ok := s.vault.(onepassword.ContextSource); ok {
+		return cs.FindItemContext(ctx, query)
+	}
+	return s.vault.FindItem(query)
+}
+
+func (s *service) listItems(ctx context.Context, req *ListItemsRequest, send func(*Item) error) error {
+	if _, err := onepassword.ParseFilter(req.Filter); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.mu.Lock()
+	items, err := s.filter(ctx, req.Filter)
+	s.mu.Unlock()
+	if err != nil {
+		return statusError(err)
+	}
+	for i := range items {
+		if err := send(NewItem(&items[i], req.Details)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) searchItems(ctx context.Context, req *SearchItemsRequest, send func(*Item) error) error {
+	s.mu.Lock()
+	results, err := s.search(ctx, req.Query)
+	s.mu.Unlock()
+	if err != nil {
+		return statusError(err)
+	}
+	for i := range results {
+		if err := send(NewItem(&results[i].Item, req.Details)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) item(ctx context.Context, uuid, query string) (*onepassword.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var item *onepassword.Item
+	var err error
+	switch {
+	case uuid != "":
+		item, err = s.vault.Item(uuid)
+	case query != "":
+		item, err = s.findItem(ctx, query)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "no uuid or query")
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return item, nil
+}
+
+func (s *service) getItem(ctx context.Context, req *GetItemRequest) (*Item, error) {
+	item, err := s.item(ctx, req.Uuid, req.Query)
+	if err != nil {
+		return nil, err
+	}
+	return NewItem(item, true), nil
+}
+
+func (s *service) resolve(ctx context.Context, req *ResolveRequest) (*ResolveResponse, error) {
+	if _, err := onepassword.ParseSecretRef(req.Ref); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.mu.Lock()
+	value, err := s.vault.Resolve(req.Ref)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &ResolveResponse{Value: value}, nil
+}
+
+func (s *service) getTOTP(ctx context.Context, req *GetTOTPRequest) (*GetTOTPResponse, error) {
+	item, err := s.item(ctx, req.Uuid, "")
+	if err != nil {
+		return nil, err
+	}
+	code, remaining, err := item.TOTPCode(time.Now())
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &GetTOTPResponse{Code: code, Remaining: int32(remaining / time.Second)}, nil
+}
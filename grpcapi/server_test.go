@@ -0,0 +1,136 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// fakeVault holds Logins in memory.
+type fakeVault struct {
+	items []onepassword.Item
+}
+
+func (v *fakeVault) Filter(expr string) ([]onepassword.Item, error) {
+	pred, err := onepassword.ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	var items []onepassword.Item
+	for i := range v.items {
+		if pred(&v.items[i]) {
+			items = append(items, v.items[i])
+		}
+	}
+	return items, nil
+}
+
+func (v *fakeVault) Search(query string) ([]onepassword.SearchResult, error) {
+	return nil, nil
+}
+
+func (v *fakeVault) Item(uuid string) (*onepassword.Item, error) {
+	for i := range v.items {
+		if v.items[i].Uuid == uuid {
+			return &v.items[i], nil
+		}
+	}
+	return nil, onepassword.ErrItemNotFound
+}
+
+func (v *fakeVault) FindItem(query string) (*onepassword.Item, error) {
+	return nil, &onepassword.AmbiguousQueryError{Query: query, Matches: v.items}
+}
+
+func (v *fakeVault) Resolve(ref string) (string, error) {
+	if ref == "opvault:///A1/password" {
+		return "hunter2", nil
+	}
+	return "", fmt.Errorf("no item for %s", ref)
+}
+
+func login(t *testing.T, uuid, title string, tags ...string) onepassword.Item {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title, item.Tags = uuid, title, tags
+	item.Updated = time.Unix(1600000000, 0)
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return *item
+}
+
+func TestService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpcapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "vault.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&fakeVault{[]onepassword.Item{login(t, "A1", "GitHub", "work"), login(t, "B2", "GitLab", "", "home")}})
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewClient(conn)
+	ctx := context.Background()
+
+	var titles []string
+	err = c.ListItems(ctx, &ListItemsRequest{Filter: "tag:work"}, func(i *Item) error {
+		titles = append(titles, i.Title)
+		if len(i.Fields) != 0 {
+			t.Errorf("Expected no fields without details: %+v", i)
+		}
+		return nil
+	})
+	if err != nil || len(titles) != 1 || titles[0] != "GitHub" {
+		t.Fatalf("Unexpected listing: %v, %v", titles, err)
+	}
+	if err = c.ListItems(ctx, &ListItemsRequest{Filter: "created:<never"}, func(*Item) error { return nil }); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected an invalid filter to fail. Got %v.", err)
+	}
+
+	item, err := c.GetItem(ctx, &GetItemRequest{Uuid: "B2"})
+	if err != nil {
+		t.Fatalf("GetItem failed: %s", err)
+	}
+	if item.Title != "GitLab" || len(item.Tags) != 2 || item.Tags[0] != "" || item.Updated != 1600000000 || len(item.Fields) != 2 || item.Fields[1].Value != "hunter2" || !item.Fields[1].Concealed {
+		t.Fatalf("Unexpected item: %+v", item)
+	}
+	if _, err = c.GetItem(ctx, &GetItemRequest{Uuid: "C3"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound. Got %v.", err)
+	}
+	if _, err = c.GetItem(ctx, &GetItemRequest{Query: "git"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected FailedPrecondition. Got %v.", err)
+	}
+
+	if value, err := c.Resolve(ctx, "opvault:///A1/password"); err != nil || value != "hunter2" {
+		t.Fatalf("Unexpected secret: %q, %v", value, err)
+	}
+	if _, err := c.Resolve(ctx, "https://example.com"); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument. Got %v.", err)
+	}
+	if _, err := c.GetTOTP(ctx, "A1"); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected an item without a one-time password to fail. Got %v.", err)
+	}
+}
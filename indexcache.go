@@ -0,0 +1,139 @@
+package onepassword
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// indexSidecar names the sidecar holding the persisted search index.
+const indexSidecar = "index"
+
+// indexCacheVersion is bumped whenever the persisted format changes. Caches
+// written with another version are discarded and rebuilt.
+const indexCacheVersion = 3
+
+// An indexEntry is an item overview as persisted in the index cache, along
+// with the updated_at and tx values of the row it was decrypted from.
+type indexEntry struct {
+	Updated int64 `json:"updated"`
+	Tx      int64 `json:"tx"`
+	Item    Item  `json:"item"`
+}
+
+type indexCache struct {
+	Version int                   `json:"version"`
+	Entries map[string]indexEntry `json:"entries"`
+}
+
+// readIndexCache returns the persisted index entries keyed by uuid. A
+// missing, unreadable, or outdated cache yields no entries.
+func (v *Vault) readIndexCache() map[string]indexEntry {
+	data, err := v.readSidecar(indexSidecar)
+	if err != nil || data == nil {
+		return nil
+	}
+	var c indexCache
+	if json.Unmarshal(data, &c) != nil || c.Version != indexCacheVersion {
+		return nil
+	}
+	return c.Entries
+}
+
+// evictIndexCache drops an item from the persisted index so its overview is
+// decrypted again. Timestamps have a resolution of a second, so an item
+// saved twice within one can't be told apart from its cached entry.
+func (v *Vault) evictIndexCache(uuid string) error {
+	cached := v.readIndexCache()
+	if _, ok := cached[uuid]; !ok {
+		return nil
+	}
+	delete(cached, uuid)
+	data, err := json.Marshal(indexCache{indexCacheVersion, cached})
+	if err != nil {
+		return err
+	}
+	return v.writeSidecar(indexSidecar, data)
+}
+
+// RemoveIndexCache deletes the persisted search index of the vault described
+// by cfg, if there is one. It's encrypted, but holds the overview of every
+// item, so it's removed when locking up.
+func RemoveIndexCache(cfg VaultConfig) error {
+	err := os.Remove(sidecarFile(cfg.DBPath, cfg.Profile, indexSidecar))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// cachedOverviews returns the overviews of every item in the vault, using
+// the persisted index cache to avoid decrypting overviews that haven't
+// changed since it was written. Only new and updated items are decrypted;
+// the cache is then written back if anything changed. The returned items
+// have no details; use ensureDetails to load them.
+func (v *Vault) cachedOverviews(ctx context.Context) ([]Item, error) {
+	recs, err := v.liveRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := v.readIndexCache()
+	fresh := make(map[string]indexEntry, len(recs))
+	dirty := len(recs) != len(cached)
+	var misses []*record
+	for _, r := range recs {
+		if ent, ok := cached[r.Uuid]; ok && ent.Updated == r.Updated && ent.Tx == r.Tx {
+			fresh[r.Uuid] = ent
+			continue
+		}
+		misses = append(misses, r)
+	}
+
+	// Decrypt the overviews of new and updated items
+	decrypted, err := v.decryptRecords(ctx, misses, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range misses {
+		fresh[r.Uuid] = indexEntry{r.Updated, r.Tx, decrypted[i]}
+		dirty = true
+	}
+	if v.metrics != nil {
+		v.metrics.IndexCacheRead(len(recs)-len(misses), len(misses))
+	}
+
+	if dirty {
+		data, err := json.Marshal(indexCache{indexCacheVersion, fresh})
+		if err != nil {
+			return nil, err
+		}
+		if err = v.writeSidecar(indexSidecar, data); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]Item, len(recs))
+	for i, r := range recs {
+		items[i] = fresh[r.Uuid].Item
+		// Names from the database take precedence over the registry
+		items[i].Category = v.category(items[i].Category.Uuid)
+	}
+	return items, nil
+}
+
+// resultDetails loads the details of search results restored from the index
+// cache.
+func (v *Vault) resultDetails(ctx context.Context, results []SearchResult) error {
+	items := make([]Item, len(results))
+	for i := range results {
+		items[i] = results[i].Item
+	}
+	if err := v.ensureDetails(ctx, items); err != nil {
+		return err
+	}
+	for i := range results {
+		results[i].Item.Details = items[i].Details
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package onepassword
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexCache(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	dbPath := filepath.Join(t.TempDir(), "Personal.opvault")
+	open := func() *Vault {
+		v := f.open()
+		v.dbPath, v.profile, v.indexCache = dbPath, "default", true
+		return v
+	}
+	title := func(v *Vault) string {
+		items, err := v.Overviews()
+		if err != nil {
+			t.Fatalf("Failed reading overviews: %s", err)
+		} else if len(items) != 1 {
+			t.Fatalf("Expected one item. Got %+v.", items)
+		}
+		return items[0].Title
+	}
+
+	v := open()
+	if got := title(v); got != "GitHub" {
+		t.Fatalf("Expected GitHub. Got %q.", got)
+	}
+
+	// Rows rewritten without touching updated_at still miss
+	f.band[uuidA1].Tx++
+	f.band[uuidA1].Overview = mustEncrypt(t, []byte(`{"title":"GitLab"}`), f.okp)
+	f.writeBand("A")
+	if got := title(open()); got != "GitLab" {
+		t.Fatalf("Expected the rewritten overview. Got %q.", got)
+	}
+
+	// Saves within one second don't leave a stale entry behind
+	v = open()
+	for _, want := range []string{"Gitea", "Forgejo"} {
+		item, err := v.Item(uuidA1)
+		if err != nil {
+			t.Fatalf("Failed reading item: %s", err)
+		}
+		item.Title = want
+		if err = v.SaveItem(item); err != nil {
+			t.Fatalf("Failed saving item: %s", err)
+		}
+		if got := title(open()); got != want {
+			t.Fatalf("Expected %s. Got %q.", want, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package onepassword
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// secretFunc returns the secret function made available to templates by
+// Inject. It accepts an item and field name, a secret reference, or a
+// single "item/field" path whose field follows the last slash.
+func (v *Vault) secretFunc() func(args ...string) (string, error) {
+	return func(args ...string) (string, error) {
+		switch len(args) {
+		case 1:
+			if IsSecretRef(args[0]) {
+				return v.Resolve(args[0])
+			}
+			slash := strings.LastIndexByte(args[0], '/')
+			if slash <= 0 || slash == len(args[0])-1 {
+				return "", fmt.Errorf("invalid secret path %q; expected item/field", args[0])
+			}
+			return v.Lookup(args[0][:slash], args[0][slash+1:])
+		case 2:
+			return v.Lookup(args[0], args[1])
+		}
+		return "", fmt.Errorf("secret takes an item/field path or an item and field")
+	}
+}
+
+// Inject executes the text/template in text and writes the result to w.
+// Templates read secrets with the secret function, given an item and field,
+// an "item/field" path, or a secret reference:
+//
+//	db:
+//	  user: {{ secret "Production DB" "username" }}
+//	  password: {{ secret "Production DB/password" }}
+//	  token: {{ secret "opvault://Work/Production DB/token" }}
+//
+// Items are found with FindItem and fields with Item.Field. Secrets are
+// looked up as the template executes, so the template itself can be kept
+// in version control. If execution fails, some output may have been
+// written.
+func (v *Vault) Inject(w io.Writer, text string) error {
+	tmpl, err := template.New("inject").
+		Funcs(template.FuncMap{"secret": v.secretFunc()}).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, nil)
+}
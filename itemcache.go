@@ -0,0 +1,125 @@
+package onepassword
+
+import (
+	"container/list"
+	"sync"
+)
+
+// An itemCache keeps the plaintext of recently decrypted overviews and
+// details, up to a budget of bytes, so that servers reading the same items
+// again needn't decrypt them again. The least recently used are evicted
+// first, and wiped as they are, as is everything when the vault is closed.
+// A nil itemCache keeps nothing.
+type itemCache struct {
+	mu      sync.Mutex
+	budget  int
+	size    int
+	entries *list.List // Of *cacheEntry, most recently used first
+	byKey   map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	part string // "overview" or "details"
+	uuid string
+}
+
+// A cacheEntry holds the plaintext of part of an item as it was at one
+// version, told by its record's transaction and update times.
+type cacheEntry struct {
+	key     cacheKey
+	tx      int64
+	updated int64
+	data    []byte
+}
+
+func newItemCache(budget int) *itemCache {
+	return &itemCache{
+		budget:  budget,
+		entries: list.New(),
+		byKey:   make(map[cacheKey]*list.Element),
+	}
+}
+
+// get returns a copy of the plaintext of part of the item r describes, or
+// nil if it isn't cached at r's version.
+func (c *itemCache) get(part string, r *record) []byte {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byKey[cacheKey{part, r.Uuid}]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if e.tx != r.Tx || e.updated != r.Updated {
+		c.remove(el)
+		return nil
+	}
+	c.entries.MoveToFront(el)
+	return append([]byte{}, e.data...)
+}
+
+// put caches a copy of the plaintext of part of the item r describes,
+// evicting the least recently used entries to stay within the budget.
+func (c *itemCache) put(part string, r *record, data []byte) {
+	if c == nil || len(data) > c.budget {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey{part, r.Uuid}
+	if el, ok := c.byKey[key]; ok {
+		c.remove(el)
+	}
+	for c.size+len(data) > c.budget {
+		c.remove(c.entries.Back())
+	}
+	e := &cacheEntry{key, r.Tx, r.Updated, append([]byte{}, data...)}
+	c.byKey[key] = c.entries.PushFront(e)
+	c.size += len(e.data)
+}
+
+// evict removes and wipes the overview and details of the item with the
+// supplied uuid, as when it's saved: its version is only told to the
+// second, so a second save within one wouldn't be noticed.
+func (c *itemCache) evict(uuid string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, part := range []string{"overview", "details"} {
+		if el, ok := c.byKey[cacheKey{part, uuid}]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// remove evicts and wipes an entry.
+func (c *itemCache) remove(el *list.Element) {
+	e := c.entries.Remove(el).(*cacheEntry)
+	delete(c.byKey, e.key)
+	c.size -= len(e.data)
+	wipe(e.data)
+}
+
+// purge evicts and wipes every entry.
+func (c *itemCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.entries.Len() > 0 {
+		c.remove(c.entries.Front())
+	}
+}
+
+// wipe overwrites plaintext with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,98 @@
+package onepassword
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestItemCache(t *testing.T) {
+	c := newItemCache(10)
+	a, b := &record{Uuid: "A1", Tx: 1}, &record{Uuid: "B2", Tx: 1}
+	data := []byte("secret")
+	c.put("details", a, data)
+	if got := c.get("details", a); !bytes.Equal(got, data) {
+		t.Fatalf("Expected a hit. Got %q.", got)
+	}
+	if got := c.get("overview", a); got != nil {
+		t.Errorf("Expected a miss for another part. Got %q.", got)
+	}
+
+	// A1 is evicted and wiped to make room for B2
+	cached := c.byKey[cacheKey{"details", "A1"}].Value.(*cacheEntry).data
+	c.put("details", b, []byte("secret"))
+	if got := c.get("details", a); got != nil {
+		t.Errorf("Expected A1 evicted. Got %q.", got)
+	}
+	if !bytes.Equal(cached, make([]byte, len(cached))) {
+		t.Errorf("Expected the evicted plaintext wiped. Got %q.", cached)
+	}
+	if c.size != 6 {
+		t.Errorf("Expected 6 bytes cached. Got %d.", c.size)
+	}
+
+	// Other versions of an item miss
+	if got := c.get("details", &record{Uuid: "B2", Tx: 2}); got != nil {
+		t.Errorf("Expected a miss for a later version. Got %q.", got)
+	}
+	c.put("details", b, []byte("too large to cache"))
+	if c.entries.Len() != 0 {
+		t.Errorf("Expected nothing cached beyond the budget")
+	}
+}
+
+func TestVaultItemCache(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v := f.open()
+	v.cache = newItemCache(1 << 20)
+
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	if v.cache.entries.Len() != 2 {
+		t.Fatalf("Expected the overview and details cached. Got %d entries.", v.cache.entries.Len())
+	}
+	// Callers own what they're given
+	wipe(item.Details)
+	if item, err = v.Item(uuidA1); err != nil || item.Password() != "hunter2" {
+		t.Fatalf("Expected the cached item. Got %+v, %v.", item, err)
+	}
+
+	item.Title = "GitHub Enterprise"
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	if item, err = v.Item(uuidA1); err != nil || item.Title != "GitHub Enterprise" {
+		t.Errorf("Expected the saved item. Got %+v, %v.", item, err)
+	}
+
+	// Saves within the same second give the record the same version, so
+	// only evicting on save keeps the earlier plaintext from being read
+	v.versions = 5
+	for _, title := range []string{"GitHub", "GitHub Enterprise Server"} {
+		item.Title = title
+		if err = v.SaveItem(item); err != nil {
+			t.Fatalf("Failed saving item: %s", err)
+		}
+		if item, err = v.Item(uuidA1); err != nil || item.Title != title {
+			t.Fatalf("Expected the item saved as %q. Got %+v, %v.", title, item, err)
+		}
+	}
+
+	// Earlier versions are decrypted without the cache
+	if versions, err := v.Versions(uuidA1); err != nil || len(versions) == 0 {
+		t.Fatalf("Expected earlier versions. Got %v, %v.", versions, err)
+	}
+	if e := v.cache.byKey[cacheKey{"overview", uuidA1}]; e == nil {
+		t.Errorf("Expected the current overview still cached")
+	}
+	if item, err = v.Item(uuidA1); err != nil || item.Title != "GitHub Enterprise Server" {
+		t.Errorf("Expected the current version. Got %+v, %v.", item, err)
+	}
+
+	v.Close()
+	if v.cache.entries.Len() != 0 || v.cache.size != 0 {
+		t.Errorf("Expected the cache purged on close")
+	}
+}
@@ -0,0 +1,133 @@
+package onepassword
+
+import "strings"
+
+// A FieldValue is a single named value from an item's details.
+type FieldValue struct {
+	Section   string // Title of the enclosing section; "" for login fields
+	Id        string // Identifier used by the apps, e.g. "username"
+	Name      string // Label shown to the user
+	Kind      string // Field kind or login field type
+	Value     string
+	Concealed bool // Whether the apps hide the value by default
+}
+
+// Fields returns the non-empty fields of the item in the order the apps show
+// them: login form fields, the password of a Password item, then each
+// section's fields. Notes are available separately from Notes.
+func (i *Item) Fields() []FieldValue {
+	return i.fields(false)
+}
+
+func (i *Item) fields(empty bool) []FieldValue {
+	d := i.credentials()
+	var fields []FieldValue
+	for _, f := range d.Fields {
+		if f.Value == "" && !empty {
+			continue
+		}
+		id := f.Designation
+		if id == "" {
+			id = f.Name
+		}
+		fields = append(fields, FieldValue{
+			Id:        id,
+			Name:      f.Name,
+			Kind:      f.Type,
+			Value:     f.Value,
+			Concealed: f.Type == "P",
+		})
+	}
+	if d.Password != "" || (empty && i.Category.Uuid == CatPassword.Uuid) {
+		fields = append(fields, FieldValue{
+			Id:        "password",
+			Name:      "password",
+			Kind:      KindConcealed,
+			Value:     d.Password,
+			Concealed: true,
+		})
+	}
+	for _, s := range d.Sections {
+		title := s.Title
+		if title == "" {
+			title = s.Name
+		}
+		for _, f := range s.Fields {
+			if f.Value == "" && !empty {
+				continue
+			}
+			fields = append(fields, FieldValue{
+				Section:   title,
+				Id:        f.Id,
+				Name:      f.Name,
+				Kind:      f.Kind,
+				Value:     f.Value,
+				Concealed: f.Kind == KindConcealed,
+			})
+		}
+	}
+	return fields
+}
+
+// Notes returns the item's notes, or "" if it has none.
+func (i *Item) Notes() string {
+	return i.credentials().Description
+}
+
+// Field returns the value of the named field. The names "title", "uuid",
+// and "url" return those parts of the overview. The names "username",
+// "password", "notes", and "totp" find those values wherever the item's
+// category stores them; any other name is matched against the label and
+// then the identifier of each field. A name of the form "section.field"
+// only matches fields in the section with that title. Matching ignores case.
+func (i *Item) Field(name string) (string, bool) {
+	var value string
+	switch strings.ToLower(name) {
+	case "title":
+		return i.Title, true
+	case "uuid":
+		return i.Uuid, true
+	case "url", "website":
+		value = i.Url
+	case "username":
+		value = i.Username()
+	case "password":
+		value = i.Password()
+	case "notes", "notesplain":
+		value = i.Notes()
+	case "totp", "one-time password":
+		value = i.TOTP()
+	}
+	if value != "" {
+		return value, true
+	}
+
+	fields := i.Fields()
+	if v, ok := matchField(fields, "", name); ok {
+		return v, true
+	}
+	if dot := strings.IndexByte(name, '.'); dot > 0 {
+		return matchField(fields, name[:dot], name[dot+1:])
+	}
+	return "", false
+}
+
+// matchField finds a field by label, then by identifier, optionally
+// restricted to a section.
+func matchField(fields []FieldValue, section, name string) (string, bool) {
+	for _, byId := range []bool{false, true} {
+		for _, f := range fields {
+			if section != "" && !strings.EqualFold(f.Section, section) {
+				continue
+			}
+			key := f.Name
+			if byId {
+				key = f.Id
+			}
+			if strings.EqualFold(key, name) {
+				return f.Value, true
+			}
+		}
+	}
+	return "", false
+}
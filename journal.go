@@ -0,0 +1,163 @@
+package onepassword
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// journalFile names the journal in an OPVault profile directory, where it
+// syncs with the vault. 1Password ignores files it doesn't know. Other
+// formats keep the journal in a sidecar of the same name.
+const journalFile = "journal.log"
+
+// A JournalEntry records a change made to a vault through this package.
+// Values are never recorded, only the names of the fields that changed.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`    // As user@host
+	Program  string    `json:"program"` // The name of the program that made the change
+	Action   string    `json:"action"`  // ItemAdded or ItemModified
+	Uuid     string    `json:"uuid"`
+	Title    string    `json:"title"`
+	Category string    `json:"category"`
+	Fields   []string  `json:"fields,omitempty"` // Changed, named as by Diff
+}
+
+// A HistoryQuery selects journal entries. Empty fields match every entry.
+type HistoryQuery struct {
+	Uuid  string
+	User  string
+	Since time.Time
+}
+
+func (q *HistoryQuery) match(e *JournalEntry) bool {
+	return (q.Uuid == "" || e.Uuid == q.Uuid) &&
+		(q.User == "" || e.User == q.User) &&
+		!e.Time.Before(q.Since)
+}
+
+// History returns the journal entries matching q, oldest first. The
+// journal is appended to by SaveItem, each entry encrypted with the
+// overview key, so it records who changed what and when for every change
+// made through this package, though not changes made by 1Password itself.
+// Entries that can't be read, such as those written before the master
+// password changed, are skipped.
+func (v *Vault) History(q HistoryQuery) ([]JournalEntry, error) {
+	data, err := v.readJournal()
+	if err != nil {
+		return nil, err
+	}
+	var entries []JournalEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		opdata, err := base64.StdEncoding.DecodeString(sc.Text())
+		if err != nil {
+			continue
+		}
+		plain, err := crypto.DecryptOPData01(opdata, v.overviewKP)
+		if err != nil {
+			continue
+		}
+		var e JournalEntry
+		if json.Unmarshal(plain, &e) == nil && q.match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	// Entries appended by several computers can arrive out of order
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, sc.Err()
+}
+
+// journalSave records that SaveItem saved item, replacing old if it isn't
+// nil.
+func (v *Vault) journalSave(item, old *Item, at time.Time) error {
+	e := &JournalEntry{
+		Time:     at,
+		User:     journalUser(),
+		Program:  filepath.Base(os.Args[0]),
+		Action:   ItemAdded,
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Category: item.Category.Name,
+	}
+	if old != nil {
+		e.Action = ItemModified
+		cur := *item
+		if cur.Details == nil {
+			cur.Details = old.Details
+		}
+		for _, c := range diffItems(old, &cur) {
+			e.Fields = append(e.Fields, c.Field)
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	opdata, err := crypto.EncryptOPData01(data, v.overviewKP)
+	if err != nil {
+		return err
+	}
+	line := []byte(base64.StdEncoding.EncodeToString(opdata) + "\n")
+	if st, ok := v.store.(*opvaultStore); ok {
+		return st.appendToFile(journalFile, line)
+	}
+	return appendFile(v.sidecarPath(journalFile), line)
+}
+
+func (v *Vault) readJournal() ([]byte, error) {
+	var data []byte
+	var err error
+	if st, ok := v.store.(*opvaultStore); ok {
+		data, err = fs.ReadFile(st.fsys, path.Join(st.dir, journalFile))
+	} else {
+		data, err = ioutil.ReadFile(v.sidecarPath(journalFile))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// journalUser returns the current user as user@host.
+func journalUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
+}
+
+// appendFile adds data to the end of a file, creating it if need be. A
+// short write in append mode is atomic, so concurrent writers' lines
+// aren't interleaved.
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,380 @@
+package onepassword
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoMatch is returned when a path selects nothing in an item's details.
+var ErrNoMatch = errors.New("path matches nothing")
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+// A pathStep is one component of a compiled path.
+type pathStep struct {
+	kind  stepKind
+	key   string
+	index int
+	cond  *pathCond
+}
+
+// A pathCond is a filter such as [?(@.t=="port")]. Without an operator the
+// filter tests for the presence of the field.
+type pathCond struct {
+	field []string
+	op    string // "", "==", or "!="
+	value interface{}
+}
+
+// Get evaluates a JSONPath expression against the item's details and
+// returns the selected value. Supported syntax covers child access by name
+// (".fields" or "['fields']"), array indices ("[0]", "[-1]"), wildcards
+// ("[*]", ".*"), and filters comparing a field of each element to a literal
+// ("[?(@.t==\"port\")]", "[?(@.a.generate!='off')]", "[?(@.v)]"). The
+// leading "$." is optional, so these are equivalent:
+//
+//	$.sections[0].fields[?(@.t=="port")].v
+//	sections[0].fields[?(@.t=="port")].v
+//
+// Paths without wildcards or filters return a single value. Other paths
+// return a []interface{} holding every match. Objects decode to
+// map[string]interface{} and numbers to json.Number.
+func (i *Item) Get(path string) (interface{}, error) {
+	steps, err := compilePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(i.Details))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{root}
+	definite := true
+	for _, s := range steps {
+		nodes = s.apply(nodes)
+		if s.kind == stepWildcard || s.kind == stepFilter {
+			definite = false
+		}
+	}
+
+	if !definite {
+		if nodes == nil {
+			nodes = []interface{}{}
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNoMatch
+	}
+	return nodes[0], nil
+}
+
+// GetString evaluates a path like Get and formats the result as text.
+// Strings and numbers are returned as is, a path matching exactly one value
+// returns that value, and anything else is encoded as JSON.
+func (i *Item) GetString(path string) (string, error) {
+	v, err := i.Get(path)
+	if err != nil {
+		return "", err
+	}
+	if list, ok := v.([]interface{}); ok {
+		switch len(list) {
+		case 0:
+			return "", ErrNoMatch
+		case 1:
+			v = list[0]
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+func (s pathStep) apply(nodes []interface{}) []interface{} {
+	var out []interface{}
+	for _, n := range nodes {
+		switch s.kind {
+		case stepKey:
+			if m, ok := n.(map[string]interface{}); ok {
+				if v, ok := m[s.key]; ok {
+					out = append(out, v)
+				}
+			}
+		case stepIndex:
+			if a, ok := n.([]interface{}); ok {
+				idx := s.index
+				if idx < 0 {
+					idx += len(a)
+				}
+				if idx >= 0 && idx < len(a) {
+					out = append(out, a[idx])
+				}
+			}
+		case stepWildcard, stepFilter:
+			for _, child := range children(n) {
+				if s.kind == stepWildcard || s.cond.match(child) {
+					out = append(out, child)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// children returns the elements of an array or the values of an object in
+// key order.
+func children(n interface{}) []interface{} {
+	switch n := n.(type) {
+	case []interface{}:
+		return n
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = n[k]
+		}
+		return out
+	}
+	return nil
+}
+
+func (c *pathCond) match(n interface{}) bool {
+	for _, key := range c.field {
+		m, ok := n.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if n, ok = m[key]; !ok {
+			return false
+		}
+	}
+
+	switch c.op {
+	case "==":
+		return valuesEqual(n, c.value)
+	case "!=":
+		return !valuesEqual(n, c.value)
+	}
+	return true
+}
+
+func valuesEqual(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+	return a == b
+}
+
+// compilePath parses a path expression into steps.
+func compilePath(path string) ([]pathStep, error) {
+	p := &pathParser{s: path}
+	if strings.HasPrefix(p.s, "$") {
+		p.pos = 1
+	} else if p.s != "" && p.s[0] != '.' && p.s[0] != '[' {
+		// Allow a leading bare name
+		p.s = "." + p.s
+	}
+
+	var steps []pathStep
+	for p.pos < len(p.s) {
+		step, err := p.step()
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %s", path, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+type pathParser struct {
+	s   string
+	pos int
+}
+
+func (p *pathParser) step() (pathStep, error) {
+	switch p.s[p.pos] {
+	case '.':
+		p.pos++
+		if p.peek('.') {
+			return pathStep{}, errors.New("recursive descent is not supported")
+		}
+		if p.peek('*') {
+			p.pos++
+			return pathStep{kind: stepWildcard}, nil
+		}
+		name := p.ident()
+		if name == "" {
+			return pathStep{}, fmt.Errorf("expected name at offset %d", p.pos)
+		}
+		return pathStep{kind: stepKey, key: name}, nil
+	case '[':
+		p.pos++
+		step, err := p.bracket()
+		if err != nil {
+			return pathStep{}, err
+		}
+		if !p.peek(']') {
+			return pathStep{}, fmt.Errorf("expected ']' at offset %d", p.pos)
+		}
+		p.pos++
+		return step, nil
+	}
+	return pathStep{}, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+}
+
+func (p *pathParser) bracket() (pathStep, error) {
+	switch {
+	case p.peek('*'):
+		p.pos++
+		return pathStep{kind: stepWildcard}, nil
+	case p.peek('\'') || p.peek('"'):
+		key, err := p.quoted()
+		return pathStep{kind: stepKey, key: key}, err
+	case p.peek('?'):
+		cond, err := p.filter()
+		return pathStep{kind: stepFilter, cond: cond}, err
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ']' {
+		p.pos++
+	}
+	idx, err := strconv.Atoi(strings.TrimSpace(p.s[start:p.pos]))
+	if err != nil {
+		return pathStep{}, fmt.Errorf("invalid index %q", p.s[start:p.pos])
+	}
+	return pathStep{kind: stepIndex, index: idx}, nil
+}
+
+// filter parses ?(@.field op literal)
+func (p *pathParser) filter() (*pathCond, error) {
+	if !strings.HasPrefix(p.s[p.pos:], "?(@") {
+		return nil, fmt.Errorf("expected '?(@' at offset %d", p.pos)
+	}
+	p.pos += 3
+
+	cond := &pathCond{}
+	for p.peek('.') {
+		p.pos++
+		name := p.ident()
+		if name == "" {
+			return nil, fmt.Errorf("expected name at offset %d", p.pos)
+		}
+		cond.field = append(cond.field, name)
+	}
+
+	p.skipSpace()
+	for _, op := range []string{"==", "!="} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			cond.op = op
+			p.pos += len(op)
+			p.skipSpace()
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			cond.value = v
+			p.skipSpace()
+			break
+		}
+	}
+
+	if !p.peek(')') {
+		return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+	}
+	p.pos++
+	return cond, nil
+}
+
+func (p *pathParser) literal() (interface{}, error) {
+	if p.peek('\'') || p.peek('"') {
+		return p.quoted()
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(") ", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	lit := p.s[start:p.pos]
+	switch lit {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if _, err := strconv.ParseFloat(lit, 64); err != nil {
+		return nil, fmt.Errorf("invalid literal %q", lit)
+	}
+	return json.Number(lit), nil
+}
+
+func (p *pathParser) quoted() (string, error) {
+	q := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.s):
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		case c == q:
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+func (p *pathParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(".[]()=! ", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *pathParser) peek(c byte) bool {
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+func (p *pathParser) skipSpace() {
+	for p.peek(' ') {
+		p.pos++
+	}
+}
@@ -0,0 +1,42 @@
+package onepassword
+
+import "testing"
+
+const databaseDetails = `{"notesPlain":"","sections":[{"name":"","title":"","fields":[{"k":"string","n":"hostname","t":"server","v":"db.example.com"},{"k":"string","n":"port","t":"port","v":"5432"},{"k":"concealed","n":"password","t":"password","v":"s3cret","a":{"generate":"off"}}]}]}`
+
+func TestItemGet(t *testing.T) {
+	item := Item{Category: CatDatabase, Details: []byte(databaseDetails)}
+	cases := map[string]string{
+		`sections[0].fields[?(@.t=="port")].v`:         "5432",
+		`$.sections[0].fields[1].v`:                    "5432",
+		`$['sections'][0]['fields'][-1].v`:             "s3cret",
+		`sections[*].fields[?(@.a.generate=='off')].n`: "password",
+		`sections[0].fields[?(@.k!="string")].v`:       "s3cret",
+		`sections[0].fields[?(@.a)].t`:                 "password",
+		`sections[0].fields[?(@.n=="hostname")]`:       `{"k":"string","n":"hostname","t":"server","v":"db.example.com"}`,
+		`sections[0].fields[?(@.k=="string")].n`:       `["hostname","port"]`,
+	}
+	for path, expected := range cases {
+		got, err := item.GetString(path)
+		if err != nil {
+			t.Fatalf("Failed evaluating %s: %s", path, err)
+		} else if got != expected {
+			t.Fatalf("%s: expected %q. Got %q.", path, expected, got)
+		}
+	}
+}
+
+func TestItemGetErrors(t *testing.T) {
+	item := Item{Category: CatDatabase, Details: []byte(databaseDetails)}
+	if _, err := item.GetString("sections[3].fields"); err != ErrNoMatch {
+		t.Fatalf("Expected ErrNoMatch. Got %v.", err)
+	}
+	if _, err := item.GetString(`sections[*].fields[?(@.t=="nope")].v`); err != ErrNoMatch {
+		t.Fatalf("Expected ErrNoMatch. Got %v.", err)
+	}
+	for _, path := range []string{"sections[x]", "$..v", `fields[?(@.t=="a)]`, "sections[0"} {
+		if _, err := item.Get(path); err == nil {
+			t.Fatalf("Expected error evaluating %s", path)
+		}
+	}
+}
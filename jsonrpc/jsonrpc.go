@@ -0,0 +1,316 @@
+// Package jsonrpc serves a vault with JSON-RPC 2.0 over a stream such as a
+// process's standard input and output, so programs in other languages,
+// like Ansible lookup plugins, can keep one unlocked vault open rather than
+// running opvault for every secret. Each request, or batch of requests, is
+// a line of JSON, and is answered with a line:
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "get", "params": {"query": "github", "field": "password"}}
+//	{"jsonrpc": "2.0", "id": 1, "result": "..."}
+//
+// The methods take their parameters by name:
+//
+//	list     {"filter": expr}                 items matching a filter expression
+//	search   {"query": q}                     items matching a search, best first
+//	get      {"query": q | "uuid": u}         an item with its fields and notes
+//	get      {"query": q, "field": name}      a field's value
+//	resolve  {"ref": "opvault://..."}         the secret a reference names
+//	totp     {"query": q | "uuid": u}         the current one-time password
+//
+// Items, lists of items, and one-time passwords have the JSON forms of the
+// restapi package; lists leave out fields and notes. Items are found as
+// onepassword.Vault.FindItem finds them, and fields as Item.Field names
+// them.
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/restapi"
+)
+
+// The error codes of JSON-RPC 2.0, and those for failures to find an item.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+
+	ItemNotFound  = -32001
+	AmbiguousItem = -32002
+)
+
+// A Source is what the server serves; *onepassword.Vault is one.
+type Source interface {
+	Filter(expr string) ([]onepassword.Item, error)
+	Search(query string) ([]onepassword.SearchResult, error)
+	Item(uuid string) (*onepassword.Item, error)
+	FindItem(query string) (*onepassword.Item, error)
+	Resolve(ref string) (string, error)
+}
+
+// A Request is a call of a method. Requests without an id are
+// notifications, which aren't answered.
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// A Response answers a Request with its result or an error.
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// An Error is a failed call.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorf(code int, format string, args ...interface{}) *Error {
+	return &Error{code, fmt.Sprintf(format, args...)}
+}
+
+// params holds every method's parameters.
+type params struct {
+	Filter string `json:"filter"`
+	Query  string `json:"query"`
+	Uuid   string `json:"uuid"`
+	Field  string `json:"field"`
+	Ref    string `json:"ref"`
+}
+
+// A Server answers requests from Vault.
+type Server struct {
+	Vault Source
+}
+
+// Serve answers the requests read from r on w until r is closed. Requests
+// are answered one at a time, in order.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	return s.ServeContext(context.Background(), r, w)
+}
+
+// ServeContext is Serve, with the requests answered within ctx: once it's
+// done, requests still being answered fail.
+func (s *Server) ServeContext(ctx context.Context, r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if resp := s.handleLine(ctx, line); resp != nil {
+				data, merr := json.Marshal(resp)
+				if merr != nil {
+					return merr
+				}
+				if _, werr := w.Write(append(data, '\n')); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handleLine answers a request or batch, returning nil if nothing is to be
+// written.
+func (s *Server) handleLine(ctx context.Context, line []byte) interface{} {
+	line = bytes.TrimSpace(line)
+	if line[0] != '[' {
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return failure(nil, errorf(ParseError, "%s", err))
+		}
+		if resp := s.handle(ctx, &req); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return failure(nil, errorf(ParseError, "%s", err))
+	}
+	if len(batch) == 0 {
+		return failure(nil, errorf(InvalidRequest, "empty batch"))
+	}
+	resps := []*Response{}
+	for _, raw := range batch {
+		var req Request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			resps = append(resps, failure(nil, errorf(InvalidRequest, "%s", err)))
+			continue
+		}
+		if resp := s.handle(ctx, &req); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		// A batch of notifications isn't answered
+		return nil
+	}
+	return resps
+}
+
+func failure(id json.RawMessage, err *Error) *Response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &Response{Version: "2.0", Id: id, Error: err}
+}
+
+// handle answers a request, returning nil for notifications.
+func (s *Server) handle(ctx context.Context, req *Request) *Response {
+	if req.Version != "2.0" || req.Method == "" {
+		return failure(req.Id, errorf(InvalidRequest, "not a JSON-RPC 2.0 request"))
+	}
+	result, err := s.call(ctx, req.Method, req.Params)
+	if req.Id == nil {
+		return nil
+	}
+	if err != nil {
+		return failure(req.Id, err)
+	}
+	return &Response{Version: "2.0", Id: req.Id, Result: result}
+}
+
+func (s *Server) call(ctx context.Context, method string, raw json.RawMessage) (interface{}, *Error) {
+	var p params
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, errorf(InvalidParams, "params must be an object of named parameters")
+		}
+	}
+
+	switch method {
+	case "list":
+		if _, err := onepassword.ParseFilter(p.Filter); err != nil {
+			return nil, errorf(InvalidParams, "%s", err)
+		}
+		items, err := s.filter(ctx, p.Filter)
+		if err != nil {
+			return nil, vaultError(err)
+		}
+		list := []restapi.Item{}
+		for i := range items {
+			list = append(list, restapi.NewItem(&items[i], false))
+		}
+		return list, nil
+	case "search":
+		if p.Query == "" {
+			return nil, errorf(InvalidParams, "no query")
+		}
+		results, err := s.search(ctx, p.Query)
+		if err != nil {
+			return nil, vaultError(err)
+		}
+		list := []restapi.Item{}
+		for i := range results {
+			list = append(list, restapi.NewItem(&results[i].Item, false))
+		}
+		return list, nil
+	case "get":
+		item, err := s.item(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Field == "" {
+			return restapi.NewItem(item, true), nil
+		}
+		value, ok := item.Field(p.Field)
+		if !ok {
+			return nil, errorf(InvalidParams, "%s has no field %q", item.Title, p.Field)
+		}
+		return value, nil
+	case "resolve":
+		if _, err := onepassword.ParseSecretRef(p.Ref); err != nil {
+			return nil, errorf(InvalidParams, "%s", err)
+		}
+		value, err := s.Vault.Resolve(p.Ref)
+		if err != nil {
+			return nil, vaultError(err)
+		}
+		return value, nil
+	case "totp":
+		item, err := s.item(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		code, remaining, terr := item.TOTPCode(time.Now())
+		if terr != nil {
+			return nil, errorf(InvalidParams, "%s", terr)
+		}
+		return restapi.TOTP{Code: code, Remaining: int(remaining / time.Second)}, nil
+	}
+	return nil, errorf(MethodNotFound, "unknown method %q", method)
+}
+
+// item returns the item named by p's uuid or query.
+func (s *Server) item(ctx context.Context, p *params) (*onepassword.Item, *Error) {
+	var item *onepassword.Item
+	var err error
+	switch {
+	case p.Uuid != "":
+		item, err = s.Vault.Item(p.Uuid)
+	case p.Query != "":
+		item, err = s.findItem(ctx, p.Query)
+	default:
+		return nil, errorf(InvalidParams, "no uuid or query")
+	}
+	if err != nil {
+		return nil, vaultError(err)
+	}
+	return item, nil
+}
+
+func (s *Server) filter(ctx context.Context, expr string) ([]onepassword.Item, error) {
+	if cs, ok := s.Vault.(onepassword.ContextSource); ok {
+		return cs.FilterContext(ctx, expr)
+	}
+	return s.Vault.Filter(expr)
+}
+
+func (s *Server) search(ctx context.Context, query string) ([]onepassword.SearchResult, error) {
+	if cs, ok := s.Vault.(onepassword.ContextSource); ok {
+		return cs.SearchContext(ctx, query)
+	}
+	return s.Vault.Search(query)
+}
+
+func (s *Server) findItem(ctx context.Context, query string) (*onepassword.Item, error) {
+	if cs, ok := s.Vault.(onepassword.ContextSource); ok {
+		return cs.FindItemContext(ctx, query)
+	}
+	return s.Vault.FindItem(query)
+}
+
+// vaultError converts errors from the vault to JSON-RPC errors.
+func vaultError(err error) *Error {
+	if _, ok := err.(*onepassword.AmbiguousQueryError); ok {
+		return errorf(AmbiguousItem, "%s", err)
+	}
+	if err == onepassword.ErrItemNotFound {
+		return errorf(ItemNotFound, "%s", err)
+	}
+	return errorf(InternalError, "%s", err)
+}
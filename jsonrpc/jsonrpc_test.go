@@ -0,0 +1,86 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// fakeVault holds Logins in memory.
+type fakeVault struct {
+	items []onepassword.Item
+}
+
+func (v *fakeVault) Filter(expr string) ([]onepassword.Item, error) {
+	return v.items, nil
+}
+
+func (v *fakeVault) Search(query string) ([]onepassword.SearchResult, error) {
+	return nil, nil
+}
+
+func (v *fakeVault) Item(uuid string) (*onepassword.Item, error) {
+	for i := range v.items {
+		if v.items[i].Uuid == uuid {
+			return &v.items[i], nil
+		}
+	}
+	return nil, onepassword.ErrItemNotFound
+}
+
+func (v *fakeVault) FindItem(query string) (*onepassword.Item, error) {
+	for i := range v.items {
+		if v.items[i].Title == query {
+			return &v.items[i], nil
+		}
+	}
+	return nil, &onepassword.AmbiguousQueryError{Query: query, Matches: v.items}
+}
+
+func (v *fakeVault) Resolve(ref string) (string, error) {
+	return "", fmt.Errorf("no item for %s", ref)
+}
+
+func TestServe(t *testing.T) {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title = "A1", "GitHub"
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Vault: &fakeVault{[]onepassword.Item{*item}}}
+
+	requests := []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "get", "params": {"query": "GitHub", "field": "password"}}`,
+		`{"jsonrpc": "2.0", "id": "a", "method": "get", "params": {"uuid": "B2"}}`,
+		`{"jsonrpc": "2.0", "method": "get", "params": {"query": "GitHub"}}`,
+		`[{"jsonrpc": "2.0", "id": 2, "method": "nope"}, {"jsonrpc": "2.0", "id": 3, "method": "get", "params": ["GitHub"]}]`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "totp", "params": {"query": "Git"}}`,
+		`{`,
+	}
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"result":"hunter2"}`,
+		`{"jsonrpc":"2.0","id":"a","error":{"code":-32001,"message":"item not found"}}`,
+		`[{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"unknown method \"nope\""}},{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"params must be an object of named parameters"}}]`,
+		`{"jsonrpc":"2.0","id":4,"error":{"code":-32002,`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,`,
+	}
+	var out bytes.Buffer
+	if err := s.Serve(strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d responses. Got %q.", len(want), got)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("Expected response %d to start %s. Got %s.", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package onepassword
+
+import (
+	"errors"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// A KeyCache keeps keys derived from master passwords, found by the salt
+// and number of iterations they were derived with, which change whenever
+// the master password does. Package keycache keeps them in files.
+type KeyCache interface {
+	// Get returns the keys derived with salt and iterations, or nil if
+	// there are none.
+	Get(salt []byte, iterations int) (*crypto.KeyPair, error)
+	// Put saves the keys derived with salt and iterations.
+	Put(salt []byte, iterations int, kp *crypto.KeyPair) error
+}
+
+// ErrKeysNotCached is returned by NewVaultWithCachedKeys when
+// cfg.KeyCache doesn't have keys that unlock the vault.
+var ErrKeysNotCached = errors.New("no cached keys unlock the vault")
+
+// NewVaultWithCachedKeys unlocks a vault with keys that NewVault saved in
+// cfg.KeyCache, skipping the derivation from the master password.
+func NewVaultWithCachedKeys(cfg VaultConfig) (*Vault, error) {
+	if cfg.KeyCache == nil {
+		return nil, ErrKeysNotCached
+	}
+	return openVault(cfg, func(st store) (*Vault, error) {
+		prof, err := st.profile()
+		if err != nil {
+			return nil, err
+		}
+		kp, err := cfg.KeyCache.Get(prof.Salt, prof.Iterations)
+		if err != nil {
+			return nil, err
+		} else if kp == nil {
+			return nil, ErrKeysNotCached
+		}
+		v, err := newVaultWithKeys(kp, st)
+		if err == ErrWrongPassword {
+			return nil, ErrKeysNotCached
+		}
+		return v, err
+	})
+}
+
+// cacheKeys saves the keys derived for the profile held by a store. Keys
+// that can't be saved are only derived again next time, so errors are
+// ignored.
+func cacheKeys(c KeyCache, st store, derKP *crypto.KeyPair) {
+	if prof, err := st.profile(); err == nil {
+		c.Put(prof.Salt, prof.Iterations, derKP)
+	}
+}
@@ -0,0 +1,176 @@
+// Package keycache keeps the keys derived from master passwords in files,
+// so that commands run one after another needn't each spend the hundreds
+// of milliseconds PBKDF2 takes, without an agent to hold them. The files
+// are sealed with a key they don't hold: either one kept in the OS
+// keystore, as by package sessionstore, or a session key, such as random
+// text in an environment variable of the user's shell.
+//
+// Keys are found by the salt and iterations they were derived with, which
+// change whenever the master password does. Clear removes them all.
+package keycache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+// sealName is the name the sealing key is saved under in a
+// sessionstore.Store.
+const sealName = "keycache"
+
+// A Cache keeps derived keys in the files of a directory.
+type Cache struct {
+	dir string
+
+	// seal returns the key the files are sealed with, or nil if there's
+	// none yet and create is false
+	seal func(create bool) (*crypto.KeyPair, error)
+
+	// forget makes the sealing key unavailable, or is nil if it can't be
+	forget func() error
+}
+
+// DefaultDir returns where service, such as "opvault", keeps its cache in
+// the user's cache directory.
+func DefaultDir(service string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, service, "keys"), nil
+}
+
+// New returns a cache in dir sealed with a random key saved in store,
+// which is made when keys are first put.
+func New(dir string, store sessionstore.Store) *Cache {
+	seal := func(create bool) (*crypto.KeyPair, error) {
+		key, err := store.Load(sealName)
+		if err == nil && len(key) != 64 {
+			// Saved by something else, or truncated; replaced like a
+			// missing key, so nothing sealed with it can be read
+			err = sessionstore.ErrNotFound
+		}
+		if err == sessionstore.ErrNotFound {
+			if !create {
+				return nil, nil
+			}
+			key = make([]byte, 64)
+			if _, err = rand.Read(key); err != nil {
+				return nil, err
+			}
+			err = store.Save(sealName, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sealKeys(key), nil
+	}
+	forget := func() error {
+		return store.Delete(sealName)
+	}
+	return &Cache{dir, seal, forget}
+}
+
+// WithSessionKey returns a cache in dir sealed with keys derived from
+// sessionKey. A session key of any length can be used, but it should be
+// as hard to guess as a key, since it's hashed once rather than stretched.
+func WithSessionKey(dir string, sessionKey []byte) *Cache {
+	sum := sha512.Sum512(sessionKey)
+	kp := sealKeys(sum[:])
+	return &Cache{dir: dir, seal: func(bool) (*crypto.KeyPair, error) { return kp, nil }}
+}
+
+func sealKeys(key []byte) *crypto.KeyPair {
+	return &crypto.KeyPair{EncKey: key[:32], MACKey: key[32:64]}
+}
+
+// file returns the name of the file holding the keys derived with salt
+// and iterations.
+func (c *Cache) file(salt []byte, iterations int) string {
+	h := sha256.New()
+	h.Write(salt)
+	binary.Write(h, binary.BigEndian, uint64(iterations))
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil)))
+}
+
+// Get returns the keys derived with salt and iterations, or nil if there
+// are none or they were sealed with a key that's since been forgotten or
+// replaced.
+func (c *Cache) Get(salt []byte, iterations int) (*crypto.KeyPair, error) {
+	sealed, err := ioutil.ReadFile(c.file(salt, iterations))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	skp, err := c.seal(false)
+	if skp == nil || err != nil {
+		return nil, err
+	}
+	plain, err := crypto.DecryptOPData01(sealed, skp)
+	if err == crypto.ErrIncorrectMAC {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(plain) != 64 {
+		return nil, nil
+	}
+	return &crypto.KeyPair{EncKey: plain[:32], MACKey: plain[32:]}, nil
+}
+
+// Put saves the keys derived with salt and iterations, replacing any
+// saved before.
+func (c *Cache) Put(salt []byte, iterations int, kp *crypto.KeyPair) error {
+	skp, err := c.seal(true)
+	if err != nil {
+		return err
+	}
+	plain := append(append(make([]byte, 0, 64), kp.EncKey...), kp.MACKey...)
+	sealed, err := crypto.EncryptOPData01(plain, skp)
+	for i := range plain {
+		plain[i] = 0
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+
+	// Written beside its name and renamed, so Get never reads half a file
+	f, err := ioutil.TempFile(c.dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(sealed); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.file(salt, iterations))
+}
+
+// Clear removes every key in the cache, and forgets the sealing key if
+// it's kept in the OS keystore.
+func (c *Cache) Clear() error {
+	err := os.RemoveAll(c.dir)
+	if c.forget != nil {
+		if ferr := c.forget(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package keycache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/sessionstore"
+)
+
+// memStore is a sessionstore.Store kept in memory.
+type memStore map[string][]byte
+
+func (m memStore) Save(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m memStore) Load(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, sessionstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memStore) Delete(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	store := memStore{}
+	c := New(dir, store)
+	salt := []byte("0123456789abcdef")
+	kp := &crypto.KeyPair{EncKey: bytes.Repeat([]byte{1}, 32), MACKey: bytes.Repeat([]byte{2}, 32)}
+
+	if got, err := c.Get(salt, 100000); got != nil || err != nil {
+		t.Fatalf("Expected nothing cached. Got %v, %v.", got, err)
+	}
+	if err := c.Put(salt, 100000, kp); err != nil {
+		t.Fatalf("Failed caching keys: %s", err)
+	}
+	got, err := c.Get(salt, 100000)
+	if err != nil || got == nil || !bytes.Equal(got.EncKey, kp.EncKey) || !bytes.Equal(got.MACKey, kp.MACKey) {
+		t.Fatalf("Expected the cached keys. Got %v, %v.", got, err)
+	}
+	if got, _ = c.Get(salt, 200000); got != nil {
+		t.Errorf("Expected nothing cached for other iterations")
+	}
+
+	// Keys sealed by another session's key can't be read
+	if got, err = WithSessionKey(dir, []byte("other")).Get(salt, 100000); got != nil || err != nil {
+		t.Errorf("Expected keys sealed with another key to be missing. Got %v, %v.", got, err)
+	}
+
+	if err = c.Clear(); err != nil {
+		t.Fatalf("Failed clearing: %s", err)
+	}
+	if got, _ = c.Get(salt, 100000); got != nil {
+		t.Errorf("Expected nothing cached after clearing")
+	}
+	if _, ok := store[sealName]; ok {
+		t.Errorf("Expected the sealing key forgotten")
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	dir := t.TempDir()
+	salt := []byte("salt")
+	kp := &crypto.KeyPair{EncKey: bytes.Repeat([]byte{3}, 32), MACKey: bytes.Repeat([]byte{4}, 32)}
+	if err := WithSessionKey(dir, []byte("session")).Put(salt, 1000, kp); err != nil {
+		t.Fatalf("Failed caching keys: %s", err)
+	}
+	got, err := WithSessionKey(dir, []byte("session")).Get(salt, 1000)
+	if err != nil || got == nil || !bytes.Equal(got.EncKey, kp.EncKey) {
+		t.Errorf("Expected the keys with the same session key. Got %v, %v.", got, err)
+	}
+}
+
+func TestBadSealKey(t *testing.T) {
+	dir := t.TempDir()
+	store := memStore{sealName: []byte("short")}
+	c := New(dir, store)
+	salt := []byte("salt")
+	kp := &crypto.KeyPair{EncKey: bytes.Repeat([]byte{5}, 32), MACKey: bytes.Repeat([]byte{6}, 32)}
+
+	if got, err := c.Get(salt, 1000); got != nil || err != nil {
+		t.Fatalf("Expected nothing cached. Got %v, %v.", got, err)
+	}
+	if err := c.Put(salt, 1000, kp); err != nil {
+		t.Fatalf("Failed caching keys: %s", err)
+	}
+	if len(store[sealName]) != 64 {
+		t.Fatalf("Expected the sealing key replaced. Got %d bytes.", len(store[sealName]))
+	}
+	if got, err := c.Get(salt, 1000); err != nil || got == nil || !bytes.Equal(got.MACKey, kp.MACKey) {
+		t.Errorf("Expected the cached keys. Got %v, %v.", got, err)
+	}
+}
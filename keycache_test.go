@@ -0,0 +1,44 @@
+package onepassword
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// mapKeyCache is a KeyCache kept in memory.
+type mapKeyCache map[string]*crypto.KeyPair
+
+func (m mapKeyCache) Get(salt []byte, iterations int) (*crypto.KeyPair, error) {
+	return m[fmt.Sprintf("%x/%d", salt, iterations)], nil
+}
+
+func (m mapKeyCache) Put(salt []byte, iterations int, kp *crypto.KeyPair) error {
+	m[fmt.Sprintf("%x/%d", salt, iterations)] = kp
+	return nil
+}
+
+func TestKeyCache(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	cfg := VaultConfig{DBPath: dir, Profile: "default", KeyCache: mapKeyCache{}}
+
+	if _, err := NewVaultWithCachedKeys(cfg); err != ErrKeysNotCached {
+		t.Fatalf("Expected ErrKeysNotCached before unlocking. Got %v.", err)
+	}
+	v, err := NewVault(testPassword, cfg)
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	v.Close()
+	if v, err = NewVaultWithCachedKeys(cfg); err != nil {
+		t.Fatalf("Failed unlocking with cached keys: %s", err)
+	}
+	defer v.Close()
+	if item, err := v.Item("A1"); err != nil || item.Password() != "hunter2" {
+		t.Errorf("Expected the item. Got %+v, %v.", item, err)
+	}
+}
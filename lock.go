@@ -0,0 +1,64 @@
+package onepassword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrBusy is returned when saving an item to a vault that another program
+// has been writing to for longer than LockTimeout.
+var ErrBusy = errors.New("vault is being written by another program")
+
+// LockTimeout is how long saving an item waits for other programs saving
+// items to the same vault to finish.
+var LockTimeout = 10 * time.Second
+
+// lockFile takes an exclusive advisory lock on the file at path, creating
+// it, so that programs writing the same vault take turns rather than
+// interleaving their rewrites of a band. While another program holds the
+// lock, taking it is retried with backoff until LockTimeout passes. The
+// holder is recorded in the file, to name it in the error if the wait
+// times out.
+func lockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(LockTimeout)
+	delay := 5 * time.Millisecond
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			holder := make([]byte, 256)
+			n, _ := f.ReadAt(holder, 0)
+			f.Close()
+			if h := strings.TrimSpace(string(holder[:n])); h != "" {
+				return nil, fmt.Errorf("%w (%s)", ErrBusy, h)
+			}
+			return nil, ErrBusy
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > 500*time.Millisecond {
+			delay = 500 * time.Millisecond
+		}
+	}
+
+	host, _ := os.Hostname()
+	f.Truncate(0)
+	f.WriteAt([]byte(fmt.Sprintf("pid %d on %s\n", os.Getpid(), host)), 0)
+	return func() {
+		f.Truncate(0)
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
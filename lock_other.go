@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package onepassword
+
+import "os"
+
+// Without file locks, as on js/wasm, writers aren't kept apart.
+func tryLock(f *os.File) (bool, error) { return true, nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,99 @@
+package onepassword
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.default.lock")
+	defer func(d time.Duration) { LockTimeout = d }(LockTimeout)
+	LockTimeout = 50 * time.Millisecond
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("Failed locking: %s", err)
+	}
+	_, err = lockFile(path)
+	if !errors.Is(err, ErrBusy) || !strings.Contains(err.Error(), fmt.Sprintf("pid %d", os.Getpid())) {
+		t.Fatalf("Expected the lock to be busy, naming its holder. Got %v.", err)
+	}
+
+	// Waiters get the lock once it's released
+	LockTimeout = 5 * time.Second
+	done := make(chan error)
+	go func() {
+		unlock, err := lockFile(path)
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	unlock()
+	if err = <-done; err != nil {
+		t.Fatalf("Failed locking after release: %s", err)
+	}
+}
+
+func TestSaveItemLocked(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	defer os.Remove(sidecarFile(dir, "default", "lock"))
+	v, err := NewVault(testPassword, VaultConfig{DBPath: dir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer v.Close()
+	defer func(d time.Duration) { LockTimeout = d }(LockTimeout)
+	LockTimeout = 50 * time.Millisecond
+
+	unlock, err := lockFile(sidecarFile(dir, "default", "lock"))
+	if err != nil {
+		t.Fatalf("Failed locking: %s", err)
+	}
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Title = "GitHub Enterprise"
+	if err = v.SaveItem(item); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Expected saving to a locked vault to fail. Got %v.", err)
+	}
+	unlock()
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving: %s", err)
+	}
+}
+
+func TestSaveItemRereads(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v := f.open()
+	v.versions = 1
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+
+	// Another program saves the item after it was read
+	f.band[uuidA1].Overview = mustEncrypt(t, []byte(`{"title":"GitHub Enterprise"}`), f.okp)
+	f.band[uuidA1].Updated = 1700000000
+	f.writeBand("A")
+
+	item.Title = "GitHub 2"
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	versions, err := v.Versions(uuidA1)
+	if err != nil || len(versions) != 1 || versions[0].Item.Title != "GitHub Enterprise" {
+		t.Fatalf("Expected the other program's version kept. Got %+v, %v.", versions, err)
+	}
+}
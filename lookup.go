@@ -0,0 +1,87 @@
+package onepassword
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// An AmbiguousQueryError is returned by FindItem when a query matches more
+// than one item.
+type AmbiguousQueryError struct {
+	Query   string
+	Matches []Item // Best matches first
+}
+
+func (e *AmbiguousQueryError) Error() string {
+	return fmt.Sprintf("%q matches %d items", e.Query, len(e.Matches))
+}
+
+// A ContextSource answers queries within a context, stopping with its
+// error once it's done; *Vault is one. The API servers take the vault as an
+// interface of their own and use these methods if it also has them, so
+// requests that are canceled stop.
+type ContextSource interface {
+	FilterContext(ctx context.Context, expr string) ([]Item, error)
+	SearchContext(ctx context.Context, query string) ([]SearchResult, error)
+	FindItemContext(ctx context.Context, query string) (*Item, error)
+}
+
+// FindItem returns the single item identified by query: an item uuid, an
+// exact title (ignoring case), or a search query matching only one item.
+// It returns ErrItemNotFound if nothing matches and an *AmbiguousQueryError
+// if several items do.
+func (v *Vault) FindItem(query string) (*Item, error) {
+	return v.FindItemContext(context.Background(), query)
+}
+
+// FindItemContext is FindItem, stopping with ctx's error once ctx is done.
+func (v *Vault) FindItemContext(ctx context.Context, query string) (*Item, error) {
+	item, err := v.Item(query)
+	if err != ErrItemNotFound {
+		return item, err
+	}
+
+	results, err := v.SearchContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var exact []SearchResult
+	for _, r := range results {
+		if strings.EqualFold(r.Item.Title, query) {
+			exact = append(exact, r)
+		}
+	}
+	if len(exact) > 0 {
+		results = exact
+	}
+
+	switch len(results) {
+	case 0:
+		return nil, ErrItemNotFound
+	case 1:
+		if v.metrics != nil {
+			v.metrics.ItemRead(results[0].Item.Category)
+		}
+		return &results[0].Item, nil
+	}
+	matches := make([]Item, len(results))
+	for i, r := range results {
+		matches[i] = r.Item
+	}
+	return nil, &AmbiguousQueryError{query, matches}
+}
+
+// Lookup returns the value of a field of the item identified by query. See
+// FindItem and Item.Field.
+func (v *Vault) Lookup(query, field string) (string, error) {
+	item, err := v.FindItem(query)
+	if err != nil {
+		return "", err
+	}
+	value, ok := item.Field(field)
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", item.Title, field)
+	}
+	return value, nil
+}
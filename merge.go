@@ -0,0 +1,226 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// A MergeConflict is an item whose contents differ between the vaults
+// being merged.
+type MergeConflict struct {
+	Dst, Src     *Item         // Decrypted, with details
+	DstTx, SrcTx int64         // Sync transactions of each version's last change
+	Changes      []FieldChange // From Dst to Src, as reported by Diff
+}
+
+// SrcNewer reports whether the source's version of the item is the more
+// recent, by sync transaction and then by modification time.
+func (c *MergeConflict) SrcNewer() bool {
+	if c.SrcTx != c.DstTx {
+		return c.SrcTx > c.DstTx
+	}
+	return c.Src.Updated.After(c.Dst.Updated)
+}
+
+// A MergeStrategy decides which version of a conflicting item a merge
+// keeps, returning true to replace the destination's with the source's.
+// Interactive strategies can show the user c.Changes and ask. An error
+// stops the merge.
+type MergeStrategy func(c *MergeConflict) (useSrc bool, err error)
+
+var (
+	// NewestWins keeps the version changed last, or the destination's if
+	// neither is newer.
+	NewestWins MergeStrategy = func(c *MergeConflict) (bool, error) { return c.SrcNewer(), nil }
+
+	// PreferDestination keeps the destination's version, so a merge only
+	// adds items.
+	PreferDestination MergeStrategy = func(*MergeConflict) (bool, error) { return false, nil }
+)
+
+// A MergeResult lists the uuids of the items a merge added or resolved.
+type MergeResult struct {
+	Added    []string `json:"added"`    // Copied from the source
+	Replaced []string `json:"replaced"` // The source's version was kept
+	Kept     []string `json:"kept"`     // The destination's version was kept
+	Merged   []string `json:"merged"`   // Combined field by field by MergeFields
+}
+
+// Merge copies the items of src into dst, matching them by uuid, so that
+// two copies of a vault that were changed separately can be reconciled.
+// Items only in src are added. Items in both whose contents differ are
+// resolved by strategy, and the losing version's password is added to the
+// winner's password history, along with any history only the loser has,
+// so no password is lost whichever version wins. Items agreeing on their
+// sync transaction and modification time aren't decrypted, as for Diff.
+//
+// Items in either vault's trash are left alone, as are attachments.
+// Items written to dst are saved as by SaveItem, so their modification
+// time is the time of the merge. On error, the result lists what was
+// merged before it.
+func Merge(dst, src *Vault, strategy MergeStrategy) (*MergeResult, error) {
+	return merge(dst, src, dst.SaveItem, func(c *MergeConflict, res *MergeResult) error {
+		useSrc, err := strategy(c)
+		if err != nil {
+			return err
+		}
+
+		winner, loser := c.Dst, c.Src
+		if useSrc {
+			winner, loser = c.Src, c.Dst
+		}
+		changed, err := mergePasswordHistory(winner, loser)
+		if err != nil {
+			return err
+		}
+		if useSrc || changed {
+			winner.Folder = c.Dst.Folder
+			if err = dst.SaveItem(winner); err != nil {
+				return err
+			}
+		}
+		if useSrc {
+			res.Replaced = append(res.Replaced, c.Src.Uuid)
+		} else {
+			res.Kept = append(res.Kept, c.Src.Uuid)
+		}
+		return nil
+	})
+}
+
+// MergeFields copies the items of src into dst as Merge does, but settles
+// items changed in both field by field rather than keeping one version
+// whole, so that edits to different fields of an item on different
+// computers all survive. The title, URL, tags, notes, and each detail
+// field are reconciled separately: items saved with
+// VaultConfig.FieldClocks set keep a vector clock for each field, and a
+// field changed after the other version's change was seen wins. Fields
+// changed concurrently, or without clocks, go to the version changed
+// last. The losing password is added to the password history.
+//
+// Merged items are saved with the clocks of both versions joined rather
+// than ticked, so later merges know what each copy has seen.
+func MergeFields(dst, src *Vault) (*MergeResult, error) {
+	add := func(item *Item) error { return dst.saveItem(item, false) }
+	return merge(dst, src, add, func(c *MergeConflict, res *MergeResult) error {
+		merged, changed, err := mergeFields(c.Dst, c.Src)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			res.Kept = append(res.Kept, c.Src.Uuid)
+			return nil
+		}
+		merged.Folder = c.Dst.Folder
+		if err = dst.saveItem(merged, false); err != nil {
+			return err
+		}
+		res.Merged = append(res.Merged, c.Src.Uuid)
+		return nil
+	})
+}
+
+// merge copies the items of src into dst as described for Merge, adding
+// items with add and settling conflicts with resolve.
+func merge(dst, src *Vault, add func(item *Item) error, resolve func(c *MergeConflict, res *MergeResult) error) (*MergeResult, error) {
+	dstRecs, err := dst.store.records()
+	if err != nil {
+		return nil, err
+	}
+	srcRecs, err := src.store.records()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := dst.store.trashed()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*record)
+	for _, r := range dstRecs {
+		existing[r.Uuid] = r
+	}
+	for _, r := range trashed {
+		existing[r.Uuid] = nil
+	}
+
+	res := &MergeResult{}
+	for _, sr := range srcRecs {
+		dr, ok := existing[sr.Uuid]
+		if ok && (dr == nil || dr.Tx == sr.Tx && dr.Updated == sr.Updated) {
+			continue
+		}
+		srcItem, err := src.decryptOverview(sr)
+		if err != nil {
+			return res, err
+		}
+		if err = src.decryptDetails(sr, srcItem); err != nil {
+			return res, err
+		}
+		if !ok {
+			// Folders aren't shared between vaults
+			srcItem.Folder = ""
+			if err = add(srcItem); err != nil {
+				return res, err
+			}
+			res.Added = append(res.Added, sr.Uuid)
+			continue
+		}
+
+		dstItem, err := dst.decryptOverview(dr)
+		if err != nil {
+			return res, err
+		}
+		if err = dst.decryptDetails(dr, dstItem); err != nil {
+			return res, err
+		}
+		changes := diffItems(dstItem, srcItem)
+		if len(changes) == 0 {
+			continue
+		}
+		if err = resolve(&MergeConflict{dstItem, srcItem, dr.Tx, sr.Tx, changes}, res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// mergePasswordHistory adds the password of loser, and the entries of its
+// history, to the history of winner, reporting whether any were missing.
+// The loser's password is recorded as replaced when it was last updated.
+func mergePasswordHistory(winner, loser *Item) (bool, error) {
+	history := winner.PasswordHistory()
+	seen := make(map[string]bool)
+	for _, h := range history {
+		seen[h.Value] = true
+	}
+	current := winner.Password()
+	add := func(h PasswordHistoryEntry) {
+		if h.Value != "" && h.Value != current && !seen[h.Value] {
+			history = append(history, h)
+			seen[h.Value] = true
+		}
+	}
+	n := len(history)
+	for _, h := range loser.PasswordHistory() {
+		add(h)
+	}
+	add(PasswordHistoryEntry{loser.Password(), loser.Updated.Unix()})
+	if len(history) == n {
+		return false, nil
+	}
+
+	d := make(map[string]json.RawMessage)
+	if len(winner.Details) > 0 {
+		if err := json.Unmarshal(winner.Details, &d); err != nil {
+			return false, err
+		}
+	}
+	sort.SliceStable(history, func(a, b int) bool { return history[a].Time < history[b].Time })
+	d["passwordHistory"], _ = json.Marshal(history)
+	data, err := json.Marshal(d)
+	if err != nil {
+		return false, err
+	}
+	winner.Details = data
+	return true, nil
+}
@@ -0,0 +1,29 @@
+package onepassword
+
+import "time"
+
+// Metrics receives measurements of a vault's work, so that long-running
+// servers can export them to a monitoring system. Implementations must be
+// safe for concurrent use. See the metrics package for one exporting to
+// Prometheus.
+type Metrics interface {
+	// Unlocked is called after each attempt to unlock the vault, with the
+	// error it failed with, if any.
+	Unlocked(err error)
+	// Decrypted is called after decrypting part of an item, "overview" or
+	// "details", with the time taken.
+	Decrypted(part string, d time.Duration)
+	// IndexCacheRead is called when the index cache is read, with the
+	// number of overviews it held and the number that had to be decrypted.
+	IndexCacheRead(hits, misses int)
+	// ItemRead is called when an item is looked up by uuid or query.
+	ItemRead(c Category)
+}
+
+// observeDecrypt reports to m, if set, the time since start taken
+// decrypting part of an item.
+func observeDecrypt(m Metrics, part string, start time.Time) {
+	if m != nil {
+		m.Decrypted(part, time.Since(start))
+	}
+}
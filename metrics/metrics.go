@@ -0,0 +1,171 @@
+// Package metrics exports measurements of opvault's servers to Prometheus,
+// for operators running shared secret services: unlock attempts, decryption
+// latency, index cache and agent hit rates, item reads by category, and the
+// requests answered over HTTP and gRPC. A Collector receives a vault's
+// measurements as its VaultConfig.Metrics and an agent's as its
+// Server.Metrics, and serves them all from Handler:
+//
+//	m := metrics.New()
+//	cfg.Metrics = m
+//	http.Handle("/metrics", m.Handler())
+//
+// No metric is labelled with anything identifying an item or a secret.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// A Collector holds the metrics, in a registry of its own alongside the
+// Go runtime's and the process's.
+type Collector struct {
+	reg          *prometheus.Registry
+	unlocks      *prometheus.CounterVec
+	decrypts     *prometheus.HistogramVec
+	indexCache   *prometheus.CounterVec
+	agentKeys    *prometheus.CounterVec
+	itemReads    *prometheus.CounterVec
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+}
+
+// New returns a Collector with every metric registered.
+func New() *Collector {
+	c := &Collector{
+		reg: prometheus.NewRegistry(),
+		unlocks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_unlock_attempts_total",
+			Help: "Attempts to unlock a vault, by result: success, wrong_password, or error.",
+		}, []string{"result"}),
+		decrypts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "opvault_decrypt_duration_seconds",
+			Help: "Time taken decrypting an item's overview or details.",
+			// From 1µs, as small items take a few microseconds
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+		}, []string{"part"}),
+		indexCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_index_cache_lookups_total",
+			Help: "Overviews looked up in the index cache, by result: hit or miss.",
+		}, []string{"result"}),
+		agentKeys: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_agent_key_requests_total",
+			Help: "Requests to the agent for a vault's keys, by result: hit or miss.",
+		}, []string{"result"}),
+		itemReads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_item_reads_total",
+			Help: "Items looked up by uuid or query, by category.",
+		}, []string{"category"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_http_requests_total",
+			Help: "HTTP requests answered, by method and status code.",
+		}, []string{"method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "opvault_http_request_duration_seconds",
+			Help:    "Time taken answering HTTP requests, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "opvault_grpc_requests_total",
+			Help: "gRPC calls answered, by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "opvault_grpc_request_duration_seconds",
+			Help:    "Time taken answering gRPC calls, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	c.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		c.unlocks, c.decrypts, c.indexCache, c.agentKeys, c.itemReads,
+		c.httpRequests, c.httpDuration, c.grpcRequests, c.grpcDuration,
+	)
+	return c
+}
+
+// Handler returns the handler for Prometheus to scrape.
+func (c *Collector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.reg, promhttp.HandlerOpts{})
+}
+
+// Unlocked implements onepassword.Metrics.
+func (c *Collector) Unlocked(err error) {
+	switch err {
+	case nil:
+		c.unlocks.WithLabelValues("success").Inc()
+	case onepassword.ErrWrongPassword:
+		c.unlocks.WithLabelValues("wrong_password").Inc()
+	default:
+		c.unlocks.WithLabelValues("error").Inc()
+	}
+}
+
+// Decrypted implements onepassword.Metrics.
+func (c *Collector) Decrypted(part string, d time.Duration) {
+	c.decrypts.WithLabelValues(part).Observe(d.Seconds())
+}
+
+// IndexCacheRead implements onepassword.Metrics.
+func (c *Collector) IndexCacheRead(hits, misses int) {
+	c.indexCache.WithLabelValues("hit").Add(float64(hits))
+	c.indexCache.WithLabelValues("miss").Add(float64(misses))
+}
+
+// ItemRead implements onepassword.Metrics.
+func (c *Collector) ItemRead(cat onepassword.Category) {
+	name := cat.Name
+	if name == "" {
+		name = "unknown"
+	}
+	c.itemReads.WithLabelValues(name).Inc()
+}
+
+// KeysRequested implements agent.Metrics.
+func (c *Collector) KeysRequested(found bool) {
+	if found {
+		c.agentKeys.WithLabelValues("hit").Inc()
+	} else {
+		c.agentKeys.WithLabelValues("miss").Inc()
+	}
+}
+
+// InstrumentHandler returns h, counting and timing its requests.
+func (c *Collector) InstrumentHandler(h http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerDuration(c.httpDuration,
+		promhttp.InstrumentHandlerCounter(c.httpRequests, h))
+}
+
+// ServerOptions returns the options that count and time a gRPC server's
+// calls.
+func (c *Collector) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			c.observeCall(info.FullMethod, start, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			c.observeCall(info.FullMethod, start, err)
+			return err
+		}),
+	}
+}
+
+func (c *Collector) observeCall(method string, start time.Time, err error) {
+	c.grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	c.grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+func TestHandler(t *testing.T) {
+	c := New()
+	c.Unlocked(nil)
+	c.Unlocked(onepassword.ErrWrongPassword)
+	c.Unlocked(errors.New("disk on fire"))
+	c.Decrypted("details", 50*time.Microsecond)
+	c.IndexCacheRead(9, 1)
+	c.KeysRequested(false)
+	c.ItemRead(onepassword.Category{Name: "Login"})
+	h := c.InstrumentHandler(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/items", nil))
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	for _, want := range []string{
+		`opvault_unlock_attempts_total{result="success"} 1`,
+		`opvault_unlock_attempts_total{result="wrong_password"} 1`,
+		`opvault_unlock_attempts_total{result="error"} 1`,
+		`opvault_decrypt_duration_seconds_count{part="details"} 1`,
+		`opvault_index_cache_lookups_total{result="hit"} 9`,
+		`opvault_index_cache_lookups_total{result="miss"} 1`,
+		`opvault_agent_key_requests_total{result="miss"} 1`,
+		`opvault_item_reads_total{category="Login"} 1`,
+		`opvault_http_requests_total{code="404",method="get"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected metrics to include %s", want)
+		}
+	}
+}
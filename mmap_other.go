@@ -0,0 +1,14 @@
+//go:build !unix
+
+package onepassword
+
+import "io/ioutil"
+
+// Without mmap, as on Windows and js/wasm, files are read whole.
+func mapFile(name string) ([]byte, func(), error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() {}, nil
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package onepassword
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the file name into memory read-only. The mapping stays
+// valid if the file is replaced by renaming another over it, as
+// writeFileAtomic and 1Password do, but reading it faults if the file is
+// truncated in place meanwhile.
+func mapFile(name string) ([]byte, func(), error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.Size() == 0 {
+		// Empty files can't be mapped
+		return nil, func() {}, nil
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: name, Err: err}
+	}
+	return data, func() { unix.Munmap(data) }, nil
+}
@@ -0,0 +1,175 @@
+// Package mobile is the library's API for iOS and Android apps, in the form
+// gomobile can bind: methods take and return strings, byte slices, and
+// integers, and lists and items are returned as JSON in the forms of the
+// restapi package. Build it with
+//
+//	gomobile bind -target ios github.com/mpage/onepassword/mobile
+//	gomobile bind -target android github.com/mpage/onepassword/mobile
+//
+// Items are found as onepassword.Vault.FindItem finds them, and fields as
+// Item.Field names them. A Vault may be used from any thread.
+package mobile
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/restapi"
+)
+
+// source is what a Vault reads; *onepassword.Vault is one.
+type source interface {
+	Filter(expr string) ([]onepassword.Item, error)
+	Search(query string) ([]onepassword.SearchResult, error)
+	FindItem(query string) (*onepassword.Item, error)
+	DerivedKeys() *crypto.KeyPair
+	Close()
+}
+
+// A Vault is an unlocked vault.
+type Vault struct {
+	mu sync.Mutex
+	v  source
+}
+
+// Open unlocks the default profile of the vault at path, an .opvault
+// directory or a 1Password SQLite database, with the master password.
+func Open(path, password string) (*Vault, error) {
+	return OpenProfile(path, onepassword.DefaultProfile, password)
+}
+
+// OpenProfile unlocks a profile of the vault at path.
+func OpenProfile(path, profile, password string) (*Vault, error) {
+	v, err := onepassword.NewVault(password, onepassword.VaultConfig{DBPath: path, Profile: profile})
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{v: v}, nil
+}
+
+// OpenWithKeys unlocks a profile of the vault at path with keys returned by
+// Vault.Keys, which apps may keep in the platform's keychain to unlock with
+// biometrics instead of the master password.
+func OpenWithKeys(path, profile string, keys []byte) (*Vault, error) {
+	if len(keys) != crypto.EncKeySize+crypto.MACKeySize {
+		return nil, fmt.Errorf("keys are %d bytes, not %d", len(keys), crypto.EncKeySize+crypto.MACKeySize)
+	}
+	kp := &crypto.KeyPair{
+		EncKey: append([]byte(nil), keys[:crypto.EncKeySize]...),
+		MACKey: append([]byte(nil), keys[crypto.EncKeySize:]...),
+	}
+	v, err := onepassword.NewVaultWithKeys(kp, onepassword.VaultConfig{DBPath: path, Profile: profile})
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{v: v}, nil
+}
+
+// Keys returns the keys derived from the master password, for OpenWithKeys.
+// They unlock the vault just as the password does, so must be stored as
+// carefully.
+func (v *Vault) Keys() []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	kp := v.v.DerivedKeys()
+	return append(append([]byte(nil), kp.EncKey...), kp.MACKey...)
+}
+
+// Close locks the vault.
+func (v *Vault) Close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.v.Close()
+}
+
+// List returns a JSON array of the items matching a filter expression,
+// without their fields and notes.
+func (v *Vault) List(filter string) (string, error) {
+	v.mu.Lock()
+	items, err := v.v.Filter(filter)
+	v.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	list := []restapi.Item{}
+	for i := range items {
+		list = append(list, restapi.NewItem(&items[i], false))
+	}
+	return toJSON(list)
+}
+
+// Search returns a JSON array of the items matching a search, best first,
+// without their fields and notes.
+func (v *Vault) Search(query string) (string, error) {
+	v.mu.Lock()
+	results, err := v.v.Search(query)
+	v.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	list := []restapi.Item{}
+	for i := range results {
+		list = append(list, restapi.NewItem(&results[i].Item, false))
+	}
+	return toJSON(list)
+}
+
+func (v *Vault) find(query string) (*onepassword.Item, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v.FindItem(query)
+}
+
+// Item returns a JSON object of the item identified by query, with its
+// fields and notes.
+func (v *Vault) Item(query string) (string, error) {
+	item, err := v.find(query)
+	if err != nil {
+		return "", err
+	}
+	return toJSON(restapi.NewItem(item, true))
+}
+
+// Field returns the value of a field of the item identified by query.
+func (v *Vault) Field(query, field string) (string, error) {
+	item, err := v.find(query)
+	if err != nil {
+		return "", err
+	}
+	value, ok := item.Field(field)
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", item.Title, field)
+	}
+	return value, nil
+}
+
+// TOTP returns the current one-time password of the item identified by
+// query.
+func (v *Vault) TOTP(query string) (string, error) {
+	item, err := v.find(query)
+	if err != nil {
+		return "", err
+	}
+	code, _, err := item.TOTPCode(time.Now())
+	return code, err
+}
+
+// TOTPRemaining returns the number of seconds until the item's one-time
+// password changes.
+func (v *Vault) TOTPRemaining(query string) (int, error) {
+	item, err := v.find(query)
+	if err != nil {
+		return 0, err
+	}
+	_, remaining, err := item.TOTPCode(time.Now())
+	return int(remaining / time.Second), err
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,69 @@
+package mobile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/crypto"
+	"github.com/mpage/onepassword/restapi"
+)
+
+// fakeVault holds one Login with a one-time password.
+type fakeVault struct {
+	item onepassword.Item
+}
+
+func (v *fakeVault) Filter(expr string) ([]onepassword.Item, error) {
+	return []onepassword.Item{v.item}, nil
+}
+
+func (v *fakeVault) Search(query string) ([]onepassword.SearchResult, error) {
+	return []onepassword.SearchResult{{Item: v.item}}, nil
+}
+
+func (v *fakeVault) FindItem(query string) (*onepassword.Item, error) {
+	if query != v.item.Title {
+		return nil, onepassword.ErrItemNotFound
+	}
+	return &v.item, nil
+}
+
+func (v *fakeVault) DerivedKeys() *crypto.KeyPair {
+	return &crypto.KeyPair{EncKey: make([]byte, 32), MACKey: []byte("0123456789abcdef0123456789abcdef")}
+}
+
+func (v *fakeVault) Close() {}
+
+func TestVault(t *testing.T) {
+	item := onepassword.Item{Uuid: "A1", Title: "GitHub", Category: onepassword.CatLogin}
+	item.Details = []byte(`{"fields":[{"designation":"password","value":"hunter2"}],"sections":[{"fields":[{"k":"concealed","n":"TOTP_1","v":"GEZDGNBV"}]}]}`)
+	v := &Vault{v: &fakeVault{item}}
+
+	list, err := v.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []restapi.Item
+	if err = json.Unmarshal([]byte(list), &items); err != nil || len(items) != 1 || items[0].Title != "GitHub" || items[0].Fields != nil {
+		t.Fatalf("Unexpected list %s: %v", list, err)
+	}
+	if value, err := v.Field("GitHub", "password"); err != nil || value != "hunter2" {
+		t.Fatalf("Expected hunter2. Got %q, %v.", value, err)
+	}
+	if _, err := v.Field("GitHub", "pin"); err == nil {
+		t.Fatalf("Expected a missing field to fail")
+	}
+	if code, err := v.TOTP("GitHub"); err != nil || len(code) != 6 {
+		t.Fatalf("Expected a 6 digit code. Got %q, %v.", code, err)
+	}
+	if _, err := v.Item("GitLab"); err != onepassword.ErrItemNotFound {
+		t.Fatalf("Expected GitLab not to be found. Got %v.", err)
+	}
+	if keys := v.Keys(); len(keys) != 64 || keys[32] != '0' {
+		t.Fatalf("Unexpected keys %x", keys)
+	}
+	if _, err := OpenWithKeys("/nonexistent", "default", []byte("short")); err == nil {
+		t.Fatalf("Expected short keys to fail")
+	}
+}
@@ -1,5 +1,10 @@
 package onepassword
 
+import (
+	"encoding/json"
+	"time"
+)
+
 var (
 	// Known categories from https://support.1password.com/opvault-design/
 	CatLogin           = Category{"001", "Login"}
@@ -20,19 +25,62 @@ var (
 	CatRouter          = Category{"109", "Router"}
 	CatServer          = Category{"110", "Server"}
 	CatEmail           = Category{"111", "Email"}
+
+	// Categories introduced after the OPVault design document was published
+	CatDocument      = Category{"006", "Document"}
+	CatAPICredential = Category{"112", "API Credential"}
+	CatMedicalRecord = Category{"113", "Medical Record"}
+	CatSSHKey        = Category{"114", "SSH Key"}
+	CatCryptoWallet  = Category{"115", "Crypto Wallet"}
 )
 
 type Category struct {
-	Uuid string `json: "uuid"`
-	Name string `json: "name"`
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// MarshalJSON encodes the category as an object holding its uuid and name.
+func (c Category) MarshalJSON() ([]byte, error) {
+	type category Category
+	return json.Marshal(category(c))
+}
+
+// UnmarshalJSON accepts either a bare uuid string, as stored in OPVault item
+// attributes, or the object produced by MarshalJSON. The uuid is
+// authoritative: the name is resolved from the registry, and a name in the
+// input is only used for categories the registry doesn't know about.
+func (c *Category) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		Uuid string `json:"uuid"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &obj.Uuid); err != nil {
+		if err = json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+	}
+
+	if cat, ok := CategoryByUUID(obj.Uuid); ok {
+		*c = cat
+	} else if obj.Name != "" {
+		*c = Category{obj.Uuid, obj.Name}
+	} else {
+		*c = resolveCategory(obj.Uuid)
+	}
+
+	return nil
 }
 
 type Field struct {
 	Value string `json:"v"`
 	Name  string `json:"t"`
+	Kind  string `json:"k"`
+	Id    string `json:"n"` // Identifies the field within its section
 }
 
 type Section struct {
+	Name   string  `json:"name"`
+	Title  string  `json:"title"`
 	Fields []Field `json:"fields"`
 }
 
@@ -41,10 +89,71 @@ type Note struct {
 	Description string    `json:"notesPlain"`
 }
 
+// A LoginField is a web form field saved with a Login item. Designation
+// marks the fields holding the username and password.
+type LoginField struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Type        string `json:"type"`
+	Designation string `json:"designation"`
+}
+
+// A PasswordHistoryEntry records a password that was replaced and when.
+type PasswordHistoryEntry struct {
+	Value string `json:"value"`
+	Time  int64  `json:"time"` // Unix timestamp
+}
+
+// Login holds the details of items in CatLogin.
+type Login struct {
+	Fields          []LoginField           `json:"fields"`
+	Sections        []Section              `json:"sections"`
+	Description     string                 `json:"notesPlain"`
+	PasswordHistory []PasswordHistoryEntry `json:"passwordHistory,omitempty"`
+}
+
+// Password holds the details of items in CatPassword.
+type Password struct {
+	Password    string `json:"password"`
+	Description string `json:"notesPlain"`
+}
+
+// DocumentAttributes describes the file stored alongside a Document item.
+type DocumentAttributes struct {
+	FileName      string `json:"fileName"`
+	DocumentId    string `json:"documentId"`
+	DecryptedSize int64  `json:"decryptedSize"`
+}
+
+// Document holds the details of items in CatDocument. API Credential, Medical
+// Record, SSH Key, and Crypto Wallet items store everything in sections and
+// decode into a Note.
+type Document struct {
+	Attributes  DocumentAttributes `json:"documentAttributes"`
+	Sections    []Section          `json:"sections"`
+	Description string             `json:"notesPlain"`
+}
+
+// A Link is one of the URLs saved in an item overview.
+type Link struct {
+	Label string `json:"l"`
+	Url   string `json:"u"`
+}
+
 type Item struct {
-	Title     string   `json:"title"`
-	Url       string   `json:"url"`
-	Tags      []string `json:"tags"`
-	Category  Category `json:"cat"`
-	Details   []byte // JSON encoded object. Structure is based on category.
+	Uuid       string          `json:"uuid"`
+	Title      string          `json:"title"`
+	Url        string          `json:"url"`
+	Urls       []Link          `json:"URLs,omitempty"`
+	Info       string          `json:"ainfo"` // Summary shown under the title, e.g. the username
+	Tags       []string        `json:"tags"`
+	Category   Category        `json:"cat"`
+	Scope      DisplayScope    `json:"scope,omitempty"`
+	Autosubmit AutosubmitMode  `json:"autosubmit,omitempty"`
+	Strength   int             `json:"ps"`             // Password strength, 0-100
+	FaveIndex  int             `json:"fave,omitempty"` // Position among favorites. Zero if not a favorite.
+	Folder     string          `json:"folder,omitempty"`
+	Created    time.Time       `json:"created"`
+	Updated    time.Time       `json:"updated"`
+	Details    json.RawMessage `json:"details,omitempty"` // Structure is based on category.
 }
@@ -0,0 +1,107 @@
+package onepassword
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A VaultSet works across several unlocked vaults at once, such as a
+// personal and a work vault, each known by the name it was added under.
+type VaultSet struct {
+	names  []string
+	vaults map[string]*Vault
+}
+
+func NewVaultSet() *VaultSet {
+	return &VaultSet{vaults: make(map[string]*Vault)}
+}
+
+// Add adds a vault to the set. Names must be unique.
+func (s *VaultSet) Add(name string, v *Vault) error {
+	if _, ok := s.vaults[name]; ok {
+		return fmt.Errorf("vault %q added twice", name)
+	}
+	s.names = append(s.names, name)
+	s.vaults[name] = v
+	return nil
+}
+
+// Names returns the names of the vaults in the order they were added.
+func (s *VaultSet) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// Vault returns the named vault, or nil if there's no such vault.
+func (s *VaultSet) Vault(name string) *Vault {
+	return s.vaults[name]
+}
+
+// Close closes every vault in the set.
+func (s *VaultSet) Close() {
+	for _, v := range s.vaults {
+		v.Close()
+	}
+}
+
+// A VaultItem is an item along with the name of the vault holding it.
+type VaultItem struct {
+	Vault string
+	Item
+}
+
+// List returns the items in every vault that satisfy pred, sorted together
+// by order, or by title if no order is given. Items that compare equal keep
+// the order their vaults were added in.
+func (s *VaultSet) List(pred ItemPredicate, order ...Comparator) ([]VaultItem, error) {
+	if len(order) == 0 {
+		order = []Comparator{ByTitle}
+	}
+	var all []VaultItem
+	for _, name := range s.names {
+		items, err := s.vaults[name].List(pred, order...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		for _, item := range items {
+			all = append(all, VaultItem{name, item})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		for _, c := range order {
+			if r := c(&all[i].Item, &all[j].Item); r != 0 {
+				return r < 0
+			}
+		}
+		return false
+	})
+	return all, nil
+}
+
+// A VaultSearchResult is a search result along with the name of the vault
+// holding the item.
+type VaultSearchResult struct {
+	Vault string
+	SearchResult
+}
+
+// Search searches every vault as Vault.Search does, merging the results from
+// most to least relevant. Scores are comparable across vaults as they only
+// depend on the fields of the matching item.
+func (s *VaultSet) Search(query string) ([]VaultSearchResult, error) {
+	var all []VaultSearchResult
+	for _, name := range s.names {
+		results, err := s.vaults[name].Search(query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		for _, r := range results {
+			all = append(all, VaultSearchResult{name, r})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Score > all[j].Score
+	})
+	return all, nil
+}
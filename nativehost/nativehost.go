@@ -0,0 +1,271 @@
+// Package nativehost serves logins to a browser extension as a native
+// messaging host, the process Chrome and Firefox start on an extension's
+// behalf and talk to over its standard input and output. Each message is
+// a JSON object preceded by its length as a 32-bit integer in native byte
+// order.
+//
+// Requests carry an "op", and are answered with the same "id":
+//
+//	{"id": 1, "op": "logins", "url": "https://github.com/login"}
+//	{"id": 1, "logins": [{"uuid": "...", "title": "GitHub", "username": "wendy"}]}
+//	{"id": 2, "op": "fill", "url": "https://github.com/login", "uuid": "..."}
+//	{"id": 2, "username": "wendy", "password": "..."}
+//	{"id": 3, "op": "totp", "url": "https://github.com/login", "uuid": "..."}
+//	{"id": 3, "code": "123456", "remaining": 17}
+//	{"id": 4, "op": "status"}
+//	{"id": 4, "locked": false}
+//	{"id": 5, "op": "lock"}
+//
+// Failures are answered with an "error". The user confirms each origin
+// before its first use in a session, and logins are only given to pages
+// they match. The session ends, locking the vault and forgetting the
+// confirmed origins, on a "lock" request or after Timeout without one.
+package nativehost
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// Browsers limit messages sent to them to 1 MiB, and the messages they send
+// to 64 MiB; requests are far smaller, so they're limited further.
+const (
+	maxRequest  = 1 << 20
+	maxResponse = 1 << 20
+)
+
+// ErrDenied is returned when the user refuses an origin.
+var ErrDenied = errors.New("denied by user")
+
+// ReadMessage reads a message and decodes it into v. It returns io.EOF when
+// the browser closes the connection.
+func ReadMessage(r io.Reader, v interface{}) error {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if n > maxRequest {
+		return fmt.Errorf("message of %d bytes is too long", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage encodes v and writes it as a message.
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxResponse {
+		return fmt.Errorf("message of %d bytes is too long", len(data))
+	}
+	// Every platform browsers run native hosts on is little endian
+	if err = binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// A Request is a message from the extension.
+type Request struct {
+	Id   json.RawMessage `json:"id,omitempty"`
+	Op   string          `json:"op"`
+	Url  string          `json:"url,omitempty"`
+	Uuid string          `json:"uuid,omitempty"`
+}
+
+// A Login is offered to the extension for a page.
+type Login struct {
+	Uuid     string `json:"uuid"`
+	Title    string `json:"title"`
+	Username string `json:"username,omitempty"`
+}
+
+// A Response answers a Request.
+type Response struct {
+	Id        json.RawMessage `json:"id,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Locked    *bool           `json:"locked,omitempty"`
+	Logins    []Login         `json:"logins,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	Password  string          `json:"password,omitempty"`
+	Code      string          `json:"code,omitempty"`
+	Remaining int             `json:"remaining,omitempty"`
+}
+
+// A Host answers an extension's requests. Unlock is called to open the
+// vault at the start of each session, and Confirm to ask the user whether
+// an origin, such as "https://github.com", may use the vault's logins.
+type Host struct {
+	Unlock  func() (onepassword.VaultReader, error)
+	Confirm func(origin string) bool
+	Timeout time.Duration // Zero for sessions that only end when locked
+
+	mu      sync.Mutex
+	vault   onepassword.VaultReader
+	allowed map[string]bool
+	used    time.Time
+	timer   *time.Timer
+}
+
+// Serve answers requests read from r on w until r is closed, and then
+// locks the vault.
+func (h *Host) Serve(r io.Reader, w io.Writer) error {
+	defer h.Lock()
+	for {
+		var req Request
+		if err := ReadMessage(r, &req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		resp := h.handle(&req)
+		resp.Id = req.Id
+		if err := WriteMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// Lock ends the session.
+func (h *Host) Lock() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lock()
+}
+
+func (h *Host) lock() {
+	if h.vault != nil {
+		h.vault.Close()
+		h.vault = nil
+	}
+	h.allowed = nil
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+}
+
+// expire ends the session if it's been idle for Timeout, or else checks
+// again when it will have been.
+func (h *Host) expire() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.vault == nil {
+		return
+	}
+	if idle := time.Since(h.used); idle < h.Timeout {
+		h.timer = time.AfterFunc(h.Timeout-idle, h.expire)
+		return
+	}
+	h.lock()
+}
+
+func (h *Host) handle(req *Request) *Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch req.Op {
+	case "status":
+		locked := h.vault == nil
+		return &Response{Locked: &locked}
+	case "lock":
+		h.lock()
+		return &Response{}
+	case "logins", "fill", "totp":
+	default:
+		return &Response{Error: fmt.Sprintf("unknown request %q", req.Op)}
+	}
+
+	logins, err := h.logins(req.Url)
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	if req.Op == "logins" {
+		resp := &Response{Logins: []Login{}}
+		for _, r := range logins {
+			resp.Logins = append(resp.Logins, Login{r.Item.Uuid, r.Item.Title, r.Item.Username()})
+		}
+		return resp
+	}
+
+	// Only logins for the page are given to it, so a compromised page
+	// can't ask for another site's
+	var item *onepassword.Item
+	for i := range logins {
+		if logins[i].Item.Uuid == req.Uuid {
+			item = &logins[i].Item
+		}
+	}
+	if item == nil {
+		return &Response{Error: "no such login for " + req.Url}
+	}
+	if req.Op == "fill" {
+		return &Response{Username: item.Username(), Password: item.Password()}
+	}
+	code, remaining, err := item.TOTPCode(time.Now())
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	return &Response{Code: code, Remaining: int(remaining / time.Second)}
+}
+
+// logins unlocks the vault if need be, confirms the origin of rawurl with
+// the user, and returns the logins that match it.
+func (h *Host) logins(rawurl string) ([]onepassword.SearchResult, error) {
+	origin, err := Origin(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if h.vault == nil {
+		if h.vault, err = h.Unlock(); err != nil {
+			return nil, err
+		}
+		h.allowed = make(map[string]bool)
+	}
+	h.used = time.Now()
+	if h.Timeout > 0 && h.timer == nil {
+		h.timer = time.AfterFunc(h.Timeout, h.expire)
+	}
+
+	if !h.allowed[origin] {
+		if !h.Confirm(origin) {
+			return nil, ErrDenied
+		}
+		h.allowed[origin] = true
+	}
+	items, err := h.vault.LookupItems(func(i *onepassword.Item) bool {
+		return i.Category.Uuid == onepassword.CatLogin.Uuid
+	})
+	if err != nil {
+		return nil, err
+	}
+	return onepassword.RankLogins(items, rawurl)
+}
+
+// Origin returns the scheme, host, and port of a page's URL, as browsers
+// identify the page's site.
+func Origin(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("%q is not a web page", rawurl)
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
@@ -0,0 +1,122 @@
+package nativehost
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// fakeVault holds items in memory.
+type fakeVault struct {
+	items  []onepassword.Item
+	closed bool
+}
+
+func (v *fakeVault) LookupItems(pred onepassword.ItemPredicate) ([]onepassword.Item, error) {
+	var items []onepassword.Item
+	for i := range v.items {
+		if pred(&v.items[i]) {
+			items = append(items, v.items[i])
+		}
+	}
+	return items, nil
+}
+
+func (v *fakeVault) Item(uuid string) (*onepassword.Item, error) {
+	return nil, onepassword.ErrItemNotFound
+}
+
+func (v *fakeVault) Close() { v.closed = true }
+
+func login(t *testing.T, uuid, url, username string) onepassword.Item {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title, item.Url = uuid, url, url
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = username, "pw-"+username
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return *item
+}
+
+func TestHost(t *testing.T) {
+	vault := &fakeVault{items: []onepassword.Item{
+		login(t, "A", "https://github.com", "wendy"),
+		login(t, "B", "https://bank.example", "bob"),
+	}}
+	var asked []string
+	h := &Host{
+		Unlock: func() (onepassword.VaultReader, error) { return vault, nil },
+		Confirm: func(origin string) bool {
+			asked = append(asked, origin)
+			return origin != "https://evil.example"
+		},
+	}
+
+	var in bytes.Buffer
+	for _, req := range []Request{
+		{Id: []byte("1"), Op: "logins", Url: "https://github.com/login"},
+		{Id: []byte("2"), Op: "fill", Url: "https://github.com/login", Uuid: "A"},
+		{Id: []byte("3"), Op: "fill", Url: "https://github.com/login", Uuid: "B"},
+		{Id: []byte("4"), Op: "logins", Url: "https://evil.example/"},
+		{Id: []byte("5"), Op: "lock"},
+		{Id: []byte("6"), Op: "status"},
+	} {
+		if err := WriteMessage(&in, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := h.Serve(&in, &out); err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+
+	var resps []Response
+	for {
+		var resp Response
+		if err := ReadMessage(&out, &resp); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	}
+	if len(resps) != 6 {
+		t.Fatalf("Expected 6 responses. Got %d.", len(resps))
+	}
+	if len(resps[0].Logins) != 1 || resps[0].Logins[0].Username != "wendy" || string(resps[0].Id) != "1" {
+		t.Errorf("Unexpected logins: %+v", resps[0])
+	}
+	if resps[1].Password != "pw-wendy" {
+		t.Errorf("Unexpected fill: %+v", resps[1])
+	}
+	if resps[2].Error == "" || resps[2].Password != "" {
+		t.Errorf("Expected another site's login to be refused: %+v", resps[2])
+	}
+	if resps[3].Error != ErrDenied.Error() {
+		t.Errorf("Expected the origin to be denied: %+v", resps[3])
+	}
+	if resps[5].Locked == nil || !*resps[5].Locked || !vault.closed {
+		t.Errorf("Expected the vault to be locked: %+v", resps[5])
+	}
+	if len(asked) != 2 {
+		t.Errorf("Expected one confirmation per origin. Got %v.", asked)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	vault := &fakeVault{}
+	h := &Host{
+		Unlock:  func() (onepassword.VaultReader, error) { return vault, nil },
+		Confirm: func(string) bool { return true },
+		Timeout: 10 * time.Millisecond,
+	}
+	h.handle(&Request{Op: "logins", Url: "https://github.com"})
+	time.Sleep(50 * time.Millisecond)
+	if locked := h.handle(&Request{Op: "status"}).Locked; !*locked || !vault.closed {
+		t.Fatalf("Expected the session to time out")
+	}
+}
@@ -0,0 +1,146 @@
+// Package opcli reads items through the official 1Password command line
+// tool, op version 2, for accounts that only it can reach. A Reader
+// implements onepassword.VaultReader, so applications can fall back to op
+// where no local vault or Connect server is available. op must be signed
+// in, e.g. with "eval $(op signin)" or a service account token in
+// $OP_SERVICE_ACCOUNT_TOKEN, which it reads from the environment.
+package opcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/connect"
+)
+
+// A CLI runs op.
+type CLI struct {
+	Path    string // "op" if empty, found in $PATH
+	Account string // Account shorthand, sign in address, or id; op's default if empty
+}
+
+// run runs op with args, passing it stdin, and returns what it prints.
+func (c *CLI) run(stdin []byte, args ...string) ([]byte, error) {
+	path := c.Path
+	if path == "" {
+		path = "op"
+	}
+	args = append(args, "--format", "json")
+	if c.Account != "" {
+		args = append(args, "--account", c.Account)
+	}
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		if msg := opError(errOut.String()); msg != "" {
+			return nil, fmt.Errorf("op: %s", msg)
+		}
+		return nil, fmt.Errorf("op: %s", err)
+	}
+	return out.Bytes(), nil
+}
+
+// opError returns the message of an error op printed, without the
+// "[ERROR] 2006/01/02 15:04:05" it starts with.
+func opError(stderr string) string {
+	msg := strings.TrimSpace(stderr)
+	if strings.HasPrefix(msg, "[ERROR] ") {
+		if f := strings.SplitN(msg, " ", 4); len(f) == 4 {
+			msg = f[3]
+		}
+	}
+	return msg
+}
+
+// A Vault describes a vault the account can read.
+type Vault struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Vaults lists the vaults of the account.
+func (c *CLI) Vaults() ([]Vault, error) {
+	out, err := c.run(nil, "vault", "list")
+	if err != nil {
+		return nil, err
+	}
+	var vaults []Vault
+	if err = json.Unmarshal(out, &vaults); err != nil {
+		return nil, fmt.Errorf("op: %s", err)
+	}
+	return vaults, nil
+}
+
+// A Reader reads the vault named Vault, by name or id, implementing
+// onepassword.VaultReader.
+type Reader struct {
+	CLI   *CLI
+	Vault string
+}
+
+var _ onepassword.VaultReader = (*Reader)(nil)
+
+// LookupItems fetches every item in the vault, as predicates may look at
+// their details. The listing is piped back into op, which fetches the
+// items in one run.
+func (r *Reader) LookupItems(pred onepassword.ItemPredicate) ([]onepassword.Item, error) {
+	list, err := r.CLI.run(nil, "item", "list", "--vault", r.Vault)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(list)) == "[]" {
+		return nil, nil
+	}
+	out, err := r.CLI.run(list, "item", "get", "-", "--vault", r.Vault)
+	if err != nil {
+		return nil, err
+	}
+
+	// op prints one JSON object per item
+	var items []onepassword.Item
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("op: %s", err)
+		}
+		item, err := connect.DecodeItem(raw)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s", err)
+		}
+		if pred(item) {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+// Item returns the item with the supplied id, or
+// onepassword.ErrItemNotFound.
+func (r *Reader) Item(uuid string) (*onepassword.Item, error) {
+	out, err := r.CLI.run(nil, "item", "get", uuid, "--vault", r.Vault)
+	if err != nil {
+		if strings.Contains(err.Error(), "isn't an item") {
+			return nil, onepassword.ErrItemNotFound
+		}
+		return nil, err
+	}
+	item, err := connect.DecodeItem(out)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s", err)
+	}
+	return item, nil
+}
+
+// Close does nothing; op keeps its own session.
+func (r *Reader) Close() {}
@@ -0,0 +1,60 @@
+package opcli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mpage/onepassword"
+)
+
+// fakeOp stands in for op with a vault of one Password item.
+const fakeOp = `#!/bin/sh
+item='{"id": "abc", "title": "Wi-Fi", "category": "PASSWORD", "created_at": "2022-01-02T03:04:05Z",
+  "fields": [{"id": "password", "type": "CONCEALED", "purpose": "PASSWORD", "label": "password", "value": "hunter2"}]}'
+case "$1 $2 $3" in
+"vault list "*) echo '[{"id": "v1", "name": "Private"}]' ;;
+"item list "*) echo '[{"id": "abc", "title": "Wi-Fi"}]' ;;
+"item get -") cat > /dev/null; echo "$item" ;;
+"item get abc") echo "$item" ;;
+*) echo "[ERROR] 2024/01/02 03:04:05 \"$3\" isn't an item in the \"Private\" vault." >&2; exit 1 ;;
+esac
+`
+
+func TestReader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a fake op script")
+	}
+	dir, err := ioutil.TempDir("", "opcli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	op := filepath.Join(dir, "op")
+	if err = ioutil.WriteFile(op, []byte(fakeOp), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CLI{Path: op}
+	vaults, err := c.Vaults()
+	if err != nil || len(vaults) != 1 || vaults[0].Name != "Private" {
+		t.Fatalf("Unexpected vaults: %v, %v", vaults, err)
+	}
+
+	var r onepassword.VaultReader = &Reader{c, "Private"}
+	items, err := r.LookupItems(func(i *onepassword.Item) bool { return true })
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Unexpected items: %v, %v", items, err)
+	}
+	if items[0].Category != onepassword.CatPassword || items[0].Password() != "hunter2" || items[0].Created.Year() != 2022 {
+		t.Fatalf("Unexpected item: %+v", items[0])
+	}
+	if _, err := r.Item("abc"); err != nil {
+		t.Fatalf("Failed getting item: %s", err)
+	}
+	if _, err := r.Item("missing"); err != onepassword.ErrItemNotFound {
+		t.Fatalf("Expected ErrItemNotFound. Got %v.", err)
+	}
+}
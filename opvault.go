@@ -0,0 +1,1076 @@
+package onepassword
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// bandNames are the files an OPVault profile spreads its items across,
+// chosen by the first character of each item's uuid.
+var bandNames = []string{
+	"band_0.js", "band_1.js", "band_2.js", "band_3.js",
+	"band_4.js", "band_5.js", "band_6.js", "band_7.js",
+	"band_8.js", "band_9.js", "band_A.js", "band_B.js",
+	"band_C.js", "band_D.js", "band_E.js", "band_F.js",
+}
+
+// bandName returns the band file holding the item with the given uuid, or
+// "" if no band holds it.
+func bandName(uuid string) string {
+	if uuid == "" {
+		return ""
+	}
+	name := "band_" + strings.ToUpper(uuid[:1]) + ".js"
+	for _, n := range bandNames {
+		if n == name {
+			return name
+		}
+	}
+	return ""
+}
+
+// A bandItem is an item as stored in a band file. Byte slices are base64
+// encoded in the JSON.
+type bandItem struct {
+	Uuid     string `json:"uuid"`
+	Category string `json:"category"`
+	Created  int64  `json:"created"`
+	Updated  int64  `json:"updated"`
+	Tx       int64  `json:"tx"`
+	Fave     int    `json:"fave"`
+	Folder   string `json:"folder"`
+	Trashed  bool   `json:"trashed"`
+	Hmac     []byte `json:"hmac"`
+	Key      []byte `json:"k"`
+	Overview []byte `json:"o"`
+	Details  []byte `json:"d"`
+}
+
+type opvaultProfile struct {
+	Salt        []byte `json:"salt"`
+	Iterations  int    `json:"iterations"`
+	MasterKey   []byte `json:"masterKey"`
+	OverviewKey []byte `json:"overviewKey"`
+}
+
+// opvaultStore reads a profile from an OPVault directory, the format used
+// by 1Password 4 onwards for vaults synced with Dropbox or a folder. The
+// directory holds a subdirectory per profile, usually just "default".
+type opvaultStore struct {
+	fsys fs.FS
+	dir  string // Profile directory within fsys
+	prof profileRecord
+
+	mu    sync.Mutex
+	items map[string]*bandItem            // Loaded on first use, by uuid
+	bands map[string]map[string]*bandItem // The same items by band, then uuid
+
+	// damaged lists what couldn't be read of each band that was loaded
+	// only in part
+	damaged map[string][]*BandParseError
+
+	// writeFile replaces a file in fsys, or is nil if fsys is read-only
+	writeFile func(name string, data []byte) error
+
+	// appendFile adds to the end of a file in fsys, or is nil if files
+	// can only be replaced
+	appendFile func(name string, data []byte) error
+
+	// removeFile deletes a file from fsys, or is nil if files can't be
+	// deleted
+	removeFile func(name string) error
+
+	// mapFile maps a file in fsys into memory, or is nil if files are
+	// read into the heap
+	mapFile func(name string) (data []byte, unmap func(), err error)
+
+	// lock keeps other programs from writing fsys until unlock is called,
+	// or is nil if they can't be kept out
+	lock func() (unlock func(), err error)
+
+	// locked is set while lockItem holds the lock
+	locked bool
+}
+
+func openOPVaultStore(fsys fs.FS, profile string) (*opvaultStore, error) {
+	s := &opvaultStore{fsys: fsys, dir: profile}
+
+	name := path.Join(profile, "profile.js")
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, &ProfileError{profile, name, err}
+	}
+	var p opvaultProfile
+	if err = unmarshalJS(data, &p); err != nil {
+		return nil, &ProfileError{profile, name, err}
+	}
+	s.prof = profileRecord{p.Salt, p.Iterations, p.MasterKey, p.OverviewKey}
+
+	return s, nil
+}
+
+// unmarshalJS decodes the JSON object wrapped in JavaScript by OPVault
+// files, such as "var profile={...};" or "ld({...});".
+func unmarshalJS(data []byte, v interface{}) error {
+	start := bytes.IndexByte(data, '{')
+	end := bytes.LastIndexByte(data, '}')
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object found")
+	}
+	return json.Unmarshal(data[start:end+1], v)
+}
+
+func (s *opvaultStore) profile() (*profileRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prof := s.prof
+	return &prof, nil
+}
+
+// Categories aren't stored in OPVault directories.
+func (s *opvaultStore) categories() (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// load reads every band file. Missing bands are skipped, as a profile
+// with few items won't have them all.
+func (s *opvaultStore) load() (map[string]*bandItem, error) {
+	return s.loadContext(context.Background())
+}
+
+// loadContext is load, stopping between bands once ctx is done. The bands
+// are read again in full the next time they're needed.
+func (s *opvaultStore) loadContext(ctx context.Context) (map[string]*bandItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.items != nil {
+		return s.items, nil
+	}
+	defer trace.StartRegion(ctx, "onepassword.loadBands").End()
+
+	items := make(map[string]*bandItem)
+	bands := make(map[string]map[string]*bandItem)
+	damaged := make(map[string][]*BandParseError)
+	for _, name := range bandNames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		band := make(map[string]*bandItem)
+		errs, err := s.readBand(name, band)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for uuid, item := range band {
+			items[uuid] = item
+		}
+		bands[name] = band
+		if errs != nil {
+			damaged[name] = errs
+		}
+	}
+	s.items, s.bands, s.damaged = items, bands, damaged
+
+	return items, nil
+}
+
+// preload reads the bands, as load does when they're first needed.
+func (s *opvaultStore) preload(ctx context.Context) error {
+	_, err := s.loadContext(ctx)
+	return err
+}
+
+// bandErrors returns what couldn't be read of the bands loaded in part, in
+// the order of the bands and then of the file.
+func (s *opvaultStore) bandErrors() ([]*BandParseError, error) {
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []*BandParseError
+	for _, name := range bandNames {
+		errs = append(errs, s.damaged[name]...)
+	}
+	return errs, nil
+}
+
+// reloadBand reads a band file again, replacing the items loaded from it,
+// and returns events for the items that changed, ordered by kind then
+// uuid. A missing band holds no items. Nothing is read if the bands
+// haven't been loaded, as they'll be read in full when they are. Only the
+// items of the band are compared, so a change costs no more in vaults with
+// many items.
+func (s *opvaultStore) reloadBand(name string, now time.Time) ([]Event, error) {
+	band := make(map[string]*bandItem)
+	errs, err := s.readBand(name, band)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		return nil, nil
+	}
+	if errs != nil {
+		s.damaged[name] = errs
+	} else {
+		delete(s.damaged, name)
+	}
+	event := func(kind string, item *bandItem) Event {
+		return Event{Kind: kind, Uuid: item.Uuid, Category: resolveCategory(item.Category).Name, Updated: time.Unix(item.Updated, 0), Time: now}
+	}
+	var deleted, added, modified []Event
+	for uuid, old := range s.bands[name] {
+		cur, ok := band[uuid]
+		if !old.Trashed && (!ok || cur.Trashed) {
+			deleted = append(deleted, event(ItemDeleted, old))
+		}
+		if !ok {
+			delete(s.items, uuid)
+		}
+	}
+	s.bands[name] = band
+	for uuid, cur := range band {
+		old, ok := s.items[uuid]
+		s.items[uuid] = cur
+		switch {
+		case cur.Trashed:
+		case !ok || old.Trashed:
+			added = append(added, event(ItemAdded, cur))
+		case old.Updated != cur.Updated || old.Tx != cur.Tx:
+			modified = append(modified, event(ItemModified, cur))
+		}
+	}
+	var events []Event
+	for _, evs := range [][]Event{deleted, added, modified} {
+		sort.Slice(evs, func(i, j int) bool { return evs[i].Uuid < evs[j].Uuid })
+		events = append(events, evs...)
+	}
+	return events, nil
+}
+
+// reloadProfile reads the profile again, reporting whether its keys
+// changed.
+func (s *opvaultStore) reloadProfile() (bool, error) {
+	name := path.Join(s.dir, "profile.js")
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return false, err
+	}
+	var p opvaultProfile
+	if err = unmarshalJS(data, &p); err != nil {
+		return false, &ProfileError{s.dir, name, err}
+	}
+	prof := profileRecord{p.Salt, p.Iterations, p.MasterKey, p.OverviewKey}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := prof.Iterations != s.prof.Iterations || !bytes.Equal(prof.Salt, s.prof.Salt) ||
+		!bytes.Equal(prof.MasterKey, s.prof.MasterKey) || !bytes.Equal(prof.OverviewKey, s.prof.OverviewKey)
+	s.prof = prof
+	return changed, nil
+}
+
+func (b *bandItem) record() *record {
+	return &record{
+		Uuid:      b.Uuid,
+		Category:  b.Category,
+		Created:   b.Created,
+		Updated:   b.Updated,
+		Tx:        b.Tx,
+		FaveIndex: b.Fave,
+		Folder:    b.Folder,
+		Key:       b.Key,
+		Overview:  b.Overview,
+	}
+}
+
+func (s *opvaultStore) records() ([]*record, error) {
+	return s.filter(false)
+}
+
+func (s *opvaultStore) trashed() ([]*record, error) {
+	return s.filter(true)
+}
+
+// filter returns the items that are or aren't in the trash.
+func (s *opvaultStore) filter(trashed bool) ([]*record, error) {
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+
+	var recs []*record
+	s.mu.Lock()
+	for _, item := range s.items {
+		if item.Trashed == trashed {
+			recs = append(recs, item.record())
+		}
+	}
+	s.mu.Unlock()
+	// Bands are maps, so impose an order that doesn't change between runs
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Uuid < recs[j].Uuid })
+	return recs, nil
+}
+
+// lookup returns the item with the supplied uuid, trashed or not, from
+// those loaded, which the watcher and writes keep current, so finding an
+// item never reads the bands again.
+func (s *opvaultStore) lookup(uuid string) (*bandItem, error) {
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[uuid]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+func (s *opvaultStore) record(uuid string) (*record, error) {
+	item, err := s.lookup(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if item.Trashed {
+		return nil, ErrItemNotFound
+	}
+	return item.record(), nil
+}
+
+func (s *opvaultStore) details(r *record) error {
+	item, err := s.lookup(r.Uuid)
+	if err != nil {
+		return err
+	}
+	r.Details = item.Details
+	return nil
+}
+
+// Attachment files start with a fixed size header:
+//
+//	7 bytes - The magic string "OPCLDAT"
+//	1 byte  - Version, currently 1
+//	2 bytes - Size of the metadata as a little endian uint16
+//	2 bytes - Unused
+//	4 bytes - Size of the icon as a little endian uint32
+//
+// followed by the metadata as JSON, the icon, and the contents. The icon and
+// contents are opdata01 encrypted with the item keys.
+const (
+	attachmentMagic      = "OPCLDAT"
+	attachmentHeaderSize = 16
+)
+
+type attachmentHeader struct {
+	metadataSize int
+	iconSize     int
+}
+
+type attachmentMetadata struct {
+	Uuid         string `json:"uuid"`
+	ItemUuid     string `json:"itemUUID"`
+	ContentsSize int64  `json:"contentsSize"`
+	Created      int64  `json:"createdAt"`
+	Updated      int64  `json:"updatedAt"`
+	Overview     []byte `json:"overview"`
+}
+
+func parseAttachmentHeader(hdr []byte) (*attachmentHeader, error) {
+	if len(hdr) < attachmentHeaderSize || string(hdr[:7]) != attachmentMagic {
+		return nil, fmt.Errorf("not an attachment")
+	}
+	if hdr[7] != 1 {
+		return nil, fmt.Errorf("unsupported attachment version %d", hdr[7])
+	}
+	return &attachmentHeader{
+		metadataSize: int(binary.LittleEndian.Uint16(hdr[8:10])),
+		iconSize:     int(binary.LittleEndian.Uint32(hdr[12:16])),
+	}, nil
+}
+
+func (s *opvaultStore) attachments(uuid string) ([]*attachmentRecord, error) {
+	names, err := fs.Glob(s.fsys, path.Join(s.dir, uuid+"_*.attachment"))
+	if err != nil {
+		return nil, err
+	}
+
+	var atts []*attachmentRecord
+	for _, name := range names {
+		a, err := s.readAttachmentMetadata(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path.Base(name), err)
+		}
+		atts = append(atts, a)
+	}
+	return atts, nil
+}
+
+// readAttachmentMetadata reads the header and metadata of an attachment
+// without reading its contents.
+func (s *opvaultStore) readAttachmentMetadata(name string) (*attachmentRecord, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, attachmentHeaderSize)
+	if _, err = io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	hdr, err := parseAttachmentHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	buf = make([]byte, hdr.metadataSize)
+	if _, err = io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	var meta attachmentMetadata
+	if err = json.Unmarshal(buf, &meta); err != nil {
+		return nil, err
+	}
+
+	if meta.Uuid == "" {
+		// Fall back to the file name, <item uuid>_<attachment uuid>.attachment
+		base := strings.TrimSuffix(path.Base(name), ".attachment")
+		meta.Uuid = base[strings.IndexByte(base, '_')+1:]
+	}
+	return &attachmentRecord{
+		Uuid:     meta.Uuid,
+		ItemUuid: meta.ItemUuid,
+		Size:     meta.ContentsSize,
+		Created:  meta.Created,
+		Updated:  meta.Updated,
+		Overview: meta.Overview,
+		path:     name,
+	}, nil
+}
+
+func (s *opvaultStore) attachmentData(a *attachmentRecord) ([]byte, func(), error) {
+	data, release, err := s.readFile(a.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	hdr, err := parseAttachmentHeader(data)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	start := attachmentHeaderSize + hdr.metadataSize + hdr.iconSize
+	if start > len(data) {
+		release()
+		return nil, nil, fmt.Errorf("attachment %s is truncated", a.Uuid)
+	}
+	return data[start:], release, nil
+}
+
+// attachmentReader reads the encrypted contents of an attachment from its
+// file as they're needed, unless fsys can only read files whole or files
+// are mapped, in which case it reads them from memory.
+func (s *opvaultStore) attachmentReader(a *attachmentRecord) (io.ReaderAt, int64, func(), error) {
+	if s.mapFile == nil {
+		f, err := s.fsys.Open(a.path)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if ra, ok := f.(io.ReaderAt); ok {
+			r, size, err := attachmentSection(ra, f)
+			if err != nil {
+				f.Close()
+				return nil, 0, nil, fmt.Errorf("attachment %s: %s", a.Uuid, err)
+			}
+			return r, size, func() { f.Close() }, nil
+		}
+		f.Close()
+	}
+	data, release, err := s.attachmentData(a)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return bytes.NewReader(data), int64(len(data)), release, nil
+}
+
+// attachmentSection returns the part of an attachment file following its
+// header, metadata, and icon.
+func attachmentSection(ra io.ReaderAt, f fs.File) (*io.SectionReader, int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, attachmentHeaderSize)
+	if _, err = ra.ReadAt(buf, 0); err != nil {
+		return nil, 0, err
+	}
+	hdr, err := parseAttachmentHeader(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	start := int64(attachmentHeaderSize + hdr.metadataSize + hdr.iconSize)
+	if start > fi.Size() {
+		return nil, 0, fmt.Errorf("truncated")
+	}
+	return io.NewSectionReader(ra, start, fi.Size()-start), fi.Size() - start, nil
+}
+
+// readBand adds the items of a band file to items, decoding them one at a
+// time as the file is read, so that the text of large bands isn't held
+// whole alongside the items. A band that's truncated or holds garbage is
+// read again whole by recoverBand, and what couldn't be read of it is
+// returned rather than failing.
+func (s *opvaultStore) readBand(name string, items map[string]*bandItem) ([]*BandParseError, error) {
+	r, done, err := s.openFile(path.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	add := func(uuid string, item *bandItem) {
+		items[uuid] = item
+	}
+	err = decodeBand(r, add)
+	done()
+	if err == nil {
+		return nil, nil
+	}
+	var perr *BandParseError
+	if !errors.As(err, &perr) {
+		return nil, err
+	}
+
+	data, release, err := s.readFile(path.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	errs := recoverBand(data, add)
+	if len(errs) == 0 {
+		errs = append(errs, perr)
+	}
+	for _, err := range errs {
+		err.File = name
+	}
+	return errs, nil
+}
+
+// decodeBand decodes the object of uuids to items wrapped in JavaScript by
+// band files, "ld({...});", passing each item to add as it's read. Errors
+// are *BandParseErrors without the file name.
+func decodeBand(r io.Reader, add func(uuid string, item *bandItem)) error {
+	br := bufio.NewReader(r)
+	var start int64
+	for ; ; start++ {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return &BandParseError{Offset: -1, Err: fmt.Errorf("no JSON object found")}
+		} else if err != nil {
+			return &BandParseError{Offset: start, Err: err}
+		}
+		if c == '{' {
+			br.UnreadByte()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	// Syntax errors say where they are; others are found once an item
+	// has been read
+	fail := func(err error) error {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return &BandParseError{Offset: start + syntax.Offset, Err: err}
+		}
+		return &BandParseError{Offset: start + dec.InputOffset(), Err: err}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fail(err)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+		var item bandItem
+		if err = dec.Decode(&item); err != nil {
+			return fail(err)
+		}
+		add(key.(string), &item)
+	}
+	// The end of the object, which the wrapper follows
+	if _, err := dec.Token(); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// bandEntry matches the start of an entry of a band's object: a uuid, then
+// the object of the item's attributes. Attributes aren't objects, so
+// nothing within an item matches.
+var bandEntry = regexp.MustCompile(`("[^"\\]*")\s*:\s*\{`)
+
+// recoverBand decodes as many of the items in a damaged band file as it
+// can, passing each to add as decodeBand does, and returns errors for the
+// parts it had to skip, without the file name. Each entry is decoded on its
+// own, so one that's cut short or mangled costs only its item, and the
+// wrapper around the object may be missing.
+func recoverBand(data []byte, add func(uuid string, item *bandItem)) []*BandParseError {
+	start := bytes.IndexByte(data, '{')
+	if start < 0 {
+		return []*BandParseError{{Offset: -1, Err: fmt.Errorf("no JSON object found")}}
+	}
+	var errs []*BandParseError
+	skipped := func(from, to int, what string) {
+		if junk := bytes.TrimLeft(data[from:to], " \t\r\n,"); len(junk) > 0 {
+			errs = append(errs, &BandParseError{Offset: int64(to - len(junk)), Err: fmt.Errorf("%s", what)})
+		}
+	}
+
+	pos := start + 1
+	failed := false
+	for {
+		m := bandEntry.FindSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		if !failed {
+			skipped(pos, pos+m[0], "garbage between items")
+		}
+		var uuid string
+		obj := pos + m[1] - 1
+		if err := json.Unmarshal(data[pos+m[2]:pos+m[3]], &uuid); err != nil {
+			errs = append(errs, &BandParseError{Offset: int64(pos + m[2]), Err: err})
+			pos, failed = obj+1, true
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(data[obj:]))
+		var item bandItem
+		if err := dec.Decode(&item); err != nil {
+			offset := jsonOffset(int64(obj), err)
+			if offset < 0 {
+				offset = int64(obj)
+			}
+			errs = append(errs, &BandParseError{Offset: offset, Err: fmt.Errorf("item %s: %w", uuid, err)})
+			pos, failed = obj+1, true
+			continue
+		}
+		add(uuid, &item)
+		pos, failed = obj+int(dec.InputOffset()), false
+	}
+
+	// The end of the object, which the wrapper follows
+	if failed {
+		return errs
+	}
+	end := pos
+	for end < len(data) && bytes.IndexByte([]byte(" \t\r\n,"), data[end]) >= 0 {
+		end++
+	}
+	switch {
+	case end == len(data):
+		errs = append(errs, &BandParseError{Offset: int64(end), Err: io.ErrUnexpectedEOF})
+	case data[end] != '}':
+		skipped(pos, len(data), "garbage after the last item")
+	}
+	return errs
+}
+
+// openFile opens a file in fsys for reading, from memory if mapFile is
+// set. done must be called once it's read.
+func (s *opvaultStore) openFile(name string) (r io.Reader, done func(), err error) {
+	if s.mapFile != nil {
+		data, unmap, err := s.mapFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(data), unmap, nil
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// readFile returns the contents of a file in fsys, mapped into memory if
+// mapFile is set. release must be called once they're no longer needed.
+func (s *opvaultStore) readFile(name string) (data []byte, release func(), err error) {
+	if s.mapFile != nil {
+		return s.mapFile(name)
+	}
+	data, err = fs.ReadFile(s.fsys, name)
+	return data, func() {}, err
+}
+
+// itemHMAC computes the HMAC that authenticates an item's attributes in a
+// band file. It covers every attribute but "hmac" itself in key order, each
+// key followed by its value: strings without quotes, booleans as "1" or "0",
+// and anything else as its JSON text.
+func itemHMAC(attrs map[string]json.RawMessage, kp *crypto.KeyPair) []byte {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		if k != "hmac" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	m := hmac.New(sha256.New, kp.MACKey)
+	for _, k := range keys {
+		v := attrs[k]
+		var str string
+		switch {
+		case string(v) == "null":
+			continue
+		case string(v) == "true":
+			str = "1"
+		case string(v) == "false":
+			str = "0"
+		case json.Unmarshal(v, &str) == nil:
+		default:
+			str = string(v)
+		}
+		io.WriteString(m, k)
+		io.WriteString(m, str)
+	}
+	return m.Sum(nil)
+}
+
+// verify checks what reading items doesn't: that the profile is complete,
+// every band parses and holds only its own items, item attributes match
+// their HMACs, folders exist, and every attachment belongs to an item.
+func (s *opvaultStore) verify(overviewKP *crypto.KeyPair) ([]Problem, error) {
+	var problems []Problem
+	add := func(kind, item, att, format string, args ...interface{}) {
+		problems = append(problems, Problem{kind, item, att, fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.prof.Salt) == 0 {
+		add(ProblemProfile, "", "", "missing salt")
+	}
+	if s.prof.Iterations <= 0 {
+		add(ProblemProfile, "", "", "invalid iteration count %d", s.prof.Iterations)
+	}
+
+	folders := make(map[string]bool)
+	data, err := fs.ReadFile(s.fsys, path.Join(s.dir, "folders.js"))
+	if err == nil {
+		var fm map[string]json.RawMessage
+		if err = unmarshalJS(data, &fm); err != nil {
+			add(ProblemFolder, "", "", "folders.js: %s", err)
+		}
+		for uuid := range fm {
+			folders[uuid] = true
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	items := make(map[string]bool)
+	for _, name := range bandNames {
+		data, err := fs.ReadFile(s.fsys, path.Join(s.dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		// The HMAC is over the attributes as stored, so keep them raw
+		var raw map[string]map[string]json.RawMessage
+		var band map[string]*bandItem
+		if err = unmarshalJS(data, &raw); err == nil {
+			err = unmarshalJS(data, &band)
+		}
+		if err != nil {
+			add(ProblemBand, "", "", "%s: %s", name, err)
+			continue
+		}
+		for uuid, attrs := range raw {
+			items[uuid] = true
+			if bandName(uuid) != name {
+				add(ProblemBand, uuid, "", "item is in %s", name)
+			}
+
+			item := band[uuid]
+			if !hmac.Equal(item.Hmac, itemHMAC(attrs, overviewKP)) {
+				add(ProblemItemHMAC, uuid, "", "attributes don't match their HMAC")
+			}
+			if item.Folder != "" && !folders[item.Folder] {
+				add(ProblemFolder, uuid, "", "folder %s doesn't exist", item.Folder)
+			}
+		}
+	}
+
+	names, err := fs.Glob(s.fsys, path.Join(s.dir, "*_*.attachment"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".attachment")
+		i := strings.IndexByte(base, '_')
+		if !items[base[:i]] {
+			add(ProblemOrphanedAttachment, base[:i], base[i+1:], "item doesn't exist")
+		}
+	}
+
+	return problems, nil
+}
+
+// appendToFile adds data to the end of a file in the profile directory,
+// replacing the file if it can't be appended to.
+func (s *opvaultStore) appendToFile(name string, data []byte) error {
+	name = path.Join(s.dir, name)
+	if s.appendFile != nil {
+		return s.appendFile(name, data)
+	}
+	if s.writeFile == nil {
+		return ErrReadOnly
+	}
+	old, err := fs.ReadFile(s.fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.writeFile(name, append(old, data...))
+}
+
+// put writes an item to its band file. Other items in the band are copied
+// as stored, so attributes this package doesn't model survive.
+func (s *opvaultStore) put(r *record, overviewKP *crypto.KeyPair) error {
+	return s.update(func(items map[string]*bandItem) (map[string]*bandItem, error) {
+		item := &bandItem{
+			Uuid:     r.Uuid,
+			Category: r.Category,
+			Created:  r.Created,
+			Updated:  r.Updated,
+			Tx:       r.Tx,
+			Fave:     r.FaveIndex,
+			Folder:   r.Folder,
+			Key:      r.Key,
+			Overview: r.Overview,
+			Details:  r.Details,
+		}
+		if old, ok := items[r.Uuid]; ok {
+			item.Trashed = old.Trashed
+		}
+		return map[string]*bandItem{r.Uuid: item}, nil
+	}, overviewKP)
+}
+
+func (s *opvaultStore) trash(uuid string, at int64, overviewKP *crypto.KeyPair) error {
+	return s.update(func(items map[string]*bandItem) (map[string]*bandItem, error) {
+		old, ok := items[uuid]
+		if !ok {
+			return nil, ErrItemNotFound
+		}
+		item := *old
+		item.Trashed = true
+		item.Updated = at
+		item.Tx = at
+		return map[string]*bandItem{uuid: &item}, nil
+	}, overviewKP)
+}
+
+// lockItem takes the lock, unless fsys can't be locked, and reads the band
+// holding the item with the supplied uuid again. Only that item is
+// replaced, so a watcher still reports other programs' changes to the
+// rest of the band.
+func (s *opvaultStore) lockItem(uuid string) (func(), error) {
+	release := func() {}
+	if s.lock != nil {
+		var err error
+		if release, err = s.lock(); err != nil {
+			return nil, err
+		}
+	}
+	name := bandName(uuid)
+	band := make(map[string]*bandItem)
+	if name != "" {
+		if _, err := s.readBand(name, band); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			release()
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	if s.items != nil && name != "" {
+		if s.bands[name] == nil {
+			s.bands[name] = make(map[string]*bandItem)
+		}
+		if item, ok := band[uuid]; ok {
+			s.items[uuid] = item
+			s.bands[name][uuid] = item
+		} else {
+			delete(s.items, uuid)
+			delete(s.bands[name], uuid)
+		}
+	}
+	s.locked = true
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.locked = false
+		s.mu.Unlock()
+		release()
+	}, nil
+}
+
+// update rewrites the bands holding the items returned by change, which is
+// passed the items as loaded, keyed by uuid. Items returned as nil are
+// removed. The bands are read and rewritten under the lock, so other
+// programs' changes to them aren't lost.
+func (s *opvaultStore) update(change func(items map[string]*bandItem) (map[string]*bandItem, error), overviewKP *crypto.KeyPair) error {
+	if s.writeFile == nil {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	locked := s.locked
+	s.mu.Unlock()
+	if s.lock != nil && !locked {
+		unlock, err := s.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	items, err := s.load()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	loaded := make(map[string]*bandItem, len(items))
+	for uuid, item := range items {
+		loaded[uuid] = item
+	}
+	s.mu.Unlock()
+	changed, err := change(loaded)
+	if err != nil {
+		return err
+	}
+
+	byBand := make(map[string][]string)
+	for uuid := range changed {
+		name := bandName(uuid)
+		if name == "" {
+			return fmt.Errorf("no band holds item %q", uuid)
+		}
+		byBand[name] = append(byBand[name], uuid)
+	}
+	for _, name := range bandNames {
+		if uuids := byBand[name]; len(uuids) > 0 {
+			if err = s.updateBand(name, uuids, changed, overviewKP); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateBand rewrites one band file with the supplied items changed.
+func (s *opvaultStore) updateBand(name string, uuids []string, changed map[string]*bandItem, overviewKP *crypto.KeyPair) error {
+	name = path.Join(s.dir, name)
+	band := make(map[string]map[string]json.RawMessage)
+	data, err := fs.ReadFile(s.fsys, name)
+	if err == nil {
+		if err = unmarshalJS(data, &band); err != nil {
+			return &BandParseError{path.Base(name), jsonOffset(int64(bytes.IndexByte(data, '{')), err), err}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for _, uuid := range uuids {
+		item := changed[uuid]
+		if item == nil {
+			delete(band, uuid)
+			continue
+		}
+		attrs := band[uuid]
+		if attrs == nil {
+			attrs = make(map[string]json.RawMessage)
+			band[uuid] = attrs
+		}
+		set := func(k string, v interface{}) {
+			attrs[k], _ = json.Marshal(v)
+		}
+		set("uuid", item.Uuid)
+		set("category", item.Category)
+		set("created", item.Created)
+		set("updated", item.Updated)
+		set("tx", item.Tx)
+		set("k", item.Key)
+		set("o", item.Overview)
+		set("d", item.Details)
+		if item.Fave != 0 {
+			set("fave", item.Fave)
+		} else {
+			delete(attrs, "fave")
+		}
+		if item.Folder != "" {
+			set("folder", item.Folder)
+		} else {
+			delete(attrs, "folder")
+		}
+		if item.Trashed {
+			set("trashed", true)
+		} else {
+			delete(attrs, "trashed")
+		}
+		delete(attrs, "hmac")
+		item.Hmac = itemHMAC(attrs, overviewKP)
+		set("hmac", item.Hmac)
+	}
+
+	data, err = json.Marshal(band)
+	if err != nil {
+		return err
+	}
+	if err = s.writeFile(name, append(append([]byte("ld("), data...), ");"...)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	key := path.Base(name)
+	if s.bands[key] == nil {
+		s.bands[key] = make(map[string]*bandItem)
+	}
+	for _, uuid := range uuids {
+		if changed[uuid] == nil {
+			delete(s.items, uuid)
+			delete(s.bands[key], uuid)
+		} else {
+			s.items[uuid] = changed[uuid]
+			s.bands[key][uuid] = changed[uuid]
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *opvaultStore) close() error {
+	if c, ok := s.fsys.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,1182 @@
+package onepassword
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+const testPassword = "freddy"
+
+// opvaultFixture builds an OPVault profile in memory.
+type opvaultFixture struct {
+	t     testing.TB
+	fsys  fstest.MapFS
+	mkp   *crypto.KeyPair
+	okp   *crypto.KeyPair
+	band  map[string]*bandItem
+	items map[string]*crypto.KeyPair
+}
+
+func randomBytes(t testing.TB, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustJSON(t testing.TB, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func mustEncrypt(t testing.TB, plaintext []byte, kp *crypto.KeyPair) []byte {
+	opdata, err := crypto.EncryptOPData01(plaintext, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opdata
+}
+
+// Uuids of items saved by tests, which have to be in the form NewUUID
+// returns. The first character picks the band, as with the short uuids
+// used by tests that only read.
+const (
+	uuidA1 = "A1000000000000000000000000000000"
+	uuidB2 = "B2000000000000000000000000000000"
+	uuidC3 = "C3000000000000000000000000000000"
+	uuidD4 = "D4000000000000000000000000000000"
+	uuidE5 = "E5000000000000000000000000000000"
+)
+
+func newOPVaultFixture(t testing.TB) *opvaultFixture {
+	f := &opvaultFixture{
+		t:     t,
+		fsys:  fstest.MapFS{},
+		band:  make(map[string]*bandItem),
+		items: make(map[string]*crypto.KeyPair),
+	}
+
+	salt := randomBytes(t, 16)
+	derived := crypto.ComputeDerivedKeys(testPassword, salt, 100)
+	profileKeys := func() ([]byte, *crypto.KeyPair) {
+		plain := randomBytes(t, 256)
+		sum := sha512.Sum512(plain)
+		return mustEncrypt(t, plain, derived), &crypto.KeyPair{EncKey: sum[:32], MACKey: sum[32:]}
+	}
+	var mk, ok []byte
+	mk, f.mkp = profileKeys()
+	ok, f.okp = profileKeys()
+
+	prof := mustJSON(t, opvaultProfile{salt, 100, mk, ok})
+	f.fsys["default/profile.js"] = &fstest.MapFile{Data: append(append([]byte("var profile="), prof...), ';')}
+	return f
+}
+
+func (f *opvaultFixture) addItem(uuid, category string, overview, details string, trashed bool) {
+	f.putItem(uuid, category, overview, details, trashed)
+	f.writeBand(uuid[:1])
+}
+
+// putItem adds an item to the fixture without writing its band, for
+// adding many before writing each band once.
+func (f *opvaultFixture) putItem(uuid, category string, overview, details string, trashed bool) {
+	kp := &crypto.KeyPair{EncKey: randomBytes(f.t, 32), MACKey: randomBytes(f.t, 32)}
+	k, err := crypto.EncryptItemKey(kp, f.mkp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.items[uuid] = kp
+	f.band[uuid] = &bandItem{
+		Uuid:     uuid,
+		Category: category,
+		Created:  1500000000,
+		Updated:  1600000000,
+		Trashed:  trashed,
+		Key:      k,
+		Overview: mustEncrypt(f.t, []byte(overview), f.okp),
+		Details:  mustEncrypt(f.t, []byte(details), kp),
+	}
+}
+
+// writeBand writes the items whose uuids start with c to their band file,
+// computing their HMACs.
+func (f *opvaultFixture) writeBand(c string) {
+	band := make(map[string]map[string]json.RawMessage)
+	for uuid, item := range f.band {
+		if uuid[:1] != c {
+			continue
+		}
+		item.Hmac = nil
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(mustJSON(f.t, item), &attrs); err != nil {
+			f.t.Fatal(err)
+		}
+		item.Hmac = itemHMAC(attrs, f.okp)
+		attrs["hmac"] = mustJSON(f.t, item.Hmac)
+		band[uuid] = attrs
+	}
+	data := mustJSON(f.t, band)
+	f.fsys["default/band_"+c+".js"] = &fstest.MapFile{Data: append(append([]byte("ld("), data...), ");"...)}
+}
+
+func (f *opvaultFixture) addAttachment(itemUuid, uuid, name string, contents []byte) {
+	meta := mustJSON(f.t, attachmentMetadata{
+		Uuid:         uuid,
+		ItemUuid:     itemUuid,
+		ContentsSize: int64(len(contents)),
+		Overview:     mustEncrypt(f.t, mustJSON(f.t, attachmentOverview{name}), f.okp),
+	})
+	hdr := make([]byte, attachmentHeaderSize)
+	copy(hdr, attachmentMagic)
+	hdr[7] = 1
+	binary.LittleEndian.PutUint16(hdr[8:], uint16(len(meta)))
+	data := append(append(hdr, meta...), mustEncrypt(f.t, contents, f.items[itemUuid])...)
+	f.fsys["default/"+itemUuid+"_"+uuid+".attachment"] = &fstest.MapFile{Data: data}
+}
+
+func (f *opvaultFixture) open() *Vault {
+	st, err := openOPVaultStore(f.fsys, "default")
+	if err != nil {
+		f.t.Fatalf("Failed opening store: %s", err)
+	}
+	st.writeFile = func(name string, data []byte) error {
+		f.fsys[name] = &fstest.MapFile{Data: data}
+		return nil
+	}
+	v, err := newVault(context.Background(), testPassword, st)
+	if err != nil {
+		f.t.Fatalf("Failed unlocking vault: %s", err)
+	}
+	return v
+}
+
+func TestOPVaultItems(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub","ainfo":"wendy"}`, loginDetails, false)
+	f.addItem("B2", CatSSN.Uuid, `{"title":"Social Security"}`, ssnDetails, false)
+	f.addItem("B3", CatLogin.Uuid, `{"title":"Old"}`, loginDetails, true)
+	v := f.open()
+
+	items, err := v.Items()
+	if err != nil {
+		t.Fatalf("Failed reading items: %s", err)
+	}
+	if len(items) != 2 || items[0].Title != "GitHub" || items[1].Category != CatSSN {
+		t.Fatalf("Unexpected items: %+v", items)
+	}
+	if items[0].Password() != "hunter2" || items[0].Created.Unix() != 1500000000 {
+		t.Fatalf("Unexpected login: %+v", items[0])
+	}
+
+	if _, err = v.Item("B3"); err != ErrItemNotFound {
+		t.Fatalf("Expected trashed items to be hidden. Got %v.", err)
+	}
+	if _, err = newVault(context.Background(), "wrong", v.store); err == nil {
+		t.Fatalf("Expected the wrong password to fail.")
+	}
+
+	v, err = NewVaultFSWithKeys(f.fsys, "default", v.DerivedKeys())
+	if err != nil {
+		t.Fatalf("Failed opening vault from fs: %s", err)
+	}
+	if item, err := v.Item("A1"); err != nil || item.Title != "GitHub" {
+		t.Fatalf("Expected GitHub from fs. Got %+v, %v.", item, err)
+	}
+	if _, err = NewVaultFS(f.fsys, "default", "wrong"); err != ErrWrongPassword {
+		t.Fatalf("Expected the wrong password to fail. Got %v.", err)
+	}
+}
+
+func TestWriteAttachment(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatDocument.Uuid, `{"title":"Backup"}`, `{}`, false)
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	f.addAttachment("A1", "C3", "backup.tar", contents)
+	dir := t.TempDir()
+	writeFixture(t, f, dir)
+	disk, err := NewVault(testPassword, VaultConfig{DBPath: dir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer disk.Close()
+
+	for _, v := range []*Vault{f.open(), disk} {
+		item, err := v.Item("A1")
+		if err != nil {
+			t.Fatalf("Failed reading item: %s", err)
+		}
+		atts, err := v.Attachments(item)
+		if err != nil || len(atts) != 1 {
+			t.Fatalf("Expected the attachment. Got %+v, %v.", atts, err)
+		}
+		var out bytes.Buffer
+		calls := 0
+		n, err := v.WriteAttachment(context.Background(), &out, &atts[0], func(written, total int64) {
+			calls++
+		})
+		if err != nil {
+			t.Fatalf("Failed writing attachment: %s", err)
+		}
+		if n != int64(len(contents)) || !bytes.Equal(out.Bytes(), contents) {
+			t.Errorf("Expected the contents. Got %d bytes.", n)
+		}
+		if calls < 2 {
+			t.Errorf("Expected progress for each chunk. Got %d calls.", calls)
+		}
+	}
+}
+
+func TestPreload(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v, err := NewVaultFS(f.fsys, "default", testPassword)
+	if err != nil {
+		t.Fatalf("Failed unlocking vault: %s", err)
+	}
+	// Read while the keys were derived
+	if st := v.store.(*opvaultStore); st.items == nil || st.items["A1"] == nil {
+		t.Errorf("Expected the bands loaded on unlocking")
+	}
+
+	// Bands that can't be read don't stop unlocking, but fail reads
+	f.fsys["default/band_A.js"].Data = []byte("ld({")
+	if v, err = NewVaultFS(f.fsys, "default", testPassword); err != nil {
+		t.Fatalf("Failed unlocking vault: %s", err)
+	}
+	if _, err = v.Item("A1"); err == nil {
+		t.Errorf("Expected an error reading a corrupt band")
+	}
+}
+
+func TestReloadBand(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("A2", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	f.addItem("B1", CatLogin.Uuid, `{"title":"Bitbucket"}`, loginDetails, false)
+	v := f.open()
+	st := v.store.(*opvaultStore)
+	if _, err := v.Item("A1"); err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+
+	// Another program adds A3 and removes A2
+	f.putItem("A3", CatLogin.Uuid, `{"title":"Gitea"}`, loginDetails, false)
+	delete(f.band, "A2")
+	f.writeBand("A")
+	events, err := st.reloadBand("band_A.js", time.Now())
+	if err != nil {
+		t.Fatalf("Failed reloading band: %s", err)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev.Kind+" "+ev.Uuid)
+	}
+	if want := []string{ItemDeleted + " A2", ItemAdded + " A3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v. Got %v.", want, got)
+	}
+	if item, err := v.Item("A3"); err != nil || item.Title != "Gitea" {
+		t.Errorf("Expected the added item. Got %+v, %v.", item, err)
+	}
+	if _, err = v.Item("A2"); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound for the removed item. Got %v.", err)
+	}
+	if len(st.bands["band_A.js"]) != 2 || len(st.bands["band_B.js"]) != 1 || len(st.items) != 3 {
+		t.Errorf("Expected the index to follow the band. Got %d items.", len(st.items))
+	}
+}
+
+func TestSkipTombstones(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.putItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.putItem("B1", CatTombstone.Uuid, `{}`, `{}`, false)
+	f.putItem("C1", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, true)
+	// Overviews that would fail to decrypt show which are skipped
+	f.band["B1"].Overview = []byte("opdata01")
+	for _, c := range []string{"A", "B", "C"} {
+		f.writeBand(c)
+	}
+	writeFixture(t, f, dir)
+
+	for _, tombstones := range []bool{false, true} {
+		v, err := NewVault(testPassword, VaultConfig{DBPath: dir, Profile: "default", Tombstones: tombstones})
+		if err != nil {
+			t.Fatalf("Failed opening vault: %s", err)
+		}
+		items, err := v.Overviews()
+		if tombstones && err == nil {
+			t.Errorf("Expected the tombstone's overview decrypted when asked for")
+		} else if !tombstones && (err != nil || len(items) != 1 || items[0].Uuid != "A1") {
+			t.Errorf("Expected only A1. Got %v, %v.", items, err)
+		}
+		if !tombstones {
+			if items, err = v.Items(); err != nil || len(items) != 1 {
+				t.Errorf("Expected only A1 among the items. Got %v, %v.", items, err)
+			}
+			if items, err = v.Trash(); err != nil || len(items) != 1 || items[0].Title != "GitLab" {
+				t.Errorf("Expected C1 in the trash. Got %v, %v.", items, err)
+			}
+		}
+		v.Close()
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("B1", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	f.band["B1"].Details[40] ^= 1
+	f.writeBand("B")
+
+	_, err := f.open().Item("B1")
+	var de *ItemDecryptError
+	if !errors.As(err, &de) || de.Uuid != "B1" || de.Part != "details" || !errors.Is(err, crypto.ErrIncorrectMAC) {
+		t.Errorf("Expected an ItemDecryptError for B1's details. Got %v.", err)
+	}
+
+	_, err = NewVaultFS(f.fsys, "work", testPassword)
+	var pe *ProfileError
+	if !errors.As(err, &pe) || pe.File != "work/profile.js" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a ProfileError for a missing profile. Got %v.", err)
+	}
+
+	f.fsys["default/band_A.js"].Data = []byte(`ld({"A1":{"uuid":"A1","created":"yesterday"}});`)
+	v := f.open()
+	if _, err = v.Item("A1"); err != ErrItemNotFound {
+		t.Errorf("Expected the unreadable A1 to be skipped. Got %v.", err)
+	}
+	errs, err := v.BandErrors()
+	if err != nil || len(errs) != 1 || errs[0].File != "band_A.js" || errs[0].Offset != 43 {
+		t.Errorf("Expected a BandParseError for A1's creation time in band_A.js. Got %v, %v.", errs, err)
+	}
+}
+
+func TestDecodeBand(t *testing.T) {
+	var uuids []string
+	add := func(uuid string, item *bandItem) {
+		uuids = append(uuids, uuid+"/"+item.Category)
+	}
+	band := `ld({"A1":{"uuid":"A1","category":"001"},"A2":{"uuid":"A2","category":"005"}});`
+	if err := decodeBand(strings.NewReader(band), add); err != nil {
+		t.Fatalf("Failed decoding band: %s", err)
+	}
+	if want := []string{"A1/001", "A2/005"}; !reflect.DeepEqual(uuids, want) {
+		t.Errorf("Decoded %v, want %v", uuids, want)
+	}
+
+	for _, band := range []string{"", "ld(", `ld({"A1":{"uuid":`, `ld({"A1":[]});`} {
+		if err := decodeBand(strings.NewReader(band), add); err == nil {
+			t.Errorf("Expected an error decoding %q", band)
+		}
+	}
+}
+
+func TestRecoverBand(t *testing.T) {
+	a1 := `"A1":{"uuid":"A1","category":"001"}`
+	a2 := `"A2":{"uuid":"A2","category":"005"}`
+	for _, tc := range []struct {
+		band    string
+		uuids   []string
+		offsets []int64
+	}{
+		{"\ufeffld({" + a1 + "," + a2 + "});", []string{"A1", "A2"}, nil},
+		{"{" + a1 + "," + a2 + "}", []string{"A1", "A2"}, nil},
+		{"ld({" + a1 + "," + a2[:20], []string{"A1"}, []int64{45}},
+		{"ld({" + a1 + ",", []string{"A1"}, []int64{40}},
+		{"ld({" + a1 + `,"A3":{"uuid":3},` + a2 + "});", []string{"A1", "A2"}, []int64{54}},
+		{"ld({" + a1 + ",xyzzy," + a2 + "});", []string{"A1", "A2"}, []int64{40}},
+		{"ld({" + a1 + "," + a2 + "xyzzy});", []string{"A1", "A2"}, []int64{75}},
+		{"garbage", nil, []int64{-1}},
+	} {
+		var uuids []string
+		errs := recoverBand([]byte(tc.band), func(uuid string, item *bandItem) {
+			uuids = append(uuids, uuid)
+		})
+		var offsets []int64
+		for _, err := range errs {
+			offsets = append(offsets, err.Offset)
+		}
+		if !reflect.DeepEqual(uuids, tc.uuids) || !reflect.DeepEqual(offsets, tc.offsets) {
+			t.Errorf("Recovered %v with errors at %v from %q, want %v at %v", uuids, offsets, tc.band, tc.uuids, tc.offsets)
+		}
+	}
+}
+
+func TestOPVaultAttachments(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatDocument.Uuid, `{"title":"Passport scan"}`, `{}`, false)
+	f.addAttachment("A1", "C3", "scan.pdf", []byte("%PDF-1.4"))
+	v := f.open()
+
+	item, err := v.Item("A1")
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	atts, err := v.Attachments(item)
+	if err != nil {
+		t.Fatalf("Failed listing attachments: %s", err)
+	}
+	if len(atts) != 1 || atts[0].Name != "scan.pdf" || atts[0].Size != 8 || atts[0].Uuid != "C3" {
+		t.Fatalf("Unexpected attachments: %+v", atts)
+	}
+	data, err := v.ReadAttachment(&atts[0])
+	if err != nil {
+		t.Fatalf("Failed reading attachment: %s", err)
+	} else if string(data) != "%PDF-1.4" {
+		t.Fatalf("Unexpected contents %q", data)
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatDocument.Uuid, `{"title":"Passport scan"}`, loginDetails, false)
+	f.addAttachment("A1", "C3", "scan.pdf", []byte("%PDF-1.4"))
+	v := f.open()
+
+	buf, err := v.DetailsBuffer("A1")
+	if err != nil {
+		t.Fatalf("Failed decrypting details: %s", err)
+	} else if string(buf.Bytes()) != loginDetails {
+		t.Errorf("Expected the details. Got %q.", buf.Bytes())
+	}
+	details := buf.Bytes()
+	buf.Release()
+	if !bytes.Equal(details, make([]byte, len(details))) {
+		t.Errorf("Expected the details zeroed on release. Got %q.", details)
+	}
+
+	item, err := v.Item("A1")
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	atts, err := v.Attachments(item)
+	if err != nil || len(atts) != 1 {
+		t.Fatalf("Expected the attachment. Got %+v, %v.", atts, err)
+	}
+	if buf, err = v.AttachmentBuffer(&atts[0]); err != nil || string(buf.Bytes()) != "%PDF-1.4" {
+		t.Fatalf("Expected the contents. Got %v.", err)
+	}
+	buf.Release()
+	if _, err = v.DetailsBuffer("F0"); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound. Got %v.", err)
+	}
+}
+
+func TestMemoryMap(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatDocument.Uuid, `{"title":"Passport scan"}`, `{}`, false)
+	f.addAttachment("A1", "C3", "scan.pdf", []byte("%PDF-1.4"))
+	writeFixture(t, f, dir)
+	v, err := NewVault(testPassword, VaultConfig{DBPath: dir, Profile: "default", MemoryMap: true})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer v.Close()
+
+	item, err := v.Item("A1")
+	if err != nil || item.Title != "Passport scan" {
+		t.Fatalf("Expected the item. Got %+v, %v.", item, err)
+	}
+	atts, err := v.Attachments(item)
+	if err != nil || len(atts) != 1 {
+		t.Fatalf("Expected the attachment. Got %+v, %v.", atts, err)
+	}
+	data, err := v.ReadAttachment(&atts[0])
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Errorf("Unexpected contents %q, %v", data, err)
+	}
+}
+
+func TestDecryptOverviews(t *testing.T) {
+	f := newOPVaultFixture(t)
+	titles := make(map[string]string)
+	var uuids []string
+	for i := 0; i < 20; i++ {
+		uuid := NewUUID()
+		titles[uuid] = fmt.Sprintf("Item %d", i)
+		f.addItem(uuid, CatLogin.Uuid, fmt.Sprintf(`{"title":%q}`, titles[uuid]), loginDetails, false)
+		uuids = append(uuids, uuid)
+	}
+	v := f.open()
+
+	items, err := v.DecryptOverviews(context.Background(), uuids, 4)
+	if err != nil {
+		t.Fatalf("Failed decrypting: %s", err)
+	}
+	for i, item := range items {
+		if item.Uuid != uuids[i] || item.Title != titles[uuids[i]] || item.Details != nil {
+			t.Errorf("Expected the overview of %s. Got %+v.", uuids[i], item)
+		}
+	}
+
+	if _, err = v.DecryptOverviews(context.Background(), []string{"F0"}, 4); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound. Got %v.", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = v.DecryptOverviews(ctx, uuids, 4); err != context.Canceled {
+		t.Errorf("Expected context.Canceled. Got %v.", err)
+	}
+	// A corrupt overview fails the batch
+	f.band[uuids[7]].Overview[40] ^= 1
+	f.writeBand(uuids[7][:1])
+	if _, err = f.open().DecryptOverviews(context.Background(), uuids, 4); !errors.Is(err, crypto.ErrIncorrectMAC) {
+		t.Errorf("Expected ErrIncorrectMAC. Got %v.", err)
+	}
+}
+
+func TestFolders(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.band["A1"].Folder = "F2"
+	f.writeBand("A")
+	folders := map[string]interface{}{
+		"F1": folderRecord{Uuid: "F1", Overview: mustEncrypt(t, []byte(`{"title":"Work"}`), f.okp)},
+		"F2": folderRecord{Uuid: "F2", Parent: "F1", Overview: mustEncrypt(t, []byte(`{"title":"Code"}`), f.okp)},
+		"F3": folderRecord{Uuid: "F3", Smart: true, Overview: mustEncrypt(t, []byte(`{"title":"Weak"}`), f.okp)},
+	}
+	f.fsys["default/folders.js"] = &fstest.MapFile{Data: append(append([]byte("loadFolders("), mustJSON(t, folders)...), ");"...)}
+	v := f.open()
+
+	fs, err := v.Folders()
+	if err != nil {
+		t.Fatalf("Failed reading folders: %s", err)
+	}
+	want := []Folder{{"F2", "Code", "F1"}, {"F1", "Work", ""}}
+	if !reflect.DeepEqual(fs, want) {
+		t.Fatalf("Expected folders %+v. Got %+v.", want, fs)
+	}
+	item, err := v.Item("A1")
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	} else if item.Folder != "F2" {
+		t.Fatalf("Expected the item to be in F2. Got %q.", item.Folder)
+	}
+}
+
+func TestInject(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"Production DB"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"Staging DB"}`, loginDetails, false)
+	v := f.open()
+
+	var b bytes.Buffer
+	err := v.Inject(&b, `{{ secret "production db" "username" }}:{{ secret "Production DB/password" }}`)
+	if err != nil {
+		t.Fatalf("Failed rendering: %s", err)
+	} else if b.String() != "wendy:hunter2" {
+		t.Fatalf("Unexpected output %q", b.String())
+	}
+
+	err = v.Inject(&b, `{{ secret "DB/password" }}`)
+	var amb *AmbiguousQueryError
+	if !errors.As(err, &amb) || len(amb.Matches) != 2 {
+		t.Fatalf("Expected an ambiguous query. Got %v.", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v := f.open()
+	v.dbPath = "/home/wendy/Personal.opvault"
+	v.profile = "default"
+
+	for _, ref := range []string{"opvault://Personal/GitHub/password", "opvault:///A1/password", "opvault://default/github/password"} {
+		if got, err := v.Resolve(ref); err != nil || got != "hunter2" {
+			t.Errorf("Resolve(%q) = %q, %v", ref, got, err)
+		}
+	}
+	if _, err := v.Resolve("opvault://Work/GitHub/password"); err == nil {
+		t.Errorf("Expected references to other vaults to fail.")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatDocument.Uuid, `{"title":"Passport scan"}`, `{}`, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"Old"}`, loginDetails, true)
+	f.addAttachment("A1", "C3", "scan.pdf", []byte("%PDF-1.4"))
+	v := f.open()
+
+	r, err := v.Verify()
+	if err != nil {
+		t.Fatalf("Failed verifying: %s", err)
+	} else if !r.OK() || r.Items != 2 || r.Attachments != 1 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+
+	// Move an item to another folder without updating its HMAC, corrupt
+	// the trashed item's details, and orphan an attachment
+	f.band["A1"].Folder = "F1"
+	band := f.fsys["default/band_A.js"].Data
+	f.fsys["default/band_A.js"].Data = bytes.Replace(band, []byte(`"folder":""`), []byte(`"folder":"F1"`), 1)
+	f.band["B2"].Details[len(f.band["B2"].Details)-1] ^= 1
+	f.writeBand("B")
+	f.fsys["default/D4_E5.attachment"] = f.fsys["default/A1_C3.attachment"]
+
+	r, err = f.open().Verify()
+	if err != nil {
+		t.Fatalf("Failed verifying: %s", err)
+	}
+	var kinds []string
+	for _, p := range r.Problems {
+		kinds = append(kinds, p.Kind+" "+p.Item)
+	}
+	want := []string{"folder A1", "item-hmac A1", "details B2", "orphaned-attachment D4"}
+	if len(kinds) != len(want) {
+		t.Fatalf("Expected problems %v. Got %v.", want, r.Problems)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("Expected problems %v. Got %v.", want, r.Problems)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	f1 := newOPVaultFixture(t)
+	f1.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f1.addItem("B2", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	f1.addItem("C3", CatLogin.Uuid, `{"title":"Bitbucket"}`, loginDetails, false)
+
+	// The same items as they'd look after a sync, which re-encrypts them
+	f2 := newOPVaultFixture(t)
+	f2.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f2.addItem("B2", CatLogin.Uuid, `{"title":"GitLab","tags":["work"]}`, strings.Replace(loginDetails, "hunter2", "hunter3", 1), false)
+	f2.band["B2"].Tx = 2
+	f2.writeBand("B")
+	f2.addItem("D4", CatLogin.Uuid, `{"title":"Gitea"}`, loginDetails, false)
+
+	d, err := Diff(f1.open(), f2.open())
+	if err != nil {
+		t.Fatalf("Failed comparing vaults: %s", err)
+	}
+	if len(d.Added) != 1 || d.Added[0].Uuid != "D4" || len(d.Removed) != 1 || d.Removed[0].Title != "Bitbucket" {
+		t.Fatalf("Unexpected added or removed items: %+v", d)
+	}
+	if len(d.Modified) != 1 {
+		t.Fatalf("Expected one modified item. Got %+v.", d.Modified)
+	}
+	want := []FieldChange{{"tags", "", "work", false}, {"password", "hunter2", "hunter3", true}}
+	if !reflect.DeepEqual(d.Modified[0].Changes, want) {
+		t.Fatalf("Expected changes %+v. Got %+v.", want, d.Modified[0].Changes)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dst := newOPVaultFixture(t)
+	dst.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	dst.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	dst.addItem(uuidC3, CatLogin.Uuid, `{"title":"Bitbucket"}`, loginDetails, false)
+	dst.addItem(uuidE5, CatLogin.Uuid, `{"title":"Trashed"}`, loginDetails, true)
+	dst.band[uuidC3].Tx = 3
+	dst.writeBand("C")
+
+	src := newOPVaultFixture(t)
+	src.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	src.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, strings.Replace(loginDetails, "hunter2", "hunter3", 1), false)
+	src.addItem(uuidC3, CatLogin.Uuid, `{"title":"Bitbucket"}`, strings.Replace(loginDetails, "hunter2", "hunter4", 1), false)
+	src.addItem(uuidD4, CatLogin.Uuid, `{"title":"Gitea"}`, loginDetails, false)
+	src.addItem(uuidE5, CatLogin.Uuid, `{"title":"Restored"}`, loginDetails, false)
+	src.band[uuidB2].Tx = 2
+	src.writeBand("B")
+
+	var conflicts []string
+	newest := func(c *MergeConflict) (bool, error) {
+		conflicts = append(conflicts, c.Src.Uuid)
+		return NewestWins(c)
+	}
+	v := dst.open()
+	res, err := Merge(v, src.open(), newest)
+	if err != nil {
+		t.Fatalf("Failed merging: %s", err)
+	}
+	want := &MergeResult{Added: []string{uuidD4}, Replaced: []string{uuidB2}, Kept: []string{uuidC3}}
+	if !reflect.DeepEqual(res, want) || !reflect.DeepEqual(conflicts, []string{uuidB2, uuidC3}) {
+		t.Fatalf("Expected %+v. Got %+v after conflicts %v.", want, res, conflicts)
+	}
+
+	// Losing passwords are kept in the history
+	v = dst.open()
+	for uuid, c := range map[string]struct{ password, history string }{
+		uuidB2: {"hunter3", "hunter2"},
+		uuidC3: {"hunter2", "hunter4"},
+	} {
+		item, err := v.Item(uuid)
+		if err != nil {
+			t.Fatalf("Failed reading %s: %s", uuid, err)
+		}
+		h := item.PasswordHistory()
+		if item.Password() != c.password || len(h) != 1 || h[0].Value != c.history {
+			t.Errorf("Expected %s to have password %s and history %s. Got %s and %+v.", uuid, c.password, c.history, item.Password(), h)
+		}
+	}
+	if item, err := v.Item(uuidD4); err != nil || item.Title != "Gitea" || item.Created.Unix() != 1500000000 {
+		t.Errorf("Expected the added item. Got %+v, %v.", item, err)
+	}
+	if _, err := v.Item(uuidE5); err != ErrItemNotFound {
+		t.Errorf("Expected the trashed item to stay trashed. Got %v.", err)
+	}
+
+	// Merging again changes nothing, and preferring the destination never
+	// replaces items
+	res, err = Merge(dst.open(), src.open(), PreferDestination)
+	if err != nil {
+		t.Fatalf("Failed merging again: %s", err)
+	}
+	if len(res.Added) != 0 || len(res.Replaced) != 0 {
+		t.Errorf("Expected only kept items. Got %+v.", res)
+	}
+	stop := errors.New("stop")
+	if _, err = Merge(dst.open(), src.open(), func(*MergeConflict) (bool, error) { return false, stop }); err != stop {
+		t.Errorf("Expected the strategy's error. Got %v.", err)
+	}
+}
+
+func TestSaveItem(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub","ainfo":"wendy","ps":42}`, loginDetails, false)
+	v := f.open()
+
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Title = "GitHub Enterprise"
+	if err = item.SetPassword("hunter3", time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	created := NewItemFromTemplate(CatSecureNote)
+	created.Title = "Recovery codes"
+	if err = v.SaveItem(created); err != nil {
+		t.Fatalf("Failed creating item: %s", err)
+	}
+
+	// Reopen to read back what was written
+	v = f.open()
+	item, err = v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading saved item: %s", err)
+	}
+	if item.Title != "GitHub Enterprise" || item.Password() != "hunter3" || item.Strength != 42 || item.Created.Unix() != 1500000000 {
+		t.Fatalf("Unexpected saved item: %+v", item)
+	}
+	if item, err = v.Item(created.Uuid); err != nil || item.Title != "Recovery codes" {
+		t.Fatalf("Expected the new item. Got %+v, %v.", item, err)
+	}
+	if r, err := v.Verify(); err != nil || !r.OK() {
+		t.Fatalf("Expected saved items to verify. Got %+v, %v.", r, err)
+	}
+}
+
+func TestSaveItemFolder(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.band[uuidA1].Folder = "F1"
+	f.writeBand("A")
+	v := f.open()
+
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Folder = "F2"
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed moving item: %s", err)
+	}
+	if item, err = f.open().Item(uuidA1); err != nil || item.Folder != "F2" {
+		t.Fatalf("Expected the item to move to F2. Got %+v, %v.", item, err)
+	}
+
+	// An empty folder takes the item out of F2
+	item.Folder = ""
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed removing item from its folder: %s", err)
+	}
+	if item, err = f.open().Item(uuidA1); err != nil || item.Folder != "" {
+		t.Fatalf("Expected the item in no folder. Got %+v, %v.", item, err)
+	}
+}
+
+func TestSaveItemInvalidUUID(t *testing.T) {
+	f := newOPVaultFixture(t)
+	v := f.open()
+
+	// 1PUX uuids are lowercase base32
+	item := NewItemFromTemplate(CatLogin)
+	item.Uuid = "pvlhpxlwvnvlgmz3m5mrbwqrwy"
+	if err := v.SaveItem(item); !errors.Is(err, ErrInvalidUUID) {
+		t.Fatalf("Expected ErrInvalidUUID. Got %v.", err)
+	}
+	if err := v.store.(*opvaultStore).put(&record{Uuid: item.Uuid}, v.overviewKP); err == nil {
+		t.Fatalf("Expected writing an item no band holds to fail")
+	}
+	if _, ok := f.fsys["default/band_P.js"]; ok {
+		t.Fatalf("Expected no band written")
+	}
+}
+
+// remoteWriterFS is a remote filesystem whose writes fail with err.
+type remoteWriterFS struct {
+	fstest.MapFS
+	err error
+}
+
+func (r remoteWriterFS) WriteFile(name string, data []byte) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.MapFS[name] = &fstest.MapFile{Data: data}
+	return nil
+}
+
+func TestRemoteWrite(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	u, _ := url.Parse("fake://example.com/1Password.opvault")
+	conflict := errors.New("band changed")
+
+	for _, c := range []struct {
+		fsys fs.FS
+		want error
+	}{
+		{f.fsys, ErrReadOnly},
+		{remoteWriterFS{f.fsys, &fs.PathError{Op: "write", Path: "default/band_A.js", Err: fs.ErrPermission}}, ErrReadOnly},
+		{remoteWriterFS{f.fsys, conflict}, conflict},
+		{remoteWriterFS{f.fsys, nil}, nil},
+	} {
+		st, err := openRemoteStore(u, func(*url.URL) (fs.FS, error) { return c.fsys, nil }, "default")
+		if err != nil {
+			t.Fatalf("Failed opening store: %s", err)
+		}
+		v, err := newVault(context.Background(), testPassword, st)
+		if err != nil {
+			t.Fatalf("Failed unlocking vault: %s", err)
+		}
+		item, err := v.Item(uuidA1)
+		if err != nil {
+			t.Fatalf("Failed reading item: %s", err)
+		}
+		item.Title = "GitHub Enterprise"
+		if err = v.SaveItem(item); err != c.want {
+			t.Errorf("Saving to %T: expected %v, got %v", c.fsys, c.want, err)
+		}
+	}
+}
+
+func TestMergeFields(t *testing.T) {
+	dst := newOPVaultFixture(t)
+	dst.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	dst.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	src := newOPVaultFixture(t)
+	src.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	// Changed later, by a program not keeping clocks
+	src.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab CE"}`, loginDetails, false)
+	src.band[uuidB2].Updated++
+	src.writeBand("B")
+
+	// Each copy changes a different field of A1
+	dv, sv := dst.open(), src.open()
+	dv.fieldClocks, sv.fieldClocks = true, true
+	item, err := dv.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Title = "GitHub Enterprise"
+	if err = dv.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	// In another second, as items whose transactions agree aren't merged
+	time.Sleep(time.Second)
+	if item, err = sv.Item(uuidA1); err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	if err = item.SetPassword("hunter3", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = sv.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+
+	res, err := MergeFields(dv, sv)
+	if err != nil {
+		t.Fatalf("Failed merging: %s", err)
+	}
+	if want := (&MergeResult{Merged: []string{uuidA1, uuidB2}}); !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %+v. Got %+v.", want, res)
+	}
+	// Both changes survive
+	if item, err = dv.Item(uuidA1); err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	if h := item.PasswordHistory(); item.Title != "GitHub Enterprise" || item.Password() != "hunter3" || len(h) != 1 || h[0].Value != "hunter2" {
+		t.Errorf("Expected both changes. Got %q, %q, %+v.", item.Title, item.Password(), h)
+	}
+	if b2, err := dv.Item(uuidB2); err != nil || b2.Title != "GitLab CE" {
+		t.Errorf("Expected the later title. Got %+v, %v.", b2, err)
+	}
+
+	// The source hasn't seen the new title, but the clocks show it's newer
+	srcItem, err := sv.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	if _, changed, err := mergeFields(item, srcItem); err != nil || changed {
+		t.Errorf("Expected nothing to merge again. Got %v, %v.", changed, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v := f.open()
+	start := time.Now().Add(-time.Second)
+
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Title = "GitHub Enterprise"
+	if err = item.SetPassword("hunter3", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	created := NewItemFromTemplate(CatSecureNote)
+	created.Title = "Recovery codes"
+	if err = v.SaveItem(created); err != nil {
+		t.Fatalf("Failed creating item: %s", err)
+	}
+	// Lines that can't be read, as from a sync conflict, are skipped
+	journal := f.fsys["default/"+journalFile]
+	journal.Data = append([]byte("garbage\n"), journal.Data...)
+
+	entries, err := f.open().History(HistoryQuery{})
+	if err != nil {
+		t.Fatalf("Failed reading history: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries. Got %+v.", entries)
+	}
+	e := entries[0]
+	if e.Action != ItemModified || e.Uuid != uuidA1 || e.Title != "GitHub Enterprise" || e.Category != "Login" ||
+		!reflect.DeepEqual(e.Fields, []string{"title", "password"}) || e.User != journalUser() || e.Time.Before(start) {
+		t.Errorf("Unexpected entry for the modified item: %+v", e)
+	}
+	if e = entries[1]; e.Action != ItemAdded || e.Uuid != created.Uuid || len(e.Fields) != 0 {
+		t.Errorf("Unexpected entry for the created item: %+v", e)
+	}
+	if bytes.Contains(journal.Data, []byte("hunter3")) || bytes.Contains(journal.Data, []byte("Recovery")) {
+		t.Error("Journal isn't encrypted")
+	}
+
+	entries, err = v.History(HistoryQuery{Uuid: created.Uuid})
+	if err != nil || len(entries) != 1 || entries[0].Title != "Recovery codes" {
+		t.Errorf("Expected the created item's entry. Got %+v, %v.", entries, err)
+	}
+	if entries, err = v.History(HistoryQuery{Since: time.Now().Add(time.Hour)}); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no future entries. Got %+v, %v.", entries, err)
+	}
+}
+
+func TestItemVersions(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	v := f.open()
+	v.versions = 2
+
+	for i, title := range []string{"GitHub 2", "GitHub 3", "GitHub 4"} {
+		item, err := v.Item(uuidA1)
+		if err != nil {
+			t.Fatalf("Failed reading item: %s", err)
+		}
+		item.Title = title
+		item.Folder, item.FaveIndex = fmt.Sprintf("F%d", i+2), i+2
+		if err = item.SetPassword("hunter3", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if err = v.SaveItem(item); err != nil {
+			t.Fatalf("Failed saving item: %s", err)
+		}
+	}
+	if bytes.Contains(f.fsys["default/"+uuidA1+".versions"].Data, []byte("GitHub")) {
+		t.Error("Versions aren't encrypted")
+	}
+
+	// Only the newest two are kept
+	versions, err := f.open().Versions(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading versions: %s", err)
+	}
+	if len(versions) != 2 || versions[0].Item.Title != "GitHub 3" || versions[1].Item.Title != "GitHub 2" {
+		t.Fatalf("Unexpected versions: %+v", versions)
+	}
+	if versions[0].Item.Password() != "hunter3" || versions[0].Replaced.IsZero() {
+		t.Errorf("Unexpected newest version: %+v", versions[0])
+	}
+
+	if err = v.RestoreVersion(uuidA1, 1); err != nil {
+		t.Fatalf("Failed restoring: %s", err)
+	}
+	item, err := v.Item(uuidA1)
+	if err != nil || item.Title != "GitHub 2" {
+		t.Fatalf("Expected the restored version. Got %+v, %v.", item, err)
+	}
+	if item.Folder != "F2" || item.FaveIndex != 2 {
+		t.Errorf("Expected the restored version's folder and favorite position. Got %q, %d.", item.Folder, item.FaveIndex)
+	}
+	// The version restored over is kept in turn
+	if versions, err = v.Versions(uuidA1); err != nil || len(versions) != 2 || versions[0].Item.Title != "GitHub 4" {
+		t.Errorf("Expected the replaced version first. Got %+v, %v.", versions, err)
+	}
+	if err = v.RestoreVersion(uuidA1, 2); err == nil {
+		t.Error("Restored a version that isn't kept")
+	}
+
+	// Versions are dropped once old enough
+	v.versionAge = time.Nanosecond
+	time.Sleep(time.Second)
+	if err = v.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	if versions, err = v.Versions(uuidA1); err != nil || len(versions) != 1 {
+		t.Errorf("Expected only the latest version. Got %+v, %v.", versions, err)
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	f.addItem(uuidC3, CatLogin.Uuid, `{"title":"Bank"}`, loginDetails, true)
+	for uuid, tx := range map[string]int64{uuidA1: 1600000100, uuidB2: 1600000200, uuidC3: 1600000300} {
+		f.band[uuid].Tx = tx
+		f.writeBand(uuid[:1])
+	}
+	v := f.open()
+
+	cs, err := v.ChangesSince(0)
+	if err != nil {
+		t.Fatalf("Failed listing changes: %s", err)
+	}
+	want := &ChangeSet{Added: []string{uuidA1, uuidB2}, Deleted: []string{uuidC3}, Watermark: 1600000300}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("Expected every item. Got %+v.", cs)
+	}
+
+	cs, err = v.ChangesSince(1600000200)
+	if err != nil {
+		t.Fatalf("Failed listing changes: %s", err)
+	}
+	if want = (&ChangeSet{Modified: []string{uuidB2}, Deleted: []string{uuidC3}, Watermark: 1600000300}); !reflect.DeepEqual(cs, want) {
+		t.Errorf("Expected the changes from the watermark. Got %+v.", cs)
+	}
+
+	item, err := v.Item(uuidA1)
+	if err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	created := NewItemFromTemplate(CatSecureNote)
+	for _, it := range []*Item{item, created} {
+		if err = v.SaveItem(it); err != nil {
+			t.Fatalf("Failed saving item: %s", err)
+		}
+	}
+	start := uint64(time.Now().Add(-time.Minute).Unix())
+	if cs, err = v.ChangesSince(start); err != nil {
+		t.Fatalf("Failed listing changes: %s", err)
+	}
+	if !reflect.DeepEqual(cs.Added, []string{created.Uuid}) || !reflect.DeepEqual(cs.Modified, []string{uuidA1}) || cs.Deleted != nil || cs.Watermark < start {
+		t.Errorf("Expected the saved items. Got %+v.", cs)
+	}
+}
+
+func TestVaultSet(t *testing.T) {
+	personal := newOPVaultFixture(t)
+	personal.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	personal.addItem("B2", CatLogin.Uuid, `{"title":"Bank"}`, loginDetails, false)
+	work := newOPVaultFixture(t)
+	work.addItem("C3", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+
+	s := NewVaultSet()
+	s.Add("personal", personal.open())
+	s.Add("work", work.open())
+	defer s.Close()
+	if err := s.Add("work", work.open()); err == nil {
+		t.Fatalf("Expected an error adding a name twice.")
+	}
+
+	items, err := s.List(func(*Item) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Vault+"/"+item.Title)
+	}
+	if want := []string{"personal/Bank", "personal/GitHub", "work/GitLab"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %v. Expected %v.", got, want)
+	}
+
+	results, err := s.Search("git")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 2 || results[0].Vault == results[1].Vault {
+		t.Fatalf("Expected a result from each vault: %+v", results)
+	}
+}
+
+func TestContext(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	dir := t.TempDir()
+	writeFixture(t, f, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := VaultConfig{DBPath: dir, Profile: "default"}
+	if _, err := NewVaultContext(ctx, testPassword, cfg); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled opening the vault. Got %v.", err)
+	}
+	v, err := NewVaultContext(context.Background(), testPassword, cfg)
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer v.Close()
+
+	if _, err = v.SearchContext(ctx, "git"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled searching. Got %v.", err)
+	}
+	if _, err = v.FilterContext(ctx, "title:GitHub"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled filtering. Got %v.", err)
+	}
+	// A canceled search leaves the index to be built by the next
+	if results, err := v.Search("git"); err != nil || len(results) != 1 {
+		t.Errorf("Expected one result. Got %v, %v.", results, err)
+	}
+}
@@ -0,0 +1,298 @@
+//go:build unix
+
+// Package pam fetches users' secrets from a system vault as they log in,
+// for pam_exec(8), so that LUKS keyfiles, application passwords, and the
+// like need not be kept on disk:
+//
+//	session optional pam_exec.so quiet /usr/local/bin/opvault-pam
+//
+// opvault-pam reads /etc/opvault/pam.yaml, which names the vault, the file
+// holding its master password, and the secrets each user may have:
+//
+//	vault: /var/lib/opvault/system.opvault
+//	passwordFile: /etc/opvault/pam-password
+//	services: [login, sshd, gdm-password]
+//	users:
+//	  alice:
+//	    luks.key: opvault:///alice LUKS/password
+//	    mail: opvault:///Mail (alice)/password
+//
+// These lists are the only secrets fetched: users not listed get nothing,
+// and nothing a user or login supplies chooses an item. When a session
+// opens, each secret is written to a file named after it in a directory
+// only the user can read, /run/opvault/<user> by default. With
+// removeOnClose set, the directory is removed when a session closes, even
+// if the user has others open; otherwise it lasts until /run is cleared.
+//
+// The configuration and password files must be owned by root and not
+// writable by anyone else, and the password file not readable by anyone
+// else. The helper runs as root, as PAM does, and refuses to run setuid.
+package pam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/credentials"
+	"gopkg.in/yaml.v2"
+)
+
+// The defaults for the helper's files.
+const (
+	DefaultConfigPath = "/etc/opvault/pam.yaml"
+	DefaultDir        = "/run/opvault"
+)
+
+// A Config is the helper's configuration.
+type Config struct {
+	Vault         string                       `yaml:"vault"`
+	Profile       string                       `yaml:"profile,omitempty"`
+	PasswordFile  string                       `yaml:"passwordFile"`
+	Dir           string                       `yaml:"dir,omitempty"`      // DefaultDir if empty
+	Services      []string                     `yaml:"services,omitempty"` // Any service if empty
+	RemoveOnClose bool                         `yaml:"removeOnClose,omitempty"`
+	Users         map[string]map[string]string `yaml:"users"` // User -> name -> secret reference
+}
+
+// A Secret is a secret a user may have: the name of its file and the
+// reference it's resolved from.
+type Secret struct {
+	Name string
+	Ref  string
+}
+
+// An Event is a PAM event as pam_exec passes it in the environment.
+type Event struct {
+	Type    string // PAM_TYPE, e.g. "open_session"
+	User    string // PAM_USER
+	Service string // PAM_SERVICE
+}
+
+// EventFromEnv returns the event described by the environment getenv
+// reads, normally os.Getenv.
+func EventFromEnv(getenv func(string) string) (Event, error) {
+	ev := Event{getenv("PAM_TYPE"), getenv("PAM_USER"), getenv("PAM_SERVICE")}
+	if ev.Type == "" || ev.User == "" {
+		return Event{}, fmt.Errorf("PAM_TYPE and PAM_USER are unset; run from pam_exec")
+	}
+	return ev, nil
+}
+
+// LoadConfig reads the configuration at path, which must be owned by root
+// and writable only by it.
+func LoadConfig(path string) (*Config, error) {
+	if err := checkOwner(path, 0022); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err = yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if err = c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	if c.Vault == "" || c.PasswordFile == "" {
+		return fmt.Errorf("vault and passwordFile are required")
+	}
+	for u, secrets := range c.Users {
+		if !validName(u) {
+			return fmt.Errorf("invalid user name %q", u)
+		}
+		for name, ref := range secrets {
+			if !validName(name) {
+				return fmt.Errorf("%s: invalid secret name %q", u, name)
+			}
+			if _, err := onepassword.ParseSecretRef(ref); err != nil {
+				return fmt.Errorf("%s: %s: %s", u, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validName reports whether name is usable as a file name.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.HasPrefix(name, ".") && len(name) <= 255 && !strings.ContainsAny(name, "/\x00")
+}
+
+// checkOwner returns an error unless the file at path is owned by root and
+// has none of the permission bits in forbidden.
+func checkOwner(path string, forbidden os.FileMode) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Uid != 0 {
+		return fmt.Errorf("%s isn't owned by root", path)
+	}
+	if fi.Mode().Perm()&forbidden != 0 {
+		return fmt.Errorf("%s has mode %s; it must not be accessible to others", path, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// Allowed returns the secrets user may have, ordered by name.
+func (c *Config) Allowed(user string) []Secret {
+	var secrets []Secret
+	for name, ref := range c.Users[user] {
+		secrets = append(secrets, Secret{name, ref})
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets
+}
+
+func (c *Config) dir() string {
+	if c.Dir == "" {
+		return DefaultDir
+	}
+	return c.Dir
+}
+
+// handles reports whether the helper acts for service.
+func (c *Config) handles(service string) bool {
+	if len(c.Services) == 0 {
+		return true
+	}
+	for _, s := range c.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Run handles ev: on "open_session" it writes the user's secrets, and on
+// "close_session" it removes them if configured to. Other events, users
+// without secrets, and services not listed are ignored.
+func (c *Config) Run(ev Event) error {
+	secrets := c.Allowed(ev.User)
+	if len(secrets) == 0 || !c.handles(ev.Service) {
+		return nil
+	}
+	switch ev.Type {
+	case "open_session":
+	case "close_session":
+		if c.RemoveOnClose {
+			return Remove(c.dir(), ev.User)
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	u, err := user.Lookup(ev.User)
+	if err != nil {
+		return err
+	}
+	if err = checkOwner(c.PasswordFile, 0077); err != nil {
+		return err
+	}
+	v, err := onepassword.OpenVault(credentials.File(c.PasswordFile), onepassword.VaultConfig{DBPath: c.Vault, Profile: c.profile()})
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	return Write(c.dir(), u, secrets, v.Resolve)
+}
+
+func (c *Config) profile() string {
+	if c.Profile == "" {
+		return onepassword.DefaultProfile
+	}
+	return c.Profile
+}
+
+// Write writes the secrets to files in the user's directory under dir,
+// owned by the user and readable only by them. Files left from an earlier
+// session are replaced. Secrets that can't be resolved are skipped, and
+// the first error is returned once the others are written.
+func Write(dir string, u *user.User, secrets []Secret, resolve func(ref string) (string, error)) error {
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("%s: non-numeric uid %q", u.Username, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("%s: non-numeric gid %q", u.Username, u.Gid)
+	}
+
+	// Only root may add to dir, so users can't plant their own
+	// directories or links there
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err = checkOwner(dir, 0022); err != nil {
+		return err
+	}
+	userDir := filepath.Join(dir, u.Username)
+	if err = os.Mkdir(userDir, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if err = os.Chmod(userDir, 0700); err != nil {
+		return err
+	}
+
+	var first error
+	for _, s := range secrets {
+		value, err := resolve(s.Ref)
+		if err == nil {
+			err = writeFile(userDir, s.Name, value, uid, gid)
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("%s: %s", s.Name, err)
+		}
+	}
+	if err = os.Lchown(userDir, uid, gid); err != nil {
+		return err
+	}
+	return first
+}
+
+// writeFile writes a temporary file and renames it, so the user never
+// reads part of a secret.
+func writeFile(dir, name, value string, uid, gid int) error {
+	f, err := ioutil.TempFile(dir, "."+name)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(value); err == nil {
+		err = f.Chmod(0400)
+	}
+	if err == nil {
+		err = f.Chown(uid, gid)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Remove removes the secrets of the user with username from dir.
+func Remove(dir, username string) error {
+	if !validName(username) {
+		return fmt.Errorf("invalid user name %q", username)
+	}
+	return os.RemoveAll(filepath.Join(dir, username))
+}
@@ -0,0 +1,136 @@
+//go:build unix
+
+package pam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventFromEnv(t *testing.T) {
+	env := map[string]string{"PAM_TYPE": "open_session", "PAM_USER": "alice", "PAM_SERVICE": "sshd"}
+	ev, err := EventFromEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev != (Event{"open_session", "alice", "sshd"}) {
+		t.Errorf("got %+v", ev)
+	}
+	if _, err = EventFromEnv(func(string) string { return "" }); err == nil {
+		t.Error("accepted an empty environment")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("configurations must be owned by root")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pam.yaml")
+	for _, c := range []struct {
+		yaml string
+		mode os.FileMode
+		err  string
+	}{
+		{"vault: /v\npasswordFile: /p\nusers:\n  alice:\n    mail: opvault:///Mail/password\n", 0600, ""},
+		{"vault: /v\npasswordFile: /p\n", 0620, "mode"},
+		{"vault: /v\npasswordFile: /p\nfrobnicate: true\n", 0600, "frobnicate"},
+		{"vault: /v\n", 0600, "required"},
+		{"vault: /v\npasswordFile: /p\nusers:\n  alice:\n    ../x: opvault:///Mail/password\n", 0600, "invalid secret name"},
+		{"vault: /v\npasswordFile: /p\nusers:\n  alice:\n    mail: Mail/password\n", 0600, "alice: mail"},
+	} {
+		if err := ioutil.WriteFile(path, []byte(c.yaml), c.mode); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(path, c.mode)
+		cfg, err := LoadConfig(path)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%q: %s", c.yaml, err)
+			} else if got := cfg.Allowed("alice"); len(got) != 1 || got[0] != (Secret{"mail", "opvault:///Mail/password"}) {
+				t.Errorf("alice may have %v", got)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got error %v, want one mentioning %q", c.yaml, err, c.err)
+		}
+	}
+}
+
+func TestRunIgnores(t *testing.T) {
+	// The vault doesn't exist, so anything but ignoring the event fails
+	c := &Config{
+		Vault:        "/nonexistent",
+		PasswordFile: "/nonexistent",
+		Dir:          t.TempDir(),
+		Services:     []string{"login"},
+		Users:        map[string]map[string]string{"alice": {"mail": "opvault:///Mail/password"}},
+	}
+	for _, ev := range []Event{
+		{"open_session", "bob", "login"},
+		{"open_session", "alice", "cron"},
+		{"auth", "alice", "login"},
+		{"close_session", "alice", "login"},
+	} {
+		if err := c.Run(ev); err != nil {
+			t.Errorf("%+v: %s", ev, err)
+		}
+	}
+	if err := c.Run(Event{"open_session", "alice", "login"}); err == nil {
+		t.Error("opened a nonexistent vault")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("secrets are written by root")
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	secrets := []Secret{{"luks.key", "opvault:///LUKS/password"}, {"mail", "opvault:///Mail/password"}}
+	resolve := func(ref string) (string, error) {
+		if ref == "opvault:///Mail/password" {
+			return "", fmt.Errorf("item not found")
+		}
+		return "hunter2", nil
+	}
+	if err = Write(dir, u, secrets, resolve); err == nil || !strings.HasPrefix(err.Error(), "mail:") {
+		t.Errorf("got error %v, want one for mail", err)
+	}
+
+	userDir := filepath.Join(dir, u.Username)
+	fi, err := os.Stat(userDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("directory has mode %s", fi.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(userDir, "luks.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hunter2" {
+		t.Errorf("luks.key holds %q", data)
+	}
+	if fi, err = os.Stat(filepath.Join(userDir, "luks.key")); err != nil || fi.Mode().Perm() != 0400 {
+		t.Errorf("luks.key: %v %v", fi.Mode(), err)
+	}
+	if _, err = os.Stat(filepath.Join(userDir, "mail")); !os.IsNotExist(err) {
+		t.Errorf("wrote mail, which didn't resolve")
+	}
+
+	if err = Remove(dir, u.Username); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(userDir); !os.IsNotExist(err) {
+		t.Error("directory left after Remove")
+	}
+}
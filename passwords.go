@@ -0,0 +1,137 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mpage/onepassword/generate"
+)
+
+// SetPassword replaces the password of a Login or Password item. The old
+// password, if any, is added to the password history with the supplied
+// time, as the official apps do. Other keys in the details are preserved.
+func (i *Item) SetPassword(password string, at time.Time) error {
+	d := make(map[string]json.RawMessage)
+	if len(i.Details) > 0 {
+		if err := json.Unmarshal(i.Details, &d); err != nil {
+			return err
+		}
+	}
+	old := i.Password()
+
+	switch i.Category.Uuid {
+	case CatLogin.Uuid:
+		if err := setLoginField(d, "password", "P", password); err != nil {
+			return err
+		}
+	case CatPassword.Uuid:
+		d["password"], _ = json.Marshal(password)
+	default:
+		return fmt.Errorf("cannot set the password of %s items", i.Category.Name)
+	}
+
+	if err := addPasswordHistory(d, old, password, at); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	i.Details = data
+	return nil
+}
+
+// addPasswordHistory records old in the password history of the details d
+// if the password has changed.
+func addPasswordHistory(d map[string]json.RawMessage, old, password string, at time.Time) error {
+	if old == "" || old == password {
+		return nil
+	}
+	var history []PasswordHistoryEntry
+	if raw, ok := d["passwordHistory"]; ok {
+		if err := json.Unmarshal(raw, &history); err != nil {
+			return err
+		}
+	}
+	history = append(history, PasswordHistoryEntry{old, at.Unix()})
+	d["passwordHistory"], _ = json.Marshal(history)
+	return nil
+}
+
+// setLoginField sets the value of the login form field with the supplied
+// designation, adding the field if it's missing. Fields are handled as
+// generic objects so keys this package doesn't model survive.
+func setLoginField(d map[string]json.RawMessage, designation, typ, value string) error {
+	var fields []map[string]interface{}
+	if raw, ok := d["fields"]; ok {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return err
+		}
+	}
+
+	found := false
+	for _, f := range fields {
+		if f["designation"] == designation {
+			f["value"] = value
+			found = true
+			break
+		}
+	}
+	if !found {
+		fields = append(fields, map[string]interface{}{
+			"name":        designation,
+			"type":        typ,
+			"designation": designation,
+			"value":       value,
+		})
+	}
+
+	var err error
+	d["fields"], err = json.Marshal(fields)
+	return err
+}
+
+// GeneratePassword sets the item's password to one created by g and
+// returns it. The old password is kept in the history; see SetPassword.
+func (i *Item) GeneratePassword(g generate.Generator, at time.Time) (string, error) {
+	password, err := g.Generate()
+	if err != nil {
+		return "", err
+	}
+	if err = i.SetPassword(password, at); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// NewLogin returns a new Login item with the supplied title and username
+// and a password created by g. The password history starts empty: it holds
+// the passwords an item used to have, so the generated password is added
+// to it when it's replaced, as the official apps do.
+func NewLogin(title, username string, g generate.Generator, at time.Time) (*Item, error) {
+	item := NewItemFromTemplate(CatLogin)
+	item.Title = title
+	item.Info = username
+	item.Created = at
+	item.Updated = at
+
+	d := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(item.Details, &d); err != nil {
+		return nil, err
+	}
+	if err := setLoginField(d, "username", "T", username); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	item.Details = data
+
+	if _, err = item.GeneratePassword(g, at); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
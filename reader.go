@@ -0,0 +1,15 @@
+package onepassword
+
+// A VaultReader reads the items of a vault, so programs can work the same
+// way with a local, unlocked Vault and with vaults reached through
+// 1Password's services, such as a connect.Reader.
+type VaultReader interface {
+	// LookupItems returns the items, with details, for which pred returns
+	// true.
+	LookupItems(pred ItemPredicate) ([]Item, error)
+	// Item returns the item with the supplied uuid, or ErrItemNotFound.
+	Item(uuid string) (*Item, error)
+	Close()
+}
+
+var _ VaultReader = (*Vault)(nil)
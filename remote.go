@@ -0,0 +1,108 @@
+package onepassword
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A RemoteOpener opens the OPVault directory at a URL as a filesystem, for
+// vaults kept on a server. Filesystems that are io.Closers are closed with
+// the vault, and those that are RemoteWriters can be saved to.
+type RemoteOpener func(u *url.URL) (fs.FS, error)
+
+// A RemoteWriter is a remote filesystem that can replace files. WriteFile
+// should fail if the file changed since it was read, so that programs
+// sharing a vault don't overwrite each other's changes, and with an error
+// matching fs.ErrPermission if the server can't be written to, which is
+// reported as ErrReadOnly.
+type RemoteWriter interface {
+	WriteFile(name string, data []byte) error
+}
+
+var (
+	remotesMu sync.RWMutex
+	remotes   = make(map[string]RemoteOpener) // Scheme -> opener
+)
+
+// RegisterRemote makes VaultConfig.DBPath accept URLs with the supplied
+// scheme, which are opened with open. Packages providing backends register
+// their schemes when imported, as the remote/webdav and remote/sftp packages
+// do:
+//
+//	import _ "github.com/mpage/onepassword/remote/webdav"
+//
+// Remote vaults are read-only unless their filesystems are RemoteWriters.
+// Their sidecars, such as the index cache, are kept in the user's cache
+// directory.
+func RegisterRemote(scheme string, open RemoteOpener) {
+	remotesMu.Lock()
+	remotes[strings.ToLower(scheme)] = open
+	remotesMu.Unlock()
+}
+
+// remoteURL returns the URL dbPath names and the opener for its scheme, or
+// false if dbPath isn't a URL with a registered scheme.
+func remoteURL(dbPath string) (*url.URL, RemoteOpener, bool) {
+	if !strings.Contains(dbPath, "://") {
+		return nil, nil, false
+	}
+	u, err := url.Parse(dbPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	remotesMu.RLock()
+	open, ok := remotes[strings.ToLower(u.Scheme)]
+	remotesMu.RUnlock()
+	return u, open, ok
+}
+
+// openRemoteStore opens a profile of the vault at u.
+func openRemoteStore(u *url.URL, open RemoteOpener, profile string) (store, error) {
+	fsys, err := open(u)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", u.Redacted(), err)
+	}
+	st, err := openOPVaultStore(fsys, profile)
+	if err != nil {
+		if c, ok := fsys.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	if w, ok := fsys.(RemoteWriter); ok {
+		st.writeFile = func(name string, data []byte) error {
+			err := w.WriteFile(name, data)
+			if errors.Is(err, fs.ErrPermission) {
+				return ErrReadOnly
+			}
+			return err
+		}
+	}
+	return st, nil
+}
+
+// remoteSidecarBase returns where the sidecars of the remote vault at u
+// are kept, as a path to append to.
+func remoteSidecarBase(u *url.URL) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	// Credentials in the URL don't change which vault it is
+	u2 := *u
+	u2.User = nil
+	if u.User != nil {
+		u2.User = url.User(u.User.Username())
+	}
+	sum := sha256.Sum256([]byte(u2.String()))
+	return filepath.Join(dir, "opvault", "remote", hex.EncodeToString(sum[:8]), "vault")
+}
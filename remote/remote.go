@@ -0,0 +1,324 @@
+// Package remote reads OPVault directories kept on servers, caching their
+// files locally so that unchanged files are never downloaded twice. Each
+// file is fetched at most once per FS, and its version, such as an HTTP
+// ETag, is kept with the cached copy so later FSes ask the server only
+// whether it's changed.
+//
+// Backends for WebDAV, SFTP, and S3-compatible object stores are in the
+// subpackages, which register the webdav://, webdav+http://, sftp://, s3://,
+// and gs:// schemes with the onepassword package when imported, so that a
+// VaultConfig.DBPath can be a URL:
+//
+//	import _ "github.com/mpage/onepassword/remote/webdav"
+//
+//	v, err := onepassword.NewVault(pass, onepassword.VaultConfig{
+//		DBPath:  "webdav://wendy@cloud.example.com/remote.php/dav/files/wendy/1Password.opvault",
+//		Profile: "default",
+//	})
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotModified is returned by Backend.Fetch when a file is unchanged
+// since the version supplied.
+var ErrNotModified = errors.New("not modified")
+
+// ErrConflict is returned when writing a file that's changed since it was
+// read, as when another program saved an item in the same band. Reopening
+// the vault reads the other program's changes.
+var ErrConflict = errors.New("vault changed on the server since it was read")
+
+// A Backend reads files from a server. Names are slash-separated paths
+// relative to the vault directory, as for fs.FS. Errors for files that
+// don't exist must match fs.ErrNotExist.
+type Backend interface {
+	// Fetch returns the contents and version of a file, or ErrNotModified
+	// if its version is still version. Versions are opaque to the FS; an
+	// empty one matches nothing.
+	Fetch(name, version string) (data []byte, newVersion string, err error)
+
+	// List returns the entries of a directory.
+	List(dir string) ([]fs.FileInfo, error)
+}
+
+// A WriteBackend is a Backend that can also replace files, only if they're
+// unchanged, so that writers sharing a vault don't lose each other's
+// changes.
+type WriteBackend interface {
+	Backend
+
+	// Store replaces a file whose version is still version, or creates
+	// one that doesn't exist if version is "", and returns its new
+	// version. Otherwise it returns ErrConflict.
+	Store(name string, data []byte, version string) (newVersion string, err error)
+}
+
+// An FS is a vault directory read through a Backend. It implements
+// fs.ReadFileFS and fs.ReadDirFS; directories can be listed but not opened.
+// If the Backend is an io.Closer, so is the FS, and if it's a WriteBackend,
+// files can be written with WriteFile.
+type FS struct {
+	backend Backend
+	cache   string // Directory of cached files; "" for none
+
+	mu    sync.Mutex
+	files map[string]*file // Fetched so far; nil for files known not to exist
+}
+
+// New returns an FS reading through b and caching files in cacheDir,
+// which is created if need be. An empty cacheDir keeps files in memory
+// only.
+func New(b Backend, cacheDir string) *FS {
+	return &FS{backend: b, cache: cacheDir, files: make(map[string]*file)}
+}
+
+// CacheDir returns the default directory for caching the vault at u, in
+// the user's cache directory. Credentials in u don't change the directory.
+func CacheDir(u *url.URL) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	u2 := *u
+	u2.User = nil
+	if u.User != nil {
+		u2.User = url.User(u.User.Username())
+	}
+	sum := sha256.Sum256([]byte(u2.String()))
+	return filepath.Join(dir, "opvault", "remote", hex.EncodeToString(sum[:8]), "files"), nil
+}
+
+// A file is a fetched file.
+type file struct {
+	name    string
+	data    []byte
+	modTime time.Time
+	version string
+}
+
+// cacheEntry is what's kept about a cached file beside it.
+type cacheEntry struct {
+	Version string    `json:"version"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	fl, err := f.fetch("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &openFile{fl, bytes.NewReader(fl.data)}, nil
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	fl, err := f.fetch("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), fl.data...), nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	infos, err := f.backend.List(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Close closes the Backend if it's an io.Closer.
+func (f *FS) Close() error {
+	if c, ok := f.backend.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// fetch returns a file, from memory if it's been fetched already, from the
+// cache if the server says it's unchanged, and from the server otherwise.
+func (f *FS) fetch(op, name string) (*file, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fl, ok := f.files[name]; ok {
+		if fl == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		return fl, nil
+	}
+
+	cached, entry := f.readCache(name)
+	version := ""
+	if cached != nil {
+		version = entry.Version
+	}
+	data, newVersion, err := f.backend.Fetch(name, version)
+	switch {
+	case err == ErrNotModified && cached != nil:
+		data = cached
+	case err != nil:
+		if errors.Is(err, fs.ErrNotExist) {
+			f.removeCache(name)
+			f.files[name] = nil
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	default:
+		entry = cacheEntry{newVersion, time.Now()}
+		f.writeCache(name, data, entry)
+	}
+
+	fl := &file{path.Base(name), data, entry.Fetched, entry.Version}
+	f.files[name] = fl
+	return fl, nil
+}
+
+// WriteFile replaces a file if it's unchanged on the server since this FS
+// read it, or creates it if it didn't exist then, and returns ErrConflict
+// otherwise. Files not read yet are read first.
+func (f *FS) WriteFile(name string, data []byte) error {
+	wb, ok := f.backend.(WriteBackend)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+	}
+	if _, err := f.fetch("write", name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	version := ""
+	if fl := f.files[name]; fl != nil {
+		version = fl.version
+		// Files whose version isn't known can't be replaced safely
+		if version == "" {
+			return &fs.PathError{Op: "write", Path: name, Err: ErrConflict}
+		}
+	}
+	newVersion, err := wb.Store(name, data, version)
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	entry := cacheEntry{newVersion, time.Now()}
+	f.writeCache(name, data, entry)
+	f.files[name] = &file{path.Base(name), append([]byte(nil), data...), entry.Fetched, newVersion}
+	return nil
+}
+
+func (f *FS) cachePath(name string) string {
+	return filepath.Join(f.cache, filepath.FromSlash(name))
+}
+
+// readCache returns the cached copy of a file, or nil if there's none.
+func (f *FS) readCache(name string) ([]byte, cacheEntry) {
+	var entry cacheEntry
+	if f.cache == "" {
+		return nil, entry
+	}
+	meta, err := ioutil.ReadFile(f.cachePath(name) + ".version")
+	if err != nil || json.Unmarshal(meta, &entry) != nil || entry.Version == "" {
+		return nil, entry
+	}
+	data, err := ioutil.ReadFile(f.cachePath(name))
+	if err != nil {
+		return nil, entry
+	}
+	return data, entry
+}
+
+// writeCache caches a file. Failing to is only a missed saving, so errors
+// are ignored.
+func (f *FS) writeCache(name string, data []byte, entry cacheEntry) {
+	if f.cache == "" {
+		return
+	}
+	if entry.Version == "" {
+		f.removeCache(name)
+		return
+	}
+	p := f.cachePath(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// The version is written last, so a copy is never taken for a version
+	// it isn't
+	os.Remove(p + ".version")
+	if writeFileAtomic(p, data) == nil {
+		writeFileAtomic(p+".version", meta)
+	}
+}
+
+func (f *FS) removeCache(name string) {
+	if f.cache == "" {
+		return
+	}
+	os.Remove(f.cachePath(name) + ".version")
+	os.Remove(f.cachePath(name))
+}
+
+// writeFileAtomic replaces the contents of a file, readable only by its
+// owner. The data is written to a temporary name first so readers never
+// see a partial write.
+func writeFileAtomic(p string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// An openFile is a fetched file opened for reading.
+type openFile struct {
+	*file
+	r *bytes.Reader
+}
+
+func (o *openFile) Read(b []byte) (int, error)                   { return o.r.Read(b) }
+func (o *openFile) Seek(offset int64, whence int) (int64, error) { return o.r.Seek(offset, whence) }
+func (o *openFile) Stat() (fs.FileInfo, error)                   { return o.file, nil }
+func (o *openFile) Close() error                                 { return nil }
+
+// file implements fs.FileInfo.
+func (fl *file) Name() string       { return fl.name }
+func (fl *file) Size() int64        { return int64(len(fl.data)) }
+func (fl *file) Mode() fs.FileMode  { return 0400 }
+func (fl *file) ModTime() time.Time { return fl.modTime }
+func (fl *file) IsDir() bool        { return false }
+func (fl *file) Sys() interface{}   { return nil }
@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeBackend serves files from memory, versioned by a counter bumped on
+// each change.
+type fakeBackend struct {
+	files    fstest.MapFS
+	versions map[string]int
+	fetches  int // Fetches that sent data
+}
+
+func (b *fakeBackend) Fetch(name, version string) ([]byte, string, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return nil, "", fs.ErrNotExist
+	}
+	current := fmt.Sprint(b.versions[name])
+	if current == version {
+		return nil, "", ErrNotModified
+	}
+	b.fetches++
+	return f.Data, current, nil
+}
+
+func (b *fakeBackend) List(dir string) ([]fs.FileInfo, error) {
+	entries, err := b.files.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	for _, e := range entries {
+		fi, _ := e.Info()
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+func TestFS(t *testing.T) {
+	b := &fakeBackend{
+		files: fstest.MapFS{
+			"default/profile.js":       {Data: []byte("var profile={};")},
+			"default/band_0.js":        {Data: []byte("ld({});")},
+			"default/0A_1B.attachment": {Data: []byte("OPCLDAT")},
+			"default/0A_2C.attachment": {Data: []byte("OPCLDAT")},
+		},
+		versions: map[string]int{},
+	}
+	cache := t.TempDir()
+
+	f := New(b, cache)
+	data, err := fs.ReadFile(f, "default/profile.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "var profile={};" {
+		t.Errorf("read %q", data)
+	}
+	// Files are fetched once per FS
+	if _, err = fs.ReadFile(f, "default/profile.js"); err != nil {
+		t.Fatal(err)
+	}
+	if b.fetches != 1 {
+		t.Errorf("%d fetches, want 1", b.fetches)
+	}
+	if _, err = fs.ReadFile(f, "default/band_F.js"); !errorsIsNotExist(err) {
+		t.Errorf("missing band: %v", err)
+	}
+
+	file, err := f.Open("default/0A_1B.attachment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 6)
+	if _, err = io.ReadFull(file, head); err != nil || string(head) != "OPCLDA" {
+		t.Errorf("read %q, %v", head, err)
+	}
+	file.Close()
+
+	names, err := fs.Glob(f, "default/*_*.attachment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "default/0A_1B.attachment" {
+		t.Errorf("glob found %v", names)
+	}
+
+	// A new FS revalidates the cached copy without downloading it again
+	b.fetches = 0
+	f = New(b, cache)
+	if data, err = f.ReadFile("default/profile.js"); err != nil || string(data) != "var profile={};" {
+		t.Errorf("cached read %q, %v", data, err)
+	}
+	if b.fetches != 0 {
+		t.Errorf("unchanged file fetched %d times", b.fetches)
+	}
+
+	// Changed files are downloaded
+	b.files["default/profile.js"] = &fstest.MapFile{Data: []byte("var profile={\"v\":2};")}
+	b.versions["default/profile.js"]++
+	f = New(b, cache)
+	if data, err = f.ReadFile("default/profile.js"); err != nil || string(data) != "var profile={\"v\":2};" {
+		t.Errorf("changed read %q, %v", data, err)
+	}
+	if b.fetches != 1 {
+		t.Errorf("changed file fetched %d times, want 1", b.fetches)
+	}
+}
+
+func TestWriteReadOnly(t *testing.T) {
+	f := New(&fakeBackend{files: fstest.MapFS{}, versions: map[string]int{}}, "")
+	err := f.WriteFile("default/band_0.js", []byte("ld({});"))
+	if pe, ok := err.(*fs.PathError); !ok || pe.Err != fs.ErrPermission {
+		t.Errorf("writing without a WriteBackend: %v", err)
+	}
+}
+
+func errorsIsNotExist(err error) bool {
+	pe, ok := err.(*fs.PathError)
+	return ok && pe.Err == fs.ErrNotExist
+}
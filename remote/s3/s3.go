@@ -0,0 +1,434 @@
+// Package s3 keeps vaults in buckets on Amazon S3, Google Cloud Storage, or
+// S3-compatible stores such as MinIO, so that CI workers and servers can
+// share a vault without a synced filesystem. Importing it registers the
+// s3:// and gs:// schemes with the onepassword package:
+//
+//	s3://team-secrets/vaults/1Password.opvault
+//	s3://team-secrets/1Password.opvault?endpoint=http://minio.internal:9000
+//	gs://team-secrets/vaults/1Password.opvault
+//
+// Requests are signed with AWS Signature Version 4, using the keys in
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN, or for
+// gs:// URLs the Cloud Storage HMAC keys in $GS_ACCESS_KEY_ID and
+// $GS_SECRET_ACCESS_KEY. Requests are unsigned if there are no keys. The
+// region is the URL's region parameter, $AWS_REGION, or us-east-1, and the
+// endpoint, for stores other than S3, is the endpoint parameter or
+// $AWS_ENDPOINT_URL_S3.
+//
+// Files are cached as described by package remote and revalidated by ETag.
+// Unlike the other backends, buckets can be written to: each write is
+// conditional on the object being unchanged since it was read, so saving
+// an item in a band that another program changed meanwhile fails with
+// remote.ErrConflict rather than losing the other program's item.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/remote"
+)
+
+func init() {
+	onepassword.RegisterRemote("s3", Open)
+	onepassword.RegisterRemote("gs", Open)
+}
+
+// Open returns a cached FS for the vault at an s3:// or gs:// URL, whose
+// host is the bucket and whose path is the vault directory's key.
+func Open(u *url.URL) (fs.FS, error) {
+	b, err := newBackend(u)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := remote.CacheDir(u)
+	if err != nil {
+		dir = ""
+	}
+	return remote.New(b, dir), nil
+}
+
+// newBackend returns a Backend for an s3:// or gs:// URL.
+func newBackend(u *url.URL) (*Backend, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s: no bucket", u.Redacted())
+	}
+	q := u.Query()
+	b := &Backend{
+		Bucket: u.Host,
+		Prefix: strings.Trim(u.Path, "/"),
+		Region: firstSet(q.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+	}
+	endpoint := firstSet(q.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"))
+	if strings.EqualFold(u.Scheme, "gs") {
+		b.GCS = true
+		b.Region = firstSet(q.Get("region"), "auto")
+		endpoint = firstSet(q.Get("endpoint"), "https://storage.googleapis.com")
+		b.AccessKey = os.Getenv("GS_ACCESS_KEY_ID")
+		b.SecretKey = os.Getenv("GS_SECRET_ACCESS_KEY")
+	} else {
+		b.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		b.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		b.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	var err error
+	if endpoint != "" {
+		b.PathStyle = true
+		if b.Endpoint, err = url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("endpoint: %s", err)
+		}
+	} else {
+		b.Endpoint = &url.URL{Scheme: "https", Host: "s3." + b.Region + ".amazonaws.com"}
+		// Bucket names with dots don't match the wildcard certificate
+		b.PathStyle = strings.Contains(b.Bucket, ".")
+	}
+	return b, nil
+}
+
+// firstSet returns the first non-empty string.
+func firstSet(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// A Backend reads and writes a vault directory in a bucket. Versions are
+// ETags, followed on Cloud Storage by a space and the object's generation,
+// which its writes are made conditional on instead.
+type Backend struct {
+	Endpoint  *url.URL // The service, as https://s3.us-east-1.amazonaws.com
+	Bucket    string
+	Prefix    string // The vault directory's key, without slashes at the ends
+	Region    string
+	PathStyle bool // Name the bucket in the path, not the host name
+	GCS       bool // Use Cloud Storage's preconditions for writes
+
+	AccessKey    string // Requests are unsigned if empty
+	SecretKey    string
+	SessionToken string
+
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (b *Backend) client() *http.Client {
+	if b.Client == nil {
+		return http.DefaultClient
+	}
+	return b.Client
+}
+
+// key returns the key of a file or directory in the vault.
+func (b *Backend) key(name string) string {
+	if name == "." {
+		return b.Prefix
+	}
+	if b.Prefix == "" {
+		return name
+	}
+	return b.Prefix + "/" + name
+}
+
+// url returns the URL of an object, or of the bucket if key is empty.
+func (b *Backend) url(key string, query url.Values) *url.URL {
+	u := *b.Endpoint
+	p := "/" + key
+	if b.PathStyle {
+		p = strings.TrimSuffix(u.Path, "/") + "/" + b.Bucket + p
+	} else {
+		u.Host = b.Bucket + "." + u.Host
+	}
+	u.Path = p
+	u.RawPath = escape(p, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request.
+func (b *Backend) do(method string, u *url.URL, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body == nil {
+		req.Body = nil
+		req.ContentLength = 0
+	}
+	sum := sha256.Sum256(body)
+	b.sign(req, hex.EncodeToString(sum[:]), time.Now())
+	return b.client().Do(req)
+}
+
+// sign adds an AWS Signature Version 4 to req, for a payload with the
+// supplied SHA-256 hash sent at t. Every header set on req is signed, with
+// the host.
+func (b *Backend) sign(req *http.Request, payloadHash string, t time.Time) {
+	if b.AccessKey == "" {
+		return
+	}
+	stamp := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		for i := range v {
+			v[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := stamp[:8] + "/" + b.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + b.SecretKey)
+	for _, s := range []string{stamp[:8], b.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// escape encodes s as Signature Version 4 requires, leaving only unreserved
+// characters and, unless escapeSlash, slashes.
+func escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes a query with its parameters sorted.
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// version returns the version of the object a response describes.
+func (b *Backend) version(resp *http.Response) string {
+	v := resp.Header.Get("ETag")
+	if b.GCS && v != "" {
+		if gen := resp.Header.Get("X-Goog-Generation"); gen != "" {
+			v += " " + gen
+		}
+	}
+	return v
+}
+
+// s3Error returns an error for an unexpected response.
+func s3Error(method, name string, resp *http.Response) error {
+	var e struct {
+		Code    string
+		Message string
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s %s: %s: %s", method, name, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s %s: %s", method, name, resp.Status)
+}
+
+func (b *Backend) Fetch(name, version string) ([]byte, string, error) {
+	header := make(http.Header)
+	if etag, _, _ := strings.Cut(version, " "); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	resp, err := b.do("GET", b.url(b.key(name), nil), header, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", remote.ErrNotModified
+	case http.StatusNotFound:
+		return nil, "", fs.ErrNotExist
+	default:
+		return nil, "", s3Error("GET", name, resp)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, b.version(resp), nil
+}
+
+// Store writes a file only if its ETag, or its generation on Cloud
+// Storage, is still version's, or if version is empty only if there's no
+// such file.
+func (b *Backend) Store(name string, data []byte, version string) (string, error) {
+	etag, gen, _ := strings.Cut(version, " ")
+	header := make(http.Header)
+	switch {
+	case b.GCS && version == "":
+		header.Set("X-Goog-If-Generation-Match", "0")
+	case b.GCS && gen != "":
+		header.Set("X-Goog-If-Generation-Match", gen)
+	case version == "":
+		header.Set("If-None-Match", "*")
+	default:
+		header.Set("If-Match", etag)
+	}
+	resp, err := b.do("PUT", b.url(b.key(name), nil), header, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	// S3 answers 409 when a concurrent conditional write won
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return "", remote.ErrConflict
+	default:
+		return "", s3Error("PUT", name, resp)
+	}
+	return b.version(resp), nil
+}
+
+// listResult is the part of a ListObjectsV2 response that's read.
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (b *Backend) List(dir string) ([]fs.FileInfo, error) {
+	prefix := b.key(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+	var infos []fs.FileInfo
+	for {
+		resp, err := b.do("GET", b.url("", q), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		if resp.StatusCode != http.StatusOK {
+			err = s3Error("LIST", dir, resp)
+		} else if err = xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&res); err != nil {
+			err = fmt.Errorf("LIST %s: %s", dir, err)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range res.Contents {
+			if name := strings.TrimPrefix(c.Key, prefix); name != "" {
+				infos = append(infos, &fileInfo{name: name, size: c.Size, modTime: c.LastModified})
+			}
+		}
+		for _, p := range res.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			infos = append(infos, &fileInfo{name: name, dir: true})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+	// Buckets have no directories, only keys with common prefixes
+	if infos == nil {
+		return nil, fs.ErrNotExist
+	}
+	return infos, nil
+}
+
+// A fileInfo describes a listed object or common prefix.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0500
+	}
+	return 0400
+}
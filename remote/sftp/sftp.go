@@ -0,0 +1,183 @@
+// Package sftp reads vaults from SSH servers over SFTP. Importing it
+// registers the sftp:// scheme with the onepassword package:
+//
+//	sftp://wendy@files.example.com/srv/vaults/1Password.opvault
+//	sftp://wendy@files.example.com:2222/~/1Password.opvault
+//
+// A path starting with /~/ is relative to the user's home directory. Keys
+// are taken from the SSH agent at $SSH_AUTH_SOCK, then from unencrypted
+// keys in ~/.ssh, and the server's key must be in ~/.ssh/known_hosts.
+// Files are cached as described by package remote, and only downloaded
+// again when their size or modification time changes.
+package sftp
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/remote"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	onepassword.RegisterRemote("sftp", Open)
+}
+
+// Open connects to the server named by an sftp:// URL and returns a cached
+// FS for the vault there. Closing the FS closes the connection.
+func Open(u *url.URL) (fs.FS, error) {
+	conn, err := dial(u)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	dir, err := remote.CacheDir(u)
+	if err != nil {
+		dir = ""
+	}
+	b := &Backend{Client: client, Dir: vaultDir(u.Path), conn: conn}
+	return remote.New(b, dir), nil
+}
+
+// vaultDir returns the directory on the server that a URL's path names.
+func vaultDir(p string) string {
+	if p == "/~" || strings.HasPrefix(p, "/~/") {
+		return strings.TrimPrefix(strings.TrimPrefix(p, "/~"), "/")
+	}
+	return p
+}
+
+// dial opens an SSH connection authenticated as u's user, or the current
+// one.
+func dial(u *url.URL) (*ssh.Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %s", err)
+	}
+
+	name := u.User.Username()
+	if name == "" {
+		cur, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		name = cur.Username
+	}
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if c, err := net.Dial("unix", sock); err == nil {
+			defer c.Close()
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(c).Signers))
+		}
+	}
+	if signers := keyFiles(filepath.Join(home, ".ssh")); len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            name,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+}
+
+// keyFiles returns the unencrypted keys with the default names in dir.
+func keyFiles(dir string) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if s, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, s)
+		}
+	}
+	return signers
+}
+
+// A Backend reads a vault directory over SFTP. Versions are files' sizes
+// and modification times.
+type Backend struct {
+	Client *sftp.Client
+	Dir    string // The vault directory on the server
+
+	conn *ssh.Client // Closed with the Backend, if set
+}
+
+func (b *Backend) path(name string) string {
+	if name == "." {
+		return b.Dir
+	}
+	return path.Join(b.Dir, name)
+}
+
+func (b *Backend) Fetch(name, version string) ([]byte, string, error) {
+	p := b.path(name)
+	fi, err := b.Client.Stat(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if fi.IsDir() {
+		return nil, "", fmt.Errorf("%s is a directory", name)
+	}
+	current := fmt.Sprintf("%d-%d", fi.Size(), fi.ModTime().UnixNano())
+	if current == version {
+		return nil, "", remote.ErrNotModified
+	}
+
+	f, err := b.Client.Open(p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+	// The file may have changed while it was read; it's fetched again next
+	// time rather than trusted
+	if int64(len(data)) != fi.Size() {
+		current = ""
+	}
+	return data, current, nil
+}
+
+func (b *Backend) List(dir string) ([]fs.FileInfo, error) {
+	return b.Client.ReadDir(b.path(dir))
+}
+
+// Close closes the SFTP session and the connection it was opened on.
+func (b *Backend) Close() error {
+	err := b.Client.Close()
+	if b.conn != nil {
+		if cerr := b.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
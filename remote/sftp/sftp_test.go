@@ -0,0 +1,111 @@
+package sftp
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword/remote"
+	"github.com/pkg/sftp"
+)
+
+// pipeConn joins the halves of two pipes for the server.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// countingBackend counts the files sent.
+type countingBackend struct {
+	*Backend
+	sent int
+}
+
+func (b *countingBackend) Fetch(name, version string) ([]byte, string, error) {
+	data, v, err := b.Backend.Fetch(name, version)
+	if err == nil {
+		b.sent++
+	}
+	return data, v, err
+}
+
+func TestBackend(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "default"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	profile := filepath.Join(dir, "default", "profile.js")
+	if err := ioutil.WriteFile(profile, []byte("var profile={};"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cr, cw := io.Pipe()
+	sr, sw := io.Pipe()
+	server, err := sftp.NewServer(pipeConn{cr, sw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		server.Serve()
+		sw.Close()
+	}()
+	client, err := sftp.NewClientPipe(sr, cw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &countingBackend{Backend: &Backend{Client: client, Dir: dir}}
+	defer b.Close()
+	cache := t.TempDir()
+
+	data, err := fs.ReadFile(remote.New(b, cache), "default/profile.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "var profile={};" {
+		t.Errorf("read %q", data)
+	}
+	_, err = fs.ReadFile(remote.New(b, cache), "default/band_0.js")
+	if pe, ok := err.(*fs.PathError); !ok || !os.IsNotExist(pe.Err) {
+		t.Errorf("missing band: %v", err)
+	}
+	entries, err := fs.ReadDir(remote.New(b, cache), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "profile.js" {
+		t.Errorf("listed %v", entries)
+	}
+
+	b.sent = 0
+	if _, err = fs.ReadFile(remote.New(b, cache), "default/profile.js"); err != nil {
+		t.Fatal(err)
+	}
+	if b.sent != 0 {
+		t.Errorf("unchanged file sent %d times", b.sent)
+	}
+
+	if err = ioutil.WriteFile(profile, []byte("var profile={\"changed\":true};"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(profile, later, later)
+	if data, err = fs.ReadFile(remote.New(b, cache), "default/profile.js"); err != nil || string(data) != "var profile={\"changed\":true};" {
+		t.Errorf("changed read %q, %v", data, err)
+	}
+}
+
+func TestVaultDir(t *testing.T) {
+	for p, want := range map[string]string{
+		"/srv/vaults/1Password.opvault": "/srv/vaults/1Password.opvault",
+		"/~/1Password.opvault":          "1Password.opvault",
+		"/~":                            "",
+	} {
+		if got := vaultDir(p); got != want {
+			t.Errorf("vaultDir(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
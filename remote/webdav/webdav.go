@@ -0,0 +1,250 @@
+// Package webdav reads vaults from WebDAV servers, such as Nextcloud,
+// ownCloud, or Apache's mod_dav. Importing it registers the schemes
+// webdav://, for HTTPS, and webdav+http:// with the onepassword package:
+//
+//	webdav://wendy@cloud.example.com/remote.php/dav/files/wendy/1Password.opvault
+//
+// The password is taken from the URL or, if the URL has a user but no
+// password, from $OPVAULT_WEBDAV_PASSWORD. Files are cached as described
+// by package remote, and revalidated with If-None-Match, or
+// If-Modified-Since for servers that don't give ETags.
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/remote"
+)
+
+// PasswordEnv names the environment variable holding the password for
+// URLs without one.
+const PasswordEnv = "OPVAULT_WEBDAV_PASSWORD"
+
+func init() {
+	onepassword.RegisterRemote("webdav", Open)
+	onepassword.RegisterRemote("webdav+http", Open)
+}
+
+// Open returns a cached FS for the vault at a webdav:// or webdav+http://
+// URL.
+func Open(u *url.URL) (fs.FS, error) {
+	b := &Backend{URL: toHTTP(u)}
+	if u.User != nil {
+		b.Username = u.User.Username()
+		var ok bool
+		if b.Password, ok = u.User.Password(); !ok {
+			b.Password = os.Getenv(PasswordEnv)
+		}
+	}
+	dir, err := remote.CacheDir(u)
+	if err != nil {
+		dir = ""
+	}
+	return remote.New(b, dir), nil
+}
+
+// toHTTP returns the HTTP URL for a webdav:// or webdav+http:// URL, without
+// credentials.
+func toHTTP(u *url.URL) *url.URL {
+	h := *u
+	h.User = nil
+	h.Scheme = "https"
+	if strings.EqualFold(u.Scheme, "webdav+http") {
+		h.Scheme = "http"
+	}
+	h.Path = strings.TrimSuffix(h.Path, "/") + "/"
+	h.RawPath = ""
+	return &h
+}
+
+// A Backend reads a vault directory from a WebDAV server.
+type Backend struct {
+	URL      *url.URL // The vault directory; http or https
+	Username string   // For basic authentication, if set
+	Password string
+	Client   *http.Client // http.DefaultClient if nil
+}
+
+func (b *Backend) client() *http.Client {
+	if b.Client == nil {
+		return http.DefaultClient
+	}
+	return b.Client
+}
+
+// resolve returns the URL of a file or directory in the vault.
+func (b *Backend) resolve(name string) string {
+	u := *b.URL
+	if name != "." {
+		u.Path = path.Join(u.Path, name)
+	}
+	return u.String()
+}
+
+func (b *Backend) do(req *http.Request) (*http.Response, error) {
+	if b.Username != "" {
+		req.SetBasicAuth(b.Username, b.Password)
+	}
+	return b.client().Do(req)
+}
+
+// Versions are the ETag or, failing that, the Last-Modified time prefixed
+// with "lm:".
+const lastModifiedPrefix = "lm:"
+
+func (b *Backend) Fetch(name, version string) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", b.resolve(name), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case strings.HasPrefix(version, lastModifiedPrefix):
+		req.Header.Set("If-Modified-Since", strings.TrimPrefix(version, lastModifiedPrefix))
+	case version != "":
+		req.Header.Set("If-None-Match", version)
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", remote.ErrNotModified
+	case http.StatusNotFound, http.StatusGone:
+		return nil, "", fs.ErrNotExist
+	default:
+		return nil, "", fmt.Errorf("GET %s: %s", name, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	version = resp.Header.Get("ETag")
+	// Weak ETags are only as good as the time; the file could change
+	// within the second
+	if version == "" || strings.HasPrefix(version, "W/") {
+		version = ""
+		if lm := resp.Header.Get("Last-Modified"); lm != "" {
+			version = lastModifiedPrefix + lm
+		}
+	}
+	return data, version, nil
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// multistatus is the part of a PROPFIND response that's read.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (b *Backend) List(dir string) ([]fs.FileInfo, error) {
+	target := b.resolve(dir)
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+	}
+	req, err := http.NewRequest("PROPFIND", target, bytes.NewBufferString(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		return nil, fs.ErrNotExist
+	default:
+		return nil, fmt.Errorf("PROPFIND %s: %s", dir, resp.Status)
+	}
+
+	var ms multistatus
+	if err = xml.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %s", dir, err)
+	}
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	for _, r := range ms.Responses {
+		href, err := base.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		rel := strings.Trim(strings.TrimPrefix(href.Path, base.Path), "/")
+		// The directory itself is listed too
+		if rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		fi := &fileInfo{name: rel}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			fi.dir = ps.Prop.ResourceType.Collection != nil
+			fi.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			fi.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+		}
+		infos = append(infos, fi)
+	}
+	if infos == nil && len(ms.Responses) == 0 {
+		return nil, errors.New("empty PROPFIND response")
+	}
+	return infos, nil
+}
+
+// A fileInfo describes a file listed by PROPFIND.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0500
+	}
+	return 0400
+}
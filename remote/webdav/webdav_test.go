@@ -0,0 +1,103 @@
+package webdav
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mpage/onepassword/remote"
+	"golang.org/x/net/webdav"
+)
+
+func TestBackend(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "vault", "default"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	profile := filepath.Join(dir, "vault", "default", "profile.js")
+	if err := ioutil.WriteFile(profile, []byte("var profile={};"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vault", "default", "band_0.js"), []byte("ld({});"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var gets, sent int
+	dav := &webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "wendy" || pass != "hunter2" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == "GET" {
+			gets++
+			rec := httptest.NewRecorder()
+			dav.ServeHTTP(rec, r)
+			if rec.Code == http.StatusOK {
+				sent++
+			}
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Scheme = "webdav+http"
+	u.User = url.UserPassword("wendy", "hunter2")
+	b := &Backend{URL: toHTTP(u), Username: "wendy", Password: "hunter2"}
+	cache := t.TempDir()
+
+	data, err := fs.ReadFile(remote.New(b, cache), "default/profile.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "var profile={};" {
+		t.Errorf("read %q", data)
+	}
+	if _, err = fs.ReadFile(remote.New(b, cache), "default/band_F.js"); err == nil {
+		t.Error("read a missing band")
+	}
+
+	names, err := fs.Glob(remote.New(b, cache), "default/band_*.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "default/band_0.js" {
+		t.Errorf("glob found %v", names)
+	}
+
+	// Unchanged files are revalidated, not sent again
+	gets, sent = 0, 0
+	if data, err = fs.ReadFile(remote.New(b, cache), "default/profile.js"); err != nil || string(data) != "var profile={};" {
+		t.Fatalf("cached read %q, %v", data, err)
+	}
+	if gets != 1 || sent != 0 {
+		t.Errorf("revalidation made %d requests sending %d files", gets, sent)
+	}
+
+	if err = ioutil.WriteFile(profile, []byte("var profile={\"changed\":true};"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = fs.ReadFile(remote.New(b, cache), "default/profile.js"); err != nil || string(data) != "var profile={\"changed\":true};" {
+		t.Errorf("changed read %q, %v", data, err)
+	}
+
+	b.Password = "wrong"
+	if _, err = fs.ReadFile(remote.New(b, ""), "default/profile.js"); err == nil {
+		t.Error("read with the wrong password")
+	}
+}
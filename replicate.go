@@ -0,0 +1,294 @@
+package onepassword
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// errSourceRekeyed stops replication when the source's keys change.
+var errSourceRekeyed = errors.New("the source vault's keys changed; open it with its new password to resume")
+
+// replicaIterations is how many PBKDF2 rounds derive the keys of replicas
+// given their own password, as 1Password uses for new OPVault profiles.
+const replicaIterations = 100000
+
+// CreateReplica creates an empty OPVault directory at dir for Replicate to
+// fill from src. If masterPass is empty, the replica has the profile of
+// src, so the same password and keys unlock it; otherwise it gets keys of
+// its own, derived from masterPass, and items are re-encrypted as they're
+// copied.
+func CreateReplica(dir string, src *Vault, masterPass string) error {
+	prof, err := src.store.profile()
+	if err != nil {
+		return err
+	}
+	if masterPass != "" {
+		if prof, err = newProfile(masterPass); err != nil {
+			return err
+		}
+	}
+	now := time.Now().Unix()
+	data, err := json.Marshal(map[string]interface{}{
+		"uuid":          NewUUID(),
+		"profileName":   DefaultProfile,
+		"salt":          prof.Salt,
+		"iterations":    prof.Iterations,
+		"masterKey":     prof.MasterKey,
+		"overviewKey":   prof.OverviewKey,
+		"createdAt":     now,
+		"updatedAt":     now,
+		"lastUpdatedBy": "opvault",
+	})
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(dir, DefaultProfile, "profile.js")
+	if _, err = os.Stat(name); err == nil {
+		return &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, append(append([]byte("var profile="), data...), ';'), 0600)
+}
+
+// newProfile returns a profile with new master and overview keys,
+// encrypted with keys derived from masterPass.
+func newProfile(masterPass string) (*profileRecord, error) {
+	prof := &profileRecord{Salt: make([]byte, 16), Iterations: replicaIterations}
+	if _, err := rand.Read(prof.Salt); err != nil {
+		return nil, err
+	}
+	derived := crypto.ComputeDerivedKeys(masterPass, prof.Salt, prof.Iterations)
+	// The keys are the SHA-512 of the random data encrypted here
+	newKeys := func() ([]byte, error) {
+		plain := make([]byte, 256)
+		if _, err := rand.Read(plain); err != nil {
+			return nil, err
+		}
+		return crypto.EncryptOPData01(plain, derived)
+	}
+	var err error
+	if prof.MasterKey, err = newKeys(); err != nil {
+		return nil, err
+	}
+	if prof.OverviewKey, err = newKeys(); err != nil {
+		return nil, err
+	}
+	return prof, nil
+}
+
+// Replicate keeps dst, an OPVault directory such as one made by
+// CreateReplica, a copy of src until ctx is done, for read replicas kept
+// offline or off-site. The items of src are copied first; after that, src
+// is watched as by Watch, and the items changed, as listed by
+// ChangesSince, are copied as each change syncs. Items of dst that src no
+// longer has are removed. Items keep their uuids, times, folders, and
+// place in the trash, and folders are copied too. Item keys and overviews
+// are re-encrypted with the keys of dst; details are copied as they are,
+// as they're encrypted with the item keys.
+//
+// Nothing else should write dst, as its changes would be overwritten. If
+// the keys of src change, replication stops with an error, as src must be
+// opened again with its new password. Only OPVault directories on this
+// computer can be replicated from.
+func Replicate(ctx context.Context, src, dst *Vault) error {
+	st, ok := dst.store.(*opvaultStore)
+	if !ok {
+		return errors.New("only OPVault directories can be replicated to")
+	}
+	events, err := src.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	watermark, err := replicate(src, dst, st, 0)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			if ev.Kind == VaultRekeyed {
+				return errSourceRekeyed
+			}
+		}
+		// The rest of a sync's events are covered by the same changes
+		for drained := false; !drained; {
+			select {
+			case ev := <-events:
+				if ev.Kind == VaultRekeyed {
+					return errSourceRekeyed
+				}
+			default:
+				drained = true
+			}
+		}
+		if watermark, err = replicate(src, dst, st, watermark); err != nil {
+			return err
+		}
+	}
+}
+
+// replicate copies the items of src changed since watermark to dst,
+// removes the items of dst that src lacks, and returns the new watermark.
+func replicate(src, dst *Vault, st *opvaultStore, watermark uint64) (uint64, error) {
+	cs, err := src.ChangesSince(watermark)
+	if err != nil {
+		return 0, err
+	}
+	recs, err := src.store.records()
+	if err != nil {
+		return 0, err
+	}
+	trashed, err := src.store.trashed()
+	if err != nil {
+		return 0, err
+	}
+	byUuid := make(map[string]*record)
+	inTrash := make(map[string]bool)
+	for _, r := range recs {
+		byUuid[r.Uuid] = r
+	}
+	for _, r := range trashed {
+		byUuid[r.Uuid] = r
+		inTrash[r.Uuid] = true
+	}
+
+	changed := make(map[string]*bandItem)
+	for _, list := range [][]string{cs.Added, cs.Modified, cs.Deleted} {
+		for _, uuid := range list {
+			item, err := replicaItem(src, dst, byUuid[uuid], inTrash[uuid])
+			if err != nil {
+				return 0, fmt.Errorf("item %s: %s", uuid, err)
+			}
+			changed[uuid] = item
+		}
+	}
+	err = st.update(func(items map[string]*bandItem) (map[string]*bandItem, error) {
+		for uuid := range items {
+			if byUuid[uuid] == nil {
+				changed[uuid] = nil
+			}
+		}
+		return changed, nil
+	}, dst.overviewKP)
+	if err != nil {
+		return 0, err
+	}
+	if err = replicateFolders(src, dst, st); err != nil {
+		return 0, err
+	}
+	return cs.Watermark, nil
+}
+
+// replicaItem returns the band item copying r to dst.
+func replicaItem(src, dst *Vault, r *record, trashed bool) (*bandItem, error) {
+	if r.Details == nil {
+		if err := src.store.details(r); err != nil {
+			return nil, err
+		}
+	}
+	kp, err := crypto.DecryptItemKey(r.Key, src.masterKP)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.EncryptItemKey(kp, dst.masterKP)
+	if err != nil {
+		return nil, err
+	}
+	overview, err := reencrypt(r.Overview, src.overviewKP, dst.overviewKP)
+	if err != nil {
+		return nil, err
+	}
+	return &bandItem{
+		Uuid:     r.Uuid,
+		Category: r.Category,
+		Created:  r.Created,
+		Updated:  r.Updated,
+		Tx:       r.Tx,
+		Fave:     r.FaveIndex,
+		Folder:   r.Folder,
+		Trashed:  trashed,
+		Key:      key,
+		Overview: overview,
+		Details:  r.Details,
+	}, nil
+}
+
+func reencrypt(opdata []byte, from, to *crypto.KeyPair) ([]byte, error) {
+	plain, err := crypto.DecryptOPData01(opdata, from)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.EncryptOPData01(plain, to)
+}
+
+// replicateFolders copies the folders of src to dst, unless dst already
+// has the same folders.
+func replicateFolders(src, dst *Vault, st *opvaultStore) error {
+	fst, ok := src.store.(folderStore)
+	if !ok {
+		return nil
+	}
+	srcRecs, err := fst.folders()
+	if err != nil {
+		return err
+	}
+	dstRecs, err := st.folders()
+	if err != nil {
+		return err
+	}
+	srcPlain, err := plainFolders(srcRecs, src.overviewKP)
+	if err != nil {
+		return err
+	}
+	if dstPlain, err := plainFolders(dstRecs, dst.overviewKP); err == nil && reflect.DeepEqual(srcPlain, dstPlain) {
+		return nil
+	}
+
+	folders := make(map[string]*folderRecord, len(srcRecs))
+	for _, r := range srcRecs {
+		overview, err := reencrypt(r.Overview, src.overviewKP, dst.overviewKP)
+		if err != nil {
+			return err
+		}
+		folders[r.Uuid] = &folderRecord{r.Uuid, r.Parent, r.Smart, overview}
+	}
+	data, err := json.Marshal(folders)
+	if err != nil {
+		return err
+	}
+	return st.writeFile(path.Join(st.dir, "folders.js"), append(append([]byte("loadFolders("), data...), ");"...))
+}
+
+// plainFolders returns folder records keyed by uuid with their overviews
+// decrypted, for comparing folders encrypted with different keys.
+func plainFolders(recs []*folderRecord, kp *crypto.KeyPair) (map[string]folderRecord, error) {
+	plain := make(map[string]folderRecord, len(recs))
+	for _, r := range recs {
+		overview, err := crypto.DecryptOPData01(r.Overview, kp)
+		if err != nil {
+			return nil, err
+		}
+		plain[r.Uuid] = folderRecord{r.Uuid, r.Parent, r.Smart, overview}
+	}
+	return plain, nil
+}
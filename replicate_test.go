@@ -0,0 +1,102 @@
+package onepassword
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplicate(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem(uuidA1, CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem(uuidB2, CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, true)
+	srcDir, dstDir := filepath.Join(dir, "src.opvault"), filepath.Join(dir, "dst.opvault")
+	writeFixture(t, f, srcDir)
+	src, err := NewVault(testPassword, VaultConfig{DBPath: srcDir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer src.Close()
+
+	if err = CreateReplica(dstDir, src, "swordfish"); err != nil {
+		t.Fatalf("Failed creating replica: %s", err)
+	}
+	if err = CreateReplica(dstDir, src, "swordfish"); !os.IsExist(err) {
+		t.Errorf("Expected an existing replica not to be replaced. Got %v.", err)
+	}
+	dst, err := NewVault("swordfish", VaultConfig{DBPath: dstDir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening replica: %s", err)
+	}
+	defer dst.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Replicate(ctx, src, dst) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Replication ended with %v", err)
+		}
+	}()
+
+	// waitFor reopens the replica until it holds A1 titled title
+	waitFor := func(title string) *Vault {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			v, err := NewVault("swordfish", VaultConfig{DBPath: dstDir, Profile: "default"})
+			if err != nil {
+				t.Fatalf("Failed opening replica: %s", err)
+			}
+			if item, err := v.Item(uuidA1); err == nil && item.Title == title {
+				return v
+			}
+			v.Close()
+			if time.Now().After(deadline) {
+				t.Fatalf("Replica never held %q", title)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	replica := waitFor("GitHub")
+	item, err := replica.Item(uuidA1)
+	if err != nil || item.Password() != "hunter2" {
+		t.Errorf("Expected the replicated item's details. Got %+v, %v.", item, err)
+	}
+	if trashed, err := replica.store.trashed(); err != nil || len(trashed) != 1 || trashed[0].Uuid != uuidB2 {
+		t.Errorf("Expected B2 in the replica's trash. Got %v, %v.", trashed, err)
+	}
+	replica.Close()
+
+	// Another program saves an item in the source
+	other, err := NewVault(testPassword, VaultConfig{DBPath: srcDir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer other.Close()
+	if item, err = other.Item(uuidA1); err != nil {
+		t.Fatalf("Failed reading item: %s", err)
+	}
+	item.Title = "GitHub Enterprise"
+	if err = other.SaveItem(item); err != nil {
+		t.Fatalf("Failed saving item: %s", err)
+	}
+	waitFor("GitHub Enterprise").Close()
+}
+
+func TestCreateReplicaSameKeys(t *testing.T) {
+	f := newOPVaultFixture(t)
+	src := f.open()
+	dir := t.TempDir()
+	if err := CreateReplica(dir, src, ""); err != nil {
+		t.Fatalf("Failed creating replica: %s", err)
+	}
+	dst, err := NewVaultWithKeys(src.DerivedKeys(), VaultConfig{DBPath: dir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Expected the source's keys to open the replica: %s", err)
+	}
+	dst.Close()
+}
@@ -0,0 +1,312 @@
+// Package restapi serves a vault over HTTP to programs that can't use the
+// Go package, such as scripts and services on the same host. Every request
+// must carry one of the server's tokens as "Authorization: Bearer <token>".
+// The endpoints only accept GET:
+//
+//	/v1/items?filter=expr                    items matching a filter expression
+//	/v1/search?q=query                       items matching a search, best first
+//	/v1/items/{uuid}                         an item with its fields and notes
+//	/v1/items/{uuid}/fields/{name}           a field's value, as plain text
+//	/v1/items/{uuid}/totp                    the current one-time password
+//	/v1/items/{uuid}/attachments             the item's attachments
+//	/v1/items/{uuid}/attachments/{uuid}      an attachment's contents
+//
+// Lists leave out fields and notes. Fields are named as Item.Field names
+// them. Failures are answered with a JSON object holding an "error".
+package restapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// An Item is an item as the API returns it.
+type Item struct {
+	Uuid     string    `json:"uuid"`
+	Title    string    `json:"title"`
+	Category string    `json:"category"`
+	Info     string    `json:"info,omitempty"`
+	Url      string    `json:"url,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Fields   []Field   `json:"fields,omitempty"`
+	Notes    string    `json:"notes,omitempty"`
+}
+
+// A Field is one of an item's fields.
+type Field struct {
+	Section   string `json:"section,omitempty"`
+	Id        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	Value     string `json:"value"`
+	Concealed bool   `json:"concealed,omitempty"`
+}
+
+// A TOTP is an item's current one-time password.
+type TOTP struct {
+	Code      string `json:"code"`
+	Remaining int    `json:"remaining"` // Seconds until the next code
+}
+
+// An Attachment describes a file attached to an item.
+type Attachment struct {
+	Uuid    string    `json:"uuid"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// NewItem returns the API's form of item, with its fields and notes if
+// details is set.
+func NewItem(item *onepassword.Item, details bool) Item {
+	i := Item{
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Category: item.Category.Name,
+		Info:     item.Info,
+		Url:      item.Url,
+		Tags:     item.Tags,
+		Created:  item.Created,
+		Updated:  item.Updated,
+	}
+	if details {
+		for _, f := range item.Fields() {
+			i.Fields = append(i.Fields, Field{f.Section, f.Id, f.Name, f.Kind, f.Value, f.Concealed})
+		}
+		i.Notes = item.Notes()
+	}
+	return i
+}
+
+// NewToken returns a random token for a client to authenticate with.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// A Source is what the API serves; *onepassword.Vault is one.
+type Source interface {
+	Filter(expr string) ([]onepassword.Item, error)
+	Search(query string) ([]onepassword.SearchResult, error)
+	Item(uuid string) (*onepassword.Item, error)
+	Attachments(item *onepassword.Item) ([]onepassword.Attachment, error)
+	ReadAttachment(a *onepassword.Attachment) ([]byte, error)
+}
+
+// A Server answers API requests from Vault, for clients holding one of
+// Tokens. Vaults aren't safe for concurrent use, so requests are answered
+// one at a time.
+type Server struct {
+	Vault  Source
+	Tokens []string
+
+	mu sync.Mutex
+}
+
+// An httpError is a failure with the status to answer it with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{status, fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="opvault"`)
+		writeError(w, errorf(http.StatusUnauthorized, "missing or unknown token"))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.route(w, r); err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *Server) filter(ctx context.Context, expr string) ([]onepassword.Item, error) {
+	if cs, ok := s.Vault.(onepassword.ContextSource); ok {
+		return cs.FilterContext(ctx, expr)
+	}
+	return s.Vault.Filter(expr)
+}
+
+func (s *Server) search(ctx context.Context, query string) ([]onepassword.SearchResult, error) {
+	if cs, ok := s.Vault.(onepassword.ContextSource); ok {
+		return cs.SearchContext(ctx, query)
+	}
+	return s.Vault.Search(query)
+}
+
+// authorized reports whether r carries one of the server's tokens. Every
+// token is compared, in constant time, so the time taken doesn't reveal
+// which tokens are close.
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	ok := 0
+	for _, t := range s.Tokens {
+		if t != "" {
+			ok |= subtle.ConstantTimeCompare(token, []byte(t))
+		}
+	}
+	return ok == 1
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) error {
+	// Split before unescaping, so field names may hold escaped slashes
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i := range parts {
+		var err error
+		if parts[i], err = url.PathUnescape(parts[i]); err != nil {
+			return errorf(http.StatusBadRequest, "%s", err)
+		}
+	}
+	if len(parts) < 2 || parts[0] != "v1" {
+		return errorf(http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "items":
+		items, err := s.filter(r.Context(), r.URL.Query().Get("filter"))
+		if err != nil {
+			return errorf(http.StatusBadRequest, "%s", err)
+		}
+		list := make([]Item, len(items))
+		for i := range items {
+			list[i] = NewItem(&items[i], false)
+		}
+		return writeJSON(w, list)
+
+	case len(parts) == 2 && parts[1] == "search":
+		results, err := s.search(r.Context(), r.URL.Query().Get("q"))
+		if err != nil {
+			return err
+		}
+		list := make([]Item, len(results))
+		for i := range results {
+			list[i] = NewItem(&results[i].Item, false)
+		}
+		return writeJSON(w, list)
+
+	case len(parts) >= 3 && parts[1] == "items":
+		item, err := s.Vault.Item(parts[2])
+		if err == onepassword.ErrItemNotFound {
+			return errorf(http.StatusNotFound, "no item %s", parts[2])
+		} else if err != nil {
+			return err
+		}
+		return s.itemEndpoint(w, item, parts[3:])
+	}
+	return errorf(http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+}
+
+// itemEndpoint answers requests for an item and its parts.
+func (s *Server) itemEndpoint(w http.ResponseWriter, item *onepassword.Item, parts []string) error {
+	switch {
+	case len(parts) == 0:
+		return writeJSON(w, NewItem(item, true))
+
+	case len(parts) == 2 && parts[0] == "fields":
+		value, ok := item.Field(parts[1])
+		if !ok {
+			return errorf(http.StatusNotFound, "%s has no field %q", item.Title, parts[1])
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, err := w.Write([]byte(value))
+		return err
+
+	case len(parts) == 1 && parts[0] == "totp":
+		code, remaining, err := item.TOTPCode(time.Now())
+		if err != nil {
+			return errorf(http.StatusNotFound, "%s", err)
+		}
+		return writeJSON(w, TOTP{code, int(remaining / time.Second)})
+
+	case len(parts) >= 1 && len(parts) <= 2 && parts[0] == "attachments":
+		atts, err := s.Vault.Attachments(item)
+		if err != nil {
+			return err
+		}
+		if len(parts) == 1 {
+			list := make([]Attachment, len(atts))
+			for i, a := range atts {
+				list[i] = Attachment{a.Uuid, a.Name, a.Size, a.Created, a.Updated}
+			}
+			return writeJSON(w, list)
+		}
+		for i := range atts {
+			if atts[i].Uuid != parts[1] {
+				continue
+			}
+			data, err := s.Vault.ReadAttachment(&atts[i])
+			if err != nil {
+				return err
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": atts[i].Name}))
+			w.Header().Set("Cache-Control", "no-store")
+			_, err = w.Write(data)
+			return err
+		}
+		return errorf(http.StatusNotFound, "%s has no attachment %s", item.Title, parts[1])
+	}
+	return errorf(http.StatusNotFound, "no such endpoint")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeError answers with err, as a server error unless it's an httpError.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if he, ok := err.(*httpError); ok {
+		status = he.status
+	}
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
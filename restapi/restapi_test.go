@@ -0,0 +1,117 @@
+package restapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// fakeVault holds one Login with an attachment.
+type fakeVault struct {
+	item *onepassword.Item
+}
+
+func (v *fakeVault) Filter(expr string) ([]onepassword.Item, error) {
+	pred, err := onepassword.ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if !pred(v.item) {
+		return nil, nil
+	}
+	return []onepassword.Item{*v.item}, nil
+}
+
+func (v *fakeVault) Search(query string) ([]onepassword.SearchResult, error) {
+	return []onepassword.SearchResult{{Item: *v.item}}, nil
+}
+
+func (v *fakeVault) Item(uuid string) (*onepassword.Item, error) {
+	if uuid != v.item.Uuid {
+		return nil, onepassword.ErrItemNotFound
+	}
+	return v.item, nil
+}
+
+func (v *fakeVault) Attachments(item *onepassword.Item) ([]onepassword.Attachment, error) {
+	return []onepassword.Attachment{{Uuid: "C3", ItemUuid: item.Uuid, Name: "key.pem", Size: 5}}, nil
+}
+
+func (v *fakeVault) ReadAttachment(a *onepassword.Attachment) ([]byte, error) {
+	return []byte("-----"), nil
+}
+
+func TestServer(t *testing.T) {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title = "A1", "GitHub"
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(&Server{Vault: &fakeVault{item}, Tokens: []string{"secret"}})
+	defer ts.Close()
+
+	get := func(path, token string) (int, string) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	for _, c := range []struct {
+		path, token string
+		status      int
+		body        string
+	}{
+		{"/v1/items", "", 401, ""},
+		{"/v1/items", "wrong", 401, ""},
+		{"/v1/items/A1/fields/password", "secret", 200, "hunter2"},
+		{"/v1/items/A1/fields/nope", "secret", 404, ""},
+		{"/v1/items/B2", "secret", 404, ""},
+		{"/v1/items/A1/attachments/C3", "secret", 200, "-----"},
+		{"/v1/items/A1/totp", "secret", 404, ""},
+		{"/v1/items?filter=created:%3Cyesterday", "secret", 400, ""},
+		{"/v2/items", "secret", 404, ""},
+	} {
+		status, body := get(c.path, c.token)
+		if status != c.status || c.body != "" && body != c.body {
+			t.Errorf("GET %s: expected %d %q. Got %d %q.", c.path, c.status, c.body, status, body)
+		}
+	}
+
+	_, body := get("/v1/items/A1", "secret")
+	var got Item
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "GitHub" || len(got.Fields) != 2 || got.Fields[1].Value != "hunter2" {
+		t.Fatalf("Unexpected item: %+v", got)
+	}
+	_, body = get("/v1/search?q=git", "secret")
+	var list []Item
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Fields != nil {
+		t.Fatalf("Expected the list to leave out fields: %+v", list)
+	}
+}
@@ -0,0 +1,100 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// savedSearchSidecar names the sidecar holding saved searches.
+const savedSearchSidecar = "searches"
+
+// A SavedSearch is a named filter expression, the equivalent of a smart
+// folder. See ParseFilter for the expression syntax.
+type SavedSearch struct {
+	Name   string `json:"name"`
+	Filter string `json:"filter"`
+}
+
+// SavedSearches returns the searches saved for the vault's profile, in the
+// order they were saved.
+func (v *Vault) SavedSearches() ([]SavedSearch, error) {
+	data, err := v.readSidecar(savedSearchSidecar)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var searches []SavedSearch
+	if err = json.Unmarshal(data, &searches); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (v *Vault) writeSavedSearches(searches []SavedSearch) error {
+	data, err := json.Marshal(searches)
+	if err != nil {
+		return err
+	}
+	return v.writeSidecar(savedSearchSidecar, data)
+}
+
+// SaveSearch stores a search, replacing any existing search with the same
+// name. The filter must be a valid expression.
+func (v *Vault) SaveSearch(s SavedSearch) error {
+	if s.Name == "" {
+		return fmt.Errorf("saved search has no name")
+	}
+	if _, err := ParseFilter(s.Filter); err != nil {
+		return err
+	}
+
+	searches, err := v.SavedSearches()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range searches {
+		if searches[i].Name == s.Name {
+			searches[i] = s
+			replaced = true
+		}
+	}
+	if !replaced {
+		searches = append(searches, s)
+	}
+
+	return v.writeSavedSearches(searches)
+}
+
+// DeleteSearch removes the saved search with the supplied name.
+func (v *Vault) DeleteSearch(name string) error {
+	searches, err := v.SavedSearches()
+	if err != nil {
+		return err
+	}
+	for i := range searches {
+		if searches[i].Name == name {
+			return v.writeSavedSearches(append(searches[:i], searches[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no saved search named %q", name)
+}
+
+// RunSavedSearch returns the items matching the saved search with the
+// supplied name, sorted by title.
+func (v *Vault) RunSavedSearch(name string) ([]Item, error) {
+	searches, err := v.SavedSearches()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range searches {
+		if s.Name == name {
+			pred, err := ParseFilter(s.Filter)
+			if err != nil {
+				return nil, err
+			}
+			return v.List(pred)
+		}
+	}
+	return nil, fmt.Errorf("no saved search named %q", name)
+}
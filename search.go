@@ -0,0 +1,258 @@
+package onepassword
+
+import (
+	"context"
+	"regexp"
+	"runtime/trace"
+	"sort"
+	"strings"
+
+	"github.com/mpage/onepassword/search"
+)
+
+// Relative weights of overview fields when ranking search results.
+const (
+	titleWeight = 3
+	infoWeight  = 2
+	tagWeight   = 2
+	urlWeight   = 1
+)
+
+// A SearchResult is an item matching a search query.
+type SearchResult struct {
+	Item       Item
+	Score      float64
+	Highlights []Highlight // Where the query matched, in field order
+}
+
+// A Highlight locates matching text within one of an item's fields.
+type Highlight struct {
+	Field string // "title", "ainfo", "tags", "url", or a detail field name
+	Text  string // The full text of the field
+	Start int    // Byte offsets of the match in Text
+	End   int
+}
+
+// highlights converts matches within fields to highlights.
+func highlights(fields []search.Field, matches []search.Match) []Highlight {
+	var hs []Highlight
+	for _, m := range matches {
+		f := fields[m.Field]
+		hs = append(hs, Highlight{f.Name, f.Text, m.Start, m.End})
+	}
+	return hs
+}
+
+// MarkHighlights returns text with the highlighted parts wrapped in open and
+// close, e.g. ANSI bold sequences. Only highlights whose Text is text are
+// applied, so the highlights of a whole result may be passed for each field
+// being displayed.
+func MarkHighlights(text string, hs []Highlight, open, close string) string {
+	var b strings.Builder
+	last := 0
+	for _, h := range hs {
+		if h.Text != text || h.Start < last || h.End > len(text) {
+			continue
+		}
+		b.WriteString(text[last:h.Start])
+		b.WriteString(open)
+		b.WriteString(text[h.Start:h.End])
+		b.WriteString(close)
+		last = h.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// itemIndex holds the search and tag indexes over a snapshot of the vault's
+// items. Both refer to items by their position in items.
+type itemIndex struct {
+	items []Item
+	index *search.Index
+	tags  map[string][]int
+}
+
+func newItemIndex(items []Item) *itemIndex {
+	idx := &itemIndex{
+		items: items,
+		index: search.NewIndex(),
+		tags:  buildTagIndex(items),
+	}
+	for i := range items {
+		idx.index.Add(searchFields(&items[i])...)
+	}
+	return idx
+}
+
+// searchFields returns the overview fields of an item that are indexed.
+func searchFields(item *Item) []search.Field {
+	fields := []search.Field{
+		{Name: "title", Text: item.Title, Weight: titleWeight},
+		{Name: "ainfo", Text: item.Info, Weight: infoWeight},
+	}
+	for _, t := range item.Tags {
+		fields = append(fields, search.Field{Name: "tags", Text: t, Weight: tagWeight})
+	}
+	if item.Url != "" {
+		fields = append(fields, search.Field{Name: "url", Text: item.Url, Weight: urlWeight})
+	}
+	for _, l := range item.Urls {
+		fields = append(fields, search.Field{Name: "url", Text: l.Url, Weight: urlWeight})
+	}
+	return fields
+}
+
+// detailFields returns the names and values of the fields in an item's
+// details, plus its notes and password, for regular expression searches.
+func detailFields(item *Item) []search.Field {
+	d := item.credentials()
+	var fields []search.Field
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, search.Field{Name: name, Text: value, Weight: 1})
+		}
+	}
+
+	add("notesPlain", d.Description)
+	add("password", d.Password)
+	for _, f := range d.Fields {
+		add(f.Name, f.Value)
+	}
+	for _, s := range d.Sections {
+		for _, f := range s.Fields {
+			name := f.Name
+			if name == "" {
+				name = f.Id
+			}
+			add(name, f.Value)
+		}
+	}
+	return fields
+}
+
+func (idx *itemIndex) search(query string) []SearchResult {
+	var results []SearchResult
+	for _, r := range idx.index.Search(query) {
+		hs := highlights(idx.index.Fields(r.Doc), r.Matches)
+		results = append(results, SearchResult{idx.items[r.Doc], r.Score, hs})
+	}
+	return results
+}
+
+// searchIndex returns the vault's item index, building it from the
+// overviews of the vault's items the first time it is needed. Details
+// aren't decrypted, so they aren't kept for the life of the vault; callers
+// load them for the items they return. If ctx is done first, the index is
+// left to be built by the next search.
+func (v *Vault) searchIndex(ctx context.Context) (*itemIndex, error) {
+	v.indexMu.Lock()
+	defer v.indexMu.Unlock()
+
+	if v.index == nil {
+		defer trace.StartRegion(ctx, "onepassword.buildSearchIndex").End()
+		items, err := v.OverviewsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v.index = newItemIndex(items)
+	}
+
+	return v.index, nil
+}
+
+// Search finds items whose title, ainfo, tags, or URLs contain every word in
+// query. Results are ordered from most to least relevant.
+func (v *Vault) Search(query string) ([]SearchResult, error) {
+	return v.SearchContext(context.Background(), query)
+}
+
+// SearchContext is Search, stopping with ctx's error once ctx is done.
+func (v *Vault) SearchContext(ctx context.Context, query string) ([]SearchResult, error) {
+	idx, err := v.searchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := idx.search(query)
+	if err = v.resultDetails(ctx, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// sortResults orders results by descending score, then by title and uuid so
+// the order is stable across runs.
+func sortResults(results []SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := &results[i], &results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Item.Title != b.Item.Title {
+			return a.Item.Title < b.Item.Title
+		}
+		return a.Item.Uuid < b.Item.Uuid
+	})
+}
+
+// RegexpOptions control Vault.SearchRegexp.
+type RegexpOptions struct {
+	// Details extends the search from overviews to the names and values of
+	// every field in the item details, including concealed ones. This
+	// requires decrypting the details of every item in the vault, so it must
+	// be requested explicitly.
+	Details bool
+}
+
+// SearchRegexp finds items with overview fields, and optionally detail
+// fields, whose names or values match re. This is useful for audits such as
+// finding anything that looks like an AWS secret key:
+//
+//	re := regexp.MustCompile(`\b[A-Za-z0-9/+=]{40}\b`)
+//	results, err := v.SearchRegexp(re, RegexpOptions{Details: true})
+//
+// Items are scored by the number of matches, weighted like Search.
+func (v *Vault) SearchRegexp(re *regexp.Regexp, opts RegexpOptions) ([]SearchResult, error) {
+	idx, err := v.searchIndex(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// Details are decrypted into a copy, so the index keeps none
+	items := idx.items
+	if opts.Details {
+		items = append([]Item(nil), idx.items...)
+		if err = v.ensureDetails(context.Background(), items); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []SearchResult
+	for i := range items {
+		item := &items[i]
+		fields := idx.index.Fields(i)
+		var score float64
+		if opts.Details {
+			details := detailFields(item)
+			for _, f := range details {
+				if re.MatchString(f.Name) {
+					score += f.Weight
+				}
+			}
+			fields = append(append([]search.Field(nil), fields...), details...)
+		}
+
+		matches := search.RegexpMatches(re, fields)
+		for _, m := range matches {
+			score += fields[m.Field].Weight
+		}
+		if score > 0 {
+			hs := highlights(fields, search.MergeMatches(matches))
+			results = append(results, SearchResult{*item, score, hs})
+		}
+	}
+	sortResults(results)
+	if err = v.resultDetails(context.Background(), results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
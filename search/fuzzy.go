@@ -0,0 +1,187 @@
+package search
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Per-character scores used when rating a subsequence match.
+const (
+	scoreMatch       = 1.0
+	bonusConsecutive = 1.0
+	bonusBoundary    = 1.5
+	penaltyGap       = 0.1
+
+	// Typo matches score at most this much, so they rank below every
+	// subsequence match of reasonable quality.
+	maxTypoScore = 0.3
+)
+
+// A FuzzyMatch describes how a pattern matched some text.
+type FuzzyMatch struct {
+	Score     float64 // In (0, 1]. Higher is better.
+	Positions []int   // Byte offsets in the text of the matched characters
+}
+
+// Fuzzy matches pattern against text the way fzf does. Every character of
+// the pattern must appear in the text in order, case insensitively, so
+// "ghub" matches "GitHub". Characters at word boundaries and runs of
+// consecutive characters score higher, gaps score lower.
+//
+// Patterns that aren't a subsequence of the text still match with a low
+// score if they are within a small edit distance of part of the text, to
+// tolerate typos such as "gihtub". Such matches have no positions.
+func Fuzzy(pattern, text string) (FuzzyMatch, bool) {
+	p := []rune(toLower(pattern))
+	if len(p) == 0 {
+		return FuzzyMatch{}, false
+	}
+
+	t := []rune(text)
+	if m, ok := subsequence(p, t); ok {
+		return m, true
+	}
+
+	d := substringDistance(p, []rune(toLower(text)))
+	if d > maxTypos(len(p)) {
+		return FuzzyMatch{}, false
+	}
+	return FuzzyMatch{Score: maxTypoScore * (1 - float64(d)/float64(len(p)))}, true
+}
+
+func toLower(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
+
+// maxTypos returns the edit distance tolerated for a pattern of length n.
+func maxTypos(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// subsequence finds the shortest window of t containing p as a subsequence,
+// then scores the characters matched within it.
+func subsequence(p, t []rune) (FuzzyMatch, bool) {
+	// Scan forward for the earliest end of a match
+	pi, end := 0, -1
+	for ti, r := range t {
+		if unicode.ToLower(r) == p[pi] {
+			pi++
+			if pi == len(p) {
+				end = ti
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return FuzzyMatch{}, false
+	}
+
+	// Scan backward from the end for the latest start
+	idx := make([]int, len(p))
+	pi = len(p) - 1
+	for ti := end; ti >= 0 && pi >= 0; ti-- {
+		if unicode.ToLower(t[ti]) == p[pi] {
+			idx[pi] = ti
+			pi--
+		}
+	}
+
+	// Score the match
+	var score float64
+	for i, ti := range idx {
+		score += scoreMatch
+		if i > 0 && idx[i-1] == ti-1 {
+			score += bonusConsecutive
+		} else if i > 0 {
+			score -= penaltyGap * float64(ti-idx[i-1]-1)
+		}
+		if isBoundary(t, ti) {
+			score += bonusBoundary
+		}
+	}
+	max := float64(len(p)) * (scoreMatch + bonusConsecutive + bonusBoundary)
+	score /= max
+	if score <= 0 {
+		score = 0.01
+	} else if score > 1 {
+		score = 1
+	}
+
+	// Convert rune indices to byte offsets
+	positions := make([]int, len(idx))
+	off, ri := 0, 0
+	for i, ti := range idx {
+		for ; ri < ti; ri++ {
+			off += utf8.RuneLen(t[ri])
+		}
+		positions[i] = off
+	}
+
+	return FuzzyMatch{Score: score, Positions: positions}, true
+}
+
+// isBoundary returns true if t[i] starts a word: it is the first character,
+// follows a non alphanumeric character, or is an upper case letter
+// following a lower case one.
+func isBoundary(t []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, cur := t[i-1], t[i]
+	if !unicode.IsLetter(prev) && !unicode.IsNumber(prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+// substringDistance returns the smallest optimal string alignment distance
+// between p and any substring of t.
+func substringDistance(p, t []rune) int {
+	// Rows are pattern prefixes, columns text positions. A match may start
+	// anywhere in t, so the first row is all zeros.
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for i := 1; i <= len(p); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if p[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && p[i-1] == t[j-2] && p[i-2] == t[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	best := len(p)
+	for _, d := range prev {
+		if d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func minInt(a int, rest ...int) int {
+	for _, b := range rest {
+		if b < a {
+			a = b
+		}
+	}
+	return a
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzySubsequence(t *testing.T) {
+	m, ok := Fuzzy("ghub", "GitHub")
+	if !ok {
+		t.Fatalf("Expected ghub to match GitHub")
+	} else if !reflect.DeepEqual(m.Positions, []int{0, 3, 4, 5}) {
+		t.Fatalf("Unexpected positions: %v", m.Positions)
+	}
+
+	boundary, _ := Fuzzy("gh", "GitHub")
+	inner, _ := Fuzzy("it", "GitHub")
+	if boundary.Score <= inner.Score {
+		t.Fatalf("Expected boundary match to outscore inner match: %v <= %v", boundary.Score, inner.Score)
+	}
+}
+
+func TestFuzzyTypos(t *testing.T) {
+	m, ok := Fuzzy("gihtub", "GitHub")
+	if !ok {
+		t.Fatalf("Expected transposition to match")
+	} else if m.Score > maxTypoScore || m.Positions != nil {
+		t.Fatalf("Unexpected typo match: %+v", m)
+	}
+	if _, ok := Fuzzy("bank", "GitHub"); ok {
+		t.Fatalf("Expected unrelated text not to match")
+	}
+}
+
+func TestSearchFallsBackToFuzzy(t *testing.T) {
+	x := NewIndex()
+	x.Add(Field{"title", "GitHub", 3})
+	x.Add(Field{"title", "Bank", 3})
+
+	results := x.Search("ghub")
+	if len(results) != 1 || results[0].Doc != 0 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+}
@@ -0,0 +1,22 @@
+package search
+
+import "regexp"
+
+// A Match locates matching text within one of a document's fields.
+type Match struct {
+	Field int // Index of the field
+	Start int // Byte offsets of the match in the field's text
+	End   int
+}
+
+// RegexpMatches returns every non-overlapping match of re in the text of
+// the supplied fields, in field order.
+func RegexpMatches(re *regexp.Regexp, fields []Field) []Match {
+	var matches []Match
+	for i, f := range fields {
+		for _, loc := range re.FindAllStringIndex(f.Text, -1) {
+			matches = append(matches, Match{i, loc[0], loc[1]})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,266 @@
+// Package search implements an in-memory index for finding vault items by
+// the text in their overviews.
+//
+// The index knows nothing about items. Callers add a document per item,
+// made of weighted fields, and get back document ids ordered by relevance
+// along with the locations of the matching text.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Field is a named piece of text belonging to a document, such as an
+// item's title. Matches in fields with a higher weight rank higher.
+type Field struct {
+	Name   string
+	Text   string
+	Weight float64
+}
+
+// Result is a document matching a query.
+type Result struct {
+	Doc     int // Id returned by Index.Add
+	Score   float64
+	Matches []Match // Ordered by field and offset, never overlapping
+}
+
+// fuzzyWeight scales fuzzy match scores so they rank below prefix matches.
+const fuzzyWeight = 0.25
+
+type posting struct {
+	doc   int
+	field int
+	start int // Byte offset of the token in the field's text
+}
+
+// Index is an inverted index from tokens to the documents containing them.
+// It is not safe for concurrent mutation.
+type Index struct {
+	docs     [][]Field
+	postings map[string][]posting
+	tokens   []string // Keys of postings, sorted lazily for prefix lookups
+	sorted   bool
+}
+
+func NewIndex() *Index {
+	return &Index{postings: make(map[string][]posting)}
+}
+
+type span struct {
+	token string // Lower cased
+	start int    // Byte offset in the original text
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// spans splits text into runs of letters and digits.
+func spans(text string) []span {
+	var out []span
+	start := -1
+	for i, r := range text {
+		switch {
+		case isSeparator(r) && start >= 0:
+			out = append(out, span{strings.ToLower(text[start:i]), start})
+			start = -1
+		case !isSeparator(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, span{strings.ToLower(text[start:]), start})
+	}
+	return out
+}
+
+// Tokenize splits text into lower case runs of letters and digits.
+func Tokenize(text string) []string {
+	var toks []string
+	for _, s := range spans(text) {
+		toks = append(toks, s.token)
+	}
+	return toks
+}
+
+// Add indexes a document made of the supplied fields and returns its id. Ids
+// are assigned sequentially starting at zero.
+func (x *Index) Add(fields ...Field) int {
+	doc := len(x.docs)
+	x.docs = append(x.docs, fields)
+
+	for i, f := range fields {
+		for _, s := range spans(f.Text) {
+			if _, ok := x.postings[s.token]; !ok {
+				x.tokens = append(x.tokens, s.token)
+				x.sorted = false
+			}
+			x.postings[s.token] = append(x.postings[s.token], posting{doc, i, s.start})
+		}
+	}
+
+	return doc
+}
+
+// Len returns the number of documents in the index.
+func (x *Index) Len() int {
+	return len(x.docs)
+}
+
+// Fields returns the fields the document was indexed with.
+func (x *Index) Fields(doc int) []Field {
+	return x.docs[doc]
+}
+
+// hit records how well a term matched a document.
+type hit struct {
+	score   float64
+	matches []Match
+}
+
+// Search returns the documents matching every term in query, ordered by
+// descending score and then by id. A term matches any token it is a prefix
+// of; whole-token matches score twice as much as prefix matches. Documents
+// without such a match fall back to fuzzy matching against whole fields,
+// which scores lower still.
+func (x *Index) Search(query string) []Result {
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	if !x.sorted {
+		sort.Strings(x.tokens)
+		x.sorted = true
+	}
+
+	var hits map[int]*hit
+	for _, term := range terms {
+		termHits := x.searchTerm(term)
+		if hits == nil {
+			hits = termHits
+			continue
+		}
+		for doc, h := range hits {
+			if th, ok := termHits[doc]; ok {
+				h.score += th.score
+				h.matches = append(h.matches, th.matches...)
+			} else {
+				delete(hits, doc)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(hits))
+	for doc, h := range hits {
+		results = append(results, Result{doc, h.score, MergeMatches(h.matches)})
+	}
+	SortResults(results)
+
+	return results
+}
+
+// searchTerm returns the best score of term within each matching document
+// along with every location it matched.
+func (x *Index) searchTerm(term string) map[int]*hit {
+	hits := make(map[int]*hit)
+	termRunes := utf8.RuneCountInString(term)
+	i := sort.SearchStrings(x.tokens, term)
+	for ; i < len(x.tokens) && strings.HasPrefix(x.tokens[i], term); i++ {
+		tok := x.tokens[i]
+		mult := 0.5
+		if tok == term {
+			mult = 1
+		}
+		for _, p := range x.postings[tok] {
+			f := x.docs[p.doc][p.field]
+			h := hits[p.doc]
+			if h == nil {
+				h = &hit{}
+				hits[p.doc] = h
+			}
+			if s := f.Weight * mult; s > h.score {
+				h.score = s
+			}
+			end := p.start + runeOffset(f.Text[p.start:], termRunes)
+			h.matches = append(h.matches, Match{p.field, p.start, end})
+		}
+	}
+
+	for doc, fields := range x.docs {
+		if _, ok := hits[doc]; ok {
+			continue
+		}
+		var h *hit
+		for fi, f := range fields {
+			m, ok := Fuzzy(term, f.Text)
+			if !ok {
+				continue
+			}
+			if h == nil {
+				h = &hit{}
+				hits[doc] = h
+			}
+			if s := f.Weight * fuzzyWeight * m.Score; s > h.score {
+				h.score = s
+			}
+			for _, pos := range m.Positions {
+				_, size := utf8.DecodeRuneInString(f.Text[pos:])
+				h.matches = append(h.matches, Match{fi, pos, pos + size})
+			}
+		}
+	}
+
+	return hits
+}
+
+// runeOffset returns the byte offset of the n'th rune in s.
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// MergeMatches sorts matches by field and offset and merges those that
+// overlap or touch.
+func MergeMatches(matches []Match) []Match {
+	if len(matches) == 0 {
+		return nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Field != matches[j].Field {
+			return matches[i].Field < matches[j].Field
+		}
+		return matches[i].Start < matches[j].Start
+	})
+
+	out := []Match{matches[0]}
+	for _, m := range matches[1:] {
+		last := &out[len(out)-1]
+		if m.Field == last.Field && m.Start <= last.End {
+			if m.End > last.End {
+				last.End = m.End
+			}
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// SortResults orders results by descending score, breaking ties by id.
+func SortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc < results[j].Doc
+	})
+}
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchRanksByFieldWeight(t *testing.T) {
+	x := NewIndex()
+	x.Add(Field{"url", "https://github.com", 1})
+	x.Add(Field{"title", "GitHub", 3})
+	x.Add(Field{"title", "GitLab", 3})
+
+	results := x.Search("github")
+	if len(results) != 2 || results[0].Doc != 1 || results[1].Doc != 0 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+}
+
+func TestSearchRequiresAllTerms(t *testing.T) {
+	x := NewIndex()
+	x.Add(Field{"title", "Work email", 3})
+	x.Add(Field{"title", "Personal email", 3})
+
+	results := x.Search("em wor")
+	if len(results) != 1 || results[0].Doc != 0 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	if results := x.Search("   "); results != nil {
+		t.Fatalf("Expected no results for empty query: %+v", results)
+	}
+}
+
+func TestSearchMatches(t *testing.T) {
+	x := NewIndex()
+	x.Add(Field{"title", "My GitHub (work)", 3}, Field{"url", "github.com", 1})
+
+	results := x.Search("git wo")
+	if len(results) != 1 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	expected := []Match{{0, 3, 6}, {0, 11, 13}, {1, 0, 3}}
+	if !reflect.DeepEqual(results[0].Matches, expected) {
+		t.Fatalf("Expected matches %v. Got %v.", expected, results[0].Matches)
+	}
+
+	results = x.Search("ghub")
+	expected = []Match{{0, 3, 4}, {0, 6, 9}, {1, 0, 1}, {1, 3, 6}}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Matches, expected) {
+		t.Fatalf("Expected fuzzy matches %v. Got %+v.", expected, results)
+	}
+}
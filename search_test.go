@@ -0,0 +1,40 @@
+package onepassword
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMarkHighlights(t *testing.T) {
+	hs := []Highlight{
+		{"title", "My GitHub", 3, 6},
+		{"url", "github.com", 0, 3},
+		{"title", "My GitHub", 7, 9},
+	}
+	if got := MarkHighlights("My GitHub", hs, "[", "]"); got != "My [Git]H[ub]" {
+		t.Fatalf("Unexpected marked text: %q", got)
+	}
+}
+
+func TestSearchDetails(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"Bank"}`, loginDetails, false)
+	v := f.open()
+	defer v.Close()
+
+	results, err := v.Search("git")
+	if err != nil || len(results) != 1 || results[0].Item.Password() != "hunter2" {
+		t.Fatalf("Expected GitHub with its details. Got %+v, %v.", results, err)
+	}
+	results, err = v.SearchRegexp(regexp.MustCompile("hunter"), RegexpOptions{Details: true})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Expected both items matching their passwords. Got %+v, %v.", results, err)
+	}
+	// The index holds overviews only
+	for _, item := range v.index.items {
+		if item.Details != nil {
+			t.Errorf("Expected no details for %s in the index", item.Title)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package onepassword
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// SecretRefScheme starts every secret reference.
+const SecretRefScheme = "opvault://"
+
+// A SecretRef points at a field of an item symbolically, so configuration
+// can name a secret without containing it. References have the form
+//
+//	opvault://vault/item/field
+//	opvault://vault/item/section/field
+//
+// where each part is percent encoded if it contains a slash or other
+// special character. The vault may be left empty, as in
+// opvault:///item/field, to mean whichever vault is open. Items are found
+// with Vault.FindItem, so they may be given by uuid or title.
+type SecretRef struct {
+	Vault   string
+	Item    string
+	Section string
+	Field   string
+}
+
+// ParseSecretRef parses a secret reference.
+func ParseSecretRef(ref string) (*SecretRef, error) {
+	if !strings.HasPrefix(ref, SecretRefScheme) {
+		return nil, fmt.Errorf("secret reference %q doesn't start with %s", ref, SecretRefScheme)
+	}
+	parts := strings.Split(ref[len(SecretRefScheme):], "/")
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, fmt.Errorf("secret reference %q must have the form %svault/item/[section/]field", ref, SecretRefScheme)
+	}
+	for i, p := range parts {
+		s, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("secret reference %q: %s", ref, err)
+		}
+		parts[i] = s
+	}
+
+	r := &SecretRef{Vault: parts[0], Item: parts[1], Field: parts[len(parts)-1]}
+	if len(parts) == 4 {
+		r.Section = parts[2]
+	}
+	if r.Item == "" || r.Field == "" {
+		return nil, fmt.Errorf("secret reference %q has no item or field", ref)
+	}
+	return r, nil
+}
+
+// IsSecretRef reports whether s looks like a secret reference.
+func IsSecretRef(s string) bool {
+	return strings.HasPrefix(s, SecretRefScheme)
+}
+
+func (r *SecretRef) String() string {
+	parts := []string{r.Vault, r.Item, r.Section, r.Field}
+	if r.Section == "" {
+		parts = []string{r.Vault, r.Item, r.Field}
+	}
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return SecretRefScheme + strings.Join(parts, "/")
+}
+
+// Name returns the name of the vault used in secret references: the file
+// name of the database or OPVault directory without its extension.
+func (v *Vault) Name() string {
+	base := filepath.Base(v.dbPath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Resolve returns the secret a reference points at. The reference's vault
+// must be empty or match the name or profile of this vault, ignoring case.
+func (v *Vault) Resolve(ref string) (string, error) {
+	r, err := ParseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if r.Vault != "" && !strings.EqualFold(r.Vault, v.Name()) && !strings.EqualFold(r.Vault, v.profile) {
+		return "", fmt.Errorf("secret reference %q is for vault %q, not %q", ref, r.Vault, v.Name())
+	}
+
+	field := r.Field
+	if r.Section != "" {
+		field = r.Section + "." + r.Field
+	}
+	return v.Lookup(r.Item, field)
+}
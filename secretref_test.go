@@ -0,0 +1,31 @@
+package onepassword
+
+import "testing"
+
+func TestParseSecretRef(t *testing.T) {
+	for _, tc := range []struct {
+		ref  string
+		want SecretRef
+	}{
+		{"opvault://Personal/GitHub/password", SecretRef{"Personal", "GitHub", "", "password"}},
+		{"opvault:///prod%2Fdb/Admin/user", SecretRef{"", "prod/db", "Admin", "user"}},
+		{"opvault://v/Home%20Wi-Fi/network%20name", SecretRef{"v", "Home Wi-Fi", "", "network name"}},
+	} {
+		r, err := ParseSecretRef(tc.ref)
+		if err != nil {
+			t.Fatalf("Failed parsing %q: %s", tc.ref, err)
+		}
+		if *r != tc.want {
+			t.Errorf("ParseSecretRef(%q) = %+v. Expected %+v.", tc.ref, *r, tc.want)
+		}
+		if r.String() != tc.ref {
+			t.Errorf("Expected %q to round trip. Got %q.", tc.ref, r.String())
+		}
+	}
+
+	for _, bad := range []string{"op://a/b/c", "opvault://a/b", "opvault://a//c", "opvault://a/b/c/d/e", "opvault://a/b/%zz"} {
+		if _, err := ParseSecretRef(bad); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
@@ -0,0 +1,597 @@
+package secretservice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/mpage/onepassword"
+)
+
+// BusName is the well-known name the service is found by.
+const BusName = "org.freedesktop.secrets"
+
+// The paths of the service's objects. Items are children of the
+// collection, named by their uuids.
+const (
+	ServicePath      dbus.ObjectPath = "/org/freedesktop/secrets"
+	CollectionPath   dbus.ObjectPath = ServicePath + "/collection/opvault"
+	DefaultAliasPath dbus.ObjectPath = ServicePath + "/aliases/default"
+	sessionPrefix                    = string(ServicePath) + "/session/"
+)
+
+const (
+	ifaceService        = "org.freedesktop.Secret.Service"
+	ifaceCollection     = "org.freedesktop.Secret.Collection"
+	ifaceItem           = "org.freedesktop.Secret.Item"
+	ifaceSession        = "org.freedesktop.Secret.Session"
+	ifaceProperties     = "org.freedesktop.DBus.Properties"
+	ifaceIntrospectable = "org.freedesktop.DBus.Introspectable"
+)
+
+// noPath is the path standing for no object, e.g. when no prompt is needed.
+const noPath dbus.ObjectPath = "/"
+
+func newError(name, format string, args ...interface{}) *dbus.Error {
+	return dbus.NewError(name, []interface{}{fmt.Sprintf(format, args...)})
+}
+
+var (
+	errNoSuchObject = newError("org.freedesktop.Secret.Error.NoSuchObject", "no such object")
+	errNoSession    = newError("org.freedesktop.Secret.Error.NoSession", "no such session")
+	errUnknown      = newError("org.freedesktop.DBus.Error.UnknownMethod", "no such method on this object")
+	errReadOnly     = newError("org.freedesktop.DBus.Error.PropertyReadOnly", "property is read-only")
+)
+
+func errNotSupported(what string) *dbus.Error {
+	return newError("org.freedesktop.DBus.Error.NotSupported", "%s isn't supported by opvault", what)
+}
+
+// vaultError returns the D-Bus error for an error from the vault.
+func vaultError(err error) *dbus.Error {
+	if err == onepassword.ErrItemNotFound {
+		return errNoSuchObject
+	}
+	return dbus.MakeFailedError(err)
+}
+
+// A secret is the API's Secret struct, (oayays).
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// The kinds of object a path may name.
+const (
+	objNone = iota
+	objService
+	objCollection
+	objItem
+	objSession
+)
+
+// object returns the kind of object p names and, for items, the item's
+// uuid. Items aren't checked to exist.
+func object(p dbus.ObjectPath) (kind int, uuid string) {
+	switch {
+	case p == ServicePath:
+		return objService, ""
+	case p == CollectionPath || p == DefaultAliasPath:
+		return objCollection, ""
+	case strings.HasPrefix(string(p), sessionPrefix):
+		return objSession, ""
+	}
+	for _, c := range []dbus.ObjectPath{CollectionPath, DefaultAliasPath} {
+		elem := strings.TrimPrefix(string(p), string(c)+"/")
+		if elem != string(p) && elem != "" && !strings.Contains(elem, "/") {
+			return objItem, uuidFromElement(elem)
+		}
+	}
+	return objNone, ""
+}
+
+// msgPath returns the path of the object msg calls.
+func msgPath(msg dbus.Message) dbus.ObjectPath {
+	p, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	return p
+}
+
+func itemPath(uuid string) dbus.ObjectPath {
+	return CollectionPath + "/" + dbus.ObjectPath(pathElement(uuid))
+}
+
+// Export serves s on conn, which the caller then claims BusName on. A
+// Server can only be exported once.
+func (s *Server) Export(conn *dbus.Conn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.sessions = make(map[dbus.ObjectPath]*session)
+	s.mu.Unlock()
+
+	// Each interface handles the whole tree, as godbus doesn't look past
+	// the nearest exported path for an object's interfaces
+	handlers := map[string]interface{}{
+		ifaceService:        serviceHandler{s},
+		ifaceCollection:     collectionHandler{s},
+		ifaceItem:           itemHandler{s},
+		ifaceSession:        sessionHandler{s},
+		ifaceProperties:     propertiesHandler{s},
+		ifaceIntrospectable: introspectHandler{s},
+	}
+	for iface, h := range handlers {
+		if err := conn.ExportSubtree(h, ServicePath, iface); err != nil {
+			return err
+		}
+	}
+
+	// Sessions end when their clients leave the bus
+	err := conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"))
+	if err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go func() {
+		for sig := range signals {
+			if sig.Name != "org.freedesktop.DBus.NameOwnerChanged" || len(sig.Body) != 3 {
+				continue
+			}
+			name, _ := sig.Body[0].(string)
+			owner, _ := sig.Body[2].(string)
+			if owner == "" {
+				s.closeSessions(name)
+			}
+		}
+	}()
+	return nil
+}
+
+// closeSessions closes the sessions of the client with the unique name.
+func (s *Server) closeSessions(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, sess := range s.sessions {
+		if sess.owner == name {
+			delete(s.sessions, p)
+		}
+	}
+}
+
+// getSecret returns the secret of the item with uuid, for the session.
+func (s *Server) getSecret(uuid string, sessionPath dbus.ObjectPath) (secret, *dbus.Error) {
+	sess, ok := s.sessions[sessionPath]
+	if !ok {
+		return secret{}, errNoSession
+	}
+	item, err := s.Vault.Item(uuid)
+	if err != nil {
+		return secret{}, vaultError(err)
+	}
+	params, value, err := sess.encrypt([]byte(Secret(item)))
+	if err != nil {
+		return secret{}, dbus.MakeFailedError(err)
+	}
+	return secret{sessionPath, params, value, "text/plain"}, nil
+}
+
+// readSecret returns the value a client sent.
+func (s *Server) readSecret(sec secret) (string, *dbus.Error) {
+	sess, ok := s.sessions[sec.Session]
+	if !ok {
+		return "", errNoSession
+	}
+	value, err := sess.decrypt(sec.Parameters, sec.Value)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return string(value), nil
+}
+
+// searchPaths returns the paths of the items matching attrs.
+func (s *Server) searchPaths(attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	items, err := s.search(attrs)
+	if err != nil {
+		return nil, vaultError(err)
+	}
+	paths := []dbus.ObjectPath{}
+	for _, item := range items {
+		paths = append(paths, itemPath(item.Uuid))
+	}
+	return paths, nil
+}
+
+func (s *Server) emit(path dbus.ObjectPath, signal string, values ...interface{}) {
+	if s.conn != nil {
+		s.conn.Emit(path, signal, values...)
+	}
+}
+
+// serviceHandler implements org.freedesktop.Secret.Service.
+type serviceHandler struct{ s *Server }
+
+func (h serviceHandler) OpenSession(msg dbus.Message, sender dbus.Sender, algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return dbus.Variant{}, noPath, errUnknown
+	}
+	in, _ := input.Value().([]byte)
+	sess, out, err := newSession(algorithm, in)
+	if err != nil {
+		if algorithm == AlgorithmDH {
+			return dbus.Variant{}, noPath, newError("org.freedesktop.DBus.Error.InvalidArgs", "%s", err)
+		}
+		return dbus.Variant{}, noPath, errNotSupported("algorithm " + strconv.Quote(algorithm))
+	}
+	sess.owner = string(sender)
+
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	p := dbus.ObjectPath(sessionPrefix + strconv.Itoa(h.s.next))
+	h.s.next++
+	h.s.sessions[p] = sess
+	if out == nil {
+		return dbus.MakeVariant(""), p, nil
+	}
+	return dbus.MakeVariant(out), p, nil
+}
+
+func (h serviceHandler) CreateCollection(msg dbus.Message, props map[string]dbus.Variant, alias string) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return noPath, noPath, errUnknown
+	}
+	// Clients create the default collection if they don't find it, which
+	// is the vault
+	if alias == "default" {
+		return CollectionPath, noPath, nil
+	}
+	return noPath, noPath, errNotSupported("creating collections")
+}
+
+func (h serviceHandler) SearchItems(msg dbus.Message, attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return nil, nil, errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	unlocked, err := h.s.searchPaths(attrs)
+	return unlocked, []dbus.ObjectPath{}, err
+}
+
+// Unlock and Lock do nothing, since the vault is unlocked while served.
+func (h serviceHandler) Unlock(msg dbus.Message, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return nil, noPath, errUnknown
+	}
+	if objects == nil {
+		objects = []dbus.ObjectPath{}
+	}
+	return objects, noPath, nil
+}
+
+func (h serviceHandler) Lock(msg dbus.Message, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return nil, noPath, errUnknown
+	}
+	return []dbus.ObjectPath{}, noPath, nil
+}
+
+func (h serviceHandler) GetSecrets(msg dbus.Message, items []dbus.ObjectPath, sessionPath dbus.ObjectPath) (map[dbus.ObjectPath]secret, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return nil, errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if _, ok := h.s.sessions[sessionPath]; !ok {
+		return nil, errNoSession
+	}
+	secrets := make(map[dbus.ObjectPath]secret)
+	for _, p := range items {
+		kind, uuid := object(p)
+		if kind != objItem {
+			continue
+		}
+		sec, err := h.s.getSecret(uuid, sessionPath)
+		if err == errNoSuchObject {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		secrets[p] = sec
+	}
+	return secrets, nil
+}
+
+func (h serviceHandler) ReadAlias(msg dbus.Message, name string) (dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return noPath, errUnknown
+	}
+	if name == "default" {
+		return CollectionPath, nil
+	}
+	return noPath, nil
+}
+
+func (h serviceHandler) SetAlias(msg dbus.Message, name string, collection dbus.ObjectPath) *dbus.Error {
+	if kind, _ := object(msgPath(msg)); kind != objService {
+		return errUnknown
+	}
+	return errNotSupported("setting aliases")
+}
+
+// collectionHandler implements org.freedesktop.Secret.Collection.
+type collectionHandler struct{ s *Server }
+
+func (h collectionHandler) Delete(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objCollection {
+		return noPath, errUnknown
+	}
+	return noPath, errNotSupported("deleting the vault")
+}
+
+func (h collectionHandler) SearchItems(msg dbus.Message, attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objCollection {
+		return nil, errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return h.s.searchPaths(attrs)
+}
+
+func (h collectionHandler) CreateItem(msg dbus.Message, props map[string]dbus.Variant, sec secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objCollection {
+		return noPath, noPath, errUnknown
+	}
+	var label string
+	var attrs map[string]string
+	if v, ok := props[ifaceItem+".Label"]; ok {
+		label, _ = v.Value().(string)
+	}
+	if v, ok := props[ifaceItem+".Attributes"]; ok {
+		attrs, _ = v.Value().(map[string]string)
+	}
+
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	value, derr := h.s.readSecret(sec)
+	if derr != nil {
+		return noPath, noPath, derr
+	}
+	item, err := h.s.create(label, attrs, value, replace)
+	if err != nil {
+		return noPath, noPath, vaultError(err)
+	}
+	p := itemPath(item.Uuid)
+	h.s.emit(CollectionPath, ifaceCollection+".ItemCreated", p)
+	return p, noPath, nil
+}
+
+// itemHandler implements org.freedesktop.Secret.Item.
+type itemHandler struct{ s *Server }
+
+func (h itemHandler) Delete(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+	if kind, _ := object(msgPath(msg)); kind != objItem {
+		return noPath, errUnknown
+	}
+	return noPath, errNotSupported("deleting items")
+}
+
+func (h itemHandler) GetSecret(msg dbus.Message, sessionPath dbus.ObjectPath) (secret, *dbus.Error) {
+	kind, uuid := object(msgPath(msg))
+	if kind != objItem {
+		return secret{}, errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return h.s.getSecret(uuid, sessionPath)
+}
+
+func (h itemHandler) SetSecret(msg dbus.Message, sec secret) *dbus.Error {
+	kind, uuid := object(msgPath(msg))
+	if kind != objItem {
+		return errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	value, derr := h.s.readSecret(sec)
+	if derr != nil {
+		return derr
+	}
+	if err := h.s.setSecret(uuid, value); err != nil {
+		return vaultError(err)
+	}
+	h.s.emit(CollectionPath, ifaceCollection+".ItemChanged", itemPath(uuid))
+	return nil
+}
+
+// sessionHandler implements org.freedesktop.Secret.Session.
+type sessionHandler struct{ s *Server }
+
+func (h sessionHandler) Close(msg dbus.Message) *dbus.Error {
+	if kind, _ := object(msgPath(msg)); kind != objSession {
+		return errUnknown
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	delete(h.s.sessions, msgPath(msg))
+	return nil
+}
+
+// propertiesHandler implements org.freedesktop.DBus.Properties. All
+// properties are read-only.
+type propertiesHandler struct{ s *Server }
+
+// properties returns the properties of the object at p on iface.
+func (s *Server) properties(p dbus.ObjectPath, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	kind, uuid := object(p)
+	switch {
+	case kind == objService && iface == ifaceService:
+		return map[string]dbus.Variant{
+			"Collections": dbus.MakeVariant([]dbus.ObjectPath{CollectionPath}),
+		}, nil
+	case kind == objCollection && iface == ifaceCollection:
+		items, err := s.Vault.Items()
+		if err != nil {
+			return nil, vaultError(err)
+		}
+		paths := []dbus.ObjectPath{}
+		for _, item := range items {
+			paths = append(paths, itemPath(item.Uuid))
+		}
+		return map[string]dbus.Variant{
+			"Items":    dbus.MakeVariant(paths),
+			"Label":    dbus.MakeVariant(s.label()),
+			"Locked":   dbus.MakeVariant(false),
+			"Created":  dbus.MakeVariant(uint64(0)),
+			"Modified": dbus.MakeVariant(uint64(0)),
+		}, nil
+	case kind == objItem && iface == ifaceItem:
+		item, err := s.Vault.Item(uuid)
+		if err != nil {
+			return nil, vaultError(err)
+		}
+		return map[string]dbus.Variant{
+			"Locked":     dbus.MakeVariant(false),
+			"Attributes": dbus.MakeVariant(Attributes(item)),
+			"Label":      dbus.MakeVariant(item.Title),
+			"Created":    dbus.MakeVariant(uint64(item.Created.Unix())),
+			"Modified":   dbus.MakeVariant(uint64(item.Updated.Unix())),
+		}, nil
+	case kind == objSession && iface == ifaceSession:
+		return map[string]dbus.Variant{}, nil
+	}
+	return nil, newError("org.freedesktop.DBus.Error.UnknownInterface", "no interface %s on %s", iface, p)
+}
+
+func (h propertiesHandler) Get(msg dbus.Message, iface, name string) (dbus.Variant, *dbus.Error) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	props, err := h.s.properties(msgPath(msg), iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	v, ok := props[name]
+	if !ok {
+		return dbus.Variant{}, newError("org.freedesktop.DBus.Error.UnknownProperty", "no property %s on %s", name, iface)
+	}
+	return v, nil
+}
+
+func (h propertiesHandler) GetAll(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return h.s.properties(msgPath(msg), iface)
+}
+
+func (h propertiesHandler) Set(msg dbus.Message, iface, name string, value dbus.Variant) *dbus.Error {
+	return errReadOnly
+}
+
+// introspectHandler implements org.freedesktop.DBus.Introspectable.
+type introspectHandler struct{ s *Server }
+
+func (h introspectHandler) Introspect(msg dbus.Message) (string, *dbus.Error) {
+	var ifaces []string
+	var children []string
+	switch kind, _ := object(msgPath(msg)); kind {
+	case objService:
+		ifaces = []string{serviceXML}
+		children = []string{"collection", "aliases", "session"}
+	case objCollection:
+		ifaces = []string{collectionXML}
+		h.s.mu.Lock()
+		items, err := h.s.Vault.Items()
+		h.s.mu.Unlock()
+		if err != nil {
+			return "", vaultError(err)
+		}
+		for _, item := range items {
+			children = append(children, pathElement(item.Uuid))
+		}
+	case objItem:
+		ifaces = []string{itemXML}
+	case objSession:
+		ifaces = []string{sessionXML}
+	default:
+		switch msgPath(msg) {
+		case ServicePath + "/collection":
+			children = []string{"opvault"}
+		case ServicePath + "/aliases":
+			children = []string{"default"}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN" "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">` + "\n<node>\n")
+	if ifaces != nil {
+		ifaces = append(ifaces, propertiesXML, introspectableXML)
+	}
+	for _, x := range ifaces {
+		b.WriteString(x)
+	}
+	for _, c := range children {
+		fmt.Fprintf(&b, " <node name=%q/>\n", c)
+	}
+	b.WriteString("</node>\n")
+	return b.String(), nil
+}
+
+const serviceXML = ` <interface name="org.freedesktop.Secret.Service">
+  <method name="OpenSession"><arg name="algorithm" type="s" direction="in"/><arg name="input" type="v" direction="in"/><arg name="output" type="v" direction="out"/><arg name="result" type="o" direction="out"/></method>
+  <method name="CreateCollection"><arg name="properties" type="a{sv}" direction="in"/><arg name="alias" type="s" direction="in"/><arg name="collection" type="o" direction="out"/><arg name="prompt" type="o" direction="out"/></method>
+  <method name="SearchItems"><arg name="attributes" type="a{ss}" direction="in"/><arg name="unlocked" type="ao" direction="out"/><arg name="locked" type="ao" direction="out"/></method>
+  <method name="Unlock"><arg name="objects" type="ao" direction="in"/><arg name="unlocked" type="ao" direction="out"/><arg name="prompt" type="o" direction="out"/></method>
+  <method name="Lock"><arg name="objects" type="ao" direction="in"/><arg name="locked" type="ao" direction="out"/><arg name="Prompt" type="o" direction="out"/></method>
+  <method name="GetSecrets"><arg name="items" type="ao" direction="in"/><arg name="session" type="o" direction="in"/><arg name="secrets" type="a{o(oayays)}" direction="out"/></method>
+  <method name="ReadAlias"><arg name="name" type="s" direction="in"/><arg name="collection" type="o" direction="out"/></method>
+  <method name="SetAlias"><arg name="name" type="s" direction="in"/><arg name="collection" type="o" direction="in"/></method>
+  <property name="Collections" type="ao" access="read"/>
+ </interface>
+`
+
+const collectionXML = ` <interface name="org.freedesktop.Secret.Collection">
+  <method name="Delete"><arg name="prompt" type="o" direction="out"/></method>
+  <method name="SearchItems"><arg name="attributes" type="a{ss}" direction="in"/><arg name="results" type="ao" direction="out"/></method>
+  <method name="CreateItem"><arg name="properties" type="a{sv}" direction="in"/><arg name="secret" type="(oayays)" direction="in"/><arg name="replace" type="b" direction="in"/><arg name="item" type="o" direction="out"/><arg name="prompt" type="o" direction="out"/></method>
+  <signal name="ItemCreated"><arg name="item" type="o"/></signal>
+  <signal name="ItemDeleted"><arg name="item" type="o"/></signal>
+  <signal name="ItemChanged"><arg name="item" type="o"/></signal>
+  <property name="Items" type="ao" access="read"/>
+  <property name="Label" type="s" access="read"/>
+  <property name="Locked" type="b" access="read"/>
+  <property name="Created" type="t" access="read"/>
+  <property name="Modified" type="t" access="read"/>
+ </interface>
+`
+
+const itemXML = ` <interface name="org.freedesktop.Secret.Item">
+  <method name="Delete"><arg name="Prompt" type="o" direction="out"/></method>
+  <method name="GetSecret"><arg name="session" type="o" direction="in"/><arg name="secret" type="(oayays)" direction="out"/></method>
+  <method name="SetSecret"><arg name="secret" type="(oayays)" direction="in"/></method>
+  <property name="Locked" type="b" access="read"/>
+  <property name="Attributes" type="a{ss}" access="read"/>
+  <property name="Label" type="s" access="read"/>
+  <property name="Created" type="t" access="read"/>
+  <property name="Modified" type="t" access="read"/>
+ </interface>
+`
+
+const sessionXML = ` <interface name="org.freedesktop.Secret.Session">
+  <method name="Close"/>
+ </interface>
+`
+
+const propertiesXML = ` <interface name="org.freedesktop.DBus.Properties">
+  <method name="Get"><arg name="interface" type="s" direction="in"/><arg name="property" type="s" direction="in"/><arg name="value" type="v" direction="out"/></method>
+  <method name="GetAll"><arg name="interface" type="s" direction="in"/><arg name="properties" type="a{sv}" direction="out"/></method>
+  <method name="Set"><arg name="interface" type="s" direction="in"/><arg name="property" type="s" direction="in"/><arg name="value" type="v" direction="in"/></method>
+ </interface>
+`
+
+const introspectableXML = ` <interface name="org.freedesktop.DBus.Introspectable">
+  <method name="Introspect"><arg name="data" type="s" direction="out"/></method>
+ </interface>
+`
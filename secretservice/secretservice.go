@@ -0,0 +1,217 @@
+// Package secretservice serves a vault as the freedesktop.org Secret
+// Service, the D-Bus API through which Linux desktop applications such as
+// NetworkManager, browsers, and mail clients keep their passwords, in
+// place of GNOME Keyring or KWallet.
+//
+// The vault appears as a single collection, which is also the "default"
+// alias, and is always unlocked. Every item in it can be found by the
+// attributes "uuid", "title", and "category", and by "username", "url",
+// and "server", the URL's host, where it has them. Items applications
+// create are saved in the vault as Password items, keeping the attributes
+// they were created with in a section titled AttributesSection. Secrets
+// are items' passwords, or their notes if they have none. Items can't be
+// deleted, and collections can't be created.
+package secretservice
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/mpage/onepassword"
+)
+
+// AttributesSection is the title of the section holding the attributes of
+// items created through the service.
+const AttributesSection = "Secret Service"
+
+// A Source is the vault served; *onepassword.Vault is one.
+type Source interface {
+	Items() ([]onepassword.Item, error)
+	Item(uuid string) (*onepassword.Item, error)
+	SaveItem(item *onepassword.Item) error
+}
+
+// A Server serves Vault on the buses it's exported to. Vaults aren't safe
+// for concurrent use, so calls are answered one at a time.
+type Server struct {
+	Vault Source
+	Label string // The collection's label; "opvault" if empty
+
+	mu       sync.Mutex
+	conn     *dbus.Conn
+	sessions map[dbus.ObjectPath]*session
+	next     int // Number of the next session
+}
+
+// Attributes returns the attributes item can be found by.
+func Attributes(item *onepassword.Item) map[string]string {
+	attrs := map[string]string{
+		"uuid":     item.Uuid,
+		"title":    item.Title,
+		"category": item.Category.Name,
+	}
+	if username := item.Username(); username != "" {
+		attrs["username"] = username
+	}
+	if item.Url != "" {
+		attrs["url"] = item.Url
+		if u, err := url.Parse(item.Url); err == nil && u.Hostname() != "" {
+			attrs["server"] = u.Hostname()
+		}
+	}
+	for k, v := range storedAttributes(item) {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+// storedAttributes returns the attributes an item was created with through
+// the service, or nil if it wasn't.
+func storedAttributes(item *onepassword.Item) map[string]string {
+	var attrs map[string]string
+	for _, f := range item.Fields() {
+		if f.Section != AttributesSection {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		name := f.Name
+		if name == "" {
+			name = f.Id
+		}
+		attrs[name] = f.Value
+	}
+	return attrs
+}
+
+// Secret returns the secret the service gives for item.
+func Secret(item *onepassword.Item) string {
+	if password := item.Password(); password != "" {
+		return password
+	}
+	return item.Notes()
+}
+
+// matches reports whether attrs include every attribute of query.
+func matches(attrs, query map[string]string) bool {
+	for k, v := range query {
+		if attrs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// search returns the items matching query, ordered by uuid.
+func (s *Server) search(query map[string]string) ([]onepassword.Item, error) {
+	items, err := s.Vault.Items()
+	if err != nil {
+		return nil, err
+	}
+	var found []onepassword.Item
+	for i := range items {
+		if matches(Attributes(&items[i]), query) {
+			found = append(found, items[i])
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Uuid < found[j].Uuid })
+	return found, nil
+}
+
+// create saves a new item with the supplied label, attributes, and secret,
+// or with replace, updates the item created with the same attributes, if
+// there is one.
+func (s *Server) create(label string, attrs map[string]string, secret string, replace bool) (*onepassword.Item, error) {
+	var item *onepassword.Item
+	if replace {
+		items, err := s.Vault.Items()
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			if stored := storedAttributes(&items[i]); stored != nil && len(stored) == len(attrs) && matches(stored, attrs) {
+				item = &items[i]
+				break
+			}
+		}
+	}
+	if item == nil {
+		item = onepassword.NewItemFromTemplate(onepassword.CatPassword)
+	}
+	if label != "" {
+		item.Title = label
+	}
+
+	fields := []onepassword.FieldValue{{Id: "password", Name: "password", Kind: onepassword.KindConcealed, Value: secret, Concealed: true}}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, onepassword.FieldValue{Section: AttributesSection, Id: k, Name: k, Kind: onepassword.KindString, Value: attrs[k]})
+	}
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.Vault.SaveItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// setSecret replaces the password of the item with uuid.
+func (s *Server) setSecret(uuid, secret string) error {
+	item, err := s.Vault.Item(uuid)
+	if err != nil {
+		return err
+	}
+	if err = item.SetPassword(secret, time.Now()); err != nil {
+		return err
+	}
+	return s.Vault.SaveItem(item)
+}
+
+func (s *Server) label() string {
+	if s.Label == "" {
+		return "opvault"
+	}
+	return s.Label
+}
+
+// pathElement encodes uuid as an element of an object path, which may only
+// hold ASCII letters, digits, and underscores.
+func pathElement(uuid string) string {
+	var b strings.Builder
+	for _, c := range []byte(uuid) {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// uuidFromElement reverses pathElement.
+func uuidFromElement(elem string) string {
+	var b strings.Builder
+	for i := 0; i < len(elem); i++ {
+		if elem[i] == '_' && i+3 <= len(elem) {
+			if c, err := strconv.ParseUint(elem[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(elem[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,304 @@
+package secretservice
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/mpage/onepassword"
+)
+
+// fakeVault holds items in memory.
+type fakeVault struct {
+	items []onepassword.Item
+}
+
+func (v *fakeVault) Items() ([]onepassword.Item, error) {
+	return append([]onepassword.Item(nil), v.items...), nil
+}
+
+func (v *fakeVault) Item(uuid string) (*onepassword.Item, error) {
+	for _, item := range v.items {
+		if item.Uuid == uuid {
+			return &item, nil
+		}
+	}
+	return nil, onepassword.ErrItemNotFound
+}
+
+func (v *fakeVault) SaveItem(item *onepassword.Item) error {
+	if item.Uuid == "" {
+		item.Uuid = onepassword.NewUUID()
+	}
+	for i := range v.items {
+		if v.items[i].Uuid == item.Uuid {
+			v.items[i] = *item
+			return nil
+		}
+	}
+	v.items = append(v.items, *item)
+	return nil
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title, item.Url = "A1", "Mail", "https://mail.example.com/login"
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return &fakeVault{[]onepassword.Item{*item}}
+}
+
+func TestSessionDH(t *testing.T) {
+	priv, pub, err := dhKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, out, err := newSession(AlgorithmDH, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := dhKey(priv, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &session{key: key}
+
+	for _, value := range []string{"", "hunter2", "exactly sixteen!"} {
+		params, data, err := server.encrypt([]byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(value)) && value != "" {
+			t.Errorf("%q sent in the clear", value)
+		}
+		got, err := client.decrypt(params, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != value {
+			t.Errorf("decrypted %q, want %q", got, value)
+		}
+	}
+
+	if _, _, err = newSession(AlgorithmDH, []byte{1}); err == nil {
+		t.Error("accepted a public key of 1")
+	}
+	if _, _, err = newSession("rot13", nil); err == nil {
+		t.Error("accepted an unknown algorithm")
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	v := newFakeVault(t)
+	s := &Server{Vault: v}
+
+	want := map[string]string{
+		"uuid":     "A1",
+		"title":    "Mail",
+		"category": "Login",
+		"username": "wendy",
+		"url":      "https://mail.example.com/login",
+		"server":   "mail.example.com",
+	}
+	got := Attributes(&v.items[0])
+	for k, val := range want {
+		if got[k] != val {
+			t.Errorf("attribute %s = %q, want %q", k, got[k], val)
+		}
+	}
+
+	for _, c := range []struct {
+		query map[string]string
+		n     int
+	}{
+		{map[string]string{}, 1},
+		{map[string]string{"server": "mail.example.com", "username": "wendy"}, 1},
+		{map[string]string{"server": "mail.example.com", "username": "fred"}, 0},
+		{map[string]string{"xdg:schema": "org.gnome.keyring.NetworkPassword"}, 0},
+	} {
+		items, err := s.search(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != c.n {
+			t.Errorf("search %v found %d items, want %d", c.query, len(items), c.n)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	v := newFakeVault(t)
+	s := &Server{Vault: v}
+
+	attrs := map[string]string{"xdg:schema": "org.freedesktop.NetworkManager.Connection", "setting-name": "802-11-wireless-security"}
+	item, err := s.create("Home Wi-Fi", attrs, "letmein", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "Home Wi-Fi" || Secret(item) != "letmein" {
+		t.Errorf("created %q with secret %q", item.Title, Secret(item))
+	}
+	found, err := s.search(map[string]string{"setting-name": "802-11-wireless-security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Uuid != item.Uuid {
+		t.Fatalf("search found %v, want the created item", found)
+	}
+
+	// Replacing updates the item with the same attributes
+	again, err := s.create("Home Wi-Fi", attrs, "opensesame", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Uuid != item.Uuid || len(v.items) != 2 {
+		t.Errorf("replace created a new item")
+	}
+	if err = s.setSecret(item.Uuid, "swordfish"); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := v.Item(item.Uuid)
+	if Secret(saved) != "swordfish" {
+		t.Errorf("secret is %q after setting it", Secret(saved))
+	}
+}
+
+func TestPathElement(t *testing.T) {
+	for _, uuid := range []string{"86CCFDAE57E479E874B2696D2103E8C8", "a-b_c.d"} {
+		elem := pathElement(uuid)
+		if !dbus.ObjectPath("/" + elem).IsValid() {
+			t.Errorf("%q encodes to invalid %q", uuid, elem)
+		}
+		if got := uuidFromElement(elem); got != uuid {
+			t.Errorf("%q round trips to %q", uuid, got)
+		}
+	}
+}
+
+// TestBus serves the vault on a private bus and uses it as clients do.
+func TestBus(t *testing.T) {
+	daemon := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := daemon.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = daemon.Start(); err != nil {
+		t.Skipf("can't start a bus: %s", err)
+	}
+	defer daemon.Wait()
+	defer daemon.Process.Kill()
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr = strings.TrimSpace(addr)
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	v := newFakeVault(t)
+	if err = (&Server{Vault: v}).Export(conn); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(BusName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("requesting name: %v %v", reply, err)
+	}
+
+	client, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	service := client.Object(BusName, ServicePath)
+
+	var out dbus.Variant
+	var sessionPath dbus.ObjectPath
+	if err = service.Call(ifaceService+".OpenSession", 0, AlgorithmPlain, dbus.MakeVariant("")).Store(&out, &sessionPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var unlocked, locked []dbus.ObjectPath
+	err = service.Call(ifaceService+".SearchItems", 0, map[string]string{"server": "mail.example.com"}).Store(&unlocked, &locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unlocked) != 1 || len(locked) != 0 {
+		t.Fatalf("SearchItems returned %v, %v", unlocked, locked)
+	}
+
+	var sec secret
+	if err = client.Object(BusName, unlocked[0]).Call(ifaceItem+".GetSecret", 0, sessionPath).Store(&sec); err != nil {
+		t.Fatal(err)
+	}
+	if string(sec.Value) != "hunter2" {
+		t.Errorf("GetSecret returned %q", sec.Value)
+	}
+	label, err := client.Object(BusName, unlocked[0]).GetProperty(ifaceItem + ".Label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label.Value() != "Mail" {
+		t.Errorf("Label is %v", label.Value())
+	}
+
+	// Store a secret through the default alias, over an encrypted session
+	priv, pub, err := dhKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = service.Call(ifaceService+".OpenSession", 0, AlgorithmDH, dbus.MakeVariant(pub)).Store(&out, &sessionPath); err != nil {
+		t.Fatal(err)
+	}
+	serverPub, _ := out.Value().([]byte)
+	key, err := dhKey(priv, serverPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &session{key: key}
+	params, data, err := sess.encrypt([]byte("letmein"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alias, itemPath, prompt dbus.ObjectPath
+	if err = service.Call(ifaceService+".ReadAlias", 0, "default").Store(&alias); err != nil {
+		t.Fatal(err)
+	}
+	props := map[string]dbus.Variant{
+		ifaceItem + ".Label":      dbus.MakeVariant("Home Wi-Fi"),
+		ifaceItem + ".Attributes": dbus.MakeVariant(map[string]string{"ssid": "home"}),
+	}
+	err = client.Object(BusName, alias).Call(ifaceCollection+".CreateItem", 0, props, secret{sessionPath, params, data, "text/plain"}, true).Store(&itemPath, &prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := make(map[dbus.ObjectPath]secret)
+	if err = service.Call(ifaceService+".GetSecrets", 0, []dbus.ObjectPath{itemPath}, sessionPath).Store(&secrets); err != nil {
+		t.Fatal(err)
+	}
+	sec = secrets[itemPath]
+	value, err := sess.decrypt(sec.Parameters, sec.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "letmein" {
+		t.Errorf("stored secret reads back as %q", value)
+	}
+	if len(v.items) != 2 {
+		t.Errorf("vault has %d items after CreateItem, want 2", len(v.items))
+	}
+
+	err = client.Object(BusName, itemPath).Call(ifaceItem+".GetSecret", 0, dbus.ObjectPath(sessionPrefix+"99")).Err
+	if e, ok := err.(dbus.Error); !ok || e.Name != errNoSession.Name {
+		t.Errorf("GetSecret with no session returned %v", err)
+	}
+}
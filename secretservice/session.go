@@ -0,0 +1,132 @@
+package secretservice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The algorithms a session may transfer secrets with.
+const (
+	AlgorithmPlain = "plain"
+	AlgorithmDH    = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+)
+
+// dhPrime is the 1024-bit MODP group of RFC 2409, which the specification
+// requires, with generator 2.
+var dhPrime, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+var errBadSecret = errors.New("malformed secret")
+
+// A session carries secrets between the service and one client, in the
+// clear or encrypted with a key agreed by Diffie-Hellman.
+type session struct {
+	key   []byte // AES-128 key; nil for plain sessions
+	owner string // The client's unique bus name
+}
+
+// newSession starts a session with algorithm, given the client's input,
+// and returns the output for the client: for AlgorithmDH, the public keys.
+func newSession(algorithm string, input []byte) (*session, []byte, error) {
+	switch algorithm {
+	case AlgorithmPlain:
+		return &session{}, nil, nil
+	case AlgorithmDH:
+		priv, pub, err := dhKeyPair()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := dhKey(priv, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &session{key: key}, pub, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
+
+// dhKeyPair returns a private exponent and its public key, padded to the
+// prime's length.
+func dhKeyPair() (*big.Int, []byte, error) {
+	b := make([]byte, 128)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, nil, err
+	}
+	priv := new(big.Int).SetBytes(b)
+	pub := new(big.Int).Exp(big.NewInt(2), priv, dhPrime)
+	return priv, pad(pub.Bytes(), 128), nil
+}
+
+// dhKey derives the AES key from the shared secret with the peer's public
+// key, as HKDF-SHA256 of the secret without salt or info.
+func dhKey(priv *big.Int, peer []byte) ([]byte, error) {
+	y := new(big.Int).SetBytes(peer)
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(dhPrime, big.NewInt(1))) >= 0 {
+		return nil, errors.New("invalid public key")
+	}
+	shared := pad(new(big.Int).Exp(y, priv, dhPrime).Bytes(), 128)
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, nil), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func pad(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b
+	}
+	return append(make([]byte, n-len(b)), b...)
+}
+
+// encrypt returns the parameters and value to send value as.
+func (s *session) encrypt(value []byte) (params, data []byte, err error) {
+	if s.key == nil {
+		return []byte{}, value, nil
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, err
+	}
+	n := aes.BlockSize - len(value)%aes.BlockSize
+	data = append(append([]byte(nil), value...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return iv, data, nil
+}
+
+// decrypt returns the value sent with params and data.
+func (s *session) decrypt(params, data []byte) ([]byte, error) {
+	if s.key == nil {
+		return data, nil
+	}
+	if len(params) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errBadSecret
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, params).CryptBlocks(value, data)
+	n := int(value[len(value)-1])
+	if n == 0 || n > aes.BlockSize || !bytes.Equal(value[len(value)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errBadSecret
+	}
+	return value[:len(value)-n], nil
+}
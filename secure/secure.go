@@ -0,0 +1,80 @@
+// Package secure pools buffers for plaintext, such as decrypted item
+// details and attachments, that are zeroed as they're released, so that
+// servers decide how long secrets stay in memory and decrypt many of them
+// without leaving each for the garbage collector.
+package secure
+
+import "sync"
+
+// Buffers are pooled in size classes of powers of two from minClass to
+// maxClass bytes. Larger buffers are zeroed when released but not pooled.
+const (
+	minClass = 10 // 1 KiB
+	maxClass = 24 // 16 MiB
+)
+
+var pools [maxClass - minClass + 1]sync.Pool
+
+// A Buffer holds plaintext until Release is called. It isn't safe for
+// concurrent use.
+type Buffer struct {
+	buf  []byte // The whole buffer, zeroed on release
+	data []byte // The contents, part of buf
+}
+
+// Get returns a buffer holding n zero bytes, taken from the pool if one
+// large enough is free.
+func Get(n int) *Buffer {
+	class := minClass
+	for class <= maxClass && 1<<class < n {
+		class++
+	}
+	if class > maxClass {
+		buf := make([]byte, n)
+		return &Buffer{buf, buf}
+	}
+	p, ok := pools[class-minClass].Get().(*[]byte)
+	if !ok {
+		buf := make([]byte, 1<<class)
+		p = &buf
+	}
+	return &Buffer{*p, (*p)[:n]}
+}
+
+// Bytes returns the contents of the buffer, which are only valid until
+// Release is called. Their capacity may extend past their length, to the
+// end of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Len returns the length of the contents.
+func (b *Buffer) Len() int {
+	return len(b.data)
+}
+
+// Slice narrows the contents to Bytes()[i:j], as after decrypting into
+// the buffer leaves padding around the plaintext.
+func (b *Buffer) Slice(i, j int) {
+	b.data = b.data[i:j]
+}
+
+// Release zeroes the whole buffer and returns it to the pool. The buffer
+// and its contents mustn't be used afterwards; releasing it again does
+// nothing.
+func (b *Buffer) Release() {
+	if b.buf == nil {
+		return
+	}
+	buf := b.buf[:cap(b.buf)]
+	for i := range buf {
+		buf[i] = 0
+	}
+	b.buf, b.data = nil, nil
+	for class := minClass; class <= maxClass; class++ {
+		if len(buf) == 1<<class {
+			pools[class-minClass].Put(&buf)
+			return
+		}
+	}
+}
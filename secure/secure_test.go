@@ -0,0 +1,38 @@
+package secure
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	b := Get(100)
+	if b.Len() != 100 || !bytes.Equal(b.Bytes(), make([]byte, 100)) {
+		t.Fatalf("Expected 100 zero bytes. Got %x.", b.Bytes())
+	}
+	if cap(b.Bytes()) != 1<<minClass {
+		t.Errorf("Expected a buffer of the smallest class. Got %d.", cap(b.Bytes()))
+	}
+	copy(b.Bytes(), "padding secret")
+	b.Slice(8, 14)
+	if string(b.Bytes()) != "secret" {
+		t.Errorf("Expected the narrowed contents. Got %q.", b.Bytes())
+	}
+
+	whole := b.buf
+	b.Release()
+	if !bytes.Equal(whole, make([]byte, len(whole))) {
+		t.Errorf("Expected the buffer zeroed. Got %q.", whole)
+	}
+	if b.Bytes() != nil {
+		t.Errorf("Expected no contents after release")
+	}
+	b.Release()
+
+	// Buffers beyond the largest class are zeroed but not pooled
+	large := Get(1<<maxClass + 1)
+	if large.Len() != 1<<maxClass+1 {
+		t.Errorf("Expected %d bytes. Got %d.", 1<<maxClass+1, large.Len())
+	}
+	large.Release()
+}
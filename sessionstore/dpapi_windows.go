@@ -0,0 +1,72 @@
+package sessionstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapi keeps data in files under %LOCALAPPDATA%, encrypted with
+// CryptProtectData so that only the current user on this machine can
+// decrypt them.
+type dpapi struct {
+	dir string
+}
+
+func platformStore(service string) (Store, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return dpapi{filepath.Join(base, service, "session")}, nil
+}
+
+func blob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// take copies out and frees the memory DPAPI allocated for it.
+func take(out *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...)
+}
+
+func (d dpapi) Save(name string, data []byte) error {
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(blob(data), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return err
+	}
+	enc := take(&out)
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.dir, name), enc, 0600)
+}
+
+func (d dpapi) Load(name string) ([]byte, error) {
+	enc, err := ioutil.ReadFile(filepath.Join(d.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(blob(enc), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return take(&out), nil
+}
+
+func (d dpapi) Delete(name string) error {
+	err := os.Remove(filepath.Join(d.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
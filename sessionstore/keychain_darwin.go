@@ -0,0 +1,42 @@
+package sessionstore
+
+import (
+	"encoding/base64"
+
+	"github.com/mpage/onepassword/credentials"
+)
+
+// keychain keeps data as generic passwords in the login Keychain, encoded
+// as base64 as security(1) handles text.
+type keychain struct {
+	service string
+}
+
+func platformStore(service string) (Store, error) {
+	return keychain{service}, nil
+}
+
+func (k keychain) entry(name string) credentials.Keychain {
+	return credentials.Keychain{Service: k.service + " session", Account: name}
+}
+
+func (k keychain) Save(name string, data []byte) error {
+	return k.entry(name).Store(base64.StdEncoding.EncodeToString(data))
+}
+
+func (k keychain) Load(name string) ([]byte, error) {
+	s, err := k.entry(name).Password("")
+	if err == credentials.ErrUnavailable {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func (k keychain) Delete(name string) error {
+	if _, err := k.Load(name); err == ErrNotFound {
+		return nil
+	}
+	return k.entry(name).Delete()
+}
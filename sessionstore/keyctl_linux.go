@@ -0,0 +1,54 @@
+package sessionstore
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// keyring keeps data as "user" keys in the user keyring, which outlives
+// any one process but not the user's last login session.
+type keyring struct {
+	service string
+}
+
+func platformStore(service string) (Store, error) {
+	return keyring{service}, nil
+}
+
+func (k keyring) description(name string) string {
+	return k.service + ":" + name
+}
+
+func (k keyring) Save(name string, data []byte) error {
+	_, err := unix.AddKey("user", k.description(name), data, unix.KEY_SPEC_USER_KEYRING)
+	return err
+}
+
+func (k keyring) Load(name string) ([]byte, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", k.description(name), 0)
+	if err == unix.ENOKEY {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	// Reading with a nil buffer returns the key's size
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if n, err = unix.KeyctlBuffer(unix.KEYCTL_READ, id, data, 0); err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (k keyring) Delete(name string) error {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", k.description(name), 0)
+	if err == unix.ENOKEY {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+	return err
+}
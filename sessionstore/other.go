@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !windows
+
+package sessionstore
+
+func platformStore(service string) (Store, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,35 @@
+// Package sessionstore keeps session state, such as the keys the agent
+// holds, across restarts of the process holding it, protected by the
+// operating system rather than written to disk in the clear:
+//
+//	Linux    the user's kernel keyring (keyctl), which is cleared at logout
+//	macOS    the login Keychain
+//	Windows  files encrypted with DPAPI for the current user
+//
+// Default returns the platform's Store.
+package sessionstore
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by Load when nothing is saved under a name.
+	ErrNotFound = errors.New("no saved session")
+	// ErrUnsupported is returned by Default on platforms without a store.
+	ErrUnsupported = errors.New("no session store on this platform")
+)
+
+// A Store saves small blobs under names, readable only by the current user.
+type Store interface {
+	// Save stores data under name, replacing anything saved before.
+	Save(name string, data []byte) error
+	// Load returns the data saved under name, or ErrNotFound.
+	Load(name string) ([]byte, error)
+	// Delete removes the data saved under name, if there is any.
+	Delete(name string) error
+}
+
+// Default returns the platform's store, keeping data under service, such
+// as "opvault", to tell it apart from other programs'.
+func Default(service string) (Store, error) {
+	return platformStore(service)
+}
@@ -0,0 +1,44 @@
+package sessionstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	s, err := Default("opvault-test")
+	if err == ErrUnsupported {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("test-%d", os.Getpid())
+	data := []byte{0, 1, 2, 0xff}
+	if err = s.Save(name, data); err != nil {
+		// Containers and CI machines often have no keyring or keychain
+		t.Skipf("Can't save: %s", err)
+	}
+	defer s.Delete(name)
+
+	if got, err := s.Load(name); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected %x. Got %x, %v.", data, got, err)
+	}
+	data = []byte("replaced")
+	if err = s.Save(name, data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Load(name); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected %x. Got %x, %v.", data, got, err)
+	}
+	if err = s.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Load(name); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound after deleting. Got %v.", err)
+	}
+	if err = s.Delete(name); err != nil {
+		t.Fatalf("Expected deleting twice to succeed. Got %v.", err)
+	}
+}
@@ -0,0 +1,66 @@
+package onepassword
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// sidecarPath returns the path of a file managed by this package that is
+// stored alongside the vault, such as saved searches. Sidecars belong to a
+// profile and are never read by 1Password itself.
+func (v *Vault) sidecarPath(name string) string {
+	return sidecarFile(v.dbPath, v.profile, name)
+}
+
+func sidecarFile(dbPath, profile, name string) string {
+	if u, _, ok := remoteURL(dbPath); ok {
+		base := remoteSidecarBase(u)
+		os.MkdirAll(filepath.Dir(base), 0700)
+		return base + "." + profile + "." + name
+	}
+	return filepath.Clean(dbPath) + "." + profile + "." + name
+}
+
+// readSidecar returns the decrypted contents of a sidecar, or nil if it
+// doesn't exist yet. Sidecars are encrypted with the overview keys.
+func (v *Vault) readSidecar(name string) ([]byte, error) {
+	opdata, err := ioutil.ReadFile(v.sidecarPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptOPData01(opdata, v.overviewKP)
+}
+
+// writeSidecar encrypts data and replaces the contents of a sidecar.
+func (v *Vault) writeSidecar(name string, data []byte) error {
+	opdata, err := crypto.EncryptOPData01(data, v.overviewKP)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(v.sidecarPath(name), opdata)
+}
+
+// writeFileAtomic replaces the contents of a file. The data is written to a
+// temporary name first so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,218 @@
+package onepassword
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// snapshotAttempts is how many times an OPVault directory is copied before
+// Snapshot gives up on finding it unchanged for long enough.
+const snapshotAttempts = 3
+
+// Snapshot copies the vault to dst, which mustn't exist, as it was at one
+// moment, so backups never hold a band half rewritten or an item missing
+// from one band and not yet added to another. An OPVault directory is
+// copied whole while holding the lock SaveItem takes, and copied again if
+// its files changed meanwhile, as when 1Password, which doesn't take the
+// lock, saved an item. A SQLite database is copied within a read
+// transaction.
+//
+// The copy is made under a temporary name beside dst and renamed once
+// complete, so dst never holds a partial copy.
+func (v *Vault) Snapshot(dst string) error {
+	ss, ok := v.store.(snapshotStore)
+	if !ok {
+		return errors.New("this vault can't be snapshotted")
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return &fs.PathError{Op: "snapshot", Path: dst, Err: fs.ErrExist}
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	name := filepath.Join(tmp, filepath.Base(dst))
+	if err = ss.snapshot(name); err != nil {
+		return err
+	}
+	return os.Rename(name, dst)
+}
+
+// A fileState is what's compared to tell whether a file changed while it
+// was copied.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot copies the OPVault directory to dst, a new directory.
+func (s *opvaultStore) snapshot(dst string) error {
+	if s.lock != nil {
+		unlock, err := s.lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	for attempt := 1; ; attempt++ {
+		before, err := s.fileStates()
+		if err != nil {
+			return err
+		}
+		if err = s.copyTo(dst); err != nil {
+			return err
+		}
+		after, err := s.fileStates()
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(before, after) {
+			return nil
+		}
+		if attempt == snapshotAttempts {
+			return fmt.Errorf("vault changed each of the %d times it was copied", attempt)
+		}
+		if err = os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *opvaultStore) fileStates() (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		states[name] = fileState{fi.Size(), fi.ModTime()}
+		return nil
+	})
+	return states, err
+}
+
+func (s *opvaultStore) copyTo(dst string) error {
+	return fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(dst, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(p, 0700)
+		}
+		data, err := fs.ReadFile(s.fsys, name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(p, data, 0600)
+	})
+}
+
+// snapshotLayout is the time layout RotateSnapshots expects at the start
+// of the names of snapshots.
+const snapshotLayout = "20060102T150405Z"
+
+// SnapshotName returns a name for a snapshot taken at t, the time in UTC
+// followed by ext, e.g. "20261015T092500Z.opvault". Snapshots named this
+// way sort by age and are recognised by RotateSnapshots.
+func SnapshotName(t time.Time, ext string) string {
+	return t.UTC().Format(snapshotLayout) + ext
+}
+
+// A RotationPolicy chooses which snapshots to keep, as backup tools do:
+// the newest snapshot of each of the last Daily days that have one, and
+// likewise for the last Weekly ISO weeks and Monthly months. The newest
+// snapshot is always kept.
+type RotationPolicy struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// keep reports which of the supplied times, newest first, the policy
+// keeps.
+func (p RotationPolicy) keep(times []time.Time) []bool {
+	kept := make([]bool, len(times))
+	if len(times) > 0 {
+		kept[0] = true
+	}
+	periods := []struct {
+		n   int
+		key func(t time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, period := range periods {
+		last := ""
+		n := 0
+		for i, t := range times {
+			if n == period.n {
+				break
+			}
+			if key := period.key(t); key != last {
+				kept[i] = true
+				last = key
+				n++
+			}
+		}
+	}
+	return kept
+}
+
+// RotateSnapshots removes the snapshots in dir, named as by SnapshotName,
+// that the policy doesn't keep, and returns their names. Other files in
+// dir are left alone.
+func RotateSnapshots(dir string, p RotationPolicy) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type snapshot struct {
+		name string
+		time time.Time
+	}
+	var snapshots []snapshot
+	for _, fi := range entries {
+		if len(fi.Name()) < len(snapshotLayout) {
+			continue
+		}
+		t, err := time.Parse(snapshotLayout, fi.Name()[:len(snapshotLayout)])
+		if err == nil {
+			snapshots = append(snapshots, snapshot{fi.Name(), t})
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].time.After(snapshots[j].time) })
+
+	times := make([]time.Time, len(snapshots))
+	for i, s := range snapshots {
+		times[i] = s.time
+	}
+	var removed []string
+	for i, keep := range p.keep(times) {
+		if keep {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(dir, snapshots[i].name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snapshots[i].name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,91 @@
+package onepassword
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	writeFixture(t, f, filepath.Join(dir, "v.opvault"))
+	v, err := NewVault(testPassword, VaultConfig{DBPath: filepath.Join(dir, "v.opvault"), Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer v.Close()
+
+	dst := filepath.Join(dir, "backups", SnapshotName(time.Now(), ".opvault"))
+	if err = os.Mkdir(filepath.Dir(dst), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Snapshot(dst); err != nil {
+		t.Fatalf("Failed taking snapshot: %s", err)
+	}
+	if err = v.Snapshot(dst); !os.IsExist(err) {
+		t.Errorf("Expected an existing snapshot not to be replaced. Got %v.", err)
+	}
+	// Nothing but the snapshot is left behind
+	if entries, _ := ioutil.ReadDir(filepath.Dir(dst)); len(entries) != 1 {
+		t.Errorf("Expected only the snapshot. Got %v.", entries)
+	}
+
+	copied, err := NewVault(testPassword, VaultConfig{DBPath: dst, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening snapshot: %s", err)
+	}
+	defer copied.Close()
+	if item, err := copied.Item("A1"); err != nil || item.Title != "GitHub" {
+		t.Errorf("Expected the item in the snapshot. Got %+v, %v.", item, err)
+	}
+}
+
+func TestRotateSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	var names []string
+	// Two snapshots a day for six weeks
+	for h := 0; h < 42*24; h += 12 {
+		name := SnapshotName(now.Add(-time.Duration(h)*time.Hour), ".opvault")
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RotateSnapshots(dir, RotationPolicy{Daily: 3, Weekly: 2})
+	if err != nil {
+		t.Fatalf("Failed rotating: %s", err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+	// The newest of each of the last three days, and of the week before
+	// the current one, which began on Monday the 5th
+	want := []string{
+		"20261011T210000Z.opvault",
+		"20261013T210000Z.opvault",
+		"20261014T210000Z.opvault",
+		"20261015T090000Z.opvault",
+		"notes.txt",
+	}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("Kept %v, want %v", kept, want)
+	}
+	if len(removed) != len(names)-4 {
+		t.Errorf("Removed %d snapshots, want %d", len(removed), len(names)-4)
+	}
+}
@@ -0,0 +1,136 @@
+package onepassword
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Comparator orders items. It returns a negative number if a sorts before
+// b, a positive number if it sorts after, and zero if they are equivalent.
+type Comparator func(a, b *Item) int
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var (
+	// ByTitle orders items alphabetically by title, ignoring case.
+	ByTitle Comparator = func(a, b *Item) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	}
+
+	// ByCreated orders items from oldest to newest.
+	ByCreated Comparator = func(a, b *Item) int {
+		return compareInts(a.Created.UnixNano(), b.Created.UnixNano())
+	}
+
+	// ByUpdated orders items from least to most recently modified.
+	ByUpdated Comparator = func(a, b *Item) int {
+		return compareInts(a.Updated.UnixNano(), b.Updated.UnixNano())
+	}
+
+	// ByCategory orders items by category name.
+	ByCategory Comparator = func(a, b *Item) int {
+		return strings.Compare(a.Category.Name, b.Category.Name)
+	}
+
+	// ByFavorite orders favorites first, in the order the user arranged
+	// them, followed by everything else.
+	ByFavorite Comparator = func(a, b *Item) int {
+		switch {
+		case a.FaveIndex == b.FaveIndex:
+			return 0
+		case a.FaveIndex == 0:
+			return 1
+		case b.FaveIndex == 0:
+			return -1
+		}
+		return compareInts(int64(a.FaveIndex), int64(b.FaveIndex))
+	}
+
+	// ByStrength orders items from weakest to strongest password.
+	ByStrength Comparator = func(a, b *Item) int {
+		return compareInts(int64(a.Strength), int64(b.Strength))
+	}
+)
+
+var comparators = map[string]Comparator{
+	"title":    ByTitle,
+	"created":  ByCreated,
+	"updated":  ByUpdated,
+	"category": ByCategory,
+	"favorite": ByFavorite,
+	"strength": ByStrength,
+}
+
+// Reverse returns a comparator producing the opposite order of c.
+func Reverse(c Comparator) Comparator {
+	return func(a, b *Item) int {
+		return c(b, a)
+	}
+}
+
+// ParseSortOrder parses a comma separated list of sort keys such as
+// "favorite,-updated". Keys are title, created, updated, category, favorite,
+// and strength; a leading "-" reverses the key.
+func ParseSortOrder(spec string) ([]Comparator, error) {
+	var order []Comparator
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		reverse := strings.HasPrefix(key, "-")
+		c, ok := comparators[strings.TrimPrefix(key, "-")]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q", key)
+		}
+		if reverse {
+			c = Reverse(c)
+		}
+		order = append(order, c)
+	}
+	return order, nil
+}
+
+// SortItems sorts items by the supplied comparators in turn. Items that
+// compare equal under all of them are ordered by uuid, so listings are
+// deterministic across runs.
+func SortItems(items []Item, order ...Comparator) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := &items[i], &items[j]
+		for _, c := range order {
+			if r := c(a, b); r != 0 {
+				return r < 0
+			}
+		}
+		return a.Uuid < b.Uuid
+	})
+}
+
+// List returns the items matching pred sorted by the supplied comparators.
+// Without comparators items are sorted by title.
+func (v *Vault) List(pred ItemPredicate, order ...Comparator) ([]Item, error) {
+	return v.ListContext(context.Background(), pred, order...)
+}
+
+// ListContext is List, stopping with ctx's error once ctx is done.
+func (v *Vault) ListContext(ctx context.Context, pred ItemPredicate, order ...Comparator) ([]Item, error) {
+	items, err := v.LookupItemsContext(ctx, pred)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) == 0 {
+		order = []Comparator{ByTitle}
+	}
+	SortItems(items, order...)
+	return items, nil
+}
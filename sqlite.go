@@ -0,0 +1,248 @@
+//go:build !js
+
+package onepassword
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mpage/onepassword/crypto"
+)
+
+// itemColumns are the columns of the items table read by scanRecord.
+const itemColumns = "id, uuid, category_uuid, created_at, updated_at, fave_index, key_data, overview_data"
+
+// sqliteStore reads a profile from the SQLite database used by 1Password 6.
+type sqliteStore struct {
+	db        *sql.DB
+	profileId int
+	prof      profileRecord
+}
+
+func openSQLiteStore(path, profile string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lookup profile
+	s := &sqliteStore{db: db}
+	err = transact(db, func(tx *sql.Tx) error {
+		row := tx.QueryRow(
+			"SELECT id, iterations, master_key_data, overview_key_data, salt"+
+				" FROM profiles"+
+				" WHERE profile_name = ?",
+			profile)
+		p := &s.prof
+		e := row.Scan(&s.profileId, &p.Iterations, &p.MasterKey, &p.OverviewKey, &p.Salt)
+		if e == sql.ErrNoRows {
+			e = &ProfileError{profile, path, errors.New("no such profile")}
+		}
+		return e
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *sqliteStore) profile() (*profileRecord, error) {
+	return &s.prof, nil
+}
+
+func (s *sqliteStore) categories() (map[string]string, error) {
+	cats := make(map[string]string)
+	err := transact(s.db, func(tx *sql.Tx) (e error) {
+		rows, e := tx.Query(
+			"SELECT uuid, singular_name"+
+				" FROM categories"+
+				" WHERE profile_id = ?",
+			s.profileId)
+		if e != nil {
+			return
+		}
+		defer rows.Close()
+
+		// Fill in cats
+		for rows.Next() {
+			var uuid, name string
+			e = rows.Scan(&uuid, &name)
+			if e != nil {
+				return
+			}
+
+			cats[uuid] = name
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		cats = nil
+	}
+
+	return cats, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecord reads an item selected using itemColumns.
+func scanRecord(row rowScanner) (*record, error) {
+	var r record
+	var faveIndex sql.NullInt64
+	err := row.Scan(&r.id, &r.Uuid, &r.Category, &r.Created, &r.Updated, &faveIndex, &r.Key, &r.Overview)
+	if err != nil {
+		return nil, err
+	}
+	r.FaveIndex = int(faveIndex.Int64)
+	return &r, nil
+}
+
+func (s *sqliteStore) records() ([]*record, error) {
+	return s.query(0)
+}
+
+func (s *sqliteStore) trashed() ([]*record, error) {
+	return s.query(1)
+}
+
+// query returns the items with the supplied value of the trashed column.
+func (s *sqliteStore) query(trashed int) ([]*record, error) {
+	var recs []*record
+
+	err := transact(s.db, func(tx *sql.Tx) (e error) {
+		rows, e := tx.Query(
+			"SELECT "+itemColumns+
+				" FROM items"+
+				" WHERE profile_id = ? AND trashed = ?",
+			s.profileId, trashed)
+		if e != nil {
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r *record
+			if r, e = scanRecord(rows); e != nil {
+				return
+			}
+			recs = append(recs, r)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		recs = nil
+	}
+
+	return recs, err
+}
+
+func (s *sqliteStore) record(uuid string) (*record, error) {
+	var r *record
+
+	err := transact(s.db, func(tx *sql.Tx) (e error) {
+		row := tx.QueryRow(
+			"SELECT "+itemColumns+
+				" FROM items"+
+				" WHERE profile_id = ? AND uuid = ? AND trashed = 0",
+			s.profileId, uuid)
+		r, e = scanRecord(row)
+		if e == sql.ErrNoRows {
+			e = ErrItemNotFound
+		}
+		return
+	})
+
+	return r, err
+}
+
+func (s *sqliteStore) details(r *record) error {
+	return transact(s.db, func(tx *sql.Tx) error {
+		row := tx.QueryRow(
+			"SELECT data FROM item_details"+
+				" WHERE item_id = ?", r.id)
+		return row.Scan(&r.Details)
+	})
+}
+
+func (s *sqliteStore) put(r *record, overviewKP *crypto.KeyPair) error {
+	return transact(s.db, func(tx *sql.Tx) error {
+		var id int64
+		row := tx.QueryRow(
+			"SELECT id FROM items"+
+				" WHERE profile_id = ? AND uuid = ?",
+			s.profileId, r.Uuid)
+		switch e := row.Scan(&id); e {
+		case nil:
+			_, e = tx.Exec(
+				"UPDATE items"+
+					" SET category_uuid = ?, created_at = ?, updated_at = ?, fave_index = ?, key_data = ?, overview_data = ?"+
+					" WHERE id = ?",
+				r.Category, r.Created, r.Updated, r.FaveIndex, r.Key, r.Overview, id)
+			if e != nil {
+				return e
+			}
+			_, e = tx.Exec("UPDATE item_details SET data = ? WHERE item_id = ?", r.Details, id)
+			return e
+		case sql.ErrNoRows:
+			res, e := tx.Exec(
+				"INSERT INTO items"+
+					" (profile_id, uuid, category_uuid, created_at, updated_at, fave_index, key_data, overview_data, trashed)"+
+					" VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0)",
+				s.profileId, r.Uuid, r.Category, r.Created, r.Updated, r.FaveIndex, r.Key, r.Overview)
+			if e != nil {
+				return e
+			}
+			if id, e = res.LastInsertId(); e != nil {
+				return e
+			}
+			_, e = tx.Exec("INSERT INTO item_details (item_id, data) VALUES (?, ?)", id, r.Details)
+			return e
+		default:
+			return e
+		}
+	})
+}
+
+func (s *sqliteStore) trash(uuid string, at int64, overviewKP *crypto.KeyPair) error {
+	return transact(s.db, func(tx *sql.Tx) error {
+		_, e := tx.Exec(
+			"UPDATE items SET trashed = 1, updated_at = ?"+
+				" WHERE profile_id = ? AND uuid = ?",
+			at, s.profileId, uuid)
+		return e
+	})
+}
+
+// Attachments aren't read from SQLite databases.
+func (s *sqliteStore) attachments(uuid string) ([]*attachmentRecord, error) {
+	return nil, nil
+}
+
+func (s *sqliteStore) attachmentData(a *attachmentRecord) ([]byte, func(), error) {
+	return nil, nil, fmt.Errorf("attachment %s not found", a.Uuid)
+}
+
+func (s *sqliteStore) attachmentReader(a *attachmentRecord) (io.ReaderAt, int64, func(), error) {
+	return nil, 0, nil, fmt.Errorf("attachment %s not found", a.Uuid)
+}
+
+// snapshot copies the database to dst within a read transaction, so
+// writers finishing meanwhile aren't seen.
+func (s *sqliteStore) snapshot(dst string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", dst)
+	return err
+}
+
+func (s *sqliteStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,9 @@
+package onepassword
+
+import "errors"
+
+// SQLite databases are read with cgo, which js/wasm lacks; read OPVault
+// directories with NewVaultFS instead.
+func openSQLiteStore(path, profile string) (store, error) {
+	return nil, errors.New("SQLite databases can't be read under js/wasm")
+}
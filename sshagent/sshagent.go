@@ -0,0 +1,149 @@
+// Package sshagent serves SSH keys kept in vault items through the SSH agent
+// protocol, so private keys never need to be written to ~/.ssh.
+package sshagent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mpage/onepassword"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrDenied is returned to clients when the user declines a signature.
+var ErrDenied = errors.New("sshagent: use of key denied")
+
+// errReadOnly is returned for requests that would change the keyring. Keys
+// are managed by editing the vault instead.
+var errReadOnly = errors.New("sshagent: keys are read from the vault and can't be changed")
+
+// A Key is a private key found in an item.
+type Key struct {
+	Uuid   string // Of the item holding the key
+	Title  string
+	Signer ssh.Signer
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key, as ssh-keygen -l
+// shows it.
+func (k *Key) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.Signer.PublicKey())
+}
+
+// isPrivateKey reports whether a field value looks like a PEM or OpenSSH
+// private key.
+func isPrivateKey(value string) bool {
+	return strings.Contains(value, "-----BEGIN") && strings.Contains(value, "PRIVATE KEY-----")
+}
+
+// Keys returns the private keys held in the fields of SSH Key, Server, and
+// any other items. Keys that can't be used, such as those protected by a
+// passphrase, are reported in the returned errors rather than stopping the
+// search.
+func Keys(items []onepassword.Item) ([]*Key, []error) {
+	var keys []*Key
+	var errs []error
+	for i := range items {
+		item := &items[i]
+		if item.Category.Uuid == onepassword.CatTombstone.Uuid {
+			continue
+		}
+		for _, f := range item.Fields() {
+			if !isPrivateKey(f.Value) {
+				continue
+			}
+			signer, err := ssh.ParsePrivateKey([]byte(f.Value))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", item.Title, err))
+				continue
+			}
+			keys = append(keys, &Key{item.Uuid, item.Title, signer})
+		}
+	}
+	return keys, errs
+}
+
+// A Keyring is an agent.ExtendedAgent serving a fixed set of keys. If
+// Confirm is set, it's asked before each signature and the request is
+// refused unless it returns true.
+type Keyring struct {
+	Confirm func(k *Key) bool
+
+	mu   sync.Mutex // Serializes confirmations
+	keys []*Key
+}
+
+var _ agent.ExtendedAgent = (*Keyring)(nil)
+
+func NewKeyring(keys []*Key, confirm func(k *Key) bool) *Keyring {
+	return &Keyring{Confirm: confirm, keys: keys}
+}
+
+func (r *Keyring) List() ([]*agent.Key, error) {
+	var list []*agent.Key
+	for _, k := range r.keys {
+		pub := k.Signer.PublicKey()
+		list = append(list, &agent.Key{Format: pub.Type(), Blob: pub.Marshal(), Comment: k.Title})
+	}
+	return list, nil
+}
+
+func (r *Keyring) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return r.SignWithFlags(key, data, 0)
+}
+
+func (r *Keyring) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	var k *Key
+	for _, candidate := range r.keys {
+		if bytes.Equal(candidate.Signer.PublicKey().Marshal(), key.Marshal()) {
+			k = candidate
+			break
+		}
+	}
+	if k == nil {
+		return nil, errors.New("sshagent: no such key")
+	}
+
+	if r.Confirm != nil {
+		r.mu.Lock()
+		ok := r.Confirm(k)
+		r.mu.Unlock()
+		if !ok {
+			return nil, ErrDenied
+		}
+	}
+
+	// RSA keys sign with SHA-2 when the client asks
+	if alg, ok := k.Signer.(ssh.AlgorithmSigner); ok && key.Type() == ssh.KeyAlgoRSA {
+		switch {
+		case flags&agent.SignatureFlagRsaSha256 != 0:
+			return alg.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA256)
+		case flags&agent.SignatureFlagRsaSha512 != 0:
+			return alg.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+		}
+	}
+	return k.Signer.Sign(rand.Reader, data)
+}
+
+func (r *Keyring) Signers() ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	for _, k := range r.keys {
+		signers = append(signers, k.Signer)
+	}
+	return signers, nil
+}
+
+func (r *Keyring) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+func (r *Keyring) Add(key agent.AddedKey) error   { return errReadOnly }
+func (r *Keyring) Remove(key ssh.PublicKey) error { return errReadOnly }
+func (r *Keyring) RemoveAll() error               { return errReadOnly }
+func (r *Keyring) Lock(passphrase []byte) error   { return errReadOnly }
+func (r *Keyring) Unlock(passphrase []byte) error { return errReadOnly }
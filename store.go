@@ -0,0 +1,124 @@
+package onepassword
+
+import (
+	"context"
+	"io"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// A record is an item as kept by a storage backend. Only the key, overview,
+// and details are encrypted.
+type record struct {
+	Uuid      string
+	Category  string
+	Created   int64
+	Updated   int64
+	Tx        int64 // Sync transaction of the last change; 0 if not recorded
+	FaveIndex int
+	Folder    string // Uuid of the folder holding the item; empty if none
+	Key       []byte // Item keys, encrypted with the master keys
+	Overview  []byte // opdata01, encrypted with the overview keys
+	Details   []byte // opdata01, encrypted with the item keys. Nil until loaded.
+
+	id int // Backend specific
+}
+
+// A profileRecord holds what's needed to derive a profile's keys.
+type profileRecord struct {
+	Salt        []byte
+	Iterations  int
+	MasterKey   []byte // opdata01, encrypted with the derived keys
+	OverviewKey []byte // opdata01, encrypted with the derived keys
+}
+
+// An attachmentRecord is an attachment as kept by a storage backend.
+type attachmentRecord struct {
+	Uuid     string
+	ItemUuid string
+	Size     int64
+	Created  int64
+	Updated  int64
+	Overview []byte // opdata01, encrypted with the overview keys
+
+	path string // Backend specific
+}
+
+// A store reads items from one of the formats 1Password keeps vaults in.
+// Stores don't decrypt anything; that's left to the Vault.
+type store interface {
+	profile() (*profileRecord, error)
+
+	// categories returns the names of categories, keyed by uuid, for
+	// formats that store them.
+	categories() (map[string]string, error)
+
+	// records returns every item that isn't in the trash, without details.
+	records() ([]*record, error)
+
+	// trashed returns every item in the trash, without details.
+	trashed() ([]*record, error)
+
+	// record returns the item with the supplied uuid, without details, or
+	// ErrItemNotFound if there is none or it's in the trash.
+	record(uuid string) (*record, error)
+
+	// details fills in the details of a record.
+	details(r *record) error
+
+	// attachments returns the attachments of the item with the supplied uuid.
+	attachments(uuid string) ([]*attachmentRecord, error)
+
+	// attachmentData returns the encrypted contents of an attachment,
+	// which may be mapped from its file and are only valid until release
+	// is called.
+	attachmentData(a *attachmentRecord) (data []byte, release func(), err error)
+
+	// attachmentReader returns a reader of the encrypted contents of an
+	// attachment, and their size. done must be called once they're read.
+	attachmentReader(a *attachmentRecord) (r io.ReaderAt, size int64, done func(), err error)
+
+	close() error
+}
+
+// A writableStore can save items. The overview keys are passed for formats
+// that authenticate item attributes.
+type writableStore interface {
+	// put creates or replaces the item with the record's uuid. The record
+	// must include its details.
+	put(r *record, overviewKP *crypto.KeyPair) error
+}
+
+// A lockingStore keeps other programs from writing it while an item is
+// read and rewritten.
+type lockingStore interface {
+	// lockItem keeps other programs from writing the store until unlock
+	// is called, and reads the item with the supplied uuid again so that
+	// it's as they last wrote it. Writes made before unlocking don't take
+	// the lock again.
+	lockItem(uuid string) (unlock func(), err error)
+}
+
+// A trashStore can move items to the trash.
+type trashStore interface {
+	// trash moves the item with the supplied uuid to the trash, recording
+	// the change at the supplied time.
+	trash(uuid string, at int64, overviewKP *crypto.KeyPair) error
+}
+
+// A snapshotStore can copy itself to a path as it was at one moment.
+type snapshotStore interface {
+	snapshot(dst string) error
+}
+
+// A preloadStore can read its items ahead of their first use, as while
+// the keys that decrypt them are derived, stopping if ctx is done.
+type preloadStore interface {
+	preload(ctx context.Context) error
+}
+
+// A damagedStore loads what it can of damaged files, and lists what it
+// couldn't.
+type damagedStore interface {
+	bandErrors() ([]*BandParseError, error)
+}
@@ -0,0 +1,160 @@
+// Package systemdcreds hands vault secrets to systemd services as
+// credentials, which services read from files in $CREDENTIALS_DIRECTORY
+// rather than from their environment. Secrets can be written as files for
+// LoadCredential= or, encrypted with systemd-creds, for
+// LoadCredentialEncrypted=:
+//
+//	[Service]
+//	ExecStartPre=+opvault -password-file /etc/opvault/password systemd-creds write db=opvault:///Database/password
+//	LoadCredential=db
+//
+// A LoadCredential= without a path looks in the credential stores,
+// /run/credstore and, for encrypted credentials, /run/credstore.encrypted.
+// systemd reads credentials before running ExecStartPre=, so files written
+// there are only seen on the next start; to have them on the first, write
+// them from a unit ordered before the service. Alternatively, Serve answers
+// LoadCredential= itself from a socket, resolving each credential as the
+// service starts:
+//
+//	LoadCredential=db:/run/opvault/creds.sock
+package systemdcreds
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The credential stores systemd searches, which Write writes to by default.
+const (
+	StoreDir          = "/run/credstore"
+	EncryptedStoreDir = "/run/credstore.encrypted"
+)
+
+// A Credential is a credential's id and the secret reference its value is
+// resolved from.
+type Credential struct {
+	Id  string
+	Ref string
+}
+
+// ParseCredential parses "id=ref".
+func ParseCredential(s string) (Credential, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq < 0 {
+		return Credential{}, fmt.Errorf("credential %q isn't id=reference", s)
+	}
+	c := Credential{s[:eq], s[eq+1:]}
+	if !ValidId(c.Id) {
+		return Credential{}, fmt.Errorf("invalid credential id %q", c.Id)
+	}
+	return c, nil
+}
+
+// ValidId reports whether id is usable as a credential's name, which
+// systemd requires to be a valid file name.
+func ValidId(id string) bool {
+	return id != "" && id != "." && id != ".." && len(id) <= 255 && !strings.ContainsAny(id, "/\x00")
+}
+
+// Write writes value to the file id in dir, readable only by its owner. If
+// encrypt is set, the file is encrypted with systemd-creds for
+// LoadCredentialEncrypted=, and so is bound to this machine.
+func Write(dir, id, value string, encrypt bool) error {
+	if !ValidId(id) {
+		return fmt.Errorf("invalid credential id %q", id)
+	}
+	data := []byte(value)
+	if encrypt {
+		var err error
+		if data, err = Encrypt(id, data); err != nil {
+			return err
+		}
+	}
+
+	// Write a temporary file and rename it, so services never read part of
+	// a credential
+	f, err := ioutil.TempFile(dir, "."+id)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(0400)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, id))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Encrypt encrypts a credential with "systemd-creds encrypt", which uses
+// the machine's TPM if it has one and the host key otherwise.
+func Encrypt(id string, data []byte) ([]byte, error) {
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("systemd-creds", "encrypt", "--name="+id, "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("systemd-creds: %s", msg)
+		}
+		return nil, fmt.Errorf("systemd-creds: %s", err)
+	}
+	return out.Bytes(), nil
+}
+
+// PeerCredential returns the unit and credential id that systemd encodes
+// in the address it connects from when loading a credential from a
+// socket: an abstract address of the form "<random>/unit/<unit>/<id>".
+func PeerCredential(addr net.Addr) (unit, id string, ok bool) {
+	ua, isUnix := addr.(*net.UnixAddr)
+	if !isUnix {
+		return "", "", false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(ua.Name, "@"), "\x00")
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[1] != "unit" || parts[2] == "" || !ValidId(parts[3]) {
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+// Serve answers connections from systemd on ln until it's closed, writing
+// each the credential resolve returns for the unit and id systemd asks
+// for. Connections whose credential can't be resolved are closed without
+// a value, and the error is passed to logf.
+func Serve(ln net.Listener, resolve func(unit, id string) (string, error), logf func(format string, args ...interface{})) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			unit, id, ok := PeerCredential(conn.RemoteAddr())
+			if !ok {
+				logf("connection from %s isn't systemd loading a credential", conn.RemoteAddr())
+				return
+			}
+			value, err := resolve(unit, id)
+			if err != nil {
+				logf("%s: credential %s: %s", unit, id, err)
+				return
+			}
+			if _, err = conn.Write([]byte(value)); err != nil {
+				logf("%s: credential %s: %s", unit, id, err)
+			}
+		}(conn)
+	}
+}
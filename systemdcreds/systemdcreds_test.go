@@ -0,0 +1,93 @@
+package systemdcreds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseCredential(t *testing.T) {
+	c, err := ParseCredential("db=opvault:///Database/password")
+	if err != nil || c.Id != "db" || c.Ref != "opvault:///Database/password" {
+		t.Fatalf("Unexpected credential: %+v, %v", c, err)
+	}
+	for _, s := range []string{"db", "=ref", "../db=ref", "a/b=ref"} {
+		if _, err := ParseCredential(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemdcreds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = Write(dir, "db", "hunter2", false); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	// Replacing a credential must work though the file is read-only
+	if err = Write(dir, "db", "hunter3", false); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	path := filepath.Join(dir, "db")
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "hunter3" {
+		t.Fatalf("Unexpected credential %q, %v", data, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0400 {
+		t.Fatalf("Unexpected mode: %v, %v", fi.Mode(), err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, ".*")); len(names) != 0 {
+		t.Fatalf("Temporary files left: %v", names)
+	}
+}
+
+func TestServe(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd connects from abstract socket addresses, which only Linux has")
+	}
+	dir, err := ioutil.TempDir("", "systemdcreds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "creds.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go Serve(ln, func(unit, id string) (string, error) {
+		if unit == "web.service" && id == "db" {
+			return "hunter2", nil
+		}
+		return "", fmt.Errorf("unknown credential")
+	}, t.Logf)
+
+	load := func(id string) string {
+		// As systemd does, bind to an abstract address naming the credential
+		local := &net.UnixAddr{Name: fmt.Sprintf("@%x/unit/web.service/%s", os.Getpid(), id), Net: "unix"}
+		conn, err := net.DialUnix("unix", local, &net.UnixAddr{Name: sock, Net: "unix"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		data, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if v := load("db"); v != "hunter2" {
+		t.Fatalf("Expected the credential. Got %q.", v)
+	}
+	if v := load("other"); v != "" {
+		t.Fatalf("Expected nothing for an unknown credential. Got %q.", v)
+	}
+}
@@ -0,0 +1,274 @@
+package onepassword
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A tagExpr is a compiled tag expression. Evaluating it against an item
+// index yields the sorted positions of matching items.
+type tagExpr interface {
+	eval(idx *itemIndex) []int
+}
+
+type tagLeaf string
+type tagNot struct{ x tagExpr }
+type tagAnd struct{ l, r tagExpr }
+type tagOr struct{ l, r tagExpr }
+
+func (t tagLeaf) eval(idx *itemIndex) []int {
+	return idx.tags[string(t)]
+}
+
+func (t tagNot) eval(idx *itemIndex) []int {
+	matched := t.x.eval(idx)
+	out := make([]int, 0, len(idx.items)-len(matched))
+	for i, j := 0, 0; i < len(idx.items); i++ {
+		if j < len(matched) && matched[j] == i {
+			j++
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+func (t tagAnd) eval(idx *itemIndex) []int {
+	l, r := t.l.eval(idx), t.r.eval(idx)
+	var out []int
+	for i, j := 0, 0; i < len(l) && j < len(r); {
+		switch {
+		case l[i] < r[j]:
+			i++
+		case l[i] > r[j]:
+			j++
+		default:
+			out = append(out, l[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func (t tagOr) eval(idx *itemIndex) []int {
+	l, r := t.l.eval(idx), t.r.eval(idx)
+	out := make([]int, 0, len(l)+len(r))
+	i, j := 0, 0
+	for i < len(l) && j < len(r) {
+		switch {
+		case l[i] < r[j]:
+			out = append(out, l[i])
+			i++
+		case l[i] > r[j]:
+			out = append(out, r[j])
+			j++
+		default:
+			out = append(out, l[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, l[i:]...)
+	return append(out, r[j:]...)
+}
+
+// buildTagIndex maps each normalized tag, and every ancestor of it in the
+// tag hierarchy, to the sorted positions of the items carrying it.
+func buildTagIndex(items []Item) map[string][]int {
+	tags := make(map[string][]int)
+	for pos := range items {
+		seen := make(map[string]bool)
+		for _, t := range items[pos].Tags {
+			parts := strings.Split(NormalizeTag(t), TagSeparator)
+			for n := 1; n <= len(parts); n++ {
+				prefix := strings.Join(parts[:n], TagSeparator)
+				if prefix != "" && !seen[prefix] {
+					seen[prefix] = true
+					tags[prefix] = append(tags[prefix], pos)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// ItemsByTags returns the items whose tags satisfy a boolean expression such
+// as "work AND NOT archived" or "(home OR family) AND finance". NOT binds
+// tighter than AND, which binds tighter than OR; adjacent tags without an
+// operator are ANDed. Operators are case insensitive, tags containing spaces
+// may be double quoted, and a tag also matches everything nested beneath it.
+//
+// Tags are looked up in an index built alongside the search index, so
+// queries cost time proportional to the items matched rather than a scan of
+// the vault.
+func (v *Vault) ItemsByTags(expr string) ([]Item, error) {
+	x, err := parseTagExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := v.searchIndex(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	positions := x.eval(idx)
+	items := make([]Item, len(positions))
+	for i, pos := range positions {
+		items[i] = idx.items[pos]
+	}
+	if err = v.ensureDetails(context.Background(), items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// parseTagExpr compiles a tag expression using recursive descent.
+func parseTagExpr(expr string) (tagExpr, error) {
+	toks, err := lexTagExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("tags: empty expression")
+	}
+
+	p := &tagParser{toks: toks}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("tags: unexpected %q", p.toks[p.pos].text)
+	}
+	return x, nil
+}
+
+type tagToken struct {
+	text string
+	op   bool // An operator or parenthesis rather than a tag
+}
+
+func lexTagExpr(expr string) ([]tagToken, error) {
+	var toks []tagToken
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			toks = append(toks, tagToken{string(r), true})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			if end == len(rs) {
+				return nil, fmt.Errorf("tags: unterminated quote in %q", expr)
+			}
+			toks = append(toks, tagToken{string(rs[i+1 : end]), false})
+			i = end + 1
+		default:
+			end := i
+			for end < len(rs) && !unicode.IsSpace(rs[end]) && !strings.ContainsRune(`()"`, rs[end]) {
+				end++
+			}
+			word := string(rs[i:end])
+			switch strings.ToUpper(word) {
+			case "AND", "OR", "NOT":
+				toks = append(toks, tagToken{strings.ToUpper(word), true})
+			default:
+				toks = append(toks, tagToken{word, false})
+			}
+			i = end
+		}
+	}
+	return toks, nil
+}
+
+type tagParser struct {
+	toks []tagToken
+	pos  int
+}
+
+func (p *tagParser) accept(op string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos].op && p.toks[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tagParser) or() (tagExpr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = tagOr{l, r}
+	}
+	return l, nil
+}
+
+func (p *tagParser) and() (tagExpr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if !p.accept("AND") {
+			// Adjacent operands are implicitly ANDed
+			if p.pos >= len(p.toks) || (p.toks[p.pos].op && p.toks[p.pos].text != "(" && p.toks[p.pos].text != "NOT") {
+				return l, nil
+			}
+		}
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = tagAnd{l, r}
+	}
+}
+
+func (p *tagParser) not() (tagExpr, error) {
+	if p.accept("NOT") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{x}, nil
+	}
+	return p.operand()
+}
+
+func (p *tagParser) operand() (tagExpr, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("tags: unexpected end of expression")
+	}
+	if p.accept("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("tags: missing ')'")
+		}
+		return x, nil
+	}
+
+	tok := p.toks[p.pos]
+	if tok.op {
+		return nil, fmt.Errorf("tags: unexpected %q", tok.text)
+	}
+	p.pos++
+	return tagLeaf(NormalizeTag(tok.text)), nil
+}
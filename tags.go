@@ -0,0 +1,146 @@
+package onepassword
+
+import (
+	"sort"
+	"strings"
+)
+
+// TagSeparator separates the components of hierarchical tags such as
+// "work/aws/prod".
+const TagSeparator = "/"
+
+// NormalizeTag returns the canonical form of a tag: components are trimmed of
+// surrounding whitespace and case folded, and empty components are dropped.
+// "  Work / AWS//prod " normalizes to "work/aws/prod".
+func NormalizeTag(tag string) string {
+	var parts []string
+	for _, p := range strings.Split(tag, TagSeparator) {
+		p = strings.ToLower(strings.Join(strings.Fields(p), " "))
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, TagSeparator)
+}
+
+// tagHasPrefix returns true if the normalized tag equals prefix or is one of
+// its descendants.
+func tagHasPrefix(tag, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	return tag == prefix || strings.HasPrefix(tag, prefix+TagSeparator)
+}
+
+// HasTag returns true if the item is tagged with tag or, when tag names an
+// interior node of the hierarchy, with any of its descendants.
+func (i *Item) HasTag(tag string) bool {
+	prefix := NormalizeTag(tag)
+	for _, t := range i.Tags {
+		if tagHasPrefix(NormalizeTag(t), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TagPrefix returns a predicate matching items carrying prefix or any tag
+// nested beneath it.
+func TagPrefix(prefix string) ItemPredicate {
+	return func(i *Item) bool {
+		return i.HasTag(prefix)
+	}
+}
+
+// A TagNode is a node in the tag hierarchy.
+type TagNode struct {
+	Name     string     // Last component of the path
+	Path     string     // Normalized path from the root
+	Count    int        // Number of items tagged with Path or a descendant
+	Children []*TagNode // Ordered by name
+}
+
+// Child returns the direct child of n with the supplied name, or nil.
+func (n *TagNode) Child(name string) *TagNode {
+	name = NormalizeTag(name)
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Find returns the node at path, or nil if no item uses it.
+func (n *TagNode) Find(path string) *TagNode {
+	node := n
+	for _, p := range strings.Split(NormalizeTag(path), TagSeparator) {
+		if p == "" {
+			continue
+		}
+		if node = node.Child(p); node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// BuildTagTree builds the tag hierarchy for the supplied items. The returned
+// root has an empty name and path; its count is the number of tagged items.
+func BuildTagTree(items []Item) *TagNode {
+	root := &TagNode{}
+	for _, item := range items {
+		// An item is counted once per node, even if several of its tags
+		// share the node.
+		seen := make(map[*TagNode]bool)
+		for _, tag := range item.Tags {
+			tag = NormalizeTag(tag)
+			if tag == "" {
+				continue
+			}
+
+			node := root
+			seen[node] = true
+			for _, p := range strings.Split(tag, TagSeparator) {
+				child := node.Child(p)
+				if child == nil {
+					child = &TagNode{Name: p, Path: joinTag(node.Path, p)}
+					node.Children = append(node.Children, child)
+				}
+				node = child
+				seen[node] = true
+			}
+		}
+		for node := range seen {
+			node.Count++
+		}
+	}
+	sortTagNodes(root)
+	return root
+}
+
+func joinTag(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + TagSeparator + name
+}
+
+func sortTagNodes(n *TagNode) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		sortTagNodes(c)
+	}
+}
+
+// TagTree returns the hierarchy of tags used by items in the vault. Tags
+// are in the overviews, so no details are decrypted.
+func (v *Vault) TagTree() (*TagNode, error) {
+	items, err := v.Overviews()
+	if err != nil {
+		return nil, err
+	}
+	return BuildTagTree(items), nil
+}
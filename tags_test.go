@@ -0,0 +1,109 @@
+package onepassword
+
+import "testing"
+
+func TestNormalizeTag(t *testing.T) {
+	cases := map[string]string{
+		"Work":                "work",
+		"  Work / AWS//prod ": "work/aws/prod",
+		"home  lab/Pi":        "home lab/pi",
+		"/":                   "",
+	}
+	for in, expected := range cases {
+		if got := NormalizeTag(in); got != expected {
+			t.Fatalf("NormalizeTag(%q): expected %q. Got %q.", in, expected, got)
+		}
+	}
+}
+
+func TestHasTagMatchesDescendants(t *testing.T) {
+	item := Item{Tags: []string{"Work/AWS/prod"}}
+	for _, tag := range []string{"work", "work/aws", "WORK/aws/Prod"} {
+		if !item.HasTag(tag) {
+			t.Fatalf("Expected item to match %q", tag)
+		}
+	}
+	for _, tag := range []string{"work/aw", "aws", "work/aws/prod/eu"} {
+		if item.HasTag(tag) {
+			t.Fatalf("Expected item not to match %q", tag)
+		}
+	}
+}
+
+func TestBuildTagTree(t *testing.T) {
+	items := []Item{
+		{Tags: []string{"work/aws/prod", "work/aws/staging"}},
+		{Tags: []string{"Work/GCP"}},
+		{Tags: []string{"personal"}},
+		{},
+	}
+	root := BuildTagTree(items)
+	if root.Count != 3 {
+		t.Fatalf("Expected 3 tagged items. Got %d.", root.Count)
+	}
+	if work := root.Find("work"); work == nil || work.Count != 2 || len(work.Children) != 2 {
+		t.Fatalf("Unexpected work node: %+v", work)
+	}
+	if aws := root.Find("work/aws"); aws == nil || aws.Count != 1 {
+		t.Fatalf("Unexpected aws node: %+v", aws)
+	}
+	if root.Children[0].Name != "personal" {
+		t.Fatalf("Children not sorted: %+v", root.Children)
+	}
+}
+
+func TestVaultTagTree(t *testing.T) {
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub","tags":["work/dev"]}`, loginDetails, false)
+	// Tags are read from overviews alone
+	f.band["A1"].Details[40] ^= 1
+	f.writeBand("A")
+	v := f.open()
+	defer v.Close()
+
+	root, err := v.TagTree()
+	if err != nil {
+		t.Fatalf("Failed building the tag tree: %s", err)
+	}
+	if dev := root.Find("work/dev"); dev == nil || dev.Count != 1 {
+		t.Fatalf("Unexpected dev node: %+v", dev)
+	}
+}
+
+func TestTagExpressions(t *testing.T) {
+	idx := newItemIndex([]Item{
+		{Title: "a", Tags: []string{"work/aws", "archived"}},
+		{Title: "b", Tags: []string{"Work"}},
+		{Title: "c", Tags: []string{"home lab"}},
+		{Title: "d"},
+	})
+	cases := map[string]string{
+		"work":                         "ab",
+		"work AND NOT archived":        "b",
+		"work and not archived":        "b",
+		"work archived":                "a",
+		"NOT work":                     "cd",
+		`"Home Lab" OR work/aws`:       "ac",
+		"(work OR \"home lab\") NOT b": "abc",
+		"NOT (work OR archived)":       "cd",
+	}
+	for expr, expected := range cases {
+		x, err := parseTagExpr(expr)
+		if err != nil {
+			t.Fatalf("Failed parsing %q: %s", expr, err)
+		}
+		got := ""
+		for _, pos := range x.eval(idx) {
+			got += idx.items[pos].Title
+		}
+		if got != expected {
+			t.Fatalf("%q: expected %q. Got %q.", expr, expected, got)
+		}
+	}
+
+	for _, expr := range []string{"", "work AND", "(work", "work)", "OR work"} {
+		if _, err := parseTagExpr(expr); err == nil {
+			t.Fatalf("Expected error parsing %q", expr)
+		}
+	}
+}
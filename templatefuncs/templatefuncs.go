@@ -0,0 +1,100 @@
+// Package templatefuncs provides template functions reading secrets from a
+// vault, for dotfile managers, static site generators, and other programs
+// that execute Go templates:
+//
+//	tmpl := template.New("gitconfig").Funcs(templatefuncs.New(v))
+//
+// The functions are:
+//
+//	onepassword "item" "field"      a field of an item
+//	onepassword "item/field"        the same, as a path
+//	onepassword "opvault://..."     the secret a reference names
+//	onepasswordItem "item"          the item itself, e.g. for .Title or .Username
+//	onepasswordTOTP "item"          the item's current one-time password
+//
+// Items are found as onepassword.Vault.FindItem finds them, and fields as
+// onepassword.Item.Field does. These names and behaviors won't change.
+// For html/template, convert the map with html/template.FuncMap.
+package templatefuncs
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// A Vault is what the functions read; *onepassword.Vault is one.
+type Vault interface {
+	FindItem(query string) (*onepassword.Item, error)
+	Resolve(ref string) (string, error)
+}
+
+// New returns the functions reading from v. Each item is looked up once
+// for the life of the map, so templates naming an item repeatedly don't
+// search the vault each time.
+func New(v Vault) template.FuncMap {
+	f := &funcs{vault: v, items: make(map[string]*onepassword.Item)}
+	return template.FuncMap{
+		"onepassword":     f.field,
+		"onepasswordItem": f.item,
+		"onepasswordTOTP": f.totp,
+	}
+}
+
+type funcs struct {
+	vault Vault
+	items map[string]*onepassword.Item
+}
+
+func (f *funcs) item(query string) (*onepassword.Item, error) {
+	if item, ok := f.items[query]; ok {
+		return item, nil
+	}
+	item, err := f.vault.FindItem(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", query, err)
+	}
+	f.items[query] = item
+	return item, nil
+}
+
+func (f *funcs) field(args ...string) (string, error) {
+	var query, name string
+	switch len(args) {
+	case 1:
+		if onepassword.IsSecretRef(args[0]) {
+			return f.vault.Resolve(args[0])
+		}
+		slash := strings.LastIndexByte(args[0], '/')
+		if slash <= 0 || slash == len(args[0])-1 {
+			return "", fmt.Errorf("invalid secret path %q; expected item/field", args[0])
+		}
+		query, name = args[0][:slash], args[0][slash+1:]
+	case 2:
+		query, name = args[0], args[1]
+	default:
+		return "", fmt.Errorf("onepassword takes an item/field path, a secret reference, or an item and field")
+	}
+
+	item, err := f.item(query)
+	if err != nil {
+		return "", err
+	}
+	value, ok := item.Field(name)
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", item.Title, name)
+	}
+	return value, nil
+}
+
+func (f *funcs) totp(query string) (string, error) {
+	item, err := f.item(query)
+	if err != nil {
+		return "", err
+	}
+	code, _, err := item.TOTPCode(time.Now())
+	return code, err
+}
@@ -0,0 +1,62 @@
+package templatefuncs
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// fakeVault holds one Login and counts lookups.
+type fakeVault struct {
+	item    *onepassword.Item
+	lookups int
+}
+
+func (v *fakeVault) FindItem(query string) (*onepassword.Item, error) {
+	v.lookups++
+	if !strings.EqualFold(query, v.item.Title) {
+		return nil, onepassword.ErrItemNotFound
+	}
+	return v.item, nil
+}
+
+func (v *fakeVault) Resolve(ref string) (string, error) {
+	return "resolved " + ref, nil
+}
+
+func TestFuncs(t *testing.T) {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title = "A1", "GitHub"
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	v := &fakeVault{item: item}
+
+	text := `{{ onepassword "GitHub" "username" }} {{ onepassword "github/password" }} {{ (onepasswordItem "GitHub").Title }} {{ onepassword "opvault:///x/y" }}`
+	tmpl, err := template.New("t").Funcs(New(v)).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err = tmpl.Execute(&out, nil); err != nil {
+		t.Fatalf("Execute failed: %s", err)
+	}
+	if want := "wendy hunter2 GitHub resolved opvault:///x/y"; out.String() != want {
+		t.Fatalf("Expected %q. Got %q.", want, out.String())
+	}
+	if v.lookups != 2 {
+		t.Fatalf("Expected each query to be looked up once. Got %d lookups.", v.lookups)
+	}
+
+	for _, text := range []string{`{{ onepassword "GitHub" "nope" }}`, `{{ onepassword "GitLab/password" }}`, `{{ onepasswordTOTP "GitHub" }}`} {
+		tmpl := template.Must(template.New("t").Funcs(New(v)).Parse(text))
+		if err := tmpl.Execute(&out, nil); err == nil {
+			t.Errorf("Expected %s to fail", text)
+		}
+	}
+}
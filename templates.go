@@ -0,0 +1,306 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+func tmplField(kind, id, name string) Field {
+	return Field{Kind: kind, Id: id, Name: name}
+}
+
+func tmplSection(name, title string, fields ...Field) Section {
+	return Section{Name: name, Title: title, Fields: fields}
+}
+
+// templates holds the sections the official apps create for each category.
+// Login, Password, Secure Note, and Document items are handled separately
+// by NewItemFromTemplate since their details aren't purely sectioned.
+var templates = map[string][]Section{
+	CatCreditCard.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "cardholder", "cardholder name"),
+			tmplField(KindCCType, "type", "type"),
+			tmplField(KindString, "ccnum", "number"),
+			tmplField(KindConcealed, "cvv", "verification number"),
+			tmplField(KindMonthYear, "expiry", "expiry date"),
+			tmplField(KindMonthYear, "validFrom", "valid from")),
+		tmplSection("contactInfo", "Contact Information",
+			tmplField(KindString, "bank", "issuing bank"),
+			tmplField(KindPhone, "phoneLocal", "phone (local)"),
+			tmplField(KindPhone, "phoneTollFree", "phone (toll free)"),
+			tmplField(KindPhone, "phoneIntl", "phone (intl)"),
+			tmplField(KindURL, "website", "website")),
+		tmplSection("details", "Additional Details",
+			tmplField(KindConcealed, "pin", "PIN"),
+			tmplField(KindString, "creditLimit", "credit limit"),
+			tmplField(KindString, "cashLimit", "cash withdrawal limit"),
+			tmplField(KindString, "interest", "interest rate"),
+			tmplField(KindString, "issuenumber", "issue number")),
+	},
+	CatIdentity.Uuid: {
+		tmplSection("name", "Identification",
+			tmplField(KindString, "firstname", "first name"),
+			tmplField(KindString, "initial", "initial"),
+			tmplField(KindString, "lastname", "last name"),
+			tmplField(KindMenu, "sex", "sex"),
+			tmplField(KindDate, "birthdate", "birth date"),
+			tmplField(KindString, "occupation", "occupation"),
+			tmplField(KindString, "company", "company"),
+			tmplField(KindString, "department", "department"),
+			tmplField(KindString, "jobtitle", "job title")),
+		tmplSection("address", "Address",
+			tmplField(KindAddress, "address", "address"),
+			tmplField(KindPhone, "defphone", "default phone"),
+			tmplField(KindPhone, "homephone", "home"),
+			tmplField(KindPhone, "cellphone", "mobile"),
+			tmplField(KindPhone, "busphone", "business")),
+		tmplSection("internet", "Internet Details",
+			tmplField(KindString, "username", "username"),
+			tmplField(KindString, "reminderq", "reminder question"),
+			tmplField(KindString, "remindera", "reminder answer"),
+			tmplField(KindEmail, "email", "email"),
+			tmplField(KindString, "website", "website")),
+	},
+	CatSoftwareLicense.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "product_version", "version"),
+			tmplField(KindString, "reg_code", "license key")),
+		tmplSection("customer", "Customer",
+			tmplField(KindString, "reg_name", "licensed to"),
+			tmplField(KindEmail, "reg_email", "registered email"),
+			tmplField(KindString, "company", "company")),
+		tmplSection("publisher", "Publisher",
+			tmplField(KindString, "publisher_name", "publisher"),
+			tmplField(KindURL, "publisher_website", "website"),
+			tmplField(KindString, "retail_price", "retail price"),
+			tmplField(KindEmail, "support_email", "support email")),
+		tmplSection("order", "Order",
+			tmplField(KindDate, "order_date", "purchase date"),
+			tmplField(KindString, "order_number", "order number"),
+			tmplField(KindString, "order_total", "order total")),
+	},
+	CatBankAccount.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "bankName", "bank name"),
+			tmplField(KindString, "owner", "name on account"),
+			tmplField(KindMenu, "accountType", "type"),
+			tmplField(KindString, "routingNo", "routing number"),
+			tmplField(KindString, "accountNo", "account number"),
+			tmplField(KindString, "swift", "SWIFT"),
+			tmplField(KindString, "iban", "IBAN"),
+			tmplField(KindConcealed, "telephonePin", "PIN")),
+		tmplSection("branchInfo", "Branch Information",
+			tmplField(KindPhone, "branchPhone", "phone"),
+			tmplField(KindString, "branchAddress", "address")),
+	},
+	CatDatabase.Uuid: {
+		tmplSection("", "",
+			tmplField(KindMenu, "database_type", "type"),
+			tmplField(KindString, "hostname", "server"),
+			tmplField(KindString, "port", "port"),
+			tmplField(KindString, "database", "database"),
+			tmplField(KindString, "username", "username"),
+			tmplField(KindConcealed, "password", "password"),
+			tmplField(KindString, "sid", "SID"),
+			tmplField(KindString, "alias", "alias"),
+			tmplField(KindString, "options", "connection options")),
+	},
+	CatDriverLicense.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "fullname", "full name"),
+			tmplField(KindString, "address", "address"),
+			tmplField(KindDate, "birthdate", "date of birth"),
+			tmplField(KindGender, "sex", "sex"),
+			tmplField(KindString, "height", "height"),
+			tmplField(KindString, "number", "number"),
+			tmplField(KindString, "class", "license class"),
+			tmplField(KindString, "conditions", "conditions / restrictions"),
+			tmplField(KindString, "state", "state"),
+			tmplField(KindString, "country", "country"),
+			tmplField(KindMonthYear, "expiry_date", "expiry date")),
+	},
+	CatOutdoorLicense.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "name", "full name"),
+			tmplField(KindDate, "valid_from", "valid from"),
+			tmplField(KindDate, "expires", "expires"),
+			tmplField(KindString, "game", "approved wildlife"),
+			tmplField(KindString, "quota", "maximum quota"),
+			tmplField(KindString, "state", "state"),
+			tmplField(KindString, "country", "country")),
+	},
+	CatMembership.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "org_name", "group"),
+			tmplField(KindURL, "website", "website"),
+			tmplField(KindPhone, "phone", "telephone"),
+			tmplField(KindString, "member_name", "member name"),
+			tmplField(KindMonthYear, "member_since", "member since"),
+			tmplField(KindMonthYear, "expiry_date", "expiry date"),
+			tmplField(KindString, "membership_no", "member ID"),
+			tmplField(KindConcealed, "pin", "password")),
+	},
+	CatPassport.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "type", "type"),
+			tmplField(KindString, "issuing_country", "issuing country"),
+			tmplField(KindString, "number", "number"),
+			tmplField(KindString, "fullname", "full name"),
+			tmplField(KindGender, "sex", "sex"),
+			tmplField(KindString, "nationality", "nationality"),
+			tmplField(KindString, "issuing_authority", "issuing authority"),
+			tmplField(KindDate, "birthdate", "date of birth"),
+			tmplField(KindString, "birthplace", "place of birth"),
+			tmplField(KindDate, "issue_date", "issued on"),
+			tmplField(KindDate, "expiry_date", "expiry date")),
+	},
+	CatRewards.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "company_name", "company name"),
+			tmplField(KindString, "member_name", "member name"),
+			tmplField(KindString, "membership_no", "member ID"),
+			tmplField(KindConcealed, "pin", "PIN")),
+		tmplSection("extra", "More Information",
+			tmplField(KindString, "additional_no", "member ID (additional)"),
+			tmplField(KindMonthYear, "member_since", "member since"),
+			tmplField(KindPhone, "customer_service_phone", "customer service phone"),
+			tmplField(KindPhone, "reservations_phone", "phone for reservations"),
+			tmplField(KindURL, "website", "website")),
+	},
+	CatSSN.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "name", "name"),
+			tmplField(KindConcealed, "number", "number")),
+	},
+	CatRouter.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "name", "base station name"),
+			tmplField(KindConcealed, "password", "base station password"),
+			tmplField(KindString, "server", "server / IP address"),
+			tmplField(KindString, "airport_id", "AirPort ID"),
+			tmplField(KindString, "network_name", "network name"),
+			tmplField(KindMenu, "wireless_security", "wireless security"),
+			tmplField(KindConcealed, "wireless_password", "wireless network password"),
+			tmplField(KindConcealed, "disk_password", "attached storage password")),
+	},
+	CatServer.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "url", "URL"),
+			tmplField(KindString, "username", "username"),
+			tmplField(KindConcealed, "password", "password")),
+		tmplSection("admin_console", "Admin Console",
+			tmplField(KindString, "admin_console_url", "admin console URL"),
+			tmplField(KindString, "admin_console_username", "admin console username"),
+			tmplField(KindConcealed, "admin_console_password", "console password")),
+		tmplSection("hosting_provider_details", "Hosting Provider",
+			tmplField(KindString, "name", "name"),
+			tmplField(KindURL, "website", "website"),
+			tmplField(KindString, "support_contact_url", "support URL"),
+			tmplField(KindPhone, "support_contact_phone", "support phone")),
+	},
+	CatEmail.Uuid: {
+		tmplSection("", "",
+			tmplField(KindMenu, "pop_type", "type"),
+			tmplField(KindString, "pop_username", "username"),
+			tmplField(KindString, "pop_server", "server"),
+			tmplField(KindString, "pop_port", "port number"),
+			tmplField(KindConcealed, "pop_password", "password"),
+			tmplField(KindMenu, "pop_security", "security"),
+			tmplField(KindMenu, "pop_authentication", "auth method")),
+		tmplSection("SMTP", "SMTP",
+			tmplField(KindString, "smtp_server", "SMTP server"),
+			tmplField(KindString, "smtp_port", "port number"),
+			tmplField(KindString, "smtp_username", "username"),
+			tmplField(KindConcealed, "smtp_password", "password"),
+			tmplField(KindMenu, "smtp_security", "security"),
+			tmplField(KindMenu, "smtp_authentication", "auth method")),
+		tmplSection("Contact Information", "Contact Information",
+			tmplField(KindString, "provider", "provider"),
+			tmplField(KindString, "provider_website", "provider's website"),
+			tmplField(KindPhone, "phone_local", "phone (local)"),
+			tmplField(KindPhone, "phone_tollfree", "phone (toll free)")),
+	},
+	CatAPICredential.Uuid: {
+		tmplSection("", "",
+			tmplField(KindString, "username", "username"),
+			tmplField(KindConcealed, "credential", "credential"),
+			tmplField(KindMenu, "type", "type"),
+			tmplField(KindString, "filename", "filename"),
+			tmplField(KindDate, "validFrom", "valid from"),
+			tmplField(KindDate, "expires", "expires"),
+			tmplField(KindString, "hostname", "hostname")),
+	},
+	CatMedicalRecord.Uuid: {
+		tmplSection("", "",
+			tmplField(KindDate, "date", "date"),
+			tmplField(KindString, "location", "location"),
+			tmplField(KindString, "healthcareprofessional", "healthcare professional"),
+			tmplField(KindString, "patient", "patient"),
+			tmplField(KindString, "reason", "reason for visit")),
+		tmplSection("medication", "Medication",
+			tmplField(KindString, "medication", "medication"),
+			tmplField(KindString, "dosage", "dosage"),
+			tmplField(KindString, "frequency", "frequency"),
+			tmplField(KindString, "notes", "notes")),
+	},
+	CatSSHKey.Uuid: {
+		tmplSection("", "",
+			tmplField(KindConcealed, "private_key", "private key"),
+			tmplField(KindString, "public_key", "public key"),
+			tmplField(KindString, "fingerprint", "fingerprint"),
+			tmplField(KindString, "key_type", "key type")),
+	},
+	CatCryptoWallet.Uuid: {
+		tmplSection("", "",
+			tmplField(KindConcealed, "recoveryPhrase", "recovery phrase"),
+			tmplField(KindConcealed, "password", "password")),
+		tmplSection("wallet", "Wallet",
+			tmplField(KindString, "walletAddress", "wallet address")),
+	},
+}
+
+// NewItemFromTemplate returns an empty item in the supplied category whose
+// details contain the sections and fields the official apps expect, so they
+// render items created by this package the same way as their own.
+// Categories without a known layout get empty Secure Note details.
+func NewItemFromTemplate(cat Category) *Item {
+	var details interface{}
+	switch cat.Uuid {
+	case CatLogin.Uuid:
+		details = &Login{
+			Fields: []LoginField{
+				{Name: "username", Type: "T", Designation: "username"},
+				{Name: "password", Type: "P", Designation: "password"},
+			},
+			Sections: []Section{},
+		}
+	case CatPassword.Uuid:
+		details = &Password{}
+	case CatDocument.Uuid:
+		details = &Document{Sections: []Section{}}
+	default:
+		sections := templates[cat.Uuid]
+		if sections == nil {
+			sections = []Section{}
+		}
+		details = &Note{Sections: sections}
+	}
+
+	data, err := json.Marshal(details)
+	if err != nil {
+		panic(fmt.Sprintf("Cannot encode template for %s: %s", cat.Name, err))
+	}
+
+	return &Item{
+		Category: cat,
+		Tags:     []string{},
+		Details:  data,
+	}
+}
+
+// TemplateFields returns the fields of a new item in the category as the
+// official apps lay it out, with empty values, in the order of Item.Fields.
+func TemplateFields(cat Category) []FieldValue {
+	return NewItemFromTemplate(cat).fields(true)
+}
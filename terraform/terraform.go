@@ -0,0 +1,226 @@
+// Package terraform has the plumbing for the onepassword_item data source
+// of a Terraform or OpenTofu provider, so infrastructure code can read
+// secrets from a local vault at plan time without the 1Password service.
+// The provider itself, built with terraform-plugin-framework, declares its
+// schemas from ProviderSchema and ItemSchema, decodes its configuration
+// into ProviderConfig and ItemConfig, whose fields carry tfsdk tags, and
+// sets the data source's state from ReadItem:
+//
+//	provider "onepassword" {
+//	  vault = "~/Dropbox/1Password.opvault"
+//	}
+//
+//	data "onepassword_item" "db" {
+//	  title = "Database"
+//	}
+//
+//	data "onepassword_item" "token" {
+//	  ref = "opvault:///API/token"
+//	}
+//
+// Plans run unattended, so the vault is unlocked with keys held by a
+// running "opvault agent", or else with the provider's password attribute
+// or $OPVAULT_PASSWORD.
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mpage/onepassword"
+	"github.com/mpage/onepassword/agent"
+	"github.com/mpage/onepassword/credentials"
+)
+
+// ErrLocked is returned by Configure when neither the agent nor a password
+// can unlock the vault.
+var ErrLocked = errors.New("vault is locked: start \"opvault agent\" or set the password")
+
+// An Attribute describes an attribute of a schema, for the provider to map
+// onto the framework's schema types. Type is "string", "list" of strings, or
+// "map" of strings.
+type Attribute struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+	Optional    bool
+	Computed    bool
+	Sensitive   bool
+}
+
+// ProviderSchema describes the provider's configuration.
+var ProviderSchema = []Attribute{
+	{Name: "vault", Type: "string", Optional: true, Description: "Path of the .opvault directory or 1Password database; defaults to the database of the 1Password app."},
+	{Name: "profile", Type: "string", Optional: true, Description: "Profile within the vault; defaults to \"default\"."},
+	{Name: "password", Type: "string", Optional: true, Sensitive: true, Description: "Master password, used if the opvault agent doesn't hold the vault's keys; defaults to $OPVAULT_PASSWORD."},
+}
+
+// ItemSchema describes the onepassword_item data source. Exactly one of
+// uuid, title, and ref is given.
+var ItemSchema = []Attribute{
+	{Name: "id", Type: "string", Computed: true, Description: "The item's uuid."},
+	{Name: "uuid", Type: "string", Optional: true, Computed: true, Description: "Uuid of the item to read."},
+	{Name: "title", Type: "string", Optional: true, Computed: true, Description: "Title of the item to read, or a search query matching only it."},
+	{Name: "ref", Type: "string", Optional: true, Description: "Secret reference, as opvault://vault/item/[section/]field, of the field to read into value."},
+	{Name: "category", Type: "string", Computed: true, Description: "The item's category, e.g. \"Login\"."},
+	{Name: "url", Type: "string", Computed: true, Description: "The item's primary URL."},
+	{Name: "tags", Type: "list", Computed: true, Description: "The item's tags."},
+	{Name: "username", Type: "string", Computed: true, Description: "The item's username."},
+	{Name: "password", Type: "string", Computed: true, Sensitive: true, Description: "The item's password."},
+	{Name: "notes", Type: "string", Computed: true, Sensitive: true, Description: "The item's notes."},
+	{Name: "fields", Type: "map", Computed: true, Sensitive: true, Description: "Every field by label, as \"section.label\" for fields in titled sections."},
+	{Name: "value", Type: "string", Computed: true, Sensitive: true, Description: "The field named by ref."},
+}
+
+// ProviderConfig is the provider's configuration.
+type ProviderConfig struct {
+	Vault    string `tfsdk:"vault"`
+	Profile  string `tfsdk:"profile"`
+	Password string `tfsdk:"password"`
+}
+
+// ItemConfig is the configuration of a onepassword_item data source.
+type ItemConfig struct {
+	Uuid  string `tfsdk:"uuid"`
+	Title string `tfsdk:"title"`
+	Ref   string `tfsdk:"ref"`
+}
+
+// ItemState is the state of a onepassword_item data source.
+type ItemState struct {
+	Id       string            `tfsdk:"id"`
+	Uuid     string            `tfsdk:"uuid"`
+	Title    string            `tfsdk:"title"`
+	Ref      string            `tfsdk:"ref"`
+	Category string            `tfsdk:"category"`
+	Url      string            `tfsdk:"url"`
+	Tags     []string          `tfsdk:"tags"`
+	Username string            `tfsdk:"username"`
+	Password string            `tfsdk:"password"`
+	Notes    string            `tfsdk:"notes"`
+	Fields   map[string]string `tfsdk:"fields"`
+	Value    string            `tfsdk:"value"`
+}
+
+// A Provider reads items from an unlocked vault.
+type Provider struct {
+	vault *onepassword.Vault
+}
+
+// Configure unlocks the vault the configuration names.
+func Configure(c ProviderConfig) (*Provider, error) {
+	cfg := onepassword.DefaultVaultConfig
+	if c.Vault != "" {
+		cfg.DBPath = expandHome(c.Vault)
+	}
+	if c.Profile != "" {
+		cfg.Profile = c.Profile
+	}
+
+	if kp, err := agent.NewClient().Keys(agent.VaultID(cfg.DBPath, cfg.Profile)); err == nil {
+		if v, err := onepassword.NewVaultWithKeys(kp, cfg); err == nil {
+			return &Provider{v}, nil
+		}
+	}
+	var src credentials.Source = credentials.Env("OPVAULT_PASSWORD")
+	if c.Password != "" {
+		src = credentials.Static(c.Password)
+	}
+	v, err := onepassword.OpenVault(src, cfg)
+	if err == credentials.ErrUnavailable {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, err
+	}
+	return &Provider{v}, nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory,
+// which Terraform doesn't do for attribute values.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Close locks the vault.
+func (p *Provider) Close() {
+	p.vault.Close()
+}
+
+// ReadItem returns the state of the data source configured by c.
+func (p *Provider) ReadItem(c ItemConfig) (*ItemState, error) {
+	given := 0
+	for _, s := range []string{c.Uuid, c.Title, c.Ref} {
+		if s != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, fmt.Errorf("exactly one of uuid, title, and ref must be given")
+	}
+
+	var item *onepassword.Item
+	var value string
+	var err error
+	switch {
+	case c.Uuid != "":
+		item, err = p.vault.Item(c.Uuid)
+	case c.Title != "":
+		item, err = p.vault.FindItem(c.Title)
+	default:
+		var ref *onepassword.SecretRef
+		if ref, err = onepassword.ParseSecretRef(c.Ref); err != nil {
+			return nil, err
+		}
+		if value, err = p.vault.Resolve(c.Ref); err != nil {
+			return nil, err
+		}
+		item, err = p.vault.FindItem(ref.Item)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := NewItemState(item)
+	state.Ref, state.Value = c.Ref, value
+	return state, nil
+}
+
+// NewItemState returns the state of a data source reading item.
+func NewItemState(item *onepassword.Item) *ItemState {
+	s := &ItemState{
+		Id:       item.Uuid,
+		Uuid:     item.Uuid,
+		Title:    item.Title,
+		Category: item.Category.Name,
+		Url:      item.Url,
+		Tags:     append([]string{}, item.Tags...),
+		Username: item.Username(),
+		Password: item.Password(),
+		Notes:    item.Notes(),
+		Fields:   make(map[string]string),
+	}
+	for _, f := range item.Fields() {
+		key := f.Name
+		if key == "" {
+			key = f.Id
+		}
+		if f.Section != "" {
+			key = f.Section + "." + key
+		}
+		if _, ok := s.Fields[key]; !ok {
+			s.Fields[key] = f.Value
+		}
+	}
+	return s
+}
@@ -0,0 +1,37 @@
+package terraform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+func TestNewItemState(t *testing.T) {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title, item.Url = "0123456789ABCDEF0123456789ABCDEF", "Database", "https://db.example.com"
+	item.Tags = []string{"prod"}
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "admin", "hunter2"
+	fields = append(fields, onepassword.FieldValue{Section: "Connection", Id: "port", Name: "Port", Kind: onepassword.KindString, Value: "5432"})
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewItemState(item)
+	if s.Id != item.Uuid || s.Category != "Login" || s.Username != "admin" || s.Password != "hunter2" || len(s.Tags) != 1 {
+		t.Fatalf("Unexpected state: %+v", s)
+	}
+	if s.Fields["username"] != "admin" || s.Fields["Connection.Port"] != "5432" {
+		t.Fatalf("Unexpected fields: %v", s.Fields)
+	}
+}
+
+func TestReadItemRequiresOneSelector(t *testing.T) {
+	p := &Provider{}
+	for _, c := range []ItemConfig{{}, {Uuid: "x", Title: "y"}} {
+		if _, err := p.ReadItem(c); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package onepassword
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// totpPrefix starts the identifier of the section fields the official apps
+// use to store one-time password secrets, e.g. "TOTP_2F1C...".
+const totpPrefix = "TOTP_"
+
+// TOTP returns the one-time password secret stored in the item, either as an
+// otpauth:// URI or a bare base32 secret, or "" if the item has none.
+func (i *Item) TOTP() string {
+	d := i.credentials()
+	for _, s := range d.Sections {
+		for _, f := range s.Fields {
+			if f.Value == "" {
+				continue
+			}
+			if strings.HasPrefix(f.Id, totpPrefix) || strings.HasPrefix(strings.ToLower(f.Value), "otpauth://") {
+				return f.Value
+			}
+		}
+	}
+	return ""
+}
+
+// TOTPParams describe how to generate time-based one-time passwords as
+// defined by RFC 6238.
+type TOTPParams struct {
+	Secret    []byte
+	Algorithm string // SHA1, SHA256, or SHA512
+	Digits    int
+	Period    time.Duration
+}
+
+// ParseTOTP parses a one-time password secret as returned by Item.TOTP.
+// Parameters missing from an otpauth:// URI, and all parameters of a bare
+// secret, take the usual defaults of SHA1, 6 digits, and 30 seconds.
+func ParseTOTP(s string) (*TOTPParams, error) {
+	p := &TOTPParams{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+
+	secret := s
+	if strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("totp: %s", err)
+		}
+		if u.Host != "totp" {
+			return nil, fmt.Errorf("totp: unsupported type %q", u.Host)
+		}
+		q := u.Query()
+		secret = q.Get("secret")
+		if a := q.Get("algorithm"); a != "" {
+			p.Algorithm = strings.ToUpper(a)
+		}
+		if d := q.Get("digits"); d != "" {
+			n, err := strconv.Atoi(d)
+			if err != nil || n < 1 || n > 10 {
+				return nil, fmt.Errorf("totp: invalid digits %q", d)
+			}
+			p.Digits = n
+		}
+		if d := q.Get("period"); d != "" {
+			n, err := strconv.Atoi(d)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("totp: invalid period %q", d)
+			}
+			p.Period = time.Duration(n) * time.Second
+		}
+	}
+	if p.hash() == nil {
+		return nil, fmt.Errorf("totp: unsupported algorithm %q", p.Algorithm)
+	}
+
+	// Secrets are often shown in groups and without padding
+	secret = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '=' {
+			return -1
+		}
+		return r
+	}, secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("totp: invalid secret: %s", err)
+	} else if len(key) == 0 {
+		return nil, fmt.Errorf("totp: empty secret")
+	}
+	p.Secret = key
+
+	return p, nil
+}
+
+func (p *TOTPParams) hash() func() hash.Hash {
+	switch p.Algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code returns the one-time password for the period containing t and the
+// time remaining until the next one.
+func (p *TOTPParams) Code(t time.Time) (string, time.Duration) {
+	period := int64(p.Period / time.Second)
+	counter := t.Unix() / period
+	remaining := time.Duration(period-t.Unix()%period) * time.Second
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(p.hash(), p.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	off := sum[len(sum)-1] & 0xf
+	bin := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	mod := uint64(1)
+	for i := 0; i < p.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", p.Digits, uint64(bin)%mod), remaining
+}
+
+// TOTPCode returns the item's one-time password for the period containing t
+// and the time remaining until the next one.
+func (i *Item) TOTPCode(t time.Time) (string, time.Duration, error) {
+	s := i.TOTP()
+	if s == "" {
+		return "", 0, fmt.Errorf("totp: %s has no one-time password", i.Title)
+	}
+	p, err := ParseTOTP(s)
+	if err != nil {
+		return "", 0, err
+	}
+	code, remaining := p.Code(t)
+	return code, remaining, nil
+}
+
+// OTPAuthURI returns an otpauth:// URI for the item's one-time password,
+// suitable for enrolling another authenticator. Bare secrets are turned into
+// URIs labelled with the item's title and username.
+func (i *Item) OTPAuthURI() (string, error) {
+	s := i.TOTP()
+	if s == "" {
+		return "", fmt.Errorf("totp: %s has no one-time password", i.Title)
+	}
+	if strings.HasPrefix(strings.ToLower(s), "otpauth://") {
+		return s, nil
+	}
+	if _, err := ParseTOTP(s); err != nil {
+		return "", err
+	}
+
+	label := i.Title
+	if user := i.Username(); user != "" {
+		label += ":" + user
+	}
+	q := url.Values{}
+	q.Set("secret", strings.ToUpper(strings.Replace(s, " ", "", -1)))
+	q.Set("issuer", i.Title)
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String(), nil
+}
@@ -0,0 +1,69 @@
+package onepassword
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B
+	vectors := []struct {
+		alg, key string
+		t        int64
+		code     string
+	}{
+		{"SHA1", "12345678901234567890", 59, "94287082"},
+		{"SHA256", "12345678901234567890123456789012", 59, "46119246"},
+		{"SHA512", "1234567890123456789012345678901234567890123456789012345678901234", 59, "90693936"},
+		{"SHA1", "12345678901234567890", 1111111109, "07081804"},
+		{"SHA1", "12345678901234567890", 20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		secret := base32.StdEncoding.EncodeToString([]byte(v.key))
+		p, err := ParseTOTP("otpauth://totp/Example:wendy?secret=" + secret + "&algorithm=" + v.alg + "&digits=8")
+		if err != nil {
+			t.Fatalf("Failed parsing URI: %s", err)
+		}
+		code, remaining := p.Code(time.Unix(v.t, 0))
+		if code != v.code {
+			t.Errorf("%s at %d: expected %s. Got %s.", v.alg, v.t, v.code, code)
+		}
+		if want := time.Duration(30-v.t%30) * time.Second; remaining != want {
+			t.Errorf("Expected %s remaining. Got %s.", want, remaining)
+		}
+	}
+}
+
+func TestParseBareTOTPSecret(t *testing.T) {
+	p, err := ParseTOTP("gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("Failed parsing secret: %s", err)
+	}
+	if string(p.Secret) != "1234567890" || p.Digits != 6 || p.Period != 30*time.Second {
+		t.Fatalf("Unexpected params: %+v", p)
+	}
+	if _, err = ParseTOTP("otpauth://hotp/x?secret=GEZDGNBV"); err == nil {
+		t.Fatalf("Expected an error for HOTP URIs.")
+	}
+}
+
+func TestOTPAuthURIAndWiFiConfig(t *testing.T) {
+	details := `{"fields":[{"designation":"username","value":"wendy"}],"sections":[{"fields":[{"k":"concealed","n":"TOTP_1","v":"GEZDGNBV"}]}]}`
+	item := Item{Title: "GitHub", Category: CatLogin, Details: []byte(details)}
+	uri, err := item.OTPAuthURI()
+	if err != nil {
+		t.Fatalf("Failed building URI: %s", err)
+	} else if uri != "otpauth://totp/GitHub:wendy?issuer=GitHub&secret=GEZDGNBV" {
+		t.Fatalf("Unexpected URI %q", uri)
+	}
+
+	details = `{"sections":[{"fields":[{"n":"network_name","v":"Home;Net"},{"n":"wireless_security","v":"wpa2"},{"n":"wireless_password","v":"p:ss"}]}]}`
+	router := Item{Title: "Home", Category: CatRouter, Details: []byte(details)}
+	wifi, err := router.WiFiConfig()
+	if err != nil {
+		t.Fatalf("Failed building payload: %s", err)
+	} else if wifi != `WIFI:T:WPA;S:Home\;Net;P:p\:ss;;` {
+		t.Fatalf("Unexpected payload %q", wifi)
+	}
+}
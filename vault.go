@@ -1,14 +1,20 @@
 package onepassword
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io/fs"
+	"os"
 	"os/user"
 	"path"
+	"path/filepath"
+	"runtime/trace"
+	"sync"
+	"time"
 
+	"github.com/mpage/onepassword/credentials"
 	"github.com/mpage/onepassword/crypto"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
@@ -17,24 +23,90 @@ const (
 	RelativeVaultPath = "Library/Containers/2BUA8C4S2C.com.agilebits.onepassword-osx-helper/Data/Library/Data/OnePassword.sqlite"
 )
 
-// A Vault is a read-only interface to the 1Password SQLite database.
+// A Vault is an interface to a 1Password vault, either the SQLite database
+// or an OPVault directory. Items are read-only apart from SaveItem.
 type Vault struct {
-	db          *sql.DB
-	profileId   int
+	store       store
+	dbPath      string
+	profile     string
+	derivedKP   *crypto.KeyPair    // Derived from the master password
 	masterKP    *crypto.KeyPair    // Encrypts item keypairs
 	overviewKP  *crypto.KeyPair    // Encrypts overviews
 	categories  map[string]string  // For uuid -> name
+	indexMu     sync.Mutex
+	index       *itemIndex         // Built on first search
+	indexCache  bool               // Persist index overviews in a sidecar
+	versions    int                // Earlier versions of items to keep
+	versionAge  time.Duration      // Drop earlier versions older than this, if positive
+	fieldClocks bool               // Tick field clocks in items saved
+	tombstones  bool               // Return tombstones with other items
+	cache       *itemCache         // Recently decrypted plaintext, or nil
+	metrics     Metrics            // Nil unless measuring
 }
 
 type VaultConfig struct {
-	DBPath  string  // Path to the sqlite file
+	DBPath  string  // Path to the sqlite file or .opvault directory
 	Profile string  // Name of 1p profile
+
+	// IndexCache persists the search index in a sidecar encrypted with the
+	// overview key, so that searching a large vault doesn't decrypt every
+	// overview each time it is opened. Only changed rows are re-decrypted.
+	IndexCache bool
+
+	// Metrics, if set, receives measurements of the vault's work.
+	Metrics Metrics
+
+	// ItemVersions, if positive, is how many earlier versions of each
+	// item SaveItem keeps, encrypted as the item is, so that bad edits can
+	// be rolled back with RestoreVersion. ItemVersionAge, if positive,
+	// also drops versions replaced longer ago than that.
+	ItemVersions   int
+	ItemVersionAge time.Duration
+
+	// FieldClocks records, in each item saved, a vector clock for each of
+	// its fields, so that MergeFields can tell which copy of a vault
+	// changed a field last.
+	FieldClocks bool
+
+	// MemoryMap maps the band and attachment files of OPVault directories
+	// into memory rather than reading them, so the files of very large
+	// vaults aren't copied through the heap before they're decoded. It
+	// needs mmap, and files are read as usual without it.
+	MemoryMap bool
+
+	// ItemCacheBytes, if positive, keeps up to that many bytes of the
+	// plaintext of recently decrypted overviews and details, so that
+	// long-running servers reading the same items needn't decrypt them
+	// again. The least recently used are wiped from memory as they're
+	// evicted, and the rest when the vault is closed.
+	ItemCacheBytes int
+
+	// Tombstones includes the items of category Tombstone that 1Password
+	// leaves in place of deleted ones among those LookupItems, Items,
+	// Overviews, and searches return. Otherwise they're skipped before
+	// their overviews are decrypted, as long-lived vaults can hold
+	// thousands of them.
+	Tombstones bool
+
+	// StrictOPData rejects encrypted overviews, details, and attachments
+	// with crypto.ErrMalformedOPData unless they're padded as 1Password
+	// pads them, as crypto.KeyPair.Strict describes. Verify is always
+	// strict.
+	StrictOPData bool
+
+	// KeyCache, if set, keeps the keys NewVault derives from the master
+	// password, so that NewVaultWithCachedKeys can unlock the vault without
+	// it later, even in another process.
+	KeyCache KeyCache
 }
 
+// resolveDefaultDBPath returns where 1Password keeps its database in the
+// current user's home directory. Where there's no user, as under js/wasm,
+// the path is relative.
 func resolveDefaultDBPath() string {
 	u, err := user.Current()
 	if err != nil {
-		panic(fmt.Sprintf("Cannot resolve current user: %s", err))
+		return RelativeVaultPath
 	}
 
 	return path.Join(u.HomeDir, RelativeVaultPath)
@@ -45,89 +117,202 @@ var DefaultVaultConfig = VaultConfig{
 	Profile: DefaultProfile,
 }
 
-func getCategories(db *sql.DB, profileId int) (map[string]string, error) {
-	cats := make(map[string]string)
-	err := transact(db, func(tx *sql.Tx) (e error) {
-		rows, e := tx.Query(
-			"SELECT uuid, singular_name" +
-			" FROM categories" +
-			" WHERE profile_id = ?",
-			profileId)
-		if e != nil {
-			return
-		}
-		defer rows.Close()
-
-		// Fill in cats
-		for rows.Next() {
-			var uuid, name string
-			e = rows.Scan(&uuid, &name)
-			if e != nil {
-				return
+// ErrItemNotFound is returned when looking up an item that doesn't exist.
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrWrongPassword is returned when unlocking a vault with the wrong master
+// password, or keys derived from one.
+var ErrWrongPassword = errors.New("incorrect master password")
+
+// openStore opens the SQLite database or OPVault directory at
+// cfg.DBPath, or the OPVault directory at a URL with a registered scheme.
+func openStore(cfg VaultConfig) (store, error) {
+	dbPath, profile := cfg.DBPath, cfg.Profile
+	if u, open, ok := remoteURL(dbPath); ok {
+		return openRemoteStore(u, open, profile)
+	}
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		st, err := openOPVaultStore(os.DirFS(dbPath), profile)
+		if err != nil {
+			return nil, err
+		}
+		st.writeFile = func(name string, data []byte) error {
+			return writeFileAtomic(filepath.Join(dbPath, filepath.FromSlash(name)), data)
+		}
+		st.appendFile = func(name string, data []byte) error {
+			return appendFile(filepath.Join(dbPath, filepath.FromSlash(name)), data)
+		}
+		st.removeFile = func(name string) error {
+			return os.Remove(filepath.Join(dbPath, filepath.FromSlash(name)))
+		}
+		st.lock = func() (func(), error) {
+			return lockFile(sidecarFile(dbPath, profile, "lock"))
+		}
+		if cfg.MemoryMap {
+			st.mapFile = func(name string) ([]byte, func(), error) {
+				return mapFile(filepath.Join(dbPath, filepath.FromSlash(name)))
 			}
+		}
+		return st, nil
+	}
+	return openSQLiteStore(dbPath, profile)
+}
+
+func NewVault(masterPass string, cfg VaultConfig) (*Vault, error) {
+	return NewVaultContext(context.Background(), masterPass, cfg)
+}
 
-			cats[uuid] = name
+// NewVaultContext is NewVault, returning ctx's error if ctx is done before
+// the vault is unlocked, as deriving keys from the master password can
+// take seconds on slow machines.
+func NewVaultContext(ctx context.Context, masterPass string, cfg VaultConfig) (*Vault, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return openVault(cfg, func(st store) (*Vault, error) {
+		v, err := newVault(ctx, masterPass, st)
+		if err == nil && cfg.KeyCache != nil {
+			cacheKeys(cfg.KeyCache, st, v.derivedKP)
 		}
+		return v, err
+	})
+}
 
-		return rows.Err()
+// NewVaultWithKeys unlocks a vault with keys previously returned by
+// Vault.DerivedKeys, skipping the derivation from the master password.
+func NewVaultWithKeys(derivedKP *crypto.KeyPair, cfg VaultConfig) (*Vault, error) {
+	return openVault(cfg, func(st store) (*Vault, error) {
+		return newVaultWithKeys(derivedKP, st)
 	})
+}
 
+// openVault opens the store named by cfg and unlocks it with unlock.
+func openVault(cfg VaultConfig, unlock func(st store) (*Vault, error)) (*Vault, error) {
+	st, err := openStore(cfg)
 	if err != nil {
-		cats = nil
+		return nil, err
 	}
 
-	return cats, err
+	v, err := unlock(st)
+	if cfg.Metrics != nil {
+		cfg.Metrics.Unlocked(err)
+	}
+	if err != nil {
+		st.close()
+		return nil, err
+	}
+	v.metrics = cfg.Metrics
+	v.dbPath = cfg.DBPath
+	if _, _, remote := remoteURL(cfg.DBPath); !remote {
+		v.dbPath = filepath.Clean(cfg.DBPath)
+	}
+	v.profile = cfg.Profile
+	v.indexCache = cfg.IndexCache
+	v.versions = cfg.ItemVersions
+	v.versionAge = cfg.ItemVersionAge
+	v.fieldClocks = cfg.FieldClocks
+	v.tombstones = cfg.Tombstones
+	v.masterKP.Strict = cfg.StrictOPData
+	v.overviewKP.Strict = cfg.StrictOPData
+	if cfg.ItemCacheBytes > 0 {
+		v.cache = newItemCache(cfg.ItemCacheBytes)
+	}
+
+	return v, nil
 }
 
-func NewVault(masterPass string, cfg VaultConfig) (*Vault, error) {
-	db, err := sql.Open("sqlite3", cfg.DBPath)
+// NewVaultFS unlocks a profile of the OPVault directory fsys, reading
+// nothing but fsys, as a browser-based viewer would from files the user
+// picks. The vault is read-only and has no index cache.
+func NewVaultFS(fsys fs.FS, profile, masterPass string) (*Vault, error) {
+	st, err := openOPVaultStore(fsys, profile)
 	if err != nil {
 		return nil, err
 	}
+	return newVault(context.Background(), masterPass, st)
+}
 
-	// Lookup profile
-	var profileId, nIters int
-	var salt, masterKeyBlob, overviewKeyBlob []byte
-	err = transact(db, func(tx *sql.Tx) error {
-		row := tx.QueryRow(
-			"SELECT id, iterations, master_key_data, overview_key_data, salt" +
-			" FROM profiles" +
-			" WHERE profile_name = ?",
-			cfg.Profile)
-		e := row.Scan(&profileId, &nIters, &masterKeyBlob, &overviewKeyBlob, &salt)
-		if e == sql.ErrNoRows {
-			e = fmt.Errorf("no profile named %q", cfg.Profile)
-		}
-		return e
-	})
+// NewVaultFSWithKeys is NewVaultFS with keys previously returned by
+// Vault.DerivedKeys.
+func NewVaultFSWithKeys(fsys fs.FS, profile string, derivedKP *crypto.KeyPair) (*Vault, error) {
+	st, err := openOPVaultStore(fsys, profile)
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
+	return newVaultWithKeys(derivedKP, st)
+}
 
-	// Decrypt master/overview keypairs
-	derKP := crypto.ComputeDerivedKeys(masterPass, salt, nIters)
-	mkp, err := crypto.DecryptMasterKeys(masterKeyBlob, derKP)
+// OpenVault unlocks a vault with the master password supplied by src, e.g.
+// credentials.Terminal{} to prompt for it.
+func OpenVault(src credentials.Source, cfg VaultConfig) (*Vault, error) {
+	pass, err := src.Password("Master password: ")
+	if err != nil {
+		return nil, err
+	}
+	return NewVault(pass, cfg)
+}
+
+// newVault unlocks the profile held by a store, giving up once ctx is done.
+func newVault(ctx context.Context, masterPass string, st store) (*Vault, error) {
+	prof, err := st.profile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Items are read while the keys are derived, so that opening a vault
+	// on a slow disk takes about as long as the slower of the two. Errors
+	// reading them are reported when they're first used.
+	var preloaded chan error
+	if ps, ok := st.(preloadStore); ok {
+		preloaded = make(chan error, 1)
+		go func() { preloaded <- ps.preload(ctx) }()
+	}
+	region := trace.StartRegion(ctx, "onepassword.deriveKeys")
+	derKP, err := crypto.ComputeDerivedKeysContext(ctx, masterPass, prof.Salt, prof.Iterations)
+	region.End()
+	var v *Vault
+	if err == nil {
+		v, err = newVaultWithKeys(derKP, st)
+	}
+	if preloaded != nil {
+		<-preloaded
+	}
+	return v, err
+}
+
+// newVaultWithKeys unlocks the profile held by a store with the keys derived
+// from its master password.
+func newVaultWithKeys(derKP *crypto.KeyPair, st store) (*Vault, error) {
+	prof, err := st.profile()
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
-	okp, err := crypto.DecryptMasterKeys(overviewKeyBlob, derKP)
+
+	// Decrypt master/overview keypairs
+	mkp, err := crypto.DecryptMasterKeys(prof.MasterKey, derKP)
+	if err == crypto.ErrIncorrectMAC {
+		return nil, ErrWrongPassword
+	} else if err != nil {
+		return nil, err
+	}
+	okp, err := crypto.DecryptMasterKeys(prof.OverviewKey, derKP)
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
 
 	// Get category index
-	cats, err := getCategories(db, profileId)
+	cats, err := st.categories()
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
 
 	v := &Vault{
-		db: db,
-		profileId: profileId,
+		store: st,
+		derivedKP: derKP,
 		masterKP: mkp,
 		overviewKP: okp,
 		categories: cats,
@@ -136,86 +321,242 @@ func NewVault(masterPass string, cfg VaultConfig) (*Vault, error) {
 	return v, nil
 }
 
+// category returns the category with the supplied uuid. Names stored in the
+// database take precedence; anything else is resolved via the registry.
+func (v *Vault) category(uuid string) Category {
+	if name, ok := v.categories[uuid]; ok {
+		return Category{uuid, name}
+	}
+	return resolveCategory(uuid)
+}
+
 // An ItemPredicate acts as a query to the 1Password database. It returns true
 // if an Item in the database is deemed a match. Otherwise it returns false.
 type ItemPredicate func(*Item) bool
 
+// decryptOverview returns the item described by a record, without details.
+func (v *Vault) decryptOverview(r *record) (*Item, error) {
+	return v.decryptOverviewVia(v.cache, r)
+}
+
+// decryptOverviewVia is decryptOverview keeping the plaintext in c, which
+// is nil for records that aren't the items' current versions.
+func (v *Vault) decryptOverviewVia(c *itemCache, r *record) (*Item, error) {
+	overview := c.get("overview", r)
+	if overview == nil {
+		defer observeDecrypt(v.metrics, "overview", time.Now())
+		var err error
+		if overview, err = crypto.DecryptOPData01(r.Overview, v.overviewKP); err != nil {
+			return nil, itemError(r.Uuid, "overview", err)
+		}
+		c.put("overview", r, overview)
+	}
+
+	var item Item
+	if err := json.Unmarshal(overview, &item); err != nil {
+		return nil, itemError(r.Uuid, "overview", err)
+	}
+	item.Uuid = r.Uuid
+	item.Category = v.category(r.Category)
+	item.Created = time.Unix(r.Created, 0)
+	item.Updated = time.Unix(r.Updated, 0)
+	item.FaveIndex = r.FaveIndex
+	item.Folder = r.Folder
+
+	return &item, nil
+}
+
+// decryptDetails fills in the details of an item from its record.
+func (v *Vault) decryptDetails(r *record, item *Item) error {
+	return v.decryptDetailsVia(v.cache, r, item)
+}
+
+// decryptDetailsVia is decryptDetails keeping the plaintext in c, as
+// decryptOverviewVia does.
+func (v *Vault) decryptDetailsVia(c *itemCache, r *record, item *Item) error {
+	if details := c.get("details", r); details != nil {
+		item.Details = details
+		return nil
+	}
+
+	// Decrypt the item key
+	kp, err := crypto.DecryptItemKey(r.Key, v.masterKP)
+	if err != nil {
+		return itemError(r.Uuid, "key", err)
+	}
+
+	// Decrypt the item details
+	if r.Details == nil {
+		if err = v.store.details(r); err != nil {
+			return err
+		}
+	}
+	defer observeDecrypt(v.metrics, "details", time.Now())
+	if item.Details, err = crypto.DecryptOPData01(r.Details, kp); err != nil {
+		return itemError(r.Uuid, "details", err)
+	}
+	c.put("details", r, item.Details)
+
+	return nil
+}
+
+// liveRecords returns the records of the items outside the trash, without
+// tombstones unless the vault was opened with them.
+func (v *Vault) liveRecords() ([]*record, error) {
+	recs, err := v.store.records()
+	if err != nil || v.tombstones {
+		return recs, err
+	}
+	live := recs[:0]
+	for _, r := range recs {
+		if r.Category != CatTombstone.Uuid {
+			live = append(live, r)
+		}
+	}
+	return live, nil
+}
+
 // LookupItems finds items in the 1Password database that match the supplied predicate.
 func (v *Vault) LookupItems(pred ItemPredicate) ([]Item, error) {
-	var items []Item
+	return v.LookupItemsContext(context.Background(), pred)
+}
 
-	err := transact(v.db, func(tx *sql.Tx) (e error) {
-		rows, e := tx.Query(
-			"SELECT id, category_uuid, key_data, overview_data" +
-			" FROM items" +
-			" WHERE profile_id = ? AND trashed = 0",
-			v.profileId)
-		if e != nil {
-			return
-		}
-		defer rows.Close()
-
-		// Figure out matches
-		for rows.Next() {
-			var itemId int
-			var catUuid string
-			var itemKeyBlob, opdata []byte
-			e = rows.Scan(&itemId, &catUuid, &itemKeyBlob, &opdata)
-			if e != nil {
-				return
-			}
+// LookupItemsContext is LookupItems, stopping with ctx's error once ctx is
+// done.
+func (v *Vault) LookupItemsContext(ctx context.Context, pred ItemPredicate) ([]Item, error) {
+	recs, err := v.liveRecords()
+	if err != nil {
+		return nil, err
+	}
 
-			// Decrypt the overview
-			var overview []byte
-			overview, e = crypto.DecryptOPData01(opdata, v.overviewKP)
-			if e != nil {
-				return
-			}
-			var item Item
-			e = json.Unmarshal(overview, &item)
-			if e != nil {
-				return
+	// Decrypted in parallel a batch at a time, and filtered in order
+	var items []Item
+	for len(recs) > 0 {
+		batch := recs
+		if len(batch) > lookupBatch {
+			batch = batch[:lookupBatch]
+		}
+		recs = recs[len(batch):]
+		decrypted, err := v.decryptRecords(ctx, batch, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		for i := range decrypted {
+			if pred(&decrypted[i]) {
+				items = append(items, decrypted[i])
 			}
-			item.Category = Category{catUuid, v.categories[catUuid]}
+		}
+	}
 
-			// Decrypt the item key
-			var kp *crypto.KeyPair
-			kp, e = crypto.DecryptItemKey(itemKeyBlob, v.masterKP)
-			if e != nil {
-				return
-			}
+	return items, nil
+}
 
-			// Decrypt the item details
-			detRow := tx.QueryRow(
-				"SELECT data FROM item_details" +
-				" WHERE item_id = ?", itemId)
-			var detailsCT []byte
-			e = detRow.Scan(&detailsCT)
-			if e != nil {
-				return
-			}
-			var details []byte
-			details, e = crypto.DecryptOPData01(detailsCT, kp)
-			if e != nil {
-				return
-			}
-			item.Details = details
+// Item returns the item with the supplied uuid.
+func (v *Vault) Item(uuid string) (*Item, error) {
+	r, err := v.store.record(uuid)
+	if err != nil {
+		return nil, err
+	}
+	item, err := v.decryptOverview(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = v.decryptDetails(r, item); err != nil {
+		return nil, err
+	}
+	if v.metrics != nil {
+		v.metrics.ItemRead(item.Category)
+	}
+	return item, nil
+}
 
-			if pred(&item) {
-				items = append(items, item)
-			}
+// ensureDetails decrypts the details of any of the supplied items that
+// don't have them yet, such as those restored from the index cache.
+func (v *Vault) ensureDetails(ctx context.Context, items []Item) error {
+	for i := range items {
+		if items[i].Details != nil {
+			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r, err := v.store.record(items[i].Uuid)
+		if err != nil {
+			return err
+		}
+		if err = v.decryptDetails(r, &items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		return rows.Err()
-	})
+// Overviews returns every item in the vault without decrypting their
+// details, which is much cheaper than Items when only titles, tags, and
+// URLs are needed. The index cache is used if enabled.
+func (v *Vault) Overviews() ([]Item, error) {
+	return v.OverviewsContext(context.Background())
+}
+
+// OverviewsContext is Overviews, stopping with ctx's error once ctx is done.
+func (v *Vault) OverviewsContext(ctx context.Context) ([]Item, error) {
+	if v.indexCache {
+		return v.cachedOverviews(ctx)
+	}
 
+	recs, err := v.liveRecords()
 	if err != nil {
-		items = nil
+		return nil, err
 	}
 
-	return items, err
+	return v.decryptRecords(ctx, recs, 0, false)
+}
+
+// Trash returns the items in the trash without their details, which are
+// otherwise never decrypted.
+func (v *Vault) Trash() ([]Item, error) {
+	recs, err := v.store.trashed()
+	if err != nil {
+		return nil, err
+	}
+
+	return v.decryptRecords(context.Background(), recs, 0, false)
+}
+
+// BandErrors returns what couldn't be read of the band files of an OPVault
+// directory. Bands that are truncated or hold garbage, as left by an
+// interrupted sync, don't keep the vault from opening: each item that can
+// be read is loaded, and the rest are reported here. The list is empty if
+// every band was read in full, and always for SQLite databases. Saving an
+// item fails while its band is damaged, so the items lost from it aren't
+// dropped for good.
+func (v *Vault) BandErrors() ([]*BandParseError, error) {
+	ds, ok := v.store.(damagedStore)
+	if !ok {
+		return nil, nil
+	}
+	return ds.bandErrors()
+}
+
+// Items returns every item in the vault.
+func (v *Vault) Items() ([]Item, error) {
+	return v.ItemsContext(context.Background())
+}
+
+// ItemsContext is Items, stopping with ctx's error once ctx is done.
+func (v *Vault) ItemsContext(ctx context.Context) ([]Item, error) {
+	return v.LookupItemsContext(ctx, func(*Item) bool { return true })
+}
+
+// DerivedKeys returns the keys derived from the master password, which
+// NewVaultWithKeys accepts in its place. Keeping them saves repeating the
+// deliberately slow derivation, as opvault agent does, but they unlock the
+// vault just as the password does.
+func (v *Vault) DerivedKeys() *crypto.KeyPair {
+	return v.derivedKP
 }
 
 func (v *Vault) Close() {
-	v.db.Close()
+	v.cache.purge()
+	v.store.close()
 }
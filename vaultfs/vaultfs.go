@@ -0,0 +1,361 @@
+//go:build linux || darwin
+
+// Package vaultfs presents a vault as a read-only FUSE filesystem, so that
+// grep, rsync, and backup software can read its contents. Folders are
+// directories, and each item is a directory of small files:
+//
+//	Work/GitHub/uuid
+//	Work/GitHub/title
+//	Work/GitHub/category
+//	Work/GitHub/url
+//	Work/GitHub/tags             one per line
+//	Work/GitHub/notes
+//	Work/GitHub/username         login fields, and a Password item's password
+//	Work/GitHub/Recovery/codes   fields of the section titled "Recovery"
+//	Work/GitHub/attachments/scan.pdf
+//
+// Items outside any folder are at the top. Empty values have no file, and
+// names are made unique within each directory by numbering repeats. Item
+// details are decrypted when their directory is first read, and
+// attachments each time they're opened.
+package vaultfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mpage/onepassword"
+)
+
+// A Source is what the filesystem shows; *onepassword.Vault is one.
+type Source interface {
+	Overviews() ([]onepassword.Item, error)
+	Item(uuid string) (*onepassword.Item, error)
+	Folders() ([]onepassword.Folder, error)
+	Attachments(item *onepassword.Item) ([]onepassword.Attachment, error)
+	ReadAttachment(a *onepassword.Attachment) ([]byte, error)
+}
+
+// Mount reads the folders and item overviews of src and serves them at dir
+// until the returned server is unmounted. Only the mounting user may read
+// the filesystem. opts may be nil.
+func Mount(dir string, src Source, opts *fs.Options) (*fuse.Server, error) {
+	folders, err := src.Folders()
+	if err != nil {
+		return nil, err
+	}
+	items, err := src.Overviews()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = &fs.Options{}
+	}
+	if opts.FsName == "" {
+		opts.FsName = "opvault"
+	}
+	if opts.Name == "" {
+		opts.Name = "opvault"
+	}
+	opts.Options = append(opts.Options, "ro")
+	opts.UID, opts.GID = uint32(os.Getuid()), uint32(os.Getgid())
+
+	root := &dirNode{}
+	v := &vaultFS{src: src}
+	opts.OnAdd = func(ctx context.Context) {
+		v.build(ctx, &root.Inode, folders, items)
+	}
+	return fs.Mount(dir, root, opts)
+}
+
+// A vaultFS serializes access to its source, which needn't be safe for
+// concurrent use.
+type vaultFS struct {
+	mu  sync.Mutex
+	src Source
+}
+
+// build adds the folders and items under root.
+func (v *vaultFS) build(ctx context.Context, root *fs.Inode, folders []onepassword.Folder, items []onepassword.Item) {
+	known := make(map[string]bool)
+	for _, f := range folders {
+		known[f.Uuid] = true
+	}
+	children := make(map[string][]onepassword.Folder)
+	for _, f := range folders {
+		parent := f.Parent
+		if !known[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], f)
+	}
+
+	// Folders are added from the top down, so any in a cycle are left out
+	dirs := map[string]*fs.Inode{"": root}
+	names := map[*fs.Inode]map[string]bool{root: {}}
+	queue := []string{""}
+	for len(queue) > 0 {
+		parent := dirs[queue[0]]
+		for _, f := range children[queue[0]] {
+			dir := parent.NewPersistentInode(ctx, &dirNode{}, fs.StableAttr{Mode: syscall.S_IFDIR})
+			parent.AddChild(uniqueName(names[parent], f.Title), dir, false)
+			dirs[f.Uuid] = dir
+			names[dir] = make(map[string]bool)
+			queue = append(queue, f.Uuid)
+		}
+		queue = queue[1:]
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Title != items[j].Title {
+			return items[i].Title < items[j].Title
+		}
+		return items[i].Uuid < items[j].Uuid
+	})
+	for _, item := range items {
+		parent, ok := dirs[item.Folder]
+		if !ok {
+			parent = root
+		}
+		n := &itemNode{fsys: v, uuid: item.Uuid, updated: item.Updated}
+		dir := parent.NewPersistentInode(ctx, n, fs.StableAttr{Mode: syscall.S_IFDIR})
+		parent.AddChild(uniqueName(names[parent], item.Title), dir, false)
+	}
+}
+
+// A dirNode is a folder, or a directory within an item.
+type dirNode struct {
+	fs.Inode
+	mtime time.Time
+}
+
+var _ = (fs.NodeGetattrer)((*dirNode)(nil))
+
+func (n *dirNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0500
+	if !n.mtime.IsZero() {
+		out.SetTimes(nil, &n.mtime, &n.mtime)
+	}
+	return 0
+}
+
+// An itemNode is an item's directory. Its files are added on first use.
+type itemNode struct {
+	fs.Inode
+	fsys    *vaultFS
+	uuid    string
+	updated time.Time
+	loaded  bool
+}
+
+var _ = (fs.NodeGetattrer)((*itemNode)(nil))
+var _ = (fs.NodeLookuper)((*itemNode)(nil))
+var _ = (fs.NodeReaddirer)((*itemNode)(nil))
+
+func (n *itemNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0500
+	out.SetTimes(nil, &n.updated, &n.updated)
+	return 0
+}
+
+func (n *itemNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if errno := n.load(ctx); errno != 0 {
+		return nil, errno
+	}
+	child := n.GetChild(name)
+	if child == nil {
+		return nil, syscall.ENOENT
+	}
+	if ga, ok := child.Operations().(fs.NodeGetattrer); ok {
+		var attr fuse.AttrOut
+		if ga.Getattr(ctx, nil, &attr) == 0 {
+			out.Attr = attr.Attr
+		}
+	}
+	return child, 0
+}
+
+func (n *itemNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	if errno := n.load(ctx); errno != 0 {
+		return nil, errno
+	}
+	var entries []fuse.DirEntry
+	for name, child := range n.Children() {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: child.Mode(), Ino: child.StableAttr().Ino})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return fs.NewListDirStream(entries), 0
+}
+
+// load decrypts the item's details and adds its files. A failure is
+// retried on next use.
+func (n *itemNode) load(ctx context.Context) syscall.Errno {
+	v := n.fsys
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if n.loaded {
+		return 0
+	}
+
+	item, err := v.src.Item(n.uuid)
+	if err == onepassword.ErrItemNotFound {
+		return syscall.ENOENT
+	} else if err != nil {
+		return syscall.EIO
+	}
+	atts, err := v.src.Attachments(item)
+	if err != nil {
+		return syscall.EIO
+	}
+
+	names := map[*fs.Inode]map[string]bool{&n.Inode: {}}
+	mkdir := func(name string) *fs.Inode {
+		d := n.NewPersistentInode(ctx, &dirNode{mtime: item.Updated}, fs.StableAttr{Mode: syscall.S_IFDIR})
+		n.AddChild(uniqueName(names[&n.Inode], name), d, false)
+		names[d] = make(map[string]bool)
+		return d
+	}
+	add := func(parent *fs.Inode, name string, node fs.InodeEmbedder) {
+		parent.AddChild(uniqueName(names[parent], name), n.NewPersistentInode(ctx, node, fs.StableAttr{}), false)
+	}
+
+	sections := map[string]*fs.Inode{"": &n.Inode}
+	for _, f := range ItemFiles(item) {
+		parent, ok := sections[f.Dir]
+		if !ok {
+			parent = mkdir(f.Dir)
+			sections[f.Dir] = parent
+		}
+		file := &fs.MemRegularFile{Data: []byte(f.Data)}
+		file.Attr.Mode = 0400
+		file.Attr.Nlink = 1
+		file.Attr.SetTimes(nil, &item.Updated, &item.Updated)
+		add(parent, f.Name, file)
+	}
+	if len(atts) > 0 {
+		parent := mkdir("attachments")
+		for _, a := range atts {
+			add(parent, a.Name, &attachmentNode{fsys: v, att: a})
+		}
+	}
+
+	n.loaded = true
+	return 0
+}
+
+// A File is one of the small files in an item's directory.
+type File struct {
+	Dir  string // Section title, or "" for the item's directory
+	Name string
+	Data string
+}
+
+// ItemFiles returns the files in an item's directory, apart from its
+// attachments. Values are followed by a newline, as text files are.
+func ItemFiles(item *onepassword.Item) []File {
+	files := []File{
+		{"", "uuid", item.Uuid},
+		{"", "title", item.Title},
+		{"", "category", item.Category.Name},
+		{"", "url", item.Url},
+		{"", "tags", strings.Join(item.Tags, "\n")},
+		{"", "notes", item.Notes()},
+	}
+	for _, f := range item.Fields() {
+		name := f.Name
+		if name == "" {
+			name = f.Id
+		}
+		files = append(files, File{f.Section, name, f.Value})
+	}
+
+	var nonEmpty []File
+	for _, f := range files {
+		if f.Data == "" {
+			continue
+		}
+		if !strings.HasSuffix(f.Data, "\n") {
+			f.Data += "\n"
+		}
+		nonEmpty = append(nonEmpty, f)
+	}
+	return nonEmpty
+}
+
+// uniqueName makes name usable as a file name, and numbers it if it's
+// already used, which it's then added to.
+func uniqueName(used map[string]bool, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// An attachmentNode is an attached file, decrypted when opened.
+type attachmentNode struct {
+	fs.Inode
+	fsys *vaultFS
+	att  onepassword.Attachment
+}
+
+var _ = (fs.NodeGetattrer)((*attachmentNode)(nil))
+var _ = (fs.NodeOpener)((*attachmentNode)(nil))
+
+func (n *attachmentNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0400
+	out.Nlink = 1
+	out.Size = uint64(n.att.Size)
+	out.SetTimes(nil, &n.att.Updated, &n.att.Updated)
+	return 0
+}
+
+func (n *attachmentNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	n.fsys.mu.Lock()
+	data, err := n.fsys.src.ReadAttachment(&n.att)
+	n.fsys.mu.Unlock()
+	if err != nil {
+		return nil, 0, syscall.EIO
+	}
+	return &attachmentHandle{data}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// An attachmentHandle holds an open attachment's contents.
+type attachmentHandle struct {
+	data []byte
+}
+
+var _ = (fs.FileReader)((*attachmentHandle)(nil))
+
+func (h *attachmentHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(h.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(h.data[off:end]), 0
+}
@@ -0,0 +1,130 @@
+//go:build linux || darwin
+
+package vaultfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/mpage/onepassword"
+)
+
+func login(t *testing.T) *onepassword.Item {
+	item := onepassword.NewItemFromTemplate(onepassword.CatLogin)
+	item.Uuid, item.Title, item.Url = "A1", "GitHub", "https://github.com"
+	item.Folder = "F2"
+	fields := onepassword.TemplateFields(onepassword.CatLogin)
+	fields[0].Value, fields[1].Value = "wendy", "hunter2"
+	fields = append(fields, onepassword.FieldValue{Section: "Recovery", Id: "codes", Name: "codes", Kind: onepassword.KindString, Value: "1234\n5678"})
+	if err := item.SetFields(fields, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestItemFiles(t *testing.T) {
+	got := ItemFiles(login(t))
+	want := []File{
+		{"", "uuid", "A1\n"},
+		{"", "title", "GitHub\n"},
+		{"", "category", "Login\n"},
+		{"", "url", "https://github.com\n"},
+		{"", "username", "wendy\n"},
+		{"", "password", "hunter2\n"},
+		{"Recovery", "codes", "1234\n5678\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected files %q. Got %q.", want, got)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	used := make(map[string]bool)
+	var got []string
+	for _, name := range []string{"a/b", "a/b", "", "..", "a_b"} {
+		got = append(got, uniqueName(used, name))
+	}
+	want := []string{"a_b", "a_b (2)", "_", "_..", "a_b (3)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected names %q. Got %q.", want, got)
+	}
+}
+
+// fakeSource holds one item, in a nested folder, with an attachment.
+type fakeSource struct {
+	item *onepassword.Item
+}
+
+func (s *fakeSource) Overviews() ([]onepassword.Item, error) {
+	return []onepassword.Item{{Uuid: s.item.Uuid, Title: s.item.Title, Folder: s.item.Folder}}, nil
+}
+
+func (s *fakeSource) Item(uuid string) (*onepassword.Item, error) {
+	if uuid != s.item.Uuid {
+		return nil, onepassword.ErrItemNotFound
+	}
+	return s.item, nil
+}
+
+func (s *fakeSource) Folders() ([]onepassword.Folder, error) {
+	return []onepassword.Folder{{Uuid: "F1", Title: "Work"}, {Uuid: "F2", Title: "Code", Parent: "F1"}}, nil
+}
+
+func (s *fakeSource) Attachments(item *onepassword.Item) ([]onepassword.Attachment, error) {
+	return []onepassword.Attachment{{Uuid: "C3", ItemUuid: item.Uuid, Name: "key.pem", Size: 5}}, nil
+}
+
+func (s *fakeSource) ReadAttachment(a *onepassword.Attachment) ([]byte, error) {
+	return []byte("-----"), nil
+}
+
+func TestMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vaultfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, err := Mount(dir, &fakeSource{login(t)}, &fs.Options{MountOptions: fuse.MountOptions{DirectMount: true}})
+	if err != nil {
+		t.Skipf("FUSE is unavailable: %s", err)
+	}
+	defer server.Unmount()
+
+	item := filepath.Join(dir, "Work", "Code", "GitHub")
+	names, err := filepath.Glob(filepath.Join(item, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range names {
+		names[i] = filepath.Base(names[i])
+	}
+	sort.Strings(names)
+	want := []string{"Recovery", "attachments", "category", "password", "title", "url", "username", "uuid"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Expected files %q. Got %q.", want, names)
+	}
+
+	for path, contents := range map[string]string{
+		"password":            "hunter2\n",
+		"Recovery/codes":      "1234\n5678\n",
+		"attachments/key.pem": "-----",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(item, path))
+		if err != nil {
+			t.Fatalf("Failed reading %s: %s", path, err)
+		} else if string(data) != contents {
+			t.Fatalf("Expected %s to hold %q. Got %q.", path, contents, data)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(item, "password"), []byte("x"), 0600); err == nil {
+		t.Fatalf("Expected the filesystem to be read-only")
+	}
+}
@@ -0,0 +1,174 @@
+package onepassword
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// Kinds of problem found by Verify.
+const (
+	ProblemProfile            = "profile"             // Missing or invalid profile fields
+	ProblemBand               = "band"                // Unreadable band file or misplaced item
+	ProblemItemHMAC           = "item-hmac"           // Item attributes don't match their HMAC
+	ProblemKey                = "key"                 // Item keys fail authentication
+	ProblemOverview           = "overview"            // Overview fails authentication
+	ProblemDetails            = "details"             // Details fail authentication
+	ProblemAttachment         = "attachment"          // Unreadable or corrupt attachment
+	ProblemOrphanedAttachment = "orphaned-attachment" // Attachment without an item
+	ProblemFolder             = "folder"              // Item refers to a missing folder
+)
+
+// A Problem is something wrong with a vault found by Verify.
+type Problem struct {
+	Kind       string `json:"kind"`
+	Item       string `json:"item,omitempty"`
+	Attachment string `json:"attachment,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Attachment != "":
+		return fmt.Sprintf("%s: attachment %s: %s", p.Kind, p.Attachment, p.Message)
+	case p.Item != "":
+		return fmt.Sprintf("%s: item %s: %s", p.Kind, p.Item, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Kind, p.Message)
+}
+
+// A VerifyReport lists the problems found by Verify.
+type VerifyReport struct {
+	Items       int       `json:"items"`
+	Attachments int       `json:"attachments"`
+	Problems    []Problem `json:"problems"`
+}
+
+// OK reports whether no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// A verifyingStore checks the parts of its format that reading items
+// doesn't touch.
+type verifyingStore interface {
+	verify(overviewKP *crypto.KeyPair) ([]Problem, error)
+}
+
+// Verify checks the integrity of the whole vault, including items in the
+// trash: every item's keys, overview, and details must authenticate, as
+// must every attachment, and their padding must be as 1Password writes,
+// whether or not the vault was opened with StrictOPData. For OPVault
+// directories the profile, band files,
+// item HMACs, and folder references are checked too, and attachments
+// without an item are reported.
+//
+// Problems with the vault's contents are listed in the report; the error
+// is only for failures to read the vault at all.
+func (v *Vault) Verify() (*VerifyReport, error) {
+	r := &VerifyReport{Problems: []Problem{}}
+	mkp := &crypto.KeyPair{EncKey: v.masterKP.EncKey, MACKey: v.masterKP.MACKey, Strict: true}
+	okp := &crypto.KeyPair{EncKey: v.overviewKP.EncKey, MACKey: v.overviewKP.MACKey, Strict: true}
+
+	if vs, ok := v.store.(verifyingStore); ok {
+		problems, err := vs.verify(okp)
+		if err != nil {
+			return nil, err
+		}
+		r.Problems = append(r.Problems, problems...)
+	}
+
+	recs, err := v.store.records()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := v.store.trashed()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range append(recs, trashed...) {
+		r.Items++
+		r.Problems = append(r.Problems, v.verifyItem(rec, r, mkp, okp)...)
+	}
+
+	sort.SliceStable(r.Problems, func(i, j int) bool {
+		a, b := r.Problems[i], r.Problems[j]
+		if a.Item != b.Item {
+			return a.Item < b.Item
+		}
+		return a.Kind < b.Kind
+	})
+	return r, nil
+}
+
+// verifyItem authenticates the parts of an item and its attachments with
+// the supplied master and overview keys.
+func (v *Vault) verifyItem(rec *record, r *VerifyReport, mkp, okp *crypto.KeyPair) []Problem {
+	var problems []Problem
+	fail := func(kind string, err error) {
+		problems = append(problems, Problem{Kind: kind, Item: rec.Uuid, Message: err.Error()})
+	}
+
+	// Plaintext is only checked, so it's decrypted into pooled buffers
+	if buf, err := decryptBuffer(rec.Overview, okp); err != nil {
+		fail(ProblemOverview, err)
+	} else {
+		buf.Release()
+	}
+	kp, err := crypto.DecryptItemKey(rec.Key, mkp)
+	if err != nil {
+		// Nothing else can be checked without the item keys
+		fail(ProblemKey, err)
+		return problems
+	}
+	if err = v.store.details(rec); err != nil {
+		fail(ProblemDetails, err)
+	} else if buf, err := decryptBuffer(rec.Details, kp); err != nil {
+		fail(ProblemDetails, err)
+	} else {
+		buf.Release()
+	}
+
+	atts, err := v.store.attachments(rec.Uuid)
+	if err != nil {
+		fail(ProblemAttachment, err)
+		return problems
+	}
+	for _, a := range atts {
+		r.Attachments++
+		if err := v.verifyAttachment(a, kp, okp); err != nil {
+			problems = append(problems, Problem{
+				Kind:       ProblemAttachment,
+				Item:       rec.Uuid,
+				Attachment: a.Uuid,
+				Message:    err.Error(),
+			})
+		}
+	}
+	return problems
+}
+
+func (v *Vault) verifyAttachment(a *attachmentRecord, kp, okp *crypto.KeyPair) error {
+	if len(a.Overview) > 0 {
+		buf, err := decryptBuffer(a.Overview, okp)
+		if err != nil {
+			return fmt.Errorf("overview: %s", err)
+		}
+		buf.Release()
+	}
+	opdata, release, err := v.store.attachmentData(a)
+	if err != nil {
+		return err
+	}
+	defer release()
+	buf, err := decryptBuffer(opdata, kp)
+	if err != nil {
+		return fmt.Errorf("contents: %s", err)
+	}
+	defer buf.Release()
+	if a.Size > 0 && int64(buf.Len()) != a.Size {
+		return fmt.Errorf("contents are %d bytes, expected %d", buf.Len(), a.Size)
+	}
+	return nil
+}
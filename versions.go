@@ -0,0 +1,157 @@
+package onepassword
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+// An ItemVersion is an earlier version of an item, as kept by SaveItem
+// for vaults opened with VaultConfig.ItemVersions set.
+type ItemVersion struct {
+	Item     Item      `json:"item"`     // With details
+	Replaced time.Time `json:"replaced"` // When a newer version was saved
+}
+
+// A storedVersion is an earlier version of an item as it was stored,
+// encrypted with the item's keys and the overview keys like the item.
+type storedVersion struct {
+	Replaced int64  `json:"replaced"`
+	Category string `json:"category"`
+	Created  int64  `json:"created"`
+	Updated  int64  `json:"updated"`
+	Fave     int    `json:"fave,omitempty"`
+	Folder   string `json:"folder,omitempty"`
+	Key      []byte `json:"k"`
+	Overview []byte `json:"o"`
+	Details  []byte `json:"d"`
+}
+
+// versionsFile names the file keeping an item's earlier versions, beside
+// the bands in an OPVault profile directory or as a sidecar otherwise.
+func versionsFile(uuid string) string {
+	return uuid + ".versions"
+}
+
+// Versions returns the kept earlier versions of the item with the supplied
+// uuid, newest first. Items saved without VaultConfig.ItemVersions set have
+// none. Versions are kept by the vault rather than the Item, which doesn't
+// refer to the vault it was read from.
+func (v *Vault) Versions(uuid string) ([]ItemVersion, error) {
+	stored, err := v.readVersions(uuid)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]ItemVersion, len(stored))
+	for i, sv := range stored {
+		r := &record{
+			Uuid:      uuid,
+			Category:  sv.Category,
+			Created:   sv.Created,
+			Updated:   sv.Updated,
+			FaveIndex: sv.Fave,
+			Folder:    sv.Folder,
+			Key:       sv.Key,
+			Overview:  sv.Overview,
+			Details:   sv.Details,
+		}
+		// Earlier versions would evict, or take the place of, the cached
+		// plaintext of the current one
+		item, err := v.decryptOverviewVia(nil, r)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %s", i, err)
+		}
+		if err = v.decryptDetailsVia(nil, r, item); err != nil {
+			return nil, fmt.Errorf("version %d: %s", i, err)
+		}
+		versions[i] = ItemVersion{*item, time.Unix(sv.Replaced, 0)}
+	}
+	return versions, nil
+}
+
+// RestoreVersion saves the nth version returned by Versions as the current
+// version of the item, moving it back to the folder it was in and restoring
+// its favorite position. The version it replaces is kept in turn, so a
+// restore can itself be undone.
+func (v *Vault) RestoreVersion(uuid string, n int) error {
+	versions, err := v.Versions(uuid)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n >= len(versions) {
+		return fmt.Errorf("item %s has %d earlier versions; there's no version %d", uuid, len(versions), n)
+	}
+	item := versions[n].Item
+	return v.SaveItem(&item)
+}
+
+// keepVersion adds the record of an item being replaced at the supplied
+// time to its earlier versions, dropping those beyond the vault's limits.
+func (v *Vault) keepVersion(r *record, at time.Time) error {
+	stored, err := v.readVersions(r.Uuid)
+	if err != nil {
+		return err
+	}
+	stored = append([]storedVersion{{
+		Replaced: at.Unix(),
+		Category: r.Category,
+		Created:  r.Created,
+		Updated:  r.Updated,
+		Fave:     r.FaveIndex,
+		Folder:   r.Folder,
+		Key:      r.Key,
+		Overview: r.Overview,
+		Details:  r.Details,
+	}}, stored...)
+	if len(stored) > v.versions {
+		stored = stored[:v.versions]
+	}
+	if v.versionAge > 0 {
+		cutoff := at.Add(-v.versionAge).Unix()
+		for i := range stored {
+			if stored[i].Replaced < cutoff {
+				stored = stored[:i]
+				break
+			}
+		}
+	}
+	return v.writeVersions(r.Uuid, stored)
+}
+
+func (v *Vault) readVersions(uuid string) ([]storedVersion, error) {
+	var data []byte
+	var err error
+	if st, ok := v.store.(*opvaultStore); ok {
+		data, err = fs.ReadFile(st.fsys, path.Join(st.dir, versionsFile(uuid)))
+	} else {
+		data, err = ioutil.ReadFile(v.sidecarPath(versionsFile(uuid)))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stored []storedVersion
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %s", versionsFile(uuid), err)
+	}
+	return stored, nil
+}
+
+func (v *Vault) writeVersions(uuid string, stored []storedVersion) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if st, ok := v.store.(*opvaultStore); ok {
+		if st.writeFile == nil {
+			return ErrReadOnly
+		}
+		return st.writeFile(path.Join(st.dir, versionsFile(uuid)), data)
+	}
+	return writeFileAtomic(v.sidecarPath(versionsFile(uuid)), data)
+}
@@ -0,0 +1,316 @@
+package onepassword
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The kinds of Event.
+const (
+	ItemAdded    = "added"
+	ItemModified = "modified"
+	ItemDeleted  = "deleted"
+	VaultRekeyed = "rekeyed" // The master password or keys changed
+)
+
+// An Event is a change to a vault noticed by a Watcher. Events carry only
+// what's stored unencrypted, so items are identified by uuid and category.
+type Event struct {
+	Kind     string    `json:"kind"`
+	Uuid     string    `json:"uuid,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Updated  time.Time `json:"updated,omitempty"`
+	Time     time.Time `json:"time"` // When the change was noticed
+}
+
+// A Watcher notices changes to the vault described by its config by
+// comparing the items stored there with those seen last time. It reads
+// nothing encrypted, so needs no password. Moving an item to the trash
+// counts as deleting it.
+type Watcher struct {
+	cfg   VaultConfig
+	files map[string]string // Fingerprints of the files read
+	prof  profileRecord
+	seen  map[string]watchedItem
+}
+
+type watchedItem struct {
+	category string
+	updated  int64
+	tx       int64
+}
+
+// NewWatcher returns a Watcher for the vault described by cfg, which starts
+// from the vault's current contents.
+func NewWatcher(cfg VaultConfig) (*Watcher, error) {
+	w := &Watcher{cfg: cfg}
+	if _, err := w.Poll(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Poll returns the changes since the last call: a VaultRekeyed event if
+// the profile's keys changed, then deleted, added, and modified items, each
+// ordered by uuid.
+func (w *Watcher) Poll() ([]Event, error) {
+	files, err := fingerprint(w.cfg.DBPath, w.cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if w.seen != nil && sameFingerprint(files, w.files) {
+		return nil, nil
+	}
+
+	st, err := openStore(w.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer st.close()
+	prof, err := st.profile()
+	if err != nil {
+		return nil, err
+	}
+	cats, err := st.categories()
+	if err != nil {
+		return nil, err
+	}
+	recs, err := st.records()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]watchedItem, len(recs))
+	for _, r := range recs {
+		name, ok := cats[r.Category]
+		if !ok {
+			name = resolveCategory(r.Category).Name
+		}
+		seen[r.Uuid] = watchedItem{name, r.Updated, r.Tx}
+	}
+
+	var events []Event
+	if w.seen != nil {
+		now := time.Now()
+		if prof.Iterations != w.prof.Iterations || !bytes.Equal(prof.Salt, w.prof.Salt) ||
+			!bytes.Equal(prof.MasterKey, w.prof.MasterKey) || !bytes.Equal(prof.OverviewKey, w.prof.OverviewKey) {
+			events = append(events, Event{Kind: VaultRekeyed, Time: now})
+		}
+		var deleted, added, modified []Event
+		for uuid, old := range w.seen {
+			if _, ok := seen[uuid]; !ok {
+				deleted = append(deleted, Event{Kind: ItemDeleted, Uuid: uuid, Category: old.category, Time: now})
+			}
+		}
+		for uuid, cur := range seen {
+			ev := Event{Uuid: uuid, Category: cur.category, Updated: time.Unix(cur.updated, 0), Time: now}
+			old, ok := w.seen[uuid]
+			switch {
+			case !ok:
+				ev.Kind = ItemAdded
+				added = append(added, ev)
+			case old.updated != cur.updated || old.tx != cur.tx:
+				ev.Kind = ItemModified
+				modified = append(modified, ev)
+			}
+		}
+		for _, evs := range [][]Event{deleted, added, modified} {
+			sort.Slice(evs, func(i, j int) bool { return evs[i].Uuid < evs[j].Uuid })
+			events = append(events, evs...)
+		}
+	}
+
+	w.files, w.prof, w.seen = files, *prof, seen
+	return events, nil
+}
+
+// Watch polls every interval, sending each event on events, until stop is
+// closed or polling fails.
+func (w *Watcher) Watch(interval time.Duration, events chan<- Event, stop <-chan struct{}) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+		}
+		evs, err := w.Poll()
+		if err != nil {
+			return err
+		}
+		for _, ev := range evs {
+			select {
+			case events <- ev:
+			case <-stop:
+				return nil
+			}
+		}
+	}
+}
+
+// watchDelay is how long Vault.Watch waits for a burst of changes to end,
+// as a sync writes several files, before reading them.
+const watchDelay = 100 * time.Millisecond
+
+// Watch keeps the vault current as other programs, such as a syncing
+// 1Password client, change its files, and sends an Event for each item
+// they add, modify, or delete, so that long-running programs see what a
+// newly opened vault would. Only the bands that changed are read again.
+// If the profile's keys change, a VaultRekeyed event is sent; items
+// encrypted with the new keys can't be read until the vault is opened
+// with its new password.
+//
+// Bands that can't be read, as when caught half-written, are read again
+// on their next change. The channel is closed when ctx is done. Only
+// OPVault directories on this computer can be watched; use a Watcher for
+// other vaults.
+func (v *Vault) Watch(ctx context.Context) (<-chan Event, error) {
+	st, ok := v.store.(*opvaultStore)
+	if _, _, remote := remoteURL(v.dbPath); !ok || remote {
+		return nil, errors.New("only OPVault directories on this computer can be watched")
+	}
+	if _, err := st.load(); err != nil {
+		return nil, err
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = fw.Add(filepath.Join(v.dbPath, filepath.FromSlash(st.dir))); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	events := make(chan Event)
+	go v.watch(ctx, st, fw, events)
+	return events, nil
+}
+
+func (v *Vault) watch(ctx context.Context, st *opvaultStore, fw *fsnotify.Watcher, events chan<- Event) {
+	defer close(events)
+	defer fw.Close()
+
+	watched := map[string]bool{"profile.js": true}
+	for _, name := range bandNames {
+		watched[name] = true
+	}
+	changed := make(map[string]bool)
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			if name := filepath.Base(ev.Name); watched[name] {
+				changed[name] = true
+				timer.Reset(watchDelay)
+			}
+			continue
+		case _, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			// Changes may have been missed, so everything is read again
+			for name := range watched {
+				changed[name] = true
+			}
+			timer.Reset(watchDelay)
+			continue
+		case <-timer.C:
+		}
+
+		evs := v.reload(st, changed)
+		changed = make(map[string]bool)
+		for _, ev := range evs {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// reload reads the changed files of a watched vault again, returning a
+// VaultRekeyed event if the profile's keys changed, then the events for
+// each band in order. Files that can't be read are left as they were.
+func (v *Vault) reload(st *opvaultStore, changed map[string]bool) []Event {
+	var events []Event
+	now := time.Now()
+	if changed["profile.js"] {
+		if rekeyed, err := st.reloadProfile(); err == nil && rekeyed {
+			events = append(events, Event{Kind: VaultRekeyed, Time: now})
+		}
+	}
+	items := false
+	for _, name := range bandNames {
+		if !changed[name] {
+			continue
+		}
+		evs, err := st.reloadBand(name, now)
+		if err != nil {
+			continue
+		}
+		items = items || len(evs) > 0
+		events = append(events, evs...)
+	}
+	if items {
+		// The search index no longer reflects the vault
+		v.indexMu.Lock()
+		v.index = nil
+		v.indexMu.Unlock()
+	}
+	return events
+}
+
+// fingerprint describes the files a vault is read from by their sizes and
+// modification times, so unchanged vaults needn't be read again: the
+// profile's directory in an OPVault, or the SQLite database and its
+// write-ahead log.
+func fingerprint(dbPath, profile string) (map[string]string, error) {
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	if fi.IsDir() {
+		if infos, err = ioutil.ReadDir(filepath.Join(dbPath, profile)); err != nil {
+			return nil, err
+		}
+	} else {
+		infos = append(infos, fi)
+		if wal, err := os.Stat(dbPath + "-wal"); err == nil {
+			infos = append(infos, wal)
+		}
+	}
+	files := make(map[string]string, len(infos))
+	for _, fi := range infos {
+		files[fi.Name()] = fmt.Sprintf("%d %d", fi.Size(), fi.ModTime().UnixNano())
+	}
+	return files, nil
+}
+
+func sameFingerprint(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, f := range a {
+		if b[name] != f {
+			return false
+		}
+	}
+	return true
+}
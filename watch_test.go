@@ -0,0 +1,133 @@
+package onepassword
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFixture writes the fixture's files under dir.
+func writeFixture(t *testing.T, f *opvaultFixture, dir string) {
+	for name, file := range f.fsys {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, file.Data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	f.addItem("C3", CatPassword.Uuid, `{"title":"Wi-Fi"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	w, err := NewWatcher(VaultConfig{DBPath: dir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed watching vault: %s", err)
+	}
+	if evs, err := w.Poll(); err != nil || len(evs) != 0 {
+		t.Fatalf("Expected no events. Got %+v, %v.", evs, err)
+	}
+
+	f.band["A1"].Updated++
+	f.writeBand("A")
+	f.band["B2"].Trashed = true
+	f.writeBand("B")
+	f.addItem("D4", CatLogin.Uuid, `{"title":"Gitea"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	evs, err := w.Poll()
+	if err != nil {
+		t.Fatalf("Failed polling: %s", err)
+	}
+	want := []Event{{Kind: ItemDeleted, Uuid: "B2"}, {Kind: ItemAdded, Uuid: "D4"}, {Kind: ItemModified, Uuid: "A1"}}
+	if len(evs) != len(want) {
+		t.Fatalf("Expected %d events. Got %+v.", len(want), evs)
+	}
+	for i := range want {
+		if evs[i].Kind != want[i].Kind || evs[i].Uuid != want[i].Uuid || evs[i].Category != "Login" {
+			t.Errorf("Expected event %d to be %s %s. Got %+v.", i, want[i].Kind, want[i].Uuid, evs[i])
+		}
+	}
+
+	// Changing the master password rewrites the profile
+	g := newOPVaultFixture(t)
+	f.fsys["default/profile.js"] = g.fsys["default/profile.js"]
+	writeFixture(t, f, dir)
+	if evs, err = w.Poll(); err != nil || len(evs) != 1 || evs[0].Kind != VaultRekeyed {
+		t.Fatalf("Expected a rekeyed event. Got %+v, %v.", evs, err)
+	}
+}
+
+func TestVaultWatch(t *testing.T) {
+	dir := t.TempDir()
+	f := newOPVaultFixture(t)
+	f.addItem("A1", CatLogin.Uuid, `{"title":"GitHub"}`, loginDetails, false)
+	f.addItem("B2", CatLogin.Uuid, `{"title":"GitLab"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	v, err := NewVault(testPassword, VaultConfig{DBPath: dir, Profile: "default"})
+	if err != nil {
+		t.Fatalf("Failed opening vault: %s", err)
+	}
+	defer v.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := v.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Failed watching vault: %s", err)
+	}
+	receive := func(n int) map[string]string {
+		got := make(map[string]string)
+		for len(got) < n {
+			select {
+			case ev := <-events:
+				got[ev.Uuid] = ev.Kind
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out after events %v", got)
+			}
+		}
+		return got
+	}
+
+	f.band["A1"].Updated++
+	f.writeBand("A")
+	f.band["B2"].Trashed = true
+	f.writeBand("B")
+	f.addItem("D4", CatLogin.Uuid, `{"title":"Gitea"}`, loginDetails, false)
+	writeFixture(t, f, dir)
+	want := map[string]string{"A1": ItemModified, "B2": ItemDeleted, "D4": ItemAdded}
+	if got := receive(3); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected events %v. Got %v.", want, got)
+	}
+	if item, err := v.Item("D4"); err != nil || item.Title != "Gitea" {
+		t.Errorf("Expected the added item. Got %+v, %v.", item, err)
+	}
+	if _, err := v.Item("B2"); err != ErrItemNotFound {
+		t.Errorf("Expected the trashed item to be gone. Got %v.", err)
+	}
+
+	// Changing the master password rewrites the profile
+	g := newOPVaultFixture(t)
+	f.fsys["default/profile.js"] = g.fsys["default/profile.js"]
+	writeFixture(t, f, dir)
+	if got := receive(1); got[""] != VaultRekeyed {
+		t.Fatalf("Expected a rekeyed event. Got %v.", got)
+	}
+
+	cancel()
+	for range events {
+	}
+}
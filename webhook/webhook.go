@@ -0,0 +1,107 @@
+// Package webhook delivers a vault's change events to HTTP endpoints, for
+// invalidating caches and alerting when items change. Each delivery is a
+// POST of a JSON Payload. With a secret, the body is signed with
+// HMAC-SHA256 and the signature sent as
+//
+//	X-Opvault-Signature: sha256=<hex>
+//
+// so receivers can check deliveries came from the watcher.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mpage/onepassword"
+)
+
+// SignatureHeader is the header carrying a delivery's signature.
+const SignatureHeader = "X-Opvault-Signature"
+
+// A Payload is the body of a delivery: the events noticed in one poll of a
+// vault.
+type Payload struct {
+	Vault  string              `json:"vault"`
+	Events []onepassword.Event `json:"events"`
+}
+
+// A Hook is an endpoint events are delivered to.
+type Hook struct {
+	URL    string
+	Secret []byte // Signs deliveries if set
+
+	// Attempts is how many times a delivery is tried before giving up,
+	// waiting twice as long after each failure. Zero means 3.
+	Attempts int
+	Client   *http.Client // Nil for one with a 10 second timeout
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Sign returns the signature of body with secret, as sent in
+// SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is body's signature with secret.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// Deliver posts p to the hook, retrying failed attempts. Responses other
+// than 2xx count as failures.
+func (h *Hook) Deliver(p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	attempts := h.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	wait := time.Second
+	for i := 1; ; i++ {
+		if err = h.post(body); err == nil || i == attempts {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (h *Hook) post(body []byte) error {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "opvault-webhook")
+	if len(h.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	client := h.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", h.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mpage/onepassword"
+)
+
+func TestDeliver(t *testing.T) {
+	secret := []byte("s3cret")
+	var got Payload
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify(secret, body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("Bad signature %q", r.Header.Get(SignatureHeader))
+		}
+		if calls == 1 {
+			// Fail the first attempt to check it's retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	h := &Hook{URL: srv.URL, Secret: secret}
+	p := &Payload{Vault: "Personal", Events: []onepassword.Event{{Kind: onepassword.ItemAdded, Uuid: "A1"}}}
+	if err := h.Deliver(p); err != nil {
+		t.Fatalf("Failed delivering: %s", err)
+	}
+	if calls != 2 || got.Vault != "Personal" || len(got.Events) != 1 || got.Events[0].Uuid != "A1" {
+		t.Fatalf("Unexpected delivery after %d calls: %+v", calls, got)
+	}
+
+	h = &Hook{URL: srv.URL, Secret: secret, Attempts: 1}
+	calls = 0
+	if err := h.Deliver(p); err == nil {
+		t.Fatalf("Expected a failed delivery to be reported")
+	}
+}
@@ -0,0 +1,42 @@
+package onepassword
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wifiEscaper escapes the characters with special meaning in WIFI: payloads.
+var wifiEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+
+// WiFiConfig returns the network of a Router item as a WIFI: payload, the
+// format phone cameras recognise in QR codes to join a network.
+func (i *Item) WiFiConfig() (string, error) {
+	if i.Category.Uuid != CatRouter.Uuid {
+		return "", fmt.Errorf("%s is not a Router item", i.Title)
+	}
+	ssid, _ := i.Field("network_name")
+	if ssid == "" {
+		return "", fmt.Errorf("%s has no network name", i.Title)
+	}
+	password, _ := i.Field("wireless_password")
+	security, _ := i.Field("wireless_security")
+
+	var auth string
+	switch strings.ToLower(security) {
+	case "none", "open":
+		auth = "nopass"
+	case "wep":
+		auth = "WEP"
+	default:
+		auth = "WPA"
+	}
+	if password == "" {
+		auth = "nopass"
+	}
+
+	payload := "WIFI:T:" + auth + ";S:" + wifiEscaper.Replace(ssid) + ";"
+	if auth != "nopass" {
+		payload += "P:" + wifiEscaper.Replace(password) + ";"
+	}
+	return payload + ";", nil
+}
@@ -0,0 +1,227 @@
+package onepassword
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mpage/onepassword/crypto"
+)
+
+// ErrReadOnly is returned when saving items to a vault whose format can't
+// be written.
+var ErrReadOnly = errors.New("vault is read-only")
+
+// ErrInvalidUUID is returned when saving an item whose uuid isn't in the
+// form NewUUID returns. Items keyed by foreign identifiers, such as those
+// of other password managers, should be given a new uuid.
+var ErrInvalidUUID = errors.New("invalid item uuid")
+
+// NewUUID returns a random item uuid in the form the apps use: 32
+// uppercase hexadecimal digits.
+func NewUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// validUUID reports whether uuid is 32 uppercase hexadecimal digits.
+func validUUID(uuid string) bool {
+	if len(uuid) != 32 {
+		return false
+	}
+	for _, c := range uuid {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// overviewKeys are the overview entries SaveItem writes from an Item.
+// Other entries already in an item's overview are preserved.
+var overviewKeys = []string{"title", "url", "URLs", "ainfo", "tags", "ps", "scope", "autosubmit"}
+
+// SaveItem encrypts an item and writes it to the vault, replacing the item
+// with the same uuid or creating a new one. Items without a uuid are given
+// one; other uuids must be in the form NewUUID returns. Created is set for
+// new items and Updated is set to the current time. An item read without
+// details keeps its existing details. In OPVault directories, the item is
+// moved to Item.Folder, or out of any folder if it's empty. Each save is
+// recorded in the vault's journal; see History. The version replaced is
+// kept if VaultConfig.ItemVersions is set; see Versions. If
+// VaultConfig.FieldClocks is set, the clocks of the fields changed are
+// ticked; see MergeFields.
+//
+// Only OPVault directories, including remote ones whose backends can
+// write, and SQLite databases can be written; other stores return
+// ErrReadOnly. 1Password itself should not be running, as it won't notice
+// the change and may overwrite it. Programs using this package to save
+// items to the same OPVault directory take turns; see LockTimeout.
+func (v *Vault) SaveItem(item *Item) error {
+	return v.saveItem(item, v.fieldClocks)
+}
+
+// saveItem saves an item as SaveItem does, ticking the clocks of the
+// fields it changes if tick is set.
+func (v *Vault) saveItem(item *Item, tick bool) error {
+	ws, ok := v.store.(writableStore)
+	if !ok {
+		return ErrReadOnly
+	}
+	if item.Uuid == "" {
+		item.Uuid = NewUUID()
+	} else if !validUUID(item.Uuid) {
+		return fmt.Errorf("%w: %q", ErrInvalidUUID, item.Uuid)
+	}
+	// The item is read and rewritten under the lock, so the version it
+	// replaces is the one other programs last wrote
+	if ls, ok := v.store.(lockingStore); ok {
+		unlock, err := ls.lockItem(item.Uuid)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	now := time.Now()
+
+	r, err := v.store.record(item.Uuid)
+	var kp *crypto.KeyPair
+	var old *Item   // As it was, for the journal
+	var prev record // As it was stored, to keep as an earlier version
+	overview := make(map[string]json.RawMessage)
+	switch err {
+	case nil:
+		if kp, err = crypto.DecryptItemKey(r.Key, v.masterKP); err != nil {
+			return err
+		}
+		data, err := crypto.DecryptOPData01(r.Overview, v.overviewKP)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, &overview); err != nil {
+			return err
+		}
+		if item.Details == nil {
+			if err = v.store.details(r); err != nil {
+				return err
+			}
+		}
+		if old, err = v.decryptOverview(r); err != nil {
+			return err
+		}
+		if err = v.decryptDetails(r, old); err != nil {
+			return err
+		}
+		prev = *r
+	case ErrItemNotFound:
+		kp, err = newItemKeys()
+		if err != nil {
+			return err
+		}
+		r = &record{Uuid: item.Uuid, Created: now.Unix()}
+		if r.Key, err = crypto.EncryptItemKey(kp, v.masterKP); err != nil {
+			return err
+		}
+		if item.Details == nil {
+			item.Details = json.RawMessage("{}")
+		}
+	default:
+		return err
+	}
+	if tick {
+		if item.Details == nil {
+			item.Details = old.Details
+		}
+		if err = tickFieldClocks(item, old, now); err != nil {
+			return err
+		}
+	}
+	if item.Created.IsZero() {
+		item.Created = time.Unix(r.Created, 0)
+	}
+	item.Updated = now
+
+	if err = encodeOverview(item, overview); err != nil {
+		return err
+	}
+	data, err := json.Marshal(overview)
+	if err != nil {
+		return err
+	}
+	if r.Overview, err = crypto.EncryptOPData01(data, v.overviewKP); err != nil {
+		return err
+	}
+	if item.Details != nil {
+		if r.Details, err = crypto.EncryptOPData01(item.Details, kp); err != nil {
+			return err
+		}
+	}
+	r.Category = item.Category.Uuid
+	r.Created = item.Created.Unix()
+	r.Updated = now.Unix()
+	r.Tx = now.Unix()
+	r.FaveIndex = item.FaveIndex
+	r.Folder = item.Folder
+
+	if err = ws.put(r, v.overviewKP); err != nil {
+		return err
+	}
+	v.cache.evict(r.Uuid)
+	if v.indexCache {
+		if err = v.evictIndexCache(r.Uuid); err != nil {
+			return fmt.Errorf("item saved, but not removed from the index cache: %s", err)
+		}
+	}
+
+	// The search index no longer reflects the vault
+	v.indexMu.Lock()
+	v.index = nil
+	v.indexMu.Unlock()
+
+	if err = v.journalSave(item, old, now); err != nil {
+		return fmt.Errorf("item saved, but not recorded in the journal: %s", err)
+	}
+	if old != nil && v.versions > 0 {
+		if err = v.keepVersion(&prev, now); err != nil {
+			return fmt.Errorf("item saved, but its previous version wasn't kept: %s", err)
+		}
+	}
+	return nil
+}
+
+func newItemKeys() (*crypto.KeyPair, error) {
+	b := make([]byte, crypto.EncKeySize+crypto.MACKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &crypto.KeyPair{EncKey: b[:crypto.EncKeySize], MACKey: b[crypto.EncKeySize:]}, nil
+}
+
+// encodeOverview sets the overview entries held by an item, removing the
+// ones that are empty.
+func encodeOverview(item *Item, overview map[string]json.RawMessage) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, k := range overviewKeys {
+		switch v := string(fields[k]); v {
+		case "", "null", `""`, "[]", "0":
+			delete(overview, k)
+		default:
+			overview[k] = fields[k]
+		}
+	}
+	return nil
+}